@@ -0,0 +1,77 @@
+//go:build cgo
+
+// gogeo-cshared exports the gogeo converter as a C shared library, so that Python, R,
+// C# and other languages with a C foreign function interface can convert files in
+// process instead of spawning the CLI.
+//
+// Build it with:
+//
+//	go build -buildmode=c-shared -o libgogeo.so ./cmd/gogeo-cshared
+//
+// which also writes the libgogeo.h header declaring:
+//
+//	char* gogeo_generate(char* input, char* output, char* optionsJSON);
+//	char* gogeo_version(void);
+//	void gogeo_free(char* s);
+//
+// gogeo_generate converts the file at input to GeoParquet at output. optionsJSON is
+// the JSON form of GenerateOptions, e.g. {"compression": "zstd", "bbox_column": true},
+// or NULL or empty for the defaults. It returns the JSON of the Report of the
+// conversion, or {"error": "..."} on failure. The strings returned are owned by the
+// caller, who frees them with gogeo_free.
+package main
+
+// #include <stdlib.h>
+import "C"
+
+import (
+	"encoding/json"
+	"unsafe"
+
+	"github.com/beyondcivic/gogeo/pkg/gogeo"
+	"github.com/beyondcivic/gogeo/pkg/version"
+)
+
+// A shared library needs a main package, whose main is never run
+func main() {}
+
+//export gogeo_generate
+func gogeo_generate(input, output, optionsJSON *C.char) *C.char {
+	if input == nil || output == nil {
+		return errorJSON("input and output must not be NULL")
+	}
+	var options []byte
+	if optionsJSON != nil {
+		options = []byte(C.GoString(optionsJSON))
+	}
+	opts, err := gogeo.ParseGenerateOptions(options)
+	if err != nil {
+		return errorJSON(err.Error())
+	}
+
+	report, err := gogeo.GenerateFile(C.GoString(input), C.GoString(output), opts...)
+	if err != nil {
+		return errorJSON(err.Error())
+	}
+	result, err := json.Marshal(report)
+	if err != nil {
+		return errorJSON(err.Error())
+	}
+	return C.CString(string(result))
+}
+
+//export gogeo_version
+func gogeo_version() *C.char {
+	return C.CString(version.Version)
+}
+
+//export gogeo_free
+func gogeo_free(s *C.char) {
+	C.free(unsafe.Pointer(s))
+}
+
+// errorJSON returns the result of a failed call
+func errorJSON(message string) *C.char {
+	result, _ := json.Marshal(map[string]string{"error": message})
+	return C.CString(string(result))
+}
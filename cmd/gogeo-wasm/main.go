@@ -0,0 +1,124 @@
+//go:build js && wasm
+
+// gogeo-wasm exposes the gogeo converter to JavaScript, so that web pages can convert
+// GeoJSON to GeoParquet, and read GeoParquet back, entirely in the browser.
+//
+// Build it with:
+//
+//	GOOS=js GOARCH=wasm go build -o gogeo.wasm ./cmd/gogeo-wasm
+//
+// and load it with the wasm_exec.js of the Go distribution, in lib/wasm of GOROOT. It
+// sets a global gogeo object with the functions:
+//
+//	gogeo.generate(input, options) // Promise<{data: Uint8Array, features: number}>
+//	gogeo.read(data)               // Promise<FeatureCollection>
+//	gogeo.version                  // string
+//
+// The input of generate is a string or a Uint8Array of GeoJSON, or of another format
+// given by options.input_format, and options names GenerateOptions in snake case,
+// e.g. {compression: "zstd", bbox_column: true}. The data of read is a Uint8Array of
+// GeoParquet. The promises are rejected with an Error on failure.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"syscall/js"
+
+	"github.com/beyondcivic/gogeo/pkg/gogeo"
+	"github.com/beyondcivic/gogeo/pkg/version"
+)
+
+func main() {
+	js.Global().Set("gogeo", js.ValueOf(map[string]any{
+		"generate": js.FuncOf(generate),
+		"read":     js.FuncOf(read),
+		"version":  version.Version,
+	}))
+	// The functions are called back until the page is closed
+	select {}
+}
+
+// generate converts its input to GeoParquet
+func generate(this js.Value, args []js.Value) any {
+	return promise(func() (any, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("generate expects an input")
+		}
+		input, err := bytesOf(args[0])
+		if err != nil {
+			return nil, err
+		}
+		var opts []gogeo.Option
+		if len(args) > 1 && args[1].Truthy() {
+			options := js.Global().Get("JSON").Call("stringify", args[1]).String()
+			if opts, err = gogeo.ParseGenerateOptions([]byte(options)); err != nil {
+				return nil, err
+			}
+		}
+
+		var output bytes.Buffer
+		report, err := gogeo.GenerateFrom(bytes.NewReader(input), &output, opts...)
+		if err != nil {
+			return nil, err
+		}
+		data := js.Global().Get("Uint8Array").New(output.Len())
+		js.CopyBytesToJS(data, output.Bytes())
+		return map[string]any{"data": data, "features": report.Features}, nil
+	})
+}
+
+// read decodes GeoParquet to a GeoJSON FeatureCollection
+func read(this js.Value, args []js.Value) any {
+	return promise(func() (any, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("read expects GeoParquet data")
+		}
+		data, err := bytesOf(args[0])
+		if err != nil {
+			return nil, err
+		}
+		fc, err := gogeo.ReadGeoParquetFrom(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		geojson, err := json.Marshal(fc)
+		if err != nil {
+			return nil, err
+		}
+		return js.Global().Get("JSON").Call("parse", string(geojson)), nil
+	})
+}
+
+// bytesOf returns the bytes of a string or a Uint8Array
+func bytesOf(value js.Value) ([]byte, error) {
+	if value.Type() == js.TypeString {
+		return []byte(value.String()), nil
+	}
+	if !value.InstanceOf(js.Global().Get("Uint8Array")) {
+		return nil, fmt.Errorf("expected a string or a Uint8Array")
+	}
+	data := make([]byte, value.Length())
+	js.CopyBytesToGo(data, value)
+	return data, nil
+}
+
+// promise runs fn without blocking the event loop and returns a Promise of its result
+func promise(fn func() (any, error)) js.Value {
+	var executor js.Func
+	executor = js.FuncOf(func(this js.Value, args []js.Value) any {
+		resolve, reject := args[0], args[1]
+		go func() {
+			defer executor.Release()
+			result, err := fn()
+			if err != nil {
+				reject.Invoke(js.Global().Get("Error").New(err.Error()))
+				return
+			}
+			resolve.Invoke(result)
+		}()
+		return nil
+	})
+	return js.Global().Get("Promise").New(executor)
+}
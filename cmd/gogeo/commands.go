@@ -5,11 +5,22 @@
 package cmd
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
+	"net"
 	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/beyondcivic/gogeo/pkg/gogeo"
 	"github.com/beyondcivic/gogeo/pkg/version"
+	"github.com/paulmach/orb/geojson"
 	"github.com/spf13/cobra"
 )
 
@@ -33,50 +44,2571 @@ func versionCmd() *cobra.Command {
 // Generate command
 func generateCmd() *cobra.Command {
 	var generateCmd = &cobra.Command{
-		Use:   "generate [geojsonPath]",
+		Use:   "generate [geojsonPath...]",
 		Short: "Generate GeoParquet from a GeoJsonfile",
-		Long:  `Generate GeoParquet from a GeoJsonfile, automatically inferring data types.`,
-		Args:  cobra.ExactArgs(1),
+		Long: `Generate GeoParquet from a GeoJsonfile, automatically inferring data types.
+
+Newline-delimited GeoJSON (.geojsonl, .geojsons, .ndjson, .jsonl) with one Feature
+per line is detected from the extension, or selected with --input-format geojsonl.
+
+A GeoPackage (.gpkg) layer is converted with its declared CRS unless --crs is
+given; use --layer to select it when the GeoPackage has several feature tables.
+
+KML and KMZ files (.kml, .kmz) are converted Placemark by Placemark, with their
+name, description and ExtendedData as properties.
+
+CSV files (.csv) need a header line and the columns holding the geometry: --lon and
+--lat for points, or --wkt for WKT geometries. The other columns are typed from
+their values, e.g. "gogeo generate points.csv --lon lon --lat lat".
+
+GML files (.gml), such as WFS GetFeature responses, are converted feature member
+by feature member. Coordinates in a urn:ogc:def:crs:EPSG:: CRS with latitude first
+are swapped to longitude/latitude, and the srsName becomes the CRS unless --crs is given.
+
+Use "-" as the input to read GeoJSON from stdin and "-o -" to write GeoParquet to
+stdout, e.g. "cat features.geojson | gogeo generate - -o - > features.parquet".
+
+Several files or glob patterns (e.g. "data/*.geojson") can be given to convert
+them in one invocation; use --out-dir to choose where the outputs are written.
+
+A ZIP archive is converted member by member: each .geojson file it contains is
+read directly from the archive and written to <member>.parquet.
+
+HTTP(S) URLs are streamed from the server; use --header to pass an
+authorization token, e.g. --header "Authorization: Bearer $TOKEN".
+
+With --append, the features are added as new row groups of the existing GeoParquet
+file given with --output, whose bbox and geometry types are extended to cover them.
+The existing rows are copied as they are; the new ones are written with the geometry
+columns, CRS and property columns of the file, so every property of the input must be
+a column of the file with a compatible type.
+
+An existing local output is not overwritten unless --force is given. With
+--if-newer, inputs whose output is newer than them are skipped and the others
+converted, overwriting outdated outputs; inputs without a modification time, such as
+URLs and stdin, are always converted.
+
+With --dry-run, the input is converted without writing anything, to check a pipeline
+before running it: the number of features, the size of the output, and the geometry
+and property columns it would hold are printed. The conversion runs in full, so that
+the same errors are reported, at the cost of reading and encoding the input.`,
+		Args: cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			geojsonPath := args[0]
 			flagOutputPath, _ := cmd.Flags().GetString("output")
+			flagOutDir, _ := cmd.Flags().GetString("out-dir")
+			flagHeaders, _ := cmd.Flags().GetStringArray("header")
+			flagAppend, _ := cmd.Flags().GetBool("append")
+			flagForce, _ := cmd.Flags().GetBool("force")
+			flagIfNewer, _ := cmd.Flags().GetBool("if-newer")
+			flagDryRun, _ := cmd.Flags().GetBool("dry-run")
+			overwrite := overwritePolicy{force: flagForce, ifNewer: flagIfNewer}
 
-			// Validate input file
-			if !fileExists(geojsonPath) {
-				fmt.Printf("Error: GeoJsonfile '%s' does not exist.\n", geojsonPath)
+			header, err := headerFlags(flagHeaders)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			registerHeaders(header)
+
+			inputs, err := expandInputs(args)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
 				os.Exit(1)
 			}
 
-			if !isGeoJsonFile(geojsonPath) {
-				fmt.Printf("Error: File '%s' does not appear to be a GeoJsonfile.\n", geojsonPath)
+			opts, err := generateOptions(cmd)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
 				os.Exit(1)
 			}
 
+			if len(inputs) > 1 || flagOutDir != "" || gogeo.IsZipFile(inputs[0]) {
+				if flagAppend || flagDryRun {
+					fmt.Printf("Error: --append and --dry-run take a single input.\n")
+					os.Exit(1)
+				}
+				if flagOutputPath != "" {
+					fmt.Printf("Error: --output cannot be used with multiple inputs or archives, use --out-dir instead.\n")
+					os.Exit(1)
+				}
+				if !generateBatch(cmd, inputs, flagOutDir, overwrite, opts) {
+					os.Exit(1)
+				}
+				return
+			}
+
+			geojsonPath := inputs[0]
+
+			// Validate input file
+			if isLocalPath(geojsonPath) {
+				if !fileExists(geojsonPath) {
+					fmt.Printf("Error: GeoJsonfile '%s' does not exist.\n", geojsonPath)
+					os.Exit(1)
+				}
+
+				if !isFeatureFile(geojsonPath) {
+					fmt.Printf("Error: File '%s' does not appear to be a GeoJSON, GeoPackage, KML, CSV, GML or OSM PBF file.\n", geojsonPath)
+					os.Exit(1)
+				}
+			}
+
+			if flagDryRun {
+				if flagAppend {
+					fmt.Printf("Error: --dry-run cannot be used with --append.\n")
+					os.Exit(1)
+				}
+				fmt.Printf("Checking the conversion of '%s'...\n", geojsonPath)
+				report, size, err := dryRunFile(cmd.Context(), geojsonPath, opts)
+				if err != nil {
+					fmt.Printf("Error generating metadata: %v\n", err)
+					printTypeConflicts(os.Stdout, err)
+					os.Exit(1)
+				}
+				fmt.Printf("✓ Dry run of '%s', nothing was written\n\n", geojsonPath)
+				printDryRun(os.Stdout, report, size)
+				printRepairs(os.Stdout, report)
+				return
+			}
+
 			// Determine output path
 			outputPath := determineOutputPath(flagOutputPath, geojsonPath)
-
-			// Validate output path
-			if err := gogeo.ValidateOutputPath(outputPath); err != nil {
-				fmt.Printf("Error: Invalid output path: %v\n", err)
+			if flagOutputPath == "" && gogeo.IsRemoteURI(geojsonPath) {
+				outputPath = determineOutputPath("", urlOutputPath(geojsonPath))
+			}
+			// The default output path cannot be derived from stdin
+			if geojsonPath == stdioPath && outputPath == replaceExtension(stdioPath, ".parquet") {
+				fmt.Printf("Error: --output is required when reading from stdin.\n")
 				os.Exit(1)
 			}
 
+			if flagAppend {
+				if flagForce || flagIfNewer {
+					fmt.Printf("Error: --force and --if-newer cannot be used with --append.\n")
+					os.Exit(1)
+				}
+				if geojsonPath == stdioPath || !isLocalPath(outputPath) || !fileExists(outputPath) {
+					fmt.Printf("Error: --append needs an input file and an existing local GeoParquet file as --output.\n")
+					os.Exit(1)
+				}
+				fmt.Printf("Appending '%s' to '%s'...\n", geojsonPath, outputPath)
+				report, err := appendFile(cmd.Context(), geojsonPath, outputPath, opts)
+				if err != nil {
+					fmt.Printf("Error appending features: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Printf("✓ Appended %d features to: %s\n", report.Features, outputPath)
+				printRepairs(os.Stdout, report)
+				return
+			}
+
+			// Status messages go to stderr when the GeoParquet is written to stdout
+			status := os.Stdout
+			if outputPath == stdioPath {
+				status = os.Stderr
+			} else if isLocalPath(outputPath) {
+				skip, err := overwrite.check(geojsonPath, outputPath)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				if skip {
+					fmt.Printf("✓ %s is up to date with '%s', skipped\n", outputPath, geojsonPath)
+					return
+				}
+				if err := gogeo.ValidateOutputPath(outputPath); err != nil {
+					fmt.Printf("Error: Invalid output path: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
 			// Generate metadata
-			fmt.Printf("Generating GeoParquet file for '%s'...\n", geojsonPath)
-			_, err := gogeo.Generate(geojsonPath, outputPath)
+			fmt.Fprintf(status, "Generating GeoParquet file for '%s'...\n", geojsonPath)
+			report, err := generateFile(cmd.Context(), geojsonPath, outputPath, opts)
 			if err != nil {
-				fmt.Printf("Error generating metadata: %v\n", err)
+				fmt.Fprintf(status, "Error generating metadata: %v\n", err)
+				printTypeConflicts(status, err)
 				os.Exit(1)
 			}
 
-			fmt.Printf("✓ GeoParquet file generated successfully")
-			if outputPath != "" {
-				fmt.Printf(" and saved to: %s\n", outputPath)
+			fmt.Fprintf(status, "✓ GeoParquet file with %d features generated successfully", report.Features)
+			if outputPath != stdioPath {
+				fmt.Fprintf(status, " and saved to: %s\n", outputPath)
+			} else {
+				fmt.Fprintln(status)
 			}
+			printRepairs(status, report)
 
 		},
 	}
 	generateCmd.Flags().StringP("output", "o", "", "Output path for the GeoParquet file")
+	generateCmd.Flags().String("out-dir", "", "Directory for the GeoParquet files when converting several inputs")
+	generateCmd.Flags().Bool("append", false, "Add the features as new row groups of the existing --output file")
+	generateCmd.Flags().Bool("force", false, "Overwrite existing output files")
+	generateCmd.Flags().Bool("if-newer", false, "Skip the inputs whose output is newer than them, overwriting outdated outputs")
+	generateCmd.Flags().Bool("dry-run", false, "Convert without writing anything and print the features, size and columns of the output")
+	generateCmd.Flags().StringArray("header", nil, "HTTP header sent when fetching URL inputs, as 'Name: value' (repeatable)")
+	addGenerateFlags(generateCmd)
 
 	return generateCmd
 }
+
+// addGenerateFlags registers the flags controlling how GeoParquet is generated from
+// input files
+func addGenerateFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("progress", false, "Display a progress bar while writing")
+	cmd.Flags().String("input-format", "", "Format of the input: geojson, geojsonl, gpkg, kml, kmz, csv, gml or pbf (default detected from the extension)")
+	cmd.Flags().String("layer", "", "Layer to convert from a GeoPackage with several feature tables")
+	cmd.Flags().String("lon", "", "CSV column holding the longitude of point geometries")
+	cmd.Flags().String("lat", "", "CSV column holding the latitude of point geometries")
+	cmd.Flags().String("wkt", "", "CSV column holding WKT geometries")
+	addWriteFlags(cmd)
+}
+
+// addWriteFlags registers the flags controlling how GeoParquet is written, without
+// those selecting the input format and --progress, for commands whose input is not a
+// file of a choice of formats. generateOptions reads the flags that are not
+// registered as unset.
+func addWriteFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("bbox-column", false, "Write a per-row bbox covering column")
+	cmd.Flags().Bool("bbox-properties", false, "Write each feature's bbox as bbox_xmin, bbox_ymin, bbox_xmax and bbox_ymax columns")
+	cmd.Flags().String("geometry-encoding", "wkb", "Encoding of the geometry column: wkb or wkt")
+	cmd.Flags().String("geometry-name", gogeo.DefaultGeometryColumn, "Name of the geometry column")
+	cmd.Flags().StringArray("geometry-column", nil, "Additional geometry column read from a property, as name[:wkb|wkt] (repeatable)")
+	cmd.Flags().String("primary-column", "", "Geometry column recorded as primary_column (default the --geometry-name column)")
+	cmd.Flags().IntP("jobs", "j", 1, "Number of workers encoding features in parallel (0 for one per CPU)")
+	cmd.Flags().String("compression", gogeo.DefaultCompression, "Compression codec: zstd, snappy, gzip, lz4, brotli or none")
+	cmd.Flags().Int64("row-group-size", 0, "Maximum number of rows per row group (default parquet-go's)")
+	cmd.Flags().String("page-size", "", "Size of the buffer in which each column page is encoded, in bytes or with a KiB, MiB or GiB suffix (default parquet-go's 256KiB)")
+	cmd.Flags().String("write-buffer-size", "", "Size of the buffer collecting pages before they are written to the output, 0 to write them through (default parquet-go's 32KiB)")
+	cmd.Flags().String("max-memory", "", "Memory budget of the buffers growing with the input, such as 512MB, flushing row groups and spilling to temporary files to stay within it (default no limit)")
+	cmd.Flags().StringSlice("skip-statistics", nil, "Write no min/max statistics for these columns, or struct fields as column.field (comma separated or repeatable)")
+	cmd.Flags().Int("truncate-statistics", 0, "Truncate the min/max statistics of string and binary columns to this number of bytes (default keep them whole)")
+	cmd.Flags().String("parquet-version", "", "Parquet format version: 1.0 for readers predating Parquet 2, or 2.x (default 2.x)")
+	cmd.Flags().String("compat", "", "Write files for an engine rejecting newer Parquet features: athena, spark2 or bigquery")
+	cmd.Flags().String("spatial-sort", "", "Order features along a space-filling curve before writing: hilbert or zorder (holds the features in memory)")
+	cmd.Flags().StringSlice("sort-by", nil, "Order features by property columns, as name[:asc|desc] separated by commas (holds the features in memory)")
+	cmd.Flags().String("where", "", "Only convert features matching a filter, e.g. \"population > 10000 AND country = 'US'\"")
+	cmd.Flags().String("join", "", "CSV lookup table whose columns are added to the features matching a row (requires --on)")
+	cmd.Flags().String("on", "", "Key column shared by the --join table and the feature properties")
+	addColumnFlags(cmd)
+	cmd.Flags().Bool("infer-temporal", false, "Write properties holding RFC 3339 timestamps, dates or epoch milliseconds as TIMESTAMP and DATE columns")
+	cmd.Flags().StringArray("datetime-format", nil, "Also parse timestamps and dates in this Go time layout, e.g. '02/01/2006 15:04' (repeatable, implies --infer-temporal)")
+	cmd.Flags().StringArray("datetime-column", nil, "Write a column as timestamps, or dates for a layout without a time of day, as column[:layout] (repeatable)")
+	cmd.Flags().Bool("infer-uuid", false, "Write properties holding UUIDs as 16-byte columns with the UUID logical type")
+	cmd.Flags().Bool("plain-json", false, "Write object and array properties as plain UTF8 strings instead of JSON columns")
+	cmd.Flags().Bool("struct-columns", false, "Write object properties as struct columns with a column per field, recursively, instead of JSON")
+	cmd.Flags().Bool("list-columns", false, "Write properties holding arrays of scalars as LIST columns of their elements instead of JSON")
+	cmd.Flags().Bool("narrow-integers", false, "Write integer columns whose values fit in 8, 16 or 32 bits as INT(8), INT(16) or INT(32) instead of INT64")
+	cmd.Flags().Bool("required-columns", false, "Write properties present and non-null in every feature as REQUIRED columns instead of OPTIONAL")
+	cmd.Flags().Bool("strict-types", false, "Fail with a report of the values whose type conflicts with their column instead of writing the column as strings")
+	cmd.Flags().Int("enum-columns", 0, "Dictionary-encode string columns with at most this many distinct values and record them in the file metadata")
+	cmd.Flags().StringSlice("encoding", nil, "Write a property column with an encoding, as column=encoding with encoding plain, dictionary, delta or byte-stream-split (comma separated or repeatable)")
+	cmd.Flags().String("id-column", gogeo.DefaultIDColumn, "Column holding the feature ids, restored as ids when the file is read back; empty to drop the ids")
+	addTransformFlags(cmd)
+	cmd.Flags().String("crs", "", "CRS of the input coordinates, as a code (e.g. EPSG:3857) or a PROJJSON file (default EPSG:4326)")
+}
+
+// addColumnFlags registers the flags selecting, renaming and casting property columns
+func addColumnFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("include-columns", nil, "Only keep these properties (comma separated or repeatable)")
+	cmd.Flags().StringSlice("exclude-columns", nil, "Drop these properties (comma separated or repeatable)")
+	cmd.Flags().StringSlice("rename", nil, "Rename a property, as old=new (comma separated or repeatable)")
+	cmd.Flags().StringSlice("cast", nil, "Write a column as another type, as column:type with type string, int, uint, float, bool, timestamp, date, uuid or json (comma separated or repeatable)")
+}
+
+// addTransformFlags registers the flags transforming the feature geometries and deriving columns from them
+func addTransformFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("split-antimeridian", false, "Cut lines and polygons crossing the antimeridian in two, as RFC 7946 recommends")
+	cmd.Flags().Float64("simplify", 0, "Simplify lines and polygons with Douglas-Peucker, removing vertices closer than this tolerance in coordinate units")
+	cmd.Flags().Int("precision", 0, "Round coordinates to this number of decimal places (default keep them as they are)")
+	cmd.Flags().Bool("make-valid", false, "Repair invalid geometries, such as unclosed or self-intersecting rings, and report those that cannot be")
+	cmd.Flags().Bool("promote-to-multi", false, "Write Point, LineString and Polygon geometries as MultiPoint, MultiLineString and MultiPolygon")
+	cmd.Flags().String("collections", "", "Handle GeometryCollection geometries: explode (one row per member), flatten (to the members of the highest dimension) or reject (default keep them)")
+	cmd.Flags().String("null-geometries", "", "Handle features without a geometry: null (write a null in an optional column), skip or fail (default null)")
+	cmd.Flags().String("empty-geometries", "", "Handle empty geometries, such as POINT EMPTY: keep (write them as EMPTY), drop or fail (default keep)")
+	cmd.Flags().String("centroid-column", "", "Add a geometry column of this name holding the centroid of each geometry")
+	cmd.Flags().String("point-on-surface-column", "", "Add a geometry column of this name holding a point within each geometry, for labels")
+	cmd.Flags().StringArray("add-area", nil, "Add a column holding the geodesic area of the polygons, as name[:m2|km2|ha|mi2], the unit defaulting to the suffix of the name or m2 (repeatable)")
+	cmd.Flags().StringArray("add-length", nil, "Add a column holding the geodesic length of the lines, as name[:m|km|mi|ft], the unit defaulting to the suffix of the name or m (repeatable)")
+	cmd.Flags().StringArray("add-geohash", nil, "Add a column holding the geohash of the centroid of each geometry, as [name:]precision with precision 1 to 12, the name defaulting to geohash (repeatable)")
+	cmd.Flags().StringArray("add-s2", nil, "Add an INT64 column holding the S2 cell id of the centroid of each geometry, as [name:]level with level 0 to 30, the name defaulting to s2 (repeatable)")
+	cmd.Flags().StringArray("add-h3", nil, "Add a UINT64 column holding the H3 cell id of the centroid of each geometry, as [name:]res with resolution 0 to 15, the name defaulting to h3 (repeatable)")
+	cmd.Flags().StringArray("add-quadkey", nil, "Add a column holding the quadkey of the XYZ tile containing the centroid of each geometry, as [name:]zoom with zoom 1 to 30, the name defaulting to quadkey (repeatable)")
+	cmd.Flags().Bool("counterclockwise", false, "Orient polygon exteriors counterclockwise and holes clockwise (RFC 7946) and record it in the geo metadata")
+}
+
+// transformOptions builds the geometry transformation options from the flags registered by addTransformFlags
+func transformOptions(cmd *cobra.Command) ([]gogeo.Option, error) {
+	flagSplitAntimeridian, _ := cmd.Flags().GetBool("split-antimeridian")
+	flagSimplify, _ := cmd.Flags().GetFloat64("simplify")
+	flagPrecision, _ := cmd.Flags().GetInt("precision")
+	flagMakeValid, _ := cmd.Flags().GetBool("make-valid")
+	flagCounterclockwise, _ := cmd.Flags().GetBool("counterclockwise")
+	flagPromoteToMulti, _ := cmd.Flags().GetBool("promote-to-multi")
+	flagCollections, _ := cmd.Flags().GetString("collections")
+	flagNullGeometries, _ := cmd.Flags().GetString("null-geometries")
+	flagEmptyGeometries, _ := cmd.Flags().GetString("empty-geometries")
+	flagCentroidColumn, _ := cmd.Flags().GetString("centroid-column")
+	flagPointOnSurfaceColumn, _ := cmd.Flags().GetString("point-on-surface-column")
+	flagAddArea, _ := cmd.Flags().GetStringArray("add-area")
+	flagAddLength, _ := cmd.Flags().GetStringArray("add-length")
+	flagAddGeohash, _ := cmd.Flags().GetStringArray("add-geohash")
+	flagAddS2, _ := cmd.Flags().GetStringArray("add-s2")
+	flagAddH3, _ := cmd.Flags().GetStringArray("add-h3")
+	flagAddQuadkey, _ := cmd.Flags().GetStringArray("add-quadkey")
+
+	var opts []gogeo.Option
+	if flagSplitAntimeridian {
+		opts = append(opts, gogeo.WithSplitAntimeridian())
+	}
+	if flagSimplify != 0 {
+		opts = append(opts, gogeo.WithSimplify(flagSimplify))
+	}
+	if cmd.Flags().Changed("precision") {
+		opts = append(opts, gogeo.WithPrecision(flagPrecision))
+	}
+	if flagMakeValid {
+		opts = append(opts, gogeo.WithMakeValid())
+	}
+	if flagCounterclockwise {
+		opts = append(opts, gogeo.WithCounterclockwise())
+	}
+	if flagPromoteToMulti {
+		opts = append(opts, gogeo.WithPromoteToMulti())
+	}
+	if flagCollections != "" {
+		opts = append(opts, gogeo.WithCollections(flagCollections))
+	}
+	if flagNullGeometries != "" {
+		opts = append(opts, gogeo.WithNullGeometries(flagNullGeometries))
+	}
+	if flagEmptyGeometries != "" {
+		opts = append(opts, gogeo.WithEmptyGeometries(flagEmptyGeometries))
+	}
+	if flagCentroidColumn != "" {
+		opts = append(opts, gogeo.WithCentroidColumn(flagCentroidColumn))
+	}
+	if flagPointOnSurfaceColumn != "" {
+		opts = append(opts, gogeo.WithPointOnSurfaceColumn(flagPointOnSurfaceColumn))
+	}
+	for _, value := range flagAddArea {
+		name, unit, _ := strings.Cut(value, ":")
+		opts = append(opts, gogeo.WithAreaColumn(name, unit))
+	}
+	for _, value := range flagAddLength {
+		name, unit, _ := strings.Cut(value, ":")
+		opts = append(opts, gogeo.WithLengthColumn(name, unit))
+	}
+	for _, value := range flagAddGeohash {
+		name, precision, err := cellFlag(value, "geohash")
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, gogeo.WithGeohashColumn(name, precision))
+	}
+	for _, value := range flagAddS2 {
+		name, level, err := cellFlag(value, "s2")
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, gogeo.WithS2Column(name, level))
+	}
+	for _, value := range flagAddH3 {
+		name, resolution, err := cellFlag(value, "h3")
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, gogeo.WithH3Column(name, resolution))
+	}
+	for _, value := range flagAddQuadkey {
+		name, zoom, err := cellFlag(value, "quadkey")
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, gogeo.WithQuadkeyColumn(name, zoom))
+	}
+	return opts, nil
+}
+
+// cellFlag parses the value of a grid cell flag, [name:]level, the name defaulting to
+// the name of the grid
+func cellFlag(value, grid string) (string, int, error) {
+	name, level, found := strings.Cut(value, ":")
+	if !found {
+		name, level = grid, value
+	}
+	n, err := strconv.Atoi(level)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid %s %q, expected [name:]level", grid, value)
+	}
+	return name, n, nil
+}
+
+// columnOptions builds the column selection and cast options from the flags registered by addColumnFlags
+func columnOptions(cmd *cobra.Command) ([]gogeo.Option, error) {
+	flagInclude, _ := cmd.Flags().GetStringSlice("include-columns")
+	flagExclude, _ := cmd.Flags().GetStringSlice("exclude-columns")
+	flagRename, _ := cmd.Flags().GetStringSlice("rename")
+	flagCast, _ := cmd.Flags().GetStringSlice("cast")
+
+	var opts []gogeo.Option
+	if len(flagInclude) > 0 {
+		opts = append(opts, gogeo.WithIncludeColumns(flagInclude...))
+	}
+	if len(flagExclude) > 0 {
+		opts = append(opts, gogeo.WithExcludeColumns(flagExclude...))
+	}
+	for _, value := range flagRename {
+		from, to, ok := strings.Cut(value, "=")
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("invalid rename %q, expected old=new", value)
+		}
+		opts = append(opts, gogeo.WithRenameColumn(from, to))
+	}
+	for _, value := range flagCast {
+		column, typeName, ok := strings.Cut(value, ":")
+		if !ok || column == "" {
+			return nil, fmt.Errorf("invalid cast %q, expected column:type", value)
+		}
+		propType, err := gogeo.ParsePropertyType(typeName)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, gogeo.WithCast(column, propType))
+	}
+	return opts, nil
+}
+
+// generateOptions builds the conversion options from the flags registered by addGenerateFlags
+func generateOptions(cmd *cobra.Command) ([]gogeo.Option, error) {
+	flagProgress, _ := cmd.Flags().GetBool("progress")
+	flagBBoxColumn, _ := cmd.Flags().GetBool("bbox-column")
+	flagBBoxProperties, _ := cmd.Flags().GetBool("bbox-properties")
+	flagCRS, _ := cmd.Flags().GetString("crs")
+	flagRowGroupSize, _ := cmd.Flags().GetInt64("row-group-size")
+	flagPageSize, _ := cmd.Flags().GetString("page-size")
+	flagWriteBufferSize, _ := cmd.Flags().GetString("write-buffer-size")
+	flagMaxMemory, _ := cmd.Flags().GetString("max-memory")
+	flagSkipStatistics, _ := cmd.Flags().GetStringSlice("skip-statistics")
+	flagTruncateStatistics, _ := cmd.Flags().GetInt("truncate-statistics")
+	flagParquetVersion, _ := cmd.Flags().GetString("parquet-version")
+	flagCompat, _ := cmd.Flags().GetString("compat")
+	flagSpatialSort, _ := cmd.Flags().GetString("spatial-sort")
+	flagSortBy, _ := cmd.Flags().GetStringSlice("sort-by")
+	flagWhere, _ := cmd.Flags().GetString("where")
+	flagJoin, _ := cmd.Flags().GetString("join")
+	flagOn, _ := cmd.Flags().GetString("on")
+	flagCompression, _ := cmd.Flags().GetString("compression")
+	flagJobs, _ := cmd.Flags().GetInt("jobs")
+	flagGeometryEncoding, _ := cmd.Flags().GetString("geometry-encoding")
+	flagGeometryName, _ := cmd.Flags().GetString("geometry-name")
+	flagGeometryColumns, _ := cmd.Flags().GetStringArray("geometry-column")
+	flagPrimaryColumn, _ := cmd.Flags().GetString("primary-column")
+	flagInputFormat, _ := cmd.Flags().GetString("input-format")
+	flagLayer, _ := cmd.Flags().GetString("layer")
+	flagLon, _ := cmd.Flags().GetString("lon")
+	flagLat, _ := cmd.Flags().GetString("lat")
+	flagWKT, _ := cmd.Flags().GetString("wkt")
+	flagInferTemporal, _ := cmd.Flags().GetBool("infer-temporal")
+	flagDatetimeFormats, _ := cmd.Flags().GetStringArray("datetime-format")
+	flagDatetimeColumns, _ := cmd.Flags().GetStringArray("datetime-column")
+	flagInferUUID, _ := cmd.Flags().GetBool("infer-uuid")
+	flagPlainJSON, _ := cmd.Flags().GetBool("plain-json")
+	flagStructColumns, _ := cmd.Flags().GetBool("struct-columns")
+	flagListColumns, _ := cmd.Flags().GetBool("list-columns")
+	flagNarrowIntegers, _ := cmd.Flags().GetBool("narrow-integers")
+	flagRequiredColumns, _ := cmd.Flags().GetBool("required-columns")
+	flagStrictTypes, _ := cmd.Flags().GetBool("strict-types")
+	flagEnumColumns, _ := cmd.Flags().GetInt("enum-columns")
+	flagEncodings, _ := cmd.Flags().GetStringSlice("encoding")
+	flagIDColumn, _ := cmd.Flags().GetString("id-column")
+
+	var opts []gogeo.Option
+	if flagInputFormat != "" {
+		opts = append(opts, gogeo.WithInputFormat(flagInputFormat))
+	}
+	if flagLayer != "" {
+		opts = append(opts, gogeo.WithLayer(flagLayer))
+	}
+	if flagLon != "" || flagLat != "" {
+		opts = append(opts, gogeo.WithLonLatColumns(flagLon, flagLat))
+	}
+	if flagWKT != "" {
+		opts = append(opts, gogeo.WithWKTColumn(flagWKT))
+	}
+	if flagProgress {
+		opts = append(opts, gogeo.WithProgress(printProgress))
+	}
+	if flagBBoxColumn {
+		opts = append(opts, gogeo.WithBBoxColumn())
+	}
+	if flagInferTemporal {
+		opts = append(opts, gogeo.WithTemporalInference())
+	}
+	if len(flagDatetimeFormats) > 0 {
+		opts = append(opts, gogeo.WithDatetimeFormats(flagDatetimeFormats...))
+	}
+	for _, value := range flagDatetimeColumns {
+		// Layouts may hold colons, the column name may not
+		column, layout, _ := strings.Cut(value, ":")
+		opts = append(opts, gogeo.WithDatetimeColumn(column, layout))
+	}
+	if flagInferUUID {
+		opts = append(opts, gogeo.WithUUIDInference())
+	}
+	if flagPlainJSON {
+		opts = append(opts, gogeo.WithPlainJSON())
+	}
+	if flagStructColumns {
+		opts = append(opts, gogeo.WithStructColumns())
+	}
+	if flagListColumns {
+		opts = append(opts, gogeo.WithListColumns())
+	}
+	if flagNarrowIntegers {
+		opts = append(opts, gogeo.WithIntegerNarrowing())
+	}
+	if flagRequiredColumns {
+		opts = append(opts, gogeo.WithRequiredColumns())
+	}
+	if flagStrictTypes {
+		opts = append(opts, gogeo.WithStrictTypes())
+	}
+	if cmd.Flags().Changed("enum-columns") {
+		opts = append(opts, gogeo.WithEnumColumns(flagEnumColumns))
+	}
+	if cmd.Flags().Changed("id-column") {
+		opts = append(opts, gogeo.WithIDColumn(flagIDColumn))
+	}
+	for _, value := range flagEncodings {
+		column, encoding, ok := strings.Cut(value, "=")
+		if !ok || column == "" {
+			return nil, fmt.Errorf("invalid encoding %q, expected column=encoding", value)
+		}
+		opts = append(opts, gogeo.WithColumnEncoding(column, encoding))
+	}
+	if flagBBoxProperties {
+		opts = append(opts, gogeo.WithBBoxProperties())
+	}
+	if flagGeometryEncoding != "" {
+		opts = append(opts, gogeo.WithGeometryEncoding(flagGeometryEncoding))
+	}
+	if flagGeometryName != "" {
+		opts = append(opts, gogeo.WithGeometryName(flagGeometryName))
+	}
+	for _, value := range flagGeometryColumns {
+		columnOpt, err := geometryColumnOption(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid geometry column: %w", err)
+		}
+		opts = append(opts, columnOpt)
+	}
+	if flagPrimaryColumn != "" {
+		opts = append(opts, gogeo.WithPrimaryColumn(flagPrimaryColumn))
+	}
+	if flagJobs != 1 {
+		opts = append(opts, gogeo.WithJobs(flagJobs))
+	}
+	if flagCompat != "" {
+		opts = append(opts, gogeo.WithCompatibility(flagCompat))
+	}
+	// The compression of the profile applies unless one is given
+	if flagCompression != "" && (flagCompat == "" || cmd.Flags().Changed("compression")) {
+		opts = append(opts, gogeo.WithCompression(flagCompression))
+	}
+	if flagParquetVersion != "" {
+		opts = append(opts, gogeo.WithParquetVersion(flagParquetVersion))
+	}
+	if flagRowGroupSize > 0 {
+		opts = append(opts, gogeo.WithRowGroupSize(flagRowGroupSize))
+	}
+	if flagPageSize != "" {
+		size, err := parseByteSize(flagPageSize, math.MaxInt32)
+		if err != nil || size == 0 {
+			return nil, fmt.Errorf("invalid page size %q, expected a positive number of bytes such as 64KiB", flagPageSize)
+		}
+		opts = append(opts, gogeo.WithPageSize(size))
+	}
+	if flagWriteBufferSize != "" {
+		size, err := parseByteSize(flagWriteBufferSize, math.MaxInt32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid write buffer size %q, expected a number of bytes such as 1MiB", flagWriteBufferSize)
+		}
+		opts = append(opts, gogeo.WithWriteBufferSize(size))
+	}
+	if flagMaxMemory != "" {
+		size, err := parseByteSize(flagMaxMemory, math.MaxInt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory budget %q, expected a number of bytes such as 512MB", flagMaxMemory)
+		}
+		opts = append(opts, gogeo.WithMaxMemory(int64(size)))
+	}
+	if len(flagSkipStatistics) > 0 {
+		opts = append(opts, gogeo.WithSkipStatistics(flagSkipStatistics...))
+	}
+	if flagTruncateStatistics != 0 {
+		opts = append(opts, gogeo.WithStatisticsTruncation(flagTruncateStatistics))
+	}
+	if flagSpatialSort != "" {
+		opts = append(opts, gogeo.WithSpatialSort(flagSpatialSort))
+	}
+	if len(flagSortBy) > 0 {
+		sortOpt, err := sortByOption(flagSortBy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sort column: %w", err)
+		}
+		opts = append(opts, sortOpt)
+	}
+	if flagWhere != "" {
+		opts = append(opts, gogeo.WithWhere(flagWhere))
+	}
+	if flagJoin != "" || flagOn != "" {
+		joinOpt, err := joinOption(flagJoin, flagOn)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, joinOpt)
+	}
+	columnOpts, err := columnOptions(cmd)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, columnOpts...)
+	transformOpts, err := transformOptions(cmd)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, transformOpts...)
+	if flagCRS != "" {
+		crsOpt, err := crsOption(flagCRS)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CRS definition: %w", err)
+		}
+		opts = append(opts, crsOpt)
+	}
+
+	return opts, nil
+}
+
+// generateBatch converts several GeoJSON files or remote objects, or the GeoJSON members of ZIP archives,
+// into outDir, reporting the outcome of each. It returns false if any conversion failed.
+func generateBatch(cmd *cobra.Command, inputs []string, outDir string, overwrite overwritePolicy, opts []gogeo.Option) bool {
+	if outDir != "" && isLocalPath(outDir) {
+		if err := os.MkdirAll(outDir, 0750); err != nil {
+			fmt.Printf("Error: Failed to create output directory: %v\n", err)
+			return false
+		}
+	}
+
+	fmt.Printf("Generating GeoParquet files for %d inputs...\n", len(inputs))
+	outputs := make(map[string]string)
+	converted, failed, skipped := 0, 0, 0
+	convert := func(name, input, outputPath string, generate func() (*gogeo.Report, error)) {
+		var err error
+		var report *gogeo.Report
+		if outputs[outputPath] != "" {
+			err = fmt.Errorf("output %s is already written for %s", outputPath, outputs[outputPath])
+		} else {
+			outputs[outputPath] = name
+			var skip bool
+			if skip, err = overwrite.check(input, outputPath); skip {
+				fmt.Printf("- %s: %s is up to date, skipped\n", name, outputPath)
+				skipped++
+				return
+			}
+			if err == nil {
+				report, err = generate()
+			}
+		}
+
+		if err != nil {
+			fmt.Printf("✗ %s: %v\n", name, err)
+			printTypeConflicts(os.Stdout, err)
+			failed++
+			return
+		}
+		fmt.Printf("✓ %s -> %s (%d features)\n", name, outputPath, report.Features)
+		printRepairs(os.Stdout, report)
+		converted++
+	}
+
+	for _, geojsonPath := range inputs {
+		switch {
+		case gogeo.IsRemoteURI(geojsonPath):
+			outputPath := joinOutputPath(outDir, urlOutputPath(geojsonPath))
+			convert(geojsonPath, geojsonPath, outputPath, func() (*gogeo.Report, error) {
+				return generateFile(cmd.Context(), geojsonPath, outputPath, opts)
+			})
+		case !fileExists(geojsonPath):
+			fmt.Printf("✗ %s: file does not exist\n", geojsonPath)
+			failed++
+		case gogeo.IsZipFile(geojsonPath):
+			if err := generateZip(cmd, geojsonPath, outDir, opts, convert); err != nil {
+				fmt.Printf("✗ %s: %v\n", geojsonPath, err)
+				failed++
+			}
+		case !isFeatureFile(geojsonPath):
+			fmt.Printf("✗ %s: file does not appear to be a GeoJSON, GeoPackage, KML, CSV, GML or OSM PBF file\n", geojsonPath)
+			failed++
+		default:
+			outputPath := joinOutputPath(outDir, replaceExtension(geojsonPath, ".parquet"))
+			convert(geojsonPath, geojsonPath, outputPath, func() (*gogeo.Report, error) {
+				return generateFile(cmd.Context(), geojsonPath, outputPath, opts)
+			})
+		}
+	}
+
+	if skipped > 0 {
+		fmt.Printf("%d of %d files converted successfully, %d up to date\n", converted, converted+failed, skipped)
+	} else {
+		fmt.Printf("%d of %d files converted successfully\n", converted, converted+failed)
+	}
+	return failed == 0
+}
+
+// generateZip converts each GeoJSON member of a ZIP archive into outDir without
+// extracting it, passing every conversion to convert.
+func generateZip(cmd *cobra.Command, zipPath, outDir string, opts []gogeo.Option,
+	convert func(name, input, outputPath string, generate func() (*gogeo.Report, error))) error {
+	archive, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	members := zipGeoJSONMembers(archive)
+	if len(members) == 0 {
+		return fmt.Errorf("archive contains no .geojson files")
+	}
+
+	for _, member := range members {
+		outputPath := joinOutputPath(outDir, replaceExtension(path.Base(member.Name), ".parquet"))
+		convert(zipPath+":"+member.Name, zipPath, outputPath, func() (*gogeo.Report, error) {
+			output, finish, err := createOutput(cmd.Context(), outputPath)
+			if err != nil {
+				return nil, err
+			}
+
+			report, err := gogeo.GenerateFromOpenerContext(cmd.Context(), member.Open, output, opts...)
+			if err := finish(err); err != nil {
+				return nil, err
+			}
+			return report, nil
+		})
+	}
+	return nil
+}
+
+// Convert command
+func convertCmd() *cobra.Command {
+	var convertCmd = &cobra.Command{
+		Use:   "convert [geoparquetPath]",
+		Short: "Convert a GeoParquet file back to GeoJSON",
+		Long: `Convert a GeoParquet file back to GeoJSON, decoding the WKB geometry column and restoring feature properties.
+
+Use --output-format geojsonl to write one Feature per line instead of a single
+FeatureCollection, which streaming tools can consume line by line.
+
+The rows are decoded and written a batch at a time. The input and output may be
+local paths or s3://, gs:// and az:// URIs; remote inputs are downloaded into memory
+before they are decoded.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			geoparquetPath := args[0]
+			outputPath, _ := cmd.Flags().GetString("output")
+			flagOutputFormat, _ := cmd.Flags().GetString("output-format")
+
+			// Validate input file
+			if isLocalPath(geoparquetPath) && !fileExists(geoparquetPath) {
+				fmt.Fprintf(os.Stderr, "Error: GeoParquet file '%s' does not exist.\n", geoparquetPath)
+				os.Exit(1)
+			}
+
+			if !isGeoParquetFile(geoparquetPath) {
+				fmt.Fprintf(os.Stderr, "Error: File '%s' does not appear to be a GeoParquet file.\n", geoparquetPath)
+				os.Exit(1)
+			}
+
+			// Determine output format and path
+			outputFormat := flagOutputFormat
+			if outputFormat == "" {
+				outputFormat = gogeo.FormatFromPath(outputPath)
+			}
+			if outputFormat == "" {
+				outputFormat = gogeo.FormatGeoJSON
+			}
+			if outputPath == "" {
+				outputPath = replaceExtension(geoparquetPath, "."+strings.ToLower(outputFormat))
+			}
+
+			// Validate output path
+			if isLocalPath(outputPath) {
+				if err := gogeo.ValidateOutputPath(outputPath); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: Invalid output path: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			// Status messages go to stderr when the GeoJSON is written to stdout
+			status := os.Stdout
+			if outputPath == stdioPath {
+				status = os.Stderr
+			}
+
+			fmt.Fprintf(status, "Converting GeoParquet file '%s' to GeoJSON...\n", geoparquetPath)
+			r, size, closeInput, err := openParquet(cmd.Context(), geoparquetPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading GeoParquet file: %v\n", err)
+				os.Exit(1)
+			}
+			defer closeInput()
+
+			w, finish, err := createOutput(cmd.Context(), outputPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing GeoJSON file: %v\n", err)
+				os.Exit(1)
+			}
+			// The features are encoded as they are read, a batch at a time
+			count, err := gogeo.WriteFeatures(w, gogeo.FeaturesFrom(r, size), outputFormat)
+			if err := finish(err); err != nil {
+				fmt.Fprintf(os.Stderr, "Error converting GeoParquet file: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Fprintf(status, "✓ Converted %d features and saved to: %s\n", count, outputPath)
+		},
+	}
+	convertCmd.Flags().StringP("output", "o", "", "Output path for the GeoJSON file, or - for stdout")
+	convertCmd.Flags().String("output-format", "", "Format of the output: geojson or geojsonl (default detected from the output extension, else geojson)")
+
+	return convertCmd
+}
+
+// Export command
+func exportCmd() *cobra.Command {
+	var exportCmd = &cobra.Command{
+		Use:   "export [geoparquetPath]",
+		Short: "Export a GeoParquet file as CSV",
+		Long: `Export a GeoParquet file as a flat CSV file, for loading into data warehouses
+such as BigQuery and Snowflake or opening in a spreadsheet.
+
+The first column holds the geometry, as WKT by default, or as hex-encoded WKB or
+GeoJSON with --geometry; the properties follow, sorted by name.
+
+The input and output may be local paths or s3://, gs:// and az:// URIs.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			geoparquetPath := args[0]
+			outputPath, _ := cmd.Flags().GetString("output")
+			flagGeometry, _ := cmd.Flags().GetString("geometry")
+
+			// Validate input file
+			if isLocalPath(geoparquetPath) && !fileExists(geoparquetPath) {
+				fmt.Fprintf(os.Stderr, "Error: GeoParquet file '%s' does not exist.\n", geoparquetPath)
+				os.Exit(1)
+			}
+
+			if !isGeoParquetFile(geoparquetPath) {
+				fmt.Fprintf(os.Stderr, "Error: File '%s' does not appear to be a GeoParquet file.\n", geoparquetPath)
+				os.Exit(1)
+			}
+
+			if outputPath == "" {
+				outputPath = replaceExtension(geoparquetPath, ".csv")
+			}
+			if isLocalPath(outputPath) {
+				if err := gogeo.ValidateOutputPath(outputPath); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: Invalid output path: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			// Status messages go to stderr when the CSV is written to stdout
+			status := os.Stdout
+			if outputPath == stdioPath {
+				status = os.Stderr
+			}
+
+			fmt.Fprintf(status, "Exporting GeoParquet file '%s' to CSV...\n", geoparquetPath)
+			r, size, closeInput, err := openParquet(cmd.Context(), geoparquetPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading GeoParquet file: %v\n", err)
+				os.Exit(1)
+			}
+			defer closeInput()
+
+			w, finish, err := createOutput(cmd.Context(), outputPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing CSV file: %v\n", err)
+				os.Exit(1)
+			}
+			// The rows are exported as they are read, a batch at a time
+			count, err := gogeo.ExportCSV(r, size, w, flagGeometry)
+			if err := finish(err); err != nil {
+				fmt.Fprintf(os.Stderr, "Error exporting GeoParquet file: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Fprintf(status, "✓ Exported %d features and saved to: %s\n", count, outputPath)
+		},
+	}
+	exportCmd.Flags().StringP("output", "o", "", "Output path for the CSV file, or - for stdout")
+	exportCmd.Flags().String("geometry", gogeo.CSVGeometryWKT, "Geometry representation: wkt, wkb (hex) or geojson")
+
+	return exportCmd
+}
+
+// Info command
+func infoCmd() *cobra.Command {
+	var infoCmd = &cobra.Command{
+		Use:   "info [geoparquetPath]",
+		Short: "Inspect a GeoParquet file",
+		Long: `Print a summary of a GeoParquet file read from its footer: the size, row and row
+group counts, compression and, for each geometry column, its encoding, geometry types,
+bounding box and CRS.
+
+--json prints the summary, including the parsed geo metadata, as JSON.
+
+The input may be a local path or an s3://, gs:// or az:// URI.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			input := args[0]
+			flagJSON, _ := cmd.Flags().GetBool("json")
+
+			r, size, closeInput, err := openParquet(cmd.Context(), input)
+			if err != nil {
+				fmt.Printf("Error reading input: %v\n", err)
+				os.Exit(1)
+			}
+			defer closeInput()
+
+			info, err := gogeo.Inspect(r, size)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			if flagJSON {
+				data, err := json.MarshalIndent(info, "", "  ")
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Println(string(data))
+				return
+			}
+			printFileInfo(os.Stdout, input, info)
+		},
+	}
+	infoCmd.Flags().Bool("json", false, "Print the summary as JSON")
+
+	return infoCmd
+}
+
+// Schema command
+func schemaCmd() *cobra.Command {
+	var schemaCmd = &cobra.Command{
+		Use:   "schema [parquetPath]",
+		Short: "Show the Parquet schema of a file",
+		Long: `Print the columns of a GeoParquet or plain Parquet file with their physical and
+logical types, repetition and the encodings of their pages, to check what gogeo
+inferred from the input. Geometry columns show the encoding declared by the geo
+metadata.
+
+--json prints the columns as JSON.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			input := args[0]
+			flagJSON, _ := cmd.Flags().GetBool("json")
+
+			r, size, closeInput, err := openParquet(cmd.Context(), input)
+			if err != nil {
+				fmt.Printf("Error reading input: %v\n", err)
+				os.Exit(1)
+			}
+			defer closeInput()
+
+			columns, err := gogeo.InspectColumns(r, size)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			if flagJSON {
+				data, err := json.MarshalIndent(columns, "", "  ")
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Println(string(data))
+				return
+			}
+			printColumns(os.Stdout, columns)
+		},
+	}
+	schemaCmd.Flags().Bool("json", false, "Print the columns as JSON")
+
+	return schemaCmd
+}
+
+// Schema infer command
+func schemaInferCmd() *cobra.Command {
+	var schemaInferCmd = &cobra.Command{
+		Use:   "schema-infer [geojsonPath]",
+		Short: "Write the schema inferred from an input as JSON without converting it",
+		Long: `Run only the property analysis of generate and write the schema it infers as
+JSON, without producing a GeoParquet file, so that pipelines can review or commit the
+schema before converting. The schema holds the number of features, the property
+columns with their types and nullability, and the geo metadata with the geometry types
+and bbox of the geometry columns, e.g.
+"gogeo schema-infer input.geojson -o schema.json".
+
+The input is read once, in constant memory. It takes the same flags as generate, so
+that the column selection, casts and type inference options give the schema that
+generate would write with them; the flags about the output file are ignored.
+
+The input may be a local file, "-" for stdin, or an http(s)://, s3://, gs:// or az://
+URI. The schema is written to stdout unless --output is given.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			input := args[0]
+			flagOutputPath, _ := cmd.Flags().GetString("output")
+
+			opts, err := generateOptions(cmd)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			schema, err := inferSchemaFile(cmd.Context(), input, opts)
+			if err != nil {
+				fmt.Printf("Error inferring schema: %v\n", err)
+				printTypeConflicts(os.Stdout, err)
+				os.Exit(1)
+			}
+
+			data, err := json.MarshalIndent(schema, "", "  ")
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if flagOutputPath == "" || flagOutputPath == stdioPath {
+				fmt.Println(string(data))
+				return
+			}
+			if err := writeOutput(cmd.Context(), flagOutputPath, append(data, '\n')); err != nil {
+				fmt.Printf("Error writing schema: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("✓ Schema of %d features with %d property columns saved to: %s\n", schema.Features, len(schema.Properties), flagOutputPath)
+		},
+	}
+	schemaInferCmd.Flags().StringP("output", "o", "", "Output path for the schema (default stdout)")
+	addGenerateFlags(schemaInferCmd)
+
+	return schemaInferCmd
+}
+
+// Head command
+func headCmd() *cobra.Command {
+	var headCmd = &cobra.Command{
+		Use:   "head [geoparquetPath]",
+		Short: "Print the first features of a GeoParquet file as GeoJSON",
+		Long: `Print the first features of a GeoParquet file to stdout as a GeoJSON
+FeatureCollection, or one Feature per line with --output-format geojsonl, to look at
+the data without converting the whole file. Only the rows printed are decoded.
+
+With --sample, each row is kept with the given probability instead, e.g. 0.01 for about
+1% of the rows, and -n limits the number of rows printed; use -n 0 to print the whole
+sample. The same --seed selects the same rows of the same file; without it, the sample
+differs on every run.
+
+The input may be a local path or an s3://, gs:// or az:// URI.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			input := args[0]
+			flagCount, _ := cmd.Flags().GetInt("count")
+			flagSample, _ := cmd.Flags().GetFloat64("sample")
+			flagSeed, _ := cmd.Flags().GetUint64("seed")
+			flagOutputFormat, _ := cmd.Flags().GetString("output-format")
+
+			if flagCount < 0 {
+				fmt.Printf("Error: invalid count %d\n", flagCount)
+				os.Exit(1)
+			}
+			if !cmd.Flags().Changed("seed") {
+				flagSeed = uint64(time.Now().UnixNano())
+			}
+
+			r, size, closeInput, err := openParquet(cmd.Context(), input)
+			if err != nil {
+				fmt.Printf("Error reading input: %v\n", err)
+				os.Exit(1)
+			}
+			defer closeInput()
+
+			features := gogeo.FeaturesFrom(r, size)
+			if cmd.Flags().Changed("sample") {
+				features = gogeo.SampleFrom(r, size, flagSample, flagSeed)
+			}
+
+			fc := geojson.NewFeatureCollection()
+			for feature, err := range features {
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				fc.Append(feature)
+				if flagCount > 0 && len(fc.Features) >= flagCount {
+					break
+				}
+			}
+
+			data, err := gogeo.MarshalFeatures(fc, flagOutputFormat)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if len(data) > 0 && data[len(data)-1] != '\n' {
+				data = append(data, '\n')
+			}
+			os.Stdout.Write(data)
+		},
+	}
+	headCmd.Flags().IntP("count", "n", 10, "Number of features to print, 0 for all")
+	headCmd.Flags().Float64("sample", 0, "Keep each row with this probability, e.g. 0.01, instead of the first rows")
+	headCmd.Flags().Uint64("seed", 0, "Seed of the random sample, to select the same rows again")
+	headCmd.Flags().String("output-format", gogeo.FormatGeoJSON, "Format of the output: geojson or geojsonl")
+
+	return headCmd
+}
+
+// Count command
+func countCmd() *cobra.Command {
+	var countCmd = &cobra.Command{
+		Use:   "count [geoparquetPath]",
+		Short: "Count the features of a GeoParquet file",
+		Long: `Print the number of rows of a GeoParquet file, read from its footer without
+decoding any row.
+
+With --bbox minx,miny,maxx,maxy, only the rows whose bbox covering column intersects
+the box are counted. Only the covering columns are read, and row groups whose column
+statistics lie outside the box are skipped. The file must have been written with a
+covering column, e.g. with generate --bbox-column.
+
+The input may be a local path or an s3://, gs:// or az:// URI.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			input := args[0]
+			flagBBox, _ := cmd.Flags().GetString("bbox")
+
+			r, size, closeInput, err := openParquet(cmd.Context(), input)
+			if err != nil {
+				fmt.Printf("Error reading input: %v\n", err)
+				os.Exit(1)
+			}
+			defer closeInput()
+
+			var count int64
+			if flagBBox == "" {
+				count, err = gogeo.CountFeatures(r, size)
+			} else {
+				bound, parseErr := parseBBox(flagBBox)
+				if parseErr != nil {
+					fmt.Printf("Error: %v\n", parseErr)
+					os.Exit(1)
+				}
+				count, err = gogeo.CountIntersecting(cmd.Context(), r, size, bound)
+			}
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(count)
+		},
+	}
+	countCmd.Flags().String("bbox", "", "Only count rows intersecting minx,miny,maxx,maxy, using the bbox covering column")
+
+	return countCmd
+}
+
+// Stats command
+func statsCmd() *cobra.Command {
+	var statsCmd = &cobra.Command{
+		Use:   "stats [inputPath]",
+		Short: "Compute statistics of the features of a file",
+		Long: `Read every feature of a GeoParquet or GeoJSON file and report the number of
+features, the number of features of each geometry type, the total number of vertices
+and the overall bounding box, followed by the type, null count, distinct count and
+minimum and maximum value of each property.
+
+Files with a .parquet or .geoparquet extension are read as GeoParquet; other inputs as
+GeoJSON, or newline-delimited GeoJSON when detected from the extension or selected with
+--input-format geojsonl. The input may be a local file, "-" for GeoJSON on stdin, or an
+http(s)://, s3://, gs:// or az:// URI.
+
+Distinct values are counted up to 100000 per property.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			input := args[0]
+			flagJSON, _ := cmd.Flags().GetBool("json")
+			flagInputFormat, _ := cmd.Flags().GetString("input-format")
+
+			var stats *gogeo.Stats
+			var err error
+			if input != stdioPath && isGeoParquetFile(input) {
+				r, size, closeInput, openErr := openParquet(cmd.Context(), input)
+				if openErr != nil {
+					fmt.Printf("Error reading input: %v\n", openErr)
+					os.Exit(1)
+				}
+				defer closeInput()
+				stats, err = gogeo.GeoParquetStats(cmd.Context(), r, size)
+			} else {
+				format := flagInputFormat
+				if format == "" {
+					format = gogeo.FormatFromPath(input)
+				}
+				if format == "" {
+					format = gogeo.FormatGeoJSON
+				}
+
+				var r io.Reader = os.Stdin
+				if input != stdioPath {
+					body, openErr := gogeo.OpenBlob(cmd.Context(), input)
+					if openErr != nil {
+						fmt.Printf("Error reading input: %v\n", openErr)
+						os.Exit(1)
+					}
+					defer body.Close()
+					r = body
+				}
+				stats, err = gogeo.GeoJSONStats(cmd.Context(), r, format)
+			}
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			if flagJSON {
+				data, err := json.MarshalIndent(stats, "", "  ")
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Println(string(data))
+				return
+			}
+			printStats(os.Stdout, stats)
+		},
+	}
+	statsCmd.Flags().Bool("json", false, "Print the statistics as JSON")
+	statsCmd.Flags().String("input-format", "", "Format of a GeoJSON input: geojson or geojsonl (default detected from the extension)")
+
+	return statsCmd
+}
+
+// Validate command
+func validateCmd() *cobra.Command {
+	var validateCmd = &cobra.Command{
+		Use:   "validate [geoparquetPath]",
+		Short: "Check a GeoParquet file against the specification",
+		Long: `Check a GeoParquet file against the GeoParquet 1.0 and 1.1 specifications.
+
+The geo metadata is checked against the metadata JSON schema of its version and the
+geometry columns it describes must exist in the Parquet schema. Every value of a WKB
+geometry column is decoded, and its type must be one of the declared geometry_types
+and its extent within the declared bbox.
+
+Exits with status 1 and a report of the violations if the file is not valid.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			input := args[0]
+			flagJSON, _ := cmd.Flags().GetBool("json")
+
+			r, size, closeInput, err := openParquet(cmd.Context(), input)
+			if err != nil {
+				fmt.Printf("Error reading input: %v\n", err)
+				os.Exit(1)
+			}
+			defer closeInput()
+
+			report, err := gogeo.ValidateGeoParquet(cmd.Context(), r, size)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			if flagJSON {
+				data, err := json.MarshalIndent(report, "", "  ")
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Println(string(data))
+			} else if report.Valid() {
+				fmt.Printf("✓ '%s' is a valid GeoParquet %s file with %d rows\n", input, report.Version, report.Rows)
+			} else {
+				fmt.Printf("✗ '%s' has %d violations of the GeoParquet specification:\n", input, len(report.Violations))
+				for _, violation := range report.Violations {
+					fmt.Printf("  - %s\n", violation)
+				}
+			}
+
+			if !report.Valid() {
+				os.Exit(1)
+			}
+		},
+	}
+	validateCmd.Flags().Bool("json", false, "Print the report as JSON")
+
+	return validateCmd
+}
+
+// Validate GeoJSON command
+func validateGeoJSONCmd() *cobra.Command {
+	var validateGeoJSONCmd = &cobra.Command{
+		Use:   "validate-geojson [geojsonPath]",
+		Short: "Check a GeoJSON file for structural problems before converting it",
+		Long: `Check a GeoJSON file against RFC 7946 before attempting a conversion.
+
+The file is streamed, so large inputs are checked in constant memory. Malformed
+features and geometries, positions that are not numbers or lie outside the
+longitude/latitude range, unclosed or too short polygon rings and geometries mixing 2D
+and 3D positions are errors. Rings not following the right-hand rule and collections
+mixing 2D and 3D features are warnings. Each problem is reported with the index of
+the feature and the line on which it starts.
+
+The input may be a local file, "-" for stdin, or an http(s)://, s3://, gs:// or az://
+URI. Newline-delimited GeoJSON is detected from the extension, or selected with
+--input-format geojsonl.
+
+Exits with status 1 if any error is found; warnings alone do not fail the check.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			input := args[0]
+			flagJSON, _ := cmd.Flags().GetBool("json")
+			flagInputFormat, _ := cmd.Flags().GetString("input-format")
+
+			format := flagInputFormat
+			if format == "" {
+				format = gogeo.FormatFromPath(input)
+			}
+			if format == "" {
+				format = gogeo.FormatGeoJSON
+			}
+
+			var r io.Reader = os.Stdin
+			if input != stdioPath {
+				body, err := gogeo.OpenBlob(cmd.Context(), input)
+				if err != nil {
+					fmt.Printf("Error reading input: %v\n", err)
+					os.Exit(1)
+				}
+				defer body.Close()
+				r = body
+			}
+
+			report, err := gogeo.ValidateGeoJSON(cmd.Context(), r, format)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			errorCount := report.Errors()
+			if flagJSON {
+				data, err := json.MarshalIndent(report, "", "  ")
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Println(string(data))
+			} else if len(report.Problems) == 0 {
+				fmt.Printf("✓ '%s' has no problems in %d features\n", input, report.Features)
+			} else {
+				mark := "✓"
+				if errorCount > 0 {
+					mark = "✗"
+				}
+				fmt.Printf("%s '%s' has %d errors and %d warnings in %d features:\n",
+					mark, input, errorCount, len(report.Problems)-errorCount, report.Features)
+				for _, problem := range report.Problems {
+					location := fmt.Sprintf("line %d", problem.Line)
+					if problem.Feature > 0 {
+						location = fmt.Sprintf("feature %d (line %d)", problem.Feature, problem.Line)
+					} else if problem.Line == 0 {
+						location = "collection"
+					}
+					fmt.Printf("  %s: %s: %s\n", location, problem.Severity, problem.Message)
+				}
+				if report.Omitted > 0 {
+					fmt.Printf("  ... and %d more problems\n", report.Omitted)
+				}
+			}
+
+			if errorCount > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+	validateGeoJSONCmd.Flags().Bool("json", false, "Print the report as JSON")
+	validateGeoJSONCmd.Flags().String("input-format", "", "Format of the input: geojson or geojsonl (default detected from the extension)")
+
+	return validateGeoJSONCmd
+}
+
+// Diff command
+func diffCmd() *cobra.Command {
+	var diffCmd = &cobra.Command{
+		Use:   "diff [oldPath] [newPath]",
+		Short: "Compare the features and schema of two files",
+		Long: `Compare two GeoParquet or GeoJSON files, such as two releases of a dataset, and
+report the features added, removed and changed, and the properties added, removed or
+whose type changed.
+
+Features are matched by the property given with --key, or else by their id, or by a
+hash of their geometry if they have none. When matching by geometry, a feature whose
+geometry changed shows as removed and added, and changed features are those whose
+properties differ. Only hashes of the features of the old file are held in memory.
+
+Files with a .parquet or .geoparquet extension are read as GeoParquet; other inputs as
+GeoJSON, or newline-delimited GeoJSON when detected from the extension or selected with
+--input-format geojsonl. Inputs may be local files or http(s)://, s3://, gs:// or az://
+URIs.
+
+Like diff, exits with status 0 if the files are identical, 1 if they differ and 2 if
+they cannot be compared.`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			flagKey, _ := cmd.Flags().GetString("key")
+			flagJSON, _ := cmd.Flags().GetBool("json")
+			flagInputFormat, _ := cmd.Flags().GetString("input-format")
+
+			oldReader, closeOld, err := openFeatures(cmd.Context(), args[0], flagInputFormat)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+				os.Exit(2)
+			}
+			defer closeOld()
+			newReader, closeNew, err := openFeatures(cmd.Context(), args[1], flagInputFormat)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+				os.Exit(2)
+			}
+			defer closeNew()
+
+			report, err := gogeo.DiffFeatures(cmd.Context(), oldReader, newReader, gogeo.DiffOptions{Key: flagKey})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(2)
+			}
+
+			if flagJSON {
+				data, err := json.MarshalIndent(report, "", "  ")
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(2)
+				}
+				fmt.Println(string(data))
+			} else {
+				printDiff(os.Stdout, args[0], args[1], report)
+			}
+
+			// Errors exit with status 2, so that 1 only means differences
+			if !report.Identical() {
+				os.Exit(1)
+			}
+		},
+	}
+	diffCmd.Flags().String("key", "", "Property identifying features in both files (default: the feature id, else a geometry hash)")
+	diffCmd.Flags().Bool("json", false, "Print the differences as JSON")
+	diffCmd.Flags().String("input-format", "", "Format of GeoJSON inputs: geojson or geojsonl (default detected from the extension)")
+
+	return diffCmd
+}
+
+// Meta command
+func metaCmd() *cobra.Command {
+	var metaCmd = &cobra.Command{
+		Use:   "meta",
+		Short: "Read or edit the geo metadata of a GeoParquet file",
+	}
+	metaCmd.AddCommand(metaGetCmd())
+	metaCmd.AddCommand(metaSetCmd())
+
+	return metaCmd
+}
+
+// Meta get command
+func metaGetCmd() *cobra.Command {
+	var getCmd = &cobra.Command{
+		Use:   "get [parquetPath]",
+		Short: "Print the geo metadata of a Parquet file",
+		Long: `Print the value of the "geo" key of the key-value metadata of a Parquet file,
+indented if it is JSON, or of another key with --key.
+
+Exits with status 1 if the file has no such key. The input may be a local path or an
+s3://, gs:// or az:// URI.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			input := args[0]
+			flagKey, _ := cmd.Flags().GetString("key")
+
+			r, size, closeInput, err := openParquet(cmd.Context(), input)
+			if err != nil {
+				fmt.Printf("Error reading input: %v\n", err)
+				os.Exit(1)
+			}
+			defer closeInput()
+
+			value, ok, err := gogeo.ReadMetadataValue(r, size, flagKey)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if !ok {
+				fmt.Printf("Error: '%s' has no %q metadata key\n", input, flagKey)
+				os.Exit(1)
+			}
+
+			var indented bytes.Buffer
+			if err := json.Indent(&indented, []byte(value), "", "  "); err == nil {
+				value = indented.String()
+			}
+			fmt.Println(value)
+		},
+	}
+	getCmd.Flags().String("key", gogeo.GeoParquetMetadataKey, "Key of the key-value metadata to print")
+
+	return getCmd
+}
+
+// Meta set command
+func metaSetCmd() *cobra.Command {
+	var setCmd = &cobra.Command{
+		Use:   "set [geoparquetPath]",
+		Short: "Edit the geo metadata of a GeoParquet file",
+		Long: `Edit the geo metadata of an existing GeoParquet file, e.g. to fix its primary
+column or declare its CRS. Only the footer of the file is rewritten: the data pages are
+copied byte for byte, so even large files are updated quickly.
+
+--metadata replaces the whole geo metadata with the JSON object of a file, which also
+adds geo metadata to a plain Parquet file. --primary-column makes another described
+geometry column the primary one. --crs sets the CRS of the primary column, or of
+--column, as a known code such as EPSG:3857, the path of a PROJJSON file, or null for
+an unknown CRS.
+
+The edited metadata must be valid GeoParquet metadata describing existing columns.
+The file is replaced unless --output is given; the output may also be an s3://, gs://
+or az:// URI.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			input := args[0]
+			outputPath, _ := cmd.Flags().GetString("output")
+			flagMetadata, _ := cmd.Flags().GetString("metadata")
+			flagPrimaryColumn, _ := cmd.Flags().GetString("primary-column")
+			flagCRS, _ := cmd.Flags().GetString("crs")
+			flagColumn, _ := cmd.Flags().GetString("column")
+
+			update := gogeo.MetadataUpdate{PrimaryColumn: flagPrimaryColumn, Column: flagColumn}
+			if flagMetadata != "" {
+				data, err := os.ReadFile(flagMetadata)
+				if err != nil {
+					fmt.Printf("Error reading metadata: %v\n", err)
+					os.Exit(1)
+				}
+				update.Metadata = data
+			}
+			if flagCRS != "" {
+				crs, err := crsDefinition(flagCRS)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				update.CRS = crs
+			}
+			if update.Metadata == nil && update.PrimaryColumn == "" && update.CRS == nil {
+				fmt.Printf("Error: nothing to change, use --metadata, --primary-column or --crs\n")
+				os.Exit(1)
+			}
+			if outputPath == "" && !isLocalPath(input) {
+				fmt.Printf("Error: --output is required for a remote input.\n")
+				os.Exit(1)
+			}
+
+			r, size, closeInput, err := openParquet(cmd.Context(), input)
+			if err != nil {
+				fmt.Printf("Error reading input: %v\n", err)
+				os.Exit(1)
+			}
+			defer closeInput()
+
+			write := func(w io.Writer) error { return gogeo.UpdateGeoMetadata(r, size, w, update) }
+			if outputPath == "" {
+				err = replaceFile(input, write)
+				outputPath = input
+			} else {
+				var w io.Writer
+				var finish func(error) error
+				w, finish, err = createOutput(cmd.Context(), outputPath)
+				if err == nil {
+					err = finish(write(w))
+				}
+			}
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("✓ Geo metadata updated and saved to: %s\n", outputPath)
+		},
+	}
+	setCmd.Flags().StringP("output", "o", "", "Output path (default: replace the input file)")
+	setCmd.Flags().String("metadata", "", "Path of a JSON file replacing the whole geo metadata")
+	setCmd.Flags().String("primary-column", "", "Geometry column to make the primary column")
+	setCmd.Flags().String("crs", "", "CRS to declare, as a code such as EPSG:3857, a PROJJSON file, or null")
+	setCmd.Flags().String("column", "", "Geometry column whose CRS is set (default: the primary column)")
+
+	return setCmd
+}
+
+// Upgrade command
+func upgradeCmd() *cobra.Command {
+	var upgradeCmd = &cobra.Command{
+		Use:   "upgrade [geoparquetPath]",
+		Short: "Upgrade the geo metadata of a file to GeoParquet 1.1",
+		Long: `Rewrite a GeoParquet 1.0 or older file with geo metadata in the shape of
+GeoParquet 1.1: the version becomes 1.1.0, the geometry_type of pre-1.0 files becomes
+geometry_types, encodings are normalized and CRS given as codes are replaced by their
+PROJJSON definitions. Only the footer is rewritten, so the data pages are kept as
+they are.
+
+With --bbox-column, the rows are decoded and written again with a bbox covering column,
+keeping the geometry columns, encodings and CRS of the input, so that readers can
+filter the file by bounding box. --compression and --row-group-size then control how
+they are written.
+
+The file is replaced unless --output is given; the output may also be an s3://, gs://
+or az:// URI.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			input := args[0]
+			outputPath, _ := cmd.Flags().GetString("output")
+
+			flagBBoxColumn, _ := cmd.Flags().GetBool("bbox-column")
+			flagCompression, _ := cmd.Flags().GetString("compression")
+			flagRowGroupSize, _ := cmd.Flags().GetInt64("row-group-size")
+
+			// Options make the rows be written again, so they are only given with --bbox-column
+			var opts []gogeo.Option
+			if flagBBoxColumn {
+				opts = append(opts, gogeo.WithBBoxColumn(), gogeo.WithCompression(flagCompression))
+				if flagRowGroupSize > 0 {
+					opts = append(opts, gogeo.WithRowGroupSize(flagRowGroupSize))
+				}
+			}
+			if outputPath == "" && !isLocalPath(input) {
+				fmt.Printf("Error: --output is required for a remote input.\n")
+				os.Exit(1)
+			}
+
+			r, size, closeInput, err := openParquet(cmd.Context(), input)
+			if err != nil {
+				fmt.Printf("Error reading input: %v\n", err)
+				os.Exit(1)
+			}
+			defer closeInput()
+
+			write := func(w io.Writer) error { return gogeo.UpgradeGeoParquet(cmd.Context(), r, size, w, opts...) }
+			if outputPath == "" {
+				err = replaceFile(input, write)
+				outputPath = input
+			} else {
+				var w io.Writer
+				var finish func(error) error
+				w, finish, err = createOutput(cmd.Context(), outputPath)
+				if err == nil {
+					err = finish(write(w))
+				}
+			}
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("✓ GeoParquet %s file saved to: %s\n", gogeo.GeoParquetVersion, outputPath)
+		},
+	}
+	upgradeCmd.Flags().StringP("output", "o", "", "Output path (default: replace the input file)")
+	upgradeCmd.Flags().Bool("bbox-column", false, "Rewrite the rows with a per-row bbox covering column")
+	upgradeCmd.Flags().String("compression", gogeo.DefaultCompression, "Compression codec of the rewritten rows: zstd, snappy, gzip, lz4, brotli or none")
+	upgradeCmd.Flags().Int64("row-group-size", 0, "Maximum number of rows per row group of the rewritten rows (default parquet-go's)")
+
+	return upgradeCmd
+}
+
+// Partition command
+func partitionCmd() *cobra.Command {
+	var partitionCmd = &cobra.Command{
+		Use:   "partition [path]",
+		Short: "Split a large dataset into spatially coherent GeoParquet parts",
+		Long: `Split a large GeoJSON, GeoParquet or other supported input into GeoParquet parts
+covering separate areas, so that readers can skip the parts outside an area of interest.
+
+The area of the features is divided as a quadtree: a cell holding more than
+--max-features features, located by the center of their bounding box, is split into
+four until every cell fits. Each non-empty cell is written to --out-dir as a file
+named after its key, such as q0213.parquet, and features without a geometry to
+none.parquet. A manifest.json file lists the parts with their cell bounds, the bounds
+of their geometries and their number of features. All parts share the same columns.
+
+GeoParquet inputs (.parquet, .geoparquet) keep their geometry columns and CRS. Other
+inputs are read as with generate, whose options apply to the parts. The input is read
+twice, so it cannot be stdin; the center of every feature is held in memory.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			input := args[0]
+			flagOutDir, _ := cmd.Flags().GetString("out-dir")
+			flagMaxFeatures, _ := cmd.Flags().GetInt("max-features")
+			if flagOutDir == "" {
+				fmt.Printf("Error: --out-dir is required.\n")
+				os.Exit(1)
+			}
+			if input == stdioPath {
+				fmt.Printf("Error: partition reads its input twice and cannot read stdin.\n")
+				os.Exit(1)
+			}
+
+			opts, err := generateOptions(cmd)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if isLocalPath(flagOutDir) {
+				if err := os.MkdirAll(flagOutDir, 0750); err != nil {
+					fmt.Printf("Error: Failed to create output directory: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			create := func(name string) (gogeo.BlobWriter, error) {
+				return gogeo.CreateBlob(cmd.Context(), joinOutputPath(flagOutDir, name))
+			}
+
+			var manifest *gogeo.PartitionManifest
+			if isGeoParquetFile(input) {
+				r, size, closeInput, err := openParquet(cmd.Context(), input)
+				if err != nil {
+					fmt.Printf("Error reading input: %v\n", err)
+					os.Exit(1)
+				}
+				defer closeInput()
+				manifest, err = gogeo.PartitionGeoParquet(cmd.Context(), r, size, create, flagMaxFeatures, opts...)
+			} else {
+				if format := gogeo.FormatFromPath(input); format != "" {
+					opts = append([]gogeo.Option{gogeo.WithInputFormat(format)}, opts...)
+				}
+				manifest, err = gogeo.Partition(cmd.Context(), gogeo.OpenBlobFunc(cmd.Context(), input), create, flagMaxFeatures, opts...)
+			}
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				printTypeConflicts(os.Stdout, err)
+				os.Exit(1)
+			}
+			fmt.Printf("✓ Split %d features into %d parts in: %s\n", manifest.Features, len(manifest.Parts), flagOutDir)
+		},
+	}
+	partitionCmd.Flags().String("out-dir", "", "Directory of the parts and manifest (required)")
+	partitionCmd.Flags().Int("max-features", 100000, "Maximum number of features of a part")
+	addGenerateFlags(partitionCmd)
+
+	return partitionCmd
+}
+
+// Merge command
+func mergeCmd() *cobra.Command {
+	var mergeCmd = &cobra.Command{
+		Use:   "merge [geoparquetPath...]",
+		Short: "Combine GeoParquet files into one",
+		Long: `Concatenate the rows of GeoParquet files, such as regional or daily extracts,
+into one GeoParquet file.
+
+The inputs must share their primary geometry column and CRS. The output keeps the
+geometry columns and encodings of the first input. Its property columns are the union
+of those of the inputs: integer and floating point columns are merged as floating
+point, and other type differences are an error. Every property column is written as
+optional, so a column missing from some inputs is null in their rows. The geometry
+types and bbox of the geo metadata cover the rows of all inputs.
+
+Inputs may be local files or http(s)://, s3://, gs:// or az:// URIs, as may the output.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			outputPath, _ := cmd.Flags().GetString("output")
+			if outputPath == "" {
+				fmt.Printf("Error: --output is required.\n")
+				os.Exit(1)
+			}
+
+			flagBBoxColumn, _ := cmd.Flags().GetBool("bbox-column")
+			flagCompression, _ := cmd.Flags().GetString("compression")
+			flagRowGroupSize, _ := cmd.Flags().GetInt64("row-group-size")
+			flagSpatialSort, _ := cmd.Flags().GetString("spatial-sort")
+			flagSortBy, _ := cmd.Flags().GetStringSlice("sort-by")
+			opts := []gogeo.Option{gogeo.WithCompression(flagCompression)}
+			if flagBBoxColumn {
+				opts = append(opts, gogeo.WithBBoxColumn())
+			}
+			if flagRowGroupSize > 0 {
+				opts = append(opts, gogeo.WithRowGroupSize(flagRowGroupSize))
+			}
+			if flagSpatialSort != "" {
+				opts = append(opts, gogeo.WithSpatialSort(flagSpatialSort))
+			}
+			if len(flagSortBy) > 0 {
+				sortOpt, err := sortByOption(flagSortBy)
+				if err != nil {
+					fmt.Printf("Error: invalid sort column: %v\n", err)
+					os.Exit(1)
+				}
+				opts = append(opts, sortOpt)
+			}
+			columnOpts, err := columnOptions(cmd)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			opts = append(opts, columnOpts...)
+			transformOpts, err := transformOptions(cmd)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			opts = append(opts, transformOpts...)
+
+			inputs := make([]*io.SectionReader, 0, len(args))
+			for _, input := range args {
+				r, size, closeInput, err := openParquet(cmd.Context(), input)
+				if err != nil {
+					fmt.Printf("Error reading input: %v\n", err)
+					os.Exit(1)
+				}
+				defer closeInput()
+				inputs = append(inputs, io.NewSectionReader(r, 0, size))
+			}
+
+			w, finish, err := createOutput(cmd.Context(), outputPath)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			report, err := gogeo.MergeGeoParquet(cmd.Context(), inputs, w, opts...)
+			if err = finish(err); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("✓ Merged %d features from %d files into: %s\n", report.Features, len(inputs), outputPath)
+			printRepairs(os.Stdout, report)
+		},
+	}
+	mergeCmd.Flags().StringP("output", "o", "", "Output path (required)")
+	mergeCmd.Flags().Bool("bbox-column", false, "Write a per-row bbox covering column")
+	mergeCmd.Flags().String("compression", gogeo.DefaultCompression, "Compression codec: zstd, snappy, gzip, lz4, brotli or none")
+	mergeCmd.Flags().Int64("row-group-size", 0, "Maximum number of rows per row group (default parquet-go's)")
+	mergeCmd.Flags().String("spatial-sort", "", "Order features along a space-filling curve before writing: hilbert or zorder (holds the features in memory)")
+	mergeCmd.Flags().StringSlice("sort-by", nil, "Order features by property columns, as name[:asc|desc] separated by commas (holds the features in memory)")
+	addColumnFlags(mergeCmd)
+	addTransformFlags(mergeCmd)
+
+	return mergeCmd
+}
+
+// Extract command
+func extractCmd() *cobra.Command {
+	var extractCmd = &cobra.Command{
+		Use:   "extract [geoparquetPath]",
+		Short: "Extract the features of a GeoParquet file within a bounding box or matching a filter",
+		Long: `Write the features of a GeoParquet file whose bounding box intersects
+--bbox minx,miny,maxx,maxy, and whose properties match the --where filter, to a new
+GeoParquet file. At least one of them is required.
+
+With --clip, the geometries are cut to the box and features that only touch it are
+dropped. When the file has a bbox covering column, e.g. written with generate
+--bbox-column, row groups whose column statistics lie outside the box are skipped
+without being decoded. The output keeps the geometry columns, encodings, CRS, bbox
+columns and property columns of the input.
+
+The input and output may be local paths or s3://, gs:// or az:// URIs; use -o - to
+write to stdout.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			input := args[0]
+			outputPath, _ := cmd.Flags().GetString("output")
+			if outputPath == "" {
+				fmt.Printf("Error: --output is required.\n")
+				os.Exit(1)
+			}
+
+			flagBBox, _ := cmd.Flags().GetString("bbox")
+			flagClip, _ := cmd.Flags().GetBool("clip")
+			flagWhere, _ := cmd.Flags().GetString("where")
+			flagCompression, _ := cmd.Flags().GetString("compression")
+			flagRowGroupSize, _ := cmd.Flags().GetInt64("row-group-size")
+			if flagBBox == "" && flagWhere == "" {
+				fmt.Printf("Error: --bbox or --where is required.\n")
+				os.Exit(1)
+			}
+			if flagClip && flagBBox == "" {
+				fmt.Printf("Error: --clip requires --bbox.\n")
+				os.Exit(1)
+			}
+			extract := gogeo.ExtractOptions{Clip: flagClip}
+			if flagBBox != "" {
+				bound, err := parseBBox(flagBBox)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				extract.BBox = &bound
+			}
+			opts := []gogeo.Option{gogeo.WithCompression(flagCompression)}
+			if flagRowGroupSize > 0 {
+				opts = append(opts, gogeo.WithRowGroupSize(flagRowGroupSize))
+			}
+			if flagWhere != "" {
+				opts = append(opts, gogeo.WithWhere(flagWhere))
+			}
+			columnOpts, err := columnOptions(cmd)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			opts = append(opts, columnOpts...)
+			transformOpts, err := transformOptions(cmd)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			opts = append(opts, transformOpts...)
+
+			r, size, closeInput, err := openParquet(cmd.Context(), input)
+			if err != nil {
+				fmt.Printf("Error reading input: %v\n", err)
+				os.Exit(1)
+			}
+			defer closeInput()
+
+			w, finish, err := createOutput(cmd.Context(), outputPath)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			report, err := gogeo.ExtractGeoParquet(cmd.Context(), r, size, w, extract, opts...)
+			if err = finish(err); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			status := os.Stdout
+			if outputPath == stdioPath {
+				status = os.Stderr
+			}
+			fmt.Fprintf(status, "✓ Extracted %d features to: %s\n", report.Features, outputPath)
+			printRepairs(status, report)
+		},
+	}
+	extractCmd.Flags().StringP("output", "o", "", "Output path (required)")
+	extractCmd.Flags().String("bbox", "", "Keep the features intersecting minx,miny,maxx,maxy")
+	extractCmd.Flags().String("where", "", "Keep the features matching a filter, e.g. \"population > 10000 AND country = 'US'\"")
+	extractCmd.Flags().Bool("clip", false, "Clip the geometries to the bbox")
+	addColumnFlags(extractCmd)
+	addTransformFlags(extractCmd)
+	extractCmd.Flags().String("compression", gogeo.DefaultCompression, "Compression codec: zstd, snappy, gzip, lz4, brotli or none")
+	extractCmd.Flags().Int64("row-group-size", 0, "Maximum number of rows per row group (default parquet-go's)")
+
+	return extractCmd
+}
+
+// OSM command
+func osmCmd() *cobra.Command {
+	var osmCmd = &cobra.Command{
+		Use:   "osm",
+		Short: "Work with OpenStreetMap data",
+	}
+	osmCmd.AddCommand(osmExtractCmd())
+
+	return osmCmd
+}
+
+// OSM extract command
+func osmExtractCmd() *cobra.Command {
+	var extractCmd = &cobra.Command{
+		Use:   "extract [pbfPath]",
+		Short: "Extract tagged nodes and ways from an OSM PBF file to GeoParquet",
+		Long: `Extract the nodes and ways of an OpenStreetMap PBF file (.osm.pbf) to GeoParquet.
+
+Tagged nodes become points and ways become line strings, or polygons when they are
+closed and tagged as an area (building, landuse, area=yes, ...). Relations are not
+assembled. Use --tags to select elements by key or key=value, e.g.
+"gogeo osm extract planet.osm.pbf --tags highway -o roads.geoparquet".
+
+Each row has osm_type and osm_id columns and a column for each --tags key; the
+other tags are written as a JSON object in the tags column.
+
+The file is streamed: it is read once to find the nodes of the selected ways, and
+the coordinates of those nodes are the only data kept in memory.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			pbfPath := args[0]
+			flagOutputPath, _ := cmd.Flags().GetString("output")
+			flagTags, _ := cmd.Flags().GetStringSlice("tags")
+
+			if !fileExists(pbfPath) {
+				fmt.Printf("Error: OSM PBF file '%s' does not exist.\n", pbfPath)
+				os.Exit(1)
+			}
+
+			opts, err := generateOptions(cmd)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			opts = append(opts, gogeo.WithInputFormat(gogeo.FormatOSMPBF), gogeo.WithOSMTags(flagTags...))
+
+			// planet.osm.pbf becomes planet.parquet
+			outputPath := determineOutputPath(flagOutputPath, strings.TrimSuffix(pbfPath, ".pbf"))
+			if isLocalPath(outputPath) {
+				if err := gogeo.ValidateOutputPath(outputPath); err != nil {
+					fmt.Printf("Error: Invalid output path: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			fmt.Printf("Extracting OSM features from '%s'...\n", pbfPath)
+			report, err := generateFile(cmd.Context(), pbfPath, outputPath, opts)
+			if err != nil {
+				fmt.Printf("Error extracting features: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("✓ GeoParquet file with %d features generated successfully and saved to: %s\n", report.Features, outputPath)
+			printRepairs(os.Stdout, report)
+		},
+	}
+	extractCmd.Flags().StringP("output", "o", "", "Output path for the GeoParquet file")
+	extractCmd.Flags().StringSlice("tags", nil, "Tags selecting the nodes and ways to extract, as key or key=value (comma separated or repeatable)")
+	extractCmd.Flags().Bool("progress", false, "Display a progress bar while writing")
+	addWriteFlags(extractCmd)
+
+	return extractCmd
+}
+
+// PostGIS command
+func pgCmd() *cobra.Command {
+	var pgCmd = &cobra.Command{
+		Use:   "pg",
+		Short: "Exchange data with a PostGIS database",
+	}
+	pgCmd.AddCommand(pgExportCmd())
+	pgCmd.AddCommand(pgImportCmd())
+
+	return pgCmd
+}
+
+// PostGIS export command
+func pgExportCmd() *cobra.Command {
+	var exportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export a PostGIS table or query to GeoParquet",
+		Long: `Export the rows of a PostGIS table or query to GeoParquet.
+
+The first geometry or geography column becomes the geometry column; further ones are
+written as WKT strings. Integer, floating point, numeric and boolean columns keep
+their type and other columns are written as text. The SRID of the geometries
+becomes the CRS unless --crs is given.
+
+--dsn is a postgres:// URL or a libpq connection string such as
+"host=localhost dbname=gis user=postgres"; missing parameters are read from the
+PGHOST, PGPORT, PGUSER, PGPASSWORD, PGDATABASE and PGSSLMODE environment variables.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			flagDSN, _ := cmd.Flags().GetString("dsn")
+			flagQuery, _ := cmd.Flags().GetString("query")
+			flagTable, _ := cmd.Flags().GetString("table")
+			outputPath, _ := cmd.Flags().GetString("output")
+
+			if (flagQuery == "") == (flagTable == "") {
+				fmt.Printf("Error: exactly one of --query or --table is required.\n")
+				os.Exit(1)
+			}
+			query := flagQuery
+			if flagTable != "" {
+				query = gogeo.PostGISTableQuery(flagTable)
+				if outputPath == "" {
+					outputPath = flagTable + ".parquet"
+				}
+			}
+			if outputPath == "" {
+				fmt.Printf("Error: --output is required with --query.\n")
+				os.Exit(1)
+			}
+			if isLocalPath(outputPath) {
+				if err := gogeo.ValidateOutputPath(outputPath); err != nil {
+					fmt.Printf("Error: Invalid output path: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			opts, err := generateOptions(cmd)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Exporting PostGIS rows to '%s'...\n", outputPath)
+			w, finish, err := createOutput(cmd.Context(), outputPath)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			report, err := gogeo.GenerateFromPostGIS(cmd.Context(), flagDSN, query, w, opts...)
+			if err := finish(err); err != nil {
+				fmt.Printf("Error exporting rows: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("✓ GeoParquet file with %d features generated successfully and saved to: %s\n", report.Features, outputPath)
+			printRepairs(os.Stdout, report)
+		},
+	}
+	exportCmd.Flags().String("dsn", "", "PostgreSQL connection URL or libpq connection string (default from the PG* environment variables)")
+	exportCmd.Flags().String("query", "", "SQL query selecting the rows to export")
+	exportCmd.Flags().String("table", "", "Table to export, as table or schema.table")
+	exportCmd.Flags().StringP("output", "o", "", "Output path for the GeoParquet file (default [table].parquet)")
+	exportCmd.Flags().Bool("progress", false, "Display a progress bar while writing")
+	addWriteFlags(exportCmd)
+
+	return exportCmd
+}
+
+// PostGIS import command
+func pgImportCmd() *cobra.Command {
+	var importCmd = &cobra.Command{
+		Use:   "import [geoparquetPath]",
+		Short: "Load a GeoParquet file into a new PostGIS table",
+		Long: `Load the rows of a GeoParquet file into a new PostGIS table.
+
+The table is created with a column per Parquet column: geometry columns become
+geometry columns with the SRID of their CRS and are copied as EWKB, and other
+columns get the matching PostgreSQL type. The rows are copied with COPY in a single
+transaction and a GiST index is built on the primary geometry column. The import
+fails if the table already exists.
+
+--dsn is a postgres:// URL or a libpq connection string; missing parameters are read
+from the PG* environment variables.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			input := args[0]
+			flagDSN, _ := cmd.Flags().GetString("dsn")
+			flagTable, _ := cmd.Flags().GetString("table")
+
+			if flagTable == "" {
+				fmt.Printf("Error: --table is required.\n")
+				os.Exit(1)
+			}
+
+			r, size, closeInput, err := openParquet(cmd.Context(), input)
+			if err != nil {
+				fmt.Printf("Error reading input: %v\n", err)
+				os.Exit(1)
+			}
+			defer closeInput()
+
+			fmt.Printf("Importing '%s' into table %s...\n", input, flagTable)
+			rows, err := gogeo.ImportPostGIS(cmd.Context(), flagDSN, flagTable, r, size)
+			if err != nil {
+				fmt.Printf("Error importing rows: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("✓ Imported %d rows into %s\n", rows, flagTable)
+		},
+	}
+	importCmd.Flags().String("dsn", "", "PostgreSQL connection URL or libpq connection string (default from the PG* environment variables)")
+	importCmd.Flags().String("table", "", "Table to create, as table or schema.table")
+
+	return importCmd
+}
+
+// Fetch command
+func fetchCmd() *cobra.Command {
+	var fetchCmd = &cobra.Command{
+		Use:   "fetch [collectionURL]",
+		Short: "Fetch an OGC API Features collection into a GeoParquet file",
+		Long: `Fetch all items of an OGC API Features collection into a single GeoParquet file.
+
+The collection URL is either the collection, e.g.
+https://example.com/collections/roads, or its items endpoint; query parameters such
+as bbox or datetime are passed on to the server. Pages are requested with --limit
+features each and followed through their "next" links until the last one.
+
+The collection is downloaded once and held in memory to infer the schema.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			collectionURL := args[0]
+			outputPath, _ := cmd.Flags().GetString("output")
+			flagLimit, _ := cmd.Flags().GetInt("limit")
+			flagMaxFeatures, _ := cmd.Flags().GetInt("max-features")
+			flagHeaders, _ := cmd.Flags().GetStringArray("header")
+
+			header, err := headerFlags(flagHeaders)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			outputPath = determineOutputPath(outputPath, collectionName(collectionURL))
+			if isLocalPath(outputPath) {
+				if err := gogeo.ValidateOutputPath(outputPath); err != nil {
+					fmt.Printf("Error: Invalid output path: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			opts, err := generateOptions(cmd)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Fetching '%s' to '%s'...\n", collectionURL, outputPath)
+			w, finish, err := createOutput(cmd.Context(), outputPath)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			request := gogeo.OGCFeaturesRequest{Header: header, Limit: flagLimit, MaxFeatures: flagMaxFeatures}
+			report, err := gogeo.GenerateFromOGCFeatures(cmd.Context(), collectionURL, request, w, opts...)
+			if err := finish(err); err != nil {
+				fmt.Printf("Error fetching features: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("✓ GeoParquet file with %d features generated successfully and saved to: %s\n", report.Features, outputPath)
+			printRepairs(os.Stdout, report)
+		},
+	}
+	fetchCmd.Flags().StringP("output", "o", "", "Output path for the GeoParquet file (default [collection].parquet)")
+	fetchCmd.Flags().Int("limit", 1000, "Number of features requested per page (0 for the server default)")
+	fetchCmd.Flags().Int("max-features", 0, "Stop after this many features (0 for the whole collection)")
+	fetchCmd.Flags().StringArray("header", nil, "HTTP header sent with every request, as 'Name: value' (repeatable)")
+	fetchCmd.Flags().Bool("progress", false, "Display a progress bar while writing")
+	addWriteFlags(fetchCmd)
+
+	return fetchCmd
+}
+
+// Watch command
+func watchCmd() *cobra.Command {
+	var watchCmd = &cobra.Command{
+		Use:   "watch [directory]",
+		Short: "Convert GeoJSON files as they appear in a directory",
+		Long: `Watch a directory and convert new or changed GeoJSON files to GeoParquet.
+
+A file is converted once it has not changed for the --settle duration, so that
+files still being written are not picked up early. Runs until interrupted.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			dir := args[0]
+			flagOutDir, _ := cmd.Flags().GetString("out-dir")
+			flagSettle, _ := cmd.Flags().GetDuration("settle")
+
+			if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+				fmt.Printf("Error: Directory '%s' does not exist.\n", dir)
+				os.Exit(1)
+			}
+
+			if flagOutDir == "" {
+				flagOutDir = dir
+			}
+			if isLocalPath(flagOutDir) {
+				if err := os.MkdirAll(flagOutDir, 0750); err != nil {
+					fmt.Printf("Error: Failed to create output directory: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			opts, err := generateOptions(cmd)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Watching '%s' for GeoJSON files (Ctrl+C to stop)...\n", dir)
+			err = watchDirectory(cmd.Context(), dir, flagSettle, func(geojsonPath string) {
+				if !fileExists(geojsonPath) {
+					return
+				}
+
+				outputPath := joinOutputPath(flagOutDir, replaceExtension(geojsonPath, ".parquet"))
+				report, err := generateFile(cmd.Context(), geojsonPath, outputPath, opts)
+				if err != nil {
+					fmt.Printf("✗ %s: %v\n", geojsonPath, err)
+					return
+				}
+				fmt.Printf("✓ %s -> %s (%d features)\n", geojsonPath, outputPath, report.Features)
+				printRepairs(os.Stdout, report)
+			})
+			if err != nil {
+				fmt.Printf("Error: Failed to watch directory: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	watchCmd.Flags().String("out-dir", "", "Directory or remote prefix for the GeoParquet files (default the watched directory)")
+	watchCmd.Flags().Duration("settle", 500*time.Millisecond, "Time a file must remain unchanged before it is converted")
+	addGenerateFlags(watchCmd)
+
+	return watchCmd
+}
+
+// Serve command
+func serveCmd() *cobra.Command {
+	var serveCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "Serve GeoParquet files over HTTP",
+	}
+	serveCmd.AddCommand(serveTilesCmd())
+	serveCmd.AddCommand(serveFeaturesCmd())
+	serveCmd.AddCommand(serveGRPCCmd())
+	serveCmd.AddCommand(serveAPICmd())
+
+	return serveCmd
+}
+
+// Serve tiles command
+func serveTilesCmd() *cobra.Command {
+	var tilesCmd = &cobra.Command{
+		Use:   "tiles [geoparquetPath]",
+		Short: "Serve the features of a GeoParquet file as vector tiles",
+		Long: `Serve the features of a GeoParquet file as Mapbox Vector Tiles at
+/{z}/{x}/{y}.mvt, with a TileJSON description at /tiles.json, to preview a dataset
+on a map without a tile pipeline, e.g. in MapLibre or QGIS.
+
+Each tile reads the features intersecting it. When the file has a bbox covering
+column, row groups whose column statistics lie outside the tile are skipped without
+being decoded, so a file written with generate --spatial-sort hilbert --bbox-column
+serves tiles without reading most of it. The coordinates must be longitudes and
+latitudes. Runs until interrupted.
+
+The input may be a local path or an s3://, gs:// or az:// URI, which is downloaded
+into memory.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			input := args[0]
+			flagHost, _ := cmd.Flags().GetString("host")
+			flagPort, _ := cmd.Flags().GetInt("port")
+			flagLayer, _ := cmd.Flags().GetString("layer")
+			flagMinZoom, _ := cmd.Flags().GetInt("min-zoom")
+
+			r, size, closeInput, err := openParquet(cmd.Context(), input)
+			if err != nil {
+				fmt.Printf("Error reading input: %v\n", err)
+				os.Exit(1)
+			}
+			defer closeInput()
+
+			server, err := gogeo.NewTileServer(r, size, gogeo.TileOptions{Layer: flagLayer, MinZoom: flagMinZoom})
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			addr := net.JoinHostPort(flagHost, strconv.Itoa(flagPort))
+			fmt.Printf("Serving tiles of '%s' at http://%s/{z}/{x}/{y}.mvt (Ctrl+C to stop)...\n", input, addr)
+			if err := serveHTTP(cmd.Context(), addr, server); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	addServeFlags(tilesCmd)
+	tilesCmd.Flags().String("layer", gogeo.DefaultTileLayer, "Name of the layer of the tiles")
+	tilesCmd.Flags().Int("min-zoom", 0, "Lowest zoom level served")
+
+	return tilesCmd
+}
+
+// Serve features command
+func serveFeaturesCmd() *cobra.Command {
+	var featuresCmd = &cobra.Command{
+		Use:   "features [geoparquetPath]",
+		Short: "Serve a GeoParquet file as an OGC API Features service",
+		Long: `Serve the features of a GeoParquet file as a collection of an OGC API Features
+service, readable by QGIS, ArcGIS, OpenLayers and other clients of the standard.
+
+The features are served as GeoJSON at /collections/{collection}/items, paged with
+the limit and offset parameters, and filtered with bbox, a CQL2 text filter as for
+--where, e.g. filter=population > 10000, and equality on a property given as a
+parameter of its name, e.g. ?country=CH. Each feature is identified by its row
+number, at /collections/{collection}/items/{row}.
+
+When the file has a bbox covering column, row groups whose column statistics lie
+outside bbox are skipped without being decoded. The coordinates must be longitudes
+and latitudes. Runs until interrupted.
+
+The input may be a local path or an s3://, gs:// or az:// URI, which is downloaded
+into memory.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			input := args[0]
+			flagHost, _ := cmd.Flags().GetString("host")
+			flagPort, _ := cmd.Flags().GetInt("port")
+			flagCollection, _ := cmd.Flags().GetString("collection")
+			flagTitle, _ := cmd.Flags().GetString("title")
+			if flagCollection == "" {
+				// data.geoparquet is served as the collection data
+				flagCollection = strings.TrimSuffix(path.Base(input), path.Ext(input))
+			}
+
+			r, size, closeInput, err := openParquet(cmd.Context(), input)
+			if err != nil {
+				fmt.Printf("Error reading input: %v\n", err)
+				os.Exit(1)
+			}
+			defer closeInput()
+
+			server, err := gogeo.NewFeatureServer(r, size, gogeo.FeatureServerOptions{Collection: flagCollection, Title: flagTitle})
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			addr := net.JoinHostPort(flagHost, strconv.Itoa(flagPort))
+			fmt.Printf("Serving '%s' at http://%s/collections/%s/items (Ctrl+C to stop)...\n", input, addr, flagCollection)
+			if err := serveHTTP(cmd.Context(), addr, server); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	addServeFlags(featuresCmd)
+	featuresCmd.Flags().String("collection", "", "Id of the collection (default the file name without its extension)")
+	featuresCmd.Flags().String("title", "", "Title of the collection (default its id)")
+
+	return featuresCmd
+}
+
+// Serve gRPC command
+func serveGRPCCmd() *cobra.Command {
+	var grpcCmd = &cobra.Command{
+		Use:   "grpc",
+		Short: "Run a gRPC service converting streamed features to GeoParquet",
+		Long: `Run the gogeo.v1.Converter gRPC service defined in
+proto/gogeo/v1/converter.proto, so that other services can convert features
+without shelling out to the CLI.
+
+Clients stream GeoJSON features to the Convert method and receive the GeoParquet
+file back in chunks. With --sink, a request naming an output has the file written
+to that path under the sink instead, e.g. s3://bucket/converted/roads.parquet, and
+receives the number of features written. The features of a request are buffered
+in memory to infer the schema.
+
+The generate options set the defaults of every conversion; a request may override
+the compression, the bbox column and the row group size. The service speaks HTTP/2
+without TLS, so run it behind a TLS-terminating proxy when it is exposed. Runs
+until interrupted.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			flagHost, _ := cmd.Flags().GetString("host")
+			flagPort, _ := cmd.Flags().GetInt("port")
+			flagSink, _ := cmd.Flags().GetString("sink")
+
+			opts, err := generateOptions(cmd)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			options := gogeo.ConvertServiceOptions{Options: opts}
+			if flagSink != "" {
+				options.Sink = func(name string) (gogeo.BlobWriter, error) {
+					return gogeo.CreateBlob(cmd.Context(), joinOutputPath(flagSink, name))
+				}
+			}
+
+			addr := net.JoinHostPort(flagHost, strconv.Itoa(flagPort))
+			fmt.Printf("Serving %s at %s (Ctrl+C to stop)...\n", gogeo.ConvertMethod, addr)
+			if err := serveHTTP(cmd.Context(), addr, gogeo.NewConvertService(options)); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	addServeFlags(grpcCmd)
+	grpcCmd.Flags().String("sink", "", "Directory or remote prefix such as s3://bucket/converted for the outputs named by the requests")
+	addWriteFlags(grpcCmd)
+
+	return grpcCmd
+}
+
+// Serve API command
+func serveAPICmd() *cobra.Command {
+	var apiCmd = &cobra.Command{
+		Use:   "api",
+		Short: "Run an HTTP API converting GeoJSON to GeoParquet",
+		Long: `Run an HTTP API converting GeoJSON to GeoParquet, so that web applications can
+offer a "download as GeoParquet" button without running the CLI.
+
+POST a FeatureCollection to /convert, or newline-delimited GeoJSON with the
+application/geo+json-seq content type, optionally compressed with
+Content-Encoding: gzip, and receive the GeoParquet file as an attachment. The
+compression, bbox-column and row-group-size query parameters override the
+defaults of a request, and filename names the file downloaded, e.g.
+/convert?compression=zstd&filename=roads.parquet. Errors are returned as JSON.
+
+The features of a request are held in memory to infer the schema, so requests
+larger than --max-body-mb after decompression, or with more than --max-features
+features, are rejected with status 413. Cross-origin requests are allowed. Runs
+until interrupted.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			flagHost, _ := cmd.Flags().GetString("host")
+			flagPort, _ := cmd.Flags().GetInt("port")
+			flagMaxBody, _ := cmd.Flags().GetInt64("max-body-mb")
+			flagMaxFeatures, _ := cmd.Flags().GetInt("max-features")
+			if flagMaxBody <= 0 {
+				fmt.Printf("Error: --max-body-mb must be positive\n")
+				os.Exit(1)
+			}
+			if flagMaxFeatures < 0 {
+				fmt.Printf("Error: --max-features must not be negative\n")
+				os.Exit(1)
+			}
+
+			opts, err := generateOptions(cmd)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			api := gogeo.NewConvertAPI(gogeo.ConvertAPIOptions{
+				Options:     opts,
+				MaxBodySize: flagMaxBody << 20,
+				MaxFeatures: flagMaxFeatures,
+			})
+
+			addr := net.JoinHostPort(flagHost, strconv.Itoa(flagPort))
+			fmt.Printf("Serving conversions at http://%s/convert (Ctrl+C to stop)...\n", addr)
+			if err := serveHTTP(cmd.Context(), addr, api); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	addServeFlags(apiCmd)
+	apiCmd.Flags().Int64("max-body-mb", gogeo.DefaultMaxBodySize>>20, "Largest request body, after decompression, in MiB")
+	apiCmd.Flags().Int("max-features", 0, "Largest number of features of a request (0 for no limit)")
+	addWriteFlags(apiCmd)
+
+	return apiCmd
+}
+
+// addServeFlags adds the flags of the address the serve commands listen on
+func addServeFlags(cmd *cobra.Command) {
+	cmd.Flags().String("host", "localhost", "Host to listen on, e.g. 0.0.0.0 for all interfaces")
+	cmd.Flags().Int("port", 8080, "Port to listen on")
+}
@@ -3,7 +3,28 @@
 // gogeo is a Go implementation for converting GeoJSON to GeoParquet format.
 //
 // The command-line tool provides functionality to:
-//   - Generate GeoParquet from GeoJSON files with WKB geometry encoding
+//   - Generate GeoParquet from GeoJSON files with WKB geometry encoding, optionally sorted along a Hilbert curve or by property columns
+//   - Convert GeoParquet files back to GeoJSON
+//   - Export GeoParquet files as CSV with WKT geometries
+//   - Inspect the metadata and Parquet schema of GeoParquet files
+//   - Infer the schema of an input as JSON without converting it
+//   - Print the first features or a random sample of a GeoParquet file as GeoJSON
+//   - Count features, optionally within a bounding box, and compute per-property statistics
+//   - Validate GeoParquet files against the specification
+//   - Check GeoJSON files for structural problems before converting them
+//   - Compare the features and schemas of two files
+//   - Read and edit the geo metadata of existing files by rewriting only their footer
+//   - Upgrade GeoParquet 1.0 and older files to GeoParquet 1.1
+//   - Merge GeoParquet files with compatible schemas into one, or append features to an existing file
+//   - Partition large datasets into quadtree cells with a manifest of their bounds
+//   - Extract the features of a GeoParquet file within a bounding box or matching a filter
+//   - Extract tagged nodes and ways from OpenStreetMap PBF files
+//   - Export PostGIS tables and queries to GeoParquet, and import GeoParquet into PostGIS
+//   - Fetch OGC API Features collections into GeoParquet
+//   - Watch a directory and convert GeoJSON files as they appear
+//   - Serve GeoParquet files as vector tiles or as OGC API Features collections
+//   - Run a gRPC conversion service for other microservices
+//   - Run an HTTP API converting GeoJSON to GeoParquet for web applications
 //   - Display version and build information
 //
 // # Command Reference
@@ -12,6 +33,262 @@
 //
 //	gogeo generate data.geojson
 //
+// Sort the rows along a Hilbert curve so that spatial queries skip most row groups:
+//
+//	gogeo generate data.geojson --spatial-sort hilbert --bbox-column
+//
+// Encode smaller pages to convert a wide table with less memory:
+//
+//	gogeo generate census.geojson --page-size 64KiB
+//
+// Keep the footer small: no statistics for a JSON column, short ones for strings:
+//
+//	gogeo generate parcels.geojson --skip-statistics attributes --truncate-statistics 16
+//
+// Convert a file larger than memory within a budget:
+//
+//	gogeo generate buildings.geojsonl --max-memory 512MB
+//
+// Check a conversion without writing the output:
+//
+//	gogeo generate roads.geojson --strict-types --dry-run
+//
+// Only convert the files changed since the last run:
+//
+//	gogeo generate "data/*.geojson" --out-dir parquet/ --if-newer
+//
+// Write a file that Athena queries:
+//
+//	gogeo generate parcels.geojson --compat athena
+//
+// Convert only the features matching a filter:
+//
+//	gogeo generate cities.geojson --where "population > 10000 AND country = 'US'"
+//
+// Drop and rename properties while converting:
+//
+//	gogeo generate export.geojson --exclude-columns _internal_id --rename NAME=name
+//
+// Simplify the geometries:
+//
+//	gogeo generate boundaries.geojson --simplify 0.0001
+//
+// Round coordinates to 6 decimal places:
+//
+//	gogeo generate data.geojson --precision 6
+//
+// Repair invalid geometries:
+//
+//	gogeo generate parcels.geojson --make-valid
+//
+// Orient polygon rings as RFC 7946 recommends:
+//
+//	gogeo generate parcels.geojson --counterclockwise
+//
+// Write every polygon as a MultiPolygon:
+//
+//	gogeo generate countries.geojson --promote-to-multi
+//
+// Write each member of a GeometryCollection as a row of its own:
+//
+//	gogeo generate sites.geojson --collections explode
+//
+// Add a label point within each polygon:
+//
+//	gogeo generate parcels.geojson --point-on-surface-column label
+//
+// Add geodesic area and length columns:
+//
+//	gogeo generate features.geojson --add-area area_km2 --add-length length_m
+//
+// Split the lines and polygons crossing the antimeridian:
+//
+//	gogeo generate pacific.geojson --split-antimeridian
+//
+// Leave out the features without a geometry:
+//
+//	gogeo generate features.geojson --null-geometries skip
+//
+// Stop at the first feature with an empty geometry:
+//
+//	gogeo generate features.geojson --empty-geometries fail
+//
+// Add a geohash column of precision 9:
+//
+//	gogeo generate features.geojson --add-geohash 9
+//
+// Add the S2 cell ids of level 13:
+//
+//	gogeo generate features.geojson --add-s2 s2_13:13
+//
+// Add the H3 cell ids of resolution 9:
+//
+//	gogeo generate features.geojson --add-h3 9
+//
+// Add the quadkeys of the tiles of zoom 12:
+//
+//	gogeo generate features.geojson --add-quadkey 12
+//
+// Enrich features with the columns of a CSV lookup table:
+//
+//	gogeo generate shapes.geojson --join lookup.csv --on id
+//
+// Override the inferred type of columns:
+//
+//	gogeo generate addresses.geojson --cast zipcode:string --cast elevation:float
+//
+// Write timestamps and dates as TIMESTAMP and DATE columns:
+//
+//	gogeo generate events.geojson --infer-temporal
+//
+// Write nested objects as struct columns:
+//
+//	gogeo generate places.geojson --struct-columns
+//
+// Write arrays of tags as LIST columns:
+//
+//	gogeo generate parks.geojson --list-columns
+//
+// Store small ids and counts in 8, 16 or 32 bits:
+//
+//	gogeo generate stations.csv --lon lon --lat lat --narrow-integers
+//
+// Declare the properties every feature has as REQUIRED columns:
+//
+//	gogeo generate census.geojson --required-columns
+//
+// Fail on columns mixing numbers and strings instead of writing them as strings:
+//
+//	gogeo generate census.geojson --strict-types
+//
+// Dictionary-encode category columns with up to 50 distinct values:
+//
+//	gogeo generate parcels.geojson --enum-columns 50
+//
+// Delta-encode sequential ids and timestamps, and split measurement bytes:
+//
+//	gogeo generate sensors.geojson --infer-temporal --encoding id=delta,time=delta,reading=byte-stream-split
+//
+// Store UUID identifiers in 16 bytes:
+//
+//	gogeo generate assets.geojson --infer-uuid
+//
+// Parse timestamps written in another layout:
+//
+//	gogeo generate events.geojson --datetime-column 'start_time:02/01/2006 15:04'
+//
+// Write the rows ordered by property columns:
+//
+//	gogeo generate cities.geojson --sort-by country,population:desc
+//
+// Convert a remote GeoJSON file:
+//
+//	gogeo generate https://example.com/cities.geojson --header "Authorization: Bearer $TOKEN"
+//
+// Convert between objects in S3, Google Cloud Storage or Azure Blob Storage:
+//
+//	gogeo generate s3://bucket/cities.geojson -o gs://bucket/cities.parquet
+//
+// Convert every GeoJSON file of a ZIP archive:
+//
+//	gogeo generate data.zip --out-dir parquet/
+//
+// Convert GeoParquet back to GeoJSON:
+//
+//	gogeo convert data.geoparquet -o data.geojson
+//
+// Export GeoParquet as CSV for a data warehouse or spreadsheet:
+//
+//	gogeo export data.geoparquet -o data.csv --geometry wkt
+//
+// Inspect a GeoParquet file:
+//
+//	gogeo info data.geoparquet --json
+//
+// Write the inferred schema of an input for review before converting it:
+//
+//	gogeo schema-infer input.geojson -o schema.json
+//
+// Print a reproducible 1% sample of a file:
+//
+//	gogeo head data.geoparquet --sample 0.01 --seed 42
+//
+// Count the features within a bounding box:
+//
+//	gogeo count data.geoparquet --bbox 8.4,47.3,8.6,47.5
+//
+// Compute statistics of a file:
+//
+//	gogeo stats data.geoparquet --json
+//
+// Check a GeoJSON file before converting it:
+//
+//	gogeo validate-geojson data.geojson
+//
+// Compare two releases of a dataset:
+//
+//	gogeo diff parcels-2024.parquet parcels-2025.parquet --key parcel_id
+//
+// Declare the CRS of an existing file:
+//
+//	gogeo meta set data.geoparquet --crs EPSG:3857
+//
+// Upgrade a GeoParquet 1.0 file, adding a bbox covering column:
+//
+//	gogeo upgrade old.parquet -o new.parquet --bbox-column
+//
+// Add features to an existing file as new row groups:
+//
+//	gogeo generate more.geojson -o existing.parquet --append
+//
+// Combine regional extracts into one file:
+//
+//	gogeo merge north.parquet south.parquet -o country.parquet
+//
+// Split a large dataset into parts of at most 100000 features:
+//
+//	gogeo partition buildings.parquet --out-dir buildings/
+//
+// Extract the features within a bounding box, clipping them to it:
+//
+//	gogeo extract data.geoparquet --bbox 8.4,47.3,8.6,47.5 -o subset.geoparquet --clip
+//
+// Extract the roads of an OpenStreetMap extract:
+//
+//	gogeo osm extract planet.osm.pbf --tags highway -o roads.geoparquet
+//
+// Export the result of a PostGIS query:
+//
+//	gogeo pg export --dsn postgres://user@localhost/gis --query "SELECT * FROM roads" -o roads.parquet
+//
+// Load a GeoParquet file into a new PostGIS table:
+//
+//	gogeo pg import roads.parquet --dsn postgres://user@localhost/gis --table public.roads
+//
+// Fetch an OGC API Features collection:
+//
+//	gogeo fetch https://demo.pygeoapi.io/master/collections/lakes -o lakes.parquet
+//
+// Convert files dropped into a landing folder:
+//
+//	gogeo watch landing/ --out-dir parquet/
+//
+// Preview a dataset on a map as vector tiles:
+//
+//	gogeo serve tiles buildings.parquet --port 8080
+//
+// Serve a dataset as an OGC API Features collection:
+//
+//	gogeo serve features data.geoparquet --port 8080
+//
+// Run a gRPC conversion service writing the files to a bucket:
+//
+//	gogeo serve grpc --port 9090 --sink s3://bucket/converted
+//
+// Run an HTTP API converting GeoJSON to GeoParquet:
+//
+//	gogeo serve api --max-body-mb 16 --max-features 100000
+//
 // Show version information:
 //
 //	gogeo version
@@ -25,13 +302,32 @@
 package cmd
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/beyondcivic/gogeo/pkg/gogeo"
 	"github.com/beyondcivic/gogeo/pkg/version"
+	"github.com/fsnotify/fsnotify"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -57,11 +353,36 @@ func Init() {
 	// Add child commands
 	RootCmd.AddCommand(versionCmd())
 	RootCmd.AddCommand(generateCmd())
+	RootCmd.AddCommand(convertCmd())
+	RootCmd.AddCommand(exportCmd())
+	RootCmd.AddCommand(infoCmd())
+	RootCmd.AddCommand(schemaCmd())
+	RootCmd.AddCommand(schemaInferCmd())
+	RootCmd.AddCommand(headCmd())
+	RootCmd.AddCommand(countCmd())
+	RootCmd.AddCommand(statsCmd())
+	RootCmd.AddCommand(validateCmd())
+	RootCmd.AddCommand(validateGeoJSONCmd())
+	RootCmd.AddCommand(diffCmd())
+	RootCmd.AddCommand(metaCmd())
+	RootCmd.AddCommand(upgradeCmd())
+	RootCmd.AddCommand(mergeCmd())
+	RootCmd.AddCommand(partitionCmd())
+	RootCmd.AddCommand(extractCmd())
+	RootCmd.AddCommand(osmCmd())
+	RootCmd.AddCommand(pgCmd())
+	RootCmd.AddCommand(fetchCmd())
+	RootCmd.AddCommand(watchCmd())
+	RootCmd.AddCommand(serveCmd())
 }
 
 func Execute() {
+	// Cancel running conversions on interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Execute the command
-	if err := RootCmd.Execute(); err != nil {
+	if err := RootCmd.ExecuteContext(ctx); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
@@ -77,8 +398,12 @@ func fileExists(filename string) bool {
 	return !info.IsDir()
 }
 
-func isGeoJsonFile(filename string) bool {
-	return gogeo.IsGeoJsonFile(filename)
+func isFeatureFile(filename string) bool {
+	return gogeo.IsFeatureFile(filename)
+}
+
+func isGeoParquetFile(filename string) bool {
+	return gogeo.IsGeoParquetFile(filename)
 }
 
 func determineOutputPath(providedPath, csvPath string) string {
@@ -93,6 +418,949 @@ func determineOutputPath(providedPath, csvPath string) string {
 	}
 
 	// Generate default path based on CSV filename
-	baseName := strings.TrimSuffix(filepath.Base(csvPath), filepath.Ext(csvPath))
-	return baseName + ".parquet"
+	return replaceExtension(csvPath, ".parquet")
+}
+
+// replaceExtension returns the base name of path with its extension replaced
+func replaceExtension(path, ext string) string {
+	baseName := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return baseName + ext
+}
+
+// progressBarWidth is the number of characters of the rendered progress bar.
+const progressBarWidth = 40
+
+// printProgress renders a progress bar on the current terminal line of stderr
+func printProgress(done, total int) {
+	if total <= 0 {
+		fmt.Fprintf(os.Stderr, "\r  %d features written", done)
+		return
+	}
+
+	filled := done * progressBarWidth / total
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+	fmt.Fprintf(os.Stderr, "\r  [%s] %3d%% (%d/%d)", bar, done*100/total, done, total)
+	if done >= total {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// maxListedInvalid is the number of geometries that could not be repaired listed by printRepairs
+const maxListedInvalid = 10
+
+// printRepairs reports the features without a geometry or with an empty one skipped with
+// --null-geometries and --empty-geometries, those written with an empty geometry, the
+// geometries repaired with --make-valid and those that could not be
+func printRepairs(w io.Writer, report *gogeo.Report) {
+	if report.Skipped > 0 {
+		fmt.Fprintf(w, "  Skipped %d features without a geometry\n", report.Skipped)
+	}
+	if report.Dropped > 0 {
+		fmt.Fprintf(w, "  Dropped %d features with an empty geometry\n", report.Dropped)
+	}
+	if report.Empty > 0 {
+		fmt.Fprintf(w, "  Wrote %d features with an empty geometry\n", report.Empty)
+	}
+	if report.Repaired > 0 {
+		fmt.Fprintf(w, "  Repaired %d invalid geometries\n", report.Repaired)
+	}
+	if report.Unrepaired == 0 {
+		return
+	}
+	fmt.Fprintf(w, "  ⚠ %d geometries could not be repaired and were written as they are:\n", report.Unrepaired)
+	for i, invalid := range report.Invalid {
+		if i == maxListedInvalid {
+			break
+		}
+		if invalid.ID != nil {
+			fmt.Fprintf(w, "    feature %d (id %v): %s\n", invalid.Feature, invalid.ID, invalid.Problem)
+		} else {
+			fmt.Fprintf(w, "    feature %d: %s\n", invalid.Feature, invalid.Problem)
+		}
+	}
+	if report.Unrepaired > maxListedInvalid {
+		fmt.Fprintf(w, "    ... and %d more\n", report.Unrepaired-maxListedInvalid)
+	}
+}
+
+// stdioPath is the input or output path designating stdin or stdout.
+const stdioPath = "-"
+
+// generateFile converts GeoJSON to GeoParquet, where input and output may be stdioPath
+// or URIs of any registered gogeo.Blobstore. Stdin is converted with GenerateFromContext,
+// which buffers the input to infer the schema.
+func generateFile(ctx context.Context, input, output string, opts []gogeo.Option) (*gogeo.Report, error) {
+	// The format detected from the extension comes first so that --input-format overrides it
+	if format := gogeo.FormatFromPath(input); format != "" {
+		opts = append([]gogeo.Option{gogeo.WithInputFormat(format)}, opts...)
+	}
+
+	if isLocalPath(input) && isLocalPath(output) {
+		return gogeo.GenerateContext(ctx, input, output, opts...)
+	}
+
+	w, finish, err := createOutput(ctx, output)
+	if err != nil {
+		return nil, err
+	}
+
+	var report *gogeo.Report
+	if input == stdioPath {
+		report, err = gogeo.GenerateFromContext(ctx, os.Stdin, w, opts...)
+	} else {
+		report, err = gogeo.GenerateFromOpenerContext(ctx, gogeo.OpenBlobFunc(ctx, input), w, opts...)
+	}
+	if err := finish(err); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// printTypeConflicts lists the type conflicts found with --strict-types by column, if
+// err holds them
+func printTypeConflicts(w io.Writer, err error) {
+	var conflicts *gogeo.TypeConflictError
+	if !errors.As(err, &conflicts) {
+		return
+	}
+	listed := make(map[string]int)
+	for _, column := range conflicts.Columns {
+		fmt.Fprintf(w, "  Column %q:\n", column)
+		for _, conflict := range conflicts.Conflicts {
+			if conflict.Column != column {
+				continue
+			}
+			listed[column]++
+			if listed[column] > maxListedInvalid {
+				continue
+			}
+			value, _ := json.Marshal(conflict.Value)
+			if conflict.ID != nil {
+				fmt.Fprintf(w, "    feature %d (id %v): %s %s, expected %s\n", conflict.Feature, conflict.ID, conflict.Conflict, value, conflict.Type)
+			} else {
+				fmt.Fprintf(w, "    feature %d: %s %s, expected %s\n", conflict.Feature, conflict.Conflict, value, conflict.Type)
+			}
+		}
+		if listed[column] > maxListedInvalid {
+			fmt.Fprintf(w, "    ... and %d more\n", listed[column]-maxListedInvalid)
+		}
+	}
+	if conflicts.Omitted > 0 {
+		fmt.Fprintf(w, "  ... and %d more conflicts\n", conflicts.Omitted)
+	}
+}
+
+// inferSchemaFile infers the schema of a local, stdin or remote input
+func inferSchemaFile(ctx context.Context, input string, opts []gogeo.Option) (*gogeo.Report, error) {
+	if format := gogeo.FormatFromPath(input); format != "" {
+		opts = append([]gogeo.Option{gogeo.WithInputFormat(format)}, opts...)
+	}
+
+	if isLocalPath(input) {
+		return gogeo.InferSchemaContext(ctx, input, opts...)
+	}
+	if input == stdioPath {
+		return gogeo.InferSchemaFromContext(ctx, os.Stdin, opts...)
+	}
+	body, err := gogeo.OpenBlob(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return gogeo.InferSchemaFromContext(ctx, body, opts...)
+}
+
+// byteCounter is an io.Writer counting the bytes written to it and discarding them
+type byteCounter int64
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
+
+// dryRunFile converts an input, which may be stdioPath or a URI, without writing the
+// output, and returns the report and the size of the output
+func dryRunFile(ctx context.Context, input string, opts []gogeo.Option) (*gogeo.Report, int64, error) {
+	if format := gogeo.FormatFromPath(input); format != "" {
+		opts = append([]gogeo.Option{gogeo.WithInputFormat(format)}, opts...)
+	}
+
+	var size byteCounter
+	var report *gogeo.Report
+	var err error
+	if input == stdioPath {
+		report, err = gogeo.GenerateFromContext(ctx, os.Stdin, &size, opts...)
+	} else {
+		report, err = gogeo.GenerateFromOpenerContext(ctx, gogeo.OpenBlobFunc(ctx, input), &size, opts...)
+	}
+	return report, int64(size), err
+}
+
+// appendFile adds the features of an input as new row groups of an existing local
+// GeoParquet file, replacing it
+func appendFile(ctx context.Context, input, output string, opts []gogeo.Option) (*gogeo.Report, error) {
+	if format := gogeo.FormatFromPath(input); format != "" {
+		opts = append([]gogeo.Option{gogeo.WithInputFormat(format)}, opts...)
+	}
+
+	file, err := os.Open(output)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var report *gogeo.Report
+	err = replaceFile(output, func(w io.Writer) error {
+		var err error
+		report, err = gogeo.AppendGeoParquet(ctx, gogeo.OpenBlobFunc(ctx, input), file, info.Size(), w, opts...)
+		return err
+	})
+	return report, err
+}
+
+// overwritePolicy decides whether generate replaces existing outputs, from the --force
+// and --if-newer flags
+type overwritePolicy struct {
+	force   bool
+	ifNewer bool
+}
+
+// check returns whether the conversion of input to output is skipped since the output is
+// up to date, or an error if the output exists and may not be overwritten. Only local
+// outputs are checked.
+func (p overwritePolicy) check(input, output string) (bool, error) {
+	if !isLocalPath(output) {
+		return false, nil
+	}
+	outputInfo, err := os.Stat(output)
+	if err != nil {
+		return false, nil
+	}
+	if p.ifNewer {
+		if !isLocalPath(input) {
+			return false, nil
+		}
+		inputInfo, err := os.Stat(input)
+		return err == nil && !outputInfo.ModTime().Before(inputInfo.ModTime()), nil
+	}
+	if !p.force {
+		return false, fmt.Errorf("output %s already exists, use --force to overwrite it", output)
+	}
+	return false, nil
+}
+
+// isLocalPath checks whether a path designates a local file rather than a stream or a remote object
+func isLocalPath(path string) bool {
+	return path != stdioPath && !gogeo.IsRemoteURI(path)
+}
+
+// joinOutputPath returns the path of the output named name in dir, which may be a remote prefix
+// such as s3://bucket/dir
+func joinOutputPath(dir, name string) string {
+	if gogeo.IsRemoteURI(dir) {
+		return strings.TrimSuffix(dir, "/") + "/" + name
+	}
+	return filepath.Join(dir, name)
+}
+
+// createOutput opens an output for writing, which may be stdioPath or the URI of a
+// gogeo.Blobstore. finish must be called with the outcome of the conversion: it completes
+// the output, or discards it if the conversion failed, and returns the first error.
+func createOutput(ctx context.Context, output string) (io.Writer, func(error) error, error) {
+	if output == stdioPath {
+		return os.Stdout, func(err error) error { return err }, nil
+	}
+
+	blob, err := gogeo.CreateBlob(ctx, output)
+	if err != nil {
+		return nil, nil, err
+	}
+	return blob, func(err error) error {
+		if err != nil {
+			blob.Abort()
+			return err
+		}
+		return blob.Close()
+	}, nil
+}
+
+// readInput reads a whole input, which may be stdioPath or the URI of a gogeo.Blobstore
+func readInput(ctx context.Context, input string) ([]byte, error) {
+	if input == stdioPath {
+		return io.ReadAll(os.Stdin)
+	}
+
+	blob, err := gogeo.OpenBlob(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+	return io.ReadAll(blob)
+}
+
+// openParquet opens a local Parquet file for random access, or downloads a remote one
+// into memory. close releases the input.
+func openParquet(ctx context.Context, input string) (io.ReaderAt, int64, func() error, error) {
+	if isLocalPath(input) {
+		file, err := os.Open(input)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, 0, nil, err
+		}
+		return file, info.Size(), file.Close, nil
+	}
+
+	data, err := readInput(ctx, input)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return bytes.NewReader(data), int64(len(data)), func() error { return nil }, nil
+}
+
+// openFeatures opens a GeoParquet file, recognized by its extension, or GeoJSON in the
+// given format, for streaming its features
+func openFeatures(ctx context.Context, input, format string) (gogeo.FeatureReader, func() error, error) {
+	if input != stdioPath && isGeoParquetFile(input) {
+		r, size, closeInput, err := openParquet(ctx, input)
+		if err != nil {
+			return nil, nil, err
+		}
+		next, stop := iter.Pull2(gogeo.FeaturesFrom(r, size))
+		return pulledFeatures(next), func() error {
+			stop()
+			return closeInput()
+		}, nil
+	}
+
+	if format == "" {
+		format = gogeo.FormatFromPath(input)
+	}
+	if format == "" {
+		format = gogeo.FormatGeoJSON
+	}
+	if format != gogeo.FormatGeoJSON && format != gogeo.FormatGeoJSONL {
+		return nil, nil, fmt.Errorf("unsupported input format %q, expected GeoParquet, geojson or geojsonl", format)
+	}
+
+	var body io.ReadCloser = io.NopCloser(os.Stdin)
+	if input != stdioPath {
+		var err error
+		if body, err = gogeo.OpenBlob(ctx, input); err != nil {
+			return nil, nil, err
+		}
+	}
+	if format == gogeo.FormatGeoJSONL {
+		return gogeo.NewGeoJSONSeqDecoder(body), body.Close, nil
+	}
+	return gogeo.NewGeoJSONDecoder(body), body.Close, nil
+}
+
+// pulledFeatures is a gogeo.FeatureReader over a pulled feature iterator
+type pulledFeatures func() (*geojson.Feature, error, bool)
+
+func (next pulledFeatures) Next() (*geojson.Feature, error) {
+	feature, err, ok := next()
+	if !ok {
+		return nil, io.EOF
+	}
+	return feature, err
+}
+
+// printFileInfo prints the summary of a GeoParquet file as a table
+func printFileInfo(w io.Writer, name string, info *gogeo.FileInfo) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "File:\t%s\n", name)
+	fmt.Fprintf(table, "Size:\t%s\n", formatBytes(info.Size))
+	fmt.Fprintf(table, "Rows:\t%d\n", info.Rows)
+	fmt.Fprintf(table, "Row groups:\t%d\n", info.RowGroups)
+	fmt.Fprintf(table, "Compression:\t%s\n", strings.Join(info.Compression, ", "))
+	if info.CreatedBy != "" {
+		fmt.Fprintf(table, "Created by:\t%s\n", info.CreatedBy)
+	}
+	if info.Geo == nil {
+		fmt.Fprintf(table, "GeoParquet:\tno geo metadata, plain Parquet file\n")
+		table.Flush()
+		return
+	}
+	fmt.Fprintf(table, "GeoParquet:\t%s\n", info.Geo.Version)
+	fmt.Fprintf(table, "Primary column:\t%s\n", info.Geo.PrimaryColumn)
+	table.Flush()
+
+	fmt.Fprintln(w)
+	printGeoColumns(w, info.Geo)
+}
+
+// printDryRun prints the features, size, geometry and property columns of the output
+// of a dry run as tables
+func printDryRun(w io.Writer, report *gogeo.Report, size int64) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "Features:\t%d\n", report.Features)
+	fmt.Fprintf(table, "Estimated size:\t%s\n", formatBytes(size))
+	fmt.Fprintf(table, "GeoParquet:\t%s\n", report.Metadata.Version)
+	fmt.Fprintf(table, "Primary column:\t%s\n", report.Metadata.PrimaryColumn)
+	table.Flush()
+
+	fmt.Fprintln(w)
+	printGeoColumns(w, report.Metadata)
+
+	if len(report.Properties) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	table = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "PROPERTY\tTYPE\tREPETITION")
+	printProperties(table, "", report.Properties)
+	table.Flush()
+}
+
+// printProperties prints a row per property column, and per field of struct columns
+func printProperties(w io.Writer, prefix string, properties []gogeo.PropertyInfo) {
+	for _, property := range properties {
+		repetition := "required"
+		if property.Nullable {
+			repetition = "optional"
+		}
+		propertyType := property.Type.String()
+		switch {
+		case property.Type == gogeo.PropertyTypeList:
+			propertyType += "<" + property.Element.String() + ">"
+		case property.Bits > 0:
+			propertyType = "int" + strconv.Itoa(property.Bits)
+		}
+		fmt.Fprintf(w, "%s%s\t%s\t%s\n", prefix, property.Name, propertyType, repetition)
+		if property.Type == gogeo.PropertyTypeStruct {
+			printProperties(w, prefix+property.Name+".", property.Fields)
+		}
+	}
+}
+
+// printGeoColumns prints the geometry columns of geo metadata as a table
+func printGeoColumns(w io.Writer, geo *gogeo.GeoParquet) {
+	names := make([]string, 0, len(geo.Columns))
+	for name := range geo.Columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "COLUMN\tENCODING\tGEOMETRY TYPES\tBBOX\tCRS")
+	for _, name := range names {
+		column := geo.Columns[name]
+		types := "any"
+		if len(column.GeometryTypes) > 0 {
+			types = strings.Join(column.GeometryTypes, ", ")
+		}
+		bbox := "-"
+		if len(column.BBox) > 0 {
+			values := make([]string, len(column.BBox))
+			for i, value := range column.BBox {
+				values[i] = strconv.FormatFloat(value, 'f', -1, 64)
+			}
+			bbox = "[" + strings.Join(values, ", ") + "]"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", name, column.Encoding, types, bbox, crsLabel(column.CRS))
+	}
+	table.Flush()
+}
+
+// printColumns prints the columns of a Parquet schema as a table
+func printColumns(w io.Writer, columns []gogeo.ColumnInfo) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "COLUMN\tPHYSICAL\tLOGICAL\tREPETITION\tENCODINGS\tGEOMETRY")
+	for _, column := range columns {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n", column.Path, column.PhysicalType,
+			orDash(column.LogicalType), column.Repetition, orDash(strings.Join(column.Encodings, ", ")), orDash(column.Geometry))
+	}
+	table.Flush()
+}
+
+// printStats prints the statistics of a file as tables
+func printStats(w io.Writer, stats *gogeo.Stats) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "Features:\t%d\n", stats.Features)
+	fmt.Fprintf(table, "Vertices:\t%d\n", stats.Vertices)
+	bbox := "-"
+	if stats.BBox != nil {
+		values := make([]string, len(stats.BBox))
+		for i, value := range stats.BBox {
+			values[i] = strconv.FormatFloat(value, 'f', -1, 64)
+		}
+		bbox = "[" + strings.Join(values, ", ") + "]"
+	}
+	fmt.Fprintf(table, "BBox:\t%s\n", bbox)
+
+	types := make([]string, 0, len(stats.GeometryTypes))
+	for name := range stats.GeometryTypes {
+		types = append(types, name)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if stats.GeometryTypes[types[i]] != stats.GeometryTypes[types[j]] {
+			return stats.GeometryTypes[types[i]] > stats.GeometryTypes[types[j]]
+		}
+		return types[i] < types[j]
+	})
+	for i, name := range types {
+		label := ""
+		if i == 0 {
+			label = "Geometry types:"
+		}
+		fmt.Fprintf(table, "%s\t%s: %d\n", label, name, stats.GeometryTypes[name])
+	}
+	table.Flush()
+
+	if len(stats.Properties) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	table = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "PROPERTY\tTYPE\tNULLS\tDISTINCT\tMIN\tMAX")
+	for _, property := range stats.Properties {
+		distinct := strconv.FormatInt(property.Distinct, 10)
+		if property.DistinctCapped {
+			distinct += "+"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%d\t%s\t%s\t%s\n", property.Name, property.Type, property.Nulls,
+			distinct, statValue(property.Min), statValue(property.Max))
+	}
+	table.Flush()
+}
+
+// statValue renders the minimum or maximum of a property for a table cell
+func statValue(value any) string {
+	const maxLength = 32
+
+	switch v := value.(type) {
+	case nil:
+		return "-"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		runes := []rune(strconv.Quote(v))
+		if len(runes) > maxLength {
+			return string(runes[:maxLength-4]) + "...\""
+		}
+		return string(runes)
+	}
+	return fmt.Sprint(value)
+}
+
+// printDiff prints the differences between two files
+func printDiff(w io.Writer, oldName, newName string, report *gogeo.DiffReport) {
+	fmt.Fprintf(w, "%s: %d features, %s: %d features\n", oldName, report.OldFeatures, newName, report.NewFeatures)
+	fmt.Fprintf(w, "%d added, %d removed, %d changed, %d unchanged\n",
+		report.Added, report.Removed, report.Changed, report.Unchanged)
+	if report.DuplicateKeys > 0 {
+		fmt.Fprintf(w, "duplicate keys: %d, matched in order of appearance\n", report.DuplicateKeys)
+	}
+
+	symbols := map[string]string{gogeo.DiffAdded: "+", gogeo.DiffRemoved: "-", gogeo.DiffChanged: "~"}
+	if len(report.Schema) > 0 {
+		fmt.Fprintln(w, "\nSchema:")
+		for _, change := range report.Schema {
+			switch change.Change {
+			case gogeo.DiffAdded:
+				fmt.Fprintf(w, "  + %s (%s)\n", change.Property, change.NewType)
+			case gogeo.DiffRemoved:
+				fmt.Fprintf(w, "  - %s (%s)\n", change.Property, change.OldType)
+			default:
+				fmt.Fprintf(w, "  ~ %s: %s -> %s\n", change.Property, change.OldType, change.NewType)
+			}
+		}
+	}
+
+	if len(report.Changes) > 0 {
+		fmt.Fprintln(w, "\nFeatures:")
+		for _, change := range report.Changes {
+			if len(change.Fields) > 0 {
+				fmt.Fprintf(w, "  %s %s: %s\n", symbols[change.Change], change.Key, strings.Join(change.Fields, ", "))
+			} else {
+				fmt.Fprintf(w, "  %s %s\n", symbols[change.Change], change.Key)
+			}
+		}
+		if report.Omitted > 0 {
+			fmt.Fprintf(w, "  ... and %d more\n", report.Omitted)
+		}
+	}
+}
+
+// orDash returns value, or "-" if it is empty
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// crsLabel names a PROJJSON CRS by its authority code, or else its name
+func crsLabel(crs json.RawMessage) string {
+	if crs == nil {
+		return "OGC:CRS84 (default)"
+	}
+	var definition struct {
+		Name string `json:"name"`
+		ID   *struct {
+			Authority string `json:"authority"`
+			Code      any    `json:"code"`
+		} `json:"id"`
+	}
+	if err := json.Unmarshal(crs, &definition); err != nil || string(crs) == "null" {
+		return "unknown"
+	}
+	if definition.ID != nil {
+		return fmt.Sprintf("%s:%v", definition.ID.Authority, definition.ID.Code)
+	}
+	if definition.Name != "" {
+		return definition.Name
+	}
+	return "unknown"
+}
+
+// formatBytes renders a size in bytes with a binary unit
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, exponent := float64(size)/unit, 0
+	for value >= unit && exponent < 4 {
+		value /= unit
+		exponent++
+	}
+	return fmt.Sprintf("%.1f %ciB (%d bytes)", value, "KMGTP"[exponent], size)
+}
+
+// byteUnits are the suffixes of the sizes parsed by parseByteSize
+var byteUnits = []struct {
+	suffix string
+	size   int
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+	{"B", 1},
+}
+
+// parseByteSize parses a size in bytes of at most limit, with an optional binary unit
+// such as 64KiB
+func parseByteSize(text string, limit int) (int, error) {
+	text = strings.TrimSpace(text)
+	unit := 1
+	for _, candidate := range byteUnits {
+		if number, ok := strings.CutSuffix(text, candidate.suffix); ok {
+			text, unit = strings.TrimSpace(number), candidate.size
+			break
+		}
+	}
+	size, err := strconv.Atoi(text)
+	if err != nil || size < 0 || size > limit/unit {
+		return 0, fmt.Errorf("invalid size %q", text)
+	}
+	return size * unit, nil
+}
+
+// writeOutput writes data to a local file or the URI of a gogeo.Blobstore
+func writeOutput(ctx context.Context, output string, data []byte) error {
+	w, finish, err := createOutput(ctx, output)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return finish(err)
+}
+
+// registerHeaders sends header with the requests of HTTP(S) inputs
+func registerHeaders(header http.Header) {
+	if len(header) == 0 {
+		return
+	}
+	store := &gogeo.HTTPStore{Header: header}
+	gogeo.RegisterBlobstore("http", store)
+	gogeo.RegisterBlobstore("https", store)
+}
+
+// crsOption returns the option for a --crs value, either a CRS code or a path to a PROJJSON file
+func crsOption(value string) (gogeo.Option, error) {
+	if !fileExists(value) {
+		return gogeo.WithCRSCode(value), nil
+	}
+
+	definition, err := os.ReadFile(value)
+	if err != nil {
+		return nil, err
+	}
+	return gogeo.WithCRS(definition), nil
+}
+
+// joinOption reads the --join lookup table keyed on the --on column
+func joinOption(path, key string) (gogeo.Option, error) {
+	if path == "" || key == "" {
+		return nil, fmt.Errorf("--join and --on must be given together")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open join table: %w", err)
+	}
+	defer file.Close()
+
+	table, err := gogeo.ReadCSVJoinTable(file, key)
+	if err != nil {
+		return nil, err
+	}
+	return gogeo.WithJoin(table), nil
+}
+
+// crsDefinition resolves a --crs value given as a known code, a PROJJSON file, or null
+func crsDefinition(value string) (json.RawMessage, error) {
+	if value == "null" {
+		return json.RawMessage("null"), nil
+	}
+	if fileExists(value) {
+		return os.ReadFile(value)
+	}
+	return gogeo.LookupCRS(value)
+}
+
+// replaceFile replaces a local file with the output of write, through a temporary file
+// in the same directory so that the file is left untouched if write fails
+func replaceFile(path string, write func(w io.Writer) error) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		if err := file.Chmod(info.Mode()); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// geometryColumnOption returns the option for a --geometry-column value of the form name[:encoding]
+func geometryColumnOption(value string) (gogeo.Option, error) {
+	name, encoding, found := strings.Cut(value, ":")
+	if name == "" {
+		return nil, fmt.Errorf("missing column name in %q", value)
+	}
+	if !found {
+		encoding = gogeo.DefaultGeometryEncoding
+	}
+	return gogeo.WithGeometryColumn(name, encoding), nil
+}
+
+// sortByOption returns the option for --sort-by values of the form name[:asc|desc]
+func sortByOption(values []string) (gogeo.Option, error) {
+	columns := make([]gogeo.SortColumn, 0, len(values))
+	for _, value := range values {
+		name, direction, _ := strings.Cut(value, ":")
+		if name == "" {
+			return nil, fmt.Errorf("missing column name in %q", value)
+		}
+		column := gogeo.SortColumn{Name: name}
+		switch strings.ToLower(direction) {
+		case "", "asc":
+		case "desc":
+			column.Descending = true
+		default:
+			return nil, fmt.Errorf("unknown direction %q in %q, expected asc or desc", direction, value)
+		}
+		columns = append(columns, column)
+	}
+	return gogeo.WithSortBy(columns...), nil
+}
+
+// zipGeoJSONMembers returns the .geojson files of a ZIP archive, skipping
+// directories and macOS resource forks
+func zipGeoJSONMembers(archive *zip.ReadCloser) []*zip.File {
+	var members []*zip.File
+	for _, member := range archive.File {
+		if member.FileInfo().IsDir() || strings.HasPrefix(member.Name, "__MACOSX/") {
+			continue
+		}
+		if strings.EqualFold(path.Ext(member.Name), ".geojson") {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+// urlOutputPath returns the default output path for a remote input, named after the
+// last segment of its path
+func urlOutputPath(rawURL string) string {
+	name := "output"
+	if u, err := url.Parse(rawURL); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+		name = path.Base(u.Path)
+	}
+	return replaceExtension(name, ".parquet")
+}
+
+// parseBBox parses a "minx,miny,maxx,maxy" bounding box flag
+func parseBBox(value string) (orb.Bound, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return orb.Bound{}, fmt.Errorf("invalid bbox %q, expected minx,miny,maxx,maxy", value)
+	}
+	var numbers [4]float64
+	for i, part := range parts {
+		number, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return orb.Bound{}, fmt.Errorf("invalid bbox %q, expected minx,miny,maxx,maxy", value)
+		}
+		numbers[i] = number
+	}
+	if numbers[0] > numbers[2] || numbers[1] > numbers[3] {
+		return orb.Bound{}, fmt.Errorf("invalid bbox %q, the minimum exceeds the maximum", value)
+	}
+	return orb.Bound{Min: orb.Point{numbers[0], numbers[1]}, Max: orb.Point{numbers[2], numbers[3]}}, nil
+}
+
+// headerFlags parses "Name: value" header flags
+func headerFlags(values []string) (http.Header, error) {
+	header := make(http.Header)
+	for _, value := range values {
+		name, content, ok := strings.Cut(value, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid header '%s', expected 'Name: value'", value)
+		}
+		header.Add(strings.TrimSpace(name), strings.TrimSpace(content))
+	}
+	return header, nil
+}
+
+// collectionName returns the identifier of an OGC API Features collection from its URL
+func collectionName(collectionURL string) string {
+	u, err := url.Parse(collectionURL)
+	if err != nil {
+		return "collection"
+	}
+	name := strings.TrimSuffix(u.Path, "/")
+	name = strings.TrimSuffix(name, "/items")
+	if name = path.Base(name); name == "." || name == "/" {
+		return "collection"
+	}
+	return name
+}
+
+// expandInputs expands the glob patterns among the input arguments
+func expandInputs(args []string) ([]string, error) {
+	var inputs []string
+	for _, arg := range args {
+		if gogeo.IsRemoteURI(arg) || !strings.ContainsAny(arg, "*?[") {
+			inputs = append(inputs, arg)
+			continue
+		}
+
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", arg, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match '%s'", arg)
+		}
+		inputs = append(inputs, matches...)
+	}
+	return inputs, nil
+}
+
+// watchDirectory calls handle for every GeoJSON file created or modified in dir until
+// ctx is cancelled. Events are debounced so that a file is handled once it has not
+// changed for the settle duration, giving writers time to finish.
+func watchDirectory(ctx context.Context, dir string, settle time.Duration, handle func(path string)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(dir); err != nil {
+		return err
+	}
+
+	timers := make(map[string]*time.Timer)
+	ready := make(chan string)
+	defer func() {
+		for _, timer := range timers {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			if !isFeatureFile(event.Name) {
+				continue
+			}
+
+			path := event.Name
+			if timer, exists := timers[path]; exists {
+				timer.Reset(settle)
+				continue
+			}
+			timers[path] = time.AfterFunc(settle, func() {
+				select {
+				case ready <- path:
+				case <-ctx.Done():
+				}
+			})
+		case path := <-ready:
+			delete(timers, path)
+			handle(path)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Printf("Warning: watch error: %v\n", err)
+		}
+	}
+}
+
+// serveHTTP serves handler on addr until ctx is cancelled, then lets the requests in
+// progress finish
+func serveHTTP(ctx context.Context, addr string, handler http.Handler) error {
+	server := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	// gRPC clients speak HTTP/2 without TLS
+	server.Protocols = new(http.Protocols)
+	server.Protocols.SetHTTP1(true)
+	server.Protocols.SetUnencryptedHTTP2(true)
+	done := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		done <- server.Shutdown(shutdown)
+	}()
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-done
 }
@@ -3,7 +3,10 @@ module github.com/beyondcivic/gogeo
 go 1.24.7
 
 require (
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/invopop/jsonschema v0.13.0
+	github.com/parquet-go/parquet-go v0.25.1
+	github.com/paulmach/orb v0.12.0
 	github.com/princjef/gomarkdoc v1.1.0
 	github.com/spf13/cobra v1.10.1
 	github.com/spf13/viper v1.21.0
@@ -19,7 +22,6 @@ require (
 	github.com/cpuguy83/go-md2man/v2 v2.0.6 // indirect
 	github.com/emirpasic/gods v1.12.0 // indirect
 	github.com/fatih/color v1.11.0 // indirect
-	github.com/fsnotify/fsnotify v1.9.0 // indirect
 	github.com/go-git/gcfg v1.5.0 // indirect
 	github.com/go-git/go-billy/v5 v5.3.1 // indirect
 	github.com/go-git/go-git/v5 v5.3.0 // indirect
@@ -37,8 +39,6 @@ require (
 	github.com/mgutz/ansi v0.0.0-20200706080929-d51e80ef957d // indirect
 	github.com/mitchellh/go-homedir v1.1.0 // indirect
 	github.com/nxadm/tail v1.4.11 // indirect
-	github.com/parquet-go/parquet-go v0.25.1 // indirect
-	github.com/paulmach/orb v0.12.0 // indirect
 	github.com/pelletier/go-toml/v2 v2.2.4 // indirect
 	github.com/pierrec/lz4/v4 v4.1.21 // indirect
 	github.com/princjef/mageutil v1.0.0 // indirect
@@ -0,0 +1,431 @@
+package gogeo
+
+import (
+	"math"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/clip"
+)
+
+// WithSplitAntimeridian cuts the lines and polygons of the feature geometries that cross
+// the antimeridian in two, as RFC 7946 recommends, so that no part has an edge from one
+// side of it to the other. An edge crosses the antimeridian when its longitudes differ
+// by more than 180 degrees, the short way around. Polygons encircling a pole are kept as
+// they are. The coordinates must be longitudes and latitudes.
+func WithSplitAntimeridian() Option {
+	return func(cfg *config) {
+		cfg.splitAntimeridian = true
+	}
+}
+
+// crossesAntimeridian reports whether an edge of a line or ring of a geometry crosses
+// the antimeridian
+func crossesAntimeridian(geometry orb.Geometry) bool {
+	switch g := geometry.(type) {
+	case orb.LineString:
+		return pathCrossesAntimeridian(g)
+	case orb.Ring:
+		return pathCrossesAntimeridian(g)
+	case orb.MultiLineString:
+		for _, line := range g {
+			if pathCrossesAntimeridian(line) {
+				return true
+			}
+		}
+	case orb.Polygon:
+		for _, ring := range g {
+			if pathCrossesAntimeridian(ring) {
+				return true
+			}
+		}
+	case orb.MultiPolygon:
+		for _, polygon := range g {
+			if crossesAntimeridian(polygon) {
+				return true
+			}
+		}
+	case orb.Collection:
+		for _, member := range g {
+			if crossesAntimeridian(member) {
+				return true
+			}
+		}
+	case GeometryZ:
+		return crossesAntimeridian(g.Geometry)
+	}
+	return false
+}
+
+// pathCrossesAntimeridian reports whether consecutive positions of a path are more than
+// 180 degrees of longitude apart
+func pathCrossesAntimeridian(path []orb.Point) bool {
+	for i := 1; i < len(path); i++ {
+		if math.Abs(path[i][0]-path[i-1][0]) > 180 {
+			return true
+		}
+	}
+	return false
+}
+
+// longitudeRange accumulates the longitudes of geometries, both as they are and moved to
+// [0, 360], so that geometries on either side of the antimeridian can be bounded by a
+// range crossing it
+type longitudeRange struct {
+	set bool
+	// Bounds of the longitudes as they are.
+	west, east float64
+	// Bounds of the longitudes with negative ones moved by 360 degrees.
+	shiftedWest, shiftedEast float64
+}
+
+// add records the longitudes of a geometry with the given bound
+func (r *longitudeRange) add(geometry orb.Geometry, bound orb.Bound) {
+	west, east := bound.Min[0], bound.Max[0]
+	shiftedWest, shiftedEast := shiftedLongitudes(geometry)
+	if shiftedWest > shiftedEast {
+		// The geometry has no positions
+		return
+	}
+
+	if !r.set {
+		r.west, r.east, r.shiftedWest, r.shiftedEast = west, east, shiftedWest, shiftedEast
+		r.set = true
+		return
+	}
+	r.west, r.east = min(r.west, west), max(r.east, east)
+	r.shiftedWest, r.shiftedEast = min(r.shiftedWest, shiftedWest), max(r.shiftedEast, shiftedEast)
+}
+
+// shiftedLongitudes returns the range of the longitudes of a geometry with negative ones
+// moved by 360 degrees, west greater than east if it has no positions. The parts of
+// multi geometries are bounded one by one, so that the parts of a geometry split at the
+// antimeridian are bounded across it.
+func shiftedLongitudes(geometry orb.Geometry) (west, east float64) {
+	west, east = math.Inf(1), math.Inf(-1)
+	union := func(member orb.Geometry) {
+		memberWest, memberEast := shiftedLongitudes(member)
+		west, east = min(west, memberWest), max(east, memberEast)
+	}
+	switch g := geometry.(type) {
+	case orb.MultiPoint:
+		for _, point := range g {
+			union(point)
+		}
+		return west, east
+	case orb.MultiLineString:
+		for _, line := range g {
+			union(line)
+		}
+		return west, east
+	case orb.MultiPolygon:
+		for _, polygon := range g {
+			union(polygon)
+		}
+		return west, east
+	case orb.Collection:
+		for _, member := range g {
+			union(member)
+		}
+		return west, east
+	case GeometryZ:
+		return shiftedLongitudes(g.Geometry)
+	}
+
+	if countPositions(geometry) == 0 {
+		return west, east
+	}
+	if crossesAntimeridian(geometry) {
+		// The part is continuous across the antimeridian once shifted
+		for _, position := range appendPositions(nil, geometry) {
+			x := position[0]
+			if x < 0 {
+				x += 360
+			}
+			west, east = min(west, x), max(east, x)
+		}
+		return west, east
+	}
+	bound := geometry.Bound()
+	switch {
+	case bound.Min[0] >= 0:
+		return bound.Min[0], bound.Max[0]
+	case bound.Max[0] <= 0:
+		return bound.Min[0] + 360, bound.Max[0] + 360
+	}
+	// The part is continuous across the prime meridian, which moves to 0 and 360
+	return 0, 360
+}
+
+// bounds returns the narrowest of the ranges of the longitudes, west being greater than
+// east for a range crossing the antimeridian
+func (r *longitudeRange) bounds() (west, east float64) {
+	if r.shiftedEast-r.shiftedWest >= r.east-r.west {
+		return r.west, r.east
+	}
+	west, east = r.shiftedWest, r.shiftedEast
+	if west > 180 {
+		west -= 360
+	}
+	if east > 180 {
+		east -= 360
+	}
+	return west, east
+}
+
+// splitAntimeridian cuts the lines and polygons of a geometry crossing the antimeridian
+func splitAntimeridian(geometry orb.Geometry) orb.Geometry {
+	if !crossesAntimeridian(geometry) {
+		return geometry
+	}
+
+	switch g := geometry.(type) {
+	case orb.LineString:
+		lines, _ := splitLine(g, nil)
+		return multiLine(lines)
+	case orb.MultiLineString:
+		var lines orb.MultiLineString
+		for _, line := range g {
+			parts, _ := splitLine(line, nil)
+			lines = append(lines, parts...)
+		}
+		return lines
+	case orb.Ring:
+		return splitAntimeridian(orb.Polygon{g})
+	case orb.Polygon:
+		parts, _, _ := splitPolygon(g)
+		return multiPolygon(parts)
+	case orb.MultiPolygon:
+		var polygons orb.MultiPolygon
+		for _, polygon := range g {
+			parts, _, _ := splitPolygon(polygon)
+			polygons = append(polygons, parts...)
+		}
+		return polygons
+	case orb.Collection:
+		members := make(orb.Collection, len(g))
+		for i, member := range g {
+			members[i] = splitAntimeridian(member)
+		}
+		return members
+	case GeometryZ:
+		return splitAntimeridianZ(g)
+	}
+	return geometry
+}
+
+// splitAntimeridianZ cuts a geometry with Z ordinates crossing the antimeridian
+func splitAntimeridianZ(g GeometryZ) orb.Geometry {
+	var polygons []orb.Polygon
+	switch inner := g.Geometry.(type) {
+	case orb.LineString:
+		lines, z := splitLine(inner, g.Z)
+		return GeometryZ{Geometry: multiLine(lines), Z: z}
+	case orb.MultiLineString:
+		var lines orb.MultiLineString
+		var z []float64
+		offset := 0
+		for _, line := range inner {
+			var lineZ []float64
+			if offset+len(line) <= len(g.Z) {
+				lineZ = g.Z[offset : offset+len(line)]
+			}
+			parts, partsZ := splitLine(line, lineZ)
+			lines = append(lines, parts...)
+			z = appendZ(z, partsZ, countPositions(orb.MultiLineString(parts)))
+			offset += len(line)
+		}
+		return GeometryZ{Geometry: lines, Z: z}
+	case orb.Ring:
+		polygons = []orb.Polygon{{inner}}
+	case orb.Polygon:
+		polygons = []orb.Polygon{inner}
+	case orb.MultiPolygon:
+		polygons = inner
+	default:
+		return g
+	}
+
+	// Positions added along the antimeridian are interpolated along the cut edges, with
+	// the longitudes continuous across it
+	var split, unshifted, references orb.MultiPolygon
+	for _, polygon := range polygons {
+		parts, shifts, reference := splitPolygon(polygon)
+		references = append(references, reference)
+		for i, part := range parts {
+			split = append(split, part)
+			unshifted = append(unshifted, shiftPolygon(part, -shifts[i]))
+		}
+	}
+	z := repairedZ(references, unshifted, g.Z)
+	if len(polygons) == 1 {
+		return GeometryZ{Geometry: multiPolygon(split), Z: z}
+	}
+	return GeometryZ{Geometry: split, Z: z}
+}
+
+// splitLine cuts a line at each edge crossing the antimeridian, ending a part and
+// starting the next one at the longitudes of 180 and -180 degrees, and returns the Z
+// ordinates of the parts if z holds those of the line
+func splitLine(line orb.LineString, z []float64) ([]orb.LineString, []float64) {
+	hasZ := len(z) == len(line)
+	var lines []orb.LineString
+	var partsZ []float64
+	part := orb.LineString{}
+	for i, position := range line {
+		if i > 0 {
+			previous := line[i-1]
+			if delta := position[0] - previous[0]; math.Abs(delta) > 180 {
+				// Cross the antimeridian the short way
+				boundary := 180.0
+				if previous[0] < 0 {
+					boundary = -180
+				}
+				ratio := (boundary - previous[0]) / (delta - math.Copysign(360, delta))
+				latitude := previous[1] + ratio*(position[1]-previous[1])
+				part = append(part, orb.Point{boundary, latitude})
+				lines = append(lines, part)
+				part = orb.LineString{{-boundary, latitude}}
+				if hasZ {
+					cut := z[i-1] + ratio*(z[i]-z[i-1])
+					partsZ = append(partsZ, cut, cut)
+				}
+			}
+		}
+		part = append(part, position)
+		if hasZ {
+			partsZ = append(partsZ, z[i])
+		}
+	}
+	lines = append(lines, part)
+	if !hasZ {
+		partsZ = nil
+	}
+	return lines, partsZ
+}
+
+// splitPolygon cuts a polygon crossing the antimeridian into the parts on either side,
+// and returns the longitudes added to each part and the polygon they were cut from. The
+// longitudes are first made continuous across the antimeridian, and the polygon clipped
+// to the ranges west and east of 180 degrees, those east being moved back by 360 degrees.
+func splitPolygon(polygon orb.Polygon) (parts []orb.Polygon, shifts []float64, reference orb.Polygon) {
+	unwrapped := unwrapPolygon(polygon)
+	for _, ring := range unwrapped {
+		// A ring encircling a pole does not close once continuous
+		if len(ring) > 0 && ring[0] != ring[len(ring)-1] {
+			return []orb.Polygon{polygon}, []float64{0}, polygon
+		}
+	}
+
+	for _, side := range [2]orb.Bound{
+		{Min: orb.Point{-180, -math.MaxFloat64}, Max: orb.Point{180, math.MaxFloat64}},
+		{Min: orb.Point{180, -math.MaxFloat64}, Max: orb.Point{540, math.MaxFloat64}},
+	} {
+		// The clipping modifies the polygon in place
+		part := clip.Polygon(side, orb.Clone(unwrapped).(orb.Polygon))
+		if len(part) == 0 || len(part[0]) < 4 {
+			continue
+		}
+		shift := 0.0
+		if side.Min[0] == 180 {
+			shift = -360
+		}
+		parts = append(parts, shiftPolygon(part, shift))
+		shifts = append(shifts, shift)
+	}
+	if len(parts) == 0 {
+		return []orb.Polygon{polygon}, []float64{0}, polygon
+	}
+	return parts, shifts, unwrapped
+}
+
+// unwrapPolygon returns a polygon whose consecutive longitudes differ by at most 180
+// degrees, moved by multiples of 360 so that the first position is within [-180, 180]
+// and the westernmost one is at least -180
+func unwrapPolygon(polygon orb.Polygon) orb.Polygon {
+	if len(polygon) == 0 || len(polygon[0]) == 0 {
+		return polygon
+	}
+	unwrapped := make(orb.Polygon, len(polygon))
+	west := math.Inf(1)
+	for i, ring := range polygon {
+		unwrapped[i] = unwrapPath(ring, polygon[0][0][0])
+		for _, position := range unwrapped[i] {
+			west = min(west, position[0])
+		}
+	}
+	if west < -180 {
+		unwrapped = shiftPolygon(unwrapped, 360)
+	}
+	return unwrapped
+}
+
+// unwrapPath returns the positions of a ring with consecutive longitudes at most 180
+// degrees apart, the first moved by a multiple of 360 degrees to the nearest of reference
+func unwrapPath(ring orb.Ring, reference float64) orb.Ring {
+	unwrapped := make(orb.Ring, len(ring))
+	for i, position := range ring {
+		previous := reference
+		if i > 0 {
+			previous = unwrapped[i-1][0]
+		}
+		position[0] += 360 * math.Round((previous-position[0])/360)
+		unwrapped[i] = position
+	}
+	return unwrapped
+}
+
+// shiftPolygon returns a polygon whose longitudes are moved by shift degrees
+func shiftPolygon(polygon orb.Polygon, shift float64) orb.Polygon {
+	if shift == 0 {
+		return polygon
+	}
+	shifted := orb.Clone(polygon).(orb.Polygon)
+	for _, ring := range shifted {
+		for i := range ring {
+			ring[i][0] += shift
+		}
+	}
+	return shifted
+}
+
+// multiLine returns the parts of a line, as a line if it was not cut
+func multiLine(lines []orb.LineString) orb.Geometry {
+	if len(lines) == 1 {
+		return lines[0]
+	}
+	return orb.MultiLineString(lines)
+}
+
+// multiPolygon returns the parts of a polygon, as a polygon if it was not cut
+func multiPolygon(polygons []orb.Polygon) orb.Geometry {
+	if len(polygons) == 1 {
+		return polygons[0]
+	}
+	return orb.MultiPolygon(polygons)
+}
+
+// unionLongitudes returns the narrowest range of longitudes covering two ranges, either
+// of which may cross the antimeridian with west greater than east
+func unionLongitudes(west1, east1, west2, east2 float64) (west, east float64) {
+	width := func(west, east float64) float64 {
+		if west > east {
+			return east - west + 360
+		}
+		return east - west
+	}
+	// Going east from the start of one range to the farthest end of the other
+	width1 := max(width(west1, east1), math.Mod(west2-west1+360, 360)+width(west2, east2))
+	width2 := max(width(west2, east2), math.Mod(west1-west2+360, 360)+width(west1, east1))
+	west, extent := west1, width1
+	if width2 < width1 {
+		west, extent = west2, width2
+	}
+	if extent >= 360 {
+		return -180, 180
+	}
+	east = west + extent
+	if east > 180 {
+		east -= 360
+	}
+	return west, east
+}
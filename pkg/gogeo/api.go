@@ -0,0 +1,208 @@
+package gogeo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb/geojson"
+)
+
+// DefaultMaxBodySize is the size of the largest request body of a ConvertAPI, after
+// decompression, unless configured otherwise.
+const DefaultMaxBodySize = 64 << 20
+
+// parquetContentType is the media type of Parquet files.
+const parquetContentType = "application/vnd.apache.parquet"
+
+// errFeatureLimit reports a request with more features than a ConvertAPI accepts
+var errFeatureLimit = errors.New("too many features")
+
+// ConvertAPIOptions configures a ConvertAPI.
+type ConvertAPIOptions struct {
+	// Options apply to every conversion, before those of the request.
+	Options []Option
+	// MaxBodySize is the size of the largest request body, after decompression, 0 for
+	// DefaultMaxBodySize. The features of a request are held in memory.
+	MaxBodySize int64
+	// MaxFeatures is the largest number of features of a request, 0 for no limit.
+	MaxFeatures int
+}
+
+// ConvertAPI is an http.Handler converting the GeoJSON body of POST /convert requests
+// to GeoParquet, so that web applications can offer GeoParquet downloads. The body is
+// a FeatureCollection, or newline-delimited GeoJSON with the
+// application/geo+json-seq content type or the format=geojsonl parameter, and may be
+// compressed with Content-Encoding: gzip. The compression, bbox-column and
+// row-group-size parameters override the options of the conversion, and filename
+// names the file downloaded. Requests over the limits are rejected with status 413.
+type ConvertAPI struct {
+	options ConvertAPIOptions
+}
+
+// NewConvertAPI returns a ConvertAPI converting with the given options.
+func NewConvertAPI(options ConvertAPIOptions) *ConvertAPI {
+	if options.MaxBodySize <= 0 {
+		options.MaxBodySize = DefaultMaxBodySize
+	}
+	return &ConvertAPI{options: options}
+}
+
+func (a *ConvertAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// Web applications are usually served from another origin
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "Content-Disposition, X-Features")
+	if req.URL.Path != "/convert" {
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+	switch req.Method {
+	case http.MethodOptions:
+		w.Header().Set("Access-Control-Allow-Methods", "POST")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Encoding")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case http.MethodPost:
+	default:
+		w.Header().Set("Allow", "POST, OPTIONS")
+		writeAPIError(w, http.StatusMethodNotAllowed, "use POST to convert GeoJSON")
+		return
+	}
+
+	opts, filename, err := a.requestOptions(req)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	body := http.MaxBytesReader(w, req.Body, a.options.MaxBodySize)
+	switch encoding := strings.ToLower(req.Header.Get("Content-Encoding")); encoding {
+	case "", "identity":
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid gzip body")
+			return
+		}
+		// Limit the decompressed size too
+		body = http.MaxBytesReader(w, gz, a.options.MaxBodySize)
+	default:
+		writeAPIError(w, http.StatusUnsupportedMediaType, fmt.Sprintf("unsupported content encoding %q, expected gzip", encoding))
+		return
+	}
+
+	cfg := newConfig(opts)
+	if err := cfg.validate(); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	input, err := newFeatureReader(body, cfg)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var reader FeatureReader = input
+	if a.options.MaxFeatures > 0 {
+		reader = &featureLimitReader{reader: input, limit: a.options.MaxFeatures}
+	}
+
+	// Buffer the file, so that a failed conversion gets an error status
+	var output bytes.Buffer
+	report, err := generateBuffered(req.Context(), withContext(req.Context(), reader), &output, cfg)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeAPIError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("the body exceeds the limit of %d bytes", a.options.MaxBodySize))
+		return
+	case errors.Is(err, errFeatureLimit):
+		writeAPIError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("the body exceeds the limit of %d features", a.options.MaxFeatures))
+		return
+	case err != nil:
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", parquetContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(output.Len()))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("X-Features", strconv.Itoa(report.Features))
+	w.Write(output.Bytes())
+}
+
+// requestOptions returns the options of the conversion of a request and the name of
+// the file downloaded
+func (a *ConvertAPI) requestOptions(req *http.Request) ([]Option, string, error) {
+	opts := append([]Option{}, a.options.Options...)
+	format := FormatGeoJSON
+	if mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediaType == "application/geo+json-seq" {
+		format = FormatGeoJSONL
+	}
+	filename := "features.parquet"
+
+	parameters := req.URL.Query()
+	for name := range parameters {
+		value := parameters.Get(name)
+		switch name {
+		case "format":
+			if value != FormatGeoJSON && value != FormatGeoJSONL {
+				return nil, "", fmt.Errorf("unsupported format %q, expected geojson or geojsonl", value)
+			}
+			format = value
+		case "compression":
+			opts = append(opts, WithCompression(value))
+		case "bbox-column":
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid bbox-column %q, expected true or false", value)
+			}
+			if enabled {
+				opts = append(opts, WithBBoxColumn())
+			}
+		case "row-group-size":
+			rows, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || rows <= 0 {
+				return nil, "", fmt.Errorf("invalid row-group-size %q, expected a positive integer", value)
+			}
+			opts = append(opts, WithRowGroupSize(rows))
+		case "filename":
+			if value == "" || strings.ContainsAny(value, `/\`) {
+				return nil, "", fmt.Errorf("invalid filename %q", value)
+			}
+			filename = value
+		default:
+			return nil, "", fmt.Errorf("unknown parameter %q", name)
+		}
+	}
+	return append(opts, WithInputFormat(format)), filename, nil
+}
+
+// featureLimitReader fails once reader returns more than limit features
+type featureLimitReader struct {
+	reader FeatureReader
+	limit  int
+	count  int
+}
+
+func (r *featureLimitReader) Next() (*geojson.Feature, error) {
+	feature, err := r.reader.Next()
+	if err != nil {
+		return nil, err
+	}
+	r.count++
+	if r.count > r.limit {
+		return nil, errFeatureLimit
+	}
+	return feature, nil
+}
+
+// writeAPIError writes an error response with a JSON body
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,479 @@
+package gogeo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/encoding/thrift"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// AppendGeoParquet adds the features of the input opened by open, GeoJSON or another
+// format selected with WithInputFormat, as new row groups of the GeoParquet file of the
+// given size read from r, and writes the result to w. The existing row groups are
+// copied byte for byte, and the bbox and geometry types of the geo metadata are
+// extended to cover the new features.
+//
+// The new rows are written like the existing ones: the geometry columns, encodings,
+// CRS, bbox columns and compression of the file replace the corresponding options, and
+// every property of the input must be a column of the file with a compatible type.
+// Files whose schema differs from the one gogeo writes, e.g. with required columns,
+// cannot be appended to; combine them with MergeGeoParquet instead. Like
+// GenerateFromOpener, the input is streamed twice. The new row groups are buffered in a
+// temporary file.
+func AppendGeoParquet(ctx context.Context, open OpenFunc, r io.ReaderAt, size int64, w io.Writer, opts ...Option) (*Report, error) {
+	pf, err := parquet.OpenFile(r, size, parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+	if err != nil {
+		return nil, AppError{Message: "failed to read GeoParquet file", Value: err}
+	}
+	geoMeta, err := readGeoMetadata(pf)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := newConfig(opts)
+	primary := geoMeta.Columns[geoMeta.PrimaryColumn]
+	if cfg.crsSet && !sameCRS(cfg.crs, primary.CRS) {
+		return nil, AppError{Message: "the CRS of the input differs from the CRS of the file"}
+	}
+	// The geo metadata of the file is kept, so an unknown CRS needs no definition
+	if string(primary.CRS) == "null" {
+		primary.CRS = nil
+		geoMeta.Columns[geoMeta.PrimaryColumn] = primary
+	}
+	fileOpts, err := geometryOptions(geoMeta)
+	if err != nil {
+		return nil, err
+	}
+	cfg.extraGeometryColumns, cfg.primaryColumn = nil, ""
+	cfg.bboxColumn = primary.Covering != nil && primary.Covering.BBox != nil
+	cfg.bboxProperties = true
+	for _, name := range bboxPropertyColumns {
+		if _, ok := pf.Schema().Lookup(name); !ok {
+			cfg.bboxProperties = false
+		}
+	}
+	for _, opt := range fileOpts {
+		opt(cfg)
+	}
+	// The primary geometry column keeps its repetition, so a required one takes no
+	// null geometries
+	if leaf, ok := pf.Schema().Lookup(geoMeta.PrimaryColumn); ok {
+		cfg.requiredGeometry = !leaf.Node.Optional()
+	}
+	if cfg.requiredGeometry && cfg.nullGeometries == "" {
+		cfg.nullGeometries = NullGeometriesFail
+	}
+	// The property columns keep their repetition and types too
+	cfg.requiredColumns = true
+	cfg.stringTypes = nil
+	if cfg.compression, err = fileCompression(pf); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	schema, err := fileProperties(pf, geoMeta, cfg)
+	if err != nil {
+		return nil, err
+	}
+	total := 0
+	if cfg.schema == nil {
+		if total, err = checkAppendedInput(ctx, open, schema, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := os.CreateTemp("", "gogeo-append-*.parquet")
+	if err != nil {
+		return nil, AppError{Message: "failed to create temporary file", Value: err}
+	}
+	defer os.Remove(rows.Name())
+	defer rows.Close()
+
+	report, err := generateOpened(ctx, open, rows, schema, cfg, total)
+	if err != nil {
+		return nil, err
+	}
+	info, err := rows.Stat()
+	if err != nil {
+		return nil, AppError{Message: "failed to read temporary file", Value: err}
+	}
+	appended, err := parquet.OpenFile(rows, info.Size(), parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+	if err != nil {
+		return nil, AppError{Message: "failed to read appended rows", Value: err}
+	}
+	if !sameSchema(pf.Metadata().Schema, appended.Metadata().Schema) {
+		return nil, AppError{Message: "the schema of the file differs from the one gogeo writes for the input, combine them with merge instead"}
+	}
+
+	value, _ := pf.Lookup(GeoParquetMetadataKey)
+	metadata, err := appendGeoMetadata(value, report.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, AppError{Message: "failed to encode geo metadata", Value: err}
+	}
+	report.Metadata = &GeoParquet{}
+	if err := json.Unmarshal(encoded, report.Metadata); err != nil {
+		return nil, AppError{Message: "failed to parse geo metadata", Value: err}
+	}
+
+	if err := appendRowGroups(r, size, pf, rows, info.Size(), appended, w, string(encoded)); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// fileProperties returns the property columns of a GeoParquet file, typed from its
+// Parquet schema
+func fileProperties(pf *parquet.File, geoMeta *GeoParquet, cfg *config) ([]PropertyInfo, error) {
+	reserved := cfg.reservedColumns()
+	skip := coveringColumns(geoMeta)
+	// The appended values of enum columns are dictionary encoded too
+	enums, err := readEnumMetadata(pf)
+	if err != nil {
+		return nil, err
+	}
+	var schema []PropertyInfo
+	for _, field := range pf.Schema().Fields() {
+		name := field.Name()
+		if skip[name] || reserved[name] {
+			continue
+		}
+		info, err := nodePropertyInfo(name, field)
+		if err != nil {
+			return nil, err
+		}
+		if values, ok := enums[name]; ok && info.Type == PropertyTypeString {
+			info.Enum = values
+		}
+		schema = append(schema, info)
+	}
+	return schema, nil
+}
+
+// fileCompression returns the name of the compression codec of a Parquet file, which
+// readers such as parquet-go expect to be the same in all row groups
+func fileCompression(pf *parquet.File) (string, error) {
+	rowGroups := pf.Metadata().RowGroups
+	if len(rowGroups) == 0 {
+		return DefaultCompression, nil
+	}
+	var codec format.CompressionCodec
+	for i, column := range rowGroups[0].Columns {
+		if i > 0 && column.MetaData.Codec != codec {
+			return "", AppError{Message: "the columns of the file use different compression codecs, combine the files with merge instead"}
+		}
+		codec = column.MetaData.Codec
+	}
+	for name, candidate := range compressionCodecs {
+		if candidate.CompressionCodec() == codec {
+			return name, nil
+		}
+	}
+	return "", AppError{Message: fmt.Sprintf("unsupported compression codec %s of the file", codec)}
+}
+
+// checkAppendedInput streams the input opened by open and checks that the properties
+// of its features can be written to the property columns of a file, returning the
+// number of features
+func checkAppendedInput(ctx context.Context, open OpenFunc, columns []PropertyInfo, cfg *config) (int, error) {
+	input, err := open()
+	if err != nil {
+		return 0, AppError{Message: "failed to read GeoJSON file", Value: err}
+	}
+	defer input.Close()
+	reader, err := newFeatureReader(input, cfg)
+	if err != nil {
+		return 0, err
+	}
+	reader = selectFeatures(withContext(ctx, reader), cfg)
+
+	infos := make(map[string]PropertyInfo, len(columns))
+	appenders := make(map[string]propertyAppender, len(columns))
+	for _, column := range columns {
+		infos[column.Name] = column
+		appenders[column.Name], _ = newPropertyAppender(column, 0)
+	}
+	reserved := cfg.reservedColumns()
+	count := 0
+	for {
+		feature, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, AppError{Message: "failed to read GeoJSON file", Value: err}
+		}
+		count++
+
+		for name, value := range feature.Properties {
+			propType := inferPropertyType(value)
+			if reserved[name] || propType == PropertyTypeNull {
+				continue
+			}
+			column, ok := infos[name]
+			columnType := column.Type
+			switch {
+			case !ok:
+				return 0, AppError{Message: fmt.Sprintf("property %q of feature %d is not a column of the file, combine the files with merge instead", name, count)}
+			case columnType == PropertyTypeStruct || columnType == PropertyTypeList, column.Bits != 0 && propType == PropertyTypeInt:
+				if _, err := appenders[name](nil, value, 0); err != nil {
+					return 0, AppError{Message: fmt.Sprintf("property %q of feature %d does not fit the column of the file: %v", name, count, err)}
+				}
+			case columnType == propType, columnType == PropertyTypeString:
+			case columnType == PropertyTypeFloat && (propType == PropertyTypeInt || propType == PropertyTypeUint):
+			case columnType == PropertyTypeUint && propType == PropertyTypeInt:
+				if _, err := convertPropertyValue(value, columnType); err != nil {
+					return 0, AppError{Message: fmt.Sprintf("property %q of feature %d is negative, but the column of the file is %s", name, count, columnType)}
+				}
+			case columnType == PropertyTypeTimestamp || columnType == PropertyTypeDate || columnType == PropertyTypeUUID || columnType == PropertyTypeJSON:
+				if _, err := convertPropertyValue(value, columnType); err != nil {
+					return 0, AppError{Message: fmt.Sprintf("property %q of feature %d is not a %s", name, count, columnType)}
+				}
+			default:
+				return 0, AppError{Message: fmt.Sprintf("property %q of feature %d is %s, but the column of the file is %s", name, count, propType, columnType)}
+			}
+		}
+	}
+	if count == 0 {
+		return 0, AppError{Message: "no features found in GeoJSON file"}
+	}
+	return count, nil
+}
+
+// sameSchema reports whether two Parquet schemas are identical
+func sameSchema(a, b []format.SchemaElement) bool {
+	return slices.EqualFunc(a, b, func(x, y format.SchemaElement) bool {
+		x.FieldID, y.FieldID = 0, 0
+		return reflect.DeepEqual(x, y)
+	})
+}
+
+// appendGeoMetadata extends the bbox and geometry types of the geo metadata of a file
+// with those of appended rows, keeping members gogeo does not know
+func appendGeoMetadata(value string, appended *GeoParquet) (map[string]any, error) {
+	var metadata map[string]any
+	if err := json.Unmarshal([]byte(value), &metadata); err != nil {
+		return nil, AppError{Message: "geo metadata is not a JSON object", Value: err}
+	}
+	columns, _ := metadata["columns"].(map[string]any)
+	for name, added := range appended.Columns {
+		column, ok := columns[name].(map[string]any)
+		if !ok {
+			continue
+		}
+
+		if types, ok := column["geometry_types"].([]any); ok && len(types) > 0 {
+			for _, geometryType := range added.GeometryTypes {
+				if !slices.Contains(types, any(geometryType)) {
+					types = append(types, geometryType)
+				}
+			}
+			slices.SortFunc(types, func(a, b any) int { return strings.Compare(fmt.Sprint(a), fmt.Sprint(b)) })
+			column["geometry_types"] = types
+		}
+
+		if bbox, ok := column["bbox"].([]any); ok {
+			if union := unionBBox(bbox, added.BBox); union != nil {
+				column["bbox"] = union
+			} else {
+				delete(column, "bbox")
+			}
+		}
+	}
+	return metadata, nil
+}
+
+// unionBBox returns the union of a bbox of geo metadata with the bbox of appended rows,
+// or nil if it cannot be computed. If either crosses the antimeridian, with xmin greater
+// than xmax, the union is the narrowest range of longitudes covering both.
+func unionBBox(bbox []any, added []float64) []any {
+	if len(added) == 0 {
+		return bbox
+	}
+	values := make([]float64, len(bbox))
+	for i, value := range bbox {
+		number, ok := value.(float64)
+		if !ok {
+			return nil
+		}
+		values[i] = number
+	}
+	if len(values) != len(added) || len(values)%2 != 0 {
+		return nil
+	}
+	half := len(values) / 2
+
+	union := make([]any, len(values))
+	for i := range values {
+		if i < half {
+			union[i] = min(values[i], added[i])
+		} else {
+			union[i] = max(values[i], added[i])
+		}
+	}
+	if values[0] > values[half] || added[0] > added[half] {
+		union[0], union[half] = unionLongitudes(values[0], values[half], added[0], added[half])
+	}
+	return union
+}
+
+// appendRowGroups copies the data of a Parquet file followed by the row groups of
+// another one with the same schema, and writes a footer describing both with the geo
+// metadata set to geoMetadata
+func appendRowGroups(r io.ReaderAt, size int64, pf *parquet.File, rows io.ReaderAt, rowsSize int64, appended *parquet.File, w io.Writer, geoMetadata string) error {
+	dataSize, err := footerOffset(r, size)
+	if err != nil {
+		return err
+	}
+	rowsDataSize, err := footerOffset(rows, rowsSize)
+	if err != nil {
+		return err
+	}
+
+	// The appended data starts after the magic number of its file
+	shift := dataSize - int64(len(parquetMagic))
+	metadata := *pf.Metadata()
+	metadata.RowGroups = slices.Clone(metadata.RowGroups)
+	var chunks []pageIndexSource
+	for i := range metadata.RowGroups {
+		metadata.RowGroups[i].Columns = slices.Clone(metadata.RowGroups[i].Columns)
+		for j := range metadata.RowGroups[i].Columns {
+			chunks = append(chunks, pageIndexSource{chunk: &metadata.RowGroups[i].Columns[j], r: r})
+		}
+	}
+	indexed := len(chunks) > 0 && chunks[0].chunk.ColumnIndexOffset > 0 && chunks[0].chunk.OffsetIndexOffset > 0
+
+	for _, rowGroup := range appended.Metadata().RowGroups {
+		rowGroup.Columns = slices.Clone(rowGroup.Columns)
+		for i := range rowGroup.Columns {
+			column := &rowGroup.Columns[i]
+			column.FileOffset += shift
+			column.MetaData.DataPageOffset += shift
+			if column.MetaData.DictionaryPageOffset != 0 {
+				column.MetaData.DictionaryPageOffset += shift
+			}
+			if column.MetaData.IndexPageOffset != 0 {
+				column.MetaData.IndexPageOffset += shift
+			}
+			if column.MetaData.BloomFilterOffset != 0 {
+				column.MetaData.BloomFilterOffset += shift
+			}
+			if !indexed {
+				column.OffsetIndexOffset, column.OffsetIndexLength = 0, 0
+				column.ColumnIndexOffset, column.ColumnIndexLength = 0, 0
+			}
+		}
+		if rowGroup.FileOffset != 0 {
+			rowGroup.FileOffset += shift
+		}
+		rowGroup.Ordinal = int16(len(metadata.RowGroups)) //nolint:gosec
+		metadata.RowGroups = append(metadata.RowGroups, rowGroup)
+		metadata.NumRows += rowGroup.NumRows
+	}
+	appendedGroups := metadata.RowGroups[len(pf.Metadata().RowGroups):]
+	for i := range appendedGroups {
+		for j := range appendedGroups[i].Columns {
+			chunks = append(chunks, pageIndexSource{chunk: &appendedGroups[i].Columns[j], r: rows, shift: shift})
+		}
+	}
+
+	metadata.KeyValueMetadata = slices.Clone(metadata.KeyValueMetadata)
+	for i, kv := range metadata.KeyValueMetadata {
+		if kv.Key == GeoParquetMetadataKey {
+			metadata.KeyValueMetadata[i].Value = geoMetadata
+		}
+	}
+	if err := appendEnumMetadata(&metadata, pf, appended); err != nil {
+		return err
+	}
+
+	// Readers load the page indexes as one section, so those of all row groups are
+	// written again after the appended data
+	var indexes []byte
+	if indexed {
+		if indexes, err = relocatePageIndexes(chunks, dataSize+rowsDataSize-int64(len(parquetMagic))); err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.Copy(w, io.NewSectionReader(r, 0, dataSize)); err != nil {
+		return AppError{Message: "failed to copy Parquet data", Value: err}
+	}
+	if _, err := io.Copy(w, io.NewSectionReader(rows, int64(len(parquetMagic)), rowsDataSize-int64(len(parquetMagic)))); err != nil {
+		return AppError{Message: "failed to copy appended rows", Value: err}
+	}
+	if _, err := w.Write(indexes); err != nil {
+		return AppError{Message: "failed to write page indexes", Value: err}
+	}
+	return writeFooter(w, &metadata)
+}
+
+// pageIndexSource is a column chunk whose page indexes are read from r, with page
+// offsets to move by shift
+type pageIndexSource struct {
+	chunk *format.ColumnChunk
+	r     io.ReaderAt
+	shift int64
+}
+
+// relocatePageIndexes reads the column and offset indexes of chunks and returns them
+// encoded as written at offset, all column indexes first, updating the chunks to
+// point to them
+func relocatePageIndexes(chunks []pageIndexSource, offset int64) ([]byte, error) {
+	var columnIndexes, offsetIndexes []byte
+	for _, source := range chunks {
+		chunk := source.chunk
+		if chunk.ColumnIndexOffset > 0 {
+			data := make([]byte, chunk.ColumnIndexLength)
+			if _, err := source.r.ReadAt(data, chunk.ColumnIndexOffset); err != nil {
+				return nil, AppError{Message: "failed to read column index", Value: err}
+			}
+			chunk.ColumnIndexOffset = offset + int64(len(columnIndexes))
+			columnIndexes = append(columnIndexes, data...)
+		}
+	}
+	offset += int64(len(columnIndexes))
+
+	for _, source := range chunks {
+		chunk := source.chunk
+		if chunk.OffsetIndexOffset == 0 {
+			continue
+		}
+		data := make([]byte, chunk.OffsetIndexLength)
+		if _, err := source.r.ReadAt(data, chunk.OffsetIndexOffset); err != nil {
+			return nil, AppError{Message: "failed to read offset index", Value: err}
+		}
+		if source.shift != 0 {
+			var index format.OffsetIndex
+			if err := thrift.Unmarshal(new(thrift.CompactProtocol), data, &index); err != nil {
+				return nil, AppError{Message: "failed to decode offset index", Value: err}
+			}
+			for i := range index.PageLocations {
+				index.PageLocations[i].Offset += source.shift
+			}
+			encoded, err := thrift.Marshal(new(thrift.CompactProtocol), &index)
+			if err != nil {
+				return nil, AppError{Message: "failed to encode offset index", Value: err}
+			}
+			data = encoded
+		}
+		chunk.OffsetIndexOffset = offset + int64(len(offsetIndexes))
+		chunk.OffsetIndexLength = int32(len(data)) //nolint:gosec
+		offsetIndexes = append(offsetIndexes, data...)
+	}
+	return append(columnIndexes, offsetIndexes...), nil
+}
@@ -0,0 +1,293 @@
+package gogeo
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// azureBlockSize is the size of the blocks of a block blob upload. Objects smaller
+// than one block are uploaded with a single request.
+const azureBlockSize = 8 << 20
+
+// azureAPIVersion is the Blob service REST API version requested
+const azureAPIVersion = "2021-08-06"
+
+// AzureStore reads and writes block blobs in Azure Blob Storage, addressed as
+// az://container/blob.
+type AzureStore struct {
+	client   *http.Client
+	account  string
+	endpoint string
+	// key is the decoded account key for Shared Key authorization, if any.
+	key []byte
+	// sas is a shared access signature query string, if any.
+	sas string
+}
+
+// NewAzureStore creates an AzureStore configured from AZURE_STORAGE_CONNECTION_STRING,
+// or from AZURE_STORAGE_ACCOUNT with either AZURE_STORAGE_KEY or AZURE_STORAGE_SAS_TOKEN.
+func NewAzureStore() *AzureStore {
+	store := &AzureStore{
+		client:  NewHTTPClient(),
+		account: os.Getenv("AZURE_STORAGE_ACCOUNT"),
+		sas:     strings.TrimPrefix(os.Getenv("AZURE_STORAGE_SAS_TOKEN"), "?"),
+	}
+	accountKey := os.Getenv("AZURE_STORAGE_KEY")
+
+	// A connection string takes precedence over the individual variables
+	if connection := os.Getenv("AZURE_STORAGE_CONNECTION_STRING"); connection != "" {
+		for _, part := range strings.Split(connection, ";") {
+			name, value, _ := strings.Cut(part, "=")
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "accountname":
+				store.account = value
+			case "accountkey":
+				accountKey = value
+			case "blobendpoint":
+				store.endpoint = strings.TrimSuffix(value, "/")
+			case "sharedaccesssignature":
+				store.sas = strings.TrimPrefix(value, "?")
+			}
+		}
+	}
+
+	if accountKey != "" {
+		store.key, _ = base64.StdEncoding.DecodeString(accountKey)
+	}
+	if store.endpoint == "" && store.account != "" {
+		store.endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", store.account)
+	}
+	return store
+}
+
+// Open streams the blob at an az://container/blob URI.
+func (s *AzureStore) Open(ctx context.Context, uri string) (io.ReadCloser, error) {
+	container, blob, err := parseBucketURI(uri, "az")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	response, err := s.do(ctx, http.MethodGet, container, blob, nil, nil, nil)
+	if err != nil {
+		cancel()
+		return nil, AppError{Message: fmt.Sprintf("failed to read %s", uri), Value: err}
+	}
+	return newIdleTimeoutReader(response.Body, httpIdleTimeout, cancel), nil
+}
+
+// Create returns a writer uploading to the blob at an az://container/blob URI. Blocks are
+// staged as data is written and the blob only appears once Close commits them.
+func (s *AzureStore) Create(ctx context.Context, uri string) (BlobWriter, error) {
+	container, blob, err := parseBucketURI(uri, "az")
+	if err != nil {
+		return nil, err
+	}
+	return &azureWriter{store: s, ctx: ctx, uri: uri, container: container, blob: blob}, nil
+}
+
+// azureWriter uploads a block blob as it is written
+type azureWriter struct {
+	store     *AzureStore
+	ctx       context.Context
+	uri       string
+	container string
+	blob      string
+
+	buffer bytes.Buffer
+	blocks []string
+	err    error
+}
+
+// Write buffers p and stages a block each time azureBlockSize bytes are buffered.
+func (w *azureWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	w.buffer.Write(p)
+	for w.buffer.Len() >= azureBlockSize {
+		if err := w.stageBlock(w.buffer.Next(azureBlockSize)); err != nil {
+			w.err = err
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close stages the remaining data and commits the block list.
+func (w *azureWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+
+	// Small blobs are written with a single request
+	if len(w.blocks) == 0 {
+		header := http.Header{"X-Ms-Blob-Type": {"BlockBlob"}}
+		response, err := w.store.do(w.ctx, http.MethodPut, w.container, w.blob, nil, header, w.buffer.Bytes())
+		if err != nil {
+			return AppError{Message: fmt.Sprintf("failed to write %s", w.uri), Value: err}
+		}
+		return response.Body.Close()
+	}
+
+	if w.buffer.Len() > 0 {
+		if err := w.stageBlock(w.buffer.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"BlockList"`
+		Latest  []string `xml:"Latest"`
+	}{Latest: w.blocks})
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"comp": {"blocklist"}}
+	response, err := w.store.do(w.ctx, http.MethodPut, w.container, w.blob, query, nil, body)
+	if err != nil {
+		return AppError{Message: fmt.Sprintf("failed to commit %s", w.uri), Value: err}
+	}
+	return response.Body.Close()
+}
+
+// Abort discards the upload. Staged blocks that are never committed are removed by
+// the service after a week.
+func (w *azureWriter) Abort() error {
+	if w.err == nil {
+		w.err = AppError{Message: fmt.Sprintf("upload of %s was aborted", w.uri)}
+	}
+	return nil
+}
+
+// stageBlock uploads data as the next uncommitted block
+func (w *azureWriter) stageBlock(data []byte) error {
+	// Block ids must all have the same length
+	id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("block-%08d", len(w.blocks))))
+	query := url.Values{"comp": {"block"}, "blockid": {id}}
+	response, err := w.store.do(w.ctx, http.MethodPut, w.container, w.blob, query, nil, data)
+	if err != nil {
+		return AppError{Message: fmt.Sprintf("failed to upload block %d of %s", len(w.blocks), w.uri), Value: err}
+	}
+	response.Body.Close()
+
+	w.blocks = append(w.blocks, id)
+	return nil
+}
+
+// do sends an authorized request for a blob and fails on non-2xx responses
+func (s *AzureStore) do(ctx context.Context, method, container, blob string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	if s.endpoint == "" {
+		return nil, AppError{Message: "no Azure storage account configured, set AZURE_STORAGE_ACCOUNT or AZURE_STORAGE_CONNECTION_STRING"}
+	}
+	if s.key == nil && s.sas == "" {
+		return nil, AppError{Message: "no Azure credentials found, set AZURE_STORAGE_KEY or AZURE_STORAGE_SAS_TOKEN"}
+	}
+
+	target := s.endpoint + "/" + url.PathEscape(container) + "/" + azureEscapePath(blob)
+	rawQuery := query.Encode()
+	if s.key == nil {
+		rawQuery = strings.TrimPrefix(rawQuery+"&"+s.sas, "&")
+	}
+	if rawQuery != "" {
+		target += "?" + rawQuery
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		request.Body = http.NoBody
+	}
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	request.Header.Set("X-Ms-Version", azureAPIVersion)
+	request.Header.Set("X-Ms-Date", time.Now().UTC().Format(http.TimeFormat))
+	if s.key != nil {
+		signAzureRequest(request, int64(len(body)), s.account, s.key)
+	}
+
+	return doRequest(s.client, request)
+}
+
+// signAzureRequest adds a Shared Key authorization header to a request
+func signAzureRequest(request *http.Request, contentLength int64, account string, key []byte) {
+	length := ""
+	if contentLength > 0 {
+		length = strconv.FormatInt(contentLength, 10)
+	}
+
+	var headerNames []string
+	for name := range request.Header {
+		if strings.HasPrefix(strings.ToLower(name), "x-ms-") {
+			headerNames = append(headerNames, strings.ToLower(name))
+		}
+	}
+	sort.Strings(headerNames)
+	var canonicalHeaders strings.Builder
+	for _, name := range headerNames {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(request.Header.Get(name)) + "\n")
+	}
+
+	// The resource includes the account name even when it is also part of the path,
+	// as with emulators
+	canonicalResource := "/" + account + request.URL.EscapedPath()
+	query := request.URL.Query()
+	queryNames := make([]string, 0, len(query))
+	for name := range query {
+		queryNames = append(queryNames, name)
+	}
+	sort.Strings(queryNames)
+	for _, name := range queryNames {
+		values := query[name]
+		sort.Strings(values)
+		canonicalResource += "\n" + strings.ToLower(name) + ":" + strings.Join(values, ",")
+	}
+
+	stringToSign := strings.Join([]string{
+		request.Method,
+		request.Header.Get("Content-Encoding"),
+		request.Header.Get("Content-Language"),
+		length,
+		request.Header.Get("Content-MD5"),
+		request.Header.Get("Content-Type"),
+		"", // Date, superseded by x-ms-date
+		request.Header.Get("If-Modified-Since"),
+		request.Header.Get("If-Match"),
+		request.Header.Get("If-None-Match"),
+		request.Header.Get("If-Unmodified-Since"),
+		request.Header.Get("Range"),
+		canonicalHeaders.String() + canonicalResource,
+	}, "\n")
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	request.Header.Set("Authorization", "SharedKey "+account+":"+signature)
+}
+
+// azureEscapePath escapes each segment of a blob name
+func azureEscapePath(blob string) string {
+	segments := strings.Split(blob, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
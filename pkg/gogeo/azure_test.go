@@ -0,0 +1,142 @@
+package gogeo
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSignAzureRequest(t *testing.T) {
+	key := []byte("account key")
+	request, err := http.NewRequest(http.MethodPut, "https://account.blob.core.windows.net/container/dir/a%20b.parquet?comp=block&blockid=YmxvY2s%3D", strings.NewReader("content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/octet-stream")
+	request.Header.Set("X-Ms-Blob-Type", "BlockBlob")
+	request.Header.Set("X-Ms-Date", "Fri, 24 May 2013 00:00:00 GMT")
+	request.Header.Set("X-Ms-Version", azureAPIVersion)
+	signAzureRequest(request, 7, "account", key)
+
+	// The Shared Key string to sign: the verb, the standard headers with the content
+	// length and type, the x-ms- headers sorted, and the resource with its query
+	stringToSign := "PUT\n\n\n7\n\napplication/octet-stream\n\n\n\n\n\n\n" +
+		"x-ms-blob-type:BlockBlob\nx-ms-date:Fri, 24 May 2013 00:00:00 GMT\nx-ms-version:2021-08-06\n" +
+		"/account/container/dir/a%20b.parquet\nblockid:YmxvY2s=\ncomp:block"
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+	want := "SharedKey account:" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	if got := request.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %s, want %s", got, want)
+	}
+}
+
+func TestAzureStore(t *testing.T) {
+	server := newStorageServer(t, func(w http.ResponseWriter, request recordedRequest) {
+		if !strings.HasPrefix(request.header.Get("Authorization"), "SharedKey account:") || request.header.Get("X-Ms-Version") != azureAPIVersion {
+			http.Error(w, "unauthorized", http.StatusForbidden)
+			return
+		}
+		if request.method == http.MethodGet {
+			io.WriteString(w, "content")
+		}
+	})
+	store := &AzureStore{client: server.Client(), account: "account", endpoint: server.URL, key: []byte("account key")}
+	ctx := context.Background()
+
+	writer, err := store.Create(ctx, "az://container/dir/a b.parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(writer, "content")
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	reader, err := store.Open(ctx, "az://container/dir/a b.parquet")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(data) != "content" {
+		t.Errorf("read %q, %v, want content", data, err)
+	}
+
+	want := []string{"PUT /container/dir/a%20b.parquet", "GET /container/dir/a%20b.parquet"}
+	if got := server.summary(); !slices.Equal(got, want) {
+		t.Errorf("requests = %q, want %q", got, want)
+	}
+	upload := server.requests[0]
+	if string(upload.body) != "content" || upload.header.Get("X-Ms-Blob-Type") != "BlockBlob" {
+		t.Errorf("uploaded %q with x-ms-blob-type %q, want content as a BlockBlob", upload.body, upload.header.Get("X-Ms-Blob-Type"))
+	}
+}
+
+func TestAzureStoreBlockUpload(t *testing.T) {
+	server := newStorageServer(t, func(w http.ResponseWriter, request recordedRequest) {})
+	store := &AzureStore{client: server.Client(), account: "account", endpoint: server.URL, key: []byte("account key")}
+
+	writer, err := store.Create(context.Background(), "az://container/big.parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write(make([]byte, azureBlockSize+1)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	first := base64.StdEncoding.EncodeToString([]byte("block-00000000"))
+	second := base64.StdEncoding.EncodeToString([]byte("block-00000001"))
+	want := []string{
+		"PUT /container/big.parquet?blockid=" + strings.ReplaceAll(first, "=", "%3D") + "&comp=block",
+		"PUT /container/big.parquet?blockid=" + strings.ReplaceAll(second, "=", "%3D") + "&comp=block",
+		"PUT /container/big.parquet?comp=blocklist",
+	}
+	if got := server.summary(); !slices.Equal(got, want) {
+		t.Fatalf("requests = %q, want %q", got, want)
+	}
+	if size := len(server.requests[0].body); size != azureBlockSize {
+		t.Errorf("first block has %d bytes, want %d", size, azureBlockSize)
+	}
+	blockList := "<BlockList><Latest>" + first + "</Latest><Latest>" + second + "</Latest></BlockList>"
+	if body := string(server.requests[2].body); body != blockList {
+		t.Errorf("block list = %s, want %s", body, blockList)
+	}
+}
+
+func TestAzureStoreSAS(t *testing.T) {
+	server := newStorageServer(t, func(w http.ResponseWriter, request recordedRequest) {})
+	store := &AzureStore{client: server.Client(), account: "account", endpoint: server.URL, sas: "sv=2021-08-06&sig=a%2Bb"}
+
+	writer, err := store.Create(context.Background(), "az://container/blob.parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	want := []string{"PUT /container/blob.parquet?sv=2021-08-06&sig=a%2Bb"}
+	if got := server.summary(); !slices.Equal(got, want) {
+		t.Errorf("requests = %q, want %q", got, want)
+	}
+	if authorization := server.requests[0].header.Get("Authorization"); authorization != "" {
+		t.Errorf("SAS request has Authorization %q", authorization)
+	}
+}
+
+func TestAzureStoreNoCredentials(t *testing.T) {
+	store := &AzureStore{client: http.DefaultClient, account: "account", endpoint: "https://account.blob.core.windows.net"}
+	if _, err := store.Open(context.Background(), "az://container/blob.parquet"); err == nil || !strings.Contains(err.Error(), "no Azure credentials found") {
+		t.Errorf("Open() error = %v, want no Azure credentials found", err)
+	}
+}
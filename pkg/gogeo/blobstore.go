@@ -0,0 +1,263 @@
+package gogeo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Blobstore reads and writes objects addressed by URI, such as local files or
+// objects in a cloud storage bucket.
+type Blobstore interface {
+	// Open streams the object at uri.
+	Open(ctx context.Context, uri string) (io.ReadCloser, error)
+	// Create returns a writer replacing the object at uri.
+	Create(ctx context.Context, uri string) (BlobWriter, error)
+}
+
+// BlobWriter writes an object. The object is complete once Close succeeds;
+// Abort discards what was written instead.
+type BlobWriter interface {
+	io.WriteCloser
+	Abort() error
+}
+
+// blobstoresMu guards blobstores
+var blobstoresMu sync.Mutex
+
+// blobstores maps URI schemes to the registered stores. The built-in stores are
+// created on first use since they are configured from the environment.
+var blobstores = map[string]Blobstore{}
+
+// defaultBlobstores creates the built-in stores by scheme
+var defaultBlobstores = map[string]func() Blobstore{
+	"file":  func() Blobstore { return LocalStore{} },
+	"http":  func() Blobstore { return &HTTPStore{} },
+	"https": func() Blobstore { return &HTTPStore{} },
+	"s3":    func() Blobstore { return NewS3Store() },
+	"gs":    func() Blobstore { return NewGCSStore() },
+	"az":    func() Blobstore { return NewAzureStore() },
+}
+
+// RegisterBlobstore makes store handle the URIs with the given scheme, such as "s3",
+// replacing the built-in store if there is one.
+func RegisterBlobstore(scheme string, store Blobstore) {
+	blobstoresMu.Lock()
+	defer blobstoresMu.Unlock()
+	blobstores[strings.ToLower(scheme)] = store
+}
+
+// BlobstoreFor returns the store handling a URI. Paths without a scheme are local files.
+func BlobstoreFor(uri string) (Blobstore, error) {
+	scheme := uriScheme(uri)
+
+	blobstoresMu.Lock()
+	defer blobstoresMu.Unlock()
+	if store, ok := blobstores[scheme]; ok {
+		return store, nil
+	}
+
+	create, ok := defaultBlobstores[scheme]
+	if !ok {
+		return nil, AppError{Message: fmt.Sprintf("unsupported storage scheme %q in %s", scheme, uri)}
+	}
+	store := create()
+	blobstores[scheme] = store
+	return store, nil
+}
+
+// OpenBlob streams the object at uri from the store handling it.
+func OpenBlob(ctx context.Context, uri string) (io.ReadCloser, error) {
+	store, err := BlobstoreFor(uri)
+	if err != nil {
+		return nil, err
+	}
+	return store.Open(ctx, uri)
+}
+
+// CreateBlob returns a writer replacing the object at uri in the store handling it.
+func CreateBlob(ctx context.Context, uri string) (BlobWriter, error) {
+	store, err := BlobstoreFor(uri)
+	if err != nil {
+		return nil, err
+	}
+	return store.Create(ctx, uri)
+}
+
+// OpenBlobFunc returns an OpenFunc opening the object at uri, for GenerateFromOpener.
+func OpenBlobFunc(ctx context.Context, uri string) OpenFunc {
+	return func() (io.ReadCloser, error) { return OpenBlob(ctx, uri) }
+}
+
+// IsRemoteURI checks if a path designates an object in a remote store rather than a local file
+func IsRemoteURI(path string) bool {
+	scheme := uriScheme(path)
+	return scheme != "file"
+}
+
+// uriScheme returns the lower-case scheme of a URI, or "file" for plain paths
+func uriScheme(uri string) string {
+	scheme, _, ok := strings.Cut(uri, "://")
+	if !ok || scheme == "" || strings.ContainsAny(scheme, `/\`) {
+		return "file"
+	}
+	return strings.ToLower(scheme)
+}
+
+// parseBucketURI splits a scheme://bucket/key URI
+func parseBucketURI(uri, scheme string) (bucket, key string, err error) {
+	prefix := scheme + "://"
+	if !strings.HasPrefix(strings.ToLower(uri), prefix) {
+		return "", "", AppError{Message: fmt.Sprintf("invalid %s URI %q", scheme, uri)}
+	}
+	bucket, key, _ = strings.Cut(uri[len(prefix):], "/")
+	if bucket == "" || key == "" {
+		return "", "", AppError{Message: fmt.Sprintf("invalid URI %q, expected %sbucket/key", uri, prefix)}
+	}
+	return bucket, key, nil
+}
+
+// LocalStore reads and writes local files, given as plain paths or file:// URIs.
+type LocalStore struct{}
+
+// Open opens a local file.
+func (LocalStore) Open(ctx context.Context, uri string) (io.ReadCloser, error) {
+	return os.Open(localPath(uri))
+}
+
+// Create writes a local file through a temporary file in its directory, which Close
+// renames over the file, so that a failed or interrupted write never leaves it
+// truncated. Abort removes the temporary file, leaving the file untouched.
+func (LocalStore) Create(ctx context.Context, uri string) (BlobWriter, error) {
+	return createLocalFile(localPath(uri))
+}
+
+// localWriter is a BlobWriter writing a local file through a temporary file
+type localWriter struct {
+	*os.File
+	path string
+}
+
+// createLocalFile creates the temporary file of a localWriter, with the permissions of
+// the file it replaces, or 0644 for a new file
+func createLocalFile(path string) (*localWriter, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+	w := &localWriter{File: file, path: path}
+	mode := fs.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := file.Chmod(mode); err != nil {
+		w.Abort()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Close flushes the temporary file to disk and renames it over the file, or removes it
+// if that fails.
+func (w *localWriter) Close() error {
+	if err := w.File.Sync(); err != nil {
+		w.Abort()
+		return err
+	}
+	if err := w.File.Close(); err != nil {
+		os.Remove(w.Name())
+		return err
+	}
+	if err := os.Rename(w.Name(), w.path); err != nil {
+		os.Remove(w.Name())
+		return err
+	}
+	return nil
+}
+
+func (w *localWriter) Abort() error {
+	w.File.Close()
+	return os.Remove(w.Name())
+}
+
+// localPath strips the file:// scheme of a URI
+func localPath(uri string) string {
+	if len(uri) >= len("file://") && strings.EqualFold(uri[:len("file://")], "file://") {
+		return uri[len("file://"):]
+	}
+	return uri
+}
+
+// HTTPStore reads objects over HTTP(S). It cannot create objects.
+type HTTPStore struct {
+	// Client sends the requests; nil uses NewHTTPClient.
+	Client *http.Client
+	// Header is sent with every request, e.g. an Authorization token.
+	Header http.Header
+
+	once sync.Once
+}
+
+// Open streams the response body of a GET request for uri.
+func (s *HTTPStore) Open(ctx context.Context, uri string) (io.ReadCloser, error) {
+	s.once.Do(func() {
+		if s.Client == nil {
+			s.Client = NewHTTPClient()
+		}
+	})
+
+	ctx, cancel := context.WithCancel(ctx)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	for name, values := range s.Header {
+		for _, value := range values {
+			request.Header.Add(name, value)
+		}
+	}
+
+	response, err := doRequest(s.Client, request)
+	if err != nil {
+		cancel()
+		return nil, AppError{Message: fmt.Sprintf("failed to fetch %s", uri), Value: err}
+	}
+	return newIdleTimeoutReader(response.Body, httpIdleTimeout, cancel), nil
+}
+
+// Create fails, since objects cannot be written over plain HTTP.
+func (s *HTTPStore) Create(ctx context.Context, uri string) (BlobWriter, error) {
+	return nil, AppError{Message: fmt.Sprintf("cannot write to %s, HTTP(S) URLs are read-only", uri)}
+}
+
+// doRequest sends a request and turns non-2xx responses into errors carrying the
+// start of the response body
+func doRequest(client *http.Client, request *http.Request) (*http.Response, error) {
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		defer response.Body.Close()
+		return nil, responseError(response)
+	}
+	return response, nil
+}
+
+// responseError describes an unexpected response
+func responseError(response *http.Response) error {
+	message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+	message = bytes.TrimSpace(message)
+	if len(message) == 0 {
+		return fmt.Errorf("%s", response.Status)
+	}
+	return fmt.Errorf("%s: %s", response.Status, message)
+}
@@ -0,0 +1,176 @@
+package gogeo
+
+import (
+	"fmt"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/maptile"
+)
+
+// Grids of the cells of WithGeohashColumn, WithS2Column, WithH3Column and
+// WithQuadkeyColumn
+const (
+	cellGeohash = "geohash"
+	cellS2      = "S2"
+	cellH3      = "H3"
+	cellQuadkey = "quadkey"
+)
+
+// maxQuadkeyZoom is the largest zoom level of WithQuadkeyColumn, whose tiles are a few
+// centimeters across
+const maxQuadkeyZoom = 30
+
+// maxGeohashPrecision is the largest number of characters of WithGeohashColumn, about
+// 4 cm at the equator, beyond which float64 longitudes and latitudes have no more bits
+const maxGeohashPrecision = 12
+
+// geohashAlphabet holds the base 32 digits of geohashes
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// cellColumn is a column holding the cell of a discrete global grid containing the
+// centroid of the feature geometries
+type cellColumn struct {
+	name string
+	// Grid of the cells, such as cellGeohash.
+	system string
+	// Precision or resolution of the cells in the grid.
+	level int
+}
+
+// WithGeohashColumn adds a STRING column holding the geohash of the given precision, from
+// 1 to 12 characters, of the centroid of each feature geometry, after any geometry
+// transformation. Nearby features share geohash prefixes, so the column buckets them
+// with plain equality. The coordinates must be longitudes and latitudes.
+func WithGeohashColumn(name string, precision int) Option {
+	return func(cfg *config) {
+		if precision < 1 || precision > maxGeohashPrecision {
+			cfg.fail(AppError{Message: fmt.Sprintf("invalid geohash precision %d, expected 1 to %d characters", precision, maxGeohashPrecision)})
+			return
+		}
+		cfg.addCellColumn(cellColumn{name: name, system: cellGeohash, level: precision})
+	}
+}
+
+// WithQuadkeyColumn adds a STRING column holding the quadkey of the XYZ web map tile of
+// the given zoom level, from 1 to 30, containing the centroid of each feature geometry,
+// after any geometry transformation: one digit from 0 to 3 per zoom level, as Bing
+// Maps numbers its tiles. The quadkeys of the tiles within a tile start with its own,
+// so the column aligns partitions with map tiles. The coordinates must be longitudes
+// and latitudes; those beyond the latitudes of Web Mercator fall in the tiles of its
+// edges.
+func WithQuadkeyColumn(name string, zoom int) Option {
+	return func(cfg *config) {
+		if zoom < 1 || zoom > maxQuadkeyZoom {
+			cfg.fail(AppError{Message: fmt.Sprintf("invalid quadkey zoom %d, expected 1 to %d", zoom, maxQuadkeyZoom)})
+			return
+		}
+		cfg.addCellColumn(cellColumn{name: name, system: cellQuadkey, level: zoom})
+	}
+}
+
+// addCellColumn adds a cell column, unless its name is empty or already taken by another
+// computed column
+func (cfg *config) addCellColumn(column cellColumn) {
+	if column.name == "" {
+		cfg.fail(AppError{Message: fmt.Sprintf("%s column name must not be empty", column.system)})
+		return
+	}
+	for _, measure := range cfg.measures {
+		if measure.name == column.name {
+			cfg.fail(AppError{Message: fmt.Sprintf("duplicate computed column %q", column.name)})
+			return
+		}
+	}
+	for _, cell := range cfg.cells {
+		if cell.name == column.name {
+			cfg.fail(AppError{Message: fmt.Sprintf("duplicate computed column %q", column.name)})
+			return
+		}
+	}
+	cfg.cells = append(cfg.cells, column)
+}
+
+// node returns the node of the values of the column
+func (c cellColumn) node() parquet.Node {
+	switch c.system {
+	case cellS2:
+		return parquet.Int(64)
+	case cellH3:
+		return parquet.Uint(64)
+	}
+	return parquet.String()
+}
+
+// cell returns the value of the column for a point
+func (c cellColumn) cell(point orb.Point) parquet.Value {
+	switch c.system {
+	case cellS2:
+		// S2 cell ids are unsigned, stored as signed integers like BigQuery does
+		return parquet.Int64Value(int64(s2CellID(point, c.level))) //nolint:gosec
+	case cellH3:
+		return parquet.Int64Value(int64(h3CellID(point, c.level))) //nolint:gosec
+	}
+	value := geohash(point, c.level)
+	if c.system == cellQuadkey {
+		value = quadkey(point, c.level)
+	}
+	return parquet.ByteArrayValue([]byte(value))
+}
+
+// geohash returns the geohash of precision characters of a point of longitude and
+// latitude, interleaving the bits of the longitude and latitude, longitude first
+func geohash(point orb.Point, precision int) string {
+	west, east := -180.0, 180.0
+	south, north := -90.0, 90.0
+	hash := make([]byte, precision)
+	even := true
+	for i := range hash {
+		digit := 0
+		for range 5 {
+			digit <<= 1
+			if even {
+				if middle := (west + east) / 2; point[0] >= middle {
+					digit |= 1
+					west = middle
+				} else {
+					east = middle
+				}
+			} else {
+				if middle := (south + north) / 2; point[1] >= middle {
+					digit |= 1
+					south = middle
+				} else {
+					north = middle
+				}
+			}
+			even = !even
+		}
+		hash[i] = geohashAlphabet[digit]
+	}
+	return string(hash)
+}
+
+// quadkey returns the quadkey of the web map tile of a zoom level containing a point of
+// longitude and latitude: a digit per level, whose bits are those of the tile x and y
+func quadkey(point orb.Point, zoom int) string {
+	tile := maptile.At(point, maptile.Zoom(zoom))
+	// The antimeridian at 180 is the west edge of the first tile
+	tiles := uint32(1) << zoom
+	tile.X %= tiles
+	tile.Y = min(tile.Y, tiles-1)
+
+	key := make([]byte, zoom)
+	for i := range key {
+		mask := uint32(1) << (zoom - 1 - i)
+		digit := byte('0')
+		if tile.X&mask != 0 {
+			digit++
+		}
+		if tile.Y&mask != 0 {
+			digit += 2
+		}
+		key[i] = digit
+	}
+	return string(key)
+}
@@ -0,0 +1,142 @@
+package gogeo
+
+import (
+	"math"
+	"slices"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/planar"
+)
+
+// Kinds of points derived from the feature geometry by WithCentroidColumn and
+// WithPointOnSurfaceColumn
+const (
+	pointCentroid  = "centroid"
+	pointOnSurface = "point-on-surface"
+)
+
+// WithCentroidColumn adds a WKB geometry column holding the centroid of each feature
+// geometry, after any geometry transformation: the area-weighted center of polygons,
+// the length-weighted center of lines and the mean of points. The centroid of a concave
+// polygon may be outside of it; use WithPointOnSurfaceColumn for a point within.
+func WithCentroidColumn(name string) Option {
+	return withPointColumn(name, pointCentroid)
+}
+
+// WithPointOnSurfaceColumn adds a WKB geometry column holding a point on each feature
+// geometry, after any geometry transformation. For polygons it is the centroid when
+// that is inside, and otherwise a point of the widest interior span of the polygon at
+// the height of the centroid, so that it always lies within, as labels should; for
+// lines and points it is the vertex closest to the centroid.
+func WithPointOnSurfaceColumn(name string) Option {
+	return withPointColumn(name, pointOnSurface)
+}
+
+// withPointColumn adds a geometry column of points of the given kind. A geometry
+// column of the same name, such as one kept from a GeoParquet input, is recomputed.
+func withPointColumn(name, kind string) Option {
+	return func(cfg *config) {
+		if cfg.pointColumns == nil {
+			cfg.pointColumns = make(map[string]string)
+		}
+		cfg.pointColumns[name] = kind
+		for _, column := range cfg.extraGeometryColumns {
+			if column.Name == name {
+				return
+			}
+		}
+		cfg.extraGeometryColumns = append(cfg.extraGeometryColumns, GeometryColumn{Name: name, Encoding: GeometryEncodingWKB})
+	}
+}
+
+// derivePoint returns the point of the given kind of a geometry, nil for a geometry
+// without positions
+func derivePoint(geometry orb.Geometry, kind string) orb.Geometry {
+	geometry = planarGeometry(geometry)
+	if geometry == nil || countPositions(geometry) == 0 {
+		return nil
+	}
+	centroid, _ := planar.CentroidArea(geometry)
+	if kind == pointCentroid {
+		return centroid
+	}
+
+	switch g := geometry.(type) {
+	case orb.Point:
+		return g
+	case orb.Polygon:
+		return polygonSurfacePoint(g, centroid)
+	case orb.MultiPolygon:
+		// The surface point of the largest polygon
+		largest, largestArea := orb.Polygon(nil), -1.0
+		for _, polygon := range g {
+			if area := planar.Area(polygon); area > largestArea && countPositions(polygon) > 0 {
+				largest, largestArea = polygon, area
+			}
+		}
+		center, _ := planar.CentroidArea(largest)
+		return polygonSurfacePoint(largest, center)
+	}
+	return closestPosition(geometry, centroid)
+}
+
+// planarGeometry returns a geometry without its Z ordinates, a collection as its
+// members of the highest dimension, and rings and bounds as polygons
+func planarGeometry(geometry orb.Geometry) orb.Geometry {
+	switch g := geometry.(type) {
+	case GeometryZ:
+		return planarGeometry(g.Geometry)
+	case orb.Collection:
+		return planarGeometry(flattenCollection(g))
+	case orb.Ring:
+		return orb.Polygon{g}
+	case orb.Bound:
+		return g.ToPolygon()
+	}
+	return geometry
+}
+
+// polygonSurfacePoint returns the centroid of a polygon if it is inside, and otherwise
+// the middle of the widest interior span of the polygon at the height of the centroid
+func polygonSurfacePoint(polygon orb.Polygon, centroid orb.Point) orb.Point {
+	y := centroid[1]
+	var crossings []float64
+	for _, ring := range polygon {
+		for i := 1; i < len(ring); i++ {
+			a, b := ring[i-1], ring[i]
+			// Half-open on y, so that a vertex at the height is crossed once
+			if (a[1] <= y) != (b[1] <= y) {
+				crossings = append(crossings, a[0]+(y-a[1])*(b[0]-a[0])/(b[1]-a[1]))
+			}
+		}
+	}
+	slices.Sort(crossings)
+
+	// Crossings alternate between entering and leaving the polygon
+	best, widest := orb.Point{}, -1.0
+	for i := 0; i+1 < len(crossings); i += 2 {
+		left, right := crossings[i], crossings[i+1]
+		if left < centroid[0] && centroid[0] < right {
+			return centroid
+		}
+		if width := right - left; width > widest {
+			best, widest = orb.Point{(left + right) / 2, y}, width
+		}
+	}
+	if widest <= 0 {
+		// Polygons without area have no interior
+		return closestPosition(polygon, centroid)
+	}
+	return best
+}
+
+// closestPosition returns the position of a geometry closest to a point
+func closestPosition(geometry orb.Geometry, point orb.Point) orb.Point {
+	closest, distance := orb.Point{}, math.Inf(1)
+	for _, position := range appendPositions(nil, geometry) {
+		if d := planar.DistanceSquared(position, point); d < distance {
+			closest, distance = position, d
+		}
+	}
+	return closest
+}
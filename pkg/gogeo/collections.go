@@ -0,0 +1,178 @@
+package gogeo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// Policies for the GeometryCollection geometries of features, set with WithCollections
+const (
+	// CollectionsExplode writes each member of a collection as a row of its own, with
+	// the properties of the feature.
+	CollectionsExplode = "explode"
+	// CollectionsFlatten writes a collection as the combination of its members of the
+	// highest dimension, dropping the others.
+	CollectionsFlatten = "flatten"
+	// CollectionsReject fails the conversion at the first collection.
+	CollectionsReject = "reject"
+)
+
+// WithCollections sets how the GeometryCollection geometries of the features, which many
+// readers cannot read, are written: CollectionsExplode, CollectionsFlatten or
+// CollectionsReject. Members that are collections themselves are handled the same way,
+// and an empty collection is written as a row without a geometry. By default,
+// collections are written as they are.
+func WithCollections(policy string) Option {
+	return func(cfg *config) {
+		switch normalized := strings.ToLower(policy); normalized {
+		case CollectionsExplode, CollectionsFlatten, CollectionsReject:
+			cfg.collections = normalized
+		case "keep":
+			cfg.collections = ""
+		default:
+			cfg.fail(AppError{Message: fmt.Sprintf("unsupported collection policy %q, expected explode, flatten or reject", policy)})
+		}
+	}
+}
+
+// collectionReader applies the collection policy to the features of reader
+type collectionReader struct {
+	reader FeatureReader
+	policy string
+	// count is the number of features read.
+	count int
+	// pending holds the members of an exploded collection not yet returned.
+	pending []*geojson.Feature
+}
+
+func (r *collectionReader) Next() (*geojson.Feature, error) {
+	if len(r.pending) > 0 {
+		feature := r.pending[0]
+		r.pending = r.pending[1:]
+		return feature, nil
+	}
+
+	feature, err := r.reader.Next()
+	if err != nil {
+		return nil, err
+	}
+	r.count++
+	collection, ok := feature.Geometry.(orb.Collection)
+	if !ok {
+		return feature, nil
+	}
+
+	switch r.policy {
+	case CollectionsReject:
+		if feature.ID != nil {
+			return nil, AppError{Message: fmt.Sprintf("feature %d (id %v) is a GeometryCollection, which many readers do not support; explode or flatten collections instead", r.count, feature.ID)}
+		}
+		return nil, AppError{Message: fmt.Sprintf("feature %d is a GeometryCollection, which many readers do not support; explode or flatten collections instead", r.count)}
+	case CollectionsFlatten:
+		// Copy the feature, which buffered inputs read more than once
+		flattened := *feature
+		flattened.Geometry = flattenCollection(collection)
+		return &flattened, nil
+	}
+
+	members := collectionMembers(nil, collection)
+	if len(members) == 0 {
+		exploded := *feature
+		exploded.Geometry = nil
+		return &exploded, nil
+	}
+	for _, member := range members {
+		exploded := *feature
+		exploded.Geometry = member
+		r.pending = append(r.pending, &exploded)
+	}
+	return r.Next()
+}
+
+// collectionMembers appends the members of a collection to members, replacing those
+// that are collections with their own members
+func collectionMembers(members []orb.Geometry, collection orb.Collection) []orb.Geometry {
+	for _, member := range collection {
+		if nested, ok := member.(orb.Collection); ok {
+			members = collectionMembers(members, nested)
+		} else if member != nil {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+// flattenCollection combines the points, lines or polygons of a collection, whichever
+// have the highest dimension, into a single or multi geometry. It returns nil for a
+// collection without members.
+func flattenCollection(collection orb.Collection) orb.Geometry {
+	var parts []orb.Geometry
+	var zs [][]float64
+	dominant := -1
+	for _, member := range collectionMembers(nil, collection) {
+		var z []float64
+		if withZ, ok := member.(GeometryZ); ok {
+			member, z = withZ.Geometry, withZ.Z
+		}
+		dimension := member.Dimensions()
+		if dimension < dominant {
+			continue
+		}
+		if dimension > dominant {
+			dominant = dimension
+			parts, zs = nil, nil
+		}
+		parts, zs = appendParts(parts, zs, member, z)
+	}
+
+	switch len(parts) {
+	case 0:
+		return nil
+	case 1:
+		return withZOrdinates(parts[0], zs[0])
+	}
+	multi, z := combineMembers(parts, zs)
+	return withZOrdinates(multi, z)
+}
+
+// appendParts appends the points, lines or polygons of a geometry to parts, and the
+// matching slices of its Z ordinates z, if any, to zs
+func appendParts(parts []orb.Geometry, zs [][]float64, geometry orb.Geometry, z []float64) ([]orb.Geometry, [][]float64) {
+	var members []orb.Geometry
+	switch g := geometry.(type) {
+	case orb.MultiPoint:
+		for _, point := range g {
+			members = append(members, point)
+		}
+	case orb.MultiLineString:
+		for _, line := range g {
+			members = append(members, line)
+		}
+	case orb.MultiPolygon:
+		for _, polygon := range g {
+			members = append(members, polygon)
+		}
+	case orb.Ring:
+		members = append(members, orb.Polygon{g})
+	case orb.Bound:
+		members = append(members, g.ToPolygon())
+	default:
+		members = append(members, geometry)
+	}
+
+	offset := 0
+	for _, member := range members {
+		n := countPositions(member)
+		var memberZ []float64
+		if z != nil && offset+n <= len(z) {
+			memberZ = z[offset : offset+n]
+		}
+		parts = append(parts, member)
+		zs = append(zs, memberZ)
+		offset += n
+	}
+	return parts, zs
+}
@@ -0,0 +1,192 @@
+package gogeo
+
+import (
+	"fmt"
+
+	"github.com/paulmach/orb/geojson"
+)
+
+// columnSelection selects and renames the properties of features before they are
+// written; properties named after a geometry column are always kept as they are
+type columnSelection struct {
+	// include lists the properties to keep, nil to keep all of them.
+	include map[string]bool
+	exclude map[string]bool
+	// rename maps input property names to column names.
+	rename map[string]string
+}
+
+// selection returns the column selection of cfg, creating it
+func (cfg *config) selection() *columnSelection {
+	if cfg.columns == nil {
+		cfg.columns = &columnSelection{exclude: make(map[string]bool), rename: make(map[string]string)}
+	}
+	return cfg.columns
+}
+
+// WithIncludeColumns keeps only the given properties, by their input names. Properties
+// read as geometry columns are kept regardless.
+func WithIncludeColumns(names ...string) Option {
+	return func(cfg *config) {
+		selection := cfg.selection()
+		if selection.include == nil {
+			selection.include = make(map[string]bool)
+		}
+		for _, name := range names {
+			selection.include[name] = true
+		}
+	}
+}
+
+// WithExcludeColumns drops the given properties, by their input names. Properties read
+// as geometry columns are kept regardless.
+func WithExcludeColumns(names ...string) Option {
+	return func(cfg *config) {
+		for _, name := range names {
+			cfg.selection().exclude[name] = true
+		}
+	}
+}
+
+// WithRenameColumn writes the property from as the column to. Filters given with
+// WithWhere refer to input names, while sort columns and a schema given with WithSchema
+// refer to the renamed columns.
+func WithRenameColumn(from, to string) Option {
+	return func(cfg *config) {
+		if from == "" || to == "" {
+			cfg.fail(AppError{Message: fmt.Sprintf("invalid rename %q to %q, names must not be empty", from, to)})
+			return
+		}
+		cfg.selection().rename[from] = to
+	}
+}
+
+// validate checks that no two properties are renamed to the same column
+func (s *columnSelection) validate() error {
+	targets := make(map[string]string, len(s.rename))
+	for from, to := range s.rename {
+		if other, ok := targets[to]; ok {
+			if other > from {
+				other, from = from, other
+			}
+			return AppError{Message: fmt.Sprintf("properties %q and %q are both renamed to %q", other, from, to)}
+		}
+		targets[to] = from
+	}
+	return nil
+}
+
+// column returns the name of the column of a property, and whether it is kept
+func (s *columnSelection) column(name string, reserved map[string]bool) (string, bool) {
+	if reserved[name] {
+		return name, true
+	}
+	if s.exclude[name] || s.include != nil && !s.include[name] {
+		return "", false
+	}
+	if to, ok := s.rename[name]; ok {
+		return to, true
+	}
+	return name, true
+}
+
+// apply returns the selected and renamed properties; a renamed property replaces a
+// property of the same name
+func (s *columnSelection) apply(properties geojson.Properties, reserved map[string]bool) geojson.Properties {
+	selected := make(geojson.Properties, len(properties))
+	for _, renamedPass := range []bool{false, true} {
+		for name, value := range properties {
+			if _, renamed := s.rename[name]; renamed != renamedPass {
+				continue
+			}
+			if column, ok := s.column(name, reserved); ok {
+				selected[column] = value
+			}
+		}
+	}
+	return selected
+}
+
+// schema returns the columns of the properties of a schema read from an input
+func (s *columnSelection) schema(properties []PropertyInfo, reserved map[string]bool) []PropertyInfo {
+	var selected []PropertyInfo
+	index := make(map[string]int, len(properties))
+	for _, renamedPass := range []bool{false, true} {
+		for _, property := range properties {
+			if _, renamed := s.rename[property.Name]; renamed != renamedPass {
+				continue
+			}
+			column, ok := s.column(property.Name, reserved)
+			if !ok {
+				continue
+			}
+			property.Name = column
+			if i, taken := index[column]; taken {
+				selected[i] = property
+				continue
+			}
+			index[column] = len(selected)
+			selected = append(selected, property)
+		}
+	}
+	return selected
+}
+
+// selectSchema returns the columns of the properties of a schema read from an input,
+// joined, selected and renamed as configured
+func (cfg *config) selectSchema(properties []PropertyInfo) []PropertyInfo {
+	if cfg.join != nil {
+		properties = cfg.join.addSchema(properties, cfg.reservedColumns())
+	}
+	if cfg.columns == nil {
+		return properties
+	}
+	return cfg.columns.schema(properties, cfg.reservedColumns())
+}
+
+// selectionReader selects and renames the properties of the features of reader
+type selectionReader struct {
+	reader    FeatureReader
+	selection *columnSelection
+	reserved  map[string]bool
+}
+
+func (r *selectionReader) Next() (*geojson.Feature, error) {
+	feature, err := r.reader.Next()
+	if err != nil {
+		return nil, err
+	}
+	// Copy the feature, which buffered inputs read more than once
+	selected := *feature
+	selected.Properties = r.selection.apply(feature.Properties, r.reserved)
+	return &selected, nil
+}
+
+// selectFeatures returns a reader over the features of reader, joined with the table
+// configured with WithJoin, matching the filter configured with WithWhere, with the
+// properties selected and renamed, the ids added as properties, the datetimes parsed and the geometries transformed
+// as configured
+func selectFeatures(reader FeatureReader, cfg *config) FeatureReader {
+	if cfg.join != nil {
+		reader = &joinReader{reader: reader, table: cfg.join, reserved: cfg.reservedColumns()}
+	}
+	if cfg.where != nil {
+		reader = &filterReader{reader: reader, filter: cfg.where}
+	}
+	if cfg.columns != nil {
+		reader = &selectionReader{reader: reader, selection: cfg.columns, reserved: cfg.reservedColumns()}
+	}
+	if cfg.idColumn != "" {
+		reader = &idReader{reader: reader, column: cfg.idColumn}
+	}
+	if len(cfg.datetimeFormats) > 0 || len(cfg.datetimeColumns) > 0 {
+		reader = &datetimeReader{reader: reader, layouts: cfg.datetimeFormats, columns: cfg.datetimeColumns}
+	}
+	if cfg.collections != "" {
+		reader = &collectionReader{reader: reader, policy: cfg.collections}
+	}
+	if cfg.transformsGeometry() {
+		reader = &transformReader{reader: reader, cfg: cfg}
+	}
+	return reader
+}
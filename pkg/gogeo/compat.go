@@ -0,0 +1,125 @@
+package gogeo
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Versions of the Parquet format accepted by WithParquetVersion.
+const (
+	// ParquetVersion1 writes PLAIN strings and the logical types that have a converted
+	// type, for readers predating the encodings of Parquet 2.
+	ParquetVersion1 = "1.0"
+	// ParquetVersion2 writes DELTA_LENGTH_BYTE_ARRAY strings, the default.
+	ParquetVersion2 = "2.x"
+)
+
+// Compatibility profiles accepted by WithCompatibility.
+const (
+	// CompatAthena writes files for Amazon Athena and the Hive and Trino readers.
+	CompatAthena = "athena"
+	// CompatSpark2 writes files for Spark 2 and its parquet-mr 1.10 reader.
+	CompatSpark2 = "spark2"
+	// CompatBigQuery writes files for BigQuery loads and external tables.
+	CompatBigQuery = "bigquery"
+)
+
+// compatProfile holds the settings of a compatibility profile
+type compatProfile struct {
+	version string
+	// compression is the codec of the profile, empty to keep the default.
+	compression string
+	// unsignedAsStrings is whether unsigned 64-bit integers are written as strings.
+	unsignedAsStrings bool
+}
+
+// compatProfiles maps the names of the compatibility profiles to their settings
+var compatProfiles = map[string]compatProfile{
+	CompatAthena:   {version: ParquetVersion1, compression: "snappy", unsignedAsStrings: true},
+	CompatSpark2:   {version: ParquetVersion1, compression: "snappy", unsignedAsStrings: true},
+	CompatBigQuery: {version: ParquetVersion1, unsignedAsStrings: true},
+}
+
+// WithParquetVersion sets the version of the Parquet format written, ParquetVersion1
+// or ParquetVersion2. Version 1.0 writes PLAIN rather than DELTA_LENGTH_BYTE_ARRAY
+// strings, rejects the delta and byte stream split encodings of WithColumnEncoding, and
+// writes UUID columns as strings, since their logical type has no converted type that
+// older readers know. Pages are still written as version 2 data pages, which these
+// readers decode, as parquet-go writes version 1 pages of optional columns with an
+// empty repetition level section that no reader decodes. Defaults to ParquetVersion2.
+func WithParquetVersion(version string) Option {
+	return func(cfg *config) {
+		switch strings.ToLower(version) {
+		case "1", "1.0":
+			cfg.parquetVersion = ParquetVersion1
+			cfg.writeAsString(PropertyTypeUUID)
+		case "2", "2.x", "2.0", "2.4", "2.6":
+			cfg.parquetVersion = ParquetVersion2
+			delete(cfg.stringTypes, PropertyTypeUUID)
+		default:
+			cfg.fail(AppError{Message: fmt.Sprintf("unsupported Parquet version %q, expected 1.0 or 2.x", version)})
+		}
+	}
+}
+
+// WithCompatibility writes files that an engine rejecting newer Parquet features reads,
+// with the profile CompatAthena, CompatSpark2 or CompatBigQuery. All of them write
+// ParquetVersion1 files and unsigned 64-bit integer columns as strings, since none of
+// these engines has an unsigned 64-bit type, and the Athena and Spark 2 profiles use
+// Snappy compression. Later WithParquetVersion and WithCompression options override the
+// version and compression of the profile.
+func WithCompatibility(profile string) Option {
+	return func(cfg *config) {
+		settings, ok := compatProfiles[strings.ToLower(profile)]
+		if !ok {
+			cfg.fail(AppError{Message: fmt.Sprintf("unsupported compatibility profile %q, expected athena, spark2 or bigquery", profile)})
+			return
+		}
+		WithParquetVersion(settings.version)(cfg)
+		if settings.compression != "" {
+			cfg.compression = settings.compression
+		}
+		if settings.unsignedAsStrings {
+			cfg.writeAsString(PropertyTypeUint)
+		}
+	}
+}
+
+// writeAsString makes the columns of a type be written as strings
+func (cfg *config) writeAsString(propType PropertyType) {
+	if cfg.stringTypes == nil {
+		cfg.stringTypes = make(map[PropertyType]bool)
+	}
+	cfg.stringTypes[propType] = true
+}
+
+// compatibleSchema returns the property columns with the types that the Parquet
+// version and compatibility profile do not write changed to strings, recursively
+func (cfg *config) compatibleSchema(schema []PropertyInfo) []PropertyInfo {
+	if len(cfg.stringTypes) == 0 {
+		return schema
+	}
+	compatible := slices.Clone(schema)
+	for i, info := range compatible {
+		switch {
+		case cfg.stringTypes[info.Type]:
+			compatible[i].Type = PropertyTypeString
+		case info.Type == PropertyTypeStruct:
+			compatible[i].Fields = cfg.compatibleSchema(info.Fields)
+		case info.Type == PropertyTypeList && cfg.stringTypes[info.Element]:
+			compatible[i].Element = PropertyTypeString
+		}
+	}
+	return compatible
+}
+
+// versionOptions returns the parquet-go options writing the configured Parquet version
+func (cfg *config) versionOptions() []parquet.WriterOption {
+	if cfg.parquetVersion != ParquetVersion1 {
+		return nil
+	}
+	return []parquet.WriterOption{parquet.DefaultEncodingFor(parquet.ByteArray, &parquet.Plain)}
+}
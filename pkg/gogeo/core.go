@@ -1,58 +1,293 @@
 package gogeo
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"io"
 	"os"
 	"sort"
 
-	"github.com/parquet-go/parquet-go"
 	"github.com/paulmach/orb"
-	"github.com/paulmach/orb/encoding/wkb"
 	"github.com/paulmach/orb/geojson"
 )
 
 const (
 	GeoParquetVersion       = "1.1.0"
 	DefaultGeometryColumn   = "geometry"
-	DefaultGeometryEncoding = "WKB"
+	DefaultGeometryEncoding = GeometryEncodingWKB
 	GeoParquetMetadataKey   = "geo"
 	DefaultCRS              = "EPSG:4326"
+	DefaultBBoxColumn       = "bbox"
+	DefaultCompression      = "zstd"
 )
 
-// Generate generates Geo Parquet file from a geojson file with automatic type inference.
-func Generate(geojsonPath string, outputPath string) (*geojson.FeatureCollection, error) {
-	// Read and parse GeoJSON file
-	fc, err := readGeoJSON(geojsonPath)
+// Generate generates Geo Parquet file from a geojson file with automatic type inference,
+// like GenerateFile, and returns the features of the input. Unlike GenerateFile, it
+// reads the input a third time and holds all of its features in memory to return them.
+func Generate(geojsonPath string, outputPath string, opts ...Option) (*geojson.FeatureCollection, error) {
+	if _, err := GenerateFile(geojsonPath, outputPath, opts...); err != nil {
+		return nil, err
+	}
+	return readFeatureFile(geojsonPath, opts)
+}
+
+// GenerateFile generates Geo Parquet file from a geojson file with automatic type
+// inference and reports what it wrote. Newline-delimited GeoJSON is recognized by its
+// extension (see FormatFromPath). The input is streamed twice, once to infer the schema
+// and once to write the rows, so memory use does not grow with the size of the file.
+// The output is written to a temporary file in its directory and renamed into place
+// once complete, so that a failed or interrupted conversion leaves any existing output
+// untouched.
+func GenerateFile(geojsonPath string, outputPath string, opts ...Option) (*Report, error) {
+	return GenerateContext(context.Background(), geojsonPath, outputPath, opts...)
+}
+
+// readFeatureFile reads all features of a local file in the input format of opts
+func readFeatureFile(path string, opts []Option) (*geojson.FeatureCollection, error) {
+	cfg := newConfig(opts)
+	if cfg.inputFormat == "" {
+		cfg.inputFormat = FormatFromPath(path)
+	}
+	file, err := os.Open(path)
 	if err != nil {
 		return nil, AppError{Message: "failed to read GeoJSON file", Value: err}
 	}
+	defer file.Close()
 
-	if len(fc.Features) == 0 {
-		return nil, AppError{Message: "no features found in GeoJSON file"}
+	reader, err := newFeatureReader(file, cfg)
+	if err != nil {
+		return nil, err
 	}
+	fc := geojson.NewFeatureCollection()
+	for {
+		feature, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return fc, nil
+		}
+		if err != nil {
+			return nil, AppError{Message: "failed to read GeoJSON file", Value: err}
+		}
+		fc.Append(feature)
+	}
+}
 
-	// Write GeoParquet file
-	if err := writeGeoParquet(outputPath, fc); err != nil {
+// GenerateContext is like GenerateFile but stops the conversion when ctx is cancelled.
+func GenerateContext(ctx context.Context, geojsonPath string, outputPath string, opts ...Option) (*Report, error) {
+	cfg := newConfig(opts)
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.inputFormat == "" {
+		cfg.inputFormat = FormatFromPath(geojsonPath)
+	}
+
+	open := func() (io.ReadCloser, error) { return os.Open(geojsonPath) }
+	schema, total, err := inferSchema(ctx, open, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := createLocalFile(outputPath)
+	if err != nil {
 		return nil, AppError{Message: "failed to write GeoParquet file", Value: err}
 	}
 
-	return fc, nil
+	report, err := generateOpened(ctx, open, output, schema, cfg, total)
+	if err != nil {
+		output.Abort()
+		return nil, err
+	}
+	if err := output.Close(); err != nil {
+		return nil, AppError{Message: "failed to write GeoParquet file", Value: err}
+	}
+	return report, nil
+}
+
+// OpenFunc opens a new reader over the same GeoJSON input each time it is called
+type OpenFunc func() (io.ReadCloser, error)
+
+// GenerateFromOpener generates GeoParquet from a GeoJSON input that can be opened
+// repeatedly, such as an archive member or a remote object, and writes it to w.
+// Like GenerateFile, the input is streamed twice instead of being buffered in memory.
+func GenerateFromOpener(open OpenFunc, w io.Writer, opts ...Option) (*Report, error) {
+	return GenerateFromOpenerContext(context.Background(), open, w, opts...)
 }
 
-// readGeoJSON reads and parses a GeoJSON file
-func readGeoJSON(path string) (*geojson.FeatureCollection, error) {
-	data, err := os.ReadFile(path)
+// GenerateFromOpenerContext is like GenerateFromOpener but stops the conversion when ctx is cancelled.
+func GenerateFromOpenerContext(ctx context.Context, open OpenFunc, w io.Writer, opts ...Option) (*Report, error) {
+	cfg := newConfig(opts)
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	schema, total, err := inferSchema(ctx, open, cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	fc, err := geojson.UnmarshalFeatureCollection(data)
+	return generateOpened(ctx, open, w, schema, cfg, total)
+}
+
+// inferSchema returns the configured schema, or streams the input to infer it.
+// total is the number of features read, or 0 if the input was not analyzed.
+func inferSchema(ctx context.Context, open OpenFunc, cfg *config) ([]PropertyInfo, int, error) {
+	if cfg.schema != nil {
+		return cfg.schema, 0, nil
+	}
+
+	analysis, err := analyzeGeoJSON(ctx, open, cfg)
+	if err != nil {
+		return nil, 0, AppError{Message: "failed to read GeoJSON file", Value: err}
+	}
+
+	if analysis.Features == 0 {
+		return nil, 0, AppError{Message: "no features found in GeoJSON file"}
+	}
+	return analysis.Properties, analysis.Features, nil
+}
+
+// generateOpened opens the input again and writes its features as GeoParquet to w
+func generateOpened(ctx context.Context, open OpenFunc, w io.Writer, schema []PropertyInfo, cfg *config, total int) (*Report, error) {
+	input, err := open()
+	if err != nil {
+		return nil, AppError{Message: "failed to read GeoJSON file", Value: err}
+	}
+	defer input.Close()
+
+	reader, err := newFeatureReader(input, cfg)
 	if err != nil {
 		return nil, err
 	}
+	return generate(withContext(ctx, reader), w, schema, cfg, total)
+}
 
-	return fc, nil
+// GenerateFrom generates GeoParquet from a GeoJSON stream and writes it to w.
+// Since a stream can only be read once, the features are buffered in memory to infer
+// the schema unless one is supplied with WithSchema.
+func GenerateFrom(r io.Reader, w io.Writer, opts ...Option) (*Report, error) {
+	return GenerateFromContext(context.Background(), r, w, opts...)
+}
+
+// GenerateFromContext is like GenerateFrom but stops the conversion when ctx is cancelled.
+func GenerateFromContext(ctx context.Context, r io.Reader, w io.Writer, opts ...Option) (*Report, error) {
+	cfg := newConfig(opts)
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.maxMemory > 0 && cfg.schema == nil {
+		// The stream is read twice from a copy rather than holding its features
+		open, remove, err := spoolInput(r, cfg.memoryShare())
+		if err != nil {
+			return nil, AppError{Message: "failed to read GeoJSON", Value: err}
+		}
+		defer remove()
+		schema, total, err := inferSchema(ctx, open, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return generateOpened(ctx, open, w, schema, cfg, total)
+	}
+
+	input, err := newFeatureReader(r, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return generateBuffered(ctx, withContext(ctx, input), w, cfg)
+}
+
+// generateBuffered writes the features of a reader that can only be read once as
+// GeoParquet to w, buffering them in memory to infer the schema unless one is configured
+func generateBuffered(ctx context.Context, reader FeatureReader, w io.Writer, cfg *config) (*Report, error) {
+	total := 0
+	schema := cfg.schema
+	if schema == nil {
+		features, err := readAllFeatures(reader)
+		if err != nil {
+			return nil, AppError{Message: "failed to read GeoJSON", Value: err}
+		}
+
+		analysis, err := analyzeFeatures(newSliceReader(features), cfg)
+		if err != nil {
+			return nil, AppError{Message: "failed to read GeoJSON", Value: err}
+		}
+
+		if analysis.Features == 0 {
+			return nil, AppError{Message: "no features found in GeoJSON"}
+		}
+		schema = analysis.Properties
+		total = analysis.Features
+		reader = withContext(ctx, newSliceReader(features))
+	}
+
+	return generate(reader, w, schema, cfg, total)
+}
+
+// generate writes all features of reader as GeoParquet to w.
+// total is the expected number of features, or 0 if unknown.
+func generate(reader FeatureReader, w io.Writer, schema []PropertyInfo, cfg *config, total int) (*Report, error) {
+	report, err := writeGeoParquet(reader, w, schema, cfg, total)
+	if err != nil {
+		return nil, AppError{Message: "failed to write GeoParquet file", Value: err}
+	}
+
+	if report.Features == 0 {
+		return nil, AppError{Message: "no features found in GeoJSON"}
+	}
+
+	return report, nil
+}
+
+// analyzeGeoJSON streams the input opened by open and analyzes its features
+func analyzeGeoJSON(ctx context.Context, open OpenFunc, cfg *config) (*Report, error) {
+	input, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+
+	reader, err := newFeatureReader(input, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return analyzeFeatures(withContext(ctx, reader), cfg)
+}
+
+// analyzeFeatures reads all features and infers the property schema and geo metadata
+func analyzeFeatures(reader FeatureReader, cfg *config) (*Report, error) {
+	reader = selectFeatures(reader, cfg)
+	properties := newPropertyAnalyzer(cfg)
+	metadata := newMetadataBuilder(cfg)
+	count := 0
+
+	for {
+		feature, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		geometries, err := featureGeometries(feature, cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		properties.add(feature)
+		metadata.add(geometries)
+		count++
+	}
+	if err := properties.conflicts.error(); err != nil {
+		return nil, err
+	}
+
+	return &Report{
+		Features:   count,
+		Properties: properties.infos(),
+		Metadata:   metadata.build(),
+	}, nil
 }
 
 // PropertyInfo holds information about a property column
@@ -60,167 +295,501 @@ type PropertyInfo struct {
 	Name     string
 	Type     PropertyType
 	Nullable bool
+	// Fields are the fields of a PropertyTypeStruct column, sorted by name.
+	Fields []PropertyInfo `json:",omitempty"`
+	// Element is the type of the elements of a PropertyTypeList column.
+	Element PropertyType `json:",omitempty"`
+	// Bits is the width of the values of a PropertyTypeInt column narrowed to 8, 16 or
+	// 32 bits, 0 for 64.
+	Bits int `json:",omitempty"`
+	// Enum holds the sorted values of a PropertyTypeString column detected as an enum
+	// by WithEnumColumns, which is written with dictionary encoding.
+	Enum []string `json:",omitempty"`
 }
 
-// writeGeoParquet writes features to a GeoParquet file
-func writeGeoParquet(path string, fc *geojson.FeatureCollection) error {
-	file, err := os.Create(path)
+// writeGeoParquet writes features as GeoParquet to w, reporting progress to cfg.progress
+func writeGeoParquet(reader FeatureReader, w io.Writer, schema []PropertyInfo, cfg *config, total int) (*Report, error) {
+	schema, err := cfg.castSchema(schema)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer file.Close()
-
-	// Analyze properties to build schema
-	propertyInfos := analyzeProperties(fc)
-
-	// Create GeoParquet metadata
-	geoMeta := createGeoParquetMetadata(fc, propertyInfos)
-	geoMetaJSON, err := json.Marshal(geoMeta)
+	writer, err := newFeatureWriter(w, schema, cfg)
 	if err != nil {
-		return fmt.Errorf("failed to marshal geo metadata: %w", err)
+		return nil, err
 	}
-
-	// Create writer with options
-	writerOpts := []parquet.WriterOption{
-		parquet.KeyValueMetadata(GeoParquetMetadataKey, string(geoMetaJSON)),
-		parquet.Compression(&parquet.Zstd),
+	reader = selectFeatures(reader, cfg)
+	// The transformations are the last stage of the selection
+	transform, _ := reader.(*transformReader)
+	if cfg.spatialSort != "" || len(cfg.sortBy) > 0 {
+		if cfg.maxMemory > 0 {
+			writer.breaks = new(rowGroupBreaks)
+		}
+		if reader, err = sortFeatures(reader, schema, cfg, writer.breaks); err != nil {
+			return nil, err
+		}
 	}
 
-	// Convert features to records
-	records := make([]GeoParquetRecord, 0, len(fc.Features))
-
-	for _, feature := range fc.Features {
-		record := GeoParquetRecord{}
+	count := 0
+	written := func() {
+		count++
+		if cfg.progress != nil && count%progressInterval == 0 {
+			cfg.progress(count, total)
+		}
+	}
 
-		// Add geometry as WKB
-		if feature.Geometry != nil {
-			wkbBytes, err := wkb.Marshal(feature.Geometry)
+	// Convert features to records and write them
+	if cfg.jobs > 1 {
+		if err := writeParallel(reader, writer, cfg.jobs, written); err != nil {
+			return nil, err
+		}
+	} else {
+		for {
+			feature, err := reader.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
 			if err != nil {
-				return fmt.Errorf("failed to encode geometry as WKB: %w", err)
+				return nil, err
 			}
-			record.Geometry = wkbBytes
-		}
 
-		// Add the name property if it exists (for this simple example)
-		if feature.Properties != nil {
-			if name, exists := feature.Properties["name"]; exists && name != nil {
-				if nameStr, ok := name.(string); ok {
-					record.Name = &nameStr
-				}
+			if err := writer.WriteFeature(feature); err != nil {
+				return nil, err
 			}
+			written()
 		}
+	}
 
-		records = append(records, record)
+	if cfg.progress != nil && count%progressInterval != 0 {
+		cfg.progress(count, total)
 	}
 
-	// Create writer and write records
-	writer := parquet.NewGenericWriter[GeoParquetRecord](file, writerOpts...)
-	defer writer.Close()
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
 
-	if _, err := writer.Write(records); err != nil {
-		return fmt.Errorf("failed to write records: %w", err)
+	report := &Report{
+		Features:   count,
+		Properties: schema,
+		Metadata:   writer.Metadata(),
+		Empty:      writer.empty,
+	}
+	if transform != nil {
+		transform.report(report)
 	}
+	return report, nil
+}
 
-	return nil
+// propertyAnalyzer incrementally infers the types of feature properties
+type propertyAnalyzer struct {
+	propertyTypes map[string]PropertyType
+	reserved      map[string]bool
+	// Whether timestamps and dates, and UUIDs, are inferred.
+	temporal bool
+	uuid     bool
+	// Whether objects and arrays are written as strings rather than JSON.
+	plainJSON bool
+	// Whether objects are written as struct columns, and the analysis of their fields
+	// by property name.
+	structs bool
+	fields  map[string]*propertyAnalyzer
+	// Whether arrays of scalars are written as list columns, and the types of their
+	// elements by property name.
+	lists    bool
+	elements map[string]PropertyType
+	// Whether integer columns are narrowed, and the widths of their values by property
+	// name.
+	narrow bool
+	bits   map[string]int
+	// negative holds the properties holding negative integers, which an unsigned column
+	// cannot hold.
+	negative map[string]bool
+	// conflicts collects the type conflicts with WithStrictTypes, nil otherwise, and
+	// prefix is the path of the fields of a struct column.
+	conflicts *typeConflicts
+	prefix    string
+	// Whether the columns without nulls are required, the number of objects analyzed
+	// and the number of non-null values by property name.
+	required bool
+	objects  int
+	present  map[string]int
+	// enums collects the distinct values of the string columns with WithEnumColumns,
+	// nil otherwise. The fields of struct columns are not enums.
+	enums *enumAnalyzer
 }
 
-// analyzeProperties collects and analyzes all properties from features
-func analyzeProperties(fc *geojson.FeatureCollection) []PropertyInfo {
-	propertyTypes := make(map[string]PropertyType)
-	propertyNames := make(map[string]bool)
+func newPropertyAnalyzer(cfg *config) *propertyAnalyzer {
+	var conflicts *typeConflicts
+	if cfg.strictTypes {
+		conflicts = &typeConflicts{}
+	}
+	var enums *enumAnalyzer
+	if cfg.enumValues > 0 {
+		enums = newEnumAnalyzer(cfg.enumValues)
+	}
+	return &propertyAnalyzer{
+		propertyTypes: make(map[string]PropertyType),
+		reserved:      cfg.reservedColumns(),
+		temporal:      cfg.inferTemporal,
+		uuid:          cfg.inferUUID,
+		plainJSON:     cfg.plainJSON,
+		structs:       cfg.structColumns,
+		lists:         cfg.listColumns,
+		narrow:        cfg.narrowIntegers,
+		conflicts:     conflicts,
+		required:      cfg.requiredColumns,
+		enums:         enums,
+	}
+}
+
+// add merges the properties of a feature into the analysis
+func (a *propertyAnalyzer) add(feature *geojson.Feature) {
+	if a.conflicts != nil {
+		a.conflicts.feature++
+		a.conflicts.id = feature.ID
+	}
+	a.addValues(feature.Properties)
+}
 
-	for _, feature := range fc.Features {
-		if feature.Properties == nil {
+// addValues merges properties, or the fields of an object, into the analysis
+func (a *propertyAnalyzer) addValues(properties map[string]any) {
+	a.objects++
+	for key, value := range properties {
+		// Skip properties colliding with geometry or covering columns
+		if a.reserved[key] {
 			continue
 		}
+		if a.required && value != nil {
+			if a.present == nil {
+				a.present = make(map[string]int)
+			}
+			a.present[key]++
+		}
 
-		for key, value := range feature.Properties {
-			propertyNames[key] = true
-			inferredType := inferPropertyType(value)
+		inferredType := a.inferType(value)
+		object, isObject := value.(map[string]any)
+		if isObject && a.structs {
+			inferredType = PropertyTypeStruct
+		}
+		elementType := PropertyTypeUnknown
+		if array, ok := value.([]any); ok && a.lists {
+			if elementType, ok = a.elementType(key, array); ok {
+				inferredType = PropertyTypeList
+			}
+		}
+		existingType, exists := a.propertyTypes[key]
+		if exists && a.conflicts != nil && a.conflicting(key, existingType, inferredType, value) {
+			a.conflicts.add(a.prefix+key, existingType, inferredType, value)
+			continue
+		}
+		if a.enums != nil {
+			a.enums.add(key, value)
+		}
 
-			if existingType, exists := propertyTypes[key]; exists {
-				// Handle type conflicts by promoting to string
-				if existingType != inferredType && inferredType != PropertyTypeNull {
-					if existingType != PropertyTypeNull {
-						propertyTypes[key] = PropertyTypeString
-					} else {
-						propertyTypes[key] = inferredType
-					}
+		if inferredType == PropertyTypeStruct {
+			a.field(key).addValues(object)
+		}
+		if inferredType == PropertyTypeList {
+			if existingElement, exists := a.elements[key]; exists {
+				if a.conflicts != nil && isTypeConflict(existingElement, elementType) {
+					a.conflicts.add(a.prefix+key+".element", existingElement, elementType, value)
+					continue
 				}
-			} else {
-				propertyTypes[key] = inferredType
+				elementType = widenPropertyType(existingElement, elementType)
+			}
+			if a.elements == nil {
+				a.elements = make(map[string]PropertyType)
+			}
+			a.elements[key] = elementType
+		}
+
+		if isNegativeInteger(value) {
+			if a.negative == nil {
+				a.negative = make(map[string]bool)
 			}
+			a.negative[key] = true
+		}
+		if a.narrow && value != nil {
+			if a.bits == nil {
+				a.bits = make(map[string]int)
+			}
+			a.bits[key] = max(a.bits[key], integerBits(value))
+		}
+
+		if exists {
+			a.propertyTypes[key] = widenPropertyType(existingType, inferredType)
+		} else {
+			a.propertyTypes[key] = inferredType
+		}
+	}
+}
+
+// conflicting reports whether a value of a property conflicts with the type of its
+// column, for WithStrictTypes
+func (a *propertyAnalyzer) conflicting(key string, existingType, inferredType PropertyType, value any) bool {
+	if isTypeConflict(existingType, inferredType) {
+		return true
+	}
+	// Unsigned 64-bit integers mixed with negative integers are written as strings
+	widened := widenPropertyType(existingType, inferredType)
+	return widened == PropertyTypeUint && (a.negative[key] || isNegativeInteger(value))
+}
+
+// inferType returns the type of a property value, including the types inferred as
+// configured
+func (a *propertyAnalyzer) inferType(value any) PropertyType {
+	inferredType := PropertyTypeUnknown
+	if a.temporal {
+		inferredType = inferTemporalType(value)
+	}
+	if inferredType == PropertyTypeUnknown && a.uuid {
+		inferredType = inferUUIDType(value)
+	}
+	if inferredType == PropertyTypeUnknown {
+		inferredType = inferPropertyType(value)
+	}
+	return inferredType
+}
+
+// elementType returns the type of the elements of an array of a property, widened like
+// the values of a column, and false if an element is an object or an array
+func (a *propertyAnalyzer) elementType(key string, array []any) (PropertyType, bool) {
+	elementType := PropertyTypeNull
+	for _, element := range array {
+		inferredType := a.inferType(element)
+		if isComplex(inferredType) {
+			return PropertyTypeUnknown, false
 		}
+		if a.conflicts != nil && isTypeConflict(elementType, inferredType) {
+			a.conflicts.add(a.prefix+key+".element", elementType, inferredType, element)
+			continue
+		}
+		elementType = widenPropertyType(elementType, inferredType)
 	}
+	return elementType, true
+}
 
-	// Convert to sorted slice for consistent ordering
-	names := make([]string, 0, len(propertyNames))
-	for name := range propertyNames {
+// field returns the analysis of the fields of the objects of a property
+func (a *propertyAnalyzer) field(key string) *propertyAnalyzer {
+	if a.fields == nil {
+		a.fields = make(map[string]*propertyAnalyzer)
+	}
+	analyzer, ok := a.fields[key]
+	if !ok {
+		analyzer = &propertyAnalyzer{
+			propertyTypes: make(map[string]PropertyType),
+			temporal:      a.temporal,
+			uuid:          a.uuid,
+			plainJSON:     a.plainJSON,
+			structs:       a.structs,
+			lists:         a.lists,
+			narrow:        a.narrow,
+			conflicts:     a.conflicts,
+			prefix:        a.prefix + key + ".",
+			required:      a.required,
+		}
+		a.fields[key] = analyzer
+	}
+	return analyzer
+}
+
+// widenPropertyType returns the type of a column holding values of two types, widening
+// integers to unsigned integers or floats, dates to timestamps and objects mixed with
+// arrays of different kinds to JSON, or else promoting to string
+func widenPropertyType(existingType, inferredType PropertyType) PropertyType {
+	switch {
+	case existingType == inferredType || inferredType == PropertyTypeNull:
+		return existingType
+	case existingType == PropertyTypeNull:
+		return inferredType
+	case isComplex(existingType) && isComplex(inferredType):
+		return PropertyTypeJSON
+	}
+	if widened, ok := widenTemporalType(existingType, inferredType); ok {
+		return widened
+	}
+	switch {
+	case existingType == PropertyTypeUint && inferredType == PropertyTypeInt, existingType == PropertyTypeInt && inferredType == PropertyTypeUint:
+		return PropertyTypeUint
+	case isNumeric(existingType) && isNumeric(inferredType):
+		return PropertyTypeFloat
+	default:
+		return PropertyTypeString
+	}
+}
+
+// infos returns the analyzed properties, sorted by name for consistent ordering
+func (a *propertyAnalyzer) infos() []PropertyInfo {
+	names := make([]string, 0, len(a.propertyTypes))
+	for name := range a.propertyTypes {
 		names = append(names, name)
 	}
 	sort.Strings(names)
 
 	infos := make([]PropertyInfo, len(names))
 	for i, name := range names {
-		propType := propertyTypes[name]
-		if propType == PropertyTypeNull {
+		propType := a.propertyTypes[name]
+		var fields []PropertyInfo
+		var element PropertyType
+		bits := 0
+		switch propType {
+		case PropertyTypeNull:
+			propType = PropertyTypeString
+		case propertyTypeEpochMillis:
+			propType = PropertyTypeTimestamp
+		case PropertyTypeStruct:
+			// Parquet groups must have fields
+			if fields = a.fields[name].infos(); len(fields) == 0 {
+				propType = PropertyTypeJSON
+			}
+		case PropertyTypeInt:
+			if a.bits[name] < 64 {
+				bits = a.bits[name]
+			}
+		case PropertyTypeUint:
+			// Keep the integers mixing negative and unsigned 64-bit values exact
+			if a.negative[name] {
+				propType = PropertyTypeString
+			}
+		case PropertyTypeList:
+			switch element = a.elements[name]; element {
+			case PropertyTypeNull:
+				element = PropertyTypeString
+			case propertyTypeEpochMillis:
+				element = PropertyTypeTimestamp
+			}
+		}
+		if propType == PropertyTypeJSON && a.plainJSON {
 			propType = PropertyTypeString
 		}
 		infos[i] = PropertyInfo{
 			Name:     name,
 			Type:     propType,
-			Nullable: true,
+			Nullable: !a.required || a.present[name] < a.objects,
+			Fields:   fields,
+			Element:  element,
+			Bits:     bits,
+			Enum:     a.enums.enum(name, propType),
 		}
 	}
 
 	return infos
 }
 
-// createGeoParquetMetadata creates GeoParquet metadata from a feature collection
-func createGeoParquetMetadata(fc *geojson.FeatureCollection, propertyInfos []PropertyInfo) *GeoParquet {
-	// Collect geometry types and bounds
-	geomTypes := make(map[string]bool)
-	var bounds *orb.Bound
+// metadataBuilder incrementally collects geometry types and bounds for the geo metadata
+type metadataBuilder struct {
+	cfg     *config
+	columns []*columnStats
+}
+
+// columnStats holds the geometry types and bounds of a geometry column
+type columnStats struct {
+	geomTypes map[string]bool
+	bounds    *orb.Bound
+	// longitudes bound the x of geometries that may cross the antimeridian, used for
+	// geographic CRS
+	longitudes longitudeRange
+}
+
+func newMetadataBuilder(cfg *config) *metadataBuilder {
+	columns := make([]*columnStats, len(cfg.geometryColumns()))
+	for i := range columns {
+		columns[i] = &columnStats{geomTypes: make(map[string]bool)}
+	}
+	return &metadataBuilder{cfg: cfg, columns: columns}
+}
+
+// add records the types and bounds of the geometries of a feature, as returned by featureGeometries
+func (b *metadataBuilder) add(geometries []orb.Geometry) {
+	for i, geometry := range geometries {
+		b.columns[i].add(geometry)
+	}
+}
+
+// add records the type and bounds of a geometry
+func (s *columnStats) add(geometry orb.Geometry) {
+	if geometry == nil {
+		return
+	}
 
-	for _, feature := range fc.Features {
-		if feature.Geometry != nil {
-			geomType := feature.Geometry.GeoJSONType()
-			geomTypes[geomType] = true
+	s.geomTypes[geometryTypeName(geometry)] = true
+	// Empty geometries have no bounds
+	if countPositions(geometry) == 0 {
+		return
+	}
 
-			featureBounds := feature.Geometry.Bound()
-			if bounds == nil {
-				b := featureBounds
-				bounds = &b
-			} else {
-				*bounds = bounds.Union(featureBounds)
+	featureBounds := geometry.Bound()
+	if s.bounds == nil {
+		s.bounds = &featureBounds
+	} else {
+		*s.bounds = s.bounds.Union(featureBounds)
+	}
+	s.longitudes.add(geometry, featureBounds)
+}
+
+// build creates the GeoParquet metadata from the collected information
+func (b *metadataBuilder) build() *GeoParquet {
+	columns := make(map[string]GeoParquetColumn)
+	for i, column := range b.cfg.geometryColumns() {
+		geomColumn := b.columns[i].build(column.Encoding, b.cfg.crs)
+
+		// The bbox covering column and ring orientation describe the feature geometry
+		if i == 0 {
+			geomColumn.Covering = b.covering()
+			if b.cfg.counterclockwise {
+				geomColumn.Orientation = "counterclockwise"
 			}
 		}
+		columns[column.Name] = geomColumn
 	}
 
+	// Create GeoParquet metadata
+	metadata := &GeoParquet{
+		Version:       GeoParquetVersion,
+		PrimaryColumn: b.cfg.primaryGeometryColumn(),
+		Columns:       columns,
+	}
+
+	return metadata
+}
+
+// build creates the metadata of a geometry column
+func (s *columnStats) build(encoding string, crs json.RawMessage) GeoParquetColumn {
 	// Convert geometry types to slice
-	var typesList []string
-	for gt := range geomTypes {
+	typesList := make([]string, 0, len(s.geomTypes))
+	for gt := range s.geomTypes {
 		typesList = append(typesList, gt)
 	}
 	sort.Strings(typesList)
 
 	// Create geometry column metadata
 	geomColumn := GeoParquetColumn{
-		Encoding:      DefaultGeometryEncoding,
+		Encoding:      encoding,
 		GeometryTypes: typesList,
-		CRS:           nil,
+		CRS:           crs,
+	}
+	if s.bounds != nil {
+		geomColumn.BBox = []float64{s.bounds.Min.X(), s.bounds.Min.Y(), s.bounds.Max.X(), s.bounds.Max.Y()}
+		// Geometries on both sides of the antimeridian get a bbox crossing it, with
+		// xmin > xmax, rather than one spanning every longitude
+		if geographicCRS(crs) {
+			geomColumn.BBox[0], geomColumn.BBox[2] = s.longitudes.bounds()
+		}
 	}
 
-	// Create columns map
-	columns := make(map[string]GeoParquetColumn)
-	columns[DefaultGeometryColumn] = geomColumn
+	return geomColumn
+}
 
-	// Create GeoParquet metadata
-	metadata := &GeoParquet{
-		Version:       GeoParquetVersion,
-		PrimaryColumn: DefaultGeometryColumn,
-		Columns:       columns,
+// covering returns the covering metadata of the feature geometry column, if any
+func (b *metadataBuilder) covering() *GeoParquetCovering {
+	if !b.cfg.bboxColumn {
+		return nil
+	}
+	return &GeoParquetCovering{
+		BBox: &GeoParquetBBoxCovering{
+			Xmin: []string{DefaultBBoxColumn, "xmin"},
+			Ymin: []string{DefaultBBoxColumn, "ymin"},
+			Xmax: []string{DefaultBBoxColumn, "xmax"},
+			Ymax: []string{DefaultBBoxColumn, "ymax"},
+		},
 	}
-
-	return metadata
 }
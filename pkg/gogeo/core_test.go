@@ -0,0 +1,129 @@
+package gogeo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateReturnsFeatures(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "points.geojson")
+	data := `{"type":"FeatureCollection","features":[` +
+		`{"type":"Feature","geometry":{"type":"Point","coordinates":[1,2]},"properties":{"name":"a"}},` +
+		`{"type":"Feature","geometry":{"type":"Point","coordinates":[3,4]},"properties":{"name":"b"}}]}`
+	if err := os.WriteFile(input, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	fc, err := Generate(input, filepath.Join(dir, "points.parquet"))
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if len(fc.Features) != 2 || fc.Features[1].Properties["name"] != "b" {
+		t.Errorf("Generate() returned %v, want the two input features", fc.Features)
+	}
+
+	report, err := GenerateFile(input, filepath.Join(dir, "points2.parquet"))
+	if err != nil {
+		t.Fatalf("GenerateFile() error = %v", err)
+	}
+	if report.Features != 2 {
+		t.Errorf("GenerateFile() wrote %d features, want 2", report.Features)
+	}
+}
+
+func TestFeatureIDRoundTrip(t *testing.T) {
+	input := `{"type":"FeatureCollection","features":[` +
+		`{"type":"Feature","id":"a","geometry":{"type":"Point","coordinates":[1,2]},"properties":{"name":"first"}},` +
+		`{"type":"Feature","geometry":{"type":"Point","coordinates":[3,4]},"properties":{"name":"second"}}]}`
+
+	var output bytes.Buffer
+	if _, err := GenerateFrom(strings.NewReader(input), &output); err != nil {
+		t.Fatalf("GenerateFrom() error = %v", err)
+	}
+	fc, err := ReadGeoParquetFrom(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatalf("ReadGeoParquetFrom() error = %v", err)
+	}
+	if len(fc.Features) != 2 {
+		t.Fatalf("read %d features, want 2", len(fc.Features))
+	}
+	if id := fc.Features[0].ID; id != "a" {
+		t.Errorf("first feature id = %v, want a", id)
+	}
+	if id := fc.Features[1].ID; id != nil {
+		t.Errorf("second feature id = %v, want none", id)
+	}
+	for _, feature := range fc.Features {
+		if _, ok := feature.Properties[DefaultIDColumn]; ok {
+			t.Errorf("feature %v has a %s property", feature.ID, DefaultIDColumn)
+		}
+	}
+
+	output.Reset()
+	if _, err := GenerateFrom(strings.NewReader(input), &output, WithIDColumn("")); err != nil {
+		t.Fatalf("GenerateFrom() error = %v", err)
+	}
+	fc, err = ReadGeoParquetFrom(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatalf("ReadGeoParquetFrom() error = %v", err)
+	}
+	if id := fc.Features[0].ID; id != nil {
+		t.Errorf("WithIDColumn(\"\") kept the id %v", id)
+	}
+
+	conflicting := `{"type":"FeatureCollection","features":[` +
+		`{"type":"Feature","id":1,"geometry":null,"properties":{"feature_id":2}}]}`
+	if _, err := GenerateFrom(strings.NewReader(conflicting), io.Discard); err == nil || !strings.Contains(err.Error(), "another id column") {
+		t.Errorf("GenerateFrom() error = %v, want an id conflict", err)
+	}
+}
+
+// BenchmarkGenerate converts points with a wide schema of 60 properties of mixed
+// types, given with WithSchema so that only the writing pass is measured.
+func BenchmarkGenerate(b *testing.B) {
+	const features, columns = 2000, 60
+	var input bytes.Buffer
+	input.WriteString(`{"type":"FeatureCollection","features":[`)
+	for i := range features {
+		if i > 0 {
+			input.WriteByte(',')
+		}
+		fmt.Fprintf(&input, `{"type":"Feature","geometry":{"type":"Point","coordinates":[%d.5,%d.25]},"properties":{`, i%180, i%90)
+		for j := range columns {
+			if j > 0 {
+				input.WriteByte(',')
+			}
+			switch j % 4 {
+			case 0:
+				fmt.Fprintf(&input, `"int_%d":%d`, j, i*j)
+			case 1:
+				fmt.Fprintf(&input, `"float_%d":%d.5`, j, i+j)
+			case 2:
+				fmt.Fprintf(&input, `"string_%d":"value %d"`, j, i%100)
+			default:
+				fmt.Fprintf(&input, `"bool_%d":%t`, j, i%2 == 0)
+			}
+		}
+		input.WriteString(`}}`)
+	}
+	input.WriteString(`]}`)
+
+	schema, err := InferSchemaFrom(bytes.NewReader(input.Bytes()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(input.Len()))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		if _, err := GenerateFrom(bytes.NewReader(input.Bytes()), io.Discard, WithSchema(schema.Properties)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
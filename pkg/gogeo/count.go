@@ -0,0 +1,236 @@
+package gogeo
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+	"github.com/paulmach/orb"
+)
+
+// CountFeatures returns the number of rows of Parquet data of the given size read from
+// r, from its footer and without decoding any row.
+func CountFeatures(r io.ReaderAt, size int64) (int64, error) {
+	pf, err := parquet.OpenFile(r, size, parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+	if err != nil {
+		return 0, AppError{Message: "failed to read Parquet file", Value: err}
+	}
+	return pf.NumRows(), nil
+}
+
+// CountIntersecting returns the number of rows of GeoParquet whose bbox covering
+// column intersects bound. Only the four covering columns are read, and row groups
+// whose column statistics show that none of their rows can intersect are skipped.
+// Rows with a null bbox do not intersect. Files without a bbox covering for their
+// primary column are an error.
+func CountIntersecting(ctx context.Context, r io.ReaderAt, size int64, bound orb.Bound) (int64, error) {
+	pf, err := parquet.OpenFile(r, size, parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+	if err != nil {
+		return 0, AppError{Message: "failed to read GeoParquet file", Value: err}
+	}
+	geoMeta, err := readGeoMetadata(pf)
+	if err != nil {
+		return 0, err
+	}
+
+	covering, err := bboxCovering(pf, geoMeta)
+	if err != nil {
+		return 0, err
+	}
+	if covering == nil {
+		return 0, AppError{Message: fmt.Sprintf("column %q has no bbox covering, regenerate the file with --bbox-column", geoMeta.PrimaryColumn)}
+	}
+
+	var count int64
+	for i, rowGroup := range pf.RowGroups() {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		if covering.disjoint(pf.Metadata().RowGroups[i], bound) {
+			continue
+		}
+
+		n, err := countRowGroup(rowGroup, covering.leaves, bound)
+		if err != nil {
+			return 0, AppError{Message: "failed to read bbox covering column", Value: err}
+		}
+		count += n
+	}
+	return count, nil
+}
+
+// bboxCoveringColumns locates the bbox covering columns of a primary geometry column
+type bboxCoveringColumns struct {
+	// leaves are the column indexes of xmin, ymin, xmax and ymax.
+	leaves [4]int
+	// wraps reports that rows cross the antimeridian, with xmin > xmax, which defeats
+	// pruning on x.
+	wraps bool
+}
+
+// bboxCovering returns the bbox covering columns of the primary column of a file, nil
+// if it has none
+func bboxCovering(pf *parquet.File, geoMeta *GeoParquet) (*bboxCoveringColumns, error) {
+	primary := geoMeta.Columns[geoMeta.PrimaryColumn]
+	if primary.Covering == nil || primary.Covering.BBox == nil {
+		return nil, nil
+	}
+	bbox := primary.Covering.BBox
+	covering := &bboxCoveringColumns{
+		wraps: len(primary.BBox) >= 4 && primary.BBox[0] > primary.BBox[len(primary.BBox)/2],
+	}
+	for i, path := range [][]string{bbox.Xmin, bbox.Ymin, bbox.Xmax, bbox.Ymax} {
+		leaf, ok := pf.Schema().Lookup(path...)
+		if !ok {
+			return nil, AppError{Message: fmt.Sprintf("bbox covering column %v is not in the Parquet schema", path)}
+		}
+		covering.leaves[i] = leaf.ColumnIndex
+	}
+	return covering, nil
+}
+
+// disjoint checks from the statistics of the covering columns whether no row of a row
+// group can intersect bound
+func (c *bboxCoveringColumns) disjoint(rowGroup format.RowGroup, bound orb.Bound) bool {
+	minXmin, okXmin := columnStatistic(rowGroup, c.leaves[0], false)
+	minYmin, okYmin := columnStatistic(rowGroup, c.leaves[1], false)
+	maxXmax, okXmax := columnStatistic(rowGroup, c.leaves[2], true)
+	maxYmax, okYmax := columnStatistic(rowGroup, c.leaves[3], true)
+
+	if (okYmin && minYmin > bound.Max.Y()) || (okYmax && maxYmax < bound.Min.Y()) {
+		return true
+	}
+	if c.wraps {
+		return false
+	}
+	return (okXmin && minXmin > bound.Max.X()) || (okXmax && maxXmax < bound.Min.X())
+}
+
+// columnStatistic returns the minimum or maximum of a floating point column chunk
+// recorded in the footer, if any
+func columnStatistic(rowGroup format.RowGroup, leaf int, upper bool) (float64, bool) {
+	if leaf >= len(rowGroup.Columns) {
+		return 0, false
+	}
+	metadata := rowGroup.Columns[leaf].MetaData
+	value := metadata.Statistics.MinValue
+	if upper {
+		value = metadata.Statistics.MaxValue
+	}
+
+	switch {
+	case metadata.Type == format.Double && len(value) == 8:
+		return math.Float64frombits(binary.LittleEndian.Uint64(value)), true
+	case metadata.Type == format.Float && len(value) == 4:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(value))), true
+	}
+	return 0, false
+}
+
+// countRowGroup counts the rows of a row group whose bbox intersects bound, reading
+// the covering columns in lockstep
+func countRowGroup(rowGroup parquet.RowGroup, leaves [4]int, bound orb.Bound) (int64, error) {
+	chunks := rowGroup.ColumnChunks()
+	var readers [4]*columnValueReader
+	for i, leaf := range leaves {
+		readers[i] = &columnValueReader{pages: chunks[leaf].Pages()}
+		defer readers[i].close()
+	}
+
+	var buffers [4][]parquet.Value
+	for i := range buffers {
+		buffers[i] = make([]parquet.Value, readBatchSize)
+	}
+
+	var count int64
+	for {
+		n := readBatchSize
+		for i, reader := range readers {
+			read, err := reader.readFull(buffers[i])
+			if err != nil && !errors.Is(err, io.EOF) {
+				return 0, err
+			}
+			n = min(n, read)
+		}
+		if n == 0 {
+			return count, nil
+		}
+
+		for row := range n {
+			if bboxIntersects(buffers[0][row], buffers[1][row], buffers[2][row], buffers[3][row], bound) {
+				count++
+			}
+		}
+		if n < readBatchSize {
+			return count, nil
+		}
+	}
+}
+
+// bboxIntersects checks whether the bbox of a row intersects bound; a bbox with
+// xmin > xmax crosses the antimeridian
+func bboxIntersects(xmin, ymin, xmax, ymax parquet.Value, bound orb.Bound) bool {
+	if xmin.IsNull() || ymin.IsNull() || xmax.IsNull() || ymax.IsNull() {
+		return false
+	}
+	x0, y0, x1, y1 := floatValue(xmin), floatValue(ymin), floatValue(xmax), floatValue(ymax)
+	if y0 > bound.Max.Y() || y1 < bound.Min.Y() {
+		return false
+	}
+	if x0 > x1 {
+		return x0 <= bound.Max.X() || x1 >= bound.Min.X()
+	}
+	return x0 <= bound.Max.X() && x1 >= bound.Min.X()
+}
+
+// floatValue returns the value of a FLOAT or DOUBLE column
+func floatValue(value parquet.Value) float64 {
+	if value.Kind() == parquet.Float {
+		return float64(value.Float())
+	}
+	return value.Double()
+}
+
+// columnValueReader reads the values of a column chunk across its pages
+type columnValueReader struct {
+	pages  parquet.Pages
+	page   parquet.Page
+	values parquet.ValueReader
+}
+
+// readFull reads values until buffer is full or the column chunk ends, in which case
+// it returns io.EOF with the number of values read
+func (r *columnValueReader) readFull(buffer []parquet.Value) (int, error) {
+	read := 0
+	for read < len(buffer) {
+		if r.values == nil {
+			page, err := r.pages.ReadPage()
+			if err != nil {
+				return read, err
+			}
+			r.page, r.values = page, page.Values()
+		}
+
+		n, err := r.values.ReadValues(buffer[read:])
+		read += n
+		if errors.Is(err, io.EOF) {
+			parquet.Release(r.page)
+			r.page, r.values = nil, nil
+		} else if err != nil {
+			return read, err
+		}
+	}
+	return read, nil
+}
+
+func (r *columnValueReader) close() {
+	if r.page != nil {
+		parquet.Release(r.page)
+	}
+	r.pages.Close()
+}
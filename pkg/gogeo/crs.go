@@ -0,0 +1,176 @@
+package gogeo
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// projjsonWGS84Datum is the WGS 84 datum ensemble shared by the built-in definitions
+const projjsonWGS84Datum = `{
+    "name": "World Geodetic System 1984 ensemble",
+    "members": [
+      {"name": "World Geodetic System 1984 (Transit)", "id": {"authority": "EPSG", "code": 1166}},
+      {"name": "World Geodetic System 1984 (G730)", "id": {"authority": "EPSG", "code": 1152}},
+      {"name": "World Geodetic System 1984 (G873)", "id": {"authority": "EPSG", "code": 1153}},
+      {"name": "World Geodetic System 1984 (G1150)", "id": {"authority": "EPSG", "code": 1154}},
+      {"name": "World Geodetic System 1984 (G1674)", "id": {"authority": "EPSG", "code": 1155}},
+      {"name": "World Geodetic System 1984 (G1762)", "id": {"authority": "EPSG", "code": 1156}},
+      {"name": "World Geodetic System 1984 (G2139)", "id": {"authority": "EPSG", "code": 1309}}
+    ],
+    "ellipsoid": {"name": "WGS 84", "semi_major_axis": 6378137, "inverse_flattening": 298.257223563},
+    "accuracy": "2.0",
+    "id": {"authority": "EPSG", "code": 6326}
+  }`
+
+// projjsonEPSG4326 is the PROJJSON definition of WGS 84 (EPSG:4326)
+const projjsonEPSG4326 = `{
+  "$schema": "https://proj.org/schemas/v0.7/projjson.schema.json",
+  "type": "GeographicCRS",
+  "name": "WGS 84",
+  "datum_ensemble": ` + projjsonWGS84Datum + `,
+  "coordinate_system": {
+    "subtype": "ellipsoidal",
+    "axis": [
+      {"name": "Geodetic latitude", "abbreviation": "Lat", "direction": "north", "unit": "degree"},
+      {"name": "Geodetic longitude", "abbreviation": "Lon", "direction": "east", "unit": "degree"}
+    ]
+  },
+  "scope": "Horizontal component of 3D system.",
+  "area": "World.",
+  "bbox": {"south_latitude": -90, "west_longitude": -180, "north_latitude": 90, "east_longitude": 180},
+  "id": {"authority": "EPSG", "code": 4326}
+}`
+
+// projjsonCRS84 is the PROJJSON definition of WGS 84 with longitude/latitude axis order (OGC:CRS84)
+const projjsonCRS84 = `{
+  "$schema": "https://proj.org/schemas/v0.7/projjson.schema.json",
+  "type": "GeographicCRS",
+  "name": "WGS 84 (CRS84)",
+  "datum_ensemble": ` + projjsonWGS84Datum + `,
+  "coordinate_system": {
+    "subtype": "ellipsoidal",
+    "axis": [
+      {"name": "Geodetic longitude", "abbreviation": "Lon", "direction": "east", "unit": "degree"},
+      {"name": "Geodetic latitude", "abbreviation": "Lat", "direction": "north", "unit": "degree"}
+    ]
+  },
+  "scope": "Not known.",
+  "area": "World.",
+  "bbox": {"south_latitude": -90, "west_longitude": -180, "north_latitude": 90, "east_longitude": 180},
+  "id": {"authority": "OGC", "code": "CRS84"}
+}`
+
+// projjsonEPSG3857 is the PROJJSON definition of WGS 84 / Pseudo-Mercator (EPSG:3857)
+const projjsonEPSG3857 = `{
+  "$schema": "https://proj.org/schemas/v0.7/projjson.schema.json",
+  "type": "ProjectedCRS",
+  "name": "WGS 84 / Pseudo-Mercator",
+  "base_crs": {
+    "name": "WGS 84",
+    "datum_ensemble": ` + projjsonWGS84Datum + `,
+    "coordinate_system": {
+      "subtype": "ellipsoidal",
+      "axis": [
+        {"name": "Geodetic latitude", "abbreviation": "Lat", "direction": "north", "unit": "degree"},
+        {"name": "Geodetic longitude", "abbreviation": "Lon", "direction": "east", "unit": "degree"}
+      ]
+    },
+    "id": {"authority": "EPSG", "code": 4326}
+  },
+  "conversion": {
+    "name": "Popular Visualisation Pseudo-Mercator",
+    "method": {"name": "Popular Visualisation Pseudo Mercator", "id": {"authority": "EPSG", "code": 1024}},
+    "parameters": [
+      {"name": "Latitude of natural origin", "value": 0, "unit": "degree", "id": {"authority": "EPSG", "code": 8801}},
+      {"name": "Longitude of natural origin", "value": 0, "unit": "degree", "id": {"authority": "EPSG", "code": 8802}},
+      {"name": "False easting", "value": 0, "unit": "metre", "id": {"authority": "EPSG", "code": 8806}},
+      {"name": "False northing", "value": 0, "unit": "metre", "id": {"authority": "EPSG", "code": 8807}}
+    ]
+  },
+  "coordinate_system": {
+    "subtype": "Cartesian",
+    "axis": [
+      {"name": "Easting", "abbreviation": "X", "direction": "east", "unit": "metre"},
+      {"name": "Northing", "abbreviation": "Y", "direction": "north", "unit": "metre"}
+    ]
+  },
+  "scope": "Web mapping and visualisation.",
+  "area": "World between 85.06°S and 85.06°N.",
+  "bbox": {"south_latitude": -85.06, "west_longitude": -180, "north_latitude": 85.06, "east_longitude": 180},
+  "id": {"authority": "EPSG", "code": 3857}
+}`
+
+// crsRegistryMu guards crsRegistry
+var crsRegistryMu sync.RWMutex
+
+// crsRegistry maps upper-case CRS codes to their PROJJSON definitions
+var crsRegistry = map[string]json.RawMessage{
+	"EPSG:4326": json.RawMessage(projjsonEPSG4326),
+	"OGC:CRS84": json.RawMessage(projjsonCRS84),
+	"EPSG:3857": json.RawMessage(projjsonEPSG3857),
+}
+
+// DefaultCRSDefinition returns the PROJJSON definition of DefaultCRS
+func DefaultCRSDefinition() json.RawMessage {
+	return json.RawMessage(projjsonEPSG4326)
+}
+
+// RegisterCRS makes a PROJJSON definition available under a code such as "EPSG:2056".
+// Codes are case insensitive; registering an existing code replaces its definition.
+func RegisterCRS(code string, projjson json.RawMessage) error {
+	if err := validateCRS(projjson); err != nil {
+		return err
+	}
+
+	crsRegistryMu.Lock()
+	defer crsRegistryMu.Unlock()
+	crsRegistry[strings.ToUpper(code)] = projjson
+	return nil
+}
+
+// LookupCRS returns the PROJJSON definition registered for a code such as "EPSG:3857"
+func LookupCRS(code string) (json.RawMessage, error) {
+	crsRegistryMu.RLock()
+	defer crsRegistryMu.RUnlock()
+
+	definition, ok := crsRegistry[strings.ToUpper(code)]
+	if !ok {
+		codes := make([]string, 0, len(crsRegistry))
+		for known := range crsRegistry {
+			codes = append(codes, known)
+		}
+		sort.Strings(codes)
+		return nil, AppError{Message: fmt.Sprintf("unknown CRS %q, known codes are %s", code, strings.Join(codes, ", "))}
+	}
+	return definition, nil
+}
+
+// validateCRS checks that a CRS definition is a PROJJSON object
+func validateCRS(definition json.RawMessage) error {
+	var object map[string]any
+	if err := json.Unmarshal(definition, &object); err != nil {
+		return AppError{Message: "CRS definition is not a JSON object", Value: err}
+	}
+	if _, ok := object["type"]; !ok {
+		return AppError{Message: "CRS definition has no \"type\" member, expected PROJJSON"}
+	}
+	return nil
+}
+
+// geographicCRS reports whether a PROJJSON CRS has longitude and latitude coordinates;
+// an omitted CRS is OGC:CRS84
+func geographicCRS(crs json.RawMessage) bool {
+	if len(crs) == 0 {
+		return true
+	}
+	var definition struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(crs, &definition); err != nil {
+		return false
+	}
+	return definition.Type == "GeographicCRS" || definition.Type == "GeodeticCRS"
+}
@@ -0,0 +1,350 @@
+package gogeo
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/wkb"
+	"github.com/paulmach/orb/encoding/wkt"
+	"github.com/paulmach/orb/geojson"
+)
+
+// Geometry representations of exported CSV files
+const (
+	// CSVGeometryWKT writes geometries as WKT strings.
+	CSVGeometryWKT = "wkt"
+	// CSVGeometryWKB writes geometries as hex-encoded WKB.
+	CSVGeometryWKB = "wkb"
+	// CSVGeometryGeoJSON writes geometries as GeoJSON geometry objects.
+	CSVGeometryGeoJSON = "geojson"
+)
+
+// CSVGeometry names the CSV columns holding the geometry of each row: either a
+// longitude and latitude column for points, or a column of WKT geometries.
+type CSVGeometry struct {
+	Lon string
+	Lat string
+	WKT string
+}
+
+// CSVReader reads the rows of a CSV file with a header line as features. The
+// geometry columns build the feature geometry and the other columns become
+// properties, typed from their text as integers, floats, booleans or strings.
+type CSVReader struct {
+	reader *csv.Reader
+	header []string
+	// Indexes of the geometry columns, -1 if unused.
+	lon, lat, wkt int
+}
+
+// NewCSVReader reads the header of a CSV file and checks that the geometry columns exist.
+func NewCSVReader(r io.Reader, geometry CSVGeometry) (*CSVReader, error) {
+	if geometry.WKT == "" && (geometry.Lon == "" || geometry.Lat == "") {
+		return nil, AppError{Message: "CSV input needs a longitude and latitude column or a WKT column"}
+	}
+	if geometry.WKT != "" && (geometry.Lon != "" || geometry.Lat != "") {
+		return nil, AppError{Message: "CSV geometry is either longitude and latitude columns or a WKT column, not both"}
+	}
+
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, AppError{Message: "failed to read CSV header", Value: err}
+	}
+	// Spreadsheet exports often start with a byte order mark
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	header = append([]string(nil), header...)
+
+	indexes := make(map[string]int, len(header))
+	for i, name := range header {
+		if _, exists := indexes[name]; exists {
+			return nil, AppError{Message: fmt.Sprintf("duplicate CSV column %q", name)}
+		}
+		indexes[name] = i
+	}
+
+	column := func(name string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		index, ok := indexes[name]
+		if !ok {
+			return -1, AppError{Message: fmt.Sprintf("CSV column %q not found, columns are %s", name, strings.Join(header, ", "))}
+		}
+		return index, nil
+	}
+
+	csvReader := &CSVReader{reader: reader, header: header}
+	if csvReader.lon, err = column(geometry.Lon); err != nil {
+		return nil, err
+	}
+	if csvReader.lat, err = column(geometry.Lat); err != nil {
+		return nil, err
+	}
+	if csvReader.wkt, err = column(geometry.WKT); err != nil {
+		return nil, err
+	}
+	return csvReader, nil
+}
+
+// Next returns the feature of the next row, or io.EOF after the last one.
+func (r *CSVReader) Next() (*geojson.Feature, error) {
+	record, err := r.reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV: %w", err)
+	}
+	line, _ := r.reader.FieldPos(0)
+
+	feature := geojson.NewFeature(nil)
+	feature.Geometry, err = r.geometry(record)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %w", line, err)
+	}
+
+	for i, value := range record {
+		if i == r.lon || i == r.lat || i == r.wkt {
+			continue
+		}
+		feature.Properties[r.header[i]] = parseTextValue(value)
+	}
+	return feature, nil
+}
+
+// geometry builds the geometry of a row; empty geometry columns give a null geometry
+func (r *CSVReader) geometry(record []string) (orb.Geometry, error) {
+	if r.wkt >= 0 {
+		value := strings.TrimSpace(record[r.wkt])
+		if value == "" {
+			return nil, nil
+		}
+		return decodeGeometry([]byte(value), GeometryEncodingWKT)
+	}
+
+	lonText, latText := strings.TrimSpace(record[r.lon]), strings.TrimSpace(record[r.lat])
+	if lonText == "" && latText == "" {
+		return nil, nil
+	}
+	lon, err := strconv.ParseFloat(lonText, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid longitude %q", lonText)
+	}
+	lat, err := strconv.ParseFloat(latText, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid latitude %q", latText)
+	}
+	return orb.Point{lon, lat}, nil
+}
+
+// parseTextValue types a field of a text format such as CSV: empty fields are null,
+// and numbers and booleans are parsed. Numbers with leading zeros, such as postal codes, stay strings.
+func parseTextValue(value string) any {
+	if value == "" {
+		return nil
+	}
+
+	switch strings.ToLower(value) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+
+	digits := strings.TrimLeft(value, "+-")
+	if len(digits) > 1 && digits[0] == '0' && digits[1] != '.' {
+		return value
+	}
+	if integer, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return integer
+	}
+	if unsigned, err := strconv.ParseUint(value, 10, 64); err == nil {
+		return unsigned
+	}
+	// ParseFloat also accepts words such as "inf" and "nan"
+	if strings.ContainsAny(value, "0123456789") {
+		if float, err := strconv.ParseFloat(value, 64); err == nil {
+			return float
+		}
+	}
+	return value
+}
+
+// MarshalCSV encodes features as a CSV file with a header line, starting with a
+// geometry column in the given representation followed by the properties sorted by
+// name. Geometry-valued properties use the same representation; maps and slices are
+// written as JSON and null values as empty fields.
+func MarshalCSV(fc *geojson.FeatureCollection, geometry string) ([]byte, error) {
+	var names []string
+	for _, feature := range fc.Features {
+		for name := range feature.Properties {
+			names = append(names, name)
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder, err := newCSVEncoder(&buf, names, geometry)
+	if err != nil {
+		return nil, err
+	}
+	for _, feature := range fc.Features {
+		if err := encoder.encode(feature); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ExportCSV encodes the features of GeoParquet of the given size read from r as CSV
+// to w, like MarshalCSV, and returns the number of features written. The features
+// are read a batch at a time rather than held in memory, and the property columns are
+// those of the Parquet schema, including the id column and the columns without any value.
+func ExportCSV(r io.ReaderAt, size int64, w io.Writer, geometry string) (int, error) {
+	reader, err := newGeoParquetReader(r, size)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	// The ids are written as the column holding them
+	reader.decoder.idColumn = ""
+
+	var names []string
+	for _, path := range reader.decoder.columns {
+		name := path[0]
+		if name != reader.decoder.geoMeta.PrimaryColumn && !reader.decoder.skip[name] {
+			names = append(names, name)
+		}
+	}
+	encoder, err := newCSVEncoder(w, names, geometry)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for {
+		feature, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return count, AppError{Message: "failed to read GeoParquet rows", Value: err}
+		}
+		if err := encoder.encode(feature); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, encoder.flush()
+}
+
+// csvEncoder writes features as the records of a CSV file with a header line
+type csvEncoder struct {
+	writer   *csv.Writer
+	names    []string
+	geometry string
+	record   []string
+	count    int
+}
+
+// newCSVEncoder writes the header line of a CSV file of the given geometry
+// representation, whose property columns are the distinct names sorted
+func newCSVEncoder(w io.Writer, names []string, geometry string) (*csvEncoder, error) {
+	geometry = strings.ToLower(geometry)
+	switch geometry {
+	case CSVGeometryWKT, CSVGeometryWKB, CSVGeometryGeoJSON:
+	default:
+		return nil, AppError{Message: fmt.Sprintf("unsupported CSV geometry %q, expected wkt, wkb or geojson", geometry)}
+	}
+
+	// The geometry column keeps its name; properties cannot shadow it
+	names = slices.DeleteFunc(slices.Clone(names), func(name string) bool { return name == DefaultGeometryColumn })
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(append([]string{DefaultGeometryColumn}, names...)); err != nil {
+		return nil, err
+	}
+	return &csvEncoder{writer: writer, names: names, geometry: geometry, record: make([]string, len(names)+1)}, nil
+}
+
+// encode writes the record of a feature
+func (e *csvEncoder) encode(feature *geojson.Feature) error {
+	e.count++
+	value, err := encodeCSVGeometry(feature.Geometry, e.geometry)
+	if err != nil {
+		return fmt.Errorf("feature %d: %w", e.count, err)
+	}
+	e.record[0] = value
+
+	for j, name := range e.names {
+		if e.record[j+1], err = csvField(feature.Properties[name], e.geometry); err != nil {
+			return fmt.Errorf("feature %d, property %s: %w", e.count, name, err)
+		}
+	}
+	return e.writer.Write(e.record)
+}
+
+// flush writes the buffered records
+func (e *csvEncoder) flush() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// csvField renders a property value as a CSV field
+func csvField(value any, geometry string) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case *geojson.Geometry:
+		return encodeCSVGeometry(v.Geometry(), geometry)
+	case orb.Geometry:
+		return encodeCSVGeometry(v, geometry)
+	}
+	return stringifyProperty(value)
+}
+
+// encodeCSVGeometry renders a geometry in a CSV geometry representation, keeping Z ordinates
+func encodeCSVGeometry(geometry orb.Geometry, representation string) (string, error) {
+	if geometry == nil {
+		return "", nil
+	}
+
+	switch representation {
+	case CSVGeometryWKB:
+		var data []byte
+		var err error
+		if hasZ(geometry) {
+			data, err = marshalWKBZ(geometry)
+		} else {
+			data, err = wkb.Marshal(geometry)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to encode geometry as WKB: %w", err)
+		}
+		return strings.ToUpper(hex.EncodeToString(data)), nil
+	case CSVGeometryGeoJSON:
+		data, err := json.Marshal(geojson.NewGeometry(geometry))
+		if err != nil {
+			return "", fmt.Errorf("failed to encode geometry as GeoJSON: %w", err)
+		}
+		return string(data), nil
+	default:
+		if hasZ(geometry) {
+			return marshalWKTZ(geometry)
+		}
+		return wkt.MarshalString(geometry), nil
+	}
+}
@@ -0,0 +1,166 @@
+package gogeo
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+func TestCSVReader(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		geometry CSVGeometry
+		want     []*geojson.Feature
+	}{
+		{
+			"lon and lat",
+			"name,lon,lat\nA,1.5,-2\nB, 3 , 4 \n",
+			CSVGeometry{Lon: "lon", Lat: "lat"},
+			[]*geojson.Feature{
+				csvFeature(orb.Point{1.5, -2}, geojson.Properties{"name": "A"}),
+				csvFeature(orb.Point{3, 4}, geojson.Properties{"name": "B"}),
+			},
+		},
+		{
+			"quoted fields",
+			"\ufeffname,note,wkt\n\"Main St, North\",\"say \"\"hi\"\"\nthere\",\"LINESTRING (0 0, 1 1)\"\n",
+			CSVGeometry{WKT: "wkt"},
+			[]*geojson.Feature{
+				csvFeature(orb.LineString{{0, 0}, {1, 1}}, geojson.Properties{"name": "Main St, North", "note": "say \"hi\"\nthere"}),
+			},
+		},
+		{
+			"empty geometry columns",
+			"id,lon,lat\n1,,\n",
+			CSVGeometry{Lon: "lon", Lat: "lat"},
+			[]*geojson.Feature{csvFeature(nil, geojson.Properties{"id": int64(1)})},
+		},
+		{
+			"empty WKT",
+			"id,wkt\n1, \n",
+			CSVGeometry{WKT: "wkt"},
+			[]*geojson.Feature{csvFeature(nil, geojson.Properties{"id": int64(1)})},
+		},
+		{"header only", "lon,lat\n", CSVGeometry{Lon: "lon", Lat: "lat"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := NewCSVReader(strings.NewReader(tt.input), tt.geometry)
+			if err != nil {
+				t.Fatalf("NewCSVReader() error = %v", err)
+			}
+			var features []*geojson.Feature
+			for {
+				feature, err := reader.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Next() error = %v", err)
+				}
+				features = append(features, feature)
+			}
+			if !reflect.DeepEqual(features, tt.want) {
+				t.Errorf("read %v, want %v", features, tt.want)
+			}
+		})
+	}
+}
+
+func csvFeature(geometry orb.Geometry, properties geojson.Properties) *geojson.Feature {
+	feature := geojson.NewFeature(geometry)
+	feature.Properties = properties
+	return feature
+}
+
+func TestCSVReaderErrors(t *testing.T) {
+	lonLat := CSVGeometry{Lon: "lon", Lat: "lat"}
+	tests := []struct {
+		name     string
+		input    string
+		geometry CSVGeometry
+		wantErr  string
+	}{
+		{"no geometry columns", "lon,lat\n", CSVGeometry{Lon: "lon"}, "CSV input needs a longitude and latitude column or a WKT column"},
+		{"both geometries", "lon,lat,wkt\n", CSVGeometry{Lon: "lon", Lat: "lat", WKT: "wkt"}, "either longitude and latitude columns or a WKT column, not both"},
+		{"empty file", "", lonLat, "failed to read CSV header: EOF"},
+		{"missing column", "x,y\n", lonLat, `CSV column "lon" not found, columns are x, y`},
+		{"duplicate column", "lon,lat,lon\n", lonLat, `duplicate CSV column "lon"`},
+		{"invalid longitude", "lon,lat\n1,2\nwest,2\n", lonLat, `line 3: invalid longitude "west"`},
+		{"missing latitude", "lon,lat\n1,\n", lonLat, `line 2: invalid latitude ""`},
+		{"invalid WKT", "wkt\nPOINT (1\n", CSVGeometry{WKT: "wkt"}, "line 2: failed to decode WKT geometry"},
+		{"wrong field count", "lon,lat\n1,2,3\n", lonLat, "failed to read CSV: record on line 2: wrong number of fields"},
+		{"bare quote", "lon,lat\n1,2\"\n", lonLat, `failed to read CSV: parse error on line 2, column 4: bare " in non-quoted-field`},
+		{"unterminated quote", "lon,lat\n1,\"2\n", lonLat, `extraneous or missing " in quoted-field`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := NewCSVReader(strings.NewReader(tt.input), tt.geometry)
+			for err == nil {
+				_, err = reader.Next()
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseTextValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  any
+	}{
+		{"", nil},
+		{"true", true},
+		{"FALSE", false},
+		{"42", int64(42)},
+		{"-7", int64(-7)},
+		{"+3", int64(3)},
+		{"0", int64(0)},
+		{"18446744073709551615", uint64(math.MaxUint64)},
+		{"1e3", 1000.0},
+		{"-0.5", -0.5},
+		{"0.25", 0.25},
+		{"007", "007"},
+		{"-01", "-01"},
+		{"inf", "inf"},
+		{"NaN", "NaN"},
+		{"1 000", "1 000"},
+		{" 12", " 12"},
+		{"yes", "yes"},
+	}
+	for _, tt := range tests {
+		if got := parseTextValue(tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseTextValue(%q) = %#v, want %#v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	input := `{"type":"FeatureCollection","features":[` +
+		`{"type":"Feature","id":"a","geometry":{"type":"Point","coordinates":[1,2]},"properties":{"name":"x, y","empty":null}},` +
+		`{"type":"Feature","geometry":null,"properties":{"name":null,"empty":null}}]}`
+	var parquet bytes.Buffer
+	if _, err := GenerateFrom(strings.NewReader(input), &parquet); err != nil {
+		t.Fatalf("GenerateFrom() error = %v", err)
+	}
+
+	var output bytes.Buffer
+	count, err := ExportCSV(bytes.NewReader(parquet.Bytes()), int64(parquet.Len()), &output, CSVGeometryWKT)
+	if err != nil {
+		t.Fatalf("ExportCSV() error = %v", err)
+	}
+	want := "geometry,empty,feature_id,name\nPOINT(1 2),,a,\"x, y\"\n,,,\n"
+	if count != 2 || output.String() != want {
+		t.Errorf("ExportCSV() wrote %d features:\n%s\nwant:\n%s", count, output.String(), want)
+	}
+}
@@ -0,0 +1,383 @@
+package gogeo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb/geojson"
+)
+
+// FeatureReader reads features one at a time.
+// Next returns io.EOF once all features have been read.
+type FeatureReader interface {
+	Next() (*geojson.Feature, error)
+}
+
+// GeoJSONDecoder is a streaming FeatureReader for GeoJSON FeatureCollections.
+// Only one feature is held in memory at a time, so arbitrarily large files can be read.
+// Property numbers are decoded from their literal, integers as int64, or uint64 above
+// the int64 range, and other numbers as float64.
+type GeoJSONDecoder struct {
+	decoder *json.Decoder
+	// Whether the decoder is positioned inside the features array.
+	inFeatures bool
+	// Whether the features array has been fully consumed.
+	done bool
+}
+
+// NewGeoJSONDecoder creates a streaming decoder reading a FeatureCollection from r.
+// A leading UTF-8 byte order mark is skipped.
+func NewGeoJSONDecoder(r io.Reader) *GeoJSONDecoder {
+	return &GeoJSONDecoder{decoder: json.NewDecoder(skipBOM(r))}
+}
+
+// Next decodes the next feature of the collection.
+func (d *GeoJSONDecoder) Next() (*geojson.Feature, error) {
+	raw, err := d.nextRaw()
+	if err != nil {
+		return nil, err
+	}
+	return decodeFeature(raw)
+}
+
+// nextRaw returns the undecoded JSON of the next feature of the collection
+func (d *GeoJSONDecoder) nextRaw() (json.RawMessage, error) {
+	if d.done {
+		return nil, io.EOF
+	}
+
+	if !d.inFeatures {
+		if err := d.seekFeatures(); err != nil {
+			return nil, err
+		}
+	}
+
+	if !d.decoder.More() {
+		// Consume the closing bracket of the features array
+		if _, err := d.decoder.Token(); err != nil {
+			return nil, err
+		}
+		d.done = true
+		if err := d.finish(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+
+	var raw json.RawMessage
+	if err := d.decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to decode feature: %w", err)
+	}
+	return raw, nil
+}
+
+// offset returns the input offset just past the last feature read
+func (d *GeoJSONDecoder) offset() int64 {
+	return d.decoder.InputOffset()
+}
+
+// decodeFeature decodes a GeoJSON Feature object
+func decodeFeature(raw json.RawMessage) (*geojson.Feature, error) {
+	var feature geojson.Feature
+	if err := json.Unmarshal(raw, &feature); err != nil {
+		return nil, fmt.Errorf("failed to decode feature: %w", err)
+	}
+	var doc struct {
+		Geometry   json.RawMessage `json:"geometry"`
+		Properties json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("failed to decode feature: %w", err)
+	}
+
+	// orb decodes every number as a float64, decode the properties again keeping
+	// their integers
+	if feature.Properties != nil {
+		properties, err := decodeJSON(doc.Properties)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode feature properties: %w", err)
+		}
+		feature.Properties = properties.(map[string]any)
+	}
+
+	// orb geometries are two-dimensional, recover Z ordinates from the raw geometry
+	if feature.Geometry != nil {
+		geometry, err := withZ(feature.Geometry, doc.Geometry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode feature geometry: %w", err)
+		}
+		feature.Geometry = geometry
+	}
+
+	return &feature, nil
+}
+
+// decodeJSON decodes a JSON value like json.Unmarshal, except that numbers are typed
+// from their literal: integers are int64, or uint64 above the int64 range, and other
+// numbers float64, so that integers such as 9007199254740993 are kept exactly
+func decodeJSON(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return convertNumbers(value), nil
+}
+
+// convertNumbers replaces the json.Number values of a decoded JSON value, recursively
+func convertNumbers(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		return parseNumber(v)
+	case map[string]any:
+		for key, element := range v {
+			v[key] = convertNumbers(element)
+		}
+	case []any:
+		for i, element := range v {
+			v[i] = convertNumbers(element)
+		}
+	}
+	return value
+}
+
+// parseNumber returns the value of a JSON number literal
+func parseNumber(number json.Number) any {
+	text := number.String()
+	if !strings.ContainsAny(text, ".eE") {
+		if integer, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return integer
+		}
+		if unsigned, err := strconv.ParseUint(text, 10, 64); err == nil {
+			return unsigned
+		}
+	}
+	// Integers beyond the uint64 range are rounded like other numbers
+	float, _ := strconv.ParseFloat(text, 64)
+	return float
+}
+
+// seekFeatures advances the decoder to the first element of the features array
+func (d *GeoJSONDecoder) seekFeatures() error {
+	if err := d.expectDelim('{'); err != nil {
+		return err
+	}
+
+	for d.decoder.More() {
+		token, err := d.decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		key, ok := token.(string)
+		if !ok {
+			return fmt.Errorf("unexpected token %v", token)
+		}
+
+		if key == "features" {
+			if err := d.expectDelim('['); err != nil {
+				return err
+			}
+			d.inFeatures = true
+			return nil
+		}
+		if err := d.decodeMember(key); err != nil {
+			return err
+		}
+	}
+
+	return errors.New("FeatureCollection has no features array")
+}
+
+// finish reads the members of the FeatureCollection following the features array and
+// checks that nothing follows the collection
+func (d *GeoJSONDecoder) finish() error {
+	for d.decoder.More() {
+		token, err := d.decoder.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return fmt.Errorf("unexpected token %v", token)
+		}
+		if key == "features" {
+			return errors.New("FeatureCollection has two features arrays")
+		}
+		if err := d.decodeMember(key); err != nil {
+			return err
+		}
+	}
+	if err := d.expectDelim('}'); err != nil {
+		return err
+	}
+
+	if token, err := d.decoder.Token(); !errors.Is(err, io.EOF) {
+		if err != nil {
+			return fmt.Errorf("unexpected data after the FeatureCollection: %w", err)
+		}
+		return fmt.Errorf("unexpected data after the FeatureCollection: %v", token)
+	}
+	return nil
+}
+
+// decodeMember reads the value of a member of the FeatureCollection other than its
+// features, checking its type
+func (d *GeoJSONDecoder) decodeMember(key string) error {
+	if key == "type" {
+		var typ string
+		if err := d.decoder.Decode(&typ); err != nil {
+			return err
+		}
+		if typ != "FeatureCollection" {
+			return fmt.Errorf("expected a FeatureCollection, got %q", typ)
+		}
+		return nil
+	}
+
+	// Skip other members such as bbox or crs
+	var skipped json.RawMessage
+	return d.decoder.Decode(&skipped)
+}
+
+// expectDelim reads the next token and checks that it is the given delimiter
+func (d *GeoJSONDecoder) expectDelim(delim json.Delim) error {
+	token, err := d.decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %q, got %v", delim, token)
+	}
+	return nil
+}
+
+// skipBOM returns a reader of r without its leading UTF-8 byte order mark, if any
+func skipBOM(r io.Reader) io.Reader {
+	buffered := bufio.NewReader(r)
+	if prefix, _ := buffered.Peek(3); bytes.Equal(prefix, []byte("\xef\xbb\xbf")) {
+		_, _ = buffered.Discard(3)
+	}
+	return buffered
+}
+
+// GeoJSONSeqDecoder is a streaming FeatureReader for newline-delimited GeoJSON
+// (GeoJSONL, NDJSON), where each line holds one Feature. The record separators of
+// RFC 8142 GeoJSON text sequences are also accepted. Property numbers are decoded like
+// those of GeoJSONDecoder.
+type GeoJSONSeqDecoder struct {
+	decoder *json.Decoder
+	// Number of features decoded so far.
+	count int
+}
+
+// NewGeoJSONSeqDecoder creates a streaming decoder reading one Feature per line from r.
+func NewGeoJSONSeqDecoder(r io.Reader) *GeoJSONSeqDecoder {
+	return &GeoJSONSeqDecoder{decoder: json.NewDecoder(recordSeparatorFilter{skipBOM(r)})}
+}
+
+// Next decodes the next feature of the sequence.
+func (d *GeoJSONSeqDecoder) Next() (*geojson.Feature, error) {
+	raw, err := d.nextRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	feature, err := decodeFeature(raw)
+	if err != nil {
+		return nil, fmt.Errorf("feature %d: %w", d.count, err)
+	}
+	return feature, nil
+}
+
+// nextRaw returns the undecoded JSON of the next feature of the sequence
+func (d *GeoJSONSeqDecoder) nextRaw() (json.RawMessage, error) {
+	var raw json.RawMessage
+	if err := d.decoder.Decode(&raw); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("failed to decode feature %d: %w", d.count+1, err)
+	}
+	d.count++
+	return raw, nil
+}
+
+// offset returns the input offset just past the last feature read
+func (d *GeoJSONSeqDecoder) offset() int64 {
+	return d.decoder.InputOffset()
+}
+
+// recordSeparatorFilter replaces the RS characters of GeoJSON text sequences with spaces
+type recordSeparatorFilter struct {
+	r io.Reader
+}
+
+func (f recordSeparatorFilter) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	for i := range p[:n] {
+		if p[i] == 0x1e {
+			p[i] = ' '
+		}
+	}
+	return n, err
+}
+
+// readAllFeatures reads the remaining features of a reader into memory
+func readAllFeatures(reader FeatureReader) ([]*geojson.Feature, error) {
+	var features []*geojson.Feature
+	for {
+		feature, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return features, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		features = append(features, feature)
+	}
+}
+
+// sliceReader is a FeatureReader over features held in memory
+type sliceReader struct {
+	features []*geojson.Feature
+}
+
+func newSliceReader(features []*geojson.Feature) *sliceReader {
+	return &sliceReader{features: features}
+}
+
+func (r *sliceReader) Next() (*geojson.Feature, error) {
+	if len(r.features) == 0 {
+		return nil, io.EOF
+	}
+	feature := r.features[0]
+	r.features = r.features[1:]
+	return feature, nil
+}
+
+// contextReader stops reading features once its context is done
+type contextReader struct {
+	ctx    context.Context
+	reader FeatureReader
+}
+
+// withContext wraps a reader so that Next fails once ctx is cancelled
+func withContext(ctx context.Context, reader FeatureReader) FeatureReader {
+	return &contextReader{ctx: ctx, reader: reader}
+}
+
+func (r *contextReader) Next() (*geojson.Feature, error) {
+	if err := r.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.reader.Next()
+}
@@ -0,0 +1,66 @@
+package gogeo
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestGeoJSONDecoder(t *testing.T) {
+	const feature = `{"type":"Feature","geometry":{"type":"Point","coordinates":[1,2]},"properties":{"n":1}}`
+	tests := []struct {
+		name     string
+		input    string
+		features int
+		wantErr  string
+	}{
+		{"collection", `{"type":"FeatureCollection","features":[` + feature + `,` + feature + `]}`, 2, ""},
+		{"members after features", `{"features":[` + feature + `],"type":"FeatureCollection","bbox":[1,2,1,2]}`, 1, ""},
+		{"trailing whitespace", `{"type":"FeatureCollection","features":[]}` + "\n\n", 0, ""},
+		{"byte order mark", "\xef\xbb\xbf" + `{"type":"FeatureCollection","features":[` + feature + `]}`, 1, ""},
+		{"trailing garbage", `{"type":"FeatureCollection","features":[` + feature + `]} trailing`, 1, "unexpected data after the FeatureCollection"},
+		{"second collection", `{"type":"FeatureCollection","features":[]}{}`, 0, "unexpected data after the FeatureCollection"},
+		{"conflicting type", `{"features":[` + feature + `],"type":"Feature"}`, 1, `expected a FeatureCollection, got "Feature"`},
+		{"two features arrays", `{"features":[],"features":[]}`, 0, "two features arrays"},
+		{"unclosed collection", `{"type":"FeatureCollection","features":[]`, 0, "unexpected end of JSON input"},
+		{"no features", `{"type":"FeatureCollection"}`, 0, "no features array"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := NewGeoJSONDecoder(strings.NewReader(tt.input))
+			features := 0
+			var err error
+			for {
+				_, err = decoder.Next()
+				if err != nil {
+					break
+				}
+				features++
+			}
+			if features != tt.features {
+				t.Errorf("decoded %d features, want %d", features, tt.features)
+			}
+			if tt.wantErr == "" {
+				if !errors.Is(err, io.EOF) {
+					t.Errorf("Next() error = %v, want io.EOF", err)
+				}
+				return
+			}
+			if err == nil || errors.Is(err, io.EOF) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Next() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGeoJSONSeqDecoderByteOrderMark(t *testing.T) {
+	input := "\xef\xbb\xbf" + `{"type":"Feature","geometry":null,"properties":{}}` + "\n"
+	decoder := NewGeoJSONSeqDecoder(strings.NewReader(input))
+	if _, err := decoder.Next(); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if _, err := decoder.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("Next() error = %v, want io.EOF", err)
+	}
+}
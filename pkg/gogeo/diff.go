@@ -0,0 +1,297 @@
+package gogeo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/paulmach/orb"
+)
+
+// maxDiffChanges is the number of feature changes listed; further ones are only counted
+const maxDiffChanges = 1000
+
+// Kinds of differences between two files
+const (
+	// DiffAdded marks a feature or property only present in the new file.
+	DiffAdded = "added"
+	// DiffRemoved marks a feature or property only present in the old file.
+	DiffRemoved = "removed"
+	// DiffChanged marks a feature whose geometry or properties differ, or a property
+	// whose type differs.
+	DiffChanged = "changed"
+)
+
+// DiffOptions configures how the features of two files are matched.
+type DiffOptions struct {
+	// Key is the property identifying a feature in both files. When empty, features
+	// are matched by their id, or by a hash of their geometry if they have none, in
+	// which case a changed geometry shows as a removal and an addition.
+	Key string
+}
+
+// FeatureChange is a feature added, removed or changed between two files.
+type FeatureChange struct {
+	// Key matching the feature: the value of DiffOptions.Key, the feature id, or the
+	// hash of its geometry prefixed with "geometry:".
+	Key string `json:"key"`
+	// DiffAdded, DiffRemoved or DiffChanged.
+	Change string `json:"change"`
+	// Properties of a changed feature whose values differ, with "geometry" if its
+	// geometry differs.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// SchemaChange is a property added, removed or whose type changed between two files.
+type SchemaChange struct {
+	Property string `json:"property"`
+	// DiffAdded, DiffRemoved or DiffChanged.
+	Change string `json:"change"`
+	// JSON types of the values of the property in each file, as in PropertyStats.
+	OldType string `json:"old_type,omitempty"`
+	NewType string `json:"new_type,omitempty"`
+}
+
+// DiffReport lists the differences between two files.
+type DiffReport struct {
+	// Number of features of each file.
+	OldFeatures int64 `json:"old_features"`
+	NewFeatures int64 `json:"new_features"`
+	// Number of features added, removed, changed and unchanged.
+	Added     int64 `json:"added"`
+	Removed   int64 `json:"removed"`
+	Changed   int64 `json:"changed"`
+	Unchanged int64 `json:"unchanged"`
+	// Features added, removed or changed, up to the first 1000, new file order first
+	// and then the removals in old file order.
+	Changes []FeatureChange `json:"changes"`
+	// Number of feature changes beyond those listed.
+	Omitted int64 `json:"omitted,omitempty"`
+	// Properties added, removed or whose type changed, sorted by name.
+	Schema []SchemaChange `json:"schema"`
+	// Number of features of each file sharing their key with an earlier one; they are
+	// matched in order of appearance.
+	DuplicateKeys int64 `json:"duplicate_keys,omitempty"`
+}
+
+// Identical reports whether the files have the same features and schema.
+func (r *DiffReport) Identical() bool {
+	return r.Added == 0 && r.Removed == 0 && r.Changed == 0 && len(r.Schema) == 0
+}
+
+func (r *DiffReport) add(change FeatureChange) {
+	if len(r.Changes) >= maxDiffChanges {
+		r.Omitted++
+		return
+	}
+	r.Changes = append(r.Changes, change)
+}
+
+// uniqueKey distinguishes the repeated keys of a file by their occurrence, e.g. "a#2"
+// for the second feature with key "a", counting them in keys
+func (r *DiffReport) uniqueKey(key string, keys map[string]int) string {
+	n := keys[key]
+	keys[key]++
+	if n == 0 {
+		return key
+	}
+	r.DuplicateKeys++
+	return key + "#" + strconv.Itoa(n+1)
+}
+
+// featureDigest holds the hashes of the geometry and properties of a feature
+type featureDigest struct {
+	// order is the position of the feature in its file.
+	order      int64
+	geometry   uint64
+	properties map[string]uint64
+}
+
+// DiffFeatures compares the features of two readers, matched as configured by opts,
+// and reports the features added, removed and changed, and the properties added,
+// removed or whose type changed. Only hashes of the old features are held in memory;
+// the new features are streamed.
+func DiffFeatures(ctx context.Context, oldReader, newReader FeatureReader, opts DiffOptions) (*DiffReport, error) {
+	report := &DiffReport{}
+
+	oldKinds := make(map[string]*propertyAccumulator)
+	digests := make(map[string]*featureDigest)
+	oldKeys := make(map[string]int)
+	err := readDigests(ctx, oldReader, opts, oldKinds, func(key string, digest *featureDigest) {
+		report.OldFeatures++
+		digest.order = report.OldFeatures
+		digests[report.uniqueKey(key, oldKeys)] = digest
+	})
+	if err != nil {
+		return nil, AppError{Message: "failed to read the old features", Value: err}
+	}
+
+	newKinds := make(map[string]*propertyAccumulator)
+	newKeys := make(map[string]int)
+	err = readDigests(ctx, newReader, opts, newKinds, func(key string, digest *featureDigest) {
+		report.NewFeatures++
+		key = report.uniqueKey(key, newKeys)
+
+		old, ok := digests[key]
+		if !ok {
+			report.Added++
+			report.add(FeatureChange{Key: key, Change: DiffAdded})
+			return
+		}
+		delete(digests, key)
+
+		if fields := changedFields(old, digest); len(fields) > 0 {
+			report.Changed++
+			report.add(FeatureChange{Key: key, Change: DiffChanged, Fields: fields})
+		} else {
+			report.Unchanged++
+		}
+	})
+	if err != nil {
+		return nil, AppError{Message: "failed to read the new features", Value: err}
+	}
+
+	removed := make([]string, 0, len(digests))
+	for key := range digests {
+		removed = append(removed, key)
+	}
+	sort.Slice(removed, func(i, j int) bool { return digests[removed[i]].order < digests[removed[j]].order })
+	for _, key := range removed {
+		report.Removed++
+		report.add(FeatureChange{Key: key, Change: DiffRemoved})
+	}
+
+	report.Schema = schemaChanges(oldKinds, newKinds)
+	return report, nil
+}
+
+// readDigests reads all features of reader, recording the types of their properties
+// in kinds and passing the key and digest of each to handle
+func readDigests(ctx context.Context, reader FeatureReader, opts DiffOptions, kinds map[string]*propertyAccumulator, handle func(key string, digest *featureDigest)) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		feature, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		digest := &featureDigest{properties: make(map[string]uint64, len(feature.Properties))}
+		if digest.geometry, err = geometryHash(feature.Geometry); err != nil {
+			return err
+		}
+		for name, value := range feature.Properties {
+			if value == nil {
+				continue
+			}
+			digest.properties[name] = valueHash(value)
+
+			accumulator, ok := kinds[name]
+			if !ok {
+				accumulator = &propertyAccumulator{}
+				kinds[name] = accumulator
+			}
+			accumulator.addKind(value)
+		}
+
+		var key string
+		switch {
+		case opts.Key != "":
+			key = featureKey(feature.Properties[opts.Key])
+		case feature.ID != nil:
+			key = featureKey(feature.ID)
+		default:
+			key = "geometry:" + strconv.FormatUint(digest.geometry, 16)
+		}
+		handle(key, digest)
+	}
+}
+
+// featureKey renders an id or key property value as a string
+func featureKey(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return v
+	}
+	if number, ok := toFloat(value); ok {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// changedFields returns the names of the properties whose values differ between two
+// digests, and "geometry" if the geometries differ
+func changedFields(old, current *featureDigest) []string {
+	var fields []string
+	if old.geometry != current.geometry {
+		fields = append(fields, "geometry")
+	}
+
+	var properties []string
+	for name, hash := range current.properties {
+		if oldHash, ok := old.properties[name]; !ok || oldHash != hash {
+			properties = append(properties, name)
+		}
+	}
+	for name := range old.properties {
+		if _, ok := current.properties[name]; !ok {
+			properties = append(properties, name)
+		}
+	}
+	sort.Strings(properties)
+	return append(fields, properties...)
+}
+
+// schemaChanges compares the property types of two files
+func schemaChanges(oldKinds, newKinds map[string]*propertyAccumulator) []SchemaChange {
+	changes := []SchemaChange{}
+	for name, old := range oldKinds {
+		current, ok := newKinds[name]
+		switch {
+		case !ok:
+			changes = append(changes, SchemaChange{Property: name, Change: DiffRemoved, OldType: old.kind})
+		case old.kind != current.kind:
+			changes = append(changes, SchemaChange{Property: name, Change: DiffChanged, OldType: old.kind, NewType: current.kind})
+		}
+	}
+	for name, current := range newKinds {
+		if _, ok := oldKinds[name]; !ok {
+			changes = append(changes, SchemaChange{Property: name, Change: DiffAdded, NewType: current.kind})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Property < changes[j].Property })
+	return changes
+}
+
+// geometryHash hashes the WKB of a geometry, 0 for no geometry
+func geometryHash(geometry orb.Geometry) (uint64, error) {
+	if geometry == nil {
+		return 0, nil
+	}
+	value, err := encodeGeometry(geometry, GeometryEncodingWKB)
+	if err != nil {
+		return 0, err
+	}
+	hash := fnv.New64a()
+	hash.Write(value)
+	return hash.Sum64(), nil
+}
+
+// valueHash hashes a property value, equal for numbers of equal value whatever their
+// Go type
+func valueHash(value any) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(distinctKey(value)))
+	return hash.Sum64()
+}
@@ -0,0 +1,140 @@
+package gogeo
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// Policies for the features with an empty geometry, set with WithEmptyGeometries
+const (
+	// EmptyGeometriesKeep writes an empty geometry as the WKB or WKT EMPTY geometry of its
+	// type, such as POINT EMPTY.
+	EmptyGeometriesKeep = "keep"
+	// EmptyGeometriesDrop leaves out the features with an empty geometry.
+	EmptyGeometriesDrop = "drop"
+	// EmptyGeometriesFail fails the conversion at the first feature with an empty geometry.
+	EmptyGeometriesFail = "fail"
+)
+
+// WithEmptyGeometries sets how the features whose geometry has no positions, such as a
+// GeoJSON Point with empty coordinates, a polygon whose rings have no coordinates or an
+// empty GeometryCollection, are written: EmptyGeometriesKeep, EmptyGeometriesDrop or
+// EmptyGeometriesFail. With EmptyGeometriesKeep, the default, they are written as the
+// EMPTY geometry of their type, without a bbox, and the Report counts them.
+func WithEmptyGeometries(policy string) Option {
+	return func(cfg *config) {
+		switch normalized := strings.ToLower(policy); normalized {
+		case EmptyGeometriesKeep:
+			cfg.emptyGeometries = ""
+		case EmptyGeometriesDrop, EmptyGeometriesFail:
+			cfg.emptyGeometries = normalized
+		default:
+			cfg.fail(AppError{Message: fmt.Sprintf("unsupported empty geometry policy %q, expected keep, drop or fail", policy)})
+		}
+	}
+}
+
+// emptyPoint returns POINT EMPTY, which WKB encodes as a point of NaN coordinates
+func emptyPoint() orb.Point {
+	return orb.Point{math.NaN(), math.NaN()}
+}
+
+// isEmptyPoint reports whether a point is POINT EMPTY
+func isEmptyPoint(point orb.Point) bool {
+	return math.IsNaN(point[0]) && math.IsNaN(point[1])
+}
+
+// emptyGeometry reports whether a non-nil geometry has no positions
+func emptyGeometry(geometry orb.Geometry) bool {
+	return geometry != nil && countPositions(geometry) == 0
+}
+
+// canonicalEmpty returns the EMPTY geometry of the type of an empty geometry, so that a
+// polygon of rings without coordinates is written as POLYGON EMPTY
+func canonicalEmpty(geometry orb.Geometry) orb.Geometry {
+	switch g := geometry.(type) {
+	case orb.Point:
+		return emptyPoint()
+	case orb.MultiPoint:
+		return orb.MultiPoint{}
+	case orb.LineString:
+		return orb.LineString{}
+	case orb.MultiLineString:
+		return orb.MultiLineString{}
+	case orb.Ring, orb.Polygon:
+		return orb.Polygon{}
+	case orb.MultiPolygon:
+		return orb.MultiPolygon{}
+	case orb.Collection:
+		return orb.Collection{}
+	case GeometryZ:
+		return canonicalEmpty(g.Geometry)
+	}
+	return geometry
+}
+
+// emptyGeometryError returns the error of EmptyGeometriesFail for the nth feature
+func emptyGeometryError(n int, id any) error {
+	if id != nil {
+		return AppError{Message: fmt.Sprintf("feature %d (id %v) has an empty geometry", n, id)}
+	}
+	return AppError{Message: fmt.Sprintf("feature %d has an empty geometry", n)}
+}
+
+// jsonEmptyPoint is POINT EMPTY, encoded in GeoJSON as a Point with empty coordinates
+// rather than the NaN coordinates JSON cannot represent
+type jsonEmptyPoint struct {
+	orb.Point
+}
+
+// MarshalJSON encodes the empty coordinates of the point
+func (jsonEmptyPoint) MarshalJSON() ([]byte, error) {
+	return []byte("[]"), nil
+}
+
+// jsonFeature returns a feature whose empty points can be encoded as GeoJSON, a copy of
+// feature if it has any
+func jsonFeature(feature *geojson.Feature) *geojson.Feature {
+	if !hasEmptyPoint(feature.Geometry) {
+		return feature
+	}
+	encoded := *feature
+	encoded.Geometry = jsonGeometry(feature.Geometry)
+	return &encoded
+}
+
+// hasEmptyPoint reports whether a geometry is, or a collection has, POINT EMPTY
+func hasEmptyPoint(geometry orb.Geometry) bool {
+	switch g := geometry.(type) {
+	case orb.Point:
+		return isEmptyPoint(g)
+	case orb.Collection:
+		for _, member := range g {
+			if hasEmptyPoint(member) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonGeometry returns a geometry whose empty points are replaced by jsonEmptyPoint
+func jsonGeometry(geometry orb.Geometry) orb.Geometry {
+	switch g := geometry.(type) {
+	case orb.Point:
+		if isEmptyPoint(g) {
+			return jsonEmptyPoint{g}
+		}
+	case orb.Collection:
+		members := make(orb.Collection, len(g))
+		for i, member := range g {
+			members[i] = jsonGeometry(member)
+		}
+		return members
+	}
+	return geometry
+}
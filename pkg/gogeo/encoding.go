@@ -0,0 +1,146 @@
+package gogeo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/encoding"
+)
+
+// Encodings of property columns accepted by WithColumnEncoding.
+const (
+	// EncodingPlain writes the values one after the other, without a dictionary.
+	EncodingPlain = "plain"
+	// EncodingDictionary writes the distinct values once per row group and the rows as
+	// indexes into them.
+	EncodingDictionary = "dictionary"
+	// EncodingDelta writes integers, timestamps and dates as DELTA_BINARY_PACKED
+	// differences, and strings as DELTA_BYTE_ARRAY suffixes of the previous value.
+	EncodingDelta = "delta"
+	// EncodingByteStreamSplit writes floating point numbers as BYTE_STREAM_SPLIT streams
+	// of their bytes, which compress better than their plain values.
+	EncodingByteStreamSplit = "byte-stream-split"
+)
+
+// columnEncodings maps the encodings of property columns to parquet-go encodings,
+// that of delta encoding being for integers
+var columnEncodings = map[string]encoding.Encoding{
+	EncodingPlain:           &parquet.Plain,
+	EncodingDictionary:      &parquet.RLEDictionary,
+	EncodingDelta:           &parquet.DeltaBinaryPacked,
+	EncodingByteStreamSplit: &parquet.ByteStreamSplit,
+}
+
+// WithColumnEncoding writes a property column with an encoding, EncodingPlain,
+// EncodingDictionary, EncodingDelta or EncodingByteStreamSplit, instead of the default
+// of parquet-go, which is plain for numbers and DELTA_LENGTH_BYTE_ARRAY for strings.
+// Dictionary encoding suits columns with few distinct values, delta encoding sorted or
+// sequential integers and timestamps, and byte stream split encoding floating point
+// measurements. The plain encoding turns off the dictionary encoding of the enum
+// columns of WithEnumColumns. The column is named after renaming, like those of
+// WithCast, and struct and list columns cannot be set.
+func WithColumnEncoding(column, encoding string) Option {
+	return func(cfg *config) {
+		if column == "" {
+			cfg.fail(AppError{Message: "encoding column name must not be empty"})
+			return
+		}
+		encoding = strings.ToLower(encoding)
+		if _, ok := columnEncodings[encoding]; !ok {
+			cfg.fail(AppError{Message: fmt.Sprintf("unsupported encoding %q of column %q, expected plain, dictionary, delta or byte-stream-split", encoding, column)})
+			return
+		}
+		if cfg.encodings == nil {
+			cfg.encodings = make(map[string]string)
+		}
+		cfg.encodings[column] = encoding
+	}
+}
+
+// checkEncodings checks that the columns of the encodings set with WithColumnEncoding
+// are property columns of the schema whose type the encoding applies to
+func (cfg *config) checkEncodings(schema []PropertyInfo) error {
+	names := make([]string, 0, len(cfg.encodings))
+	for name := range cfg.encodings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		index := -1
+		for i, info := range schema {
+			if info.Name == name {
+				index = i
+			}
+		}
+		if index < 0 {
+			return AppError{Message: fmt.Sprintf("cannot set the encoding of %q, it is not a property column", name)}
+		}
+		encoding := cfg.encodings[name]
+		if cfg.parquetVersion == ParquetVersion1 && (encoding == EncodingDelta || encoding == EncodingByteStreamSplit) {
+			return AppError{Message: fmt.Sprintf("cannot write column %q with %s encoding in Parquet %s", name, encoding, ParquetVersion1)}
+		}
+		if err := checkEncoding(schema[index], encoding); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkEncoding checks that an encoding applies to the values of a property column
+func checkEncoding(info PropertyInfo, encoding string) error {
+	var ok bool
+	switch info.Type {
+	case PropertyTypeStruct, PropertyTypeList:
+		ok = false
+	case PropertyTypeInt, PropertyTypeUint:
+		ok = encoding != EncodingByteStreamSplit
+	case PropertyTypeFloat:
+		ok = encoding != EncodingDelta
+	case PropertyTypeBool:
+		ok = encoding != EncodingDelta && encoding != EncodingByteStreamSplit
+	default:
+		ok = encoding != EncodingByteStreamSplit
+	}
+	if !ok {
+		return AppError{Message: fmt.Sprintf("cannot write %s column %q with %s encoding", columnTypeName(info), info.Name, encoding)}
+	}
+	return nil
+}
+
+// columnTypeName returns the type of a property column for a message, with the width
+// of narrowed integers
+func columnTypeName(info PropertyInfo) string {
+	if info.Type == PropertyTypeInt && info.Bits != 0 {
+		return fmt.Sprintf("INT(%d)", info.Bits)
+	}
+	return info.Type.String()
+}
+
+// columnEncoding returns the encoding of a leaf property column of values of a kind,
+// that of its name in encodings, or the dictionary encoding of enum columns, nil for
+// the default one
+func columnEncoding(info PropertyInfo, kind parquet.Kind, encodings map[string]string) encoding.Encoding {
+	name, ok := encodings[info.Name]
+	if !ok {
+		if isEnumColumn(info) {
+			return &parquet.RLEDictionary
+		}
+		return nil
+	}
+	if name == EncodingDelta && (kind == parquet.ByteArray || kind == parquet.FixedLenByteArray) {
+		return &parquet.DeltaByteArray
+	}
+	return columnEncodings[name]
+}
+
+// encodedNode is a leaf node of a record schema written with an encoding
+type encodedNode struct {
+	parquet.Node
+	encoding encoding.Encoding
+}
+
+func (n encodedNode) Encoding() encoding.Encoding {
+	return n.encoding
+}
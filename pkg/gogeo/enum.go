@@ -0,0 +1,181 @@
+package gogeo
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// EnumMetadataKey is the key of the Parquet key-value metadata listing the values of
+// the enum columns detected with WithEnumColumns, as a JSON object mapping each column
+// name to its sorted values.
+const EnumMetadataKey = "gogeo.enums"
+
+// WithEnumColumns detects the string property columns with at most maxValues distinct
+// values, such as categories and status codes, and writes them with dictionary
+// encoding, so that they compress better and readers filter them by their dictionary.
+// A column also needs at least twice as many values as distinct ones, so that the ids
+// of small inputs are not taken for categories. The values of each enum column, listed
+// in PropertyInfo.Enum, are recorded in the EnumMetadataKey metadata of the file.
+func WithEnumColumns(maxValues int) Option {
+	return func(cfg *config) {
+		if maxValues <= 0 {
+			cfg.fail(AppError{Message: fmt.Sprintf("invalid enum column size %d, expected a positive number of values", maxValues)})
+			return
+		}
+		cfg.enumValues = maxValues
+	}
+}
+
+// enumAnalyzer collects the distinct values of string properties up to a maximum
+type enumAnalyzer struct {
+	maxValues int
+	// distinct holds the distinct values of the properties that may be enums, and
+	// values their number of non-null values.
+	distinct map[string]map[string]bool
+	values   map[string]int
+	// rejected holds the properties with too many distinct values or values that are
+	// not strings.
+	rejected map[string]bool
+}
+
+func newEnumAnalyzer(maxValues int) *enumAnalyzer {
+	return &enumAnalyzer{
+		maxValues: maxValues,
+		distinct:  make(map[string]map[string]bool),
+		values:    make(map[string]int),
+		rejected:  make(map[string]bool),
+	}
+}
+
+// add records a property value
+func (e *enumAnalyzer) add(key string, value any) {
+	if value == nil || e.rejected[key] {
+		return
+	}
+	text, ok := value.(string)
+	if !ok {
+		e.reject(key)
+		return
+	}
+	values := e.distinct[key]
+	if values == nil {
+		values = make(map[string]bool)
+		e.distinct[key] = values
+	}
+	values[text] = true
+	e.values[key]++
+	if len(values) > e.maxValues {
+		e.reject(key)
+	}
+}
+
+func (e *enumAnalyzer) reject(key string) {
+	e.rejected[key] = true
+	delete(e.distinct, key)
+}
+
+// enum returns the sorted values of a property column of a type if it is an enum, nil
+// otherwise
+func (e *enumAnalyzer) enum(key string, propType PropertyType) []string {
+	if e == nil {
+		return nil
+	}
+	values := e.distinct[key]
+	if propType != PropertyTypeString || len(values) == 0 || e.values[key] < 2*len(values) {
+		return nil
+	}
+	return slices.Sorted(maps.Keys(values))
+}
+
+// isEnumColumn reports whether a property column is an enum column, which is dictionary
+// encoded
+func isEnumColumn(info PropertyInfo) bool {
+	return info.Enum != nil && info.Type == PropertyTypeString
+}
+
+// enumRecorder collects the values written to the enum columns of a file
+type enumRecorder map[string]map[string]bool
+
+// newEnumRecorder returns a recorder for the enum columns of a schema, nil if it has none
+func newEnumRecorder(schema []PropertyInfo) enumRecorder {
+	var recorder enumRecorder
+	for _, info := range schema {
+		if info.Enum == nil || info.Type != PropertyTypeString {
+			continue
+		}
+		if recorder == nil {
+			recorder = make(enumRecorder)
+		}
+		recorder[info.Name] = make(map[string]bool)
+	}
+	return recorder
+}
+
+// add records the values of the enum columns of a feature's properties
+func (r enumRecorder) add(properties map[string]any) {
+	for name, values := range r {
+		if value, ok := properties[name]; ok && value != nil {
+			text, _ := stringifyProperty(value)
+			values[text] = true
+		}
+	}
+}
+
+// metadata returns the JSON of the EnumMetadataKey metadata of the recorded values
+func (r enumRecorder) metadata() (string, error) {
+	enums := make(map[string][]string, len(r))
+	for name, values := range r {
+		enums[name] = slices.Sorted(maps.Keys(values))
+	}
+	data, err := json.Marshal(enums)
+	return string(data), err
+}
+
+// readEnumMetadata returns the values of the enum columns of a Parquet file by name
+func readEnumMetadata(pf *parquet.File) (map[string][]string, error) {
+	value, ok := pf.Lookup(EnumMetadataKey)
+	if !ok {
+		return nil, nil
+	}
+	var enums map[string][]string
+	if err := json.Unmarshal([]byte(value), &enums); err != nil {
+		return nil, AppError{Message: fmt.Sprintf("invalid %s metadata", EnumMetadataKey), Value: err}
+	}
+	return enums, nil
+}
+
+// appendEnumMetadata sets the EnumMetadataKey metadata of a file with rows appended
+// to the union of the enum column values of the file and of the appended rows
+func appendEnumMetadata(metadata *format.FileMetaData, pf, appended *parquet.File) error {
+	enums, err := readEnumMetadata(pf)
+	if err != nil {
+		return err
+	}
+	appendedEnums, err := readEnumMetadata(appended)
+	if err != nil || enums == nil && appendedEnums == nil {
+		return err
+	}
+	if enums == nil {
+		enums = make(map[string][]string)
+	}
+	for name, values := range appendedEnums {
+		enums[name] = slices.Compact(slices.Sorted(slices.Values(append(enums[name], values...))))
+	}
+	data, err := json.Marshal(enums)
+	if err != nil {
+		return fmt.Errorf("failed to marshal enum metadata: %w", err)
+	}
+	for i, kv := range metadata.KeyValueMetadata {
+		if kv.Key == EnumMetadataKey {
+			metadata.KeyValueMetadata[i].Value = string(data)
+			return nil
+		}
+	}
+	metadata.KeyValueMetadata = append(metadata.KeyValueMetadata, format.KeyValue{Key: EnumMetadataKey, Value: string(data)})
+	return nil
+}
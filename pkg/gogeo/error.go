@@ -16,3 +16,12 @@ func (e AppError) Error() string {
 		return e.Message
 	}
 }
+
+// Unwrap returns the underlying error, if any, so that errors.Is and errors.As
+// can inspect it (e.g. to detect context.Canceled).
+func (e AppError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package gogeo
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/clip"
+	"github.com/paulmach/orb/geojson"
+)
+
+// ExtractOptions selects the features extracted from a GeoParquet file.
+type ExtractOptions struct {
+	// BBox keeps the features whose geometry bounding box intersects it, nil to keep
+	// all features.
+	BBox *orb.Bound
+	// Clip cuts the geometries of the extracted features to BBox, dropping features
+	// that only touch it. The Z ordinates of the positions added along BBox are
+	// interpolated.
+	Clip bool
+}
+
+// ExtractGeoParquet writes the rows of GeoParquet of the given size read from r that
+// are selected by extract, and match the filter of WithWhere if given, to w. The output
+// keeps the geometry columns, encodings, CRS, bbox columns and property columns of the
+// input; options such as WithCompression apply to it. When the input has a bbox covering column, row groups whose column
+// statistics lie outside the bounding box are skipped without being decoded. The input
+// is read once.
+func ExtractGeoParquet(ctx context.Context, r io.ReaderAt, size int64, w io.Writer, extract ExtractOptions, opts ...Option) (*Report, error) {
+	pf, err := parquet.OpenFile(r, size, parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+	if err != nil {
+		return nil, AppError{Message: "failed to read GeoParquet file", Value: err}
+	}
+	geoMeta, err := readGeoMetadata(pf)
+	if err != nil {
+		return nil, err
+	}
+	covering, err := bboxCovering(pf, geoMeta)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := geometryOptions(geoMeta)
+	if err != nil {
+		return nil, err
+	}
+	if covering != nil {
+		base = append(base, WithBBoxColumn())
+	}
+	bboxProperties := true
+	for _, name := range bboxPropertyColumns {
+		if _, ok := pf.Schema().Lookup(name); !ok {
+			bboxProperties = false
+		}
+	}
+	if bboxProperties {
+		base = append(base, WithBBoxProperties())
+	}
+	cfg := newConfig(append(base, opts...))
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	schema := cfg.schema
+	if schema == nil {
+		if schema, err = fileProperties(pf, geoMeta, cfg); err != nil {
+			return nil, err
+		}
+		schema = cfg.selectSchema(schema)
+	}
+
+	rows, err := newGeoParquetReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if extract.BBox != nil && covering != nil {
+		kept := rows.rowGroups[:0]
+		for i, rowGroup := range rows.rowGroups {
+			if !covering.disjoint(pf.Metadata().RowGroups[i], *extract.BBox) {
+				kept = append(kept, rowGroup)
+			}
+		}
+		rows.rowGroups = kept
+	}
+
+	reader := &extractReader{reader: withContext(ctx, rows), extract: extract, geographic: geographicCRS(cfg.crs)}
+	report, err := writeGeoParquet(reader, w, schema, cfg, 0)
+	if err != nil {
+		return nil, AppError{Message: "failed to write GeoParquet file", Value: err}
+	}
+	if report.Features == 0 {
+		return nil, AppError{Message: "no features match the extraction"}
+	}
+	return report, nil
+}
+
+// extractReader returns the features of reader selected by extract
+type extractReader struct {
+	reader  FeatureReader
+	extract ExtractOptions
+	// geographic reports that the coordinates are longitudes and latitudes, whose
+	// geometries may cross the antimeridian
+	geographic bool
+}
+
+func (r *extractReader) Next() (*geojson.Feature, error) {
+	for {
+		feature, err := r.reader.Next()
+		if err != nil {
+			return nil, err
+		}
+		if r.extract.BBox == nil {
+			return feature, nil
+		}
+
+		bound := *r.extract.BBox
+		if feature.Geometry == nil || countPositions(feature.Geometry) == 0 || !intersectsBound(feature.Geometry, bound, r.geographic) {
+			continue
+		}
+		if r.extract.Clip {
+			geometry := feature.Geometry
+			if r.geographic {
+				// Clip the parts on either side of the antimeridian
+				geometry = splitAntimeridian(geometry)
+			}
+			clipped, err := clipGeometry(bound, geometry)
+			if err != nil {
+				return nil, err
+			}
+			if clipped == nil || countPositions(clipped) == 0 {
+				continue
+			}
+			feature.Geometry = clipped
+		}
+		return feature, nil
+	}
+}
+
+// clipGeometry cuts a geometry to a bound. The Z ordinates of the kept positions are
+// preserved, and those of the positions added along the bound are interpolated along
+// the nearest original edge.
+func clipGeometry(bound orb.Bound, geometry orb.Geometry) (orb.Geometry, error) {
+	switch g := geometry.(type) {
+	case GeometryZ:
+		clipped, err := clipGeometry(bound, g.Geometry)
+		if err != nil || clipped == nil {
+			return clipped, err
+		}
+		return GeometryZ{Geometry: clipped, Z: repairedZ(g.Geometry, clipped, g.Z)}, nil
+	case orb.Collection:
+		var members orb.Collection
+		for _, member := range g {
+			clipped, err := clipGeometry(bound, member)
+			if err != nil {
+				return nil, err
+			}
+			if clipped != nil && countPositions(clipped) > 0 {
+				members = append(members, clipped)
+			}
+		}
+		if len(members) == 0 {
+			return nil, nil
+		}
+		return members, nil
+	case orb.Point, orb.MultiPoint, orb.LineString, orb.MultiLineString, orb.Ring, orb.Polygon, orb.MultiPolygon, orb.Bound:
+		return clip.Geometry(bound, g), nil
+	}
+	return nil, AppError{Message: fmt.Sprintf("cannot clip a geometry of type %T", geometry)}
+}
+
+// intersectsBound reports whether the bounding box of a geometry intersects bound, on
+// either side of the antimeridian for a geometry of longitudes and latitudes crossing it
+func intersectsBound(geometry orb.Geometry, bound orb.Bound, geographic bool) bool {
+	if !geographic || !crossesAntimeridian(geometry) {
+		return geometry.Bound().Intersects(bound)
+	}
+	if geometryBound := geometry.Bound(); geometryBound.Min[1] > bound.Max[1] || geometryBound.Max[1] < bound.Min[1] {
+		return false
+	}
+	// The longitudes of the geometry are continuous in [0, 360] once shifted
+	west, east := shiftedLongitudes(geometry)
+	for _, shift := range [2]float64{0, 360} {
+		if bound.Min[0]+shift <= east && bound.Max[0]+shift >= west {
+			return true
+		}
+	}
+	return false
+}
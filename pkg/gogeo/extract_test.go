@@ -0,0 +1,39 @@
+package gogeo
+
+import (
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+func TestExtractClipsGeometryZ(t *testing.T) {
+	line := GeometryZ{Geometry: orb.LineString{{-170, 10}, {-160, 10}, {-140, 10}}, Z: []float64{100, 200, 400}}
+	reader := &extractReader{
+		reader:     newSliceReader([]*geojson.Feature{geojson.NewFeature(line)}),
+		extract:    ExtractOptions{BBox: &orb.Bound{Min: orb.Point{-165, 0}, Max: orb.Point{-150, 30}}, Clip: true},
+		geographic: true,
+	}
+	feature, err := reader.Next()
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	clipped, ok := feature.Geometry.(GeometryZ)
+	if !ok {
+		t.Fatalf("clipped geometry is a %T, want GeometryZ", feature.Geometry)
+	}
+	wantLine := orb.LineString{{-165, 10}, {-160, 10}, {-150, 10}}
+	if !orb.Equal(clipped.Geometry, wantLine) {
+		t.Errorf("clipped line = %v, want %v", clipped.Geometry, wantLine)
+	}
+	wantZ := []float64{150, 200, 300}
+	if len(clipped.Z) != len(wantZ) {
+		t.Fatalf("clipped Z = %v, want %v", clipped.Z, wantZ)
+	}
+	for i, z := range wantZ {
+		if clipped.Z[i] != z {
+			t.Errorf("clipped Z = %v, want %v", clipped.Z, wantZ)
+			break
+		}
+	}
+}
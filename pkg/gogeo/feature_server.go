@@ -0,0 +1,527 @@
+package gogeo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// OGC API Features
+const (
+	// DefaultFeatureCollection is the id of the collection of a FeatureServer.
+	DefaultFeatureCollection = "features"
+	// defaultItemsLimit and maxItemsLimit are the default and largest numbers of
+	// features of a page of items.
+	defaultItemsLimit = 10
+	maxItemsLimit     = 10000
+	// crs84 is the URI of the CRS of GeoJSON coordinates.
+	crs84 = "http://www.opengis.net/def/crs/OGC/1.3/CRS84"
+	// geoJSONContentType is the media type of GeoJSON.
+	geoJSONContentType = "application/geo+json"
+)
+
+// ogcConformance lists the conformance classes of OGC API Features implemented by a
+// FeatureServer
+var ogcConformance = []string{
+	"http://www.opengis.net/spec/ogcapi-features-1/1.0/conf/core",
+	"http://www.opengis.net/spec/ogcapi-features-1/1.0/conf/geojson",
+}
+
+// FeatureServerOptions configures a FeatureServer.
+type FeatureServerOptions struct {
+	// Collection is the id of the collection of the features, DefaultFeatureCollection
+	// when empty.
+	Collection string
+	// Title is the title of the collection, its id when empty.
+	Title string
+}
+
+// FeatureServer is an http.Handler serving the features of a GeoParquet file as a
+// collection of an OGC API Features service, with the landing page at /, the
+// conformance classes at /conformance, the collection at /collections/{id}, its
+// features as GeoJSON at /collections/{id}/items and each feature, identified by its
+// row number, at /collections/{id}/items/{featureId}.
+//
+// The items are paged with the limit and offset parameters, and filtered with bbox, a
+// CQL2 text filter as for WithWhere, and equality on a property given as a parameter of
+// its name, such as ?country=CH. When the file has a bbox covering column, row groups
+// whose column statistics lie outside bbox are skipped without being decoded. The
+// coordinates must be longitudes and latitudes.
+type FeatureServer struct {
+	pf       *parquet.File
+	geoMeta  *GeoParquet
+	covering *bboxCoveringColumns
+	options  FeatureServerOptions
+	// fields are the types of the property columns.
+	fields map[string]string
+	// offsets are the row numbers of the first rows of the row groups.
+	offsets []int64
+	mux     *http.ServeMux
+}
+
+// NewFeatureServer returns a FeatureServer over the GeoParquet file of the given size
+// read from r, which must remain open while the server runs.
+func NewFeatureServer(r io.ReaderAt, size int64, options FeatureServerOptions) (*FeatureServer, error) {
+	if options.Collection == "" {
+		options.Collection = DefaultFeatureCollection
+	}
+	if strings.Contains(options.Collection, "/") {
+		return nil, AppError{Message: fmt.Sprintf("invalid collection id %q, it must not contain a slash", options.Collection)}
+	}
+	if options.Title == "" {
+		options.Title = options.Collection
+	}
+
+	pf, err := parquet.OpenFile(r, size, parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+	if err != nil {
+		return nil, AppError{Message: "failed to read GeoParquet file", Value: err}
+	}
+	geoMeta, err := readGeoMetadata(pf)
+	if err != nil {
+		return nil, err
+	}
+	if !geographicCRS(geoMeta.Columns[geoMeta.PrimaryColumn].CRS) {
+		return nil, AppError{Message: fmt.Sprintf("GeoJSON features need longitudes and latitudes, but the CRS of column %q is not geographic", geoMeta.PrimaryColumn)}
+	}
+	covering, err := bboxCovering(pf, geoMeta)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FeatureServer{
+		pf:       pf,
+		geoMeta:  geoMeta,
+		covering: covering,
+		options:  options,
+		fields:   propertyFields(pf, geoMeta),
+		mux:      http.NewServeMux(),
+	}
+	offset := int64(0)
+	for _, rowGroup := range pf.RowGroups() {
+		s.offsets = append(s.offsets, offset)
+		offset += rowGroup.NumRows()
+	}
+
+	s.mux.HandleFunc("GET /{$}", s.serveLandingPage)
+	s.mux.HandleFunc("GET /conformance", s.serveConformance)
+	s.mux.HandleFunc("GET /collections", s.serveCollections)
+	s.mux.HandleFunc("GET /collections/{collection}", s.serveCollection)
+	s.mux.HandleFunc("GET /collections/{collection}/items", s.serveItems)
+	s.mux.HandleFunc("GET /collections/{collection}/items/{feature}", s.serveItem)
+	return s, nil
+}
+
+func (s *FeatureServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// Web clients are usually served from another origin
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	s.mux.ServeHTTP(w, req)
+}
+
+// ItemsQuery selects a page of the features of a FeatureServer.
+type ItemsQuery struct {
+	// BBox keeps the features whose geometry bounding box intersects it, nil to keep
+	// all features. A box whose minimum longitude exceeds its maximum crosses the
+	// antimeridian.
+	BBox *orb.Bound
+	// Where is a CQL2 text filter on the properties, as for WithWhere, empty to keep
+	// all features.
+	Where string
+	// Properties keeps the features whose properties equal the given values.
+	Properties map[string]any
+	// Offset is the number of matching features skipped, and Limit the largest number
+	// returned, 10 when 0.
+	Offset, Limit int
+}
+
+// Items returns the features selected by query, numbered by their row in the file,
+// and whether more features match after them.
+func (s *FeatureServer) Items(ctx context.Context, query ItemsQuery) ([]*geojson.Feature, bool, error) {
+	if query.Limit <= 0 {
+		query.Limit = defaultItemsLimit
+	}
+	var bounds []orb.Bound
+	if query.BBox != nil {
+		bounds = splitBound(*query.BBox)
+	}
+	var filter filterExpr
+	if query.Where != "" {
+		var err error
+		if filter, err = parseFilter(query.Where); err != nil {
+			return nil, false, err
+		}
+	}
+	matches := func(feature *geojson.Feature) bool {
+		if len(bounds) > 0 {
+			if feature.Geometry == nil || countPositions(feature.Geometry) == 0 {
+				return false
+			}
+			intersects := false
+			for _, bound := range bounds {
+				intersects = intersects || intersectsBound(feature.Geometry, bound, true)
+			}
+			if !intersects {
+				return false
+			}
+		}
+		for name, value := range query.Properties {
+			if c, ok := compareFilterValues(feature.Properties[name], value); !ok || c != 0 {
+				return false
+			}
+		}
+		return filter == nil || filter.eval(feature.Properties) == truthTrue
+	}
+
+	var features []*geojson.Feature
+	skipped := 0
+	for i, rowGroup := range s.pf.RowGroups() {
+		if s.covering != nil && len(bounds) > 0 && s.disjoint(i, bounds) {
+			continue
+		}
+		rows := fileRows(s.pf, s.geoMeta)
+		rows.rowGroups = []parquet.RowGroup{rowGroup}
+		// Features are identified by their row, so the id column stays a property
+		rows.decoder.idColumn = ""
+		reader := withContext(ctx, rows)
+		for row := s.offsets[i]; ; row++ {
+			feature, err := reader.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				rows.Close()
+				return nil, false, err
+			}
+			if !matches(feature) {
+				continue
+			}
+			if skipped < query.Offset {
+				skipped++
+				continue
+			}
+			if len(features) == query.Limit {
+				rows.Close()
+				return features, true, nil
+			}
+			feature.ID = row
+			features = append(features, feature)
+		}
+		rows.Close()
+	}
+	return features, false, nil
+}
+
+// disjoint checks from the statistics of the bbox covering columns whether no row of a
+// row group can intersect any of bounds
+func (s *FeatureServer) disjoint(rowGroup int, bounds []orb.Bound) bool {
+	for _, bound := range bounds {
+		if !s.covering.disjoint(s.pf.Metadata().RowGroups[rowGroup], bound) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitBound returns a bounding box of longitudes and latitudes crossing the
+// antimeridian, whose minimum longitude exceeds its maximum, as the boxes on either side
+func splitBound(bound orb.Bound) []orb.Bound {
+	if bound.Min[0] <= bound.Max[0] {
+		return []orb.Bound{bound}
+	}
+	return []orb.Bound{
+		{Min: bound.Min, Max: orb.Point{180, bound.Max[1]}},
+		{Min: orb.Point{-180, bound.Min[1]}, Max: bound.Max},
+	}
+}
+
+// Item returns the feature of a row of the file, nil if there is no such row.
+func (s *FeatureServer) Item(row int64) (*geojson.Feature, error) {
+	for i, rowGroup := range s.pf.RowGroups() {
+		if row < s.offsets[i] || row >= s.offsets[i]+rowGroup.NumRows() {
+			continue
+		}
+		rows := rowGroup.Rows()
+		defer rows.Close()
+		if err := rows.SeekToRow(row - s.offsets[i]); err != nil {
+			return nil, err
+		}
+		buffer := make([]parquet.Row, 1)
+		if n, err := rows.ReadRows(buffer); n == 0 {
+			return nil, err
+		}
+		decoder := newRowDecoder(s.pf, s.geoMeta)
+		decoder.idColumn = ""
+		feature, err := decoder.decode(buffer[0])
+		if err != nil {
+			return nil, err
+		}
+		feature.ID = row
+		return feature, nil
+	}
+	return nil, nil
+}
+
+// baseURL returns the URL of the landing page of the service for a request
+func baseURL(req *http.Request) string {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + req.Host
+}
+
+func (s *FeatureServer) serveLandingPage(w http.ResponseWriter, req *http.Request) {
+	base := baseURL(req)
+	writeJSON(w, http.StatusOK, "application/json", map[string]any{
+		"title":       s.options.Title,
+		"description": "OGC API Features service of a GeoParquet file",
+		"links": []ogcLink{
+			{Href: base + "/", Rel: "self", Type: "application/json"},
+			{Href: base + "/conformance", Rel: "conformance", Type: "application/json"},
+			{Href: base + "/collections", Rel: "data", Type: "application/json"},
+		},
+	})
+}
+
+func (s *FeatureServer) serveConformance(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, "application/json", map[string]any{"conformsTo": ogcConformance})
+}
+
+func (s *FeatureServer) serveCollections(w http.ResponseWriter, req *http.Request) {
+	base := baseURL(req)
+	writeJSON(w, http.StatusOK, "application/json", map[string]any{
+		"links":       []ogcLink{{Href: base + "/collections", Rel: "self", Type: "application/json"}},
+		"collections": []any{s.collection(base)},
+	})
+}
+
+func (s *FeatureServer) serveCollection(w http.ResponseWriter, req *http.Request) {
+	if req.PathValue("collection") != s.options.Collection {
+		writeOGCError(w, http.StatusNotFound, "NotFound", fmt.Sprintf("no collection %q", req.PathValue("collection")))
+		return
+	}
+	writeJSON(w, http.StatusOK, "application/json", s.collection(baseURL(req)))
+}
+
+// collection describes the collection of the features
+func (s *FeatureServer) collection(base string) map[string]any {
+	href := base + "/collections/" + url.PathEscape(s.options.Collection)
+	collection := map[string]any{
+		"id":       s.options.Collection,
+		"title":    s.options.Title,
+		"itemType": "feature",
+		"crs":      []string{crs84},
+		"links": []ogcLink{
+			{Href: href, Rel: "self", Type: "application/json"},
+			{Href: href + "/items", Rel: "items", Type: geoJSONContentType},
+		},
+	}
+	if bbox := s.geoMeta.Columns[s.geoMeta.PrimaryColumn].BBox; len(bbox) >= 4 {
+		half := len(bbox) / 2
+		collection["extent"] = map[string]any{
+			"spatial": map[string]any{
+				"bbox": [][]float64{{bbox[0], bbox[1], bbox[half], bbox[half+1]}},
+				"crs":  crs84,
+			},
+		}
+	}
+	return collection
+}
+
+// ogcItems is a page of the features of a collection
+type ogcItems struct {
+	Type           string           `json:"type"`
+	Features       []geoJSONFeature `json:"features"`
+	Links          []ogcLink        `json:"links"`
+	NumberReturned int              `json:"numberReturned"`
+	TimeStamp      string           `json:"timeStamp"`
+}
+
+func (s *FeatureServer) serveItems(w http.ResponseWriter, req *http.Request) {
+	if req.PathValue("collection") != s.options.Collection {
+		writeOGCError(w, http.StatusNotFound, "NotFound", fmt.Sprintf("no collection %q", req.PathValue("collection")))
+		return
+	}
+	query, err := s.itemsQuery(req.URL.Query())
+	if err != nil {
+		writeOGCError(w, http.StatusBadRequest, "InvalidParameterValue", err.Error())
+		return
+	}
+	features, more, err := s.Items(req.Context(), query)
+	if err != nil {
+		writeOGCError(w, http.StatusInternalServerError, "ServerError", err.Error())
+		return
+	}
+
+	items := ogcItems{
+		Type:           "FeatureCollection",
+		Features:       make([]geoJSONFeature, len(features)),
+		NumberReturned: len(features),
+		TimeStamp:      time.Now().UTC().Format(time.RFC3339),
+	}
+	for i, feature := range features {
+		items.Features[i] = geoJSONFeature{feature}
+	}
+	page := func(rel string, offset int) ogcLink {
+		parameters := req.URL.Query()
+		parameters.Set("offset", strconv.Itoa(offset))
+		parameters.Set("limit", strconv.Itoa(query.Limit))
+		return ogcLink{Href: baseURL(req) + req.URL.Path + "?" + parameters.Encode(), Rel: rel, Type: geoJSONContentType}
+	}
+	items.Links = append(items.Links, ogcLink{Href: baseURL(req) + req.URL.RequestURI(), Rel: "self", Type: geoJSONContentType})
+	if query.Offset > 0 {
+		items.Links = append(items.Links, page("prev", max(query.Offset-query.Limit, 0)))
+	}
+	if more {
+		items.Links = append(items.Links, page("next", query.Offset+query.Limit))
+	}
+	writeJSON(w, http.StatusOK, geoJSONContentType, items)
+}
+
+// itemsQuery parses the parameters of a request for items. Unknown parameters are
+// rejected, as the standard requires.
+func (s *FeatureServer) itemsQuery(parameters url.Values) (ItemsQuery, error) {
+	query := ItemsQuery{Limit: defaultItemsLimit, Properties: make(map[string]any)}
+	for name, values := range parameters {
+		value := values[0]
+		switch name {
+		case "limit":
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 1 {
+				return query, fmt.Errorf("invalid limit %q, expected a positive integer", value)
+			}
+			query.Limit = min(limit, maxItemsLimit)
+		case "offset":
+			offset, err := strconv.Atoi(value)
+			if err != nil || offset < 0 {
+				return query, fmt.Errorf("invalid offset %q, expected a non-negative integer", value)
+			}
+			query.Offset = offset
+		case "bbox":
+			bound, err := parseOGCBBox(value)
+			if err != nil {
+				return query, err
+			}
+			query.BBox = &bound
+		case "filter":
+			if _, err := parseFilter(value); err != nil {
+				return query, err
+			}
+			query.Where = value
+		case "filter-lang":
+			if value != "cql2-text" {
+				return query, fmt.Errorf("unsupported filter language %q, expected cql2-text", value)
+			}
+		case "f":
+			if value != "json" && value != "geojson" {
+				return query, fmt.Errorf("unsupported format %q, expected json", value)
+			}
+		default:
+			kind, ok := s.fields[name]
+			if !ok {
+				return query, fmt.Errorf("unknown parameter %q", name)
+			}
+			literal, err := propertyLiteral(value, kind)
+			if err != nil {
+				return query, fmt.Errorf("invalid value %q of property %q: %w", value, name, err)
+			}
+			query.Properties[name] = literal
+		}
+	}
+	return query, nil
+}
+
+// parseOGCBBox parses a bbox parameter of four or six numbers, whose minimum longitude
+// exceeds the maximum for a box crossing the antimeridian
+func parseOGCBBox(value string) (orb.Bound, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 && len(parts) != 6 {
+		return orb.Bound{}, fmt.Errorf("invalid bbox %q, expected minx,miny,maxx,maxy", value)
+	}
+	numbers := make([]float64, len(parts))
+	for i, part := range parts {
+		number, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return orb.Bound{}, fmt.Errorf("invalid bbox %q, expected minx,miny,maxx,maxy", value)
+		}
+		numbers[i] = number
+	}
+	// Drop the heights of a box of six numbers
+	half := len(numbers) / 2
+	bound := orb.Bound{Min: orb.Point{numbers[0], numbers[1]}, Max: orb.Point{numbers[half], numbers[half+1]}}
+	if bound.Min[1] > bound.Max[1] {
+		return orb.Bound{}, fmt.Errorf("invalid bbox %q, the minimum latitude exceeds the maximum", value)
+	}
+	return bound, nil
+}
+
+// propertyLiteral parses the value of a property parameter as a value of the type of
+// the property column
+func propertyLiteral(value, kind string) (any, error) {
+	switch kind {
+	case "Boolean":
+		return strconv.ParseBool(value)
+	case "Number":
+		return strconv.ParseFloat(value, 64)
+	}
+	return value, nil
+}
+
+func (s *FeatureServer) serveItem(w http.ResponseWriter, req *http.Request) {
+	if req.PathValue("collection") != s.options.Collection {
+		writeOGCError(w, http.StatusNotFound, "NotFound", fmt.Sprintf("no collection %q", req.PathValue("collection")))
+		return
+	}
+	row, err := strconv.ParseInt(req.PathValue("feature"), 10, 64)
+	var feature *geojson.Feature
+	if err == nil {
+		if feature, err = s.Item(row); err != nil {
+			writeOGCError(w, http.StatusInternalServerError, "ServerError", err.Error())
+			return
+		}
+	}
+	if feature == nil {
+		writeOGCError(w, http.StatusNotFound, "NotFound", fmt.Sprintf("no feature %q", req.PathValue("feature")))
+		return
+	}
+
+	// Add the links to the members of the feature
+	data, err := json.Marshal(geoJSONFeature{feature})
+	if err != nil {
+		writeOGCError(w, http.StatusInternalServerError, "ServerError", err.Error())
+		return
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		writeOGCError(w, http.StatusInternalServerError, "ServerError", err.Error())
+		return
+	}
+	collection := baseURL(req) + "/collections/" + url.PathEscape(s.options.Collection)
+	members["links"], _ = json.Marshal([]ogcLink{
+		{Href: baseURL(req) + req.URL.Path, Rel: "self", Type: geoJSONContentType},
+		{Href: collection, Rel: "collection", Type: "application/json"},
+	})
+	writeJSON(w, http.StatusOK, geoJSONContentType, members)
+}
+
+// writeJSON writes a response of the given status and content type encoding value
+func writeJSON(w http.ResponseWriter, status int, contentType string, value any) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeOGCError writes an exception of OGC API Features
+func writeOGCError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, "application/json", map[string]string{"code": code, "description": description})
+}
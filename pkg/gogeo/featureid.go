@@ -0,0 +1,74 @@
+package gogeo
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/paulmach/orb/geojson"
+)
+
+// DefaultIDColumn is the column holding the feature ids unless set with WithIDColumn.
+const DefaultIDColumn = "feature_id"
+
+// IDMetadataKey is the key of the Parquet key-value metadata naming the column that
+// holds the feature ids, so that reading the file back restores them as ids rather
+// than properties.
+const IDMetadataKey = "gogeo.id"
+
+// WithIDColumn sets the column holding the ids of the features, DefaultIDColumn by
+// default. The column is written like a property when any feature has an id, and its
+// name is recorded in the IDMetadataKey metadata of the file. A feature with both an
+// id and a property of that name is an error unless they are equal. An empty name
+// drops the ids.
+func WithIDColumn(name string) Option {
+	return func(cfg *config) {
+		cfg.idColumn = name
+	}
+}
+
+// idReader adds the id of each feature to its properties, under the id column
+type idReader struct {
+	reader FeatureReader
+	column string
+	count  int
+}
+
+func (r *idReader) Next() (*geojson.Feature, error) {
+	feature, err := r.reader.Next()
+	if err != nil {
+		return nil, err
+	}
+	r.count++
+	if feature.ID == nil {
+		return feature, nil
+	}
+	if value, ok := feature.Properties[r.column]; ok {
+		if !reflect.DeepEqual(value, feature.ID) {
+			return nil, AppError{Message: fmt.Sprintf("feature %d has the id %v and a %q property %v, set another id column", r.count, feature.ID, r.column, value)}
+		}
+		return feature, nil
+	}
+	// Copy the feature, which buffered inputs read more than once
+	identified := *feature
+	identified.Properties = maps.Clone(feature.Properties)
+	if identified.Properties == nil {
+		identified.Properties = make(geojson.Properties)
+	}
+	identified.Properties[r.column] = feature.ID
+	return &identified, nil
+}
+
+// readIDColumn returns the column holding the feature ids of a Parquet file, empty
+// if it has none
+func readIDColumn(pf *parquet.File) string {
+	name, ok := pf.Lookup(IDMetadataKey)
+	if !ok {
+		return ""
+	}
+	if _, ok := pf.Schema().Lookup(name); !ok {
+		return ""
+	}
+	return name
+}
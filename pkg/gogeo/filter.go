@@ -0,0 +1,552 @@
+package gogeo
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/paulmach/orb/geojson"
+)
+
+// truth is the result of a filter predicate in three-valued logic: comparisons with a
+// null or missing property, or between values of different types, are unknown
+type truth int8
+
+const (
+	truthFalse truth = iota
+	truthTrue
+	truthUnknown
+)
+
+func (t truth) not() truth {
+	switch t {
+	case truthTrue:
+		return truthFalse
+	case truthFalse:
+		return truthTrue
+	}
+	return truthUnknown
+}
+
+// filterExpr is a parsed filter evaluated against the properties of a feature
+type filterExpr interface {
+	eval(properties geojson.Properties) truth
+}
+
+// filterOperand is a property or a literal of a filter
+type filterOperand interface {
+	value(properties geojson.Properties) any
+}
+
+type propertyOperand string
+
+func (p propertyOperand) value(properties geojson.Properties) any {
+	return properties[string(p)]
+}
+
+type literalOperand struct {
+	literal any
+}
+
+func (l literalOperand) value(geojson.Properties) any {
+	return l.literal
+}
+
+// logicalExpr combines two predicates with AND or OR
+type logicalExpr struct {
+	and         bool
+	left, right filterExpr
+}
+
+func (e *logicalExpr) eval(properties geojson.Properties) truth {
+	left := e.left.eval(properties)
+	if e.and && left == truthFalse || !e.and && left == truthTrue {
+		return left
+	}
+	right := e.right.eval(properties)
+	switch {
+	case left == right:
+		return left
+	case e.and && right == truthFalse, !e.and && right == truthTrue:
+		return right
+	default:
+		return truthUnknown
+	}
+}
+
+type notExpr struct {
+	expr filterExpr
+}
+
+func (e *notExpr) eval(properties geojson.Properties) truth {
+	return e.expr.eval(properties).not()
+}
+
+// compareExpr compares two operands with =, <>, <, <=, > or >=
+type compareExpr struct {
+	op          string
+	left, right filterOperand
+}
+
+func (e *compareExpr) eval(properties geojson.Properties) truth {
+	c, ok := compareFilterValues(e.left.value(properties), e.right.value(properties))
+	if !ok {
+		return truthUnknown
+	}
+	var result bool
+	switch e.op {
+	case "=":
+		result = c == 0
+	case "<>":
+		result = c != 0
+	case "<":
+		result = c < 0
+	case "<=":
+		result = c <= 0
+	case ">":
+		result = c > 0
+	case ">=":
+		result = c >= 0
+	}
+	if result {
+		return truthTrue
+	}
+	return truthFalse
+}
+
+// betweenExpr checks that an operand is within two bounds, inclusive
+type betweenExpr struct {
+	operand, low, high filterOperand
+}
+
+func (e *betweenExpr) eval(properties geojson.Properties) truth {
+	return (&logicalExpr{
+		and:   true,
+		left:  &compareExpr{op: ">=", left: e.operand, right: e.low},
+		right: &compareExpr{op: "<=", left: e.operand, right: e.high},
+	}).eval(properties)
+}
+
+// inExpr checks that an operand equals one of a list
+type inExpr struct {
+	operand filterOperand
+	list    []filterOperand
+}
+
+func (e *inExpr) eval(properties geojson.Properties) truth {
+	result := truthFalse
+	for _, item := range e.list {
+		switch (&compareExpr{op: "=", left: e.operand, right: item}).eval(properties) {
+		case truthTrue:
+			return truthTrue
+		case truthUnknown:
+			result = truthUnknown
+		}
+	}
+	return result
+}
+
+// likeExpr matches a string operand against a pattern where % matches any sequence of
+// characters and _ any single character
+type likeExpr struct {
+	operand filterOperand
+	pattern *regexp.Regexp
+}
+
+func (e *likeExpr) eval(properties geojson.Properties) truth {
+	value, ok := e.operand.value(properties).(string)
+	if !ok {
+		return truthUnknown
+	}
+	if e.pattern.MatchString(value) {
+		return truthTrue
+	}
+	return truthFalse
+}
+
+// nullExpr checks whether an operand is null or missing
+type nullExpr struct {
+	operand filterOperand
+}
+
+func (e *nullExpr) eval(properties geojson.Properties) truth {
+	if e.operand.value(properties) == nil {
+		return truthTrue
+	}
+	return truthFalse
+}
+
+// booleanExpr uses a boolean operand as a predicate
+type booleanExpr struct {
+	operand filterOperand
+}
+
+func (e *booleanExpr) eval(properties geojson.Properties) truth {
+	switch value := e.operand.value(properties).(type) {
+	case bool:
+		if value {
+			return truthTrue
+		}
+		return truthFalse
+	default:
+		return truthUnknown
+	}
+}
+
+// compareFilterValues orders two values of the same type: numbers, strings or booleans
+func compareFilterValues(a, b any) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return cmp.Compare(x, y), ok
+	}
+	switch a := a.(type) {
+	case string:
+		b, ok := b.(string)
+		return strings.Compare(a, b), ok
+	case bool:
+		if _, ok := b.(bool); !ok {
+			return 0, false
+		}
+		return compareValues(a, b), true
+	}
+	return 0, false
+}
+
+// Kinds of filter tokens
+const (
+	tokenEnd = iota
+	tokenWord
+	tokenIdentifier
+	tokenString
+	tokenNumber
+	tokenSymbol
+)
+
+type filterToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+// parseFilter parses a CQL2 text style filter such as
+// "population > 10000 AND country = 'US'"
+func parseFilter(expr string) (filterExpr, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, AppError{Message: fmt.Sprintf("invalid filter %q", expr), Value: err}
+	}
+	p := &filterParser{tokens: tokens}
+	parsed, err := p.or()
+	if err == nil && p.peek().kind != tokenEnd {
+		err = p.unexpected()
+	}
+	if err != nil {
+		return nil, AppError{Message: fmt.Sprintf("invalid filter %q", expr), Value: err}
+	}
+	return parsed, nil
+}
+
+// tokenizeFilter splits a filter into words, "quoted" identifiers, 'quoted' strings,
+// numbers and symbols
+func tokenizeFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'' || r == '"':
+			var text strings.Builder
+			start := i
+			for i++; ; i++ {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("unterminated quote at position %d", start+1)
+				}
+				if runes[i] == r {
+					// A doubled quote stands for the quote itself
+					if i+1 < len(runes) && runes[i+1] == r {
+						i++
+					} else {
+						break
+					}
+				}
+				text.WriteRune(runes[i])
+			}
+			i++
+			kind := tokenString
+			if r == '"' {
+				kind = tokenIdentifier
+			}
+			tokens = append(tokens, filterToken{kind: kind, text: text.String(), pos: start})
+		case unicode.IsDigit(r) || (r == '-' || r == '.') && i+1 < len(runes) && (unicode.IsDigit(runes[i+1]) || runes[i+1] == '.'):
+			start := i
+			for i++; i < len(runes) && (unicode.IsDigit(runes[i]) || strings.ContainsRune(".eE", runes[i]) ||
+				(runes[i] == '-' || runes[i] == '+') && (runes[i-1] == 'e' || runes[i-1] == 'E')); i++ {
+			}
+			tokens = append(tokens, filterToken{kind: tokenNumber, text: string(runes[start:i]), pos: start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i++; i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || strings.ContainsRune("_.:", runes[i])); i++ {
+			}
+			tokens = append(tokens, filterToken{kind: tokenWord, text: string(runes[start:i]), pos: start})
+		default:
+			start := i
+			text := string(r)
+			if i+1 < len(runes) {
+				switch pair := string(runes[i : i+2]); pair {
+				case "<=", ">=", "<>", "!=":
+					text = pair
+				}
+			}
+			if !strings.Contains("=<>!(),", text[:1]) || text == "!" {
+				return nil, fmt.Errorf("unexpected %q at position %d", text, start+1)
+			}
+			if text == "!=" {
+				text = "<>"
+			}
+			i += len([]rune(text))
+			tokens = append(tokens, filterToken{kind: tokenSymbol, text: text, pos: start})
+		}
+	}
+	return append(tokens, filterToken{kind: tokenEnd, pos: len(runes)}), nil
+}
+
+// filterParser parses filter tokens by recursive descent, NOT binding tighter than
+// AND and AND tighter than OR
+type filterParser struct {
+	tokens []filterToken
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[0]
+}
+
+func (p *filterParser) next() filterToken {
+	token := p.tokens[0]
+	if token.kind != tokenEnd {
+		p.tokens = p.tokens[1:]
+	}
+	return token
+}
+
+// keyword consumes the next token if it is the given keyword
+func (p *filterParser) keyword(word string) bool {
+	if token := p.peek(); token.kind == tokenWord && strings.EqualFold(token.text, word) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// symbol consumes the next token if it is the given symbol
+func (p *filterParser) symbol(symbol string) bool {
+	if token := p.peek(); token.kind == tokenSymbol && token.text == symbol {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) unexpected() error {
+	token := p.peek()
+	if token.kind == tokenEnd {
+		return fmt.Errorf("unexpected end of filter")
+	}
+	return fmt.Errorf("unexpected %q at position %d", token.text, token.pos+1)
+}
+
+func (p *filterParser) or() (filterExpr, error) {
+	left, err := p.and()
+	for err == nil && p.keyword("OR") {
+		var right filterExpr
+		if right, err = p.and(); err == nil {
+			left = &logicalExpr{left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) and() (filterExpr, error) {
+	left, err := p.not()
+	for err == nil && p.keyword("AND") {
+		var right filterExpr
+		if right, err = p.not(); err == nil {
+			left = &logicalExpr{and: true, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) not() (filterExpr, error) {
+	if p.keyword("NOT") {
+		expr, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{expr}, nil
+	}
+	return p.predicate()
+}
+
+func (p *filterParser) predicate() (filterExpr, error) {
+	if p.symbol("(") {
+		expr, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.symbol(")") {
+			return nil, p.unexpected()
+		}
+		return expr, nil
+	}
+
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	if token := p.peek(); token.kind == tokenSymbol && strings.Contains("= <> < <= > >=", token.text) {
+		p.next()
+		right, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return &compareExpr{op: token.text, left: left, right: right}, nil
+	}
+	if p.keyword("IS") {
+		negate := p.keyword("NOT")
+		if !p.keyword("NULL") {
+			return nil, p.unexpected()
+		}
+		return negated(&nullExpr{left}, negate), nil
+	}
+
+	negate := p.keyword("NOT")
+	switch {
+	case p.keyword("LIKE"):
+		token := p.next()
+		if token.kind != tokenString {
+			return nil, fmt.Errorf("LIKE expects a 'quoted' pattern at position %d", token.pos+1)
+		}
+		return negated(&likeExpr{operand: left, pattern: likePattern(token.text)}, negate), nil
+	case p.keyword("BETWEEN"):
+		low, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword("AND") {
+			return nil, p.unexpected()
+		}
+		high, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return negated(&betweenExpr{operand: left, low: low, high: high}, negate), nil
+	case p.keyword("IN"):
+		if !p.symbol("(") {
+			return nil, p.unexpected()
+		}
+		in := &inExpr{operand: left}
+		for {
+			item, err := p.operand()
+			if err != nil {
+				return nil, err
+			}
+			in.list = append(in.list, item)
+			if p.symbol(")") {
+				return negated(in, negate), nil
+			}
+			if !p.symbol(",") {
+				return nil, p.unexpected()
+			}
+		}
+	case negate:
+		return nil, p.unexpected()
+	}
+	return &booleanExpr{left}, nil
+}
+
+// operand parses a property name or a literal
+func (p *filterParser) operand() (filterOperand, error) {
+	token := p.peek()
+	switch token.kind {
+	case tokenIdentifier:
+		p.next()
+		return propertyOperand(token.text), nil
+	case tokenString:
+		p.next()
+		return literalOperand{token.text}, nil
+	case tokenNumber:
+		p.next()
+		number, err := strconv.ParseFloat(token.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", token.text, token.pos+1)
+		}
+		return literalOperand{number}, nil
+	case tokenWord:
+		switch strings.ToUpper(token.text) {
+		case "TRUE", "FALSE":
+			p.next()
+			return literalOperand{strings.EqualFold(token.text, "TRUE")}, nil
+		case "NULL":
+			p.next()
+			return literalOperand{nil}, nil
+		case "AND", "OR", "NOT", "IS", "LIKE", "BETWEEN", "IN":
+			return nil, p.unexpected()
+		}
+		p.next()
+		return propertyOperand(token.text), nil
+	}
+	return nil, p.unexpected()
+}
+
+// negated wraps expr in NOT when negate is set
+func negated(expr filterExpr, negate bool) filterExpr {
+	if negate {
+		return &notExpr{expr}
+	}
+	return expr
+}
+
+// likePattern compiles a LIKE pattern to an anchored regular expression
+func likePattern(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("(?s)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			expr.WriteString(".*")
+		case '_':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
+
+// filterReader returns the features of reader matching a filter
+type filterReader struct {
+	reader FeatureReader
+	filter filterExpr
+}
+
+func (r *filterReader) Next() (*geojson.Feature, error) {
+	for {
+		feature, err := r.reader.Next()
+		if err != nil {
+			return nil, err
+		}
+		if r.filter.eval(feature.Properties) == truthTrue {
+			return feature, nil
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package gogeo
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/paulmach/orb/geojson"
+)
+
+func TestParseFilter(t *testing.T) {
+	properties := geojson.Properties{
+		"population":  20000.0,
+		"n":           int64(5),
+		"country":     "US",
+		"name":        "O'Brien",
+		"region name": "North",
+		"tags.kind":   "x",
+		"active":      true,
+		"score":       nil,
+	}
+	tests := []struct {
+		expr string
+		want truth
+	}{
+		// Comparisons and literals
+		{"population > 10000", truthTrue},
+		{"population >= -5", truthTrue},
+		{"n = 5", truthTrue},
+		{"n = .5e1", truthTrue},
+		{"n != 5", truthFalse},
+		{"n <> 4", truthTrue},
+		{"country = 'US'", truthTrue},
+		{"'US' = country", truthTrue},
+		{"active = TRUE", truthTrue},
+		{"active", truthTrue},
+		{"active = false", truthFalse},
+
+		// Precedence: NOT binds tighter than AND, and AND tighter than OR
+		{"country = 'US' OR population > 1e9 AND active = false", truthTrue},
+		{"(country = 'US' OR population > 1e9) AND active = false", truthFalse},
+		{"NOT country = 'FR' AND active = false", truthFalse},
+		{"NOT (country = 'FR' AND active = false)", truthTrue},
+		{"NOT NOT active", truthTrue},
+		{"country = 'US' and not active = false", truthTrue},
+
+		// Quoting
+		{"name = 'O''Brien'", truthTrue},
+		{`"region name" = 'North'`, truthTrue},
+		{`"country" = "country"`, truthTrue},
+		{"tags.kind = 'x'", truthTrue},
+		{"country = 'us'", truthFalse},
+
+		// Null and mismatched types are unknown, and only known results combine
+		{"score > 1", truthUnknown},
+		{"NOT score > 1", truthUnknown},
+		{"missing = 1", truthUnknown},
+		{"country > 1", truthUnknown},
+		{"country", truthUnknown},
+		{"score > 1 OR active", truthTrue},
+		{"score > 1 AND active", truthUnknown},
+		{"score > 1 AND active = false", truthFalse},
+		{"score IS NULL", truthTrue},
+		{"missing IS NULL", truthTrue},
+		{"score IS NOT NULL", truthFalse},
+		{"country = NULL", truthUnknown},
+
+		// LIKE, BETWEEN and IN
+		{"name LIKE 'O%'", truthTrue},
+		{"name LIKE 'O_Brien'", truthTrue},
+		{"name LIKE 'o%'", truthFalse},
+		{"name NOT LIKE '%n'", truthFalse},
+		{"country LIKE 'U.'", truthFalse},
+		{"n LIKE '5'", truthUnknown},
+		{"n BETWEEN 1 AND 5", truthTrue},
+		{"n NOT BETWEEN 1 AND 4", truthTrue},
+		{"n BETWEEN 1 AND 5 AND active", truthTrue},
+		{"country IN ('FR', 'US')", truthTrue},
+		{"country NOT IN ('FR')", truthTrue},
+		{"country IN ('FR', score)", truthUnknown},
+		{"country IN ('US', score)", truthTrue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			filter, err := parseFilter(tt.expr)
+			if err != nil {
+				t.Fatalf("parseFilter() error = %v", err)
+			}
+			if got := filter.eval(properties); got != tt.want {
+				t.Errorf("eval() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{"", "unexpected end of filter"},
+		{"name = 'abc", "unterminated quote at position 8"},
+		{`"name = 'abc'`, "unterminated quote at position 1"},
+		{"n > 1 AND", "unexpected end of filter"},
+		{"(n > 1", "unexpected end of filter"},
+		{"n > 1)", `unexpected ")" at position 6`},
+		{"n > 1 n < 2", `unexpected "n" at position 7`},
+		{"n # 1", `unexpected "#" at position 3`},
+		{"n ! 1", `unexpected "!" at position 3`},
+		{"AND n = 1", `unexpected "AND" at position 1`},
+		{"n = 1e", `invalid number "1e" at position 5`},
+		{"n IS 1", `unexpected "1" at position 6`},
+		{"n NOT = 1", `unexpected "=" at position 7`},
+		{"name LIKE pattern", "LIKE expects a 'quoted' pattern at position 11"},
+		{"n BETWEEN 1 5", `unexpected "5" at position 13`},
+		{"n IN 1", `unexpected "1" at position 6`},
+		{"n IN (1 2)", `unexpected "2" at position 9`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := parseFilter(tt.expr)
+			if err == nil {
+				t.Fatal("parseFilter() succeeded")
+			}
+			want := fmt.Sprintf("invalid filter %q: %s", tt.expr, tt.wantErr)
+			if !strings.HasPrefix(err.Error(), want) {
+				t.Errorf("parseFilter() error = %v, want %s", err, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package gogeo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"maps"
+	"path"
+	"strings"
+
+	"github.com/paulmach/orb/geojson"
+)
+
+// Feature formats read and written by the converter
+const (
+	// FormatGeoJSON is a GeoJSON FeatureCollection.
+	FormatGeoJSON = "geojson"
+	// FormatGeoJSONL is newline-delimited GeoJSON with one Feature per line.
+	FormatGeoJSONL = "geojsonl"
+	// FormatGeoPackage is a layer of a GeoPackage (.gpkg) database. It can only be read.
+	FormatGeoPackage = "gpkg"
+	// FormatKML is a KML document whose Placemarks are the features. It can only be read.
+	FormatKML = "kml"
+	// FormatKMZ is a zipped KML document. It can only be read.
+	FormatKMZ = "kmz"
+	// FormatCSV is a CSV file with a header line and point or WKT geometry columns. It can only be read.
+	FormatCSV = "csv"
+	// FormatGML is a GML document such as a WFS GetFeature response. It can only be read.
+	FormatGML = "gml"
+	// FormatOSMPBF is an OpenStreetMap PBF extract whose tagged nodes and ways are the
+	// features. It can only be read.
+	FormatOSMPBF = "pbf"
+)
+
+// formatExtensions maps file extensions to feature formats
+var formatExtensions = map[string]string{
+	".geojson":    FormatGeoJSON,
+	".json":       FormatGeoJSON,
+	".geojsonl":   FormatGeoJSONL,
+	".geojsons":   FormatGeoJSONL,
+	".geojsonseq": FormatGeoJSONL,
+	".ndjson":     FormatGeoJSONL,
+	".jsonl":      FormatGeoJSONL,
+	".gpkg":       FormatGeoPackage,
+	".kml":        FormatKML,
+	".kmz":        FormatKMZ,
+	".csv":        FormatCSV,
+	".gml":        FormatGML,
+	".pbf":        FormatOSMPBF,
+}
+
+// FormatFromPath returns the feature format of a path or URI based on its extension,
+// or an empty string if the extension is not recognized.
+func FormatFromPath(filePath string) string {
+	// Query strings of URLs are not part of the extension
+	filePath, _, _ = strings.Cut(filePath, "?")
+	return formatExtensions[strings.ToLower(path.Ext(filePath))]
+}
+
+// normalizeFormat returns the canonical name of a feature format
+func normalizeFormat(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case FormatGeoJSON:
+		return FormatGeoJSON, nil
+	case FormatGeoJSONL, "geojsonseq", "ndjson":
+		return FormatGeoJSONL, nil
+	case FormatGeoPackage, "geopackage":
+		return FormatGeoPackage, nil
+	case FormatKML, FormatKMZ, FormatCSV, FormatGML:
+		return strings.ToLower(format), nil
+	case FormatOSMPBF, "osm.pbf", "osmpbf":
+		return FormatOSMPBF, nil
+	default:
+		return "", AppError{Message: fmt.Sprintf("unsupported format %q, expected geojson, geojsonl, gpkg, kml, kmz, csv, gml or pbf", format)}
+	}
+}
+
+// newFeatureReader creates a streaming FeatureReader for input in the configured format.
+// The CRS declared by a GeoPackage layer or GML geometries replaces the default unless
+// one was set explicitly.
+func newFeatureReader(r io.Reader, cfg *config) (FeatureReader, error) {
+	switch cfg.inputFormat {
+	case FormatGeoJSONL:
+		return NewGeoJSONSeqDecoder(r), nil
+	case FormatGeoPackage:
+		source, size, err := randomAccess(r)
+		if err != nil {
+			return nil, AppError{Message: "failed to read GeoPackage", Value: err}
+		}
+		reader, err := NewGeoPackageReader(source, size, cfg.layer)
+		if err != nil {
+			return nil, err
+		}
+		return &inputCRS{reader, cfg}, nil
+	case FormatKML:
+		return NewKMLDecoder(r), nil
+	case FormatKMZ:
+		source, size, err := randomAccess(r)
+		if err != nil {
+			return nil, AppError{Message: "failed to read KMZ archive", Value: err}
+		}
+		return NewKMZDecoder(source, size)
+	case FormatCSV:
+		return NewCSVReader(r, cfg.csvGeometry)
+	case FormatGML:
+		return &inputCRS{NewGMLDecoder(r), cfg}, nil
+	case FormatOSMPBF:
+		source, size, err := randomAccess(r)
+		if err != nil {
+			return nil, AppError{Message: "failed to read OSM PBF file", Value: err}
+		}
+		return NewOSMReader(source, size, cfg.osmTags)
+	default:
+		return NewGeoJSONDecoder(r), nil
+	}
+}
+
+// crsFeatureReader is a FeatureReader of an input that declares its CRS
+type crsFeatureReader interface {
+	FeatureReader
+	CRS() json.RawMessage
+}
+
+// inputCRS applies the CRS declared by the input to cfg as soon as the reader knows it,
+// unless a CRS was set explicitly. The CRS is only written once all features are read.
+type inputCRS struct {
+	crsFeatureReader
+	cfg *config
+}
+
+func (r *inputCRS) Next() (*geojson.Feature, error) {
+	feature, err := r.crsFeatureReader.Next()
+	if crs := r.crsFeatureReader.CRS(); crs != nil && !r.cfg.crsSet {
+		r.cfg.crs = crs
+	}
+	return feature, err
+}
+
+// MarshalFeatures encodes features in the given format: a FeatureCollection for
+// FormatGeoJSON, or one Feature per line for FormatGeoJSONL, which downstream tools
+// can stream without parsing the whole document.
+func MarshalFeatures(fc *geojson.FeatureCollection, format string) ([]byte, error) {
+	format, err := normalizeFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case FormatGeoJSON:
+		// The members of the collection are sorted by name, as orb writes them
+		members := maps.Clone(fc.ExtraMembers)
+		if members == nil {
+			members = make(geojson.Properties)
+		}
+		members["type"] = "FeatureCollection"
+		delete(members, "bbox")
+		if fc.BBox != nil {
+			members["bbox"] = fc.BBox
+		}
+		features := make([]geoJSONFeature, len(fc.Features))
+		for i, feature := range fc.Features {
+			features[i] = geoJSONFeature{feature}
+		}
+		members["features"] = features
+		return json.Marshal(members)
+	case FormatGeoPackage, FormatKML, FormatKMZ, FormatCSV, FormatGML, FormatOSMPBF:
+		return nil, AppError{Message: fmt.Sprintf("writing %s is not supported, expected geojson or geojsonl", format)}
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	for _, feature := range fc.Features {
+		// Encode terminates each feature with a newline
+		if err := encoder.Encode(geoJSONFeature{feature}); err != nil {
+			return nil, fmt.Errorf("failed to encode feature: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteFeatures encodes the features of an iterator to w as they are read, in the
+// formats of MarshalFeatures, and returns the number of features written. Unlike
+// MarshalFeatures, it does not hold the features in memory, so that the iterator of
+// Features can convert files larger than memory. An error of the iterator stops the
+// encoding, leaving incomplete output.
+func WriteFeatures(w io.Writer, features iter.Seq2[*geojson.Feature, error], format string) (int, error) {
+	format, err := normalizeFormat(format)
+	if err != nil {
+		return 0, err
+	}
+	switch format {
+	case FormatGeoJSON, FormatGeoJSONL:
+	default:
+		return 0, AppError{Message: fmt.Sprintf("writing %s is not supported, expected geojson or geojsonl", format)}
+	}
+
+	buffered := bufio.NewWriter(w)
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	collection := format == FormatGeoJSON
+	if collection {
+		buffered.WriteString(`{"features":[`)
+	}
+	count := 0
+	for feature, err := range features {
+		if err != nil {
+			return count, err
+		}
+		// Encode terminates each feature with a newline, which separates the lines of
+		// FormatGeoJSONL and is dropped within a collection
+		encoded.Reset()
+		if err := encoder.Encode(geoJSONFeature{feature}); err != nil {
+			return count, fmt.Errorf("failed to encode feature: %w", err)
+		}
+		if collection {
+			if count > 0 {
+				buffered.WriteByte(',')
+			}
+			encoded.Truncate(encoded.Len() - 1)
+		}
+		buffered.Write(encoded.Bytes())
+		count++
+	}
+	if collection {
+		buffered.WriteString(`],"type":"FeatureCollection"}`)
+	}
+	return count, buffered.Flush()
+}
+
+// geoJSONFeature encodes a feature as GeoJSON, with empty properties written as {}
+// where orb writes null, which some readers reject
+type geoJSONFeature struct {
+	*geojson.Feature
+}
+
+func (f geoJSONFeature) MarshalJSON() ([]byte, error) {
+	feature := jsonFeature(f.Feature)
+	if len(feature.Properties) > 0 {
+		return feature.MarshalJSON()
+	}
+	if len(feature.ExtraMembers) > 0 {
+		// orb writes the members of such a feature sorted by name, as a map
+		data, err := feature.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(data, &members); err != nil {
+			return nil, err
+		}
+		members["properties"] = json.RawMessage("{}")
+		return json.Marshal(members)
+	}
+	return json.Marshal(struct {
+		ID         any                `json:"id,omitempty"`
+		Type       string             `json:"type"`
+		BBox       geojson.BBox       `json:"bbox,omitempty"`
+		Geometry   *geojson.Geometry  `json:"geometry"`
+		Properties geojson.Properties `json:"properties"`
+	}{feature.ID, "Feature", feature.BBox, geojson.NewGeometry(feature.Geometry), geojson.Properties{}})
+}
+
+// randomAccess returns random access to an input for formats that cannot be streamed,
+// such as GeoPackage, KMZ and OSM PBF. Files are read in place; other streams are buffered in memory.
+func randomAccess(r io.Reader) (io.ReaderAt, int64, error) {
+	if file, ok := r.(interface {
+		io.ReaderAt
+		Stat() (fs.FileInfo, error)
+	}); ok {
+		info, err := file.Stat()
+		if err != nil {
+			return nil, 0, err
+		}
+		return file, info.Size(), nil
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(data), int64(len(data)), nil
+}
@@ -0,0 +1,89 @@
+package gogeo
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+func TestMarshalFeaturesEmptyProperties(t *testing.T) {
+	withNull := geojson.NewFeature(nil)
+	withNull.ID = "a"
+	withExtra := geojson.NewFeature(orb.Point{1, 2})
+	withExtra.ExtraMembers = geojson.Properties{"title": "b"}
+	withProperties := geojson.NewFeature(orb.Point{1, 2})
+	withProperties.Properties["n"] = 1
+
+	tests := []struct {
+		name    string
+		feature *geojson.Feature
+		want    string
+	}{
+		{"null geometry", withNull, `{"id":"a","type":"Feature","geometry":null,"properties":{}}`},
+		{"extra members", withExtra, `{"geometry":{"type":"Point","coordinates":[1,2]},"properties":{},"title":"b","type":"Feature"}`},
+		{"properties", withProperties, `{"type":"Feature","geometry":{"type":"Point","coordinates":[1,2]},"properties":{"n":1}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc := geojson.NewFeatureCollection().Append(tt.feature)
+			data, err := MarshalFeatures(fc, FormatGeoJSONL)
+			if err != nil {
+				t.Fatalf("MarshalFeatures() error = %v", err)
+			}
+			if got := string(data); got != tt.want+"\n" {
+				t.Errorf("MarshalFeatures() = %s, want %s", got, tt.want)
+			}
+
+			data, err = MarshalFeatures(fc, FormatGeoJSON)
+			if err != nil {
+				t.Fatalf("MarshalFeatures() error = %v", err)
+			}
+			if got, want := string(data), `{"features":[`+tt.want+`],"type":"FeatureCollection"}`; got != want {
+				t.Errorf("MarshalFeatures() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestWriteFeatures(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	for i := range 3 {
+		feature := geojson.NewFeature(orb.Point{float64(i), 0})
+		feature.Properties["n"] = i
+		fc.Append(feature)
+	}
+	for _, format := range []string{FormatGeoJSON, FormatGeoJSONL} {
+		want, err := MarshalFeatures(fc, format)
+		if err != nil {
+			t.Fatalf("MarshalFeatures() error = %v", err)
+		}
+		var buf bytes.Buffer
+		count, err := WriteFeatures(&buf, func(yield func(*geojson.Feature, error) bool) {
+			for _, feature := range fc.Features {
+				if !yield(feature, nil) {
+					return
+				}
+			}
+		}, format)
+		if err != nil {
+			t.Fatalf("WriteFeatures() error = %v", err)
+		}
+		if count != 3 || buf.String() != string(want) {
+			t.Errorf("WriteFeatures(%s) wrote %d features: %s, want %s", format, count, buf.String(), want)
+		}
+	}
+
+	failing := func(yield func(*geojson.Feature, error) bool) {
+		yield(nil, errors.New("broken"))
+	}
+	if _, err := WriteFeatures(io.Discard, failing, FormatGeoJSON); err == nil {
+		t.Error("WriteFeatures() ignored the error of the iterator")
+	}
+	if _, err := WriteFeatures(io.Discard, failing, FormatCSV); err == nil {
+		t.Error("WriteFeatures() accepted csv")
+	}
+}
@@ -0,0 +1,403 @@
+package gogeo
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gcsChunkSize is the size of the chunks of a resumable upload; it must be a multiple
+// of 256 KiB. Objects smaller than one chunk are uploaded with a single request.
+const gcsChunkSize = 8 << 20
+
+// gcsScope is the OAuth scope requested for Cloud Storage
+const gcsScope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+// gcsMetadataTokenURL serves the access token of the default service account on GCE,
+// Cloud Run and GKE
+const gcsMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// GCSStore reads and writes objects in Google Cloud Storage, addressed as gs://bucket/object.
+type GCSStore struct {
+	client   *http.Client
+	endpoint string
+	// anonymous is set for emulators, which do not check credentials.
+	anonymous bool
+
+	mu    sync.Mutex
+	token string
+	// expiry is the time the cached token expires.
+	expiry time.Time
+}
+
+// NewGCSStore creates a GCSStore using Application Default Credentials: the
+// GOOGLE_OAUTH_ACCESS_TOKEN variable, the service account or user credentials file
+// named by GOOGLE_APPLICATION_CREDENTIALS (or written by "gcloud auth application-default
+// login"), or the metadata server on Google Cloud. STORAGE_EMULATOR_HOST selects an emulator.
+func NewGCSStore() *GCSStore {
+	store := &GCSStore{client: NewHTTPClient(), endpoint: "https://storage.googleapis.com"}
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+		store.endpoint = strings.TrimSuffix(host, "/")
+		store.anonymous = true
+	}
+	return store
+}
+
+// Open streams the object at a gs://bucket/object URI.
+func (s *GCSStore) Open(ctx context.Context, uri string) (io.ReadCloser, error) {
+	bucket, object, err := parseBucketURI(uri, "gs")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	objectURL := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", s.endpoint, url.PathEscape(bucket), url.PathEscape(object))
+	response, err := s.do(ctx, http.MethodGet, objectURL, nil)
+	if err != nil {
+		cancel()
+		return nil, AppError{Message: fmt.Sprintf("failed to read %s", uri), Value: err}
+	}
+	return newIdleTimeoutReader(response.Body, httpIdleTimeout, cancel), nil
+}
+
+// Create returns a writer uploading to the object at a gs://bucket/object URI. Data is
+// sent in chunks of a resumable upload as it is written and the object only appears once
+// Close succeeds.
+func (s *GCSStore) Create(ctx context.Context, uri string) (BlobWriter, error) {
+	bucket, object, err := parseBucketURI(uri, "gs")
+	if err != nil {
+		return nil, err
+	}
+	return &gcsWriter{store: s, ctx: ctx, uri: uri, bucket: bucket, object: object}, nil
+}
+
+// gcsWriter uploads an object to Cloud Storage as it is written
+type gcsWriter struct {
+	store  *GCSStore
+	ctx    context.Context
+	uri    string
+	bucket string
+	object string
+
+	buffer bytes.Buffer
+	// session is the URL of the resumable upload, once started.
+	session string
+	// offset is the number of bytes uploaded so far.
+	offset int64
+	err    error
+}
+
+// Write buffers p and uploads a chunk each time gcsChunkSize bytes are buffered.
+func (w *gcsWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	w.buffer.Write(p)
+	for w.buffer.Len() > gcsChunkSize {
+		if err := w.uploadChunk(w.buffer.Next(gcsChunkSize), false); err != nil {
+			w.err = err
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close uploads the remaining data and completes the object.
+func (w *gcsWriter) Close() error {
+	if w.err != nil {
+		w.Abort()
+		return w.err
+	}
+
+	// Small objects are written with a single request
+	if w.session == "" {
+		query := url.Values{"uploadType": {"media"}, "name": {w.object}}
+		uploadURL := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?%s", w.store.endpoint, url.PathEscape(w.bucket), query.Encode())
+		response, err := w.store.do(w.ctx, http.MethodPost, uploadURL, w.buffer.Bytes())
+		if err != nil {
+			return AppError{Message: fmt.Sprintf("failed to write %s", w.uri), Value: err}
+		}
+		return response.Body.Close()
+	}
+
+	if err := w.uploadChunk(w.buffer.Bytes(), true); err != nil {
+		w.Abort()
+		return err
+	}
+	return nil
+}
+
+// Abort cancels the resumable upload; nothing is written to the object.
+func (w *gcsWriter) Abort() error {
+	if w.err == nil {
+		w.err = AppError{Message: fmt.Sprintf("upload of %s was aborted", w.uri)}
+	}
+	if w.session == "" {
+		return nil
+	}
+
+	// GCS answers a cancelled upload with 499, which is not an error here
+	session := w.session
+	w.session = ""
+	request, err := http.NewRequestWithContext(context.WithoutCancel(w.ctx), http.MethodDelete, session, nil)
+	if err != nil {
+		return err
+	}
+	response, err := w.store.client.Do(request)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+// uploadChunk sends the next chunk of the resumable upload, starting it if needed.
+// The last chunk declares the total size, which completes the object.
+func (w *gcsWriter) uploadChunk(data []byte, last bool) error {
+	if w.session == "" {
+		session, err := w.startUpload()
+		if err != nil {
+			return AppError{Message: fmt.Sprintf("failed to start upload of %s", w.uri), Value: err}
+		}
+		w.session = session
+	}
+
+	total := "*"
+	if last {
+		total = fmt.Sprint(w.offset + int64(len(data)))
+	}
+	contentRange := fmt.Sprintf("bytes %d-%d/%s", w.offset, w.offset+int64(len(data))-1, total)
+	if len(data) == 0 {
+		contentRange = "bytes */" + total
+	}
+
+	request, err := http.NewRequestWithContext(w.ctx, http.MethodPut, w.session, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Range", contentRange)
+
+	response, err := w.store.client.Do(request)
+	if err != nil {
+		return AppError{Message: fmt.Sprintf("failed to upload %s", w.uri), Value: err}
+	}
+	defer response.Body.Close()
+
+	// 308 acknowledges an intermediate chunk, 200 or 201 the completed object
+	if (last && response.StatusCode/100 != 2) || (!last && response.StatusCode != http.StatusPermanentRedirect) {
+		return AppError{Message: fmt.Sprintf("failed to upload %s", w.uri), Value: responseError(response)}
+	}
+	w.offset += int64(len(data))
+	return nil
+}
+
+// startUpload starts a resumable upload and returns its session URL
+func (w *gcsWriter) startUpload() (string, error) {
+	query := url.Values{"uploadType": {"resumable"}, "name": {w.object}}
+	uploadURL := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?%s", w.store.endpoint, url.PathEscape(w.bucket), query.Encode())
+	response, err := w.store.do(w.ctx, http.MethodPost, uploadURL, nil)
+	if err != nil {
+		return "", err
+	}
+	response.Body.Close()
+
+	session := response.Header.Get("Location")
+	if session == "" {
+		return "", fmt.Errorf("no upload session in response")
+	}
+	return session, nil
+}
+
+// do sends an authorized request and fails on non-2xx responses
+func (s *GCSStore) do(ctx context.Context, method, target string, body []byte) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.anonymous {
+		token, err := s.accessToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return doRequest(s.client, request)
+}
+
+// accessToken returns a cached OAuth access token, fetching a new one before it expires
+func (s *GCSStore) accessToken(ctx context.Context) (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Until(s.expiry) > 5*time.Minute {
+		return s.token, nil
+	}
+
+	token, err := s.fetchToken(ctx)
+	if err != nil {
+		return "", AppError{Message: "failed to obtain Google Cloud credentials", Value: err}
+	}
+	s.token = token.AccessToken
+	s.expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return s.token, nil
+}
+
+// oauthToken is the response of an OAuth token endpoint
+type oauthToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// googleCredentials is a service account key or authorized user credentials file
+type googleCredentials struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// fetchToken obtains an access token from the credentials file, or from the metadata server
+func (s *GCSStore) fetchToken(ctx context.Context) (oauthToken, error) {
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if path == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, ".config", "gcloud", "application_default_credentials.json")
+			if _, err := os.Stat(path); err != nil {
+				path = ""
+			}
+		}
+	}
+	if path == "" {
+		return s.requestToken(ctx, http.MethodGet, gcsMetadataTokenURL, nil, http.Header{"Metadata-Flavor": {"Google"}})
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return oauthToken{}, err
+	}
+	var credentials googleCredentials
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return oauthToken{}, fmt.Errorf("invalid credentials file %s: %w", path, err)
+	}
+
+	switch credentials.Type {
+	case "service_account":
+		if credentials.TokenURI == "" {
+			credentials.TokenURI = "https://oauth2.googleapis.com/token"
+		}
+		assertion, err := signServiceAccountJWT(credentials, time.Now())
+		if err != nil {
+			return oauthToken{}, err
+		}
+		form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+		return s.requestToken(ctx, http.MethodPost, credentials.TokenURI, form, nil)
+	case "authorized_user":
+		form := url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {credentials.ClientID},
+			"client_secret": {credentials.ClientSecret},
+			"refresh_token": {credentials.RefreshToken},
+		}
+		return s.requestToken(ctx, http.MethodPost, "https://oauth2.googleapis.com/token", form, nil)
+	default:
+		return oauthToken{}, fmt.Errorf("unsupported credentials type %q in %s", credentials.Type, path)
+	}
+}
+
+// requestToken calls an OAuth token endpoint, posting form if it is not nil
+func (s *GCSStore) requestToken(ctx context.Context, method, tokenURL string, form url.Values, header http.Header) (oauthToken, error) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	request, err := http.NewRequestWithContext(ctx, method, tokenURL, body)
+	if err != nil {
+		return oauthToken{}, err
+	}
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	if form != nil {
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	response, err := doRequest(s.client, request)
+	if err != nil {
+		return oauthToken{}, err
+	}
+	defer response.Body.Close()
+
+	var token oauthToken
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return oauthToken{}, err
+	}
+	if token.AccessToken == "" {
+		return oauthToken{}, fmt.Errorf("no access token in response from %s", tokenURL)
+	}
+	return token, nil
+}
+
+// signServiceAccountJWT creates the RS256 signed assertion exchanged for an access token
+func signServiceAccountJWT(credentials googleCredentials, now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(credentials.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("invalid service account private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid service account private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("service account private key is not an RSA key")
+	}
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]any{
+		"iss":   credentials.ClientEmail,
+		"scope": gcsScope,
+		"aud":   credentials.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
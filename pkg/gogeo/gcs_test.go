@@ -0,0 +1,253 @@
+package gogeo
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordedRequest is a request received by a fake storage server
+type recordedRequest struct {
+	method string
+	uri    string
+	header http.Header
+	body   []byte
+}
+
+// storageServer is a fake storage server recording the requests it receives and
+// answering them with respond
+type storageServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []recordedRequest
+}
+
+func newStorageServer(t *testing.T, respond func(w http.ResponseWriter, request recordedRequest)) *storageServer {
+	t.Helper()
+	server := &storageServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("reading the request body: %v", err)
+		}
+		request := recordedRequest{method: r.Method, uri: r.RequestURI, header: r.Header, body: body}
+		server.mu.Lock()
+		server.requests = append(server.requests, request)
+		server.mu.Unlock()
+		respond(w, request)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// summary lists the method and URI of the requests received, without the host
+func (s *storageServer) summary() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var summary []string
+	for _, request := range s.requests {
+		summary = append(summary, request.method+" "+request.uri)
+	}
+	return summary
+}
+
+func TestGCSStore(t *testing.T) {
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "token")
+	server := newStorageServer(t, func(w http.ResponseWriter, request recordedRequest) {
+		if request.header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if request.method == http.MethodGet {
+			io.WriteString(w, "content")
+		}
+	})
+	store := &GCSStore{client: server.Client(), endpoint: server.URL}
+	ctx := context.Background()
+
+	writer, err := store.Create(ctx, "gs://bucket/dir/a b.parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(writer, "content")
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	reader, err := store.Open(ctx, "gs://bucket/dir/a b.parquet")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(data) != "content" {
+		t.Errorf("read %q, %v, want content", data, err)
+	}
+
+	want := []string{
+		"POST /upload/storage/v1/b/bucket/o?name=dir%2Fa+b.parquet&uploadType=media",
+		"GET /storage/v1/b/bucket/o/dir%2Fa%20b.parquet?alt=media",
+	}
+	if got := server.summary(); !slices.Equal(got, want) {
+		t.Errorf("requests = %q, want %q", got, want)
+	}
+	if body := server.requests[0].body; string(body) != "content" {
+		t.Errorf("uploaded %q, want content", body)
+	}
+}
+
+func TestGCSStoreResumableUpload(t *testing.T) {
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "token")
+	var server *storageServer
+	server = newStorageServer(t, func(w http.ResponseWriter, request recordedRequest) {
+		switch {
+		case request.method == http.MethodPost:
+			w.Header().Set("Location", server.URL+"/session")
+		case request.method == http.MethodPut && strings.HasSuffix(request.header.Get("Content-Range"), "/*"):
+			w.WriteHeader(http.StatusPermanentRedirect)
+		}
+	})
+	store := &GCSStore{client: server.Client(), endpoint: server.URL}
+
+	for _, abort := range []bool{false, true} {
+		server.requests = nil
+		writer, err := store.Create(context.Background(), "gs://bucket/big.parquet")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write(make([]byte, gcsChunkSize+1)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+
+		want := []string{"POST /upload/storage/v1/b/bucket/o?name=big.parquet&uploadType=resumable", "PUT /session"}
+		if abort {
+			if err := writer.Abort(); err != nil {
+				t.Fatalf("Abort() error = %v", err)
+			}
+			want = append(want, "DELETE /session")
+		} else {
+			if err := writer.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			want = append(want, "PUT /session")
+		}
+		if got := server.summary(); !slices.Equal(got, want) {
+			t.Fatalf("requests = %q, want %q", got, want)
+		}
+
+		// Only the request starting the session carries the token
+		if got := server.requests[0].header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("upload started with Authorization %q", got)
+		}
+		first := server.requests[1]
+		if got := first.header.Get("Content-Range"); got != "bytes 0-8388607/*" || len(first.body) != gcsChunkSize {
+			t.Errorf("first chunk has Content-Range %q and %d bytes", got, len(first.body))
+		}
+		if !abort {
+			last := server.requests[2]
+			if got := last.header.Get("Content-Range"); got != "bytes 8388608-8388608/8388609" || len(last.body) != 1 {
+				t.Errorf("last chunk has Content-Range %q and %d bytes", got, len(last.body))
+			}
+		}
+	}
+}
+
+func TestGCSStoreServiceAccount(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	var server *storageServer
+	server = newStorageServer(t, func(w http.ResponseWriter, request recordedRequest) {
+		if request.uri != "/token" {
+			if request.header.Get("Authorization") != "Bearer service-token" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+			}
+			return
+		}
+
+		form, err := url.ParseQuery(string(request.body))
+		if err != nil || form.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			http.Error(w, "invalid grant", http.StatusBadRequest)
+			return
+		}
+		parts := strings.Split(form.Get("assertion"), ".")
+		if len(parts) != 3 {
+			http.Error(w, "invalid assertion", http.StatusBadRequest)
+			return
+		}
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+		var claims map[string]any
+		data, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		json.Unmarshal(data, &claims)
+		if claims["iss"] != "writer@project.iam.gserviceaccount.com" || claims["aud"] != server.URL+"/token" || claims["scope"] != gcsScope {
+			http.Error(w, "invalid claims", http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, `{"access_token":"service-token","expires_in":3600}`)
+	})
+
+	credentials, err := json.Marshal(googleCredentials{
+		Type:        "service_account",
+		ClientEmail: "writer@project.iam.gserviceaccount.com",
+		PrivateKey:  string(privateKey),
+		TokenURI:    server.URL + "/token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(path, credentials, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "")
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", path)
+
+	store := &GCSStore{client: server.Client(), endpoint: server.URL}
+	for range 2 {
+		writer, err := store.Create(context.Background(), "gs://bucket/a.parquet")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+
+	// The token is fetched once and reused
+	want := []string{
+		"POST /token",
+		"POST /upload/storage/v1/b/bucket/o?name=a.parquet&uploadType=media",
+		"POST /upload/storage/v1/b/bucket/o?name=a.parquet&uploadType=media",
+	}
+	if got := server.summary(); !slices.Equal(got, want) {
+		t.Errorf("requests = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,96 @@
+package gogeo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// GenerateOptions holds the common options of a conversion as plain values, for callers
+// that cannot build Option values, such as the WebAssembly and C bindings. Its JSON
+// form names the fields in snake case, e.g. {"compression": "zstd", "bbox_column":
+// true}.
+type GenerateOptions struct {
+	// InputFormat is the format of the input, see WithInputFormat.
+	InputFormat string `json:"input_format,omitempty"`
+	// Compression is the codec of the column chunks, see WithCompression.
+	Compression string `json:"compression,omitempty"`
+	// RowGroupSize is the number of rows of a row group, 0 for the default.
+	RowGroupSize int64 `json:"row_group_size,omitempty"`
+	// BBoxColumn adds a bbox covering column.
+	BBoxColumn bool `json:"bbox_column,omitempty"`
+	// CRS is a code such as "EPSG:3857" or a PROJJSON object.
+	CRS json.RawMessage `json:"crs,omitempty"`
+	// SpatialSort is the curve the rows are sorted along, see WithSpatialSort.
+	SpatialSort string `json:"spatial_sort,omitempty"`
+	// Where is a filter of the features, see WithWhere.
+	Where string `json:"where,omitempty"`
+	// GeometryEncoding is the encoding of the geometry column, "WKB" or "WKT".
+	GeometryEncoding string `json:"geometry_encoding,omitempty"`
+	// IncludeColumns keeps only these properties, see WithIncludeColumns.
+	IncludeColumns []string `json:"include_columns,omitempty"`
+	// ExcludeColumns drops these properties, see WithExcludeColumns.
+	ExcludeColumns []string `json:"exclude_columns,omitempty"`
+}
+
+// ParseGenerateOptions decodes GenerateOptions from JSON and returns their options.
+// Empty data is no options; unknown fields are an error.
+func ParseGenerateOptions(data []byte) ([]Option, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	var options GenerateOptions
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&options); err != nil {
+		return nil, AppError{Message: "invalid generate options", Value: err}
+	}
+	return options.Options()
+}
+
+// Options returns the options of a conversion.
+func (o GenerateOptions) Options() ([]Option, error) {
+	var opts []Option
+	if o.InputFormat != "" {
+		opts = append(opts, WithInputFormat(o.InputFormat))
+	}
+	if o.Compression != "" {
+		opts = append(opts, WithCompression(o.Compression))
+	}
+	if o.RowGroupSize > 0 {
+		opts = append(opts, WithRowGroupSize(o.RowGroupSize))
+	}
+	if o.BBoxColumn {
+		opts = append(opts, WithBBoxColumn())
+	}
+	if crs := bytes.TrimSpace(o.CRS); len(crs) > 0 && !bytes.Equal(crs, []byte("null")) {
+		switch crs[0] {
+		case '"':
+			var code string
+			if err := json.Unmarshal(crs, &code); err != nil {
+				return nil, AppError{Message: "invalid crs", Value: err}
+			}
+			opts = append(opts, WithCRSCode(code))
+		case '{':
+			opts = append(opts, WithCRS(crs))
+		default:
+			return nil, AppError{Message: fmt.Sprintf("invalid crs %s, expected a code or a PROJJSON object", crs)}
+		}
+	}
+	if o.SpatialSort != "" {
+		opts = append(opts, WithSpatialSort(o.SpatialSort))
+	}
+	if o.Where != "" {
+		opts = append(opts, WithWhere(o.Where))
+	}
+	if o.GeometryEncoding != "" {
+		opts = append(opts, WithGeometryEncoding(o.GeometryEncoding))
+	}
+	if len(o.IncludeColumns) > 0 {
+		opts = append(opts, WithIncludeColumns(o.IncludeColumns...))
+	}
+	if len(o.ExcludeColumns) > 0 {
+		opts = append(opts, WithExcludeColumns(o.ExcludeColumns...))
+	}
+	return opts, nil
+}
@@ -0,0 +1,156 @@
+package gogeo
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/wkb"
+	"github.com/paulmach/orb/encoding/wkt"
+	"github.com/paulmach/orb/geojson"
+)
+
+// Geometry encodings supported for geometry columns
+const (
+	GeometryEncodingWKB = "WKB"
+	GeometryEncodingWKT = "WKT"
+)
+
+// GeometryColumn describes a geometry column of the output
+type GeometryColumn struct {
+	// Column name.
+	Name string
+	// Encoding of the column (WKB or WKT).
+	Encoding string
+}
+
+// normalizeGeometryEncoding returns the canonical name of a geometry encoding
+func normalizeGeometryEncoding(encoding string) (string, error) {
+	switch strings.ToUpper(encoding) {
+	case GeometryEncodingWKB:
+		return GeometryEncodingWKB, nil
+	case GeometryEncodingWKT:
+		return GeometryEncodingWKT, nil
+	default:
+		return "", AppError{Message: fmt.Sprintf("unsupported geometry encoding %q", encoding)}
+	}
+}
+
+// geometryNode returns the node of a geometry column with the given encoding.
+// WKT is stored as a UTF8 string, WKB as plain bytes.
+func geometryNode(encoding string) parquet.Node {
+	if encoding == GeometryEncodingWKT {
+		return parquet.String()
+	}
+	return parquet.Leaf(parquet.ByteArrayType)
+}
+
+// encodeGeometry encodes a geometry into the bytes of a column of the given encoding
+// Geometries with Z ordinates are written as ISO WKB or "Z" WKT.
+func encodeGeometry(geometry orb.Geometry, encoding string) ([]byte, error) {
+	if encoding == GeometryEncodingWKT {
+		if hasZ(geometry) {
+			wktString, err := marshalWKTZ(geometry)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode geometry as WKT: %w", err)
+			}
+			return []byte(wktString), nil
+		}
+		if point, ok := geometry.(orb.Point); ok && isEmptyPoint(point) {
+			return []byte("POINT EMPTY"), nil
+		}
+		return wkt.Marshal(geometry), nil
+	}
+
+	if hasZ(geometry) {
+		wkbBytes, err := marshalWKBZ(geometry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode geometry as WKB: %w", err)
+		}
+		return wkbBytes, nil
+	}
+
+	wkbBytes, err := wkb.Marshal(geometry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode geometry as WKB: %w", err)
+	}
+	return wkbBytes, nil
+}
+
+// decodeGeometry decodes a stored geometry value of the given encoding
+func decodeGeometry(data []byte, encoding string) (orb.Geometry, error) {
+	if encoding == GeometryEncodingWKT {
+		if wktHasZ(string(data)) {
+			return unmarshalWKTZ(string(data))
+		}
+		// orb cannot parse POINT EMPTY
+		if strings.EqualFold(strings.Join(strings.Fields(string(data)), " "), "POINT EMPTY") {
+			return emptyPoint(), nil
+		}
+		geometry, err := wkt.Unmarshal(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode WKT geometry: %w", err)
+		}
+		return geometry, nil
+	}
+
+	unmarshal := wkb.Unmarshal
+	if wkbHasZ(data) {
+		unmarshal = unmarshalWKBZ
+	}
+	geometry, err := unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode WKB geometry: %w", err)
+	}
+	return geometry, nil
+}
+
+// featureGeometries returns the geometries of a feature for each of cfg.geometryColumns().
+// The first is the feature geometry; the others are parsed from the feature properties,
+// or derived from the feature geometry for the columns of WithCentroidColumn and
+// WithPointOnSurfaceColumn.
+func featureGeometries(feature *geojson.Feature, cfg *config) ([]orb.Geometry, error) {
+	columns := cfg.geometryColumns()
+	geometries := make([]orb.Geometry, len(columns))
+	geometries[0] = feature.Geometry
+
+	for i, column := range columns[1:] {
+		if kind, ok := cfg.pointColumns[column.Name]; ok {
+			geometries[i+1] = derivePoint(feature.Geometry, kind)
+			continue
+		}
+		geometry, err := parseGeometryProperty(feature.Properties[column.Name])
+		if err != nil {
+			return nil, fmt.Errorf("geometry column %q: %w", column.Name, err)
+		}
+		geometries[i+1] = geometry
+	}
+
+	return geometries, nil
+}
+
+// parseGeometryProperty parses a property holding a GeoJSON geometry object or a WKT string,
+// or the geometry of another geometry column read from GeoParquet
+func parseGeometryProperty(value any) (orb.Geometry, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return decodeGeometry([]byte(v), GeometryEncodingWKT)
+	case *geojson.Geometry:
+		if v == nil {
+			return nil, nil
+		}
+		return v.Coordinates, nil
+	case map[string]any:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return decodeGeoJSONGeometry(data)
+	default:
+		return nil, fmt.Errorf("unsupported geometry value of type %T", value)
+	}
+}
@@ -0,0 +1,957 @@
+package gogeo
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// GeometryZ is a geometry with Z (elevation) ordinates.
+// orb geometries are two-dimensional, so the Z value of every position is kept
+// alongside, in the order the positions appear in the geometry. Geometry
+// collections are never wrapped; their members are GeometryZ values instead.
+type GeometryZ struct {
+	orb.Geometry
+	// Z ordinates, one per position.
+	Z []float64
+}
+
+// MarshalJSON encodes the GeoJSON coordinates of the geometry, including Z
+func (g GeometryZ) MarshalJSON() ([]byte, error) {
+	coordinates, err := coordinatesZ(g.Geometry, &zCursor{z: g.Z})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(coordinates)
+}
+
+// hasZ reports whether a geometry, or any member of a collection, has Z ordinates
+func hasZ(geometry orb.Geometry) bool {
+	switch g := geometry.(type) {
+	case GeometryZ:
+		return true
+	case orb.Collection:
+		for _, member := range g {
+			if hasZ(member) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// geometryTypeName returns the GeoParquet geometry type of a geometry, e.g. "Point Z"
+func geometryTypeName(geometry orb.Geometry) string {
+	if hasZ(geometry) {
+		return geometry.GeoJSONType() + " Z"
+	}
+	return geometry.GeoJSONType()
+}
+
+// zCursor walks the Z ordinates of a geometry; missing values read as 0
+type zCursor struct {
+	z []float64
+	i int
+}
+
+func (c *zCursor) next() float64 {
+	var value float64
+	if c.i < len(c.z) {
+		value = c.z[c.i]
+	}
+	c.i++
+	return value
+}
+
+// coordinatesZ returns the nested GeoJSON coordinates of a geometry with Z values
+func coordinatesZ(geometry orb.Geometry, c *zCursor) (any, error) {
+	switch g := geometry.(type) {
+	case orb.Point:
+		return positionZ(g, c), nil
+	case orb.MultiPoint:
+		return positionsZ(g, c), nil
+	case orb.LineString:
+		return positionsZ(g, c), nil
+	case orb.Ring:
+		return positionsZ(g, c), nil
+	case orb.MultiLineString:
+		lines := make([][][]float64, len(g))
+		for i, line := range g {
+			lines[i] = positionsZ(line, c)
+		}
+		return lines, nil
+	case orb.Polygon:
+		return ringsZ(g, c), nil
+	case orb.MultiPolygon:
+		polygons := make([][][][]float64, len(g))
+		for i, polygon := range g {
+			polygons[i] = ringsZ(polygon, c)
+		}
+		return polygons, nil
+	default:
+		return nil, fmt.Errorf("unsupported geometry type %T with Z ordinates", geometry)
+	}
+}
+
+func positionZ(p orb.Point, c *zCursor) []float64 {
+	return []float64{p.X(), p.Y(), c.next()}
+}
+
+func positionsZ(points []orb.Point, c *zCursor) [][]float64 {
+	positions := make([][]float64, len(points))
+	for i, p := range points {
+		positions[i] = positionZ(p, c)
+	}
+	return positions
+}
+
+func ringsZ(polygon orb.Polygon, c *zCursor) [][][]float64 {
+	rings := make([][][]float64, len(polygon))
+	for i, ring := range polygon {
+		rings[i] = positionsZ(ring, c)
+	}
+	return rings
+}
+
+// decodeGeoJSONGeometry decodes a GeoJSON geometry object, keeping Z ordinates
+func decodeGeoJSONGeometry(data []byte) (orb.Geometry, error) {
+	geometry, err := geojson.UnmarshalGeometry(data)
+	if err != nil {
+		return nil, err
+	}
+	return withZ(geometry.Geometry(), data)
+}
+
+// withZ attaches the Z ordinates found in the raw GeoJSON of a geometry decoded by orb
+func withZ(geometry orb.Geometry, data []byte) (orb.Geometry, error) {
+	if geometry == nil || len(data) == 0 {
+		return geometry, nil
+	}
+
+	var doc struct {
+		Coordinates json.RawMessage   `json:"coordinates"`
+		Geometries  []json.RawMessage `json:"geometries"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	if collection, ok := geometry.(orb.Collection); ok {
+		for i := range collection {
+			if i >= len(doc.Geometries) {
+				break
+			}
+			member, err := withZ(collection[i], doc.Geometries[i])
+			if err != nil {
+				return nil, err
+			}
+			collection[i] = member
+		}
+		return collection, nil
+	}
+
+	var coordinates any
+	if err := json.Unmarshal(doc.Coordinates, &coordinates); err != nil {
+		return nil, err
+	}
+	// orb reads a Point with empty coordinates as 0, 0
+	if items, ok := coordinates.([]any); ok && len(items) == 0 {
+		if _, ok := geometry.(orb.Point); ok {
+			return emptyPoint(), nil
+		}
+	}
+
+	var z []float64
+	if !collectZ(coordinates, &z) {
+		return geometry, nil
+	}
+	return GeometryZ{Geometry: geometry, Z: z}, nil
+}
+
+// collectZ appends the Z value of every position of nested GeoJSON coordinates,
+// reporting whether any position has one
+func collectZ(value any, z *[]float64) bool {
+	items, ok := value.([]any)
+	if !ok {
+		return false
+	}
+
+	// A position is an array of numbers
+	if len(items) > 0 {
+		if _, isNumber := items[0].(float64); isNumber {
+			if len(items) >= 3 {
+				if elevation, ok := items[2].(float64); ok {
+					*z = append(*z, elevation)
+					return true
+				}
+			}
+			*z = append(*z, 0)
+			return false
+		}
+	}
+
+	found := false
+	for _, item := range items {
+		if collectZ(item, z) {
+			found = true
+		}
+	}
+	return found
+}
+
+// WKB geometry type codes
+const (
+	wkbPoint              uint32 = 1
+	wkbLineString         uint32 = 2
+	wkbPolygon            uint32 = 3
+	wkbMultiPoint         uint32 = 4
+	wkbMultiLineString    uint32 = 5
+	wkbMultiPolygon       uint32 = 6
+	wkbGeometryCollection uint32 = 7
+
+	// ISO WKB adds 1000 to the type code for Z geometries
+	wkbISOZ uint32 = 1000
+
+	// EWKB flags
+	ewkbZ    uint32 = 0x80000000
+	ewkbM    uint32 = 0x40000000
+	ewkbSRID uint32 = 0x20000000
+)
+
+// marshalWKBZ encodes a geometry as little-endian ISO WKB with Z ordinates
+func marshalWKBZ(geometry orb.Geometry) ([]byte, error) {
+	w := &wkbZWriter{}
+	if err := w.write(geometry); err != nil {
+		return nil, err
+	}
+	return w.buf, nil
+}
+
+// wkbZWriter accumulates ISO WKB with Z ordinates
+type wkbZWriter struct {
+	buf []byte
+}
+
+func (w *wkbZWriter) write(geometry orb.Geometry) error {
+	switch g := geometry.(type) {
+	case GeometryZ:
+		return w.writeZ(g.Geometry, &zCursor{z: g.Z})
+	case orb.Collection:
+		w.header(wkbGeometryCollection)
+		w.count(len(g))
+		for _, member := range g {
+			if err := w.write(member); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return w.writeZ(geometry, &zCursor{})
+	}
+}
+
+func (w *wkbZWriter) writeZ(geometry orb.Geometry, c *zCursor) error {
+	switch g := geometry.(type) {
+	case orb.Point:
+		w.header(wkbPoint)
+		w.position(g, c)
+	case orb.MultiPoint:
+		w.header(wkbMultiPoint)
+		w.count(len(g))
+		for _, p := range g {
+			w.header(wkbPoint)
+			w.position(p, c)
+		}
+	case orb.LineString:
+		w.header(wkbLineString)
+		w.positions(g, c)
+	case orb.MultiLineString:
+		w.header(wkbMultiLineString)
+		w.count(len(g))
+		for _, line := range g {
+			w.header(wkbLineString)
+			w.positions(line, c)
+		}
+	case orb.Ring:
+		return w.writeZ(orb.Polygon{g}, c)
+	case orb.Polygon:
+		w.header(wkbPolygon)
+		w.rings(g, c)
+	case orb.MultiPolygon:
+		w.header(wkbMultiPolygon)
+		w.count(len(g))
+		for _, polygon := range g {
+			w.header(wkbPolygon)
+			w.rings(polygon, c)
+		}
+	default:
+		return fmt.Errorf("unsupported geometry type %T with Z ordinates", geometry)
+	}
+	return nil
+}
+
+func (w *wkbZWriter) header(kind uint32) {
+	w.buf = append(w.buf, 1) // little endian
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, kind+wkbISOZ)
+}
+
+func (w *wkbZWriter) count(n int) {
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, uint32(n))
+}
+
+func (w *wkbZWriter) position(p orb.Point, c *zCursor) {
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(p.X()))
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(p.Y()))
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(c.next()))
+}
+
+func (w *wkbZWriter) positions(points []orb.Point, c *zCursor) {
+	w.count(len(points))
+	for _, p := range points {
+		w.position(p, c)
+	}
+}
+
+func (w *wkbZWriter) rings(polygon orb.Polygon, c *zCursor) {
+	w.count(len(polygon))
+	for _, ring := range polygon {
+		w.positions(ring, c)
+	}
+}
+
+// wkbHasZ reports whether WKB data starts with a Z (ISO or EWKB) geometry header
+func wkbHasZ(data []byte) bool {
+	if len(data) < 5 {
+		return false
+	}
+	kind := byteOrder(data[0]).Uint32(data[1:5])
+	return kind&ewkbZ != 0 || (kind&0xffff)/1000 == 1
+}
+
+func byteOrder(b byte) binary.ByteOrder {
+	if b == 0 {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// errWKBTruncated is returned for WKB data that ends before the geometry does
+var errWKBTruncated = errors.New("truncated WKB data")
+
+// unmarshalWKBZ decodes ISO WKB or EWKB with Z ordinates into GeometryZ values
+func unmarshalWKBZ(data []byte) (orb.Geometry, error) {
+	r := &wkbZReader{data: data}
+	return r.geometry()
+}
+
+// wkbZReader decodes WKB geometries that may have Z ordinates
+type wkbZReader struct {
+	data []byte
+}
+
+func (r *wkbZReader) geometry() (orb.Geometry, error) {
+	order, kind, hasZ, err := r.header()
+	if err != nil {
+		return nil, err
+	}
+
+	if kind == wkbGeometryCollection {
+		n, err := r.uint32(order)
+		if err != nil {
+			return nil, err
+		}
+		collection := make(orb.Collection, 0, n)
+		for i := uint32(0); i < n; i++ {
+			member, err := r.geometry()
+			if err != nil {
+				return nil, err
+			}
+			collection = append(collection, member)
+		}
+		return collection, nil
+	}
+
+	var z []float64
+	geometry, err := r.body(kind, order, hasZ, &z)
+	if err != nil {
+		return nil, err
+	}
+	if hasZ {
+		return GeometryZ{Geometry: geometry, Z: z}, nil
+	}
+	return geometry, nil
+}
+
+// header reads the byte order and type of a geometry
+func (r *wkbZReader) header() (binary.ByteOrder, uint32, bool, error) {
+	if len(r.data) < 5 {
+		return nil, 0, false, errWKBTruncated
+	}
+	order := byteOrder(r.data[0])
+	kind := order.Uint32(r.data[1:5])
+	r.data = r.data[5:]
+
+	if kind&ewkbM != 0 || (kind&0xffff)/1000 >= 2 {
+		return nil, 0, false, errors.New("WKB geometries with M ordinates are not supported")
+	}
+
+	hasZ := kind&ewkbZ != 0 || (kind&0xffff)/1000 == 1
+	if kind&ewkbSRID != 0 {
+		if len(r.data) < 4 {
+			return nil, 0, false, errWKBTruncated
+		}
+		r.data = r.data[4:]
+	}
+
+	return order, (kind & 0xffff) % 1000, hasZ, nil
+}
+
+func (r *wkbZReader) body(kind uint32, order binary.ByteOrder, hasZ bool, z *[]float64) (orb.Geometry, error) {
+	switch kind {
+	case wkbPoint:
+		return r.position(order, hasZ, z)
+	case wkbLineString:
+		points, err := r.positions(order, hasZ, z)
+		return orb.LineString(points), err
+	case wkbPolygon:
+		return r.polygon(order, hasZ, z)
+	case wkbMultiPoint, wkbMultiLineString, wkbMultiPolygon:
+		n, err := r.uint32(order)
+		if err != nil {
+			return nil, err
+		}
+
+		members := make([]orb.Geometry, 0, n)
+		for i := uint32(0); i < n; i++ {
+			memberOrder, memberKind, _, err := r.header()
+			if err != nil {
+				return nil, err
+			}
+			if memberKind != kind-3 {
+				return nil, fmt.Errorf("unexpected WKB member type %d", memberKind)
+			}
+			member, err := r.body(memberKind, memberOrder, hasZ, z)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, member)
+		}
+		return collectMembers(kind, members), nil
+	default:
+		return nil, fmt.Errorf("unsupported WKB geometry type %d", kind)
+	}
+}
+
+// collectMembers builds a multi geometry from its decoded members
+func collectMembers(kind uint32, members []orb.Geometry) orb.Geometry {
+	switch kind {
+	case wkbMultiPoint:
+		multi := make(orb.MultiPoint, len(members))
+		for i, member := range members {
+			multi[i] = member.(orb.Point)
+		}
+		return multi
+	case wkbMultiLineString:
+		multi := make(orb.MultiLineString, len(members))
+		for i, member := range members {
+			multi[i] = member.(orb.LineString)
+		}
+		return multi
+	default:
+		multi := make(orb.MultiPolygon, len(members))
+		for i, member := range members {
+			multi[i] = member.(orb.Polygon)
+		}
+		return multi
+	}
+}
+
+func (r *wkbZReader) uint32(order binary.ByteOrder) (uint32, error) {
+	if len(r.data) < 4 {
+		return 0, errWKBTruncated
+	}
+	value := order.Uint32(r.data)
+	r.data = r.data[4:]
+	return value, nil
+}
+
+func (r *wkbZReader) float64(order binary.ByteOrder) (float64, error) {
+	if len(r.data) < 8 {
+		return 0, errWKBTruncated
+	}
+	value := math.Float64frombits(order.Uint64(r.data))
+	r.data = r.data[8:]
+	return value, nil
+}
+
+func (r *wkbZReader) position(order binary.ByteOrder, hasZ bool, z *[]float64) (orb.Point, error) {
+	x, err := r.float64(order)
+	if err != nil {
+		return orb.Point{}, err
+	}
+	y, err := r.float64(order)
+	if err != nil {
+		return orb.Point{}, err
+	}
+	if hasZ {
+		elevation, err := r.float64(order)
+		if err != nil {
+			return orb.Point{}, err
+		}
+		*z = append(*z, elevation)
+	}
+	return orb.Point{x, y}, nil
+}
+
+func (r *wkbZReader) positions(order binary.ByteOrder, hasZ bool, z *[]float64) ([]orb.Point, error) {
+	n, err := r.uint32(order)
+	if err != nil {
+		return nil, err
+	}
+	// Guard against allocating for corrupt counts
+	if int(n) > len(r.data)/16 {
+		return nil, errWKBTruncated
+	}
+
+	points := make([]orb.Point, n)
+	for i := range points {
+		if points[i], err = r.position(order, hasZ, z); err != nil {
+			return nil, err
+		}
+	}
+	return points, nil
+}
+
+func (r *wkbZReader) polygon(order binary.ByteOrder, hasZ bool, z *[]float64) (orb.Polygon, error) {
+	n, err := r.uint32(order)
+	if err != nil {
+		return nil, err
+	}
+	if int(n) > len(r.data)/4 {
+		return nil, errWKBTruncated
+	}
+
+	polygon := make(orb.Polygon, n)
+	for i := range polygon {
+		points, err := r.positions(order, hasZ, z)
+		if err != nil {
+			return nil, err
+		}
+		polygon[i] = orb.Ring(points)
+	}
+	return polygon, nil
+}
+
+// wktTypeNames maps GeoJSON geometry types to WKT keywords
+var wktTypeNames = map[string]string{
+	"Point":              "POINT",
+	"MultiPoint":         "MULTIPOINT",
+	"LineString":         "LINESTRING",
+	"MultiLineString":    "MULTILINESTRING",
+	"Polygon":            "POLYGON",
+	"MultiPolygon":       "MULTIPOLYGON",
+	"GeometryCollection": "GEOMETRYCOLLECTION",
+}
+
+// marshalWKTZ encodes a geometry as WKT with Z ordinates, e.g. "POINT Z (1 2 3)"
+func marshalWKTZ(geometry orb.Geometry) (string, error) {
+	var sb strings.Builder
+	if err := writeWKTZ(&sb, geometry); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+func writeWKTZ(sb *strings.Builder, geometry orb.Geometry) error {
+	sb.WriteString(wktTypeNames[geometry.GeoJSONType()])
+	sb.WriteString(" Z ")
+
+	if collection, ok := geometry.(orb.Collection); ok {
+		sb.WriteByte('(')
+		for i, member := range collection {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			if err := writeWKTZ(sb, member); err != nil {
+				return err
+			}
+		}
+		sb.WriteByte(')')
+		return nil
+	}
+
+	c := &zCursor{}
+	if g, ok := geometry.(GeometryZ); ok {
+		geometry, c = g.Geometry, &zCursor{z: g.Z}
+	}
+	coordinates, err := coordinatesZ(geometry, c)
+	if err != nil {
+		return err
+	}
+
+	switch v := coordinates.(type) {
+	case []float64:
+		sb.WriteString("(" + wktPosition(v) + ")")
+	case [][]float64:
+		// MULTIPOINT members are parenthesized, LINESTRING positions are not
+		_, isMultiPoint := geometry.(orb.MultiPoint)
+		sb.WriteString(wktPositions(v, isMultiPoint))
+	case [][][]float64:
+		sb.WriteString(wktList(len(v), func(i int) string { return wktPositions(v[i], false) }))
+	case [][][][]float64:
+		sb.WriteString(wktList(len(v), func(i int) string {
+			return wktList(len(v[i]), func(j int) string { return wktPositions(v[i][j], false) })
+		}))
+	}
+	return nil
+}
+
+func wktPosition(position []float64) string {
+	parts := make([]string, len(position))
+	for i, value := range position {
+		parts[i] = strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return strings.Join(parts, " ")
+}
+
+func wktPositions(positions [][]float64, parenthesize bool) string {
+	return wktList(len(positions), func(i int) string {
+		if parenthesize {
+			return "(" + wktPosition(positions[i]) + ")"
+		}
+		return wktPosition(positions[i])
+	})
+}
+
+func wktList(n int, item func(i int) string) string {
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = item(i)
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+// wktHasZ reports whether a WKT string declares Z ordinates, e.g. "POINT Z (1 2 3)" or "POINTZ(1 2 3)"
+func wktHasZ(s string) bool {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	rest := strings.TrimLeft(s, "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	keyword := s[:len(s)-len(rest)]
+	if wktGeoJSONType(keyword) == "" {
+		return strings.HasSuffix(keyword, "Z") && wktGeoJSONType(strings.TrimSuffix(keyword, "Z")) != ""
+	}
+	return strings.HasPrefix(strings.TrimSpace(rest), "Z")
+}
+
+// wktGeoJSONType returns the GeoJSON type of a WKT keyword, or "" if unknown
+func wktGeoJSONType(keyword string) string {
+	for geoJSONType, wktType := range wktTypeNames {
+		if wktType == keyword {
+			return geoJSONType
+		}
+	}
+	return ""
+}
+
+// unmarshalWKTZ decodes WKT with Z ordinates into GeometryZ values
+func unmarshalWKTZ(s string) (orb.Geometry, error) {
+	p := &wktParser{s: strings.ToUpper(s)}
+	geometry, err := p.geometry()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode WKT geometry: %w", err)
+	}
+	if p.skipSpace(); p.pos != len(p.s) {
+		return nil, fmt.Errorf("failed to decode WKT geometry: unexpected %q", p.s[p.pos:])
+	}
+	return geometry, nil
+}
+
+// wktParser is a recursive descent parser for WKT. Coordinates are converted to
+// GeoJSON so they go through the same decoding as GeoJSON input.
+type wktParser struct {
+	s   string
+	pos int
+}
+
+func (p *wktParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == '\n' || p.s[p.pos] == '\r') {
+		p.pos++
+	}
+}
+
+func (p *wktParser) word() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && p.s[p.pos] >= 'A' && p.s[p.pos] <= 'Z' {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *wktParser) expect(b byte) error {
+	p.skipSpace()
+	if p.pos >= len(p.s) || p.s[p.pos] != b {
+		return fmt.Errorf("expected %q at offset %d", b, p.pos)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *wktParser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *wktParser) geometry() (orb.Geometry, error) {
+	keyword := p.word()
+	geoJSONType := wktGeoJSONType(keyword)
+	if geoJSONType == "" && strings.HasSuffix(keyword, "Z") {
+		geoJSONType = wktGeoJSONType(strings.TrimSuffix(keyword, "Z"))
+	}
+	if geoJSONType == "" {
+		return nil, fmt.Errorf("unknown geometry type %q", keyword)
+	}
+
+	save := p.pos
+	switch dimension := p.word(); dimension {
+	case "Z", "":
+	case "EMPTY":
+		p.pos = save
+	default:
+		return nil, fmt.Errorf("unsupported dimension %q", dimension)
+	}
+
+	save = p.pos
+	if p.word() == "EMPTY" {
+		return nil, nil
+	}
+	p.pos = save
+
+	if geoJSONType == "GeometryCollection" {
+		if err := p.expect('('); err != nil {
+			return nil, err
+		}
+		var collection orb.Collection
+		for {
+			member, err := p.geometry()
+			if err != nil {
+				return nil, err
+			}
+			if member != nil {
+				collection = append(collection, member)
+			}
+			if p.peek() != ',' {
+				break
+			}
+			p.pos++
+		}
+		return collection, p.expect(')')
+	}
+
+	coordinates, err := p.coordinates()
+	if err != nil {
+		return nil, err
+	}
+	// A WKT point is a parenthesized position
+	if geoJSONType == "Point" {
+		if list, ok := coordinates.([]any); ok && len(list) == 1 {
+			coordinates = list[0]
+		}
+	}
+	// MULTIPOINT members may be parenthesized
+	if geoJSONType == "MultiPoint" {
+		if list, ok := coordinates.([]any); ok {
+			for i, item := range list {
+				if member, ok := item.([]any); ok && len(member) == 1 {
+					list[i] = member[0]
+				}
+			}
+		}
+	}
+
+	data, err := json.Marshal(map[string]any{"type": geoJSONType, "coordinates": coordinates})
+	if err != nil {
+		return nil, err
+	}
+	return decodeGeoJSONGeometry(data)
+}
+
+// coordinates parses a parenthesized list of positions or nested lists
+func (p *wktParser) coordinates() (any, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+
+	var items []any
+	for {
+		if p.peek() == '(' {
+			item, err := p.coordinates()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		} else {
+			position, err := p.position()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, position)
+		}
+
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+
+	return items, p.expect(')')
+}
+
+// position parses whitespace separated numbers
+func (p *wktParser) position() ([]any, error) {
+	var position []any
+	for {
+		p.skipSpace()
+		start := p.pos
+		for p.pos < len(p.s) && strings.IndexByte("+-.0123456789E", p.s[p.pos]) >= 0 {
+			p.pos++
+		}
+		if start == p.pos {
+			break
+		}
+		value, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+		if err != nil {
+			return nil, err
+		}
+		position = append(position, value)
+	}
+
+	if len(position) < 2 {
+		return nil, fmt.Errorf("invalid position at offset %d", p.pos)
+	}
+	return position, nil
+}
+
+// allOfType reports whether there are members and all of them have type T
+func allOfType[T orb.Geometry](members []orb.Geometry) bool {
+	for _, member := range members {
+		if _, ok := member.(T); !ok {
+			return false
+		}
+	}
+	return len(members) > 0
+}
+
+// countPositions returns the number of positions of a geometry; POINT EMPTY has none
+func countPositions(geometry orb.Geometry) int {
+	switch g := geometry.(type) {
+	case orb.Point:
+		if isEmptyPoint(g) {
+			return 0
+		}
+		return 1
+	case orb.MultiPoint:
+		return len(g)
+	case orb.LineString:
+		return len(g)
+	case orb.Ring:
+		return len(g)
+	case orb.Polygon:
+		count := 0
+		for _, ring := range g {
+			count += len(ring)
+		}
+		return count
+	case orb.MultiLineString:
+		count := 0
+		for _, line := range g {
+			count += len(line)
+		}
+		return count
+	case orb.MultiPolygon:
+		count := 0
+		for _, polygon := range g {
+			count += countPositions(polygon)
+		}
+		return count
+	case orb.Collection:
+		count := 0
+		for _, member := range g {
+			count += countPositions(member)
+		}
+		return count
+	case GeometryZ:
+		return countPositions(g.Geometry)
+	}
+	return 0
+}
+
+// appendZ appends the altitudes of n positions, or zeros if they have none
+func appendZ(z, altitudes []float64, n int) []float64 {
+	if altitudes != nil {
+		return append(z, altitudes...)
+	}
+	return append(z, make([]float64, n)...)
+}
+
+// withZOrdinates attaches altitudes to a geometry, if it has any
+func withZOrdinates(geometry orb.Geometry, z []float64) orb.Geometry {
+	if z == nil {
+		return geometry
+	}
+	return GeometryZ{Geometry: geometry, Z: z}
+}
+
+// combineMembers combines the members of a multi-geometry and their Z ordinates, as
+// returned by the readers. Members of a single type become a MultiPoint,
+// MultiLineString or MultiPolygon, others a GeometryCollection.
+func combineMembers(members []orb.Geometry, zs [][]float64) (orb.Geometry, []float64) {
+	var multi orb.Geometry
+	switch {
+	case allOfType[orb.Point](members):
+		points := make(orb.MultiPoint, len(members))
+		for i, member := range members {
+			points[i] = member.(orb.Point)
+		}
+		multi = points
+	case allOfType[orb.LineString](members):
+		lines := make(orb.MultiLineString, len(members))
+		for i, member := range members {
+			lines[i] = member.(orb.LineString)
+		}
+		multi = lines
+	case allOfType[orb.Polygon](members):
+		polygons := make(orb.MultiPolygon, len(members))
+		for i, member := range members {
+			polygons[i] = member.(orb.Polygon)
+		}
+		multi = polygons
+	default:
+		// Members of a collection carry their own Z ordinates
+		collection := make(orb.Collection, len(members))
+		for i, member := range members {
+			collection[i] = withZOrdinates(member, zs[i])
+		}
+		return collection, nil
+	}
+
+	var z []float64
+	hasZ := false
+	for i, member := range members {
+		z = appendZ(z, zs[i], countPositions(member))
+		hasZ = hasZ || zs[i] != nil
+	}
+	if !hasZ {
+		z = nil
+	}
+	return multi, z
+}
@@ -0,0 +1,280 @@
+package gogeo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// GeoPackageReader reads the features of a layer of a GeoPackage (.gpkg) file.
+// Every column other than the geometry becomes a feature property.
+type GeoPackageReader struct {
+	layer    string
+	table    *sqliteTable
+	geometry string
+	cursor   *sqliteCursor
+	crs      json.RawMessage
+}
+
+// NewGeoPackageReader opens a feature table of a GeoPackage. An empty layer selects
+// the only feature table, and fails if the GeoPackage has several.
+func NewGeoPackageReader(r io.ReaderAt, size int64, layer string) (*GeoPackageReader, error) {
+	db, err := openSQLite(r, size)
+	if err != nil {
+		return nil, AppError{Message: "failed to read GeoPackage", Value: err}
+	}
+	tables, err := db.tables()
+	if err != nil {
+		return nil, AppError{Message: "failed to read GeoPackage", Value: err}
+	}
+
+	layers, err := geoPackageLayers(db, tables)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(layers))
+	for name := range layers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if layer == "" {
+		if len(names) != 1 {
+			return nil, AppError{Message: fmt.Sprintf("GeoPackage has %d feature layers, select one of %s", len(names), strings.Join(names, ", "))}
+		}
+		layer = names[0]
+	}
+
+	info, ok := layers[layer]
+	if !ok {
+		return nil, AppError{Message: fmt.Sprintf("layer %q not found, GeoPackage layers are %s", layer, strings.Join(names, ", "))}
+	}
+	table, ok := tables[strings.ToLower(info.table)]
+	if !ok {
+		return nil, AppError{Message: fmt.Sprintf("table of layer %q not found", layer)}
+	}
+
+	crs, err := geoPackageCRS(db, tables, info.srsID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GeoPackageReader{
+		layer:    layer,
+		table:    table,
+		geometry: info.geometry,
+		cursor:   db.scan(table.rootPage),
+		crs:      crs,
+	}, nil
+}
+
+// GeoPackageLayers lists the names of the feature layers of a GeoPackage.
+func GeoPackageLayers(r io.ReaderAt, size int64) ([]string, error) {
+	db, err := openSQLite(r, size)
+	if err != nil {
+		return nil, AppError{Message: "failed to read GeoPackage", Value: err}
+	}
+	tables, err := db.tables()
+	if err != nil {
+		return nil, AppError{Message: "failed to read GeoPackage", Value: err}
+	}
+	layers, err := geoPackageLayers(db, tables)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(layers))
+	for name := range layers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Layer returns the name of the layer being read.
+func (r *GeoPackageReader) Layer() string {
+	return r.layer
+}
+
+// CRS returns the PROJJSON definition of the coordinate reference system declared for
+// the layer, or nil if it is undefined.
+func (r *GeoPackageReader) CRS() json.RawMessage {
+	return r.crs
+}
+
+// Next returns the next feature of the layer, or io.EOF after the last one.
+func (r *GeoPackageReader) Next() (*geojson.Feature, error) {
+	rowid, values, err := r.cursor.next()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("layer %s: %w", r.layer, err)
+	}
+
+	row := r.table.row(rowid, values)
+	feature := geojson.NewFeature(nil)
+	feature.ID = rowid
+	for _, column := range r.table.columns {
+		value := row[column.name]
+		if strings.EqualFold(column.name, r.geometry) {
+			geometry, err := decodeGeoPackageGeometry(value)
+			if err != nil {
+				return nil, fmt.Errorf("layer %s, feature %d: %w", r.layer, rowid, err)
+			}
+			feature.Geometry = geometry
+			continue
+		}
+		feature.Properties[column.name] = value
+	}
+	return feature, nil
+}
+
+// geoPackageLayer is a row of gpkg_geometry_columns joined with gpkg_contents
+type geoPackageLayer struct {
+	table    string
+	geometry string
+	srsID    int64
+}
+
+// geoPackageLayers returns the feature layers by name
+func geoPackageLayers(db *sqliteDB, tables map[string]*sqliteTable) (map[string]geoPackageLayer, error) {
+	contents, ok := tables["gpkg_contents"]
+	if !ok {
+		return nil, AppError{Message: "not a GeoPackage, gpkg_contents table not found"}
+	}
+	columns, ok := tables["gpkg_geometry_columns"]
+	if !ok {
+		return nil, AppError{Message: "not a GeoPackage, gpkg_geometry_columns table not found"}
+	}
+
+	contentRows, err := db.rows(contents)
+	if err != nil {
+		return nil, AppError{Message: "failed to read gpkg_contents", Value: err}
+	}
+	columnRows, err := db.rows(columns)
+	if err != nil {
+		return nil, AppError{Message: "failed to read gpkg_geometry_columns", Value: err}
+	}
+
+	geometryColumns := make(map[string]map[string]any)
+	for _, row := range columnRows {
+		name, _ := row["table_name"].(string)
+		geometryColumns[strings.ToLower(name)] = row
+	}
+
+	layers := make(map[string]geoPackageLayer)
+	for _, row := range contentRows {
+		name, _ := row["table_name"].(string)
+		if dataType, _ := row["data_type"].(string); dataType != "features" {
+			continue
+		}
+		geometry, ok := geometryColumns[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+		column, _ := geometry["column_name"].(string)
+		srsID, _ := geometry["srs_id"].(int64)
+		layers[name] = geoPackageLayer{table: name, geometry: column, srsID: srsID}
+	}
+	return layers, nil
+}
+
+// geoPackageCRS returns the PROJJSON definition of a spatial reference system of
+// gpkg_spatial_ref_sys. Registered codes use their full definition; others are
+// identified by name and code only. The undefined systems 0 and -1 return nil.
+func geoPackageCRS(db *sqliteDB, tables map[string]*sqliteTable, srsID int64) (json.RawMessage, error) {
+	if srsID == 0 || srsID == -1 {
+		return nil, nil
+	}
+	srs, ok := tables["gpkg_spatial_ref_sys"]
+	if !ok {
+		return nil, AppError{Message: "not a GeoPackage, gpkg_spatial_ref_sys table not found"}
+	}
+	rows, err := db.rows(srs)
+	if err != nil {
+		return nil, AppError{Message: "failed to read gpkg_spatial_ref_sys", Value: err}
+	}
+
+	for _, row := range rows {
+		if id, _ := row["srs_id"].(int64); id != srsID {
+			continue
+		}
+		organization, _ := row["organization"].(string)
+		code, _ := row["organization_coordsys_id"].(int64)
+		name, _ := row["srs_name"].(string)
+		definition, _ := row["definition"].(string)
+
+		if definition, err := LookupCRS(fmt.Sprintf("%s:%d", organization, code)); err == nil {
+			return definition, nil
+		}
+		return minimalPROJJSON(name, strings.ToUpper(organization), code, wktCRSType(definition))
+	}
+	return nil, AppError{Message: fmt.Sprintf("spatial reference system %d not found in gpkg_spatial_ref_sys", srsID)}
+}
+
+// wktCRSType returns the PROJJSON type of a CRS from its WKT definition
+func wktCRSType(wkt string) string {
+	upper := strings.ToUpper(strings.TrimSpace(wkt))
+	switch {
+	case strings.HasPrefix(upper, "PROJCS"), strings.HasPrefix(upper, "PROJCRS"), strings.HasPrefix(upper, "PROJECTEDCRS"):
+		return "ProjectedCRS"
+	case strings.HasPrefix(upper, "COMPD_CS"), strings.HasPrefix(upper, "COMPOUNDCRS"):
+		return "CompoundCRS"
+	}
+	return "GeographicCRS"
+}
+
+// minimalPROJJSON identifies a CRS that is not registered by its name and authority code
+func minimalPROJJSON(name, authority string, code int64, crsType string) (json.RawMessage, error) {
+	definition := map[string]any{
+		"$schema": "https://proj.org/schemas/v0.7/projjson.schema.json",
+		"type":    crsType,
+		"name":    name,
+	}
+	if authority != "" && authority != "NONE" {
+		definition["id"] = map[string]any{"authority": authority, "code": code}
+	}
+	return json.Marshal(definition)
+}
+
+// decodeGeoPackageGeometry decodes a GeoPackage geometry blob: a "GP" header with the
+// flags, SRS id and optional envelope, followed by WKB. Empty geometries are read as null.
+func decodeGeoPackageGeometry(value any) (orb.Geometry, error) {
+	if value == nil {
+		return nil, nil
+	}
+	data, ok := value.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("geometry is a %T, expected a blob", value)
+	}
+	if len(data) < 8 || data[0] != 'G' || data[1] != 'P' {
+		return nil, errors.New("invalid GeoPackage geometry header")
+	}
+
+	flags := data[3]
+	if flags&0x20 != 0 {
+		return nil, errors.New("extended GeoPackage geometries are not supported")
+	}
+	if flags&0x10 != 0 {
+		return nil, nil
+	}
+
+	// The envelope holds 4, 6 or 8 doubles depending on its dimensions
+	envelopeSizes := []int{0, 32, 48, 48, 64}
+	indicator := int(flags>>1) & 0x07
+	if indicator >= len(envelopeSizes) {
+		return nil, fmt.Errorf("invalid GeoPackage envelope indicator %d", indicator)
+	}
+	offset := 8 + envelopeSizes[indicator]
+	if len(data) < offset {
+		return nil, errors.New("truncated GeoPackage geometry")
+	}
+	return decodeGeometry(data[offset:], GeometryEncodingWKB)
+}
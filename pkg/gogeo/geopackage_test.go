@@ -0,0 +1,281 @@
+package gogeo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/wkb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// testdata/small.gpkg is a GeoPackage with 512-byte pages written by SQLite. Its
+// places layer has 40 rows, so that the table b-tree has interior pages, the first
+// with a notes value spanning several overflow pages, and geometries with each kind
+// of envelope, a big-endian header, the empty flag and a NULL. Its "road lines"
+// layer has an undefined CRS and the stats table is not a feature table.
+func openGeoPackageFixture(t *testing.T, layer string) (*GeoPackageReader, error) {
+	t.Helper()
+	file, err := os.Open("testdata/small.gpkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewGeoPackageReader(file, info.Size(), layer)
+}
+
+func readGeoPackageFeatures(t *testing.T, reader *GeoPackageReader) []*geojson.Feature {
+	t.Helper()
+	var features []*geojson.Feature
+	for {
+		feature, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return features
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		features = append(features, feature)
+	}
+}
+
+func TestGeoPackageReader(t *testing.T) {
+	reader, err := openGeoPackageFixture(t, "places")
+	if err != nil {
+		t.Fatalf("NewGeoPackageReader() error = %v", err)
+	}
+	var crs struct {
+		ID struct {
+			Authority string `json:"authority"`
+			Code      int    `json:"code"`
+		} `json:"id"`
+	}
+	if err := json.Unmarshal(reader.CRS(), &crs); err != nil || crs.ID.Authority != "EPSG" || crs.ID.Code != 4326 {
+		t.Errorf("CRS() = %s, want EPSG:4326", reader.CRS())
+	}
+
+	features := readGeoPackageFeatures(t, reader)
+	if len(features) != 40 {
+		t.Fatalf("read %d features, want 40", len(features))
+	}
+	tests := []struct {
+		geometry   orb.Geometry
+		name       string
+		population any
+		area       any
+		notes      any
+	}{
+		{orb.Point{1, 2}, "point", int64(120), 1.5, strings.Repeat("overflow ", 400)},
+		{orb.LineString{{0, 0}, {1, 1}}, "line with an XY envelope", nil, nil, nil},
+		{orb.Polygon{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}}, "polygon with an XYZ envelope", int64(0), -2.25, ""},
+		{orb.Point{3, 4}, "big-endian with an XYZM envelope", int64(7), nil, nil},
+		{nil, "empty", nil, nil, nil},
+		{nil, "null", nil, nil, nil},
+	}
+	for i, tt := range tests {
+		feature := features[i]
+		fid := int64(i + 1)
+		if feature.ID != fid {
+			t.Errorf("feature %d has id %v", fid, feature.ID)
+		}
+		if tt.geometry == nil && feature.Geometry != nil || tt.geometry != nil && !orb.Equal(feature.Geometry, tt.geometry) {
+			t.Errorf("feature %d has geometry %v, want %v", fid, feature.Geometry, tt.geometry)
+		}
+		want := geojson.Properties{"fid": fid, "name": tt.name, "population": tt.population, "area": tt.area, "notes": tt.notes}
+		if !reflect.DeepEqual(feature.Properties, want) {
+			t.Errorf("feature %d has properties %v, want %v", fid, feature.Properties, want)
+		}
+	}
+	for i, feature := range features[6:] {
+		fid := int64(i + 7)
+		if feature.ID != fid || !orb.Equal(feature.Geometry, orb.Point{float64(fid), float64(-fid)}) {
+			t.Errorf("feature %d has id %v and geometry %v", fid, feature.ID, feature.Geometry)
+		}
+	}
+}
+
+func TestGeoPackageLayers(t *testing.T) {
+	file, err := os.Open("testdata/small.gpkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := GeoPackageLayers(file, info.Size())
+	if err != nil {
+		t.Fatalf("GeoPackageLayers() error = %v", err)
+	}
+	if want := []string{"places", "road lines"}; !slices.Equal(layers, want) {
+		t.Errorf("GeoPackageLayers() = %q, want %q", layers, want)
+	}
+
+	reader, err := openGeoPackageFixture(t, "road lines")
+	if err != nil {
+		t.Fatalf("NewGeoPackageReader() error = %v", err)
+	}
+	if crs := reader.CRS(); crs != nil {
+		t.Errorf("CRS() = %s, want none for srs_id 0", crs)
+	}
+	features := readGeoPackageFeatures(t, reader)
+	if len(features) != 1 || features[0].Properties["ref"] != "A1" || !orb.Equal(features[0].Geometry, orb.LineString{{5, 5}, {6, 6}}) {
+		t.Errorf("read %v, want the A1 road", features)
+	}
+
+	for layer, wantErr := range map[string]string{
+		"":      "GeoPackage has 2 feature layers, select one of places, road lines",
+		"stats": `layer "stats" not found`,
+	} {
+		if _, err := openGeoPackageFixture(t, layer); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("NewGeoPackageReader(%q) error = %v, want %q", layer, err, wantErr)
+		}
+	}
+}
+
+func TestGeoPackageTruncated(t *testing.T) {
+	data, err := os.ReadFile("testdata/small.gpkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cut the file in the middle of the places table
+	data = data[:len(data)/2]
+	reader, err := NewGeoPackageReader(bytes.NewReader(data), int64(len(data)), "places")
+	if err == nil {
+		for err == nil {
+			_, err = reader.Next()
+		}
+		if errors.Is(err, io.EOF) {
+			t.Fatal("read a truncated GeoPackage without error")
+		}
+	}
+	if !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("error = %v, want a page out of range", err)
+	}
+}
+
+func TestGeoPackageWAL(t *testing.T) {
+	data, err := os.ReadFile("testdata/small.gpkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Format versions 2 mark a database in WAL mode
+	data[18], data[19] = 2, 2
+	path := filepath.Join(t.TempDir(), "wal.gpkg")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	open := func() error {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		_, err = NewGeoPackageReader(file, int64(len(data)), "places")
+		return err
+	}
+	if err := open(); err != nil {
+		t.Errorf("NewGeoPackageReader() without a WAL file error = %v", err)
+	}
+	if err := os.WriteFile(path+"-wal", nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := open(); err != nil {
+		t.Errorf("NewGeoPackageReader() with an empty WAL file error = %v", err)
+	}
+	if err := os.WriteFile(path+"-wal", []byte("frames"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := open(); err == nil || !strings.Contains(err.Error(), "wal.gpkg-wal that are not checkpointed") {
+		t.Errorf("NewGeoPackageReader() with a WAL file error = %v, want not checkpointed", err)
+	}
+}
+
+func TestDecodeGeoPackageGeometry(t *testing.T) {
+	point, err := wkb.Marshal(orb.Point{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := func(flags byte, envelope int, data []byte) []byte {
+		header := []byte{'G', 'P', 0, flags}
+		header = binary.LittleEndian.AppendUint32(header, 4326)
+		for range envelope {
+			header = binary.LittleEndian.AppendUint64(header, math.Float64bits(1))
+		}
+		return append(header, data...)
+	}
+	tests := []struct {
+		name    string
+		value   any
+		want    orb.Geometry
+		wantErr string
+	}{
+		{"no envelope", blob(0x01, 0, point), orb.Point{1, 2}, ""},
+		{"XY envelope", blob(0x03, 4, point), orb.Point{1, 2}, ""},
+		{"XYZ envelope", blob(0x05, 6, point), orb.Point{1, 2}, ""},
+		{"XYM envelope", blob(0x07, 6, point), orb.Point{1, 2}, ""},
+		{"XYZM envelope", blob(0x09, 8, point), orb.Point{1, 2}, ""},
+		{"big-endian flag", blob(0x00, 0, point), orb.Point{1, 2}, ""},
+		{"empty", blob(0x11, 0, nil), nil, ""},
+		{"null", nil, nil, ""},
+		{"not a blob", "POINT (1 2)", nil, "geometry is a string, expected a blob"},
+		{"bad magic", append([]byte("XP\x00\x01\x00\x00\x00\x00"), point...), nil, "invalid GeoPackage geometry header"},
+		{"short header", []byte("GP\x00\x01"), nil, "invalid GeoPackage geometry header"},
+		{"extended", blob(0x21, 0, point), nil, "extended GeoPackage geometries are not supported"},
+		{"invalid envelope indicator", blob(0x0b, 0, point), nil, "invalid GeoPackage envelope indicator 5"},
+		{"truncated envelope", blob(0x03, 2, nil), nil, "truncated GeoPackage geometry"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeGeoPackageGeometry(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("decodeGeoPackageGeometry() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeGeoPackageGeometry() error = %v", err)
+			}
+			if tt.want == nil && got != nil || tt.want != nil && !orb.Equal(got, tt.want) {
+				t.Errorf("decodeGeoPackageGeometry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLiteVarint(t *testing.T) {
+	tests := []struct {
+		data   []byte
+		value  uint64
+		length int
+	}{
+		{[]byte{0x00}, 0, 1},
+		{[]byte{0x7f, 0xff}, 127, 1},
+		{[]byte{0x81, 0x00}, 128, 2},
+		{[]byte{0x82, 0x80, 0x01}, 0x8001, 3},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, math.MaxUint64, 9},
+	}
+	for _, tt := range tests {
+		value, length := sqliteVarint(tt.data)
+		if value != tt.value || length != tt.length {
+			t.Errorf("sqliteVarint(%x) = %d, %d, want %d, %d", tt.data, value, length, tt.value, tt.length)
+		}
+	}
+}
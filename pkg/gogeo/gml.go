@@ -0,0 +1,558 @@
+package gogeo
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// gmlNamespace prefixes the namespaces of GML 3.2 and earlier versions
+const gmlNamespace = "http://www.opengis.net/gml"
+
+// GMLDecoder streams the features of a GML document, such as a WFS GetFeature
+// response or a .gml export. The first geometry property of a feature becomes its
+// geometry; further geometry properties are kept as WKT strings and the other
+// properties are typed from their text.
+type GMLDecoder struct {
+	decoder *xml.Decoder
+	// Whether the decoder is inside a featureMembers element listing several features.
+	inMembers bool
+	// Whether the next element is the feature of a featureMember or member element.
+	pendingMember bool
+	// srsName of the first geometry declaring one.
+	srsName string
+	crs     json.RawMessage
+	count   int
+}
+
+// NewGMLDecoder creates a streaming decoder reading the features of a GML document.
+func NewGMLDecoder(r io.Reader) *GMLDecoder {
+	return &GMLDecoder{decoder: xml.NewDecoder(r)}
+}
+
+// CRS returns the PROJJSON definition of the srsName of the geometries read so far,
+// or nil if none declared one.
+func (d *GMLDecoder) CRS() json.RawMessage {
+	return d.crs
+}
+
+// Next decodes the next feature member of the document.
+func (d *GMLDecoder) Next() (*geojson.Feature, error) {
+	for {
+		token, err := d.decoder.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("failed to decode GML: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch {
+			case d.pendingMember || d.inMembers:
+				d.pendingMember = false
+				var member xmlNode
+				if err := d.decoder.DecodeElement(&member, &t); err != nil {
+					return nil, fmt.Errorf("failed to decode feature %d: %w", d.count+1, err)
+				}
+				d.count++
+				feature, err := d.feature(&member)
+				if err != nil {
+					return nil, fmt.Errorf("feature %d: %w", d.count, err)
+				}
+				return feature, nil
+			case t.Name.Local == "featureMember" || t.Name.Local == "member":
+				d.pendingMember = true
+			case t.Name.Local == "featureMembers":
+				d.inMembers = true
+			}
+		case xml.EndElement:
+			if t.Name.Local == "featureMembers" {
+				d.inMembers = false
+			}
+			d.pendingMember = false
+		}
+	}
+}
+
+// feature converts a feature element; its child elements are the properties
+func (d *GMLDecoder) feature(member *xmlNode) (*geojson.Feature, error) {
+	feature := geojson.NewFeature(nil)
+	for _, attr := range member.Attrs {
+		if attr.Name.Local == "id" || attr.Name.Local == "fid" {
+			feature.ID = attr.Value
+		}
+	}
+
+	for i := range member.Nodes {
+		property := &member.Nodes[i]
+		name := property.XMLName.Local
+		if name == "boundedBy" && isGMLElement(property) {
+			continue
+		}
+
+		if geometryNode := gmlGeometryChild(property); geometryNode != nil {
+			geometry, err := d.geometry(geometryNode)
+			if err != nil {
+				return nil, fmt.Errorf("property %s: %w", name, err)
+			}
+			if feature.Geometry == nil {
+				feature.Geometry = geometry
+				continue
+			}
+			// Further geometries can be written as geometry columns with --geometry-column
+			value, err := encodeCSVGeometry(geometry, CSVGeometryWKT)
+			if err != nil {
+				return nil, fmt.Errorf("property %s: %w", name, err)
+			}
+			addGMLProperty(feature.Properties, name, value)
+			continue
+		}
+		addGMLProperty(feature.Properties, name, gmlValue(property))
+	}
+	return feature, nil
+}
+
+// addGMLProperty sets a property, collecting the values of repeated properties in a list
+func addGMLProperty(properties geojson.Properties, name string, value any) {
+	existing, ok := properties[name]
+	if !ok {
+		properties[name] = value
+		return
+	}
+	if values, ok := existing.([]any); ok {
+		properties[name] = append(values, value)
+		return
+	}
+	properties[name] = []any{existing, value}
+}
+
+// gmlValue converts a property element: text is typed like CSV fields, nested
+// elements become maps and xsi:nil elements are null
+func gmlValue(node *xmlNode) any {
+	if node.attr("nil") == "true" {
+		return nil
+	}
+	if len(node.Nodes) == 0 {
+		return parseTextValue(strings.TrimSpace(node.Content))
+	}
+
+	values := make(geojson.Properties, len(node.Nodes))
+	for i := range node.Nodes {
+		addGMLProperty(values, node.Nodes[i].XMLName.Local, gmlValue(&node.Nodes[i]))
+	}
+	return map[string]any(values)
+}
+
+// isGMLElement reports whether an element belongs to a GML namespace
+func isGMLElement(node *xmlNode) bool {
+	return strings.HasPrefix(node.XMLName.Space, gmlNamespace)
+}
+
+// gmlGeometryChild returns the GML geometry held by a property element, if any
+func gmlGeometryChild(property *xmlNode) *xmlNode {
+	for i := range property.Nodes {
+		child := &property.Nodes[i]
+		if isGMLElement(child) && isGMLGeometry(child.XMLName.Local) {
+			return child
+		}
+	}
+	return nil
+}
+
+// isGMLGeometry reports whether a GML element is a supported geometry
+func isGMLGeometry(name string) bool {
+	switch name {
+	case "Point", "LineString", "LinearRing", "Curve", "Polygon", "Surface",
+		"MultiPoint", "MultiLineString", "MultiCurve", "MultiPolygon", "MultiSurface", "MultiGeometry":
+		return true
+	}
+	return false
+}
+
+// geometry converts a top-level geometry, recording the CRS of its srsName
+func (d *GMLDecoder) geometry(node *xmlNode) (orb.Geometry, error) {
+	srsName := node.attr("srsName")
+	if srsName != "" && d.srsName == "" {
+		d.srsName = srsName
+		crs, err := gmlCRS(srsName)
+		if err != nil {
+			return nil, err
+		}
+		d.crs = crs
+	}
+	if srsName == "" {
+		srsName = d.srsName
+	}
+
+	_, latFirst := parseSRSName(srsName)
+	reader := gmlGeometryReader{latFirst: latFirst, dimension: 2}
+	geometry, z, err := reader.read(node)
+	if err != nil {
+		return nil, err
+	}
+	return withZOrdinates(geometry, z), nil
+}
+
+// gmlGeometryReader converts GML geometries. z slices hold the Z ordinate of every
+// position in order and are nil for 2D geometries.
+type gmlGeometryReader struct {
+	// Whether the axis order of the CRS is latitude, longitude.
+	latFirst bool
+	// Inherited srsDimension.
+	dimension int
+}
+
+// read converts a geometry element
+func (r gmlGeometryReader) read(node *xmlNode) (orb.Geometry, []float64, error) {
+	if dimension := node.attr("srsDimension"); dimension != "" {
+		value, err := strconv.Atoi(dimension)
+		if err != nil || value < 2 || value > 4 {
+			return nil, nil, fmt.Errorf("invalid srsDimension %q", dimension)
+		}
+		r.dimension = value
+	}
+
+	switch node.XMLName.Local {
+	case "Point":
+		points, z, err := r.positions(node)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(points) != 1 {
+			return nil, nil, fmt.Errorf("point has %d positions", len(points))
+		}
+		return points[0], z, nil
+	case "LineString":
+		points, z, err := r.positions(node)
+		return orb.LineString(points), z, err
+	case "LinearRing":
+		points, z, err := r.positions(node)
+		return orb.Polygon{orb.Ring(points)}, z, err
+	case "Curve":
+		return r.curve(node)
+	case "Polygon":
+		return r.polygon(node)
+	case "Surface":
+		patches := node.child("patches")
+		if patches == nil {
+			return nil, nil, errors.New("surface has no patches")
+		}
+		return r.members(patches.Nodes, false)
+	case "MultiPoint", "MultiLineString", "MultiCurve", "MultiPolygon", "MultiSurface", "MultiGeometry":
+		var members []xmlNode
+		for _, member := range node.Nodes {
+			// Members are wrapped in a pointMember, curveMembers, geometryMember, ... element
+			members = append(members, member.Nodes...)
+		}
+		return r.members(members, node.XMLName.Local == "MultiGeometry")
+	default:
+		return nil, nil, fmt.Errorf("unsupported GML geometry %s", node.XMLName.Local)
+	}
+}
+
+// members combines the geometries of a multi-geometry. Surfaces and multi-geometries
+// among them are flattened so that a MultiSurface of Surfaces is a MultiPolygon.
+func (r gmlGeometryReader) members(nodes []xmlNode, collection bool) (orb.Geometry, []float64, error) {
+	var members []orb.Geometry
+	var zs [][]float64
+	for i := range nodes {
+		node := &nodes[i]
+		name := node.XMLName.Local
+		if name == "PolygonPatch" {
+			name = "Polygon"
+		}
+		if !isGMLGeometry(name) {
+			continue
+		}
+
+		var geometry orb.Geometry
+		var z []float64
+		var err error
+		if node.XMLName.Local == "PolygonPatch" {
+			geometry, z, err = r.polygon(node)
+		} else {
+			geometry, z, err = r.read(node)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch g := geometry.(type) {
+		case orb.MultiPolygon:
+			if collection {
+				break
+			}
+			offset := 0
+			for _, polygon := range g {
+				n := countPositions(polygon)
+				members = append(members, polygon)
+				zs = append(zs, sliceZ(z, offset, n))
+				offset += n
+			}
+			continue
+		case orb.MultiLineString:
+			if collection {
+				break
+			}
+			offset := 0
+			for _, line := range g {
+				members = append(members, line)
+				zs = append(zs, sliceZ(z, offset, len(line)))
+				offset += len(line)
+			}
+			continue
+		}
+		members = append(members, geometry)
+		zs = append(zs, z)
+	}
+
+	if len(members) == 0 {
+		return nil, nil, errors.New("multi-geometry has no members")
+	}
+	if len(members) == 1 && !collection {
+		if polygon, ok := members[0].(orb.Polygon); ok {
+			return polygon, zs[0], nil
+		}
+	}
+	geometry, z := combineMembers(members, zs)
+	return geometry, z, nil
+}
+
+// sliceZ returns the Z ordinates of n positions starting at offset, or nil for 2D geometries
+func sliceZ(z []float64, offset, n int) []float64 {
+	if z == nil {
+		return nil
+	}
+	return z[offset : offset+n]
+}
+
+// curve converts a Curve made of LineStringSegments into a line string
+func (r gmlGeometryReader) curve(node *xmlNode) (orb.Geometry, []float64, error) {
+	segments := node.child("segments")
+	if segments == nil {
+		return nil, nil, errors.New("curve has no segments")
+	}
+
+	var line orb.LineString
+	var z []float64
+	hasZ := false
+	for i := range segments.Nodes {
+		segment := &segments.Nodes[i]
+		if segment.XMLName.Local != "LineStringSegment" {
+			return nil, nil, fmt.Errorf("unsupported curve segment %s", segment.XMLName.Local)
+		}
+		points, segmentZ, err := r.positions(segment)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Consecutive segments share their end points
+		if len(line) > 0 && len(points) > 0 && line[len(line)-1] == points[0] {
+			points = points[1:]
+			if segmentZ != nil {
+				segmentZ = segmentZ[1:]
+			}
+		}
+		line = append(line, points...)
+		z = appendZ(z, segmentZ, len(points))
+		hasZ = hasZ || segmentZ != nil
+	}
+	if !hasZ {
+		z = nil
+	}
+	return line, z, nil
+}
+
+// polygon converts a Polygon or PolygonPatch, with GML 3 exterior and interior
+// rings or GML 2 outerBoundaryIs and innerBoundaryIs
+func (r gmlGeometryReader) polygon(node *xmlNode) (orb.Geometry, []float64, error) {
+	var polygon orb.Polygon
+	var z []float64
+	hasZ := false
+	for _, boundaries := range [][]string{{"exterior", "outerBoundaryIs"}, {"interior", "innerBoundaryIs"}} {
+		for i := range node.Nodes {
+			boundary := &node.Nodes[i]
+			if boundary.XMLName.Local != boundaries[0] && boundary.XMLName.Local != boundaries[1] {
+				continue
+			}
+			ring := boundary.child("LinearRing")
+			if ring == nil {
+				return nil, nil, fmt.Errorf("%s is not a LinearRing", boundary.XMLName.Local)
+			}
+			points, ringZ, err := r.positions(ring)
+			if err != nil {
+				return nil, nil, err
+			}
+			polygon = append(polygon, orb.Ring(points))
+			z = appendZ(z, ringZ, len(points))
+			hasZ = hasZ || ringZ != nil
+		}
+	}
+	if len(polygon) == 0 {
+		return nil, nil, errors.New("polygon has no exterior ring")
+	}
+	if !hasZ {
+		z = nil
+	}
+	return polygon, z, nil
+}
+
+// positions reads the positions of an element from a posList, GML 2 coordinates,
+// or pos and pointProperty elements
+func (r gmlGeometryReader) positions(node *xmlNode) ([]orb.Point, []float64, error) {
+	if posList := node.child("posList"); posList != nil {
+		dimension := r.dimension
+		if value := posList.attr("srsDimension"); value != "" {
+			var err error
+			if dimension, err = strconv.Atoi(value); err != nil || dimension < 2 || dimension > 4 {
+				return nil, nil, fmt.Errorf("invalid srsDimension %q", value)
+			}
+		}
+		return r.parsePositions(strings.Fields(posList.Content), dimension)
+	}
+
+	if coordinates := node.child("coordinates"); coordinates != nil {
+		// GML 2 separates the ordinates of a tuple with commas
+		var values []string
+		tuples := strings.Fields(coordinates.Content)
+		dimension := 2
+		if len(tuples) > 0 {
+			dimension = strings.Count(tuples[0], ",") + 1
+		}
+		for _, tuple := range tuples {
+			parts := strings.Split(tuple, ",")
+			if len(parts) != dimension {
+				return nil, nil, fmt.Errorf("invalid coordinates %q", tuple)
+			}
+			values = append(values, parts...)
+		}
+		return r.parsePositions(values, dimension)
+	}
+
+	var points []orb.Point
+	var z []float64
+	hasZ := false
+	for i := range node.Nodes {
+		var point []orb.Point
+		var pointZ []float64
+		var err error
+		switch child := &node.Nodes[i]; child.XMLName.Local {
+		case "pos":
+			fields := strings.Fields(child.Content)
+			point, pointZ, err = r.parsePositions(fields, max(len(fields), 1))
+		case "pointProperty", "pointRep":
+			if child.child("Point") == nil {
+				continue
+			}
+			point, pointZ, err = r.positions(child.child("Point"))
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		points = append(points, point...)
+		z = appendZ(z, pointZ, len(point))
+		hasZ = hasZ || pointZ != nil
+	}
+	if !hasZ {
+		z = nil
+	}
+	return points, z, nil
+}
+
+// parsePositions parses a flat list of ordinates; only the first three are kept
+func (r gmlGeometryReader) parsePositions(values []string, dimension int) ([]orb.Point, []float64, error) {
+	if len(values)%dimension != 0 {
+		return nil, nil, fmt.Errorf("%d ordinates do not form %d-dimensional positions", len(values), dimension)
+	}
+
+	points := make([]orb.Point, 0, len(values)/dimension)
+	var z []float64
+	for i := 0; i < len(values); i += dimension {
+		var ordinates [3]float64
+		for j := 0; j < dimension && j < 3; j++ {
+			value, err := strconv.ParseFloat(values[i+j], 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid ordinate %q", values[i+j])
+			}
+			ordinates[j] = value
+		}
+		if r.latFirst {
+			ordinates[0], ordinates[1] = ordinates[1], ordinates[0]
+		}
+		points = append(points, orb.Point{ordinates[0], ordinates[1]})
+		if dimension >= 3 {
+			z = append(z, ordinates[2])
+		}
+	}
+	return points, z, nil
+}
+
+// parseSRSName extracts the CRS code of an srsName, e.g. "EPSG:4326". latFirst reports
+// whether coordinates are in latitude, longitude order, which the URN and URL forms
+// use for geographic EPSG codes while the legacy forms keep longitude first.
+func parseSRSName(srsName string) (code string, latFirst bool) {
+	lower := strings.ToLower(srsName)
+	switch {
+	case strings.HasSuffix(lower, "crs84"):
+		return "OGC:CRS84", false
+	case strings.HasPrefix(lower, "urn:ogc:def:crs:epsg:"), strings.HasPrefix(lower, "urn:x-ogc:def:crs:epsg:"),
+		strings.HasPrefix(lower, "http://www.opengis.net/def/crs/epsg/"), strings.HasPrefix(lower, "https://www.opengis.net/def/crs/epsg/"):
+		number := srsName[strings.LastIndexAny(srsName, ":/")+1:]
+		epsg, err := strconv.Atoi(number)
+		if err != nil {
+			return "", false
+		}
+		return "EPSG:" + number, isGeographicEPSG(epsg)
+	case strings.HasPrefix(lower, "epsg:"):
+		return "EPSG:" + srsName[len("epsg:"):], false
+	case strings.HasPrefix(lower, "http://www.opengis.net/gml/srs/epsg.xml#"):
+		return "EPSG:" + srsName[strings.LastIndex(srsName, "#")+1:], false
+	}
+	return "", false
+}
+
+// isGeographicEPSG reports whether an EPSG code is most likely a geographic CRS,
+// whose authority axis order is latitude, longitude
+func isGeographicEPSG(code int) bool {
+	switch code {
+	case 4978, 4936:
+		// Geocentric
+		return false
+	case 7844, 6668, 9057:
+		return true
+	}
+	return code >= 4000 && code < 5000
+}
+
+// gmlCRS returns the PROJJSON definition of an srsName: the registered definition of
+// its code or an identifying name and code
+func gmlCRS(srsName string) (json.RawMessage, error) {
+	code, _ := parseSRSName(srsName)
+	if code == "" {
+		return nil, nil
+	}
+	if definition, err := LookupCRS(code); err == nil {
+		return definition, nil
+	}
+
+	authority, number, _ := strings.Cut(code, ":")
+	epsg, err := strconv.ParseInt(number, 10, 64)
+	if err != nil {
+		return nil, nil
+	}
+	crsType := "ProjectedCRS"
+	if isGeographicEPSG(int(epsg)) {
+		crsType = "GeographicCRS"
+	}
+	return minimalPROJJSON(code, authority, epsg, crsType)
+}
@@ -0,0 +1,255 @@
+package gogeo
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// gmlDocument wraps feature members in a WFS 1.1 FeatureCollection
+func gmlDocument(members ...string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<wfs:FeatureCollection xmlns:wfs="http://www.opengis.net/wfs" xmlns:gml="http://www.opengis.net/gml"
+	xmlns:app="urn:app" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">` +
+		strings.Join(members, "") + `</wfs:FeatureCollection>`
+}
+
+// gmlGeometryMember is a feature member whose geom property holds geometry
+func gmlGeometryMember(geometry string) string {
+	return `<gml:featureMember><app:place gml:id="p1"><app:geom>` + geometry + `</app:geom></app:place></gml:featureMember>`
+}
+
+func TestGMLDecoder(t *testing.T) {
+	tests := []struct {
+		name     string
+		geometry string
+		want     orb.Geometry
+	}{
+		{"legacy srsName keeps longitude first", `<gml:Point srsName="EPSG:4326"><gml:pos>1 2</gml:pos></gml:Point>`, orb.Point{1, 2}},
+		{"URN srsName is latitude first", `<gml:Point srsName="urn:ogc:def:crs:EPSG::4326"><gml:pos>2 1</gml:pos></gml:Point>`, orb.Point{1, 2}},
+		{"projected URN keeps easting first", `<gml:Point srsName="urn:ogc:def:crs:EPSG::3857"><gml:pos>1 2</gml:pos></gml:Point>`, orb.Point{1, 2}},
+		{"GML 2 coordinates", `<gml:Point><gml:coordinates>1,2</gml:coordinates></gml:Point>`, orb.Point{1, 2}},
+		{
+			"3D posList",
+			`<gml:LineString srsDimension="3"><gml:posList>0 0 5 1 1 6</gml:posList></gml:LineString>`,
+			GeometryZ{Geometry: orb.LineString{{0, 0}, {1, 1}}, Z: []float64{5, 6}},
+		},
+		{
+			"posList dimension",
+			`<gml:LineString><gml:posList srsDimension="4">0 0 5 9 1 1 6 9</gml:posList></gml:LineString>`,
+			GeometryZ{Geometry: orb.LineString{{0, 0}, {1, 1}}, Z: []float64{5, 6}},
+		},
+		{
+			"pos elements",
+			`<gml:LineString><gml:pos>0 0</gml:pos><gml:pos>1 1</gml:pos></gml:LineString>`,
+			orb.LineString{{0, 0}, {1, 1}},
+		},
+		{
+			"GML 3 polygon with a hole",
+			`<gml:Polygon><gml:exterior><gml:LinearRing><gml:posList>0 0 4 0 4 4 0 0</gml:posList></gml:LinearRing></gml:exterior>` +
+				`<gml:interior><gml:LinearRing><gml:posList>1 1 2 1 2 2 1 1</gml:posList></gml:LinearRing></gml:interior></gml:Polygon>`,
+			orb.Polygon{{{0, 0}, {4, 0}, {4, 4}, {0, 0}}, {{1, 1}, {2, 1}, {2, 2}, {1, 1}}},
+		},
+		{
+			"GML 2 polygon",
+			`<gml:Polygon><gml:outerBoundaryIs><gml:LinearRing><gml:coordinates>0,0 4,0 4,4 0,0</gml:coordinates></gml:LinearRing></gml:outerBoundaryIs></gml:Polygon>`,
+			orb.Polygon{{{0, 0}, {4, 0}, {4, 4}, {0, 0}}},
+		},
+		{
+			"curve segments share end points",
+			`<gml:Curve><gml:segments><gml:LineStringSegment><gml:posList>0 0 1 1</gml:posList></gml:LineStringSegment>` +
+				`<gml:LineStringSegment><gml:posList>1 1 2 0</gml:posList></gml:LineStringSegment></gml:segments></gml:Curve>`,
+			orb.LineString{{0, 0}, {1, 1}, {2, 0}},
+		},
+		{
+			"surface of one patch",
+			`<gml:Surface><gml:patches><gml:PolygonPatch><gml:exterior><gml:LinearRing><gml:posList>0 0 1 0 1 1 0 0</gml:posList></gml:LinearRing></gml:exterior></gml:PolygonPatch></gml:patches></gml:Surface>`,
+			orb.Polygon{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}},
+		},
+		{
+			"multi-surface of polygons",
+			`<gml:MultiSurface><gml:surfaceMember><gml:Polygon><gml:exterior><gml:LinearRing><gml:posList>0 0 1 0 1 1 0 0</gml:posList></gml:LinearRing></gml:exterior></gml:Polygon></gml:surfaceMember>` +
+				`<gml:surfaceMember><gml:Polygon><gml:exterior><gml:LinearRing><gml:posList>5 5 6 5 6 6 5 5</gml:posList></gml:LinearRing></gml:exterior></gml:Polygon></gml:surfaceMember></gml:MultiSurface>`,
+			orb.MultiPolygon{{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}}, {{{5, 5}, {6, 5}, {6, 6}, {5, 5}}}},
+		},
+		{
+			"multi-point with a members element",
+			`<gml:MultiPoint><gml:pointMembers><gml:Point><gml:pos>1 2</gml:pos></gml:Point><gml:Point><gml:pos>3 4</gml:pos></gml:Point></gml:pointMembers></gml:MultiPoint>`,
+			orb.MultiPoint{{1, 2}, {3, 4}},
+		},
+		{
+			"multi-geometry",
+			`<gml:MultiGeometry><gml:geometryMember><gml:Point><gml:pos>1 2</gml:pos></gml:Point></gml:geometryMember>` +
+				`<gml:geometryMember><gml:LineString><gml:posList>0 0 1 1</gml:posList></gml:LineString></gml:geometryMember></gml:MultiGeometry>`,
+			orb.Collection{orb.Point{1, 2}, orb.LineString{{0, 0}, {1, 1}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := NewGMLDecoder(strings.NewReader(gmlDocument(gmlGeometryMember(tt.geometry))))
+			feature, err := decoder.Next()
+			if err != nil {
+				t.Fatalf("Next() error = %v", err)
+			}
+			if !reflect.DeepEqual(feature.Geometry, tt.want) {
+				t.Errorf("geometry = %#v, want %#v", feature.Geometry, tt.want)
+			}
+			if _, err := decoder.Next(); !errors.Is(err, io.EOF) {
+				t.Errorf("Next() error = %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestGMLDecoderProperties(t *testing.T) {
+	input := gmlDocument(`<gml:featureMember><app:road fid="r1">
+		<gml:boundedBy><gml:Envelope><gml:lowerCorner>0 0</gml:lowerCorner><gml:upperCorner>1 1</gml:upperCorner></gml:Envelope></gml:boundedBy>
+		<app:centerline><gml:LineString><gml:posList>0 0 1 1</gml:posList></gml:LineString></app:centerline>
+		<app:start><gml:Point><gml:pos>0 0</gml:pos></gml:Point></app:start>
+		<app:name> Main &amp; 1st </app:name>
+		<app:lanes>2</app:lanes>
+		<app:width>7.5</app:width>
+		<app:paved>true</app:paved>
+		<app:code>007</app:code>
+		<app:closed xsi:nil="true"/>
+		<app:note></app:note>
+		<app:alias>A</app:alias>
+		<app:alias>B</app:alias>
+		<app:owner><app:name>City</app:name><app:id>3</app:id></app:owner>
+	</app:road></gml:featureMember>`)
+	feature, err := NewGMLDecoder(strings.NewReader(input)).Next()
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if feature.ID != "r1" {
+		t.Errorf("ID = %v, want r1", feature.ID)
+	}
+	if !orb.Equal(feature.Geometry, orb.LineString{{0, 0}, {1, 1}}) {
+		t.Errorf("geometry = %v, want the centerline", feature.Geometry)
+	}
+	want := geojson.Properties{
+		"start":  "POINT(0 0)",
+		"name":   "Main & 1st",
+		"lanes":  int64(2),
+		"width":  7.5,
+		"paved":  true,
+		"code":   "007",
+		"closed": nil,
+		"note":   nil,
+		"alias":  []any{"A", "B"},
+		"owner":  map[string]any{"name": "City", "id": int64(3)},
+	}
+	if !reflect.DeepEqual(feature.Properties, want) {
+		t.Errorf("properties = %#v, want %#v", feature.Properties, want)
+	}
+}
+
+func TestGMLDecoderMembers(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		ids   []any
+	}{
+		{
+			"featureMembers",
+			gmlDocument(`<gml:featureMembers><app:place gml:id="a"/><app:place gml:id="b"/></gml:featureMembers>`),
+			[]any{"a", "b"},
+		},
+		{
+			"WFS 2.0 members",
+			`<wfs:FeatureCollection xmlns:wfs="http://www.opengis.net/wfs/2.0" xmlns:gml="http://www.opengis.net/gml/3.2" xmlns:app="urn:app">` +
+				`<wfs:member><app:place gml:id="a"/></wfs:member><wfs:member><app:place gml:id="b"/></wfs:member></wfs:FeatureCollection>`,
+			[]any{"a", "b"},
+		},
+		{"no members", gmlDocument(), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := NewGMLDecoder(strings.NewReader(tt.input))
+			var ids []any
+			for {
+				feature, err := decoder.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Next() error = %v", err)
+				}
+				ids = append(ids, feature.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.ids) {
+				t.Errorf("decoded ids %v, want %v", ids, tt.ids)
+			}
+		})
+	}
+}
+
+func TestGMLDecoderCRS(t *testing.T) {
+	input := gmlDocument(
+		gmlGeometryMember(`<gml:Point srsName="urn:ogc:def:crs:EPSG::4326"><gml:pos>2 1</gml:pos></gml:Point>`),
+		// Later geometries without an srsName inherit the axis order of the first
+		gmlGeometryMember(`<gml:Point><gml:pos>4 3</gml:pos></gml:Point>`),
+	)
+	decoder := NewGMLDecoder(strings.NewReader(input))
+	if crs := decoder.CRS(); crs != nil {
+		t.Errorf("CRS() = %s before the first geometry", crs)
+	}
+	for _, want := range []orb.Point{{1, 2}, {3, 4}} {
+		feature, err := decoder.Next()
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		if !orb.Equal(feature.Geometry, want) {
+			t.Errorf("geometry = %v, want %v", feature.Geometry, want)
+		}
+	}
+	var crs struct {
+		ID struct {
+			Authority string `json:"authority"`
+			Code      int    `json:"code"`
+		} `json:"id"`
+	}
+	if err := json.Unmarshal(decoder.CRS(), &crs); err != nil || crs.ID.Authority != "EPSG" || crs.ID.Code != 4326 {
+		t.Errorf("CRS() = %s, want EPSG:4326", decoder.CRS())
+	}
+}
+
+func TestGMLDecoderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{"two positions in a point", gmlGeometryMember(`<gml:Point><gml:posList>1 2 3 4</gml:posList></gml:Point>`), "feature 1: property geom: point has 2 positions"},
+		{"odd ordinates", gmlGeometryMember(`<gml:LineString><gml:posList>0 0 1</gml:posList></gml:LineString>`), "3 ordinates do not form 2-dimensional positions"},
+		{"invalid ordinate", gmlGeometryMember(`<gml:Point><gml:pos>1 x</gml:pos></gml:Point>`), `invalid ordinate "x"`},
+		{"invalid srsDimension", gmlGeometryMember(`<gml:Point srsDimension="5"><gml:pos>1 2</gml:pos></gml:Point>`), `invalid srsDimension "5"`},
+		{"ragged coordinates", gmlGeometryMember(`<gml:LineString><gml:coordinates>0,0 1,1,1</gml:coordinates></gml:LineString>`), `invalid coordinates "1,1,1"`},
+		{"polygon without exterior", gmlGeometryMember(`<gml:Polygon/>`), "polygon has no exterior ring"},
+		{"boundary without ring", gmlGeometryMember(`<gml:Polygon><gml:exterior><gml:Ring/></gml:exterior></gml:Polygon>`), "exterior is not a LinearRing"},
+		{"curve without segments", gmlGeometryMember(`<gml:Curve/>`), "curve has no segments"},
+		{"arc segment", gmlGeometryMember(`<gml:Curve><gml:segments><gml:Arc/></gml:segments></gml:Curve>`), "unsupported curve segment Arc"},
+		{"surface without patches", gmlGeometryMember(`<gml:Surface/>`), "surface has no patches"},
+		{"empty multi-geometry", gmlGeometryMember(`<gml:MultiPoint/>`), "multi-geometry has no members"},
+		{"unclosed feature", `<gml:featureMember><app:place><app:name>x</app:place>`, "failed to decode feature 1"},
+		{"unclosed document", `<app:name>`, "failed to decode GML"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := tt.input
+			if strings.HasPrefix(input, "<gml:featureMember>") {
+				input = gmlDocument(input)
+			}
+			_, err := NewGMLDecoder(strings.NewReader(input)).Next()
+			if err == nil || errors.Is(err, io.EOF) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Next() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
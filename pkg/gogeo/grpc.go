@@ -0,0 +1,342 @@
+package gogeo
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb/geojson"
+)
+
+// gRPC
+const (
+	// ConvertMethod is the path of the Convert method of the gogeo.v1.Converter gRPC
+	// service, defined in proto/gogeo/v1/converter.proto.
+	ConvertMethod = "/gogeo.v1.Converter/Convert"
+	// maxGRPCMessageSize is the size of the largest request message accepted.
+	maxGRPCMessageSize = 64 << 20
+	// grpcChunkSize is the size of the chunks of the GeoParquet file of the responses.
+	grpcChunkSize = 1 << 20
+)
+
+// gRPC status codes
+const (
+	grpcOK                = 0
+	grpcCanceled          = 1
+	grpcInvalidArgument   = 3
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+)
+
+// ConvertServiceOptions configures a ConvertService.
+type ConvertServiceOptions struct {
+	// Options apply to every conversion, before those of the request.
+	Options []Option
+	// Sink creates the files of the requests naming an output, nil to only return
+	// the files to the clients.
+	Sink CreateFunc
+}
+
+// ConvertService is an http.Handler implementing the gogeo.v1.Converter gRPC service
+// over HTTP/2, defined in proto/gogeo/v1/converter.proto, so that other services can
+// convert features without running the CLI. Its Convert method reads the GeoJSON
+// features streamed by the client, buffering them to infer the schema, then streams
+// the GeoParquet file back in chunks, or writes it to the sink. Messages may be
+// compressed with gzip.
+type ConvertService struct {
+	options ConvertServiceOptions
+}
+
+// NewConvertService returns a ConvertService converting with the given options.
+func NewConvertService(options ConvertServiceOptions) *ConvertService {
+	return &ConvertService{options: options}
+}
+
+// grpcError is a failed call, with its gRPC status code
+type grpcError struct {
+	code    int
+	message string
+}
+
+func (e grpcError) Error() string {
+	return e.message
+}
+
+func (s *ConvertService) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.ProtoMajor != 2 || !strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC requests must use HTTP/2 and the application/grpc content type", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+
+	err := grpcError{code: grpcUnimplemented, message: fmt.Sprintf("unknown method %s", req.URL.Path)}
+	if req.URL.Path == ConvertMethod {
+		err = s.convert(w, req)
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(err.code))
+	if err.message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", grpcPercentEncode(err.message))
+	}
+}
+
+// convert runs the Convert method
+func (s *ConvertService) convert(w http.ResponseWriter, req *http.Request) grpcError {
+	messages := &grpcMessageReader{r: bufio.NewReader(req.Body), compression: req.Header.Get("Grpc-Encoding")}
+	first, err := messages.next()
+	if errors.Is(err, io.EOF) {
+		return grpcError{code: grpcInvalidArgument, message: "the request stream has no features"}
+	}
+	if err != nil {
+		return grpcStatus(err)
+	}
+	request, err := decodeConvertRequest(first)
+	if err != nil {
+		return grpcStatus(err)
+	}
+
+	opts := append(append([]Option{}, s.options.Options...), request.options.options()...)
+	cfg := newConfig(opts)
+	if err := cfg.validate(); err != nil {
+		return grpcError{code: grpcInvalidArgument, message: err.Error()}
+	}
+	output := request.options.output
+	if output != "" && s.options.Sink == nil {
+		return grpcError{code: grpcInvalidArgument, message: "the server has no sink to write an output to"}
+	}
+	if output != "" && !filepath.IsLocal(output) {
+		return grpcError{code: grpcInvalidArgument, message: fmt.Sprintf("invalid output %q, expected a relative path within the sink", output)}
+	}
+
+	reader := withContext(req.Context(), &convertRequestReader{messages: messages, pending: request.features})
+	if output != "" {
+		blob, err := s.options.Sink(output)
+		if err != nil {
+			return grpcError{code: grpcInternal, message: err.Error()}
+		}
+		report, err := generateBuffered(req.Context(), reader, blob, cfg)
+		if err != nil {
+			blob.Abort()
+			return grpcStatus(err)
+		}
+		if err := blob.Close(); err != nil {
+			return grpcError{code: grpcInternal, message: err.Error()}
+		}
+		response := protoAppendVarint(nil, 2, uint64(report.Features))
+		response = protoAppendBytes(response, 3, []byte(output))
+		if err := writeGRPCMessage(w, response); err != nil {
+			return grpcStatus(err)
+		}
+		return grpcError{code: grpcOK}
+	}
+
+	chunks := &grpcChunkWriter{w: w}
+	buffered := bufio.NewWriterSize(chunks, grpcChunkSize)
+	report, err := generateBuffered(req.Context(), reader, buffered, cfg)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err == nil {
+		err = writeGRPCMessage(w, protoAppendVarint(nil, 2, uint64(report.Features)))
+	}
+	if err != nil {
+		return grpcStatus(err)
+	}
+	return grpcError{code: grpcOK}
+}
+
+// grpcStatus returns the status of a failed call
+func grpcStatus(err error) grpcError {
+	var status grpcError
+	switch {
+	case errors.As(err, &status):
+		return grpcError{code: status.code, message: err.Error()}
+	case errors.Is(err, context.Canceled):
+		return grpcError{code: grpcCanceled, message: err.Error()}
+	}
+	return grpcError{code: grpcInvalidArgument, message: err.Error()}
+}
+
+// grpcPercentEncode encodes a status message for the grpc-message trailer
+func grpcPercentEncode(message string) string {
+	var encoded strings.Builder
+	for i := 0; i < len(message); i++ {
+		if c := message[i]; c >= ' ' && c <= '~' && c != '%' {
+			encoded.WriteByte(c)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return encoded.String()
+}
+
+// grpcMessageReader reads the length-prefixed messages of a gRPC request stream
+type grpcMessageReader struct {
+	r *bufio.Reader
+	// compression is the grpc-encoding of the compressed messages.
+	compression string
+}
+
+// next returns the next message, io.EOF at the end of the stream
+func (m *grpcMessageReader) next() ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(m.r, prefix[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, grpcError{code: grpcInvalidArgument, message: "truncated gRPC message"}
+		}
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxGRPCMessageSize {
+		return nil, grpcError{code: grpcResourceExhausted, message: fmt.Sprintf("message of %d bytes exceeds the limit of %d", size, maxGRPCMessageSize)}
+	}
+	message := make([]byte, size)
+	if _, err := io.ReadFull(m.r, message); err != nil {
+		return nil, grpcError{code: grpcInvalidArgument, message: "truncated gRPC message"}
+	}
+	if prefix[0] == 0 {
+		return message, nil
+	}
+
+	if m.compression != "gzip" {
+		return nil, grpcError{code: grpcUnimplemented, message: fmt.Sprintf("unsupported message compression %q, expected gzip", m.compression)}
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(message))
+	if err != nil {
+		return nil, grpcError{code: grpcInvalidArgument, message: "invalid gzip message"}
+	}
+	message, err = io.ReadAll(io.LimitReader(gz, maxGRPCMessageSize+1))
+	if err != nil {
+		return nil, grpcError{code: grpcInvalidArgument, message: "invalid gzip message"}
+	}
+	if len(message) > maxGRPCMessageSize {
+		return nil, grpcError{code: grpcResourceExhausted, message: fmt.Sprintf("message exceeds the limit of %d bytes", maxGRPCMessageSize)}
+	}
+	return message, nil
+}
+
+// writeGRPCMessage writes an uncompressed response message and sends it
+func writeGRPCMessage(w http.ResponseWriter, message []byte) error {
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(message)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	http.NewResponseController(w).Flush()
+	return nil
+}
+
+// grpcChunkWriter writes the GeoParquet file as the data of response messages
+type grpcChunkWriter struct {
+	w http.ResponseWriter
+}
+
+func (c *grpcChunkWriter) Write(data []byte) (int, error) {
+	if err := writeGRPCMessage(c.w, protoAppendBytes(nil, 1, data)); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// convertRequest is a decoded ConvertRequest message
+type convertRequest struct {
+	options  convertOptions
+	features []*geojson.Feature
+}
+
+// convertOptions is a decoded ConvertOptions message
+type convertOptions struct {
+	compression  string
+	bboxColumn   bool
+	rowGroupSize int64
+	output       string
+}
+
+// options returns the options of a conversion
+func (o convertOptions) options() []Option {
+	var opts []Option
+	if o.compression != "" {
+		opts = append(opts, WithCompression(o.compression))
+	}
+	if o.bboxColumn {
+		opts = append(opts, WithBBoxColumn())
+	}
+	if o.rowGroupSize > 0 {
+		opts = append(opts, WithRowGroupSize(o.rowGroupSize))
+	}
+	return opts
+}
+
+// decodeConvertRequest decodes a ConvertRequest message
+func decodeConvertRequest(message []byte) (*convertRequest, error) {
+	request := &convertRequest{}
+	err := protoFields(message, func(field protoField) error {
+		switch {
+		case field.number == 1 && field.wire == 2:
+			return protoFields(field.data, func(option protoField) error {
+				switch {
+				case option.number == 1 && option.wire == 2:
+					request.options.compression = string(option.data)
+				case option.number == 2 && option.wire == 0:
+					request.options.bboxColumn = option.value != 0
+				case option.number == 3 && option.wire == 0:
+					request.options.rowGroupSize = int64(option.value)
+				case option.number == 4 && option.wire == 2:
+					request.options.output = string(option.data)
+				}
+				return nil
+			})
+		case field.number == 2 && field.wire == 2:
+			feature, err := decodeFeature(field.data)
+			if err != nil {
+				return grpcError{code: grpcInvalidArgument, message: fmt.Sprintf("invalid GeoJSON feature: %v", err)}
+			}
+			request.features = append(request.features, feature)
+		}
+		return nil
+	})
+	if err != nil {
+		var status grpcError
+		if errors.As(err, &status) {
+			return nil, status
+		}
+		return nil, grpcError{code: grpcInvalidArgument, message: fmt.Sprintf("invalid ConvertRequest message: %v", err)}
+	}
+	return request, nil
+}
+
+// convertRequestReader returns the features of the messages of a request stream
+type convertRequestReader struct {
+	messages *grpcMessageReader
+	// pending holds the features of the current message not yet returned.
+	pending []*geojson.Feature
+}
+
+func (r *convertRequestReader) Next() (*geojson.Feature, error) {
+	for len(r.pending) == 0 {
+		message, err := r.messages.next()
+		if err != nil {
+			return nil, err
+		}
+		request, err := decodeConvertRequest(message)
+		if err != nil {
+			return nil, err
+		}
+		r.pending = request.features
+	}
+	feature := r.pending[0]
+	r.pending = r.pending[1:]
+	return feature, nil
+}
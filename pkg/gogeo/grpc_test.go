@@ -0,0 +1,244 @@
+package gogeo
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// grpcCall sends the messages of a Convert request stream to the service over HTTP/2
+// without TLS, and returns the response messages and the grpc-status and
+// grpc-message trailers
+func grpcCall(t *testing.T, service *ConvertService, method, encoding string, messages ...[]byte) ([][]byte, string, string) {
+	t.Helper()
+	server := httptest.NewUnstartedServer(service)
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	defer server.Close()
+
+	var body bytes.Buffer
+	for _, message := range messages {
+		var prefix [5]byte
+		if encoding != "" {
+			prefix[0] = 1
+			var compressed bytes.Buffer
+			gz := gzip.NewWriter(&compressed)
+			gz.Write(message)
+			gz.Close()
+			message = compressed.Bytes()
+		}
+		binary.BigEndian.PutUint32(prefix[1:], uint32(len(message)))
+		body.Write(prefix[:])
+		body.Write(message)
+	}
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	req, err := http.NewRequest(http.MethodPost, server.URL+method, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	if encoding != "" {
+		req.Header.Set("Grpc-Encoding", encoding)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("gRPC call error = %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("gRPC call used %s, want HTTP/2", resp.Proto)
+	}
+
+	var responses [][]byte
+	for {
+		var prefix [5]byte
+		if _, err := io.ReadFull(resp.Body, prefix[:]); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("reading the response: %v", err)
+		}
+		message := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+		if _, err := io.ReadFull(resp.Body, message); err != nil {
+			t.Fatalf("reading the response: %v", err)
+		}
+		responses = append(responses, message)
+	}
+	return responses, resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+}
+
+// convertRequestMessage encodes a ConvertRequest message
+func convertRequestMessage(options []byte, features ...string) []byte {
+	var message []byte
+	if options != nil {
+		message = protoAppendBytes(message, 1, options)
+	}
+	for _, feature := range features {
+		message = protoAppendBytes(message, 2, []byte(feature))
+	}
+	return message
+}
+
+// convertResponse is a decoded ConvertResponse stream
+type convertResponse struct {
+	data     []byte
+	features uint64
+	output   string
+}
+
+func decodeConvertResponses(t *testing.T, messages [][]byte) convertResponse {
+	t.Helper()
+	var response convertResponse
+	for _, message := range messages {
+		err := protoFields(message, func(field protoField) error {
+			switch field.number {
+			case 1:
+				response.data = append(response.data, field.data...)
+			case 2:
+				response.features = field.value
+			case 3:
+				response.output = string(field.data)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("invalid ConvertResponse message: %v", err)
+		}
+	}
+	return response
+}
+
+const (
+	grpcTestPoint = `{"type":"Feature","geometry":{"type":"Point","coordinates":[1,2]},"properties":{"name":"a"}}`
+	grpcTestLine  = `{"type":"Feature","geometry":{"type":"LineString","coordinates":[[1,2],[3,4]]},"properties":{"name":"b"}}`
+)
+
+func TestConvertServiceRoundTrip(t *testing.T) {
+	for _, encoding := range []string{"", "gzip"} {
+		t.Run("encoding "+strconv.Quote(encoding), func(t *testing.T) {
+			options := protoAppendBytes(nil, 1, []byte("snappy"))
+			options = protoAppendVarint(options, 3, 1)
+			messages, status, message := grpcCall(t, NewConvertService(ConvertServiceOptions{}), ConvertMethod, encoding,
+				convertRequestMessage(options, grpcTestPoint),
+				convertRequestMessage(nil, grpcTestLine, grpcTestPoint))
+			if status != "0" {
+				t.Fatalf("grpc-status = %q (%s), want 0", status, message)
+			}
+
+			response := decodeConvertResponses(t, messages)
+			if response.features != 3 {
+				t.Errorf("response reports %d features, want 3", response.features)
+			}
+			fc, err := ReadGeoParquetFrom(bytes.NewReader(response.data), int64(len(response.data)))
+			if err != nil {
+				t.Fatalf("ReadGeoParquetFrom() error = %v", err)
+			}
+			if len(fc.Features) != 3 {
+				t.Fatalf("read %d features, want 3", len(fc.Features))
+			}
+			for i, want := range []string{"a", "b", "a"} {
+				if name := fc.Features[i].Properties["name"]; name != want {
+					t.Errorf("feature %d has name %v, want %s", i, name, want)
+				}
+			}
+		})
+	}
+}
+
+type memoryBlob struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *memoryBlob) Close() error {
+	b.closed = true
+	return nil
+}
+
+func (b *memoryBlob) Abort() error {
+	return nil
+}
+
+func TestConvertServiceSink(t *testing.T) {
+	blobs := make(map[string]*memoryBlob)
+	service := NewConvertService(ConvertServiceOptions{Sink: func(name string) (BlobWriter, error) {
+		blobs[name] = &memoryBlob{}
+		return blobs[name], nil
+	}})
+	options := protoAppendBytes(nil, 4, []byte("roads/out.parquet"))
+	messages, status, message := grpcCall(t, service, ConvertMethod, "", convertRequestMessage(options, grpcTestLine))
+	if status != "0" {
+		t.Fatalf("grpc-status = %q (%s), want 0", status, message)
+	}
+
+	response := decodeConvertResponses(t, messages)
+	if response.features != 1 || response.output != "roads/out.parquet" || response.data != nil {
+		t.Errorf("response = %+v, want 1 feature written to roads/out.parquet", response)
+	}
+	blob, ok := blobs["roads/out.parquet"]
+	if !ok || !blob.closed {
+		t.Fatalf("the sink has no closed roads/out.parquet")
+	}
+	if _, err := ReadGeoParquetFrom(bytes.NewReader(blob.Bytes()), int64(blob.Len())); err != nil {
+		t.Errorf("ReadGeoParquetFrom() error = %v", err)
+	}
+}
+
+func TestConvertServiceErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		messages [][]byte
+		status   string
+		message  string
+	}{
+		{"unknown method", "/gogeo.v1.Converter/Other", nil, "12", "unknown method /gogeo.v1.Converter/Other"},
+		{"no messages", ConvertMethod, nil, "3", "the request stream has no features"},
+		{"invalid feature", ConvertMethod, [][]byte{convertRequestMessage(nil, `{"type":`)}, "3", "invalid GeoJSON feature"},
+		{"invalid message", ConvertMethod, [][]byte{{0x0a, 0x05}}, "3", "invalid ConvertRequest message: truncated protobuf field"},
+		{"output without sink", ConvertMethod, [][]byte{convertRequestMessage(protoAppendBytes(nil, 4, []byte("out.parquet")), grpcTestPoint)}, "3", "the server has no sink to write an output to"},
+		{"invalid compression", ConvertMethod, [][]byte{convertRequestMessage(protoAppendBytes(nil, 1, []byte("rar")), grpcTestPoint)}, "3", "rar"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, status, message := grpcCall(t, NewConvertService(ConvertServiceOptions{}), tt.method, "", tt.messages...)
+			if status != tt.status || !strings.Contains(message, tt.message) {
+				t.Errorf("grpc-status = %q (%s), want %s (%s)", status, message, tt.status, tt.message)
+			}
+		})
+	}
+}
+
+func TestGRPCMessageReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		stream  string
+		status  int
+		message string
+	}{
+		{"truncated prefix", "\x00\x00\x00", grpcInvalidArgument, "truncated gRPC message"},
+		{"truncated message", "\x00\x00\x00\x00\x05abc", grpcInvalidArgument, "truncated gRPC message"},
+		{"oversized message", "\x00\x04\x00\x00\x01", grpcResourceExhausted, "exceeds the limit"},
+		{"compressed without encoding", "\x01\x00\x00\x00\x01a", grpcUnimplemented, "unsupported message compression"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := &grpcMessageReader{r: bufio.NewReader(strings.NewReader(tt.stream))}
+			_, err := messages.next()
+			status := grpcStatus(err)
+			if status.code != tt.status || !strings.Contains(status.message, tt.message) {
+				t.Errorf("next() error = %v (code %d), want %q (code %d)", err, status.code, tt.message, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,382 @@
+package gogeo
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/paulmach/orb"
+)
+
+// maxH3Resolution is the resolution of the smallest H3 cells, about 1 m² in area
+const maxH3Resolution = 15
+
+// h3Res0Gnomonic is the distance between the centers of adjacent resolution 0 cells in
+// the gnomonic projection of a face, and h3ClassIIIRotation the angle between the axes
+// of the grids of odd and even resolutions.
+const (
+	h3Res0Gnomonic     = 0.38196601125010500003
+	h3ClassIIIRotation = 0.333473172251832115336090755351601070065900389
+)
+
+// The digits of the H3 cells are the unit vectors of the i, j and k axes from the
+// center of the parent cell to that of the child, as bits
+const (
+	h3CenterDigit = 0
+	h3KDigit      = 1
+	h3NoDigit     = 7
+)
+
+var (
+	// h3FaceCenters holds the latitude and longitude in radians of the centers of the
+	// faces of the icosahedron, and h3FacePoints their point on the unit sphere.
+	h3FaceCenters = [20][2]float64{
+		{0.803582649718989942, 1.248397419617396099},
+		{1.307747883455638156, 2.536945009877921159},
+		{1.054751253523952054, -1.347517358900396623},
+		{0.600191595538186799, -0.450603909469755746},
+		{0.491715428198773866, 0.401988202911306943},
+		{0.172745327415618701, 1.678146885280433686},
+		{0.605929321571350690, 2.953923329812411617},
+		{0.427370518328979641, -1.888876200336285401},
+		{-0.079066118549212831, -0.733429513380867741},
+		{-0.230961644455383637, 0.506495587332349035},
+		{0.079066118549212831, 2.408163140208925497},
+		{0.230961644455383637, -2.635097066257444203},
+		{-0.172745327415618701, -1.463445768309359553},
+		{-0.605929321571350690, -0.187669323777381622},
+		{-0.427370518328979641, 1.252716453253507838},
+		{-0.600191595538186799, 2.690988744120037492},
+		{-0.491715428198773866, -2.739604450678486295},
+		{-0.803582649718989942, -1.893195233972397139},
+		{-1.307747883455638156, -0.604647643711872080},
+		{-1.054751253523952054, 1.794075294689396615},
+	}
+	h3FacePoints [20][3]float64
+	// h3FaceAxes holds the azimuth in radians of the i axis of each face, pointing to
+	// one of its vertices.
+	h3FaceAxes = [20]float64{
+		5.619958268523939882, 5.760339081714187279, 0.780213654393430055, 0.430469363979999913,
+		6.130269123335111400, 2.692877706530642877, 2.982963003477243874, 3.532912002790141181,
+		3.494305004259568154, 3.003214169499538391, 5.930472956509811562, 0.138378484090254847,
+		0.448714947059150361, 0.158629650112549365, 5.891865957979238535, 2.711123289609793325,
+		3.294508837434268316, 3.804819692245439833, 3.664438879055192436, 2.361378999196363184,
+	}
+	// h3BaseCells gives, for the i, j and k coordinates from 0 to 2 of the resolution 0
+	// cells around each face, the base cell and the number of 60° counterclockwise
+	// rotations from the axes of the face to those of the home face of the base cell.
+	h3BaseCells = [20][3][3][3][2]int{
+		{ // face 0
+			{{{16, 0}, {18, 0}, {24, 0}}, {{33, 0}, {30, 0}, {32, 3}}, {{49, 1}, {48, 3}, {50, 3}}},
+			{{{8, 0}, {5, 5}, {10, 5}}, {{22, 0}, {16, 0}, {18, 0}}, {{41, 1}, {33, 0}, {30, 0}}},
+			{{{4, 0}, {0, 5}, {2, 5}}, {{15, 1}, {8, 0}, {5, 5}}, {{31, 1}, {22, 0}, {16, 0}}},
+		},
+		{ // face 1
+			{{{2, 0}, {6, 0}, {14, 0}}, {{10, 0}, {11, 0}, {17, 3}}, {{24, 1}, {23, 3}, {25, 3}}},
+			{{{0, 0}, {1, 5}, {9, 5}}, {{5, 0}, {2, 0}, {6, 0}}, {{18, 1}, {10, 0}, {11, 0}}},
+			{{{4, 1}, {3, 5}, {7, 5}}, {{8, 1}, {0, 0}, {1, 5}}, {{16, 1}, {5, 0}, {2, 0}}},
+		},
+		{ // face 2
+			{{{7, 0}, {21, 0}, {38, 0}}, {{9, 0}, {19, 0}, {34, 3}}, {{14, 1}, {20, 3}, {36, 3}}},
+			{{{3, 0}, {13, 5}, {29, 5}}, {{1, 0}, {7, 0}, {21, 0}}, {{6, 1}, {9, 0}, {19, 0}}},
+			{{{4, 2}, {12, 5}, {26, 5}}, {{0, 1}, {3, 0}, {13, 5}}, {{2, 1}, {1, 0}, {7, 0}}},
+		},
+		{ // face 3
+			{{{26, 0}, {42, 0}, {58, 0}}, {{29, 0}, {43, 0}, {62, 3}}, {{38, 1}, {47, 3}, {64, 3}}},
+			{{{12, 0}, {28, 5}, {44, 5}}, {{13, 0}, {26, 0}, {42, 0}}, {{21, 1}, {29, 0}, {43, 0}}},
+			{{{4, 3}, {15, 5}, {31, 5}}, {{3, 1}, {12, 0}, {28, 5}}, {{7, 1}, {13, 0}, {26, 0}}},
+		},
+		{ // face 4
+			{{{31, 0}, {41, 0}, {49, 0}}, {{44, 0}, {53, 0}, {61, 3}}, {{58, 1}, {65, 3}, {75, 3}}},
+			{{{15, 0}, {22, 5}, {33, 5}}, {{28, 0}, {31, 0}, {41, 0}}, {{42, 1}, {44, 0}, {53, 0}}},
+			{{{4, 4}, {8, 5}, {16, 5}}, {{12, 1}, {15, 0}, {22, 5}}, {{26, 1}, {28, 0}, {31, 0}}},
+		},
+		{ // face 5
+			{{{50, 0}, {48, 0}, {49, 3}}, {{32, 0}, {30, 3}, {33, 3}}, {{24, 3}, {18, 3}, {16, 3}}},
+			{{{70, 0}, {67, 0}, {66, 3}}, {{52, 3}, {50, 0}, {48, 0}}, {{37, 3}, {32, 0}, {30, 3}}},
+			{{{83, 0}, {87, 3}, {85, 3}}, {{74, 3}, {70, 0}, {67, 0}}, {{57, 3}, {52, 3}, {50, 0}}},
+		},
+		{ // face 6
+			{{{25, 0}, {23, 0}, {24, 3}}, {{17, 0}, {11, 3}, {10, 3}}, {{14, 3}, {6, 3}, {2, 3}}},
+			{{{45, 0}, {39, 0}, {37, 3}}, {{35, 3}, {25, 0}, {23, 0}}, {{27, 3}, {17, 0}, {11, 3}}},
+			{{{63, 0}, {59, 3}, {57, 3}}, {{56, 3}, {45, 0}, {39, 0}}, {{46, 3}, {35, 3}, {25, 0}}},
+		},
+		{ // face 7
+			{{{36, 0}, {20, 0}, {14, 3}}, {{34, 0}, {19, 3}, {9, 3}}, {{38, 3}, {21, 3}, {7, 3}}},
+			{{{55, 0}, {40, 0}, {27, 3}}, {{54, 3}, {36, 0}, {20, 0}}, {{51, 3}, {34, 0}, {19, 3}}},
+			{{{72, 0}, {60, 3}, {46, 3}}, {{73, 3}, {55, 0}, {40, 0}}, {{71, 3}, {54, 3}, {36, 0}}},
+		},
+		{ // face 8
+			{{{64, 0}, {47, 0}, {38, 3}}, {{62, 0}, {43, 3}, {29, 3}}, {{58, 3}, {42, 3}, {26, 3}}},
+			{{{84, 0}, {69, 0}, {51, 3}}, {{82, 3}, {64, 0}, {47, 0}}, {{76, 3}, {62, 0}, {43, 3}}},
+			{{{97, 0}, {89, 3}, {71, 3}}, {{98, 3}, {84, 0}, {69, 0}}, {{96, 3}, {82, 3}, {64, 0}}},
+		},
+		{ // face 9
+			{{{75, 0}, {65, 0}, {58, 3}}, {{61, 0}, {53, 3}, {44, 3}}, {{49, 3}, {41, 3}, {31, 3}}},
+			{{{94, 0}, {86, 0}, {76, 3}}, {{81, 3}, {75, 0}, {65, 0}}, {{66, 3}, {61, 0}, {53, 3}}},
+			{{{107, 0}, {104, 3}, {96, 3}}, {{101, 3}, {94, 0}, {86, 0}}, {{85, 3}, {81, 3}, {75, 0}}},
+		},
+		{ // face 10
+			{{{57, 0}, {59, 0}, {63, 3}}, {{74, 0}, {78, 0}, {79, 3}}, {{83, 3}, {92, 3}, {95, 3}}},
+			{{{37, 0}, {39, 3}, {45, 3}}, {{52, 0}, {57, 0}, {59, 0}}, {{70, 3}, {74, 0}, {78, 0}}},
+			{{{24, 0}, {23, 3}, {25, 3}}, {{32, 3}, {37, 0}, {39, 3}}, {{50, 3}, {52, 0}, {57, 0}}},
+		},
+		{ // face 11
+			{{{46, 0}, {60, 0}, {72, 3}}, {{56, 0}, {68, 0}, {80, 3}}, {{63, 3}, {77, 3}, {90, 3}}},
+			{{{27, 0}, {40, 3}, {55, 3}}, {{35, 0}, {46, 0}, {60, 0}}, {{45, 3}, {56, 0}, {68, 0}}},
+			{{{14, 0}, {20, 3}, {36, 3}}, {{17, 3}, {27, 0}, {40, 3}}, {{25, 3}, {35, 0}, {46, 0}}},
+		},
+		{ // face 12
+			{{{71, 0}, {89, 0}, {97, 3}}, {{73, 0}, {91, 0}, {103, 3}}, {{72, 3}, {88, 3}, {105, 3}}},
+			{{{51, 0}, {69, 3}, {84, 3}}, {{54, 0}, {71, 0}, {89, 0}}, {{55, 3}, {73, 0}, {91, 0}}},
+			{{{38, 0}, {47, 3}, {64, 3}}, {{34, 3}, {51, 0}, {69, 3}}, {{36, 3}, {54, 0}, {71, 0}}},
+		},
+		{ // face 13
+			{{{96, 0}, {104, 0}, {107, 3}}, {{98, 0}, {110, 0}, {115, 3}}, {{97, 3}, {111, 3}, {119, 3}}},
+			{{{76, 0}, {86, 3}, {94, 3}}, {{82, 0}, {96, 0}, {104, 0}}, {{84, 3}, {98, 0}, {110, 0}}},
+			{{{58, 0}, {65, 3}, {75, 3}}, {{62, 3}, {76, 0}, {86, 3}}, {{64, 3}, {82, 0}, {96, 0}}},
+		},
+		{ // face 14
+			{{{85, 0}, {87, 0}, {83, 3}}, {{101, 0}, {102, 0}, {100, 3}}, {{107, 3}, {112, 3}, {114, 3}}},
+			{{{66, 0}, {67, 3}, {70, 3}}, {{81, 0}, {85, 0}, {87, 0}}, {{94, 3}, {101, 0}, {102, 0}}},
+			{{{49, 0}, {48, 3}, {50, 3}}, {{61, 3}, {66, 0}, {67, 3}}, {{75, 3}, {81, 0}, {85, 0}}},
+		},
+		{ // face 15
+			{{{95, 0}, {92, 0}, {83, 0}}, {{79, 0}, {78, 3}, {74, 3}}, {{63, 1}, {59, 3}, {57, 3}}},
+			{{{109, 0}, {108, 5}, {100, 5}}, {{93, 0}, {95, 0}, {92, 0}}, {{77, 1}, {79, 0}, {78, 3}}},
+			{{{117, 0}, {118, 5}, {114, 5}}, {{106, 1}, {109, 0}, {108, 5}}, {{90, 1}, {93, 0}, {95, 0}}},
+		},
+		{ // face 16
+			{{{90, 0}, {77, 0}, {63, 0}}, {{80, 0}, {68, 3}, {56, 3}}, {{72, 1}, {60, 3}, {46, 3}}},
+			{{{106, 0}, {93, 5}, {79, 5}}, {{99, 0}, {90, 0}, {77, 0}}, {{88, 1}, {80, 0}, {68, 3}}},
+			{{{117, 4}, {109, 5}, {95, 5}}, {{113, 1}, {106, 0}, {93, 5}}, {{105, 1}, {99, 0}, {90, 0}}},
+		},
+		{ // face 17
+			{{{105, 0}, {88, 0}, {72, 0}}, {{103, 0}, {91, 3}, {73, 3}}, {{97, 1}, {89, 3}, {71, 3}}},
+			{{{113, 0}, {99, 5}, {80, 5}}, {{116, 0}, {105, 0}, {88, 0}}, {{111, 1}, {103, 0}, {91, 3}}},
+			{{{117, 3}, {106, 5}, {90, 5}}, {{121, 1}, {113, 0}, {99, 5}}, {{119, 1}, {116, 0}, {105, 0}}},
+		},
+		{ // face 18
+			{{{119, 0}, {111, 0}, {97, 0}}, {{115, 0}, {110, 3}, {98, 3}}, {{107, 1}, {104, 3}, {96, 3}}},
+			{{{121, 0}, {116, 5}, {103, 5}}, {{120, 0}, {119, 0}, {111, 0}}, {{112, 1}, {115, 0}, {110, 3}}},
+			{{{117, 2}, {113, 5}, {105, 5}}, {{118, 1}, {121, 0}, {116, 5}}, {{114, 1}, {120, 0}, {119, 0}}},
+		},
+		{ // face 19
+			{{{114, 0}, {112, 0}, {107, 0}}, {{100, 0}, {102, 3}, {101, 3}}, {{83, 1}, {87, 3}, {85, 3}}},
+			{{{118, 0}, {120, 5}, {115, 5}}, {{108, 0}, {114, 0}, {112, 0}}, {{92, 1}, {100, 0}, {102, 3}}},
+			{{{117, 1}, {121, 5}, {119, 5}}, {{109, 1}, {118, 0}, {120, 5}}, {{95, 1}, {108, 0}, {114, 0}}},
+		},
+	}
+	// h3Pentagons maps the base cells that are pentagons to the faces, if any, where
+	// the digits of a cell leaving the missing k axis are rotated clockwise rather than
+	// counterclockwise.
+	h3Pentagons = map[int][2]int{
+		4: {-1, -1}, 14: {2, 6}, 24: {1, 5}, 38: {3, 7}, 49: {0, 9}, 58: {4, 8},
+		63: {11, 15}, 72: {12, 16}, 83: {10, 19}, 97: {13, 17}, 107: {14, 18}, 117: {-1, -1},
+	}
+	// h3RotateCCW and h3RotateCW map the digits to those rotated by 60°.
+	h3RotateCCW = [7]int{0, 5, 3, 1, 6, 4, 2}
+	h3RotateCW  = [7]int{0, 3, 6, 2, 5, 1, 4}
+)
+
+func init() {
+	for face, center := range h3FaceCenters {
+		h3FacePoints[face] = unitVector(center[0], center[1])
+	}
+}
+
+// WithH3Column adds a UINT64 column holding the id of the H3 cell of the given
+// resolution, from 0 to 15, containing the centroid of each feature geometry, after any
+// geometry transformation. The ids are those of the H3 library, so the column joins
+// H3-indexed datasets. The coordinates must be longitudes and latitudes.
+func WithH3Column(name string, resolution int) Option {
+	return func(cfg *config) {
+		if resolution < 0 || resolution > maxH3Resolution {
+			cfg.fail(AppError{Message: fmt.Sprintf("invalid H3 resolution %d, expected 0 to %d", resolution, maxH3Resolution)})
+			return
+		}
+		cfg.addCellColumn(cellColumn{name: name, system: cellH3, level: resolution})
+	}
+}
+
+// h3CellID returns the id of the H3 cell of a resolution containing a point of
+// longitude and latitude. The point is projected onto the closest face of an
+// icosahedron, the cell containing it is found in the hexagonal grid of the face, and
+// its ancestors are walked up to the resolution 0 base cell, each step giving a digit
+// of the id. The digits are then rotated to the axes of the home face of the base cell.
+func h3CellID(point orb.Point, resolution int) uint64 {
+	face, coord := h3FaceCoord(point, resolution)
+
+	digits := make([]int, resolution)
+	for r := resolution - 1; r >= 0; r-- {
+		// The grids of odd resolutions are rotated counterclockwise from those of
+		// their parents, and those of even resolutions clockwise
+		last, odd := coord, (r+1)%2 == 1
+		coord = coord.parent(odd)
+		digits[r] = last.sub(coord.child(odd)).digit()
+	}
+
+	entry := h3BaseCells[face][coord[0]][coord[1]][coord[2]]
+	base, rotations := entry[0], entry[1]
+	if offsets, ok := h3Pentagons[base]; ok {
+		// Cells of pentagons have no k axis subsequence, they are rotated out of it
+		if h3LeadingDigit(digits) == h3KDigit {
+			if face == offsets[0] || face == offsets[1] {
+				h3Rotate(digits, h3RotateCW)
+			} else {
+				h3Rotate(digits, h3RotateCCW)
+			}
+		}
+		for range rotations {
+			h3RotatePentagon(digits)
+		}
+	} else {
+		for range rotations {
+			h3Rotate(digits, h3RotateCCW)
+		}
+	}
+
+	id := uint64(1)<<59 | uint64(resolution)<<52 | uint64(base)<<45 //nolint:gosec
+	for r := range maxH3Resolution {
+		digit := h3NoDigit
+		if r < resolution {
+			digit = digits[r]
+		}
+		id |= uint64(digit) << (3 * (maxH3Resolution - 1 - r)) //nolint:gosec
+	}
+	return id
+}
+
+// h3FaceCoord returns the face of the icosahedron closest to a point of longitude and
+// latitude, and the coordinates of the cell of a resolution containing it in the grid
+// of that face
+func h3FaceCoord(point orb.Point, resolution int) (int, h3Coord) {
+	lat, lng := point[1]*math.Pi/180, point[0]*math.Pi/180
+	p := unitVector(lat, lng)
+	face, sqd := 0, math.Inf(1)
+	for f, center := range h3FacePoints {
+		d := (p[0]-center[0])*(p[0]-center[0]) + (p[1]-center[1])*(p[1]-center[1]) + (p[2]-center[2])*(p[2]-center[2])
+		if d < sqd {
+			face, sqd = f, d
+		}
+	}
+
+	r := math.Acos(1 - sqd/2)
+	if r < 1e-16 {
+		return face, h3Coord{}
+	}
+	center := h3FaceCenters[face]
+	azimuth := math.Atan2(math.Cos(lat)*math.Sin(lng-center[1]),
+		math.Cos(center[0])*math.Sin(lat)-math.Sin(center[0])*math.Cos(lat)*math.Cos(lng-center[1]))
+	theta := positiveAngle(h3FaceAxes[face] - positiveAngle(azimuth))
+	if resolution%2 == 1 {
+		theta = positiveAngle(theta - h3ClassIIIRotation)
+	}
+	// Gnomonic projection, scaled to the distance between the cells
+	r = math.Tan(r) / h3Res0Gnomonic
+	for range resolution {
+		r *= math.Sqrt(7)
+	}
+	return face, h3Round(r*math.Cos(theta), r*math.Sin(theta))
+}
+
+// h3Coord is a position in the i, j and k coordinates of the hexagonal grid of a face,
+// whose axes are 120° apart. Normalized coordinates are not negative and one of them
+// is 0.
+type h3Coord [3]int
+
+// h3Round returns the coordinates of the cell center closest to a position of the
+// plane of a face, the i axis along x
+func h3Round(x, y float64) h3Coord {
+	// Cube coordinates of the axes at 0° and 60°
+	b := y / (math.Sqrt(3) / 2)
+	a := x - b/2
+	c := -a - b
+	ra, rb, rc := math.Round(a), math.Round(b), math.Round(c)
+	da, db, dc := math.Abs(ra-a), math.Abs(rb-b), math.Abs(rc-c)
+	if da > db && da > dc {
+		ra = -rb - rc
+	} else if db > dc {
+		rb = -ra - rc
+	}
+	return h3Coord{int(ra + rb), int(rb), 0}.normalize()
+}
+
+func (c h3Coord) normalize() h3Coord {
+	m := min(c[0], c[1], c[2])
+	return h3Coord{c[0] - m, c[1] - m, c[2] - m}
+}
+
+func (c h3Coord) sub(other h3Coord) h3Coord {
+	return h3Coord{c[0] - other[0], c[1] - other[1], c[2] - other[2]}.normalize()
+}
+
+// parent returns the coordinates of the parent of a cell of an odd or even resolution
+// in the grid of the previous resolution
+func (c h3Coord) parent(odd bool) h3Coord {
+	i, j := float64(c[0]-c[2]), float64(c[1]-c[2])
+	if odd {
+		return h3Coord{int(math.Round((3*i - j) / 7)), int(math.Round((i + 2*j) / 7)), 0}.normalize()
+	}
+	return h3Coord{int(math.Round((2*i + j) / 7)), int(math.Round((3*j - i) / 7)), 0}.normalize()
+}
+
+// child returns the coordinates of the center child of a cell in the grid of the next
+// resolution, odd or even, the reverse of parent
+func (c h3Coord) child(odd bool) h3Coord {
+	i, j, k := c[0], c[1], c[2]
+	if odd {
+		return h3Coord{3*i + j, 3*j + k, i + 3*k}.normalize()
+	}
+	return h3Coord{3*i + k, i + 3*j, j + 3*k}.normalize()
+}
+
+// digit returns the digit of a unit vector, its normalized coordinates as bits
+func (c h3Coord) digit() int {
+	return c[0]<<2 | c[1]<<1 | c[2]
+}
+
+// h3LeadingDigit returns the first digit of a cell that is not the center one
+func h3LeadingDigit(digits []int) int {
+	for _, digit := range digits {
+		if digit != h3CenterDigit {
+			return digit
+		}
+	}
+	return h3CenterDigit
+}
+
+// h3Rotate rotates the digits of a cell by 60° with one of h3RotateCCW and h3RotateCW
+func h3Rotate(digits []int, rotation [7]int) {
+	for r, digit := range digits {
+		digits[r] = rotation[digit]
+	}
+}
+
+// h3RotatePentagon rotates the digits of a cell of a pentagon by 60° counterclockwise,
+// skipping the missing k axis subsequence
+func h3RotatePentagon(digits []int) {
+	found := false
+	for r, digit := range digits {
+		digits[r] = h3RotateCCW[digit]
+		if !found && digits[r] != h3CenterDigit {
+			found = true
+			if h3LeadingDigit(digits) == h3KDigit {
+				h3Rotate(digits, h3RotateCCW)
+			}
+		}
+	}
+}
+
+// unitVector returns the point of the unit sphere of a latitude and longitude in radians
+func unitVector(lat, lng float64) [3]float64 {
+	return [3]float64{math.Cos(lat) * math.Cos(lng), math.Cos(lat) * math.Sin(lng), math.Sin(lat)}
+}
+
+// positiveAngle returns an angle in radians normalized to [0, 2π)
+func positiveAngle(angle float64) float64 {
+	angle = math.Mod(angle, 2*math.Pi)
+	if angle < 0 {
+		angle += 2 * math.Pi
+	}
+	return angle
+}
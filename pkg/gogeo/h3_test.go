@@ -0,0 +1,72 @@
+package gogeo
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/paulmach/orb"
+)
+
+func TestH3CellID(t *testing.T) {
+	// Cell ids returned by the H3 library for the same points
+	tests := []struct {
+		name       string
+		point      orb.Point
+		resolution int
+		want       string
+	}{
+		{"origin at res 0", orb.Point{0, 0}, 0, "8075fffffffffff"},
+		{"Sunnyvale at res 5", orb.Point{-122.0553238, 37.3615593}, 5, "85283473fffffff"},
+		{"Sunnyvale at res 7", orb.Point{-122.0553238, 37.3615593}, 7, "87283472bffffff"},
+		{"San Francisco at res 9", orb.Point{-122.41795063018799, 37.775938728915946}, 9, "8928308280fffff"},
+		{"Statue of Liberty at res 10", orb.Point{-74.044444, 40.689167}, 10, "8a2a1072b59ffff"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strconv.FormatUint(h3CellID(tt.point, tt.resolution), 16)
+			if got != tt.want {
+				t.Errorf("h3CellID(%v, %d) = %s, want %s", tt.point, tt.resolution, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestH3CellIDLayout(t *testing.T) {
+	points := []orb.Point{{0, 0}, {179.9, -89.9}, {-179.9, 89.9}, {10.5, 64.7}, {-58.4, -34.6}, {139.7, 35.7}}
+	for _, point := range points {
+		for resolution := 0; resolution <= maxH3Resolution; resolution++ {
+			id := h3CellID(point, resolution)
+			if mode := id >> 59 & 0xf; mode != 1 {
+				t.Errorf("h3CellID(%v, %d) = %x has mode %d, want 1", point, resolution, id, mode)
+			}
+			if got := int(id >> 52 & 0xf); got != resolution {
+				t.Errorf("h3CellID(%v, %d) = %x has resolution %d", point, resolution, id, got)
+			}
+			if baseCell := id >> 45 & 0x7f; baseCell >= 122 {
+				t.Errorf("h3CellID(%v, %d) = %x has base cell %d, want < 122", point, resolution, id, baseCell)
+			}
+			for r := 1; r <= maxH3Resolution; r++ {
+				digit := id >> (3 * (maxH3Resolution - r)) & 7
+				if r > resolution && digit != h3NoDigit {
+					t.Errorf("h3CellID(%v, %d) = %x has digit %d at unused resolution %d", point, resolution, id, digit, r)
+				}
+				if r <= resolution && digit == h3NoDigit {
+					t.Errorf("h3CellID(%v, %d) = %x has no digit at resolution %d", point, resolution, id, r)
+				}
+			}
+		}
+	}
+}
+
+func TestWithH3ColumnResolution(t *testing.T) {
+	for _, resolution := range []int{-1, 16} {
+		cfg := newConfig([]Option{WithH3Column("h3", resolution)})
+		if err := cfg.validate(); err == nil {
+			t.Errorf("WithH3Column(\"h3\", %d) was accepted", resolution)
+		}
+	}
+	cfg := newConfig([]Option{WithH3Column("h3", 15)})
+	if err := cfg.validate(); err != nil {
+		t.Errorf("WithH3Column(\"h3\", 15) error = %v", err)
+	}
+}
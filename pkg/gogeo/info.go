@@ -0,0 +1,170 @@
+package gogeo
+
+import (
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// FileInfo summarizes a GeoParquet file from its footer, without reading its rows.
+type FileInfo struct {
+	// Size of the file in bytes.
+	Size int64 `json:"size"`
+	// Number of rows.
+	Rows int64 `json:"rows"`
+	// Number of row groups.
+	RowGroups int `json:"row_groups"`
+	// Compression codecs used by the column chunks, e.g. ["SNAPPY"].
+	Compression []string `json:"compression"`
+	// Application that wrote the file.
+	CreatedBy string `json:"created_by,omitempty"`
+	// Parsed geo metadata, nil for a plain Parquet file.
+	Geo *GeoParquet `json:"geo"`
+}
+
+// InspectFile reads the footer of a GeoParquet file and summarizes it.
+func InspectFile(path string) (*FileInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, AppError{Message: "failed to open GeoParquet file", Value: err}
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, AppError{Message: "failed to stat GeoParquet file", Value: err}
+	}
+	return Inspect(file, stat.Size())
+}
+
+// Inspect summarizes GeoParquet of the given size read from r. A Parquet file without
+// geo metadata is summarized with a nil Geo; invalid geo metadata is an error.
+func Inspect(r io.ReaderAt, size int64) (*FileInfo, error) {
+	pf, err := parquet.OpenFile(r, size, parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+	if err != nil {
+		return nil, AppError{Message: "failed to read Parquet file", Value: err}
+	}
+
+	metadata := pf.Metadata()
+	info := &FileInfo{
+		Size:      size,
+		Rows:      pf.NumRows(),
+		RowGroups: len(metadata.RowGroups),
+		CreatedBy: metadata.CreatedBy,
+	}
+
+	codecs := make(map[string]bool)
+	for _, rowGroup := range metadata.RowGroups {
+		for _, column := range rowGroup.Columns {
+			codecs[column.MetaData.Codec.String()] = true
+		}
+	}
+	info.Compression = make([]string, 0, len(codecs))
+	for codec := range codecs {
+		info.Compression = append(info.Compression, codec)
+	}
+	sort.Strings(info.Compression)
+
+	if _, ok := pf.Lookup(GeoParquetMetadataKey); ok {
+		if info.Geo, err = readGeoMetadata(pf); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// ColumnInfo describes a leaf column of a Parquet file.
+type ColumnInfo struct {
+	// Dotted path of the column, e.g. "bbox.xmin".
+	Path string `json:"path"`
+	// Physical type, e.g. "BYTE_ARRAY" or "DOUBLE".
+	PhysicalType string `json:"physical_type"`
+	// Logical type annotation, e.g. "STRING", empty if the column has none.
+	LogicalType string `json:"logical_type,omitempty"`
+	// Repetition of the column: "required", "optional" or "repeated".
+	Repetition string `json:"repetition"`
+	// Encodings of the column chunks, e.g. ["PLAIN", "RLE"].
+	Encodings []string `json:"encodings"`
+	// Geometry encoding declared by the geo metadata, empty for other columns.
+	Geometry string `json:"geometry,omitempty"`
+}
+
+// InspectColumnsFile reads the schema of a Parquet file and describes its columns.
+func InspectColumnsFile(path string) ([]ColumnInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, AppError{Message: "failed to open Parquet file", Value: err}
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, AppError{Message: "failed to stat Parquet file", Value: err}
+	}
+	return InspectColumns(file, stat.Size())
+}
+
+// InspectColumns describes the leaf columns of Parquet data of the given size read
+// from r, in schema order. Files without geo metadata are supported.
+func InspectColumns(r io.ReaderAt, size int64) ([]ColumnInfo, error) {
+	pf, err := parquet.OpenFile(r, size, parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+	if err != nil {
+		return nil, AppError{Message: "failed to read Parquet file", Value: err}
+	}
+
+	var geoMeta *GeoParquet
+	if _, ok := pf.Lookup(GeoParquetMetadataKey); ok {
+		if geoMeta, err = readGeoMetadata(pf); err != nil {
+			return nil, err
+		}
+	}
+
+	schema := pf.Schema()
+	metadata := pf.Metadata()
+	var columns []ColumnInfo
+	for _, path := range schema.Columns() {
+		leaf, ok := schema.Lookup(path...)
+		if !ok {
+			continue
+		}
+
+		column := ColumnInfo{
+			Path:         strings.Join(path, "."),
+			PhysicalType: leaf.Node.Type().Kind().String(),
+			Repetition:   "required",
+		}
+		if logical := leaf.Node.Type().LogicalType(); logical != nil {
+			column.LogicalType = logical.String()
+		}
+		switch {
+		case leaf.Node.Repeated():
+			column.Repetition = "repeated"
+		case leaf.Node.Optional():
+			column.Repetition = "optional"
+		}
+
+		seen := make(map[string]bool)
+		for _, rowGroup := range metadata.RowGroups {
+			if leaf.ColumnIndex >= len(rowGroup.Columns) {
+				continue
+			}
+			for _, encoding := range rowGroup.Columns[leaf.ColumnIndex].MetaData.Encoding {
+				if name := encoding.String(); !seen[name] {
+					seen[name] = true
+					column.Encodings = append(column.Encodings, name)
+				}
+			}
+		}
+
+		if geoMeta != nil {
+			if geometry, ok := geoMeta.Columns[column.Path]; ok {
+				column.Geometry = geometry.Encoding
+			}
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
@@ -0,0 +1,86 @@
+package gogeo
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// WithIntegerNarrowing writes integer property columns whose values all fit in 8, 16
+// or 32 bits as INT32 columns annotated with the INT(8), INT(16) or INT(32) logical
+// type instead of INT64, halving the size of the plain values of id and count columns
+// and letting readers load them in smaller types. The width is that of the smallest
+// and largest values of all the features.
+func WithIntegerNarrowing() Option {
+	return func(cfg *config) {
+		cfg.narrowIntegers = true
+	}
+}
+
+// integerBits returns the number of bits of the smallest signed integer type holding
+// an integer property value, 8, 16, 32 or 64
+func integerBits(value any) int {
+	rv := reflect.ValueOf(value)
+	var v int64
+	switch {
+	case rv.CanInt():
+		v = rv.Int()
+	case rv.CanUint() && rv.Uint() <= math.MaxInt32:
+		v = int64(rv.Uint()) //nolint:gosec
+	default:
+		return 64
+	}
+	switch {
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		return 8
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		return 16
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		return 32
+	default:
+		return 64
+	}
+}
+
+// isNegativeInteger reports whether a property value is a negative integer
+func isNegativeInteger(value any) bool {
+	rv := reflect.ValueOf(value)
+	return rv.CanInt() && rv.Int() < 0
+}
+
+// narrowInteger converts an integer to the INT32 value of a column of the given width,
+// 8, 16 or 32, failing if it does not fit
+func narrowInteger(value int64, bits int) (int32, error) {
+	if limit := int64(1) << (bits - 1); value < -limit || value >= limit {
+		return 0, fmt.Errorf("%d overflows INT(%d)", value, bits)
+	}
+	return int32(value), nil
+}
+
+// parquetIntegerBits returns the width of a narrowed integer column of a Parquet type,
+// 8, 16 or 32 for signed INT32 columns, 0 otherwise
+func parquetIntegerBits(t parquet.Type) int {
+	if t.Kind() != parquet.Int32 {
+		return 0
+	}
+	logical := t.LogicalType()
+	switch {
+	case logical == nil || logical.Integer == nil:
+		return 32
+	case !logical.Integer.IsSigned:
+		return 0
+	default:
+		return int(logical.Integer.BitWidth)
+	}
+}
+
+// widerIntegerBits returns the width of an integer column holding the values of
+// columns of two widths, 0 being INT64
+func widerIntegerBits(a, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return max(a, b)
+}
@@ -0,0 +1,183 @@
+package gogeo
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/paulmach/orb/geojson"
+)
+
+// JoinTable is a lookup table whose rows enrich the properties of features with
+// WithJoin, indexed by the value of a key column.
+type JoinTable struct {
+	key string
+	// columns are the columns besides the key, in the order of the table.
+	columns []string
+	rows    map[string][]any
+	schema  []PropertyInfo
+}
+
+// ReadCSVJoinTable reads a CSV lookup table with a header line, indexed by the key
+// column. Other fields are typed from their text like CSV input, empty fields being
+// null. Rows with an empty key are skipped, and keys must be unique.
+func ReadCSVJoinTable(r io.Reader, key string) (*JoinTable, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, AppError{Message: "failed to read CSV header of the join table", Value: err}
+	}
+	// Spreadsheet exports often start with a byte order mark
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	header = append([]string(nil), header...)
+
+	keyIndex := -1
+	seen := make(map[string]bool, len(header))
+	for i, name := range header {
+		if seen[name] {
+			return nil, AppError{Message: fmt.Sprintf("duplicate CSV column %q in the join table", name)}
+		}
+		seen[name] = true
+		if name == key {
+			keyIndex = i
+		}
+	}
+	if keyIndex < 0 {
+		return nil, AppError{Message: fmt.Sprintf("join column %q not found, columns are %s", key, strings.Join(header, ", "))}
+	}
+
+	table := &JoinTable{key: key, rows: make(map[string][]any)}
+	for i, name := range header {
+		if i != keyIndex {
+			table.columns = append(table.columns, name)
+		}
+	}
+	types := &propertyAnalyzer{propertyTypes: make(map[string]PropertyType)}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, AppError{Message: "failed to read join table", Value: err}
+		}
+		if record[keyIndex] == "" {
+			continue
+		}
+		if _, exists := table.rows[record[keyIndex]]; exists {
+			line, _ := reader.FieldPos(0)
+			return nil, AppError{Message: fmt.Sprintf("duplicate key %q in the join table at line %d", record[keyIndex], line)}
+		}
+
+		row := make([]any, 0, len(table.columns))
+		properties := make(geojson.Properties, len(table.columns))
+		for i, field := range record {
+			if i == keyIndex {
+				continue
+			}
+			value := parseTextValue(field)
+			row = append(row, value)
+			properties[header[i]] = value
+		}
+		table.rows[record[keyIndex]] = row
+		types.add(&geojson.Feature{Properties: properties})
+	}
+	for _, name := range table.columns {
+		if _, ok := types.propertyTypes[name]; !ok {
+			types.propertyTypes[name] = PropertyTypeNull
+		}
+	}
+	table.schema = types.infos()
+	return table, nil
+}
+
+// lookup returns the row of the table matching the key property of a feature
+func (t *JoinTable) lookup(properties geojson.Properties) ([]any, bool) {
+	value := properties[t.key]
+	if value == nil {
+		return nil, false
+	}
+	key, err := stringifyProperty(value)
+	if err != nil {
+		return nil, false
+	}
+	row, ok := t.rows[key]
+	return row, ok
+}
+
+// apply returns the properties of a feature enriched with the columns of its row, which
+// replace properties of the same name
+func (t *JoinTable) apply(properties geojson.Properties, reserved map[string]bool) geojson.Properties {
+	row, ok := t.lookup(properties)
+	if !ok {
+		return properties
+	}
+	joined := make(geojson.Properties, len(properties)+len(row))
+	for name, value := range properties {
+		joined[name] = value
+	}
+	for i, name := range t.columns {
+		if !reserved[name] {
+			joined[name] = row[i]
+		}
+	}
+	return joined
+}
+
+// addSchema returns the columns of a schema read from an input with those of the table,
+// widening the types of columns present in both
+func (t *JoinTable) addSchema(properties []PropertyInfo, reserved map[string]bool) []PropertyInfo {
+	joined := append([]PropertyInfo(nil), properties...)
+	for _, info := range t.schema {
+		if reserved[info.Name] {
+			continue
+		}
+		found := false
+		for i := range joined {
+			if joined[i].Name == info.Name {
+				joined[i].Type = widenPropertyType(joined[i].Type, info.Type)
+				joined[i].Nullable = true
+				found = true
+			}
+		}
+		if !found {
+			joined = append(joined, info)
+		}
+	}
+	return joined
+}
+
+// WithJoin enriches the properties of each feature with the columns of the row of table
+// whose key equals the feature property of the same name, compared as text. Joined
+// columns replace properties of the same name, and features without a matching row are
+// written without them. Filters given with WithWhere and column options apply to the
+// joined properties.
+func WithJoin(table *JoinTable) Option {
+	return func(cfg *config) {
+		if table == nil {
+			cfg.fail(AppError{Message: "join table must not be nil"})
+			return
+		}
+		cfg.join = table
+	}
+}
+
+// joinReader enriches the properties of the features of reader from a join table
+type joinReader struct {
+	reader   FeatureReader
+	table    *JoinTable
+	reserved map[string]bool
+}
+
+func (r *joinReader) Next() (*geojson.Feature, error) {
+	feature, err := r.reader.Next()
+	if err != nil {
+		return nil, err
+	}
+	// Copy the feature, which buffered inputs read more than once
+	joined := *feature
+	joined.Properties = r.table.apply(feature.Properties, r.reserved)
+	return &joined, nil
+}
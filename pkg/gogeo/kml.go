@@ -0,0 +1,396 @@
+package gogeo
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// KMLDecoder streams the Placemarks of a KML document as features. The name and
+// description of a Placemark and its ExtendedData become properties; SimpleData
+// values are typed by their Schema declaration, other values are strings.
+type KMLDecoder struct {
+	decoder *xml.Decoder
+	// schemas maps Schema ids to their field types by field name.
+	schemas map[string]map[string]string
+	count   int
+}
+
+// NewKMLDecoder creates a streaming decoder reading Placemarks from a KML document.
+func NewKMLDecoder(r io.Reader) *KMLDecoder {
+	return &KMLDecoder{decoder: xml.NewDecoder(r), schemas: make(map[string]map[string]string)}
+}
+
+// NewKMZDecoder creates a decoder reading the Placemarks of the main document of a
+// KMZ archive: doc.kml, or else the first .kml file at its root.
+func NewKMZDecoder(r io.ReaderAt, size int64) (*KMLDecoder, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, AppError{Message: "failed to read KMZ archive", Value: err}
+	}
+
+	var document *zip.File
+	for _, file := range archive.File {
+		if strings.Contains(file.Name, "/") || !strings.EqualFold(path.Ext(file.Name), ".kml") {
+			continue
+		}
+		if strings.EqualFold(file.Name, "doc.kml") {
+			document = file
+			break
+		}
+		if document == nil {
+			document = file
+		}
+	}
+	if document == nil {
+		return nil, AppError{Message: "KMZ archive contains no .kml document"}
+	}
+
+	input, err := document.Open()
+	if err != nil {
+		return nil, AppError{Message: "failed to read KMZ archive", Value: err}
+	}
+	return NewKMLDecoder(input), nil
+}
+
+// xmlNode is a generic XML element. Lookups by name ignore namespaces, so that
+// KML gx extensions are read like core elements
+type xmlNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Content string     `xml:",chardata"`
+	Nodes   []xmlNode  `xml:",any"`
+}
+
+// child returns the first child element with the given local name
+func (n *xmlNode) child(name string) *xmlNode {
+	for i := range n.Nodes {
+		if n.Nodes[i].XMLName.Local == name {
+			return &n.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// attr returns the value of an attribute
+func (n *xmlNode) attr(name string) string {
+	for _, attr := range n.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// Next decodes the next Placemark of the document.
+func (d *KMLDecoder) Next() (*geojson.Feature, error) {
+	for {
+		token, err := d.decoder.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("failed to decode KML: %w", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "Schema":
+			var schema xmlNode
+			if err := d.decoder.DecodeElement(&schema, &start); err != nil {
+				return nil, fmt.Errorf("failed to decode KML schema: %w", err)
+			}
+			d.addSchema(&schema)
+		case "Placemark":
+			var placemark xmlNode
+			if err := d.decoder.DecodeElement(&placemark, &start); err != nil {
+				return nil, fmt.Errorf("failed to decode placemark %d: %w", d.count+1, err)
+			}
+			d.count++
+			feature, err := d.feature(&placemark)
+			if err != nil {
+				return nil, fmt.Errorf("placemark %d: %w", d.count, err)
+			}
+			return feature, nil
+		}
+	}
+}
+
+// addSchema records the field types of a Schema declaration
+func (d *KMLDecoder) addSchema(schema *xmlNode) {
+	fields := make(map[string]string)
+	for _, field := range schema.Nodes {
+		if field.XMLName.Local == "SimpleField" {
+			fields[field.attr("name")] = strings.ToLower(field.attr("type"))
+		}
+	}
+	// Older documents reference schemas by name rather than id
+	for _, key := range []string{schema.attr("id"), schema.attr("name")} {
+		if key != "" {
+			d.schemas[key] = fields
+		}
+	}
+}
+
+// feature converts a Placemark into a feature
+func (d *KMLDecoder) feature(placemark *xmlNode) (*geojson.Feature, error) {
+	feature := geojson.NewFeature(nil)
+	if id := placemark.attr("id"); id != "" {
+		feature.ID = id
+	}
+
+	for i := range placemark.Nodes {
+		node := &placemark.Nodes[i]
+		switch node.XMLName.Local {
+		case "name", "description":
+			feature.Properties[node.XMLName.Local] = strings.TrimSpace(node.Content)
+		case "ExtendedData":
+			if err := d.extendedData(node, feature.Properties); err != nil {
+				return nil, err
+			}
+		default:
+			if feature.Geometry != nil || !isKMLGeometry(node.XMLName.Local) {
+				continue
+			}
+			geometry, z, err := kmlGeometry(node)
+			if err != nil {
+				return nil, err
+			}
+			feature.Geometry = withZOrdinates(geometry, z)
+		}
+	}
+	return feature, nil
+}
+
+// extendedData adds the Data and SchemaData values of ExtendedData to properties
+func (d *KMLDecoder) extendedData(node *xmlNode, properties geojson.Properties) error {
+	for i := range node.Nodes {
+		element := &node.Nodes[i]
+		switch element.XMLName.Local {
+		case "Data":
+			value := element.child("value")
+			if value == nil {
+				properties[element.attr("name")] = nil
+				continue
+			}
+			properties[element.attr("name")] = strings.TrimSpace(value.Content)
+		case "SchemaData":
+			fields := d.schemas[strings.TrimPrefix(element.attr("schemaUrl"), "#")]
+			for _, data := range element.Nodes {
+				if data.XMLName.Local != "SimpleData" {
+					continue
+				}
+				name := data.attr("name")
+				value, err := kmlValue(strings.TrimSpace(data.Content), fields[name])
+				if err != nil {
+					return fmt.Errorf("field %s: %w", name, err)
+				}
+				properties[name] = value
+			}
+		}
+	}
+	return nil
+}
+
+// kmlValue converts a SimpleData value to the type declared by its SimpleField
+func kmlValue(value, fieldType string) (any, error) {
+	if value == "" && fieldType != "string" && fieldType != "" {
+		return nil, nil
+	}
+	switch fieldType {
+	case "int", "uint", "short", "ushort":
+		return strconv.ParseInt(value, 10, 64)
+	case "float", "double":
+		return strconv.ParseFloat(value, 64)
+	case "bool":
+		switch strings.ToLower(value) {
+		case "1", "true":
+			return true, nil
+		case "0", "false":
+			return false, nil
+		}
+		return nil, fmt.Errorf("invalid bool %q", value)
+	default:
+		return value, nil
+	}
+}
+
+// isKMLGeometry reports whether an element is a supported geometry
+func isKMLGeometry(name string) bool {
+	switch name {
+	case "Point", "LineString", "LinearRing", "Polygon", "MultiGeometry", "Track", "MultiTrack":
+		return true
+	}
+	return false
+}
+
+// kmlGeometry converts a geometry element. z holds the altitude of every position in
+// order, zero where it is omitted, and is nil if no position has an altitude.
+func kmlGeometry(node *xmlNode) (orb.Geometry, []float64, error) {
+	switch node.XMLName.Local {
+	case "Point":
+		points, z, err := kmlCoordinates(node)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(points) != 1 {
+			return nil, nil, fmt.Errorf("point has %d coordinates", len(points))
+		}
+		return points[0], z, nil
+	case "LineString":
+		points, z, err := kmlCoordinates(node)
+		return orb.LineString(points), z, err
+	case "LinearRing":
+		points, z, err := kmlCoordinates(node)
+		return orb.Polygon{orb.Ring(points)}, z, err
+	case "Polygon":
+		return kmlPolygon(node)
+	case "Track":
+		return kmlTrack(node)
+	case "MultiGeometry", "MultiTrack":
+		return kmlMultiGeometry(node)
+	default:
+		return nil, nil, fmt.Errorf("unsupported geometry %s", node.XMLName.Local)
+	}
+}
+
+// kmlPolygon converts a Polygon, starting with its outer boundary
+func kmlPolygon(node *xmlNode) (orb.Geometry, []float64, error) {
+	var polygon orb.Polygon
+	var z []float64
+	hasZ := false
+	for _, boundary := range []string{"outerBoundaryIs", "innerBoundaryIs"} {
+		for i := range node.Nodes {
+			if node.Nodes[i].XMLName.Local != boundary {
+				continue
+			}
+			for j := range node.Nodes[i].Nodes {
+				ring := &node.Nodes[i].Nodes[j]
+				if ring.XMLName.Local != "LinearRing" {
+					continue
+				}
+				points, ringZ, err := kmlCoordinates(ring)
+				if err != nil {
+					return nil, nil, err
+				}
+				polygon = append(polygon, orb.Ring(points))
+				z = appendZ(z, ringZ, len(points))
+				hasZ = hasZ || ringZ != nil
+			}
+		}
+	}
+	if len(polygon) == 0 {
+		return nil, nil, errors.New("polygon has no outer boundary")
+	}
+	if !hasZ {
+		z = nil
+	}
+	return polygon, z, nil
+}
+
+// kmlTrack converts a gx:Track into a line string of its gx:coord positions
+func kmlTrack(node *xmlNode) (orb.Geometry, []float64, error) {
+	var line orb.LineString
+	var z []float64
+	hasZ := false
+	for _, coord := range node.Nodes {
+		if coord.XMLName.Local != "coord" {
+			continue
+		}
+		// gx:coord separates the ordinates with spaces rather than commas
+		point, altitude, ok, err := kmlPosition(strings.Join(strings.Fields(coord.Content), ","))
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, point)
+		z = append(z, altitude)
+		hasZ = hasZ || ok
+	}
+	if !hasZ {
+		z = nil
+	}
+	return line, z, nil
+}
+
+// kmlMultiGeometry converts a MultiGeometry or gx:MultiTrack with combineMembers
+func kmlMultiGeometry(node *xmlNode) (orb.Geometry, []float64, error) {
+	var members []orb.Geometry
+	var zs [][]float64
+	for i := range node.Nodes {
+		if !isKMLGeometry(node.Nodes[i].XMLName.Local) {
+			continue
+		}
+		member, z, err := kmlGeometry(&node.Nodes[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		members = append(members, member)
+		zs = append(zs, z)
+	}
+
+	multi, z := combineMembers(members, zs)
+	return multi, z, nil
+}
+
+// kmlCoordinates parses the coordinates child of an element: whitespace-separated
+// lon,lat[,alt] tuples
+func kmlCoordinates(node *xmlNode) ([]orb.Point, []float64, error) {
+	coordinates := node.child("coordinates")
+	if coordinates == nil {
+		return nil, nil, fmt.Errorf("%s has no coordinates", node.XMLName.Local)
+	}
+
+	// Some writers put spaces around the commas within a tuple
+	content := coordinates.Content
+	for _, spaced := range []string{" ,", ", "} {
+		for strings.Contains(content, spaced) {
+			content = strings.ReplaceAll(content, spaced, ",")
+		}
+	}
+
+	var points []orb.Point
+	var z []float64
+	hasZ := false
+	for _, tuple := range strings.Fields(content) {
+		point, altitude, ok, err := kmlPosition(tuple)
+		if err != nil {
+			return nil, nil, err
+		}
+		points = append(points, point)
+		z = append(z, altitude)
+		hasZ = hasZ || ok
+	}
+	if !hasZ {
+		z = nil
+	}
+	return points, z, nil
+}
+
+// kmlPosition parses a lon,lat[,alt] tuple; ok reports whether it has an altitude
+func kmlPosition(tuple string) (orb.Point, float64, bool, error) {
+	parts := strings.Split(tuple, ",")
+	if len(parts) < 2 || len(parts) > 3 {
+		return orb.Point{}, 0, false, fmt.Errorf("invalid coordinate %q", tuple)
+	}
+
+	var values [3]float64
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return orb.Point{}, 0, false, fmt.Errorf("invalid coordinate %q", tuple)
+		}
+		values[i] = value
+	}
+	return orb.Point{values[0], values[1]}, values[2], len(parts) == 3, nil
+}
@@ -0,0 +1,237 @@
+package gogeo
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// kmlDocument wraps Placemarks and schemas in a KML document
+func kmlDocument(elements ...string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2" xmlns:gx="http://www.google.com/kml/ext/2.2"><Document>` +
+		strings.Join(elements, "") + `</Document></kml>`
+}
+
+func TestKMLDecoder(t *testing.T) {
+	tests := []struct {
+		name     string
+		geometry string
+		want     orb.Geometry
+	}{
+		{"point", `<Point><coordinates>1,2</coordinates></Point>`, orb.Point{1, 2}},
+		{"point with altitude", `<Point><coordinates>1,2,30</coordinates></Point>`, GeometryZ{Geometry: orb.Point{1, 2}, Z: []float64{30}}},
+		{"spaces around commas", `<LineString><coordinates>0 , 0  1, 1</coordinates></LineString>`, orb.LineString{{0, 0}, {1, 1}}},
+		{
+			"altitude on some positions",
+			"<LineString><coordinates>\n\t0,0\n\t1,1,5\n</coordinates></LineString>",
+			GeometryZ{Geometry: orb.LineString{{0, 0}, {1, 1}}, Z: []float64{0, 5}},
+		},
+		{
+			"polygon with a hole",
+			`<Polygon><innerBoundaryIs><LinearRing><coordinates>1,1 2,1 2,2 1,1</coordinates></LinearRing></innerBoundaryIs>` +
+				`<outerBoundaryIs><LinearRing><coordinates>0,0 4,0 4,4 0,0</coordinates></LinearRing></outerBoundaryIs></Polygon>`,
+			orb.Polygon{{{0, 0}, {4, 0}, {4, 4}, {0, 0}}, {{1, 1}, {2, 1}, {2, 2}, {1, 1}}},
+		},
+		{"linear ring", `<LinearRing><coordinates>0,0 1,0 1,1 0,0</coordinates></LinearRing>`, orb.Polygon{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}}},
+		{
+			"multi-geometry of points",
+			`<MultiGeometry><Point><coordinates>1,2</coordinates></Point><Point><coordinates>3,4</coordinates></Point></MultiGeometry>`,
+			orb.MultiPoint{{1, 2}, {3, 4}},
+		},
+		{
+			"mixed multi-geometry",
+			`<MultiGeometry><Point><coordinates>1,2</coordinates></Point><LineString><coordinates>0,0 1,1</coordinates></LineString></MultiGeometry>`,
+			orb.Collection{orb.Point{1, 2}, orb.LineString{{0, 0}, {1, 1}}},
+		},
+		{
+			"track",
+			`<gx:Track><when>2024-01-01T00:00:00Z</when><when>2024-01-01T00:01:00Z</when><gx:coord>1 2 10</gx:coord><gx:coord>3 4 20</gx:coord></gx:Track>`,
+			GeometryZ{Geometry: orb.LineString{{1, 2}, {3, 4}}, Z: []float64{10, 20}},
+		},
+		{
+			"multi-track",
+			`<gx:MultiTrack><gx:Track><gx:coord>0 0</gx:coord><gx:coord>1 1</gx:coord></gx:Track><gx:Track><gx:coord>2 2</gx:coord><gx:coord>3 3</gx:coord></gx:Track></gx:MultiTrack>`,
+			orb.MultiLineString{{{0, 0}, {1, 1}}, {{2, 2}, {3, 3}}},
+		},
+		{
+			"only the first geometry",
+			`<Point><coordinates>1,2</coordinates></Point><Point><coordinates>3,4</coordinates></Point>`,
+			orb.Point{1, 2},
+		},
+		{"no geometry", `<Style/>`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := NewKMLDecoder(strings.NewReader(kmlDocument(`<Placemark>` + tt.geometry + `</Placemark>`)))
+			feature, err := decoder.Next()
+			if err != nil {
+				t.Fatalf("Next() error = %v", err)
+			}
+			if !reflect.DeepEqual(feature.Geometry, tt.want) {
+				t.Errorf("geometry = %#v, want %#v", feature.Geometry, tt.want)
+			}
+			if _, err := decoder.Next(); !errors.Is(err, io.EOF) {
+				t.Errorf("Next() error = %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestKMLDecoderProperties(t *testing.T) {
+	input := kmlDocument(
+		`<Schema name="place" id="placeSchema">
+			<SimpleField name="population" type="int"/>
+			<SimpleField name="area" type="double"/>
+			<SimpleField name="capital" type="bool"/>
+			<SimpleField name="code" type="string"/>
+			<SimpleField name="founded" type="int"/>
+		</Schema>`,
+		`<Folder><Placemark id="p1">
+			<name> Springfield </name>
+			<description><![CDATA[<b>Home</b> & more]]></description>
+			<ExtendedData>
+				<Data name="website"><value>https://example.com</value></Data>
+				<Data name="notes"/>
+				<SchemaData schemaUrl="#placeSchema">
+					<SimpleData name="population">30720</SimpleData>
+					<SimpleData name="area">14.5</SimpleData>
+					<SimpleData name="capital">0</SimpleData>
+					<SimpleData name="code">007</SimpleData>
+					<SimpleData name="founded"></SimpleData>
+					<SimpleData name="undeclared">12</SimpleData>
+				</SchemaData>
+			</ExtendedData>
+			<Point><coordinates>1,2</coordinates></Point>
+		</Placemark></Folder>`,
+		// Older documents reference the schema by name
+		`<Placemark><ExtendedData><SchemaData schemaUrl="place"><SimpleData name="capital">TRUE</SimpleData></SchemaData></ExtendedData></Placemark>`,
+	)
+	decoder := NewKMLDecoder(strings.NewReader(input))
+	feature, err := decoder.Next()
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if feature.ID != "p1" {
+		t.Errorf("ID = %v, want p1", feature.ID)
+	}
+	want := geojson.Properties{
+		"name":        "Springfield",
+		"description": "<b>Home</b> & more",
+		"website":     "https://example.com",
+		"notes":       nil,
+		"population":  int64(30720),
+		"area":        14.5,
+		"capital":     false,
+		"code":        "007",
+		"founded":     nil,
+		"undeclared":  "12",
+	}
+	if !reflect.DeepEqual(feature.Properties, want) {
+		t.Errorf("properties = %#v, want %#v", feature.Properties, want)
+	}
+
+	feature, err = decoder.Next()
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if want := (geojson.Properties{"capital": true}); !reflect.DeepEqual(feature.Properties, want) || feature.ID != nil {
+		t.Errorf("second placemark has id %v and properties %v, want %v", feature.ID, feature.Properties, want)
+	}
+}
+
+func TestKMLDecoderErrors(t *testing.T) {
+	schema := `<Schema id="s"><SimpleField name="n" type="int"/><SimpleField name="b" type="bool"/></Schema>`
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{"two coordinates in a point", kmlDocument(`<Placemark><Point><coordinates>1,2 3,4</coordinates></Point></Placemark>`), "placemark 1: point has 2 coordinates"},
+		{"missing coordinates", kmlDocument(`<Placemark><LineString/></Placemark>`), "LineString has no coordinates"},
+		{"one ordinate", kmlDocument(`<Placemark><Point><coordinates>1</coordinates></Point></Placemark>`), `invalid coordinate "1"`},
+		{"four ordinates", kmlDocument(`<Placemark><Point><coordinates>1,2,3,4</coordinates></Point></Placemark>`), `invalid coordinate "1,2,3,4"`},
+		{"invalid number", kmlDocument(`<Placemark><Point><coordinates>1,north</coordinates></Point></Placemark>`), `invalid coordinate "1,north"`},
+		{"invalid track coord", kmlDocument(`<Placemark><gx:Track><gx:coord>1</gx:coord></gx:Track></Placemark>`), `invalid coordinate "1"`},
+		{"polygon without outer boundary", kmlDocument(`<Placemark><Polygon/></Placemark>`), "polygon has no outer boundary"},
+		{"invalid member", kmlDocument(`<Placemark><MultiGeometry><Point/></MultiGeometry></Placemark>`), "Point has no coordinates"},
+		{
+			"invalid int",
+			kmlDocument(schema, `<Placemark><ExtendedData><SchemaData schemaUrl="#s"><SimpleData name="n">x</SimpleData></SchemaData></ExtendedData></Placemark>`),
+			`field n: strconv.ParseInt: parsing "x"`,
+		},
+		{
+			"invalid bool",
+			kmlDocument(schema, `<Placemark><ExtendedData><SchemaData schemaUrl="#s"><SimpleData name="b">yes</SimpleData></SchemaData></ExtendedData></Placemark>`),
+			`field b: invalid bool "yes"`,
+		},
+		{"unclosed placemark", kmlDocument(`<Placemark><name>x</Placemark>`), "failed to decode placemark 1"},
+		{"unclosed schema", `<kml><Schema id="s"><SimpleField name="n"></Schema></kml>`, "failed to decode KML schema"},
+		{"unclosed document", `<kml><Document>`, "failed to decode KML"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKMLDecoder(strings.NewReader(tt.input)).Next()
+			if err == nil || errors.Is(err, io.EOF) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Next() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKMZDecoder(t *testing.T) {
+	archive := func(files ...string) []byte {
+		var buf bytes.Buffer
+		writer := zip.NewWriter(&buf)
+		for _, name := range files {
+			file, err := writer.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(file, kmlDocument(`<Placemark><name>`+name+`</name></Placemark>`))
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr string
+	}{
+		{"doc.kml", archive("files/nested.kml", "other.kml", "doc.kml"), "doc.kml", ""},
+		{"first root document", archive("images/icon.png", "files/nested.kml", "Places.KML", "other.kml"), "Places.KML", ""},
+		{"no document", archive("files/nested.kml"), "", "KMZ archive contains no .kml document"},
+		{"not an archive", []byte("<kml/>"), "", "failed to read KMZ archive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder, err := NewKMZDecoder(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("NewKMZDecoder() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewKMZDecoder() error = %v", err)
+			}
+			feature, err := decoder.Next()
+			if err != nil {
+				t.Fatalf("Next() error = %v", err)
+			}
+			if name := feature.Properties["name"]; name != tt.want {
+				t.Errorf("read the placemark of %v, want %s", name, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,467 @@
+package gogeo
+
+import (
+	"math"
+	"sort"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/planar"
+)
+
+// maxInvalidGeometries is the number of geometries that could not be made valid listed
+// in a Report; further ones are only counted
+const maxInvalidGeometries = 1000
+
+// problemZeroArea is the problem of polygons whose exterior ring has no area
+const problemZeroArea = "zero-area polygon"
+
+// InvalidGeometry is a feature geometry that WithMakeValid could not make valid.
+type InvalidGeometry struct {
+	// Index of the feature among those converted, starting at 1.
+	Feature int `json:"feature"`
+	// Identifier of the feature, if it has one.
+	ID any `json:"id,omitempty"`
+	// Problem that could not be repaired.
+	Problem string `json:"problem"`
+}
+
+// WithMakeValid checks the feature geometries and repairs the invalid ones: unclosed
+// rings are closed, self-intersecting rings are split into simple rings at their
+// intersections, as with an even-odd fill, and rings without area or outside the
+// exterior of their polygon are dropped. Geometries that cannot be repaired, such as
+// polygons without area or whose rings cross each other, are written as they are and
+// listed in the Report.
+func WithMakeValid() Option {
+	return func(cfg *config) {
+		cfg.makeValid = true
+	}
+}
+
+// makeValid returns a valid version of a geometry, whether it differs from geometry, and
+// the problem that prevented the repair, in which case geometry is returned
+func makeValid(geometry orb.Geometry) (orb.Geometry, bool, string) {
+	switch g := geometry.(type) {
+	case orb.Point:
+		if !finitePoint(g) {
+			return geometry, false, "non-finite coordinates"
+		}
+	case orb.MultiPoint:
+		for _, point := range g {
+			if !finitePoint(point) {
+				return geometry, false, "non-finite coordinates"
+			}
+		}
+	case orb.LineString:
+		if problem := checkLine(g); problem != "" {
+			return geometry, false, problem
+		}
+	case orb.MultiLineString:
+		for _, line := range g {
+			if problem := checkLine(line); problem != "" {
+				return geometry, false, problem
+			}
+		}
+	case orb.Polygon:
+		polygons, repaired, problem := repairPolygon(g)
+		if problem != "" {
+			return geometry, false, problem
+		}
+		if !repaired {
+			return geometry, false, ""
+		}
+		if len(polygons) == 1 {
+			return polygons[0], true, ""
+		}
+		return polygons, true, ""
+	case orb.MultiPolygon:
+		var polygons orb.MultiPolygon
+		changed := false
+		for _, polygon := range g {
+			parts, repaired, problem := repairPolygon(polygon)
+			if problem == problemZeroArea && len(g) > 1 {
+				// Drop the collapsed parts of a multipolygon
+				changed = true
+				continue
+			}
+			if problem != "" {
+				return geometry, false, problem
+			}
+			changed = changed || repaired
+			polygons = append(polygons, parts...)
+		}
+		if len(polygons) == 0 {
+			return geometry, false, problemZeroArea
+		}
+		if !changed {
+			return geometry, false, ""
+		}
+		return polygons, true, ""
+	case orb.Collection:
+		members := make(orb.Collection, len(g))
+		changed := false
+		for i, member := range g {
+			valid, repaired, problem := makeValid(member)
+			if problem != "" {
+				return geometry, false, problem
+			}
+			members[i] = valid
+			changed = changed || repaired
+		}
+		if !changed {
+			return geometry, false, ""
+		}
+		return members, true, ""
+	case GeometryZ:
+		valid, repaired, problem := makeValid(g.Geometry)
+		if !repaired {
+			return geometry, false, problem
+		}
+		return GeometryZ{Geometry: valid, Z: repairedZ(g.Geometry, valid, g.Z)}, true, ""
+	}
+	return geometry, false, ""
+}
+
+// finitePoint reports whether both coordinates of a point are finite
+func finitePoint(point orb.Point) bool {
+	return !math.IsNaN(point[0]) && !math.IsInf(point[0], 0) && !math.IsNaN(point[1]) && !math.IsInf(point[1], 0)
+}
+
+// checkLine returns the problem of a line, which needs finite coordinates and two
+// distinct positions
+func checkLine(line orb.LineString) string {
+	distinct := false
+	for i, point := range line {
+		if !finitePoint(point) {
+			return "non-finite coordinates"
+		}
+		if i > 0 && point != line[0] {
+			distinct = true
+		}
+	}
+	if !distinct {
+		return "line with fewer than two distinct positions"
+	}
+	return ""
+}
+
+// repairPolygon returns the valid polygons covering a polygon, and whether they differ
+// from it, or the problem that prevented the repair
+func repairPolygon(polygon orb.Polygon) (orb.MultiPolygon, bool, string) {
+	if len(polygon) == 0 {
+		return nil, false, "polygon without rings"
+	}
+	changed := false
+	var exteriors, holes []orb.Ring
+	for i, ring := range polygon {
+		for _, point := range ring {
+			if !finitePoint(point) {
+				return nil, false, "non-finite coordinates"
+			}
+		}
+		loops, repaired := simpleRings(ring)
+		changed = changed || repaired
+		if i == 0 {
+			exteriors = loops
+		} else {
+			holes = append(holes, loops...)
+		}
+	}
+	if len(exteriors) == 0 {
+		return nil, false, problemZeroArea
+	}
+
+	// Nested exteriors of a self-intersecting ring become holes, as with an even-odd fill
+	sort.SliceStable(exteriors, func(i, j int) bool {
+		return math.Abs(ringArea2(exteriors[i])) > math.Abs(ringArea2(exteriors[j]))
+	})
+	var polygons orb.MultiPolygon
+	for _, ring := range exteriors {
+		if owner := containingPolygon(polygons, ring); owner >= 0 {
+			polygons[owner] = append(polygons[owner], ring)
+			continue
+		}
+		polygons = append(polygons, orb.Polygon{ring})
+	}
+	for _, hole := range holes {
+		owner := containingPolygon(polygons, hole)
+		if owner < 0 {
+			changed = true
+			continue
+		}
+		polygons[owner] = append(polygons[owner], hole)
+	}
+	for _, repaired := range polygons {
+		if ringsCross(repaired) {
+			return nil, false, "rings of a polygon cross each other"
+		}
+	}
+	if !changed {
+		return orb.MultiPolygon{polygon}, false, ""
+	}
+	return polygons, true, ""
+}
+
+// containingPolygon returns the index of the polygon whose exterior contains ring, or -1
+func containingPolygon(polygons orb.MultiPolygon, ring orb.Ring) int {
+	for i, polygon := range polygons {
+		if ringInside(ring, polygon[0]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// ringInside reports whether a ring lies inside another ring that it does not cross,
+// testing its first position that is not on the boundary of the other
+func ringInside(ring, other orb.Ring) bool {
+	if !other.Bound().Contains(ring[0]) {
+		return false
+	}
+	for _, point := range ring {
+		if !onRing(other, point) {
+			return planar.RingContains(other, point)
+		}
+	}
+	// All positions are shared, test the middle of an edge
+	return planar.RingContains(other, orb.Point{(ring[0][0] + ring[1][0]) / 2, (ring[0][1] + ring[1][1]) / 2})
+}
+
+// onRing reports whether a point lies on the boundary of a ring
+func onRing(ring orb.Ring, point orb.Point) bool {
+	for i := 1; i < len(ring); i++ {
+		if orientation(ring[i-1], ring[i], point) == 0 && onSegment(ring[i-1], ring[i], point) {
+			return true
+		}
+	}
+	return false
+}
+
+// simpleRings splits a ring at its self-intersections and repeated positions into simple
+// closed rings with an area, and reports whether they differ from the ring, which is
+// also the case when it was not closed
+func simpleRings(ring orb.Ring) ([]orb.Ring, bool) {
+	// Drop consecutive duplicate positions and close the ring
+	points := make([]orb.Point, 0, len(ring)+1)
+	for _, point := range ring {
+		if len(points) == 0 || point != points[len(points)-1] {
+			points = append(points, point)
+		}
+	}
+	closed := len(ring) > 0 && ring[0] == ring[len(ring)-1]
+	if len(points) > 1 && points[0] != points[len(points)-1] {
+		points = append(points, points[0])
+	}
+	if len(points) < 4 {
+		return nil, true
+	}
+
+	// Insert the intersections of the edges as positions of both of them
+	segments := make([]segment, len(points)-1)
+	for i := range segments {
+		segments[i] = segment{a: points[i], b: points[i+1], index: i}
+	}
+	nodes := make([][]orb.Point, len(segments))
+	noded := false
+	forEachSegmentPair(segments, func(s, t segment) {
+		for _, point := range segmentIntersections(s, t) {
+			if point != s.a && point != s.b {
+				nodes[s.index] = append(nodes[s.index], point)
+				noded = true
+			}
+			if point != t.a && point != t.b {
+				nodes[t.index] = append(nodes[t.index], point)
+				noded = true
+			}
+		}
+	})
+	sequence := make([]orb.Point, 0, len(points))
+	for i, s := range segments {
+		sequence = append(sequence, s.a)
+		sort.Slice(nodes[i], func(j, k int) bool {
+			return planar.DistanceSquared(s.a, nodes[i][j]) < planar.DistanceSquared(s.a, nodes[i][k])
+		})
+		for _, node := range nodes[i] {
+			if node != sequence[len(sequence)-1] {
+				sequence = append(sequence, node)
+			}
+		}
+	}
+	sequence = append(sequence, points[0])
+
+	// Cut a loop whenever the walk comes back to a position of the current path
+	var loops []orb.Ring
+	var path []orb.Point
+	index := make(map[orb.Point]int)
+	for _, point := range sequence {
+		if start, ok := index[point]; ok {
+			loop := append(orb.Ring(nil), path[start:]...)
+			loop = append(loop, point)
+			if len(loop) >= 4 && loop.Orientation() != 0 {
+				loops = append(loops, loop)
+			}
+			for _, cut := range path[start+1:] {
+				delete(index, cut)
+			}
+			path = path[:start+1]
+			continue
+		}
+		index[point] = len(path)
+		path = append(path, point)
+	}
+
+	if closed && !noded && len(loops) == 1 && len(loops[0]) == len(points) {
+		return []orb.Ring{ring}, false
+	}
+	return loops, true
+}
+
+// ringsCross reports whether two rings of a polygon cross or overlap each other
+func ringsCross(polygon orb.Polygon) bool {
+	var segments []segment
+	for r, ring := range polygon {
+		for i := 1; i < len(ring); i++ {
+			segments = append(segments, segment{a: ring[i-1], b: ring[i], ring: r})
+		}
+	}
+	cross := false
+	forEachSegmentPair(segments, func(s, t segment) {
+		if cross || s.ring == t.ring {
+			return
+		}
+		points := segmentIntersections(s, t)
+		switch {
+		case len(points) > 1:
+			cross = true
+		case len(points) == 1:
+			// Rings may touch at a point, but not cross through an edge
+			point := points[0]
+			cross = point != s.a && point != s.b && point != t.a && point != t.b
+		}
+	})
+	return cross
+}
+
+// segment is an edge of a ring
+type segment struct {
+	a, b orb.Point
+	// ring is the index of the ring of the edge, index its position in the ring.
+	ring, index int
+}
+
+// forEachSegmentPair calls fn with the pairs of segments whose bounds overlap, sweeping
+// them from left to right
+func forEachSegmentPair(segments []segment, fn func(s, t segment)) {
+	order := make([]int, len(segments))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return math.Min(segments[order[i]].a[0], segments[order[i]].b[0]) < math.Min(segments[order[j]].a[0], segments[order[j]].b[0])
+	})
+	for i, si := range order {
+		s := segments[si]
+		maxX := math.Max(s.a[0], s.b[0])
+		minY, maxY := math.Min(s.a[1], s.b[1]), math.Max(s.a[1], s.b[1])
+		for _, ti := range order[i+1:] {
+			t := segments[ti]
+			if math.Min(t.a[0], t.b[0]) > maxX {
+				break
+			}
+			if math.Max(t.a[1], t.b[1]) < minY || math.Min(t.a[1], t.b[1]) > maxY {
+				continue
+			}
+			fn(s, t)
+		}
+	}
+}
+
+// segmentIntersections returns the point where two segments cross, or the endpoints of
+// each lying on the other when they touch or overlap
+func segmentIntersections(s, t segment) []orb.Point {
+	d1 := orientation(t.a, t.b, s.a)
+	d2 := orientation(t.a, t.b, s.b)
+	d3 := orientation(s.a, s.b, t.a)
+	d4 := orientation(s.a, s.b, t.b)
+	if (d1 > 0 && d2 < 0 || d1 < 0 && d2 > 0) && (d3 > 0 && d4 < 0 || d3 < 0 && d4 > 0) {
+		ratio := d1 / (d1 - d2)
+		return []orb.Point{{s.a[0] + ratio*(s.b[0]-s.a[0]), s.a[1] + ratio*(s.b[1]-s.a[1])}}
+	}
+
+	var points []orb.Point
+	add := func(point orb.Point) {
+		for _, existing := range points {
+			if existing == point {
+				return
+			}
+		}
+		points = append(points, point)
+	}
+	if d1 == 0 && onSegment(t.a, t.b, s.a) {
+		add(s.a)
+	}
+	if d2 == 0 && onSegment(t.a, t.b, s.b) {
+		add(s.b)
+	}
+	if d3 == 0 && onSegment(s.a, s.b, t.a) {
+		add(t.a)
+	}
+	if d4 == 0 && onSegment(s.a, s.b, t.b) {
+		add(t.b)
+	}
+	return points
+}
+
+// orientation returns twice the signed area of the triangle a, b, c: positive if c is
+// to the left of the line from a to b, negative if to the right and zero if collinear
+func orientation(a, b, c orb.Point) float64 {
+	return (b[0]-a[0])*(c[1]-a[1]) - (b[1]-a[1])*(c[0]-a[0])
+}
+
+// onSegment reports whether a point collinear with a segment lies within its bounds
+func onSegment(a, b, point orb.Point) bool {
+	return math.Min(a[0], b[0]) <= point[0] && point[0] <= math.Max(a[0], b[0]) &&
+		math.Min(a[1], b[1]) <= point[1] && point[1] <= math.Max(a[1], b[1])
+}
+
+// ringArea2 returns twice the signed area of a ring, positive if counterclockwise
+func ringArea2(ring orb.Ring) float64 {
+	area := 0.0
+	for i := 1; i < len(ring); i++ {
+		area += orientation(ring[0], ring[i-1], ring[i])
+	}
+	return area
+}
+
+// repairedZ returns the Z ordinates of the positions of a repaired geometry, taken from
+// the same positions of the original; positions added at intersections are interpolated
+// along the nearest original edge
+func repairedZ(original, repaired orb.Geometry, z []float64) []float64 {
+	originalPositions := appendPositions(nil, original)
+	known := make(map[orb.Point]float64)
+	for i, position := range originalPositions {
+		if _, ok := known[position]; !ok && i < len(z) {
+			known[position] = z[i]
+		}
+	}
+	positions := appendPositions(nil, repaired)
+	ordinates := make([]float64, len(positions))
+	for i, position := range positions {
+		if value, ok := known[position]; ok {
+			ordinates[i] = value
+			continue
+		}
+		nearest := math.Inf(1)
+		for j := 1; j < len(originalPositions) && j < len(z); j++ {
+			a, b := originalPositions[j-1], originalPositions[j]
+			if distance := planar.DistanceFromSegmentSquared(a, b, position); distance < nearest {
+				nearest = distance
+				ratio := 0.0
+				if length := planar.Distance(a, b); length > 0 {
+					ratio = planar.Distance(a, position) / length
+				}
+				ordinates[i] = z[j-1] + ratio*(z[j]-z[j-1])
+			}
+		}
+	}
+	return ordinates
+}
@@ -0,0 +1,249 @@
+package gogeo
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+)
+
+// WGS 84 ellipsoid
+const (
+	wgs84SemiMajorAxis = 6378137.0
+	wgs84Flattening    = 1 / 298.257223563
+)
+
+// maxVincentyIterations bounds the iterations of the Vincenty inverse formula, which
+// converges slowly or not at all for nearly antipodal positions
+const maxVincentyIterations = 200
+
+// areaUnits and lengthUnits give the size of the units of area and length columns in
+// square meters and meters
+var (
+	areaUnits   = map[string]float64{"m2": 1, "km2": 1e6, "ha": 1e4, "mi2": 2589988.110336}
+	lengthUnits = map[string]float64{"m": 1, "km": 1000, "mi": 1609.344, "ft": 0.3048}
+)
+
+// measureColumn is a column holding the area or length of the feature geometries
+type measureColumn struct {
+	name string
+	// Whether the column holds areas rather than lengths.
+	area bool
+	// Size of the unit of the column, in square meters or meters.
+	unit float64
+}
+
+// WithAreaColumn adds a DOUBLE column holding the geodesic area of the polygons of each
+// feature geometry on the WGS 84 ellipsoid, after any geometry transformation, in unit:
+// "m2", "km2", "ha" or "mi2". An empty unit is taken from the suffix of name, such as
+// "area_km2", and defaults to square meters. Lines and points have no area. The
+// coordinates must be longitudes and latitudes.
+func WithAreaColumn(name, unit string) Option {
+	return withMeasureColumn(name, unit, true, areaUnits, "m2")
+}
+
+// WithLengthColumn adds a DOUBLE column holding the geodesic length of the lines of each
+// feature geometry on the WGS 84 ellipsoid, after any geometry transformation, in unit:
+// "m", "km", "mi" or "ft". An empty unit is taken from the suffix of name, such as
+// "length_km", and defaults to meters. Polygons and points have no length. The
+// coordinates must be longitudes and latitudes.
+func WithLengthColumn(name, unit string) Option {
+	return withMeasureColumn(name, unit, false, lengthUnits, "m")
+}
+
+// withMeasureColumn adds an area or length column
+func withMeasureColumn(name, unit string, area bool, units map[string]float64, defaultUnit string) Option {
+	return func(cfg *config) {
+		if name == "" {
+			cfg.fail(AppError{Message: "measure column name must not be empty"})
+			return
+		}
+		if unit == "" {
+			unit = defaultUnit
+			if i := strings.LastIndexByte(name, '_'); i >= 0 {
+				if _, ok := units[strings.ToLower(name[i+1:])]; ok {
+					unit = name[i+1:]
+				}
+			}
+		}
+		size, ok := units[strings.ToLower(unit)]
+		if !ok {
+			known := make([]string, 0, len(units))
+			for symbol := range units {
+				known = append(known, symbol)
+			}
+			sort.Strings(known)
+			cfg.fail(AppError{Message: fmt.Sprintf("unsupported unit %q of column %q, expected %s", unit, name, strings.Join(known, ", "))})
+			return
+		}
+		for _, column := range cfg.measures {
+			if column.name == name {
+				cfg.fail(AppError{Message: fmt.Sprintf("duplicate measure column %q", name)})
+				return
+			}
+		}
+		for _, column := range cfg.cells {
+			if column.name == name {
+				cfg.fail(AppError{Message: fmt.Sprintf("duplicate computed column %q", name)})
+				return
+			}
+		}
+		cfg.measures = append(cfg.measures, measureColumn{name: name, area: area, unit: size})
+	}
+}
+
+// measure returns the area or length of a geometry in the unit of the column
+func (c measureColumn) measure(geometry orb.Geometry) float64 {
+	if c.area {
+		return geodesicArea(geometry) / c.unit
+	}
+	return geodesicLength(geometry) / c.unit
+}
+
+// geodesicArea returns the area of the polygons of a geometry of longitudes and
+// latitudes on the WGS 84 ellipsoid, in square meters
+func geodesicArea(geometry orb.Geometry) float64 {
+	switch g := geometry.(type) {
+	case orb.Polygon:
+		area := 0.0
+		for i, ring := range g {
+			if i == 0 {
+				area += math.Abs(geodesicRingArea(ring))
+			} else {
+				area -= math.Abs(geodesicRingArea(ring))
+			}
+		}
+		return math.Max(area, 0)
+	case orb.MultiPolygon:
+		area := 0.0
+		for _, polygon := range g {
+			area += geodesicArea(polygon)
+		}
+		return area
+	case orb.Ring:
+		return geodesicArea(orb.Polygon{g})
+	case orb.Bound:
+		return geodesicArea(g.ToPolygon())
+	case orb.Collection:
+		area := 0.0
+		for _, member := range g {
+			area += geodesicArea(member)
+		}
+		return area
+	case GeometryZ:
+		return geodesicArea(g.Geometry)
+	}
+	return 0
+}
+
+// geodesicRingArea returns the signed area of a ring, positive if counterclockwise. The
+// latitudes are mapped to authalic latitudes, on a sphere of the same area as the
+// ellipsoid where the area of every band of latitudes is kept, and the spherical excess
+// of the ring is summed edge by edge.
+func geodesicRingArea(ring orb.Ring) float64 {
+	sum := 0.0
+	for i := 1; i < len(ring); i++ {
+		a, b := ring[i-1], ring[i]
+		// Longitude differences cross the antimeridian the short way
+		dLon := math.Remainder((b[0]-a[0])*math.Pi/180, 2*math.Pi)
+		t1 := math.Tan(authalicLatitude(a[1]) / 2)
+		t2 := math.Tan(authalicLatitude(b[1]) / 2)
+		sum += 2 * math.Atan2(math.Tan(dLon/2)*(t1+t2), 1+t1*t2)
+	}
+	radius := authalicRadius()
+	return sum * radius * radius
+}
+
+// authalicQ is the q function of the authalic latitude for the sine of a latitude
+func authalicQ(sin float64) float64 {
+	e2 := wgs84Flattening * (2 - wgs84Flattening)
+	e := math.Sqrt(e2)
+	return (1 - e2) * (sin/(1-e2*sin*sin) - math.Log((1-e*sin)/(1+e*sin))/(2*e))
+}
+
+// authalicLatitude returns the authalic latitude, in radians, of a latitude in degrees
+func authalicLatitude(latitude float64) float64 {
+	ratio := authalicQ(math.Sin(latitude*math.Pi/180)) / authalicQ(1)
+	return math.Asin(math.Max(-1, math.Min(1, ratio)))
+}
+
+// authalicRadius returns the radius of the sphere of the same area as the ellipsoid
+func authalicRadius() float64 {
+	return wgs84SemiMajorAxis * math.Sqrt(authalicQ(1)/2)
+}
+
+// geodesicLength returns the length of the lines of a geometry of longitudes and
+// latitudes on the WGS 84 ellipsoid, in meters
+func geodesicLength(geometry orb.Geometry) float64 {
+	switch g := geometry.(type) {
+	case orb.LineString:
+		length := 0.0
+		for i := 1; i < len(g); i++ {
+			length += geodesicDistance(g[i-1], g[i])
+		}
+		return length
+	case orb.MultiLineString:
+		length := 0.0
+		for _, line := range g {
+			length += geodesicLength(line)
+		}
+		return length
+	case orb.Collection:
+		length := 0.0
+		for _, member := range g {
+			length += geodesicLength(member)
+		}
+		return length
+	case GeometryZ:
+		return geodesicLength(g.Geometry)
+	}
+	return 0
+}
+
+// geodesicDistance returns the length of the geodesic between two positions on the
+// WGS 84 ellipsoid, in meters, with the inverse formula of Vincenty. Nearly antipodal
+// positions, for which it does not converge, fall back to the great circle distance.
+func geodesicDistance(p1, p2 orb.Point) float64 {
+	a := wgs84SemiMajorAxis
+	f := wgs84Flattening
+	b := a * (1 - f)
+
+	L := math.Remainder((p2[0]-p1[0])*math.Pi/180, 2*math.Pi)
+	u1 := math.Atan((1 - f) * math.Tan(p1[1]*math.Pi/180))
+	u2 := math.Atan((1 - f) * math.Tan(p2[1]*math.Pi/180))
+	sinU1, cosU1 := math.Sincos(u1)
+	sinU2, cosU2 := math.Sincos(u2)
+
+	lambda := L
+	for range maxVincentyIterations {
+		sinLambda, cosLambda := math.Sincos(lambda)
+		sinSigma := math.Hypot(cosU2*sinLambda, cosU1*sinU2-sinU1*cosU2*cosLambda)
+		if sinSigma == 0 {
+			return 0
+		}
+		cosSigma := sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma := math.Atan2(sinSigma, cosSigma)
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cos2Alpha := 1 - sinAlpha*sinAlpha
+		cos2SigmaM := 0.0
+		if cos2Alpha != 0 {
+			// Lines along the equator have no midpoint latitude
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cos2Alpha
+		}
+		C := f / 16 * cos2Alpha * (4 + f*(4-3*cos2Alpha))
+		previous := lambda
+		lambda = L + (1-C)*f*sinAlpha*(sigma+C*sinSigma*(cos2SigmaM+C*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+		if math.Abs(lambda-previous) < 1e-12 {
+			uSquared := cos2Alpha * (a*a - b*b) / (b * b)
+			A := 1 + uSquared/16384*(4096+uSquared*(-768+uSquared*(320-175*uSquared)))
+			B := uSquared / 1024 * (256 + uSquared*(-128+uSquared*(74-47*uSquared)))
+			deltaSigma := B * sinSigma * (cos2SigmaM + B/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+				B/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+			return b * A * (sigma - deltaSigma)
+		}
+	}
+	return geo.DistanceHaversine(p1, p2)
+}
@@ -0,0 +1,179 @@
+package gogeo
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// memoryShares is the number of parts of the memory budget, each of the buffers
+// growing with the input being limited to one of them and the last one left to
+// decoding, encoding and the garbage collector
+const memoryShares = 4
+
+// WithMaxMemory bounds the memory held by the buffers that grow with the input, so that
+// large inputs are converted within a budget instead of running out of memory. Each of
+// them is limited to a quarter of the budget, and switches to a streaming strategy when
+// full:
+//
+//   - The pages of the row group being written are flushed as a row group, so that a
+//     file holds several row groups even without WithRowGroupSize.
+//   - A stream read by GenerateFrom without WithSchema is copied to a temporary file
+//     and read twice, rather than having its features held in memory.
+//   - With WithSpatialSort and WithSortBy, the features are sorted in runs, each
+//     written as its own row groups, so that every row group is still sorted but the
+//     file as a whole only within each run.
+//
+// The sizes of the features held are estimated, so the budget is approximate. 0, the
+// default, sets no limit.
+func WithMaxMemory(bytes int64) Option {
+	return func(cfg *config) {
+		cfg.maxMemory = bytes
+	}
+}
+
+// memoryShare returns the number of bytes a buffer may hold, 0 if there is no budget
+func (cfg *config) memoryShare() int64 {
+	return cfg.maxMemory / memoryShares
+}
+
+// featureSize estimates the number of bytes a decoded feature holds in memory
+func featureSize(feature *geojson.Feature) int64 {
+	size := int64(128)
+	if feature.Geometry != nil {
+		size += 64 + 16*int64(countPositions(feature.Geometry))
+		if z, ok := feature.Geometry.(GeometryZ); ok {
+			size += 8 * int64(len(z.Z))
+		}
+	}
+	return size + valueSize(map[string]any(feature.Properties))
+}
+
+// valueSize estimates the number of bytes a property value holds in memory
+func valueSize(value any) int64 {
+	switch v := value.(type) {
+	case string:
+		return 16 + int64(len(v))
+	case []byte:
+		return 24 + int64(len(v))
+	case map[string]any:
+		size := int64(48)
+		for key, element := range v {
+			size += 32 + int64(len(key)) + valueSize(element)
+		}
+		return size
+	case []any:
+		size := int64(24)
+		for _, element := range v {
+			size += 16 + valueSize(element)
+		}
+		return size
+	case orb.Geometry:
+		return 64 + 16*int64(countPositions(v))
+	default:
+		return 16
+	}
+}
+
+// spoolInput copies a stream, in memory up to limit bytes and to a temporary file
+// beyond, and returns an OpenFunc reading the copy and a function removing it
+func spoolInput(r io.Reader, limit int64) (OpenFunc, func(), error) {
+	var buffer bytes.Buffer
+	n, err := io.CopyN(&buffer, r, limit+1)
+	if errors.Is(err, io.EOF) || (err == nil && n <= limit) {
+		data := buffer.Bytes()
+		open := func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil }
+		return open, func() {}, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.CreateTemp("", "gogeo-input-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	remove := func() { os.Remove(file.Name()) }
+	if _, err := buffer.WriteTo(file); err != nil {
+		file.Close()
+		remove()
+		return nil, nil, err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		remove()
+		return nil, nil, err
+	}
+	if err := file.Close(); err != nil {
+		remove()
+		return nil, nil, err
+	}
+	open := func() (io.ReadCloser, error) { return os.Open(file.Name()) }
+	return open, remove, nil
+}
+
+// pageBuffers is a parquet.BufferPool of in-memory page buffers counting the bytes of
+// the pages they hold, which parquet-go keeps until the row group is flushed
+type pageBuffers struct {
+	pool parquet.BufferPool
+	size int64
+}
+
+func newPageBuffers() *pageBuffers {
+	return &pageBuffers{pool: parquet.NewChunkBufferPool(256 * 1024)}
+}
+
+func (p *pageBuffers) GetBuffer() io.ReadWriteSeeker {
+	return &countedBuffer{ReadWriteSeeker: p.pool.GetBuffer(), pool: p}
+}
+
+func (p *pageBuffers) PutBuffer(buffer io.ReadWriteSeeker) {
+	if counted, ok := buffer.(*countedBuffer); ok {
+		p.size -= counted.size
+		p.pool.PutBuffer(counted.ReadWriteSeeker)
+	}
+}
+
+// countedBuffer is a page buffer of pageBuffers
+type countedBuffer struct {
+	io.ReadWriteSeeker
+	pool *pageBuffers
+	size int64
+}
+
+func (b *countedBuffer) Write(p []byte) (int, error) {
+	n, err := b.ReadWriteSeeker.Write(p)
+	b.size += int64(n)
+	b.pool.size += int64(n)
+	return n, err
+}
+
+// rowGroupBreaks holds the numbers of rows after which the writer starts a new row
+// group, recorded by the reader of the sorted runs before it returns their features
+type rowGroupBreaks struct {
+	mu   sync.Mutex
+	rows []int
+}
+
+func (b *rowGroupBreaks) add(rows int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rows = append(b.rows, rows)
+}
+
+// reached reports whether a row group ends after this number of rows, forgetting the
+// breaks up to it
+func (b *rowGroupBreaks) reached(rows int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for len(b.rows) > 0 && b.rows[0] < rows {
+		b.rows = b.rows[1:]
+	}
+	return len(b.rows) > 0 && b.rows[0] == rows
+}
@@ -0,0 +1,256 @@
+package gogeo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/paulmach/orb/geojson"
+)
+
+// MergeGeoParquet concatenates the rows of GeoParquet inputs into one GeoParquet file
+// written to w. The inputs must share their primary column and CRS; the output keeps the
+// geometry columns and encodings of the first input, plus any further geometry columns
+// of the others. An unknown CRS cannot be kept.
+//
+// The property columns are the union of those of the inputs, typed from their Parquet
+// schemas: integer and floating point columns are merged as floating point, other type
+// differences are an error. Every property column is written as optional, so columns
+// missing from some inputs or required in only some of them are reconciled with nulls.
+// The geometry types and bbox of the geo metadata are computed from the merged rows.
+//
+// Options such as WithBBoxColumn or WithCompression apply to the output. The schema is
+// read from the footers, so the rows are read only once.
+func MergeGeoParquet(ctx context.Context, inputs []*io.SectionReader, w io.Writer, opts ...Option) (*Report, error) {
+	if len(inputs) == 0 {
+		return nil, AppError{Message: "no inputs to merge"}
+	}
+
+	var base []Option
+	var first *GeoParquet
+	encodings := make(map[string]string)
+	columns := make(map[string]PropertyInfo)
+	total := 0
+	for i, input := range inputs {
+		pf, err := parquet.OpenFile(input, input.Size(), parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+		if err != nil {
+			return nil, AppError{Message: fmt.Sprintf("failed to read input %d", i+1), Value: err}
+		}
+		geoMeta, err := readGeoMetadata(pf)
+		if err != nil {
+			return nil, AppError{Message: fmt.Sprintf("input %d", i+1), Value: err}
+		}
+		total += int(pf.NumRows())
+
+		if first == nil {
+			first = geoMeta
+			if base, err = geometryOptions(geoMeta); err != nil {
+				return nil, AppError{Message: "input 1", Value: err}
+			}
+		} else {
+			if geoMeta.PrimaryColumn != first.PrimaryColumn {
+				return nil, AppError{Message: fmt.Sprintf("input %d has primary column %q, input 1 has %q", i+1, geoMeta.PrimaryColumn, first.PrimaryColumn)}
+			}
+			if !sameCRS(geoMeta.Columns[geoMeta.PrimaryColumn].CRS, first.Columns[first.PrimaryColumn].CRS) {
+				return nil, AppError{Message: fmt.Sprintf("input %d has a different CRS than input 1, reproject it first", i+1)}
+			}
+		}
+		for name, column := range geoMeta.Columns {
+			if _, ok := first.Columns[name]; ok {
+				continue
+			}
+			if _, ok := encodings[name]; !ok {
+				encodings[name] = column.Encoding
+			}
+		}
+
+		skip := coveringColumns(geoMeta)
+		for _, field := range pf.Schema().Fields() {
+			name := field.Name()
+			if skip[name] {
+				continue
+			}
+			if _, ok := geoMeta.Columns[name]; ok {
+				continue
+			}
+			info, err := nodePropertyInfo(name, field)
+			if err == nil {
+				err = mergeColumn(columns, info)
+			}
+			if err != nil {
+				return nil, AppError{Message: fmt.Sprintf("input %d", i+1), Value: err}
+			}
+		}
+	}
+
+	extra := make([]string, 0, len(encodings))
+	for name := range encodings {
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		base = append(base, WithGeometryColumn(name, encodings[name]))
+	}
+
+	cfg := newConfig(append(base, opts...))
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	schema := cfg.schema
+	if schema == nil {
+		reserved := cfg.reservedColumns()
+		names := make([]string, 0, len(columns))
+		for name := range columns {
+			if !reserved[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			schema = append(schema, columns[name])
+		}
+		// The rows of the inputs lacking a column are null in it
+		schema = cfg.selectSchema(nullableSchema(schema))
+	}
+
+	reader := &concatReader{}
+	defer reader.Close()
+	for _, input := range inputs {
+		rows, err := newGeoParquetReader(input, input.Size())
+		if err != nil {
+			return nil, err
+		}
+		reader.readers = append(reader.readers, rows)
+	}
+	return generate(withContext(ctx, reader), w, schema, cfg, total)
+}
+
+// parquetPropertyType maps the type of a Parquet leaf column to a property type
+func parquetPropertyType(t parquet.Type) PropertyType {
+	if logical := t.LogicalType(); logical != nil {
+		switch {
+		case logical.Timestamp != nil:
+			return PropertyTypeTimestamp
+		case logical.Date != nil:
+			return PropertyTypeDate
+		case logical.UUID != nil:
+			return PropertyTypeUUID
+		case logical.Json != nil:
+			return PropertyTypeJSON
+		case logical.Integer != nil && !logical.Integer.IsSigned && t.Kind() == parquet.Int64:
+			return PropertyTypeUint
+		}
+	}
+	switch t.Kind() {
+	case parquet.Boolean:
+		return PropertyTypeBool
+	case parquet.Int32, parquet.Int64:
+		return PropertyTypeInt
+	case parquet.Float, parquet.Double:
+		return PropertyTypeFloat
+	default:
+		return PropertyTypeString
+	}
+}
+
+// mergeColumn records a column in columns, merging it with a column of the same name
+// of an earlier input
+func mergeColumn(columns map[string]PropertyInfo, info PropertyInfo) error {
+	existing, ok := columns[info.Name]
+	if !ok {
+		columns[info.Name] = info
+		return nil
+	}
+	merged, err := mergePropertyInfo(info.Name, existing, info)
+	if err != nil {
+		return err
+	}
+	columns[info.Name] = merged
+	return nil
+}
+
+// mergePropertyInfo returns the column holding the values of two columns of the given
+// name, merging the fields of struct columns and the elements of list columns
+func mergePropertyInfo(name string, existing, info PropertyInfo) (PropertyInfo, error) {
+	switch {
+	case existing.Type == PropertyTypeList && info.Type == PropertyTypeList:
+		element, err := mergePropertyInfo(name+".element", PropertyInfo{Type: existing.Element}, PropertyInfo{Type: info.Element})
+		existing.Element = element.Type
+		return existing, err
+	case existing.Type == PropertyTypeStruct && info.Type == PropertyTypeStruct:
+		merged := existing
+		merged.Fields = slices.Clone(existing.Fields)
+		for _, field := range info.Fields {
+			i := slices.IndexFunc(merged.Fields, func(f PropertyInfo) bool { return f.Name == field.Name })
+			if i < 0 {
+				merged.Fields = append(merged.Fields, field)
+				continue
+			}
+			mergedField, err := mergePropertyInfo(name+"."+field.Name, merged.Fields[i], field)
+			if err != nil {
+				return existing, err
+			}
+			merged.Fields[i] = mergedField
+		}
+		slices.SortFunc(merged.Fields, func(a, b PropertyInfo) int { return strings.Compare(a.Name, b.Name) })
+		return merged, nil
+	case existing.Type == info.Type:
+		existing.Bits = widerIntegerBits(existing.Bits, info.Bits)
+		return existing, nil
+	case isNumeric(existing.Type) && isNumeric(info.Type):
+		existing.Type = PropertyTypeFloat
+		existing.Bits = 0
+		return existing, nil
+	}
+	return existing, AppError{Message: fmt.Sprintf("column %q is %s, but %s in an earlier input", name, info.Type, existing.Type)}
+}
+
+// sameCRS reports whether two CRS of geo metadata are the same, an omitted CRS
+// being OGC:CRS84
+func sameCRS(a, b json.RawMessage) bool {
+	if a == nil {
+		a = DefaultCRSDefinition()
+	}
+	if b == nil {
+		b = DefaultCRSDefinition()
+	}
+	var x, y any
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// concatReader reads the rows of GeoParquet readers one after the other
+type concatReader struct {
+	readers []*geoParquetReader
+}
+
+func (r *concatReader) Next() (*geojson.Feature, error) {
+	for len(r.readers) > 0 {
+		feature, err := r.readers[0].Next()
+		if !errors.Is(err, io.EOF) {
+			return feature, err
+		}
+		r.readers[0].Close()
+		r.readers = r.readers[1:]
+	}
+	return nil, io.EOF
+}
+
+// Close releases the rows of the remaining readers
+func (r *concatReader) Close() error {
+	for _, reader := range r.readers {
+		reader.Close()
+	}
+	r.readers = nil
+	return nil
+}
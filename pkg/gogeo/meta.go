@@ -0,0 +1,215 @@
+package gogeo
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/encoding/thrift"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// parquetMagic starts and ends every Parquet file
+const parquetMagic = "PAR1"
+
+// MetadataUpdate describes changes to the geo metadata of a GeoParquet file.
+type MetadataUpdate struct {
+	// Metadata replaces the whole geo metadata when set; the other changes are applied
+	// on top of it.
+	Metadata json.RawMessage
+	// PrimaryColumn makes another described geometry column the primary one.
+	PrimaryColumn string
+	// CRS sets the PROJJSON CRS of Column, or of the primary column if Column is
+	// empty. The JSON literal null declares the CRS as unknown. A bbox of the column
+	// crossing the antimeridian is removed unless the CRS is geographic.
+	CRS json.RawMessage
+	// Column is the geometry column whose CRS is set.
+	Column string
+}
+
+// ReadMetadataValue returns the value of a key of the key-value metadata of Parquet
+// data of the given size read from r, and whether the key is present.
+func ReadMetadataValue(r io.ReaderAt, size int64, key string) (string, bool, error) {
+	pf, err := parquet.OpenFile(r, size, parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+	if err != nil {
+		return "", false, AppError{Message: "failed to read Parquet file", Value: err}
+	}
+	value, ok := pf.Lookup(key)
+	return value, ok, nil
+}
+
+// RewriteMetadata copies Parquet data of the given size from r to w with the key-value
+// metadata key set to value, or removed if value is empty. Only the footer is encoded
+// again: the data pages are copied byte for byte.
+func RewriteMetadata(r io.ReaderAt, size int64, w io.Writer, key, value string) error {
+	pf, err := parquet.OpenFile(r, size, parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+	if err != nil {
+		return AppError{Message: "failed to read Parquet file", Value: err}
+	}
+	return rewriteFooter(r, size, w, pf, key, value)
+}
+
+// UpdateGeoMetadata copies GeoParquet of the given size from r to w with its geo
+// metadata changed as described by update, rewriting only the footer. The metadata is
+// edited as a JSON object, so members gogeo does not know are kept. The result must
+// pass the metadata and schema checks of ValidateGeoParquet; otherwise the violations
+// are returned as an error before anything is written.
+func UpdateGeoMetadata(r io.ReaderAt, size int64, w io.Writer, update MetadataUpdate) error {
+	pf, err := parquet.OpenFile(r, size, parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+	if err != nil {
+		return AppError{Message: "failed to read Parquet file", Value: err}
+	}
+
+	source := update.Metadata
+	if source == nil {
+		value, ok := pf.Lookup(GeoParquetMetadataKey)
+		if !ok {
+			return AppError{Message: "file has no geo metadata, pass the whole metadata to add it"}
+		}
+		source = json.RawMessage(value)
+	}
+	var metadata map[string]any
+	if err := json.Unmarshal(source, &metadata); err != nil {
+		return AppError{Message: "geo metadata is not a JSON object", Value: err}
+	}
+
+	if update.PrimaryColumn != "" {
+		metadata["primary_column"] = update.PrimaryColumn
+	}
+	if update.CRS != nil {
+		if err := setColumnCRS(metadata, update.Column, update.CRS); err != nil {
+			return err
+		}
+	}
+
+	return writeGeoMetadata(r, size, w, pf, metadata)
+}
+
+// writeGeoMetadata checks geo metadata against the metadata and Parquet schemas and
+// copies the file with a footer holding it
+func writeGeoMetadata(r io.ReaderAt, size int64, w io.Writer, pf *parquet.File, metadata map[string]any) error {
+	report := &ValidationReport{}
+	columns := validateGeoMetadata(metadata, report)
+	validateGeometrySchema(pf, columns, report)
+	if !report.Valid() {
+		return AppError{Message: "invalid geo metadata: " + strings.Join(report.Violations, "; ")}
+	}
+
+	value, err := json.Marshal(metadata)
+	if err != nil {
+		return AppError{Message: "failed to encode geo metadata", Value: err}
+	}
+	return rewriteFooter(r, size, w, pf, GeoParquetMetadataKey, string(value))
+}
+
+// setColumnCRS sets the crs member of a geometry column of the metadata
+func setColumnCRS(metadata map[string]any, column string, crs json.RawMessage) error {
+	if column == "" {
+		column, _ = metadata["primary_column"].(string)
+	}
+	columns, _ := metadata["columns"].(map[string]any)
+	object, ok := columns[column].(map[string]any)
+	if !ok {
+		return AppError{Message: fmt.Sprintf("geometry column %q is not described in geo metadata", column)}
+	}
+
+	if string(crs) == "null" {
+		object["crs"] = nil
+		dropAntimeridianBBox(object, crs)
+		return nil
+	}
+	if err := validateCRS(crs); err != nil {
+		return err
+	}
+	var definition any
+	if err := json.Unmarshal(crs, &definition); err != nil {
+		return AppError{Message: "invalid CRS definition", Value: err}
+	}
+	object["crs"] = definition
+	dropAntimeridianBBox(object, crs)
+	return nil
+}
+
+// dropAntimeridianBBox removes the bbox of a geometry column if it crosses the
+// antimeridian, with xmin > xmax, and crs is not geographic. Such a bbox means nothing
+// in a projected CRS, and the extent of the x coordinates is not known without
+// reading the geometries. Other bboxes still bound the unchanged coordinates.
+func dropAntimeridianBBox(object map[string]any, crs json.RawMessage) {
+	if geographicCRS(crs) {
+		return
+	}
+	bbox, _ := object["bbox"].([]any)
+	if len(bbox) != 4 && len(bbox) != 6 {
+		return
+	}
+	xmin, _ := bbox[0].(float64)
+	xmax, _ := bbox[len(bbox)/2].(float64)
+	if xmin > xmax {
+		delete(object, "bbox")
+	}
+}
+
+// rewriteFooter copies the data pages of a Parquet file and writes a new footer with
+// the key-value metadata key set to value, or removed if value is empty
+func rewriteFooter(r io.ReaderAt, size int64, w io.Writer, pf *parquet.File, key, value string) error {
+	dataSize, err := footerOffset(r, size)
+	if err != nil {
+		return err
+	}
+
+	metadata := *pf.Metadata()
+	metadata.KeyValueMetadata = make([]format.KeyValue, 0, len(pf.Metadata().KeyValueMetadata)+1)
+	found := false
+	for _, kv := range pf.Metadata().KeyValueMetadata {
+		if kv.Key == key {
+			if found || value == "" {
+				continue
+			}
+			kv.Value, found = value, true
+		}
+		metadata.KeyValueMetadata = append(metadata.KeyValueMetadata, kv)
+	}
+	if !found && value != "" {
+		metadata.KeyValueMetadata = append(metadata.KeyValueMetadata, format.KeyValue{Key: key, Value: value})
+	}
+
+	if _, err := io.Copy(w, io.NewSectionReader(r, 0, dataSize)); err != nil {
+		return AppError{Message: "failed to copy Parquet data", Value: err}
+	}
+	return writeFooter(w, &metadata)
+}
+
+// footerOffset returns the offset of the footer of a Parquet file, which is the size
+// of its data pages and page indexes
+func footerOffset(r io.ReaderAt, size int64) (int64, error) {
+	var trailer [8]byte
+	if _, err := r.ReadAt(trailer[:], size-8); err != nil {
+		return 0, AppError{Message: "failed to read Parquet footer", Value: err}
+	}
+	if string(trailer[4:]) != parquetMagic {
+		return 0, AppError{Message: "unsupported Parquet footer, encrypted files cannot be rewritten"}
+	}
+	return size - 8 - int64(binary.LittleEndian.Uint32(trailer[:4])), nil
+}
+
+// writeFooter writes the footer of a Parquet file holding metadata, after its data
+func writeFooter(w io.Writer, metadata *format.FileMetaData) error {
+	footer, err := thrift.Marshal(new(thrift.CompactProtocol), metadata)
+	if err != nil {
+		return AppError{Message: "failed to encode Parquet footer", Value: err}
+	}
+
+	var trailer [8]byte
+	binary.LittleEndian.PutUint32(trailer[:4], uint32(len(footer)))
+	copy(trailer[4:], parquetMagic)
+	if _, err := w.Write(footer); err != nil {
+		return AppError{Message: "failed to write Parquet footer", Value: err}
+	}
+	if _, err := w.Write(trailer[:]); err != nil {
+		return AppError{Message: "failed to write Parquet footer", Value: err}
+	}
+	return nil
+}
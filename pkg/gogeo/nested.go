@@ -0,0 +1,167 @@
+package gogeo
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// WithStructColumns writes object properties as Parquet struct columns, groups holding
+// one optional column per field of the objects, instead of their JSON text, so that
+// engines can query their fields as columns such as address.city. Fields holding
+// objects are written as structs too. The fields of a column are those of all its
+// objects, typed like properties; a property mixing objects with other values is
+// written as JSON, or as strings.
+func WithStructColumns() Option {
+	return func(cfg *config) {
+		cfg.structColumns = true
+	}
+}
+
+// WithListColumns writes properties holding arrays of scalars, such as
+// "tags": ["a", "b"], as Parquet LIST columns of their elements instead of their JSON
+// text. The type of the elements is inferred across all the arrays of a property, like
+// the type of a column, and null elements are dropped. A property mixing arrays with other
+// values, or holding arrays of objects or arrays, is written as JSON, or as strings.
+func WithListColumns() Option {
+	return func(cfg *config) {
+		cfg.listColumns = true
+	}
+}
+
+// structNode returns the node of a struct column, with one field per field of the column
+func structNode(fields []PropertyInfo) parquet.Node {
+	nodes := make([]parquet.Field, len(fields))
+	for i, info := range fields {
+		nodes[i] = namedField(info.Name, propertyNode(info, nil))
+	}
+	return groupNode{fields: nodes}
+}
+
+// newStructAppender returns the appender of a struct column whose first leaf column is
+// column, writing objects, and the index of the leaf column following its own
+func newStructAppender(info PropertyInfo, column int) (propertyAppender, int) {
+	first := column
+	fields := make([]propertyAppender, len(info.Fields))
+	for i, field := range info.Fields {
+		fields[i], column = newPropertyAppender(field, column)
+	}
+	end := column
+
+	return func(row parquet.Row, value any, def int) (parquet.Row, error) {
+		if value == nil {
+			for column := first; column < end; column++ {
+				row = append(row, parquet.NullValue().Level(0, def, column))
+			}
+			return row, nil
+		}
+		object, ok := value.(map[string]any)
+		if !ok {
+			return row, fmt.Errorf("cannot convert %T to %s", value, PropertyTypeStruct)
+		}
+		if info.Nullable {
+			def++
+		}
+		for i, field := range info.Fields {
+			value := object[field.Name]
+			if value == nil && !field.Nullable {
+				return row, fmt.Errorf("field %q is null, but its column is required", field.Name)
+			}
+			var err error
+			if row, err = fields[i](row, value, def); err != nil {
+				return row, fmt.Errorf("field %q: %w", field.Name, err)
+			}
+		}
+		return row, nil
+	}, end
+}
+
+// newListAppender returns the appender of a list column of leaf column column, writing
+// the elements of arrays and dropping their null elements
+func newListAppender(info PropertyInfo, column int) propertyAppender {
+	convert := newValueConverter(info.Element, 0)
+	return func(row parquet.Row, value any, def int) (parquet.Row, error) {
+		if value == nil {
+			return append(row, parquet.NullValue().Level(0, def, column)), nil
+		}
+		array, ok := value.([]any)
+		if !ok {
+			return row, fmt.Errorf("cannot convert %T to %s", value, PropertyTypeList)
+		}
+		if info.Nullable {
+			def++
+		}
+		// The elements are one level deeper, in the repeated group of the list, and all
+		// but the first repeat it
+		repetition := 0
+		for i, element := range array {
+			if element == nil {
+				continue
+			}
+			converted, err := convert(element)
+			if err != nil {
+				return row, fmt.Errorf("element %d: %w", i, err)
+			}
+			row = append(row, converted.Level(repetition, def+1, column))
+			repetition = 1
+		}
+		if repetition == 0 {
+			// An empty list
+			row = append(row, parquet.NullValue().Level(0, def, column))
+		}
+		return row, nil
+	}
+}
+
+// nodePropertyInfo returns the property column of a Parquet node: leaves are typed
+// from their Parquet type, groups are struct columns and lists of leaves are list
+// columns. Other lists and maps are not supported.
+func nodePropertyInfo(name string, node parquet.Node) (PropertyInfo, error) {
+	info := PropertyInfo{Name: name, Nullable: node.Optional()}
+	switch {
+	case isListOrMap(node) && node.Type().LogicalType().List != nil:
+		if element, ok := listLeafElement(node); ok {
+			info.Type = PropertyTypeList
+			info.Element = parquetPropertyType(element.Type())
+			return info, nil
+		}
+		return info, AppError{Message: fmt.Sprintf("column %q is a list of lists or groups, which is not supported", name)}
+	case node.Repeated() || isListOrMap(node):
+		return info, AppError{Message: fmt.Sprintf("column %q is a repeated column or a map, which is not supported", name)}
+	case node.Leaf():
+		info.Type = parquetPropertyType(node.Type())
+		if info.Type == PropertyTypeInt {
+			info.Bits = parquetIntegerBits(node.Type())
+		}
+	default:
+		info.Type = PropertyTypeStruct
+		for _, field := range node.Fields() {
+			child, err := nodePropertyInfo(name+"."+field.Name(), field)
+			if err != nil {
+				return info, err
+			}
+			child.Name = field.Name()
+			info.Fields = append(info.Fields, child)
+		}
+		slices.SortFunc(info.Fields, func(a, b PropertyInfo) int { return strings.Compare(a.Name, b.Name) })
+	}
+	return info, nil
+}
+
+// listLeafElement returns the element of a LIST group holding leaves
+func listLeafElement(node parquet.Node) (parquet.Node, bool) {
+	fields := node.Fields()
+	if len(fields) != 1 || !fields[0].Repeated() || len(fields[0].Fields()) != 1 {
+		return nil, false
+	}
+	element := fields[0].Fields()[0]
+	return element, element.Leaf() && !element.Repeated()
+}
+
+// isListOrMap reports whether a group node is annotated as a LIST or a MAP
+func isListOrMap(node parquet.Node) bool {
+	logical := node.Type().LogicalType()
+	return logical != nil && (logical.List != nil || logical.Map != nil)
+}
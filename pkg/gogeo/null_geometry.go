@@ -0,0 +1,45 @@
+package gogeo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Policies for the features without a geometry, set with WithNullGeometries
+const (
+	// NullGeometriesNull writes a feature without a geometry as a row whose geometry is
+	// null, in an optional geometry column.
+	NullGeometriesNull = "null"
+	// NullGeometriesSkip leaves out the features without a geometry, in a required
+	// geometry column.
+	NullGeometriesSkip = "skip"
+	// NullGeometriesFail fails the conversion at the first feature without a geometry.
+	NullGeometriesFail = "fail"
+)
+
+// WithNullGeometries sets how the features without a geometry, such as those of GeoJSON
+// with "geometry": null, are written: NullGeometriesNull, NullGeometriesSkip or
+// NullGeometriesFail. With NullGeometriesNull, the default, the primary geometry column
+// is optional; with the other policies it is required, as some readers expect. The
+// policy applies to the geometries after any geometry transformation, so exploding an
+// empty GeometryCollection gives a feature without a geometry.
+func WithNullGeometries(policy string) Option {
+	return func(cfg *config) {
+		switch normalized := strings.ToLower(policy); normalized {
+		case NullGeometriesNull:
+			cfg.nullGeometries, cfg.requiredGeometry = "", false
+		case NullGeometriesSkip, NullGeometriesFail:
+			cfg.nullGeometries, cfg.requiredGeometry = normalized, true
+		default:
+			cfg.fail(AppError{Message: fmt.Sprintf("unsupported null geometry policy %q, expected null, skip or fail", policy)})
+		}
+	}
+}
+
+// nullGeometryError returns the error of NullGeometriesFail for the nth feature
+func nullGeometryError(n int, id any) error {
+	if id != nil {
+		return AppError{Message: fmt.Sprintf("feature %d (id %v) has no geometry", n, id)}
+	}
+	return AppError{Message: fmt.Sprintf("feature %d has no geometry", n)}
+}
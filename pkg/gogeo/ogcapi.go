@@ -0,0 +1,211 @@
+package gogeo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb/geojson"
+)
+
+// OGCFeaturesRequest configures how the items of an OGC API Features collection are fetched.
+type OGCFeaturesRequest struct {
+	// Client sends the requests; nil uses NewHTTPClient.
+	Client *http.Client
+	// Header is sent with every request, e.g. an Authorization token.
+	Header http.Header
+	// Limit is the number of features requested per page, 0 for the server default.
+	Limit int
+	// MaxFeatures stops after this many features, 0 to read the whole collection.
+	MaxFeatures int
+}
+
+// OGCFeaturesReader pages through the items of an OGC API Features collection,
+// following the "next" link of each page until the last one. Only one page is held
+// in memory at a time.
+type OGCFeaturesReader struct {
+	ctx   context.Context
+	store *HTTPStore
+	// next is the URL of the next page, empty after the last one.
+	next string
+	// visited holds the URLs of the pages already fetched, so that a server linking
+	// back to an earlier page does not loop forever.
+	visited     map[string]bool
+	features    []*geojson.Feature
+	maxFeatures int
+	count       int
+}
+
+// ogcFeaturesPage is a page of items of a collection
+type ogcFeaturesPage struct {
+	Type     string            `json:"type"`
+	Features []json.RawMessage `json:"features"`
+	Links    []ogcLink         `json:"links"`
+}
+
+// ogcLink is a link of an OGC API response
+type ogcLink struct {
+	Href string `json:"href"`
+	Rel  string `json:"rel"`
+	Type string `json:"type"`
+}
+
+// NewOGCFeaturesReader returns a reader over the items of the collection at
+// collectionURL, given either as the collection, e.g.
+// https://example.com/collections/roads, or as its items endpoint. Query parameters
+// of the URL, such as bbox or datetime, are kept.
+func NewOGCFeaturesReader(ctx context.Context, collectionURL string, request OGCFeaturesRequest) (*OGCFeaturesReader, error) {
+	itemsURL, err := ogcItemsURL(collectionURL, request.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	header := request.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	if header.Get("Accept") == "" {
+		header.Set("Accept", "application/geo+json, application/json;q=0.9")
+	}
+
+	return &OGCFeaturesReader{
+		ctx:         ctx,
+		store:       &HTTPStore{Client: request.Client, Header: header},
+		next:        itemsURL,
+		visited:     make(map[string]bool),
+		maxFeatures: request.MaxFeatures,
+	}, nil
+}
+
+// Next returns the next feature of the collection, fetching the next page when the
+// current one is exhausted, or io.EOF after the last one.
+func (r *OGCFeaturesReader) Next() (*geojson.Feature, error) {
+	if r.maxFeatures > 0 && r.count >= r.maxFeatures {
+		return nil, io.EOF
+	}
+	for len(r.features) == 0 {
+		if r.next == "" {
+			return nil, io.EOF
+		}
+		if err := r.fetch(); err != nil {
+			return nil, err
+		}
+	}
+
+	feature := r.features[0]
+	r.features = r.features[1:]
+	r.count++
+	return feature, nil
+}
+
+// fetch reads the page at r.next and finds the link to the following one
+func (r *OGCFeaturesReader) fetch() error {
+	pageURL := r.next
+	r.visited[pageURL] = true
+	r.next = ""
+
+	body, err := r.store.Open(r.ctx, pageURL)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	var page ogcFeaturesPage
+	if err := json.NewDecoder(body).Decode(&page); err != nil {
+		return AppError{Message: fmt.Sprintf("failed to read features from %s", pageURL), Value: err}
+	}
+	if page.Type != "FeatureCollection" {
+		return AppError{Message: fmt.Sprintf("%s is not a GeoJSON FeatureCollection, is the URL an OGC API Features collection?", pageURL)}
+	}
+
+	r.features = make([]*geojson.Feature, len(page.Features))
+	for i, raw := range page.Features {
+		feature, err := decodeFeature(raw)
+		if err != nil {
+			return AppError{Message: fmt.Sprintf("failed to read features from %s", pageURL), Value: err}
+		}
+		r.features[i] = feature
+	}
+	if len(page.Features) == 0 {
+		return nil
+	}
+	next, err := ogcNextLink(pageURL, page.Links)
+	if err != nil {
+		return err
+	}
+	if next != "" && !r.visited[next] {
+		r.next = next
+	}
+	return nil
+}
+
+// ogcItemsURL returns the URL of the first page of items of a collection
+func ogcItemsURL(collectionURL string, limit int) (string, error) {
+	if !IsURL(collectionURL) {
+		return "", AppError{Message: fmt.Sprintf("invalid collection URL %q, expected an HTTP(S) URL", collectionURL)}
+	}
+	u, err := url.Parse(collectionURL)
+	if err != nil {
+		return "", AppError{Message: fmt.Sprintf("invalid collection URL %q", collectionURL), Value: err}
+	}
+	if limit < 0 {
+		return "", AppError{Message: fmt.Sprintf("invalid page limit %d", limit)}
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	if !strings.HasSuffix(u.Path, "/items") {
+		u.Path += "/items"
+	}
+	u.RawPath = ""
+	if limit > 0 {
+		query := u.Query()
+		query.Set("limit", strconv.Itoa(limit))
+		u.RawQuery = query.Encode()
+	}
+	return u.String(), nil
+}
+
+// ogcNextLink returns the absolute URL of the "next" link of a page, or "" if it is the last one
+func ogcNextLink(pageURL string, links []ogcLink) (string, error) {
+	for _, link := range links {
+		if link.Rel != "next" || link.Href == "" {
+			continue
+		}
+		// Servers may offer the next page in several formats
+		if link.Type != "" && !strings.Contains(link.Type, "json") {
+			continue
+		}
+
+		base, err := url.Parse(pageURL)
+		if err != nil {
+			return "", err
+		}
+		href, err := url.Parse(link.Href)
+		if err != nil {
+			return "", AppError{Message: fmt.Sprintf("invalid next link %q", link.Href), Value: err}
+		}
+		return base.ResolveReference(href).String(), nil
+	}
+	return "", nil
+}
+
+// GenerateFromOGCFeatures fetches all items of an OGC API Features collection and
+// writes them to w as GeoParquet. The collection is only fetched once: unless a schema
+// is supplied with WithSchema, the features are buffered in memory to infer it.
+func GenerateFromOGCFeatures(ctx context.Context, collectionURL string, request OGCFeaturesRequest, w io.Writer, opts ...Option) (*Report, error) {
+	cfg := newConfig(opts)
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	reader, err := NewOGCFeaturesReader(ctx, collectionURL, request)
+	if err != nil {
+		return nil, err
+	}
+	return generateBuffered(ctx, withContext(ctx, reader), w, cfg)
+}
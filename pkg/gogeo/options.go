@@ -0,0 +1,574 @@
+package gogeo
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// progressInterval is the number of features written between progress callbacks.
+const progressInterval = 1000
+
+// ProgressFunc is called periodically during a conversion with the number of
+// features written so far and the total number of features (0 if unknown).
+type ProgressFunc func(done, total int)
+
+// Option configures a conversion.
+type Option func(*config)
+
+// config holds the settings applied during a conversion
+type config struct {
+	// Property schema to use instead of inferring it from the input.
+	schema []PropertyInfo
+	// Callback invoked as features are written.
+	progress ProgressFunc
+	// Whether to write a per-row bbox covering column.
+	bboxColumn bool
+	// Whether to write per-feature bbox property columns.
+	bboxProperties bool
+	// PROJJSON definition of the coordinate reference system.
+	crs json.RawMessage
+	// Whether crs was set by an option rather than defaulted or read from the input.
+	crsSet bool
+	// Name of the column holding the feature geometry.
+	geometryName string
+	// Encoding of the geometry column (WKB or WKT).
+	geometryEncoding string
+	// Additional geometry columns read from feature properties.
+	extraGeometryColumns []GeometryColumn
+	// Kinds of the points of the additional geometry columns derived from the feature
+	// geometry rather than read from properties, by column name.
+	pointColumns map[string]string
+	// Name of the primary geometry column, empty for the feature geometry column.
+	primaryColumn string
+	// Number of features encoded concurrently.
+	jobs int
+	// Compression codec name.
+	compression string
+	// Maximum number of rows per row group, 0 for the parquet-go default.
+	rowGroupSize int64
+	// Size in bytes of the page buffers, 0 for parquet-go's, and of the write buffer,
+	// if writeBufferSet.
+	pageSize        int
+	writeBufferSize int
+	writeBufferSet  bool
+	// Columns written without min/max statistics, and the number of bytes the
+	// statistics of string and binary columns are truncated to, 0 to keep them whole.
+	skipStatistics  []string
+	statisticsLimit int
+	// Version of the Parquet format written, empty for ParquetVersion2, and the types of
+	// the columns written as strings for it and the compatibility profile.
+	parquetVersion string
+	stringTypes    map[PropertyType]bool
+	// Memory budget in bytes of the buffers growing with the input, 0 for no limit.
+	maxMemory int64
+	// Space-filling curve ordering the rows, empty to keep the input order.
+	spatialSort string
+	// Property columns ordering the rows, before the space-filling curve.
+	sortBy []SortColumn
+	// Filter selecting the features to convert, nil to convert all of them.
+	where filterExpr
+	// Lookup table enriching the properties of features, nil for none.
+	join *JoinTable
+	// Properties to keep and rename, nil to keep all of them.
+	columns *columnSelection
+	// Types of property columns replacing the inferred ones.
+	casts map[string]PropertyType
+	// Whether to infer timestamp and date columns.
+	inferTemporal bool
+	// Layouts of the timestamps and dates of string properties, besides RFC 3339, for
+	// all properties and for the properties parsed with their own.
+	datetimeFormats []datetimeLayout
+	datetimeColumns map[string]datetimeLayout
+	// Whether to infer UUID columns.
+	inferUUID bool
+	// Whether to write complex properties as plain strings rather than JSON columns.
+	plainJSON bool
+	// Whether to write object properties as struct columns, and arrays of scalars as
+	// list columns.
+	structColumns bool
+	listColumns   bool
+	// Whether to write integer columns in the smallest sufficient width.
+	narrowIntegers bool
+	// Whether to fail on type conflicts instead of promoting columns to string.
+	strictTypes bool
+	// Whether to write the property columns that are not nullable as required.
+	requiredColumns bool
+	// Column holding the feature ids, empty to drop them.
+	idColumn string
+	// Maximum number of distinct values of the string columns dictionary encoded as
+	// enums, 0 to detect none.
+	enumValues int
+	// Encodings of property columns by name, replacing the default ones.
+	encodings map[string]string
+	// Douglas-Peucker tolerance simplifying the feature geometries, 0 to keep them.
+	simplify float64
+	// Number of decimal places coordinates are rounded to, if precisionSet.
+	precision    int
+	precisionSet bool
+	// Whether to repair invalid feature geometries.
+	makeValid bool
+	// Whether to orient polygon exteriors counterclockwise and holes clockwise.
+	counterclockwise bool
+	// Whether to write single geometries as multi geometries.
+	promoteToMulti bool
+	// Policy for GeometryCollection geometries, empty to write them as they are.
+	collections string
+	// Whether to cut the geometries crossing the antimeridian.
+	splitAntimeridian bool
+	// Policy for the features without a geometry, empty to write null geometries, and
+	// whether the primary geometry column is required.
+	nullGeometries   string
+	requiredGeometry bool
+	// Policy for the features with an empty geometry, empty to write them.
+	emptyGeometries string
+	// Columns holding the area or length of the feature geometries.
+	measures []measureColumn
+	// Columns holding the grid cells of the centroids of the feature geometries.
+	cells []cellColumn
+	// Format of the input features, empty for GeoJSON or detection from the file extension.
+	inputFormat string
+	// Layer of a multi-layer input such as a GeoPackage, empty for the only layer.
+	layer string
+	// Columns holding the geometry of CSV input.
+	csvGeometry CSVGeometry
+	// Tag filters selecting the elements of OSM PBF input.
+	osmTags []string
+	// First error raised while applying options.
+	err error
+}
+
+// newConfig applies the options to a default configuration
+func newConfig(opts []Option) *config {
+	cfg := &config{
+		crs:              DefaultCRSDefinition(),
+		geometryName:     DefaultGeometryColumn,
+		geometryEncoding: DefaultGeometryEncoding,
+		compression:      DefaultCompression,
+		idColumn:         DefaultIDColumn,
+		jobs:             1,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// validate checks the configuration before anything is written
+func (cfg *config) validate() error {
+	if cfg.err != nil {
+		return cfg.err
+	}
+
+	if _, ok := compressionCodecs[cfg.compression]; !ok {
+		return AppError{Message: fmt.Sprintf("unsupported compression %q, expected zstd, snappy, gzip, lz4, brotli or none", cfg.compression)}
+	}
+	if cfg.rowGroupSize < 0 {
+		return AppError{Message: fmt.Sprintf("invalid row group size %d", cfg.rowGroupSize)}
+	}
+	if cfg.pageSize < 0 {
+		return AppError{Message: fmt.Sprintf("invalid page size %d", cfg.pageSize)}
+	}
+	if cfg.writeBufferSize < 0 {
+		return AppError{Message: fmt.Sprintf("invalid write buffer size %d", cfg.writeBufferSize)}
+	}
+	if cfg.statisticsLimit < 0 {
+		return AppError{Message: fmt.Sprintf("invalid statistics truncation %d", cfg.statisticsLimit)}
+	}
+	if cfg.maxMemory < 0 {
+		return AppError{Message: fmt.Sprintf("invalid memory budget %d", cfg.maxMemory)}
+	}
+	if cfg.columns != nil {
+		if err := cfg.columns.validate(); err != nil {
+			return err
+		}
+	}
+
+	derived := cfg.derivedColumns()
+	names := make(map[string]bool)
+	for _, column := range cfg.geometryColumns() {
+		if column.Name == "" {
+			return AppError{Message: "geometry column name must not be empty"}
+		}
+		if names[column.Name] {
+			return AppError{Message: fmt.Sprintf("duplicate geometry column %q", column.Name)}
+		}
+		if derived[column.Name] {
+			return AppError{Message: fmt.Sprintf("geometry column %q collides with a bbox, area, length or cell column", column.Name)}
+		}
+		names[column.Name] = true
+	}
+	if !names[cfg.primaryGeometryColumn()] {
+		return AppError{Message: fmt.Sprintf("primary column %q is not a geometry column", cfg.primaryColumn)}
+	}
+	if names[cfg.idColumn] || derived[cfg.idColumn] {
+		return AppError{Message: fmt.Sprintf("id column %q collides with a geometry or derived column", cfg.idColumn)}
+	}
+
+	return validateCRS(cfg.crs)
+}
+
+// fail records the first error raised while applying options
+func (cfg *config) fail(err error) {
+	if cfg.err == nil {
+		cfg.err = err
+	}
+}
+
+// geometryColumns returns all geometry columns, starting with the one holding the feature geometry
+func (cfg *config) geometryColumns() []GeometryColumn {
+	columns := []GeometryColumn{{Name: cfg.geometryName, Encoding: cfg.geometryEncoding}}
+	return append(columns, cfg.extraGeometryColumns...)
+}
+
+// primaryGeometryColumn returns the name of the primary geometry column
+func (cfg *config) primaryGeometryColumn() string {
+	if cfg.primaryColumn == "" {
+		return cfg.geometryName
+	}
+	return cfg.primaryColumn
+}
+
+// derivedColumns returns the names of the columns computed from the feature geometry
+func (cfg *config) derivedColumns() map[string]bool {
+	derived := make(map[string]bool)
+	if cfg.bboxColumn {
+		derived[DefaultBBoxColumn] = true
+	}
+	if cfg.bboxProperties {
+		for _, name := range bboxPropertyColumns {
+			derived[name] = true
+		}
+	}
+	for _, column := range cfg.measures {
+		derived[column.name] = true
+	}
+	for _, column := range cfg.cells {
+		derived[column.name] = true
+	}
+	return derived
+}
+
+// reservedColumns returns the column names that properties cannot use
+func (cfg *config) reservedColumns() map[string]bool {
+	reserved := cfg.derivedColumns()
+	for _, column := range cfg.geometryColumns() {
+		reserved[column.Name] = true
+	}
+	return reserved
+}
+
+// WithSchema sets the property columns to write instead of inferring them from the input.
+// With a schema the input is converted in a single streaming pass.
+func WithSchema(schema []PropertyInfo) Option {
+	return func(cfg *config) {
+		cfg.schema = schema
+	}
+}
+
+// WithProgress registers a callback invoked every 1000 written features and once
+// when writing completes.
+func WithProgress(fn ProgressFunc) Option {
+	return func(cfg *config) {
+		cfg.progress = fn
+	}
+}
+
+// WithBBoxColumn writes a per-row bbox struct column (xmin, ymin, xmax, ymax) and declares
+// it as the covering of the geometry column, enabling row group pruning per GeoParquet 1.1.
+func WithBBoxColumn() Option {
+	return func(cfg *config) {
+		cfg.bboxColumn = true
+	}
+}
+
+// WithBBoxProperties writes the bounding box of each feature as four plain float columns
+// (bbox_xmin, bbox_ymin, bbox_xmax, bbox_ymax). Unlike WithBBoxColumn they are not
+// declared as a covering, so they also serve readers limited to GeoParquet 1.0.
+func WithBBoxProperties() Option {
+	return func(cfg *config) {
+		cfg.bboxProperties = true
+	}
+}
+
+// WithCRS sets the PROJJSON definition of the coordinate reference system written into
+// the geo metadata. Coordinates are not reprojected. Defaults to DefaultCRSDefinition.
+func WithCRS(projjson json.RawMessage) Option {
+	return func(cfg *config) {
+		cfg.crs = projjson
+		cfg.crsSet = true
+	}
+}
+
+// WithCRSCode sets the coordinate reference system by code, such as "EPSG:3857".
+// The code must be built in or added with RegisterCRS.
+func WithCRSCode(code string) Option {
+	return func(cfg *config) {
+		definition, err := LookupCRS(code)
+		if err != nil {
+			cfg.fail(err)
+			return
+		}
+		cfg.crs = definition
+		cfg.crsSet = true
+	}
+}
+
+// WithGeometryEncoding sets the encoding of the geometry column: "WKB" (default) or "WKT".
+// WKT is stored as a UTF8 string column for tools that cannot decode WKB.
+func WithGeometryEncoding(encoding string) Option {
+	return func(cfg *config) {
+		normalized, err := normalizeGeometryEncoding(encoding)
+		if err != nil {
+			cfg.fail(err)
+			return
+		}
+		cfg.geometryEncoding = normalized
+	}
+}
+
+// WithGeometryColumn adds a geometry column read from the feature property of the same name.
+// The property may hold a GeoJSON geometry object or a WKT string; the encoding is "WKB" or "WKT".
+func WithGeometryColumn(name, encoding string) Option {
+	return func(cfg *config) {
+		normalized, err := normalizeGeometryEncoding(encoding)
+		if err != nil {
+			cfg.fail(err)
+			return
+		}
+		cfg.extraGeometryColumns = append(cfg.extraGeometryColumns, GeometryColumn{Name: name, Encoding: normalized})
+	}
+}
+
+// WithPrimaryColumn selects the geometry column recorded as primary_column in the geo metadata.
+// Defaults to the column holding the feature geometry.
+func WithPrimaryColumn(name string) Option {
+	return func(cfg *config) {
+		cfg.primaryColumn = name
+	}
+}
+
+// WithGeometryName sets the name of the column holding the feature geometry, which is
+// also the default primary_column. Defaults to DefaultGeometryColumn.
+func WithGeometryName(name string) Option {
+	return func(cfg *config) {
+		cfg.geometryName = name
+	}
+}
+
+// WithRowGroupSize sets the maximum number of rows per row group. Smaller row groups
+// allow finer-grained filtering by query engines, larger ones compress better.
+func WithRowGroupSize(rows int64) Option {
+	return func(cfg *config) {
+		cfg.rowGroupSize = rows
+	}
+}
+
+// WithPageSize sets the size in bytes of the buffer in which the pages of each column
+// are encoded, a page being written when its buffer fills, so it sets the size of the
+// pages before compression, give or take the values of a batch of 64 rows. Smaller pages take less memory per column, which adds
+// up for wide schemas, and let readers skip finer ranges of rows with the page index;
+// larger ones compress better and suit tiny rows. 0 keeps parquet-go's 256 KiB.
+func WithPageSize(bytes int) Option {
+	return func(cfg *config) {
+		cfg.pageSize = bytes
+	}
+}
+
+// WithWriteBufferSize sets the size in bytes of the buffer collecting the encoded pages
+// before they are written to the output, 0 writing them straight through. A larger
+// buffer makes fewer, larger writes, which suits slow outputs such as network
+// filesystems. Defaults to parquet-go's 32 KiB.
+func WithWriteBufferSize(bytes int) Option {
+	return func(cfg *config) {
+		cfg.writeBufferSize = bytes
+		cfg.writeBufferSet = true
+	}
+}
+
+// WithSpatialSort orders the rows along a space-filling curve, SpatialSortHilbert or
+// SpatialSortZOrder, through the centers of the feature bounding boxes. Nearby features
+// then share row groups, whose bounds become small enough for readers to skip most of
+// them in spatial queries. The features are held in memory to be sorted, or in runs
+// with WithMaxMemory.
+func WithSpatialSort(curve string) Option {
+	return func(cfg *config) {
+		normalized, err := normalizeSpatialSort(curve)
+		if err != nil {
+			cfg.fail(err)
+			return
+		}
+		cfg.spatialSort = normalized
+	}
+}
+
+// WithSortBy orders the rows by property columns, the first column deciding and each
+// following one breaking the ties of the previous ones. Nulls come last in either
+// direction. With WithSpatialSort, the curve breaks the remaining ties. The order is
+// recorded as the sorting_columns of every row group, for query engines that use it.
+// The features are held in memory to be sorted, or in runs with WithMaxMemory.
+func WithSortBy(columns ...SortColumn) Option {
+	return func(cfg *config) {
+		for _, column := range columns {
+			if column.Name == "" {
+				cfg.fail(AppError{Message: "sort column name must not be empty"})
+				return
+			}
+		}
+		cfg.sortBy = append(cfg.sortBy, columns...)
+	}
+}
+
+// WithPlainJSON writes object and array properties as plain UTF8 string columns of
+// their JSON text, as before the JSON logical type was used, for readers that do not
+// support it.
+func WithPlainJSON() Option {
+	return func(cfg *config) {
+		cfg.plainJSON = true
+	}
+}
+
+// WithCast writes the property column with the given name, after renaming, as propType
+// instead of the inferred or configured type. Values are converted to it: numbers
+// between integers, non-negative unsigned integers and floating point, numeric and
+// boolean strings are parsed, and any value can be written as a string. RFC 3339 timestamps, dates and milliseconds since
+// the epoch can be written as timestamps and dates, and any value as JSON, strings
+// holding JSON as they are. A value that cannot be converted fails the conversion.
+func WithCast(column string, propType PropertyType) Option {
+	return func(cfg *config) {
+		if column == "" {
+			cfg.fail(AppError{Message: "cast column name must not be empty"})
+			return
+		}
+		switch propType {
+		case PropertyTypeString, PropertyTypeInt, PropertyTypeUint, PropertyTypeFloat, PropertyTypeBool, PropertyTypeTimestamp, PropertyTypeDate, PropertyTypeUUID, PropertyTypeJSON:
+		default:
+			cfg.fail(AppError{Message: fmt.Sprintf("cannot cast %q to %s", column, propType)})
+			return
+		}
+		if cfg.casts == nil {
+			cfg.casts = make(map[string]PropertyType)
+		}
+		cfg.casts[column] = propType
+	}
+}
+
+// castSchema returns the property columns with the types configured with WithCast,
+// and those written as strings for compatibility
+func (cfg *config) castSchema(schema []PropertyInfo) ([]PropertyInfo, error) {
+	if len(cfg.casts) == 0 {
+		return cfg.compatibleSchema(schema), nil
+	}
+	cast := slices.Clone(schema)
+	found := 0
+	for i, info := range cast {
+		if propType, ok := cfg.casts[info.Name]; ok {
+			cast[i].Type = propType
+			cast[i].Bits = 0
+			if propType != PropertyTypeString {
+				cast[i].Enum = nil
+			}
+			found++
+		}
+	}
+	if found < len(cfg.casts) {
+		names := make([]string, 0, len(cfg.casts))
+		for name := range cfg.casts {
+			if !slices.ContainsFunc(cast, func(info PropertyInfo) bool { return info.Name == name }) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		return nil, AppError{Message: fmt.Sprintf("cannot cast %q, it is not a property column", names[0])}
+	}
+	return cfg.compatibleSchema(cast), nil
+}
+
+// WithWhere converts only the features whose properties match a CQL2 text style
+// filter, such as "population > 10000 AND country = 'US'". Properties are compared with
+// =, <>, <, <=, > and >=, tested with LIKE, BETWEEN, IN and IS NULL, and predicates are
+// combined with AND, OR, NOT and parentheses. Strings are 'quoted', and property names
+// that are not plain words "double quoted". Comparisons with null or missing
+// properties, or between values of different types, match no feature.
+func WithWhere(expr string) Option {
+	return func(cfg *config) {
+		filter, err := parseFilter(expr)
+		if err != nil {
+			cfg.fail(err)
+			return
+		}
+		cfg.where = filter
+	}
+}
+
+// WithCompression sets the compression codec of the column chunks: "zstd" (default),
+// "snappy", "gzip", "lz4", "brotli" or "none".
+func WithCompression(codec string) Option {
+	return func(cfg *config) {
+		cfg.compression = strings.ToLower(codec)
+	}
+}
+
+// WithJobs sets the number of workers encoding features concurrently; rows are still
+// written in input order. A value of 0 or less uses one worker per CPU. Defaults to 1.
+func WithJobs(n int) Option {
+	return func(cfg *config) {
+		if n <= 0 {
+			n = runtime.NumCPU()
+		}
+		cfg.jobs = n
+	}
+}
+
+// WithInputFormat sets the format of the input: "geojson" for a FeatureCollection,
+// "geojsonl" for newline-delimited GeoJSON with one Feature per line, "gpkg" for a
+// GeoPackage, "kml" and "kmz" for KML, "csv", "gml", or "pbf" for OpenStreetMap. Generate detects the format from the
+// file extension; streams default to "geojson".
+func WithInputFormat(format string) Option {
+	return func(cfg *config) {
+		normalized, err := normalizeFormat(format)
+		if err != nil {
+			cfg.fail(err)
+			return
+		}
+		cfg.inputFormat = normalized
+	}
+}
+
+// WithLayer selects the layer to convert from an input holding several, such as the
+// feature tables of a GeoPackage. Inputs with a single layer do not need it.
+func WithLayer(name string) Option {
+	return func(cfg *config) {
+		cfg.layer = name
+	}
+}
+
+// WithLonLatColumns builds point geometries of CSV input from a longitude and a latitude column.
+func WithLonLatColumns(lon, lat string) Option {
+	return func(cfg *config) {
+		cfg.csvGeometry.Lon = lon
+		cfg.csvGeometry.Lat = lat
+	}
+}
+
+// WithWKTColumn reads the geometries of CSV input from a column of WKT strings.
+func WithWKTColumn(name string) Option {
+	return func(cfg *config) {
+		cfg.csvGeometry.WKT = name
+	}
+}
+
+// WithOSMTags selects the nodes and ways of OSM PBF input having one of the tags, given
+// as "key" for any value or "key=value". Each key becomes a property column.
+func WithOSMTags(tags ...string) Option {
+	return func(cfg *config) {
+		if _, err := parseOSMTags(tags); err != nil {
+			cfg.fail(err)
+			return
+		}
+		cfg.osmTags = append(cfg.osmTags, tags...)
+	}
+}
@@ -0,0 +1,679 @@
+package gogeo
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// Limits of the OSM PBF format on the size of a blob header and of a blob
+const (
+	osmMaxHeaderSize = 64 * 1024
+	osmMaxBlobSize   = 32 * 1024 * 1024
+)
+
+// osmAreaKeys are the keys that make a closed way a polygon rather than a ring-shaped line
+var osmAreaKeys = []string{
+	"amenity", "building", "building:part", "historic", "landuse", "leisure",
+	"man_made", "military", "natural", "place", "shop", "tourism", "water",
+}
+
+// OSMReader reads the nodes and ways of an OpenStreetMap PBF file as features. Tagged
+// nodes become points, ways become line strings or, when closed and tagged as an area,
+// polygons. Relations are not assembled.
+//
+// Each feature has osm_type ("node" or "way") and osm_id properties, a property for
+// each key of the tag filter, and a tags property holding its other tags. Ways are
+// built from the coordinates of nodes read earlier in the file, so the file must list
+// nodes before ways as OSM extracts do; nodes missing from the file are skipped.
+type OSMReader struct {
+	source io.ReaderAt
+	size   int64
+	blobs  *osmBlobReader
+	filter []osmTag
+	// coordinates holds the coordinates of the nodes referenced by selected ways,
+	// filled while the nodes are read. Nodes not read yet have NaN coordinates.
+	coordinates map[int64]orb.Point
+	pending     []*geojson.Feature
+}
+
+// osmTag selects elements having a key, with any value if value is empty
+type osmTag struct {
+	key   string
+	value string
+}
+
+// NewOSMReader opens an OSM PBF file. Only elements with one of the filter tags are
+// read, given as "key" for any value or "key=value"; without a filter every tagged
+// node and every way is read. The file is scanned once to find the nodes of the
+// selected ways before features are returned.
+func NewOSMReader(r io.ReaderAt, size int64, tags []string) (*OSMReader, error) {
+	filter, err := parseOSMTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := &OSMReader{source: r, size: size, filter: filter, coordinates: make(map[int64]orb.Point)}
+	if err := reader.findWayNodes(); err != nil {
+		return nil, err
+	}
+	reader.blobs = newOSMBlobReader(io.NewSectionReader(r, 0, size))
+	return reader, nil
+}
+
+// parseOSMTags parses tag filters given as "key" or "key=value"
+func parseOSMTags(tags []string) ([]osmTag, error) {
+	var filter []osmTag
+	for _, tag := range tags {
+		key, value, _ := strings.Cut(tag, "=")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, AppError{Message: fmt.Sprintf("invalid OSM tag filter %q, expected key or key=value", tag)}
+		}
+		filter = append(filter, osmTag{key: key, value: strings.TrimSpace(value)})
+	}
+	return filter, nil
+}
+
+// matches reports whether an element with the given tags is selected by the filter
+func (r *OSMReader) matches(tags map[string]string, way bool) bool {
+	if len(r.filter) == 0 {
+		return way || len(tags) > 0
+	}
+	for _, tag := range r.filter {
+		if value, ok := tags[tag.key]; ok && (tag.value == "" || tag.value == value) {
+			return true
+		}
+	}
+	return false
+}
+
+// findWayNodes scans the file for the selected ways and records the nodes they reference
+func (r *OSMReader) findWayNodes() error {
+	blobs := newOSMBlobReader(io.NewSectionReader(r.source, 0, r.size))
+	for {
+		block, err := blobs.next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = block.elements(nil, func(way osmWay) {
+			if way.points == nil && r.matches(way.tags, true) {
+				for _, ref := range way.refs {
+					r.coordinates[ref] = orb.Point{math.NaN(), math.NaN()}
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Next returns the next selected node or way, or io.EOF after the last one.
+func (r *OSMReader) Next() (*geojson.Feature, error) {
+	for len(r.pending) == 0 {
+		block, err := r.blobs.next()
+		if err != nil {
+			return nil, err
+		}
+		err = block.elements(r.addNode, r.addWay)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	feature := r.pending[0]
+	r.pending = r.pending[1:]
+	return feature, nil
+}
+
+// addNode records the coordinates of a node referenced by a selected way and queues
+// the node itself if it is selected
+func (r *OSMReader) addNode(node osmNode) {
+	if _, ok := r.coordinates[node.id]; ok {
+		r.coordinates[node.id] = node.point
+	}
+	if len(node.tags) > 0 && r.matches(node.tags, false) {
+		r.pending = append(r.pending, r.feature("node", node.id, node.point, node.tags))
+	}
+}
+
+// addWay queues a selected way whose geometry can be built
+func (r *OSMReader) addWay(way osmWay) {
+	if !r.matches(way.tags, true) {
+		return
+	}
+
+	line := way.points
+	if line == nil {
+		for _, ref := range way.refs {
+			if point, ok := r.coordinates[ref]; ok && !math.IsNaN(point[0]) {
+				line = append(line, point)
+			}
+		}
+	}
+	if len(line) < 2 {
+		return
+	}
+
+	var geometry orb.Geometry = line
+	closed := len(way.refs) >= 4 && way.refs[0] == way.refs[len(way.refs)-1]
+	if closed && len(line) >= 4 && line[0] == line[len(line)-1] && isOSMArea(way.tags) {
+		geometry = orb.Polygon{orb.Ring(line)}
+	}
+	r.pending = append(r.pending, r.feature("way", way.id, geometry, way.tags))
+}
+
+// feature builds the feature of an element, with a property for each filter key and
+// the other tags in the tags property
+func (r *OSMReader) feature(elementType string, id int64, geometry orb.Geometry, tags map[string]string) *geojson.Feature {
+	feature := geojson.NewFeature(geometry)
+	feature.ID = fmt.Sprintf("%s/%d", elementType, id)
+	feature.Properties["osm_type"] = elementType
+	feature.Properties["osm_id"] = id
+
+	others := make(map[string]any)
+	for key, value := range tags {
+		others[key] = value
+	}
+	for _, tag := range r.filter {
+		if value, ok := tags[tag.key]; ok {
+			feature.Properties[tag.key] = value
+			delete(others, tag.key)
+		}
+	}
+	if len(others) > 0 {
+		feature.Properties["tags"] = others
+	} else {
+		feature.Properties["tags"] = nil
+	}
+	return feature
+}
+
+// isOSMArea reports whether the tags of a closed way describe an area
+func isOSMArea(tags map[string]string) bool {
+	switch tags["area"] {
+	case "yes":
+		return true
+	case "no":
+		return false
+	}
+	if tags["natural"] == "coastline" {
+		return false
+	}
+	for _, key := range osmAreaKeys {
+		if _, ok := tags[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// osmBlobReader reads the blobs of an OSM PBF file: each is a length-prefixed
+// BlobHeader followed by a Blob holding a header or a primitive block
+type osmBlobReader struct {
+	r      io.Reader
+	header bool
+}
+
+func newOSMBlobReader(r io.Reader) *osmBlobReader {
+	return &osmBlobReader{r: r}
+}
+
+// next returns the next primitive block, checking the header block on the way
+func (b *osmBlobReader) next() (*osmBlock, error) {
+	for {
+		var length [4]byte
+		if _, err := io.ReadFull(b.r, length[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				if !b.header {
+					return nil, AppError{Message: "not an OSM PBF file, no header block found"}
+				}
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("failed to read OSM PBF: %w", err)
+		}
+
+		headerSize := binary.BigEndian.Uint32(length[:])
+		if headerSize > osmMaxHeaderSize {
+			return nil, AppError{Message: "not an OSM PBF file, invalid blob header size"}
+		}
+		header := make([]byte, headerSize)
+		if _, err := io.ReadFull(b.r, header); err != nil {
+			return nil, fmt.Errorf("failed to read OSM PBF: %w", err)
+		}
+
+		var blobType string
+		var blobSize uint64
+		err := protoFields(header, func(field protoField) error {
+			switch field.number {
+			case 1:
+				blobType = string(field.data)
+			case 3:
+				blobSize = field.value
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid OSM PBF blob header: %w", err)
+		}
+		if blobSize > osmMaxBlobSize {
+			return nil, fmt.Errorf("OSM PBF blob of %d bytes exceeds the maximum size", blobSize)
+		}
+
+		blob := make([]byte, blobSize)
+		if _, err := io.ReadFull(b.r, blob); err != nil {
+			return nil, fmt.Errorf("failed to read OSM PBF: %w", err)
+		}
+		data, err := decodeOSMBlob(blob)
+		if err != nil {
+			return nil, err
+		}
+
+		switch blobType {
+		case "OSMHeader":
+			if err := checkOSMHeader(data); err != nil {
+				return nil, err
+			}
+			b.header = true
+		case "OSMData":
+			if !b.header {
+				return nil, AppError{Message: "not an OSM PBF file, data block before the header block"}
+			}
+			return parseOSMBlock(data)
+		}
+	}
+}
+
+// decodeOSMBlob returns the uncompressed content of a blob, stored raw or zlib compressed
+func decodeOSMBlob(blob []byte) ([]byte, error) {
+	var raw, compressed []byte
+	var rawSize uint64
+	var unsupported string
+	err := protoFields(blob, func(field protoField) error {
+		switch field.number {
+		case 1:
+			raw = field.data
+		case 2:
+			rawSize = field.value
+		case 3:
+			compressed = field.data
+		case 4:
+			unsupported = "lzma"
+		case 6:
+			unsupported = "lz4"
+		case 7:
+			unsupported = "zstd"
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid OSM PBF blob: %w", err)
+	}
+
+	switch {
+	case raw != nil:
+		return raw, nil
+	case compressed != nil:
+		if rawSize > osmMaxBlobSize {
+			return nil, fmt.Errorf("OSM PBF blob of %d bytes exceeds the maximum size", rawSize)
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, fmt.Errorf("invalid OSM PBF blob: %w", err)
+		}
+		defer zr.Close()
+		buf := bytes.NewBuffer(make([]byte, 0, rawSize))
+		if _, err := io.Copy(buf, io.LimitReader(zr, osmMaxBlobSize+1)); err != nil {
+			return nil, fmt.Errorf("invalid OSM PBF blob: %w", err)
+		}
+		if buf.Len() > osmMaxBlobSize {
+			return nil, errors.New("OSM PBF blob exceeds the maximum size")
+		}
+		return buf.Bytes(), nil
+	case unsupported != "":
+		return nil, fmt.Errorf("%s compressed OSM PBF blobs are not supported", unsupported)
+	}
+	return nil, nil
+}
+
+// checkOSMHeader fails if the file requires features this reader does not implement
+func checkOSMHeader(data []byte) error {
+	return protoFields(data, func(field protoField) error {
+		if field.number != 4 {
+			return nil
+		}
+		switch feature := string(field.data); feature {
+		case "OsmSchema-V0.6", "DenseNodes", "LocationsOnWays":
+			return nil
+		default:
+			return AppError{Message: fmt.Sprintf("OSM PBF file requires unsupported feature %q", feature)}
+		}
+	})
+}
+
+// osmBlock is a decoded PrimitiveBlock
+type osmBlock struct {
+	strings     []string
+	granularity int64
+	latOffset   int64
+	lonOffset   int64
+	groups      [][]byte
+}
+
+// osmNode is a node with its tags
+type osmNode struct {
+	id    int64
+	point orb.Point
+	tags  map[string]string
+}
+
+// osmWay is a way with the ids of its nodes, and their coordinates if the file stores
+// them on ways
+type osmWay struct {
+	id     int64
+	refs   []int64
+	points orb.LineString
+	tags   map[string]string
+}
+
+// parseOSMBlock decodes the string table and coordinate scaling of a PrimitiveBlock;
+// its groups are decoded by elements
+func parseOSMBlock(data []byte) (*osmBlock, error) {
+	block := &osmBlock{granularity: 100}
+	err := protoFields(data, func(field protoField) error {
+		switch field.number {
+		case 1:
+			return protoFields(field.data, func(s protoField) error {
+				if s.number == 1 {
+					block.strings = append(block.strings, string(s.data))
+				}
+				return nil
+			})
+		case 2:
+			block.groups = append(block.groups, field.data)
+		case 17:
+			block.granularity = int64(field.value)
+		case 19:
+			block.latOffset = int64(field.value)
+		case 20:
+			block.lonOffset = int64(field.value)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid OSM PBF block: %w", err)
+	}
+	return block, nil
+}
+
+// point converts stored coordinates to degrees
+func (b *osmBlock) point(lon, lat int64) orb.Point {
+	return orb.Point{
+		float64(b.lonOffset+b.granularity*lon) / 1e9,
+		float64(b.latOffset+b.granularity*lat) / 1e9,
+	}
+}
+
+// tags builds the tags of an element from string table indexes
+func (b *osmBlock) tags(keys, values []uint64) (map[string]string, error) {
+	if len(keys) != len(values) {
+		return nil, errors.New("mismatched tag keys and values")
+	}
+	tags := make(map[string]string, len(keys))
+	for i := range keys {
+		if keys[i] >= uint64(len(b.strings)) || values[i] >= uint64(len(b.strings)) {
+			return nil, errors.New("tag string index out of range")
+		}
+		tags[b.strings[keys[i]]] = b.strings[values[i]]
+	}
+	return tags, nil
+}
+
+// elements calls node and way for the nodes and ways of the block; a nil node
+// callback skips decoding nodes
+func (b *osmBlock) elements(node func(osmNode), way func(osmWay)) error {
+	for _, group := range b.groups {
+		err := protoFields(group, func(field protoField) error {
+			switch field.number {
+			case 1:
+				if node != nil {
+					return b.node(field.data, node)
+				}
+			case 2:
+				if node != nil {
+					return b.denseNodes(field.data, node)
+				}
+			case 3:
+				return b.way(field.data, way)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("invalid OSM PBF block: %w", err)
+		}
+	}
+	return nil
+}
+
+// node decodes a Node message
+func (b *osmBlock) node(data []byte, fn func(osmNode)) error {
+	var id, lat, lon int64
+	var keys, values []uint64
+	err := protoFields(data, func(field protoField) error {
+		var err error
+		switch field.number {
+		case 1:
+			id = protoZigZag(field.value)
+		case 2:
+			keys, err = protoVarints(keys, field)
+		case 3:
+			values, err = protoVarints(values, field)
+		case 8:
+			lat = protoZigZag(field.value)
+		case 9:
+			lon = protoZigZag(field.value)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	tags, err := b.tags(keys, values)
+	if err != nil {
+		return fmt.Errorf("node %d: %w", id, err)
+	}
+	fn(osmNode{id: id, point: b.point(lon, lat), tags: tags})
+	return nil
+}
+
+// denseNodes decodes a DenseNodes message: delta coded ids and coordinates, and the
+// tags of all nodes as key and value indexes, each node terminated by 0
+func (b *osmBlock) denseNodes(data []byte, fn func(osmNode)) error {
+	var ids, lats, lons, keysValues []uint64
+	err := protoFields(data, func(field protoField) error {
+		var err error
+		switch field.number {
+		case 1:
+			ids, err = protoVarints(ids, field)
+		case 8:
+			lats, err = protoVarints(lats, field)
+		case 9:
+			lons, err = protoVarints(lons, field)
+		case 10:
+			keysValues, err = protoVarints(keysValues, field)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(lats) != len(ids) || len(lons) != len(ids) {
+		return errors.New("dense nodes have mismatched ids and coordinates")
+	}
+
+	var id, lat, lon int64
+	tagIndex := 0
+	for i := range ids {
+		id += protoZigZag(ids[i])
+		lat += protoZigZag(lats[i])
+		lon += protoZigZag(lons[i])
+
+		var keys, values []uint64
+		for tagIndex < len(keysValues) && keysValues[tagIndex] != 0 {
+			if tagIndex+1 >= len(keysValues) {
+				return fmt.Errorf("node %d: truncated tags", id)
+			}
+			keys = append(keys, keysValues[tagIndex])
+			values = append(values, keysValues[tagIndex+1])
+			tagIndex += 2
+		}
+		tagIndex++
+
+		tags, err := b.tags(keys, values)
+		if err != nil {
+			return fmt.Errorf("node %d: %w", id, err)
+		}
+		fn(osmNode{id: id, point: b.point(lon, lat), tags: tags})
+	}
+	return nil
+}
+
+// way decodes a Way message with its delta coded node ids and, with LocationsOnWays,
+// coordinates
+func (b *osmBlock) way(data []byte, fn func(osmWay)) error {
+	var id int64
+	var keys, values, refs, lats, lons []uint64
+	err := protoFields(data, func(field protoField) error {
+		var err error
+		switch field.number {
+		case 1:
+			id = int64(field.value)
+		case 2:
+			keys, err = protoVarints(keys, field)
+		case 3:
+			values, err = protoVarints(values, field)
+		case 8:
+			refs, err = protoVarints(refs, field)
+		case 9:
+			lats, err = protoVarints(lats, field)
+		case 10:
+			lons, err = protoVarints(lons, field)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	tags, err := b.tags(keys, values)
+	if err != nil {
+		return fmt.Errorf("way %d: %w", id, err)
+	}
+
+	way := osmWay{id: id, refs: make([]int64, len(refs)), tags: tags}
+	var ref int64
+	for i := range refs {
+		ref += protoZigZag(refs[i])
+		way.refs[i] = ref
+	}
+	if len(lats) > 0 && len(lats) == len(refs) && len(lons) == len(refs) {
+		var lat, lon int64
+		way.points = make(orb.LineString, len(refs))
+		for i := range refs {
+			lat += protoZigZag(lats[i])
+			lon += protoZigZag(lons[i])
+			way.points[i] = b.point(lon, lat)
+		}
+	}
+	fn(way)
+	return nil
+}
+
+// protoField is a decoded protobuf field: the value of varint and fixed-size fields,
+// or the content of length-delimited fields
+type protoField struct {
+	number int
+	wire   int
+	value  uint64
+	data   []byte
+}
+
+// protoFields calls fn for each field of a protobuf message
+func protoFields(data []byte, fn func(protoField) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("invalid protobuf field key")
+		}
+		data = data[n:]
+
+		field := protoField{number: int(key >> 3), wire: int(key & 7)}
+		switch field.wire {
+		case 0:
+			field.value, n = binary.Uvarint(data)
+			if n <= 0 {
+				return errors.New("invalid protobuf varint")
+			}
+			data = data[n:]
+		case 1:
+			if len(data) < 8 {
+				return errors.New("truncated protobuf field")
+			}
+			field.value = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case 2:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return errors.New("truncated protobuf field")
+			}
+			field.data = data[n : n+int(length)]
+			data = data[n+int(length):]
+		case 5:
+			if len(data) < 4 {
+				return errors.New("truncated protobuf field")
+			}
+			field.value = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d", field.wire)
+		}
+
+		if err := fn(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// protoVarints appends the values of a repeated varint field, packed or not
+func protoVarints(values []uint64, field protoField) ([]uint64, error) {
+	if field.wire == 0 {
+		return append(values, field.value), nil
+	}
+	data := field.data
+	for len(data) > 0 {
+		value, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errors.New("invalid packed protobuf varint")
+		}
+		values = append(values, value)
+		data = data[n:]
+	}
+	return values, nil
+}
+
+// protoZigZag decodes a zigzag encoded sint64
+func protoZigZag(value uint64) int64 {
+	return int64(value>>1) ^ -int64(value&1)
+}
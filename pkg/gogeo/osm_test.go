@@ -0,0 +1,100 @@
+package gogeo
+
+import (
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// testdata/small.osm.pbf holds five dense nodes, node 5 tagged as a cafe, and three
+// ways in a zlib compressed block: way 10 an open highway over nodes 1, 2 and 3, way
+// 11 a closed building over nodes 1, 2, 4 and 1, and way 12 a highway from node 3 to
+// node 99, which is not in the file.
+func readOSMFixture(t *testing.T, tags []string) []*geojson.Feature {
+	t.Helper()
+	file, err := os.Open("testdata/small.osm.pbf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewOSMReader(file, info.Size(), tags)
+	if err != nil {
+		t.Fatalf("NewOSMReader() error = %v", err)
+	}
+	var features []*geojson.Feature
+	for {
+		feature, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return features
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		features = append(features, feature)
+	}
+}
+
+func TestOSMReader(t *testing.T) {
+	road := orb.LineString{{7, 46}, {7.001, 46}, {7.002, 46.001}}
+	building := orb.Polygon{{{7, 46}, {7.001, 46}, {7.001, 46.001}, {7, 46}}}
+	tests := []struct {
+		name string
+		tags []string
+		want []*geojson.Feature
+	}{
+		{"no filter", nil, []*geojson.Feature{
+			osmFeature("node/5", orb.Point{7.0005, 46.0005}, geojson.Properties{"osm_type": "node", "osm_id": int64(5), "tags": map[string]any{"amenity": "cafe", "name": "Corner"}}),
+			osmFeature("way/10", road, geojson.Properties{"osm_type": "way", "osm_id": int64(10), "tags": map[string]any{"highway": "residential", "name": "Main Street"}}),
+			osmFeature("way/11", building, geojson.Properties{"osm_type": "way", "osm_id": int64(11), "tags": map[string]any{"building": "yes"}}),
+		}},
+		{"key filter", []string{"highway"}, []*geojson.Feature{
+			osmFeature("way/10", road, geojson.Properties{"osm_type": "way", "osm_id": int64(10), "highway": "residential", "tags": map[string]any{"name": "Main Street"}}),
+		}},
+		{"value filter", []string{"building=yes", "amenity=bar"}, []*geojson.Feature{
+			osmFeature("way/11", building, geojson.Properties{"osm_type": "way", "osm_id": int64(11), "building": "yes", "tags": nil}),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := readOSMFixture(t, tt.tags)
+			if len(got) != len(tt.want) {
+				t.Fatalf("read %d features, want %d", len(got), len(tt.want))
+			}
+			for i, feature := range got {
+				want := tt.want[i]
+				if feature.ID != want.ID {
+					t.Errorf("feature %d has id %v, want %v", i, feature.ID, want.ID)
+				}
+				if !orb.Equal(feature.Geometry, want.Geometry) {
+					t.Errorf("%v has geometry %v, want %v", want.ID, feature.Geometry, want.Geometry)
+				}
+				if !reflect.DeepEqual(feature.Properties, want.Properties) {
+					t.Errorf("%v has properties %v, want %v", want.ID, feature.Properties, want.Properties)
+				}
+			}
+		})
+	}
+}
+
+func TestNewOSMReaderInvalidFilter(t *testing.T) {
+	if _, err := NewOSMReader(nil, 0, []string{"=yes"}); err == nil {
+		t.Error("NewOSMReader() accepted a filter without a key")
+	}
+}
+
+func osmFeature(id string, geometry orb.Geometry, properties geojson.Properties) *geojson.Feature {
+	feature := geojson.NewFeature(geometry)
+	feature.ID = id
+	feature.Properties = properties
+	return feature
+}
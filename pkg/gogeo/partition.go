@@ -0,0 +1,334 @@
+package gogeo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// Names of the files of a partitioned dataset
+const (
+	// PartitionManifestName is the name of the manifest listing the parts.
+	PartitionManifestName = "manifest.json"
+	// partitionNoGeometry is the cell of the features without a geometry
+	partitionNoGeometry = "none"
+	// maxPartitionDepth bounds the depth of the quadtree, so that features sharing a
+	// location cannot make it split forever
+	maxPartitionDepth = 24
+)
+
+// CreateFunc creates the file of a partitioned dataset with the given name.
+type CreateFunc func(name string) (BlobWriter, error)
+
+// PartitionManifest describes a dataset split into spatially coherent parts, so that
+// readers can select the parts intersecting an area from their bounds.
+type PartitionManifest struct {
+	// Number of features of all parts.
+	Features int `json:"features"`
+	// Maximum number of features of a part, except for parts of cells that could not
+	// be split further.
+	MaxFeatures int `json:"max_features"`
+	// Bounds of the root cell of the quadtree as [xmin, ymin, xmax, ymax].
+	BBox []float64 `json:"bbox"`
+	// PROJJSON CRS of the coordinates of all parts.
+	CRS json.RawMessage `json:"crs,omitempty"`
+	// Parts, one per non-empty leaf cell of the quadtree.
+	Parts []PartitionPart `json:"parts"`
+}
+
+// PartitionPart is a GeoParquet file holding the features of a quadtree cell.
+type PartitionPart struct {
+	// Name of the file, relative to the manifest.
+	Path string `json:"path"`
+	// Key of the cell: "q" for the root, followed by one digit per level giving the
+	// quadrant, 0 for the lower left, 1 lower right, 2 upper left and 3 upper right.
+	// Features without a geometry are in the cell "none".
+	Cell string `json:"cell"`
+	// Bounds of the cell; the centers of the bounding boxes of its features are within.
+	CellBBox []float64 `json:"cell_bbox,omitempty"`
+	// Bounds of the geometries of the part, which may extend beyond the cell.
+	BBox []float64 `json:"bbox,omitempty"`
+	// Number of features of the part.
+	Features int `json:"features"`
+}
+
+// Partition splits the features of the input opened by open, GeoJSON or another format
+// selected with WithInputFormat, into GeoParquet parts of at most maxFeatures features
+// each, and writes them with a PartitionManifestName manifest using create. Cells of a
+// quadtree over the centers of the feature bounding boxes are split into four until
+// they hold at most maxFeatures features, and each non-empty leaf cell becomes a part.
+//
+// The input is streamed twice. The center of every feature is held in memory, and the
+// rows of all parts are buffered until their row groups are written. All parts share
+// the same property columns.
+func Partition(ctx context.Context, open OpenFunc, create CreateFunc, maxFeatures int, opts ...Option) (*PartitionManifest, error) {
+	cfg := newConfig(opts)
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return partition(ctx, func() (FeatureReader, func() error, error) {
+		input, err := open()
+		if err != nil {
+			return nil, nil, AppError{Message: "failed to read GeoJSON file", Value: err}
+		}
+		reader, err := newFeatureReader(input, cfg)
+		if err != nil {
+			input.Close()
+			return nil, nil, err
+		}
+		return reader, input.Close, nil
+	}, create, maxFeatures, cfg)
+}
+
+// PartitionGeoParquet is like Partition for the rows of GeoParquet of the given size
+// read from r. The parts keep the geometry columns, encodings and CRS of the input
+// unless options replace them.
+func PartitionGeoParquet(ctx context.Context, r io.ReaderAt, size int64, create CreateFunc, maxFeatures int, opts ...Option) (*PartitionManifest, error) {
+	reader, err := newGeoParquetReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	reader.Close()
+	geometry, err := geometryOptions(reader.decoder.geoMeta)
+	if err != nil {
+		return nil, err
+	}
+	cfg := newConfig(append(geometry, opts...))
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return partition(ctx, func() (FeatureReader, func() error, error) {
+		reader, err := newGeoParquetReader(r, size)
+		if err != nil {
+			return nil, nil, err
+		}
+		return reader, reader.Close, nil
+	}, create, maxFeatures, cfg)
+}
+
+// partitionPoint is the center of the bounding box of a feature
+type partitionPoint struct {
+	x, y  float64
+	index int
+}
+
+// partitionCell is a leaf cell of the quadtree
+type partitionCell struct {
+	key    string
+	bound  orb.Bound
+	writer *FeatureWriter
+	output BlobWriter
+	count  int
+}
+
+// partition writes the features of the readers returned by open into parts
+func partition(ctx context.Context, open func() (FeatureReader, func() error, error), create CreateFunc, maxFeatures int, cfg *config) (*PartitionManifest, error) {
+	if maxFeatures <= 0 {
+		return nil, AppError{Message: fmt.Sprintf("invalid maximum number of features per part %d", maxFeatures)}
+	}
+	if cfg.spatialSort != "" || len(cfg.sortBy) > 0 {
+		return nil, AppError{Message: "sorting is not supported when partitioning, parts keep the input order"}
+	}
+
+	// First pass: infer the schema and collect the centers of the features
+	reader, closeInput, err := open()
+	if err != nil {
+		return nil, err
+	}
+	properties := newPropertyAnalyzer(cfg)
+	var points []partitionPoint
+	var bound orb.Bound
+	count := 0
+	err = forEachFeature(selectFeatures(withContext(ctx, reader), cfg), func(feature *geojson.Feature) error {
+		if _, err := featureGeometries(feature, cfg); err != nil {
+			return err
+		}
+		properties.add(feature)
+		if feature.Geometry != nil && countPositions(feature.Geometry) > 0 {
+			center := feature.Geometry.Bound().Center()
+			if len(points) == 0 {
+				bound = orb.Bound{Min: center, Max: center}
+			} else {
+				bound = bound.Extend(center)
+			}
+			points = append(points, partitionPoint{x: center[0], y: center[1], index: count})
+		}
+		count++
+		return nil
+	})
+	closeInput()
+	if err != nil {
+		return nil, AppError{Message: "failed to read features", Value: err}
+	}
+	if count == 0 {
+		return nil, AppError{Message: "no features found"}
+	}
+	if err := properties.conflicts.error(); err != nil {
+		return nil, err
+	}
+
+	// Assign each feature to a leaf cell; features without a geometry keep cell 0
+	var cells []*partitionCell
+	cellOf := make([]int32, count)
+	if len(points) < count {
+		cells = append(cells, &partitionCell{key: partitionNoGeometry})
+	}
+	var split func(key string, cellBound orb.Bound, points []partitionPoint, depth int)
+	split = func(key string, cellBound orb.Bound, points []partitionPoint, depth int) {
+		if len(points) == 0 {
+			return
+		}
+		if len(points) <= maxFeatures || depth >= maxPartitionDepth {
+			for _, point := range points {
+				cellOf[point.index] = int32(len(cells)) //nolint:gosec
+			}
+			cells = append(cells, &partitionCell{key: key, bound: cellBound})
+			return
+		}
+
+		center := cellBound.Center()
+		var quadrants [4][]partitionPoint
+		for _, point := range points {
+			quadrant := 0
+			if point.x > center[0] {
+				quadrant |= 1
+			}
+			if point.y > center[1] {
+				quadrant |= 2
+			}
+			quadrants[quadrant] = append(quadrants[quadrant], point)
+		}
+		for quadrant, points := range quadrants {
+			child := cellBound
+			if quadrant&1 == 0 {
+				child.Max[0] = center[0]
+			} else {
+				child.Min[0] = center[0]
+			}
+			if quadrant&2 == 0 {
+				child.Max[1] = center[1]
+			} else {
+				child.Min[1] = center[1]
+			}
+			split(key+string(rune('0'+quadrant)), child, points, depth+1)
+		}
+	}
+	split("q", bound, points, 0)
+
+	// Second pass: route each feature to the writer of its cell
+	schema, err := cfg.castSchema(properties.infos())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, cell := range cells {
+			if cell.output != nil {
+				cell.output.Abort()
+			}
+		}
+	}()
+	reader, closeInput, err = open()
+	if err != nil {
+		return nil, err
+	}
+	index := 0
+	err = forEachFeature(selectFeatures(withContext(ctx, reader), cfg), func(feature *geojson.Feature) error {
+		if index >= count {
+			return AppError{Message: "the input changed between the two passes"}
+		}
+		cell := cells[cellOf[index]]
+		index++
+		if cell.writer == nil {
+			output, err := create(cell.key + ".parquet")
+			if err != nil {
+				return err
+			}
+			cell.output = output
+			if cell.writer, err = newFeatureWriter(output, schema, cfg); err != nil {
+				return err
+			}
+		}
+		cell.count++
+		if cfg.progress != nil && index%progressInterval == 0 {
+			cfg.progress(index, count)
+		}
+		return cell.writer.WriteFeature(feature)
+	})
+	closeInput()
+	if err != nil {
+		return nil, AppError{Message: "failed to write parts", Value: err}
+	}
+	if cfg.progress != nil && index%progressInterval != 0 {
+		cfg.progress(index, count)
+	}
+
+	manifest := &PartitionManifest{
+		Features:    count,
+		MaxFeatures: maxFeatures,
+		BBox:        []float64{bound.Min[0], bound.Min[1], bound.Max[0], bound.Max[1]},
+		CRS:         cfg.crs,
+		Parts:       make([]PartitionPart, 0, len(cells)),
+	}
+	for _, cell := range cells {
+		if cell.writer == nil {
+			continue
+		}
+		if err := cell.writer.Close(); err != nil {
+			return nil, AppError{Message: fmt.Sprintf("failed to write part %s", cell.key), Value: err}
+		}
+		output := cell.output
+		cell.output = nil
+		if err := output.Close(); err != nil {
+			return nil, AppError{Message: fmt.Sprintf("failed to write part %s", cell.key), Value: err}
+		}
+
+		part := PartitionPart{Path: cell.key + ".parquet", Cell: cell.key, Features: cell.count}
+		if cell.key != partitionNoGeometry {
+			part.CellBBox = []float64{cell.bound.Min[0], cell.bound.Min[1], cell.bound.Max[0], cell.bound.Max[1]}
+		}
+		if metadata := cell.writer.Metadata(); metadata != nil {
+			part.BBox = metadata.Columns[metadata.PrimaryColumn].BBox
+		}
+		manifest.Parts = append(manifest.Parts, part)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, AppError{Message: "failed to encode manifest", Value: err}
+	}
+	output, err := create(PartitionManifestName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := output.Write(data); err != nil {
+		output.Abort()
+		return nil, AppError{Message: "failed to write manifest", Value: err}
+	}
+	if err := output.Close(); err != nil {
+		return nil, AppError{Message: "failed to write manifest", Value: err}
+	}
+	return manifest, nil
+}
+
+// forEachFeature calls fn with each feature of reader until it fails
+func forEachFeature(reader FeatureReader, fn func(*geojson.Feature) error) error {
+	for {
+		feature, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(feature); err != nil {
+			return err
+		}
+	}
+}
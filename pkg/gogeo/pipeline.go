@@ -0,0 +1,124 @@
+package gogeo
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/paulmach/orb/geojson"
+)
+
+// encodeBatchSize is the number of features handed to an encoding worker at a time.
+const encodeBatchSize = 256
+
+// encodeTask is a batch of features to encode, with the channel receiving the result
+type encodeTask struct {
+	features []*geojson.Feature
+	result   chan encodeResult
+}
+
+// encodeResult holds the encoded features of a batch, in input order
+type encodeResult struct {
+	encoded []encodedFeature
+	err     error
+}
+
+// writeParallel encodes the features of reader on jobs workers and writes them in
+// input order, calling written after each feature is written.
+func writeParallel(reader FeatureReader, writer *FeatureWriter, jobs int, written func()) error {
+	tasks := make(chan encodeTask)
+	// Tasks are queued in input order before being handed to the workers
+	queue := make(chan encodeTask, 2*jobs)
+	done := make(chan struct{})
+	readErr := make(chan error, 1)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer close(done)
+
+	for range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range tasks {
+				task.result <- encodeBatch(writer, task.features)
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(queue)
+		defer close(tasks)
+
+		for {
+			batch, err := readBatch(reader, encodeBatchSize)
+			if len(batch) > 0 {
+				task := encodeTask{features: batch, result: make(chan encodeResult, 1)}
+				select {
+				case queue <- task:
+				case <-done:
+					return
+				}
+				select {
+				case tasks <- task:
+				case <-done:
+					return
+				}
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					readErr <- err
+				}
+				return
+			}
+		}
+	}()
+
+	for task := range queue {
+		result := <-task.result
+		if result.err != nil {
+			return result.err
+		}
+		for _, encoded := range result.encoded {
+			if err := writer.write(encoded); err != nil {
+				return err
+			}
+			written()
+		}
+	}
+
+	select {
+	case err := <-readErr:
+		return err
+	default:
+		return nil
+	}
+}
+
+// encodeBatch encodes a batch of features
+func encodeBatch(writer *FeatureWriter, features []*geojson.Feature) encodeResult {
+	encoded := make([]encodedFeature, len(features))
+	for i, feature := range features {
+		var err error
+		if encoded[i], err = writer.encode(feature); err != nil {
+			return encodeResult{err: err}
+		}
+	}
+	return encodeResult{encoded: encoded}
+}
+
+// readBatch reads up to n features. The error of the last read, including io.EOF,
+// is returned along with the features read before it.
+func readBatch(reader FeatureReader, n int) ([]*geojson.Feature, error) {
+	batch := make([]*geojson.Feature, 0, n)
+	for len(batch) < n {
+		feature, err := reader.Next()
+		if err != nil {
+			return batch, err
+		}
+		batch = append(batch, feature)
+	}
+	return batch, nil
+}
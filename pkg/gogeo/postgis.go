@@ -0,0 +1,578 @@
+package gogeo
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/wkb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// Type OIDs of the built-in PostgreSQL types mapped to property types
+const (
+	pgTypeBool    = 16
+	pgTypeInt8    = 20
+	pgTypeInt2    = 21
+	pgTypeInt4    = 23
+	pgTypeOID     = 26
+	pgTypeFloat4  = 700
+	pgTypeFloat8  = 701
+	pgTypeNumeric = 1700
+)
+
+// PostGISReader streams the rows of a query on a PostGIS database as features. The
+// first geometry or geography column becomes the feature geometry and the other
+// columns become properties; further geometry columns are read as WKT strings.
+type PostGISReader struct {
+	conn     *pgConn
+	rows     *pgRows
+	geometry int
+	// geometryColumns marks the columns of PostGIS geometry and geography types.
+	geometryColumns []bool
+	schema          []PropertyInfo
+	crs             json.RawMessage
+	count           int
+}
+
+// NewPostGISReader connects to the database described by dsn, a postgres:// URL or
+// libpq key=value string, and runs query. Close must be called to release the connection.
+func NewPostGISReader(ctx context.Context, dsn, query string) (*PostGISReader, error) {
+	conn, err := connectPostgres(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	geometryTypes, err := pgGeometryTypes(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	rows, err := conn.query(query)
+	if err != nil {
+		conn.Close()
+		return nil, AppError{Message: "PostGIS query failed", Value: err}
+	}
+
+	r := &PostGISReader{conn: conn, rows: rows, geometry: -1, geometryColumns: make([]bool, len(rows.columns))}
+	for i, column := range rows.columns {
+		if geometryTypes[column.typeOID] {
+			r.geometryColumns[i] = true
+			if r.geometry < 0 {
+				r.geometry = i
+				continue
+			}
+		}
+		r.schema = append(r.schema, PropertyInfo{Name: column.name, Type: pgPropertyType(column.typeOID), Nullable: true})
+	}
+	if r.geometry < 0 {
+		conn.Close()
+		return nil, AppError{Message: "PostGIS query returns no geometry or geography column"}
+	}
+	return r, nil
+}
+
+// pgGeometryTypes returns the OIDs of the PostGIS geometry and geography types, which
+// depend on the database since PostGIS is an extension
+func pgGeometryTypes(conn *pgConn) (map[uint32]bool, error) {
+	rows, err := conn.query("SELECT oid FROM pg_type WHERE typname IN ('geometry', 'geography')")
+	if err != nil {
+		return nil, AppError{Message: "failed to look up the PostGIS types", Value: err}
+	}
+
+	types := make(map[uint32]bool)
+	for {
+		values, err := rows.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, AppError{Message: "failed to look up the PostGIS types", Value: err}
+		}
+		oid, err := strconv.ParseUint(string(values[0]), 10, 32)
+		if err != nil {
+			return nil, AppError{Message: "failed to look up the PostGIS types", Value: err}
+		}
+		types[uint32(oid)] = true
+	}
+	if len(types) == 0 {
+		return nil, AppError{Message: "PostGIS is not installed in the database"}
+	}
+	return types, nil
+}
+
+// pgPropertyType maps a PostgreSQL type to a property type. Numbers and booleans keep
+// their type; other values, including dates and JSON, are written as their text.
+func pgPropertyType(oid uint32) PropertyType {
+	switch oid {
+	case pgTypeBool:
+		return PropertyTypeBool
+	case pgTypeInt2, pgTypeInt4, pgTypeInt8, pgTypeOID:
+		return PropertyTypeInt
+	case pgTypeFloat4, pgTypeFloat8, pgTypeNumeric:
+		return PropertyTypeFloat
+	default:
+		return PropertyTypeString
+	}
+}
+
+// Schema returns the property columns of the query result, typed from the column types.
+func (r *PostGISReader) Schema() []PropertyInfo {
+	return r.schema
+}
+
+// CRS returns the PROJJSON definition of the SRID of the first geometry read, or nil
+// if no geometry with an SRID was read yet.
+func (r *PostGISReader) CRS() json.RawMessage {
+	return r.crs
+}
+
+// Next returns the feature of the next row, or io.EOF after the last one.
+func (r *PostGISReader) Next() (*geojson.Feature, error) {
+	values, err := r.rows.next()
+	if errors.Is(err, io.EOF) {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, AppError{Message: "PostGIS query failed", Value: err}
+	}
+	r.count++
+
+	feature := geojson.NewFeature(nil)
+	for i, column := range r.rows.columns {
+		value := values[i]
+		if r.geometryColumns[i] {
+			geometry, srid, err := decodeEWKBHex(value)
+			if err != nil {
+				return nil, fmt.Errorf("row %d, column %s: %w", r.count, column.name, err)
+			}
+			if i == r.geometry {
+				feature.Geometry = geometry
+				if r.crs == nil && srid > 0 {
+					if r.crs, err = sridCRS(srid); err != nil {
+						return nil, err
+					}
+				}
+			} else if geometry != nil {
+				if feature.Properties[column.name], err = encodeCSVGeometry(geometry, CSVGeometryWKT); err != nil {
+					return nil, fmt.Errorf("row %d, column %s: %w", r.count, column.name, err)
+				}
+			} else {
+				feature.Properties[column.name] = nil
+			}
+			continue
+		}
+
+		property, err := pgValue(value, column.typeOID)
+		if err != nil {
+			return nil, fmt.Errorf("row %d, column %s: %w", r.count, column.name, err)
+		}
+		feature.Properties[column.name] = property
+	}
+	return feature, nil
+}
+
+// Close releases the database connection.
+func (r *PostGISReader) Close() error {
+	return r.conn.Close()
+}
+
+// pgValue converts the text of a value to the Go type of its property type
+func pgValue(value []byte, oid uint32) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	text := string(value)
+	switch pgPropertyType(oid) {
+	case PropertyTypeBool:
+		return text == "t", nil
+	case PropertyTypeInt:
+		return strconv.ParseInt(text, 10, 64)
+	case PropertyTypeFloat:
+		return strconv.ParseFloat(text, 64)
+	default:
+		return text, nil
+	}
+}
+
+// decodeEWKBHex decodes the hex EWKB text of a PostGIS geometry and returns its SRID,
+// 0 if it has none
+func decodeEWKBHex(value []byte) (orb.Geometry, int, error) {
+	if value == nil {
+		return nil, 0, nil
+	}
+	data, err := hex.DecodeString(string(value))
+	if err != nil {
+		return nil, 0, errors.New("invalid EWKB geometry")
+	}
+	if len(data) < 5 {
+		return nil, 0, errWKBTruncated
+	}
+
+	srid := 0
+	if kind := byteOrder(data[0]).Uint32(data[1:5]); kind&ewkbSRID != 0 {
+		if len(data) < 9 {
+			return nil, 0, errWKBTruncated
+		}
+		srid = int(byteOrder(data[0]).Uint32(data[5:9]))
+	}
+
+	geometry, err := decodeGeometry(data, GeometryEncodingWKB)
+	return geometry, srid, err
+}
+
+// sridCRS returns the PROJJSON definition of an EPSG code used as SRID. Codes that
+// are not registered are identified by their code only.
+func sridCRS(srid int) (json.RawMessage, error) {
+	code := fmt.Sprintf("EPSG:%d", srid)
+	if definition, err := LookupCRS(code); err == nil {
+		return definition, nil
+	}
+	crsType := "ProjectedCRS"
+	if isGeographicEPSG(srid) {
+		crsType = "GeographicCRS"
+	}
+	return minimalPROJJSON(code, "EPSG", int64(srid), crsType)
+}
+
+// GenerateFromPostGIS runs query on the PostGIS database described by dsn and writes
+// the rows as GeoParquet to w. The property columns are typed from the column types of
+// the result, so rows are streamed in a single pass, and the SRID of the geometries
+// becomes the CRS unless one is set with WithCRS or WithCRSCode.
+func GenerateFromPostGIS(ctx context.Context, dsn, query string, w io.Writer, opts ...Option) (*Report, error) {
+	cfg := newConfig(opts)
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	reader, err := NewPostGISReader(ctx, dsn, query)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	schema := cfg.schema
+	if schema == nil {
+		schema = cfg.selectSchema(reader.Schema())
+	}
+	return generate(withContext(ctx, &inputCRS{reader, cfg}), w, schema, cfg, 0)
+}
+
+// PostGISTableQuery returns the query selecting all rows of a table, given as table
+// or schema.table.
+func PostGISTableQuery(table string) string {
+	return "SELECT * FROM " + quoteIdentifier(strings.TrimSpace(table))
+}
+
+// pgImportColumn is a column of a table created by ImportPostGIS
+type pgImportColumn struct {
+	name string
+	// sqlType is the PostgreSQL type of the column.
+	sqlType string
+	// srid is the SRID of a geometry column, -1 for other columns.
+	srid int
+	// required is whether the column is NOT NULL.
+	required bool
+}
+
+// ImportPostGIS creates table, given as table or schema.table, in the PostGIS database
+// described by dsn and copies the rows of the GeoParquet data of the given size read from
+// r into it, one row group at a time. Geometry columns become geometry columns with the
+// SRID of their CRS and are copied as EWKB; other columns get the PostgreSQL type of
+// their Parquet type. The table is created and filled in a single transaction, then
+// indexed with GiST on the primary geometry column. It returns the number of rows copied.
+func ImportPostGIS(ctx context.Context, dsn, table string, r io.ReaderAt, size int64) (int, error) {
+	pf, err := parquet.OpenFile(r, size)
+	if err != nil {
+		return 0, AppError{Message: "failed to read GeoParquet file", Value: err}
+	}
+	geoMeta, err := readGeoMetadata(pf)
+	if err != nil {
+		return 0, err
+	}
+	columns, err := pgImportColumns(pf, geoMeta)
+	if err != nil {
+		return 0, err
+	}
+
+	conn, err := connectPostgres(ctx, dsn)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	table = quoteIdentifier(strings.TrimSpace(table))
+	definitions := make([]string, len(columns))
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = quoteIdentifier(column.name)
+		definitions[i] = names[i] + " " + column.sqlType
+		if column.required {
+			definitions[i] += " NOT NULL"
+		}
+	}
+
+	if err := conn.exec("BEGIN"); err != nil {
+		return 0, AppError{Message: "PostGIS import failed", Value: err}
+	}
+	count := 0
+	err = conn.exec(fmt.Sprintf("CREATE TABLE %s (%s)", table, strings.Join(definitions, ", ")))
+	if err == nil {
+		copySQL := fmt.Sprintf("COPY %s (%s) FROM STDIN", table, strings.Join(names, ", "))
+		err = conn.copyIn(copySQL, func(w io.Writer) error {
+			var copyErr error
+			count, copyErr = copyGeoParquetRows(ctx, w, pf, geoMeta, columns)
+			return copyErr
+		})
+	}
+	if err == nil {
+		err = conn.exec(fmt.Sprintf("CREATE INDEX ON %s USING GIST (%s)", table, quoteIdentifier(geoMeta.PrimaryColumn)))
+	}
+	if err == nil {
+		err = conn.exec("COMMIT")
+	}
+	if err != nil {
+		_ = conn.exec("ROLLBACK")
+		return 0, AppError{Message: "PostGIS import failed", Value: err}
+	}
+	return count, nil
+}
+
+// pgImportColumns returns the columns of the table receiving a GeoParquet file, in the
+// order of the Parquet schema. Covering columns are derived from the geometry and skipped,
+// struct and list columns are imported as jsonb, and required columns are NOT NULL.
+func pgImportColumns(pf *parquet.File, geoMeta *GeoParquet) ([]pgImportColumn, error) {
+	skip := coveringColumns(geoMeta)
+	var columns []pgImportColumn
+	for _, field := range pf.Schema().Fields() {
+		name := field.Name()
+		if skip[name] {
+			continue
+		}
+
+		if geometry, ok := geoMeta.Columns[name]; ok {
+			srid := crsSRID(geometry.CRS)
+			columns = append(columns, pgImportColumn{name: name, sqlType: pgGeometryType(geometry, srid), srid: srid})
+			continue
+		}
+
+		switch {
+		case field.Repeated() || isListOrMap(field) && field.Type().LogicalType().Map != nil:
+			return nil, AppError{Message: fmt.Sprintf("column %q is a repeated column or a map, which cannot be imported", name)}
+		case field.Leaf():
+			columns = append(columns, pgImportColumn{name: name, sqlType: pgColumnType(field.Type()), srid: -1, required: field.Required()})
+		default:
+			columns = append(columns, pgImportColumn{name: name, sqlType: "jsonb", srid: -1, required: field.Required()})
+		}
+	}
+	return columns, nil
+}
+
+// pgColumnType returns the PostgreSQL type storing values of a Parquet type
+func pgColumnType(t parquet.Type) string {
+	if logical := t.LogicalType(); logical != nil {
+		switch {
+		case logical.Timestamp != nil:
+			return "timestamptz"
+		case logical.Date != nil:
+			return "date"
+		case logical.UUID != nil:
+			return "uuid"
+		case logical.Json != nil:
+			return "jsonb"
+		case logical.Integer != nil && logical.Integer.IsSigned && logical.Integer.BitWidth <= 16:
+			return "smallint"
+		case logical.Integer != nil && !logical.Integer.IsSigned && logical.Integer.BitWidth == 64:
+			// PostgreSQL has no unsigned integers
+			return "numeric(20)"
+		}
+	}
+	switch t.Kind() {
+	case parquet.Boolean:
+		return "boolean"
+	case parquet.Int32:
+		return "integer"
+	case parquet.Int64:
+		return "bigint"
+	case parquet.Float:
+		return "real"
+	case parquet.Double:
+		return "double precision"
+	default:
+		return "text"
+	}
+}
+
+// pgGeometryType returns the PostGIS type of a geometry column. The type modifier
+// declares the SRID and whether geometries have Z ordinates, unless they are mixed.
+func pgGeometryType(column GeoParquetColumn, srid int) string {
+	withZ := 0
+	for _, geometryType := range column.GeometryTypes {
+		if strings.HasSuffix(geometryType, " Z") {
+			withZ++
+		}
+	}
+
+	switch {
+	case withZ > 0 && withZ < len(column.GeometryTypes):
+		return "geometry"
+	case withZ > 0:
+		return fmt.Sprintf("geometry(GeometryZ, %d)", max(srid, 0))
+	default:
+		return fmt.Sprintf("geometry(Geometry, %d)", max(srid, 0))
+	}
+}
+
+// crsSRID returns the EPSG code of a PROJJSON CRS to use as SRID: 4326 for the default
+// OGC:CRS84, and 0 for a CRS without an EPSG or OGC identifier
+func crsSRID(crs json.RawMessage) int {
+	if len(crs) == 0 || string(crs) == "null" {
+		return 4326
+	}
+	var definition struct {
+		ID struct {
+			Authority string `json:"authority"`
+			Code      any    `json:"code"`
+		} `json:"id"`
+	}
+	if err := json.Unmarshal(crs, &definition); err != nil {
+		return 0
+	}
+
+	code := fmt.Sprint(definition.ID.Code)
+	switch strings.ToUpper(definition.ID.Authority) {
+	case "EPSG":
+		srid, _ := strconv.Atoi(code)
+		return srid
+	case "OGC":
+		if code == "CRS84" {
+			return 4326
+		}
+	}
+	return 0
+}
+
+// copyGeoParquetRows writes the rows of a GeoParquet file in the COPY text format
+func copyGeoParquetRows(ctx context.Context, w io.Writer, pf *parquet.File, geoMeta *GeoParquet, columns []pgImportColumn) (int, error) {
+	buffered := bufio.NewWriter(w)
+	decoder := newRowDecoder(pf, geoMeta)
+
+	count := 0
+	for _, rowGroup := range pf.RowGroups() {
+		fc := geojson.NewFeatureCollection()
+		if err := readRowGroup(ctx, rowGroup, decoder, fc); err != nil {
+			return count, err
+		}
+
+		for _, feature := range fc.Features {
+			count++
+			for i, column := range columns {
+				if i > 0 {
+					buffered.WriteByte('\t')
+				}
+				field, err := pgCopyField(feature, column, geoMeta.PrimaryColumn, decoder.idColumn)
+				if err != nil {
+					return count, fmt.Errorf("row %d, column %s: %w", count, column.name, err)
+				}
+				buffered.WriteString(field)
+			}
+			buffered.WriteByte('\n')
+		}
+	}
+	return count, buffered.Flush()
+}
+
+// pgCopyField renders the value of a column of a feature as a COPY text field
+func pgCopyField(feature *geojson.Feature, column pgImportColumn, primary, idColumn string) (string, error) {
+	var value any
+	switch column.name {
+	case primary:
+		value = feature.Geometry
+	case idColumn:
+		value = feature.ID
+	default:
+		value = feature.Properties[column.name]
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return `\N`, nil
+	case orb.Geometry:
+		return encodeEWKBHex(v, column.srid)
+	case *geojson.Geometry:
+		if v == nil {
+			return `\N`, nil
+		}
+		return encodeEWKBHex(v.Geometry(), column.srid)
+	case bool:
+		if v {
+			return "t", nil
+		}
+		return "f", nil
+	case float64:
+		switch {
+		case math.IsInf(v, 1):
+			return "Infinity", nil
+		case math.IsInf(v, -1):
+			return "-Infinity", nil
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case string:
+		return pgCopyEscaper.Replace(v), nil
+	case map[string]any, []any:
+		// Values of JSON columns
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return pgCopyEscaper.Replace(string(data)), nil
+	}
+	return "", fmt.Errorf("unsupported value %T", value)
+}
+
+// pgCopyEscaper escapes the characters with a meaning in the COPY text format
+var pgCopyEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// encodeEWKBHex encodes a geometry as hex EWKB with an SRID, as PostGIS parses it
+func encodeEWKBHex(geometry orb.Geometry, srid int) (string, error) {
+	var data []byte
+	var err error
+	if hasZ(geometry) {
+		data, err = marshalWKBZ(geometry)
+	} else {
+		data, err = wkb.Marshal(geometry)
+	}
+	if err != nil {
+		return "", err
+	}
+	if srid <= 0 {
+		return hex.EncodeToString(data), nil
+	}
+
+	// The SRID follows the type of the outermost geometry, flagged in the type
+	order := byteOrder(data[0])
+	kind := order.Uint32(data[1:5])
+	if (kind&0xffff)/1000 == 1 {
+		kind = kind%1000 | ewkbZ
+	}
+	ewkb := make([]byte, len(data)+4)
+	ewkb[0] = data[0]
+	order.PutUint32(ewkb[1:5], kind|ewkbSRID)
+	order.PutUint32(ewkb[5:9], uint32(srid))
+	copy(ewkb[9:], data[5:])
+	return hex.EncodeToString(ewkb), nil
+}
@@ -0,0 +1,693 @@
+package gogeo
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/md5" //nolint:gosec // required by the PostgreSQL md5 authentication method
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// pgDialTimeout bounds connecting to the database server
+const pgDialTimeout = 30 * time.Second
+
+// pgCopyChunkSize is the size of the CopyData messages sent during a COPY
+const pgCopyChunkSize = 64 << 10
+
+// pgConfig holds the connection parameters of a DSN
+type pgConfig struct {
+	host     string
+	port     string
+	user     string
+	password string
+	database string
+	sslmode  string
+}
+
+// parsePostgresDSN parses a connection string, either a postgres:// URL or libpq
+// key=value pairs. Missing parameters default to the PGHOST, PGPORT, PGUSER,
+// PGPASSWORD, PGDATABASE and PGSSLMODE environment variables.
+func parsePostgresDSN(dsn string) (pgConfig, error) {
+	cfg := pgConfig{
+		host:     os.Getenv("PGHOST"),
+		port:     os.Getenv("PGPORT"),
+		user:     os.Getenv("PGUSER"),
+		password: os.Getenv("PGPASSWORD"),
+		database: os.Getenv("PGDATABASE"),
+		sslmode:  os.Getenv("PGSSLMODE"),
+	}
+
+	params := make(map[string]string)
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return cfg, AppError{Message: "invalid PostgreSQL connection URL", Value: err}
+		}
+		if u.Hostname() != "" {
+			params["host"] = u.Hostname()
+		}
+		if u.Port() != "" {
+			params["port"] = u.Port()
+		}
+		if u.User != nil {
+			params["user"] = u.User.Username()
+			if password, ok := u.User.Password(); ok {
+				params["password"] = password
+			}
+		}
+		if database := strings.TrimPrefix(u.Path, "/"); database != "" {
+			params["dbname"] = database
+		}
+		for key, values := range u.Query() {
+			params[key] = values[0]
+		}
+	} else {
+		for _, pair := range strings.Fields(dsn) {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				return cfg, AppError{Message: fmt.Sprintf("invalid PostgreSQL connection parameter %q, expected key=value", pair)}
+			}
+			params[key] = strings.Trim(value, "'")
+		}
+	}
+
+	for key, value := range params {
+		switch key {
+		case "host":
+			cfg.host = value
+		case "port":
+			cfg.port = value
+		case "user":
+			cfg.user = value
+		case "password":
+			cfg.password = value
+		case "dbname":
+			cfg.database = value
+		case "sslmode":
+			cfg.sslmode = value
+		}
+	}
+
+	if cfg.host == "" {
+		cfg.host = "localhost"
+	}
+	if cfg.port == "" {
+		cfg.port = "5432"
+	}
+	if cfg.user == "" {
+		cfg.user = os.Getenv("USER")
+	}
+	if cfg.database == "" {
+		cfg.database = cfg.user
+	}
+	if cfg.sslmode == "" {
+		cfg.sslmode = "prefer"
+	}
+	switch cfg.sslmode {
+	case "disable", "prefer", "require", "verify-full":
+	default:
+		return cfg, AppError{Message: fmt.Sprintf("unsupported sslmode %q, expected disable, prefer, require or verify-full", cfg.sslmode)}
+	}
+	return cfg, nil
+}
+
+// pgConn is a connection to a PostgreSQL server speaking the simple query protocol
+// with text results
+type pgConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	// stop releases the cancellation of the context the connection was opened with.
+	stop func() bool
+}
+
+// pgColumn describes a column of a query result
+type pgColumn struct {
+	name    string
+	typeOID uint32
+}
+
+// pgError is an ErrorResponse of the server
+type pgError struct {
+	severity string
+	code     string
+	message  string
+	detail   string
+}
+
+func (e *pgError) Error() string {
+	message := fmt.Sprintf("%s: %s (SQLSTATE %s)", e.severity, e.message, e.code)
+	if e.detail != "" {
+		message += ": " + e.detail
+	}
+	return message
+}
+
+// connectPostgres opens and authenticates a connection. Cancelling ctx interrupts the
+// connection, failing any pending operation.
+func connectPostgres(ctx context.Context, dsn string) (*pgConn, error) {
+	cfg, err := parsePostgresDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: pgDialTimeout}
+	var conn net.Conn
+	if strings.HasPrefix(cfg.host, "/") {
+		conn, err = dialer.DialContext(ctx, "unix", fmt.Sprintf("%s/.s.PGSQL.%s", cfg.host, cfg.port))
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(cfg.host, cfg.port))
+	}
+	if err != nil {
+		return nil, AppError{Message: "failed to connect to PostgreSQL", Value: err}
+	}
+
+	plain := conn
+	if conn, err = pgStartTLS(plain, cfg); err != nil {
+		plain.Close()
+		return nil, AppError{Message: "failed to connect to PostgreSQL", Value: err}
+	}
+
+	c := &pgConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	c.stop = context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+	})
+	if err := c.startup(cfg); err != nil {
+		c.conn.Close()
+		c.stop()
+		return nil, AppError{Message: "failed to connect to PostgreSQL", Value: err}
+	}
+	return c, nil
+}
+
+// pgStartTLS negotiates TLS as requested by sslmode. Like libpq, prefer and require
+// encrypt the connection without verifying the server certificate.
+func pgStartTLS(conn net.Conn, cfg pgConfig) (net.Conn, error) {
+	if cfg.sslmode == "disable" || strings.HasPrefix(cfg.host, "/") {
+		return conn, nil
+	}
+
+	// SSLRequest: length 8 and the request code 80877103
+	request := []byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f}
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+	var response [1]byte
+	if _, err := io.ReadFull(conn, response[:]); err != nil {
+		return nil, err
+	}
+	if response[0] != 'S' {
+		if cfg.sslmode != "prefer" {
+			return nil, errors.New("server does not support SSL")
+		}
+		return conn, nil
+	}
+
+	config := &tls.Config{ServerName: cfg.host, MinVersion: tls.VersionTLS12}
+	if cfg.sslmode != "verify-full" {
+		config.InsecureSkipVerify = true //nolint:gosec // sslmode prefer and require do not verify the server
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// startup sends the startup message and authenticates
+func (c *pgConn) startup(cfg pgConfig) error {
+	var body []byte
+	body = binary.BigEndian.AppendUint32(body, 196608) // protocol 3.0
+	for _, param := range [][2]string{
+		{"user", cfg.user},
+		{"database", cfg.database},
+		{"client_encoding", "UTF8"},
+		{"application_name", "gogeo"},
+	} {
+		body = append(append(append(body, param[0]...), 0), append([]byte(param[1]), 0)...)
+	}
+	body = append(body, 0)
+
+	c.w.Write(binary.BigEndian.AppendUint32(nil, uint32(len(body)+4)))
+	c.w.Write(body)
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+
+	var scram *pgSCRAM
+	for {
+		kind, msg, err := c.receive()
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case 'R':
+			if len(msg) < 4 {
+				return errors.New("invalid authentication request")
+			}
+			switch method := binary.BigEndian.Uint32(msg); method {
+			case 0: // AuthenticationOk
+			case 3: // AuthenticationCleartextPassword
+				c.send('p', append([]byte(cfg.password), 0))
+			case 5: // AuthenticationMD5Password
+				if len(msg) < 8 {
+					return errors.New("invalid authentication request")
+				}
+				c.send('p', append([]byte(pgMD5Password(cfg.user, cfg.password, msg[4:8])), 0))
+			case 10: // AuthenticationSASL
+				if !strings.Contains(string(msg[4:]), "SCRAM-SHA-256\x00") {
+					return errors.New("server requires an unsupported SASL mechanism")
+				}
+				scram = newPGSCRAM(cfg.password)
+				first := scram.clientFirst()
+				body := append([]byte("SCRAM-SHA-256\x00"), binary.BigEndian.AppendUint32(nil, uint32(len(first)))...)
+				c.send('p', append(body, first...))
+			case 11: // AuthenticationSASLContinue
+				if scram == nil {
+					return errors.New("unexpected SASL message")
+				}
+				final, err := scram.clientFinal(msg[4:])
+				if err != nil {
+					return err
+				}
+				c.send('p', final)
+			case 12: // AuthenticationSASLFinal
+				if scram == nil {
+					return errors.New("unexpected SASL message")
+				}
+				if err := scram.verify(msg[4:]); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("unsupported authentication method %d", method)
+			}
+			if err := c.w.Flush(); err != nil {
+				return err
+			}
+		case 'E':
+			return parsePGError(msg)
+		case 'Z':
+			return nil
+		}
+	}
+}
+
+// pgMD5Password computes the response of the md5 authentication method
+func pgMD5Password(user, password string, salt []byte) string {
+	inner := md5.Sum([]byte(password + user))                               //nolint:gosec
+	outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), salt...)) //nolint:gosec
+	return "md5" + hex.EncodeToString(outer[:])
+}
+
+// pgSCRAM runs a SCRAM-SHA-256 exchange (RFC 5802) without channel binding
+type pgSCRAM struct {
+	password    string
+	nonce       string
+	clientBare  string
+	authMessage string
+	salted      []byte
+}
+
+func newPGSCRAM(password string) *pgSCRAM {
+	nonce := make([]byte, 18)
+	_, _ = rand.Read(nonce)
+	return &pgSCRAM{password: password, nonce: base64.StdEncoding.EncodeToString(nonce)}
+}
+
+// clientFirst returns the client-first-message; the user name is taken from the startup message
+func (s *pgSCRAM) clientFirst() []byte {
+	s.clientBare = "n=,r=" + s.nonce
+	return []byte("n,," + s.clientBare)
+}
+
+// clientFinal answers the server-first-message with the client proof
+func (s *pgSCRAM) clientFinal(serverFirst []byte) ([]byte, error) {
+	var nonce, salt string
+	iterations := 0
+	for _, attr := range strings.Split(string(serverFirst), ",") {
+		key, value, _ := strings.Cut(attr, "=")
+		switch key {
+		case "r":
+			nonce = value
+		case "s":
+			salt = value
+		case "i":
+			fmt.Sscanf(value, "%d", &iterations)
+		}
+	}
+	if !strings.HasPrefix(nonce, s.nonce) || iterations <= 0 {
+		return nil, errors.New("invalid SCRAM server message")
+	}
+	saltBytes, err := base64.StdEncoding.DecodeString(salt)
+	if err != nil {
+		return nil, errors.New("invalid SCRAM salt")
+	}
+
+	s.salted, err = pbkdf2.Key(sha256.New, s.password, saltBytes, iterations, sha256.Size)
+	if err != nil {
+		return nil, err
+	}
+	clientKey := scramHMAC(s.salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+
+	withoutProof := "c=biws,r=" + nonce
+	s.authMessage = s.clientBare + "," + string(serverFirst) + "," + withoutProof
+	signature := scramHMAC(storedKey[:], s.authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ signature[i]
+	}
+	return []byte(withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+}
+
+// verify checks the server signature of the server-final-message
+func (s *pgSCRAM) verify(serverFinal []byte) error {
+	serverKey := scramHMAC(s.salted, "Server Key")
+	expected := "v=" + base64.StdEncoding.EncodeToString(scramHMAC(serverKey, s.authMessage))
+	if !hmac.Equal([]byte(strings.TrimSpace(string(serverFinal))), []byte(expected)) {
+		return errors.New("invalid SCRAM server signature")
+	}
+	return nil
+}
+
+func scramHMAC(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// send buffers a message; the buffer is written by the next flush
+func (c *pgConn) send(kind byte, body []byte) {
+	c.w.WriteByte(kind)
+	c.w.Write(binary.BigEndian.AppendUint32(nil, uint32(len(body)+4)))
+	c.w.Write(body)
+}
+
+// receive reads the next message, skipping notices and parameter updates
+func (c *pgConn) receive() (byte, []byte, error) {
+	for {
+		var header [5]byte
+		if _, err := io.ReadFull(c.r, header[:]); err != nil {
+			return 0, nil, err
+		}
+		length := binary.BigEndian.Uint32(header[1:])
+		if length < 4 {
+			return 0, nil, errors.New("invalid PostgreSQL message")
+		}
+		msg := make([]byte, length-4)
+		if _, err := io.ReadFull(c.r, msg); err != nil {
+			return 0, nil, err
+		}
+		switch header[0] {
+		case 'N', 'S', 'K', 'A':
+			continue
+		}
+		return header[0], msg, nil
+	}
+}
+
+// parsePGError decodes the fields of an ErrorResponse
+func parsePGError(msg []byte) error {
+	e := &pgError{}
+	for len(msg) > 1 {
+		field := msg[0]
+		end := strings.IndexByte(string(msg[1:]), 0)
+		if end < 0 {
+			break
+		}
+		value := string(msg[1 : end+1])
+		msg = msg[end+2:]
+		switch field {
+		case 'S':
+			e.severity = value
+		case 'C':
+			e.code = value
+		case 'M':
+			e.message = value
+		case 'D':
+			e.detail = value
+		}
+	}
+	return e
+}
+
+// Close terminates the session and closes the connection.
+func (c *pgConn) Close() error {
+	c.stop()
+	c.send('X', nil)
+	_ = c.w.Flush()
+	return c.conn.Close()
+}
+
+// exec runs statements that return no rows
+func (c *pgConn) exec(sql string) error {
+	rows, err := c.query(sql)
+	if err != nil {
+		return err
+	}
+	for {
+		if _, err := rows.next(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// pgRows streams the rows of a query
+type pgRows struct {
+	c       *pgConn
+	columns []pgColumn
+	err     error
+	done    bool
+}
+
+// query sends a query and reads up to its row description
+func (c *pgConn) query(sql string) (*pgRows, error) {
+	c.send('Q', append([]byte(sql), 0))
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	rows := &pgRows{c: c}
+	for {
+		kind, msg, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case 'T':
+			columns, err := parsePGRowDescription(msg)
+			if err != nil {
+				return nil, err
+			}
+			rows.columns = columns
+			return rows, nil
+		case 'C', 'I':
+			// A statement without rows; the result ends with ReadyForQuery
+			return rows, nil
+		case 'E':
+			rows.err = parsePGError(msg)
+			if err := rows.finish(); err != nil {
+				return nil, err
+			}
+			return nil, rows.err
+		case 'Z':
+			rows.done = true
+			return rows, nil
+		}
+	}
+}
+
+// parsePGRowDescription decodes the columns of a RowDescription
+func parsePGRowDescription(msg []byte) ([]pgColumn, error) {
+	if len(msg) < 2 {
+		return nil, errors.New("invalid row description")
+	}
+	n := int(binary.BigEndian.Uint16(msg))
+	msg = msg[2:]
+	columns := make([]pgColumn, n)
+	for i := range columns {
+		end := strings.IndexByte(string(msg), 0)
+		if end < 0 || len(msg) < end+19 {
+			return nil, errors.New("invalid row description")
+		}
+		columns[i].name = string(msg[:end])
+		// Table OID (4), attribute number (2), then the type OID
+		columns[i].typeOID = binary.BigEndian.Uint32(msg[end+7:])
+		msg = msg[end+19:]
+	}
+	return columns, nil
+}
+
+// next returns the text values of the next row, nil for NULL, or io.EOF after the last row
+func (r *pgRows) next() ([][]byte, error) {
+	for !r.done {
+		kind, msg, err := r.c.receive()
+		if err != nil {
+			r.done = true
+			return nil, err
+		}
+		switch kind {
+		case 'D':
+			return parsePGDataRow(msg)
+		case 'E':
+			r.err = parsePGError(msg)
+		case 'Z':
+			r.done = true
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return nil, io.EOF
+}
+
+// finish discards the remaining messages up to ReadyForQuery
+func (r *pgRows) finish() error {
+	for !r.done {
+		kind, _, err := r.c.receive()
+		if err != nil {
+			return err
+		}
+		r.done = kind == 'Z'
+	}
+	return nil
+}
+
+// parsePGDataRow decodes the values of a DataRow
+func parsePGDataRow(msg []byte) ([][]byte, error) {
+	if len(msg) < 2 {
+		return nil, errors.New("invalid data row")
+	}
+	n := int(binary.BigEndian.Uint16(msg))
+	msg = msg[2:]
+	values := make([][]byte, n)
+	for i := range values {
+		if len(msg) < 4 {
+			return nil, errors.New("invalid data row")
+		}
+		length := int32(binary.BigEndian.Uint32(msg))
+		msg = msg[4:]
+		if length < 0 {
+			continue
+		}
+		if int(length) > len(msg) {
+			return nil, errors.New("invalid data row")
+		}
+		values[i] = msg[:length]
+		msg = msg[length:]
+	}
+	return values, nil
+}
+
+// copyIn runs a COPY ... FROM STDIN statement, streaming the data written by rows.
+// If rows fails, the COPY is aborted and its error returned.
+func (c *pgConn) copyIn(sql string, rows func(w io.Writer) error) error {
+	c.send('Q', append([]byte(sql), 0))
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+
+	result := &pgRows{c: c}
+	for ready := false; !ready; {
+		kind, msg, err := c.receive()
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case 'G':
+			ready = true
+		case 'E':
+			result.err = parsePGError(msg)
+			if err := result.finish(); err != nil {
+				return err
+			}
+			return result.err
+		case 'Z':
+			return errors.New("statement is not a COPY FROM STDIN")
+		}
+	}
+
+	w := &pgCopyWriter{c: c}
+	err := rows(w)
+	if err == nil {
+		err = w.flush()
+	}
+	if err != nil {
+		c.send('f', append([]byte(err.Error()), 0))
+	} else {
+		c.send('c', nil)
+	}
+	if flushErr := c.w.Flush(); flushErr != nil {
+		return flushErr
+	}
+
+	// The server reports the outcome, or its own error, before ReadyForQuery
+	for !result.done {
+		kind, msg, receiveErr := c.receive()
+		if receiveErr != nil {
+			return receiveErr
+		}
+		switch kind {
+		case 'E':
+			if result.err == nil {
+				result.err = parsePGError(msg)
+			}
+		case 'Z':
+			result.done = true
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return result.err
+}
+
+// pgCopyWriter sends the data of a COPY in CopyData messages
+type pgCopyWriter struct {
+	c   *pgConn
+	buf []byte
+}
+
+func (w *pgCopyWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= pgCopyChunkSize {
+		return len(p), w.flush()
+	}
+	return len(p), nil
+}
+
+// flush sends the buffered data
+func (w *pgCopyWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	w.c.send('d', w.buf)
+	w.buf = w.buf[:0]
+	return w.c.w.Flush()
+}
+
+// quoteIdentifier quotes a possibly schema-qualified name such as schema.table
+func quoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = `"` + strings.ReplaceAll(part, `"`, `""`) + `"`
+	}
+	return strings.Join(parts, ".")
+}
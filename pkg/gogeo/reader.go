@@ -0,0 +1,510 @@
+package gogeo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/paulmach/orb/geojson"
+)
+
+// readBatchSize is the number of rows read from a row group at a time.
+const readBatchSize = 128
+
+// ReadGeoParquet reads a GeoParquet file and reconstructs its features.
+// The primary geometry column is decoded from WKB and all other columns become feature properties.
+func ReadGeoParquet(path string) (*geojson.FeatureCollection, error) {
+	return ReadGeoParquetContext(context.Background(), path)
+}
+
+// ReadGeoParquetContext is like ReadGeoParquet but stops reading when ctx is cancelled.
+func ReadGeoParquetContext(ctx context.Context, path string) (*geojson.FeatureCollection, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, AppError{Message: "failed to open GeoParquet file", Value: err}
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, AppError{Message: "failed to stat GeoParquet file", Value: err}
+	}
+
+	return ReadGeoParquetFromContext(ctx, file, stat.Size())
+}
+
+// ReadGeoParquetFrom reads GeoParquet of the given size from r, such as an object
+// downloaded into a bytes.Reader, and reconstructs its features.
+func ReadGeoParquetFrom(r io.ReaderAt, size int64) (*geojson.FeatureCollection, error) {
+	return ReadGeoParquetFromContext(context.Background(), r, size)
+}
+
+// ReadGeoParquetFromContext is like ReadGeoParquetFrom but stops reading when ctx is cancelled.
+func ReadGeoParquetFromContext(ctx context.Context, r io.ReaderAt, size int64) (*geojson.FeatureCollection, error) {
+	pf, err := parquet.OpenFile(r, size)
+	if err != nil {
+		return nil, AppError{Message: "failed to read GeoParquet file", Value: err}
+	}
+
+	geoMeta, err := readGeoMetadata(pf)
+	if err != nil {
+		return nil, err
+	}
+
+	fc := geojson.NewFeatureCollection()
+	decoder := newRowDecoder(pf, geoMeta)
+
+	for _, rowGroup := range pf.RowGroups() {
+		if err := readRowGroup(ctx, rowGroup, decoder, fc); err != nil {
+			return nil, AppError{Message: "failed to read GeoParquet rows", Value: err}
+		}
+	}
+
+	return fc, nil
+}
+
+// Features returns an iterator over the features of a GeoParquet file. Rows are
+// decoded lazily, a batch at a time, so files larger than memory can be processed:
+//
+//	for feature, err := range gogeo.Features("cities.geoparquet") {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// An error ends the iteration. The file is opened when the iteration starts and closed
+// when it ends, including when the loop is left early.
+func Features(path string) iter.Seq2[*geojson.Feature, error] {
+	return func(yield func(*geojson.Feature, error) bool) {
+		file, err := os.Open(path)
+		if err != nil {
+			yield(nil, AppError{Message: "failed to open GeoParquet file", Value: err})
+			return
+		}
+		defer file.Close()
+
+		stat, err := file.Stat()
+		if err != nil {
+			yield(nil, AppError{Message: "failed to stat GeoParquet file", Value: err})
+			return
+		}
+
+		FeaturesFrom(file, stat.Size())(yield)
+	}
+}
+
+// FeaturesFrom is like Features for GeoParquet of the given size read from r.
+func FeaturesFrom(r io.ReaderAt, size int64) iter.Seq2[*geojson.Feature, error] {
+	return func(yield func(*geojson.Feature, error) bool) {
+		reader, err := newGeoParquetReader(r, size)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		readFeatures(reader, yield)
+	}
+}
+
+// SampleFrom returns an iterator over a random sample of the features of GeoParquet of
+// the given size read from r, keeping each row with probability fraction. The same
+// seed selects the same rows of the same file. Rows that are not selected are not
+// decoded.
+func SampleFrom(r io.ReaderAt, size int64, fraction float64, seed uint64) iter.Seq2[*geojson.Feature, error] {
+	return func(yield func(*geojson.Feature, error) bool) {
+		if fraction <= 0 || fraction > 1 {
+			yield(nil, AppError{Message: fmt.Sprintf("invalid sample fraction %v, expected a number in (0, 1]", fraction)})
+			return
+		}
+		reader, err := newGeoParquetReader(r, size)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		random := rand.New(rand.NewPCG(seed, seed))
+		reader.keep = func() bool { return random.Float64() < fraction }
+		readFeatures(reader, yield)
+	}
+}
+
+// readFeatures yields the features of reader until the end, an error or yield stops
+func readFeatures(reader *geoParquetReader, yield func(*geojson.Feature, error) bool) {
+	defer reader.Close()
+
+	for {
+		feature, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			yield(nil, AppError{Message: "failed to read GeoParquet rows", Value: err})
+			return
+		}
+		if !yield(feature, nil) {
+			return
+		}
+	}
+}
+
+// geoParquetReader is a FeatureReader decoding the rows of a GeoParquet file one
+// batch at a time
+type geoParquetReader struct {
+	rowGroups []parquet.RowGroup
+	rows      parquet.Rows
+	buffer    []parquet.Row
+	// pending holds the rows of the current batch not yet decoded.
+	pending []parquet.Row
+	decoder *rowDecoder
+	// keep selects the rows to decode when sampling, nil to decode all of them.
+	keep func() bool
+}
+
+func newGeoParquetReader(r io.ReaderAt, size int64) (*geoParquetReader, error) {
+	pf, err := parquet.OpenFile(r, size)
+	if err != nil {
+		return nil, AppError{Message: "failed to read GeoParquet file", Value: err}
+	}
+
+	geoMeta, err := readGeoMetadata(pf)
+	if err != nil {
+		return nil, err
+	}
+	return fileRows(pf, geoMeta), nil
+}
+
+// fileRows returns a reader over the rows of an open GeoParquet file
+func fileRows(pf *parquet.File, geoMeta *GeoParquet) *geoParquetReader {
+	return &geoParquetReader{
+		rowGroups: pf.RowGroups(),
+		buffer:    make([]parquet.Row, readBatchSize),
+		decoder:   newRowDecoder(pf, geoMeta),
+	}
+}
+
+func (r *geoParquetReader) Next() (*geojson.Feature, error) {
+	for {
+		for len(r.pending) == 0 {
+			if r.rows == nil {
+				if len(r.rowGroups) == 0 {
+					return nil, io.EOF
+				}
+				r.rows = r.rowGroups[0].Rows()
+				r.rowGroups = r.rowGroups[1:]
+			}
+
+			n, err := r.rows.ReadRows(r.buffer)
+			r.pending = r.buffer[:n]
+			if errors.Is(err, io.EOF) {
+				r.rows.Close()
+				r.rows = nil
+			} else if err != nil {
+				return nil, err
+			}
+		}
+
+		row := r.pending[0]
+		r.pending = r.pending[1:]
+		if r.keep == nil || r.keep() {
+			return r.decoder.decode(row)
+		}
+	}
+}
+
+// Close releases the rows of the row group being read
+func (r *geoParquetReader) Close() error {
+	if r.rows == nil {
+		return nil
+	}
+	err := r.rows.Close()
+	r.rows = nil
+	return err
+}
+
+// readGeoMetadata reads and validates the geo metadata of a Parquet file
+func readGeoMetadata(pf *parquet.File) (*GeoParquet, error) {
+	value, ok := pf.Lookup(GeoParquetMetadataKey)
+	if !ok {
+		return nil, AppError{Message: "file has no geo metadata, not a GeoParquet file"}
+	}
+
+	var geoMeta GeoParquet
+	if err := json.Unmarshal([]byte(value), &geoMeta); err != nil {
+		return nil, AppError{Message: "failed to parse geo metadata", Value: err}
+	}
+
+	if _, ok := geoMeta.Columns[geoMeta.PrimaryColumn]; !ok {
+		return nil, AppError{Message: fmt.Sprintf("primary column %q is not described in geo metadata", geoMeta.PrimaryColumn)}
+	}
+	for name, column := range geoMeta.Columns {
+		encoding, err := normalizeGeometryEncoding(column.Encoding)
+		if err != nil {
+			return nil, AppError{Message: fmt.Sprintf("geometry column %q", name), Value: err}
+		}
+		column.Encoding = encoding
+		geoMeta.Columns[name] = column
+	}
+
+	return &geoMeta, nil
+}
+
+// coveringColumns returns the top-level columns referenced by covering metadata.
+// They are derived from the geometry and are not decoded as properties.
+func coveringColumns(geoMeta *GeoParquet) map[string]bool {
+	skip := make(map[string]bool)
+	for _, column := range geoMeta.Columns {
+		if column.Covering == nil || column.Covering.BBox == nil {
+			continue
+		}
+		bbox := column.Covering.BBox
+		for _, path := range [][]string{bbox.Xmin, bbox.Ymin, bbox.Xmax, bbox.Ymax} {
+			if len(path) > 0 {
+				skip[path[0]] = true
+			}
+		}
+	}
+	return skip
+}
+
+// readRowGroup decodes all rows of a row group into features
+func readRowGroup(ctx context.Context, rowGroup parquet.RowGroup, decoder *rowDecoder, fc *geojson.FeatureCollection) error {
+	rows := rowGroup.Rows()
+	defer rows.Close()
+
+	buffer := make([]parquet.Row, readBatchSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := rows.ReadRows(buffer)
+		for _, row := range buffer[:n] {
+			feature, decodeErr := decoder.decode(row)
+			if decodeErr != nil {
+				return decodeErr
+			}
+			fc.Append(feature)
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// rowDecoder converts the rows of a GeoParquet file into GeoJSON features
+type rowDecoder struct {
+	// columns and types are the paths and types of the leaf columns, levels the
+	// definition levels at which each group of their path is not null, and lists the
+	// position in their path of the LIST group holding them, -1 for none.
+	columns [][]string
+	types   []parquet.Type
+	levels  [][]int
+	lists   []int
+	geoMeta *GeoParquet
+	// skip holds the covering columns, which are not properties.
+	skip map[string]bool
+	// idColumn is the column holding the feature ids, empty for none.
+	idColumn string
+}
+
+func newRowDecoder(pf *parquet.File, geoMeta *GeoParquet) *rowDecoder {
+	schema := pf.Schema()
+	columns := schema.Columns()
+	types := make([]parquet.Type, len(columns))
+	levels := make([][]int, len(columns))
+	lists := make([]int, len(columns))
+	for i, path := range columns {
+		leaf, _ := schema.Lookup(path...)
+		types[i] = leaf.Node.Type()
+		levels[i], lists[i] = groupLevels(schema, path)
+	}
+	return &rowDecoder{columns: columns, types: types, levels: levels, lists: lists, geoMeta: geoMeta, skip: coveringColumns(geoMeta), idColumn: readIDColumn(pf)}
+}
+
+// groupLevels returns the definition levels at which the groups of the path of a leaf
+// column are not null, and the position of the first LIST group of the path
+func groupLevels(schema *parquet.Schema, path []string) ([]int, int) {
+	levels := make([]int, len(path)-1)
+	list := -1
+	var node parquet.Node = schema
+	level := 0
+	for i, name := range path[:len(path)-1] {
+		for _, field := range node.Fields() {
+			if field.Name() == name {
+				node = field
+				break
+			}
+		}
+		if !node.Required() {
+			level++
+		}
+		levels[i] = level
+		if list < 0 && i+2 < len(path) && isListOrMap(node) && node.Type().LogicalType().List != nil {
+			list = i
+		}
+	}
+	return levels, list
+}
+
+// decode converts a Parquet row into a GeoJSON feature.
+// The primary geometry column becomes the feature geometry; other geometry columns
+// become properties holding GeoJSON geometries.
+func (d *rowDecoder) decode(row parquet.Row) (*geojson.Feature, error) {
+	feature := geojson.NewFeature(nil)
+	geoMeta := d.geoMeta
+	var elements map[int]int
+
+	for _, value := range row {
+		path := d.columns[value.Column()]
+		if d.skip[path[0]] {
+			continue
+		}
+		if len(path) > 1 {
+			d.decodeField(feature.Properties, value, &elements)
+			continue
+		}
+		if value.IsNull() {
+			continue
+		}
+
+		name := path[0]
+		if column, ok := geoMeta.Columns[name]; ok {
+			if len(value.ByteArray()) == 0 {
+				continue
+			}
+			geometry, err := decodeGeometry(value.ByteArray(), column.Encoding)
+			if err != nil {
+				return nil, err
+			}
+			if name == geoMeta.PrimaryColumn {
+				feature.Geometry = geometry
+			} else {
+				feature.Properties[name] = geojson.NewGeometry(geometry)
+			}
+			continue
+		}
+
+		if name == d.idColumn {
+			feature.ID = decodeValue(value, d.types[value.Column()])
+			continue
+		}
+		feature.Properties[name] = decodeValue(value, d.types[value.Column()])
+	}
+
+	return feature, nil
+}
+
+// decodeField sets the field of an object property held by a value of a column nested
+// in groups, creating the objects of the groups that are not null. The values of a
+// column within a list are its elements, or the fields of its elements, in order;
+// elements counts those of each column decoded so far. Lists nested in the elements of
+// a list are not supported.
+func (d *rowDecoder) decodeField(properties map[string]any, value parquet.Value, elements *map[int]int) {
+	column := value.Column()
+	path := d.columns[column]
+	levels := d.levels[column]
+	last := len(path) - 1
+	object := properties
+	for i := 0; i < last; i++ {
+		name := path[i]
+		if value.DefinitionLevel() < levels[i] {
+			return
+		}
+		if i != d.lists[column] {
+			child, ok := object[name].(map[string]any)
+			if !ok {
+				child = make(map[string]any)
+				object[name] = child
+			}
+			object = child
+			continue
+		}
+
+		// path[i+1] is the repeated group of the list and path[i+2] the element
+		list, _ := object[name].([]any)
+		if value.DefinitionLevel() < levels[i+1] {
+			if list == nil {
+				object[name] = []any{}
+			}
+			return
+		}
+		if *elements == nil {
+			*elements = make(map[int]int)
+		}
+		index := (*elements)[column]
+		(*elements)[column]++
+		for len(list) <= index {
+			list = append(list, nil)
+		}
+		object[name] = list
+		if i+2 == last {
+			if !value.IsNull() {
+				list[index] = decodeValue(value, d.types[column])
+			}
+			return
+		}
+		if value.DefinitionLevel() < levels[i+2] {
+			return
+		}
+		child, ok := list[index].(map[string]any)
+		if !ok {
+			child = make(map[string]any)
+			list[index] = child
+		}
+		object = child
+		i += 2
+	}
+	if !value.IsNull() {
+		object[path[last]] = decodeValue(value, d.types[column])
+	}
+}
+
+// decodeValue converts a Parquet value of a column of type t into a GeoJSON property
+// value. Timestamps, dates and UUIDs become their usual text, and JSON is decoded.
+func decodeValue(value parquet.Value, t parquet.Type) any {
+	if logical := t.LogicalType(); logical != nil {
+		switch {
+		case logical.Timestamp != nil:
+			return timestampTime(value.Int64(), logical.Timestamp.Unit).Format(time.RFC3339Nano)
+		case logical.Date != nil:
+			return formatDate(value.Int32())
+		case logical.UUID != nil:
+			return formatUUID(value.ByteArray())
+		case logical.Json != nil:
+			if decoded, err := decodeJSON(value.ByteArray()); err == nil {
+				return decoded
+			}
+		case logical.Integer != nil && !logical.Integer.IsSigned:
+			if value.Kind() == parquet.Int64 {
+				return value.Uint64()
+			}
+			return int64(value.Uint32())
+		}
+	}
+
+	switch value.Kind() {
+	case parquet.Boolean:
+		return value.Boolean()
+	case parquet.Int32:
+		return int64(value.Int32())
+	case parquet.Int64:
+		return value.Int64()
+	case parquet.Float:
+		return float64(value.Float())
+	case parquet.Double:
+		return value.Double()
+	default:
+		return string(value.ByteArray())
+	}
+}
@@ -0,0 +1,488 @@
+package gogeo
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// bboxPropertyColumns are the names of the per-feature bbox property columns
+var bboxPropertyColumns = [4]string{"bbox_xmin", "bbox_ymin", "bbox_xmax", "bbox_ymax"}
+
+// bboxFields are the names of the fields of the bbox covering column
+var bboxFields = [4]string{"xmin", "ymin", "xmax", "ymax"}
+
+// recordSchema returns the Parquet schema of the rows of features.
+// The first columns hold the encoded geometries, one per geometry column, followed by
+// the optional bbox columns, the area and length columns, the grid cell columns and one
+// column per property.
+// Properties are always the last columns.
+func recordSchema(propertyInfos []PropertyInfo, cfg *config) *parquet.Schema {
+	geometryColumns := cfg.geometryColumns()
+	fields := make([]parquet.Field, 0, len(propertyInfos)+len(geometryColumns)+1)
+	for i, column := range geometryColumns {
+		node := geometryNode(column.Encoding)
+		if i > 0 || !cfg.requiredGeometry {
+			node = parquet.Optional(node)
+		}
+		fields = append(fields, namedField(column.Name, node))
+	}
+
+	if cfg.bboxColumn {
+		bbox := make([]parquet.Field, len(bboxFields))
+		for i, name := range bboxFields {
+			bbox[i] = namedField(name, parquet.Leaf(parquet.DoubleType))
+		}
+		fields = append(fields, namedField(DefaultBBoxColumn, parquet.Optional(groupNode{fields: bbox})))
+	}
+
+	if cfg.bboxProperties {
+		for _, name := range bboxPropertyColumns {
+			fields = append(fields, namedField(name, parquet.Optional(parquet.Leaf(parquet.DoubleType))))
+		}
+	}
+
+	for _, column := range cfg.measures {
+		fields = append(fields, namedField(column.name, parquet.Optional(parquet.Leaf(parquet.DoubleType))))
+	}
+
+	for _, column := range cfg.cells {
+		fields = append(fields, namedField(column.name, parquet.Optional(column.node())))
+	}
+
+	for _, info := range propertyInfos {
+		fields = append(fields, namedField(info.Name, propertyNode(info, cfg.encodings)))
+	}
+
+	return parquet.NewSchema("", groupNode{fields: fields})
+}
+
+// propertyNode returns the node of a property column, optional if it is nullable, and
+// written with the encoding of its name in encodings or as an enum
+func propertyNode(info PropertyInfo, encodings map[string]string) parquet.Node {
+	var node parquet.Node
+	switch info.Type {
+	case PropertyTypeStruct:
+		node = structNode(info.Fields)
+	case PropertyTypeList:
+		// parquet-go writes required elements
+		node = parquet.List(leafNode(info.Element, 0))
+	default:
+		node = leafNode(info.Type, info.Bits)
+		if encoding := columnEncoding(info, node.Type().Kind(), encodings); encoding != nil {
+			node = encodedNode{Node: node, encoding: encoding}
+		}
+	}
+	if info.Nullable {
+		node = parquet.Optional(node)
+	}
+	return node
+}
+
+// leafNode returns the node of the values of a property type, integers being narrowed
+// to bits if it is not 0
+func leafNode(propType PropertyType, bits int) parquet.Node {
+	switch propType {
+	case PropertyTypeInt:
+		if bits != 0 {
+			return parquet.Int(bits)
+		}
+		return parquet.Int(64)
+	case PropertyTypeUint:
+		return parquet.Uint(64)
+	case PropertyTypeFloat:
+		return parquet.Leaf(parquet.DoubleType)
+	case PropertyTypeBool:
+		return parquet.Leaf(parquet.BooleanType)
+	case PropertyTypeTimestamp:
+		return parquet.Timestamp(parquet.Microsecond)
+	case PropertyTypeDate:
+		return parquet.Date()
+	case PropertyTypeUUID:
+		return parquet.UUID()
+	case PropertyTypeJSON:
+		return parquet.JSON()
+	default:
+		return parquet.String()
+	}
+}
+
+// namedField returns a field of a record schema
+func namedField(name string, node parquet.Node) parquet.Field {
+	return parquet.Group{name: node}.Fields()[0]
+}
+
+// groupNode is a group node of a record schema, whose fields are in the order of the
+// columns rather than sorted by name like those of a parquet.Group
+type groupNode struct {
+	parquet.Group
+	fields []parquet.Field
+}
+
+func (n groupNode) Fields() []parquet.Field {
+	return n.fields
+}
+
+// recordBuilder builds the rows of features, with the appenders of the property
+// columns resolved from the schema once for all the rows
+type recordBuilder struct {
+	cfg        *config
+	properties []PropertyInfo
+	appenders  []propertyAppender
+	// Encodings of the geometry columns.
+	encodings []string
+	// Number of leaf columns of a row.
+	columns int
+}
+
+func newRecordBuilder(propertyInfos []PropertyInfo, cfg *config) *recordBuilder {
+	geometryColumns := cfg.geometryColumns()
+	encodings := make([]string, len(geometryColumns))
+	for i, column := range geometryColumns {
+		encodings[i] = column.Encoding
+	}
+
+	column := len(geometryColumns) + len(cfg.measures) + len(cfg.cells)
+	if cfg.bboxColumn {
+		column += len(bboxFields)
+	}
+	if cfg.bboxProperties {
+		column += len(bboxPropertyColumns)
+	}
+	appenders := make([]propertyAppender, len(propertyInfos))
+	for i, info := range propertyInfos {
+		appenders[i], column = newPropertyAppender(info, column)
+	}
+
+	return &recordBuilder{
+		cfg:        cfg,
+		properties: propertyInfos,
+		appenders:  appenders,
+		encodings:  encodings,
+		columns:    column,
+	}
+}
+
+// build returns the row of a feature and its geometries, as returned by
+// featureGeometries. It is safe to call concurrently.
+func (b *recordBuilder) build(feature *geojson.Feature, geometries []orb.Geometry) (parquet.Row, error) {
+	row := make(parquet.Row, 0, b.columns)
+
+	// Add encoded geometries
+	for i, geometry := range geometries {
+		if geometry == nil {
+			if i == 0 && b.cfg.requiredGeometry {
+				return nil, AppError{Message: "a feature without a geometry cannot be written to a required geometry column"}
+			}
+			row = append(row, parquet.NullValue().Level(0, 0, len(row)))
+			continue
+		}
+		if emptyGeometry(geometry) {
+			geometry = canonicalEmpty(geometry)
+		}
+
+		data, err := encodeGeometry(geometry, b.encodings[i])
+		if err != nil {
+			return nil, err
+		}
+		row = append(row, optionalValue(parquet.ByteArrayValue(data), i > 0 || !b.cfg.requiredGeometry, len(row)))
+	}
+
+	bounded := feature.Geometry != nil && !emptyGeometry(feature.Geometry)
+	var bound orb.Bound
+	if bounded {
+		bound = feature.Geometry.Bound()
+	}
+	if b.cfg.bboxColumn {
+		row = appendDoubles(row, bounded, bound.Min.X(), bound.Min.Y(), bound.Max.X(), bound.Max.Y())
+	}
+	if b.cfg.bboxProperties {
+		for _, value := range [4]float64{bound.Min.X(), bound.Min.Y(), bound.Max.X(), bound.Max.Y()} {
+			row = appendDoubles(row, bounded, value)
+		}
+	}
+	for _, column := range b.cfg.measures {
+		if feature.Geometry == nil {
+			row = appendDoubles(row, false, 0)
+		} else {
+			row = appendDoubles(row, true, column.measure(feature.Geometry))
+		}
+	}
+	if len(b.cfg.cells) > 0 {
+		centroid, ok := derivePoint(feature.Geometry, pointCentroid).(orb.Point)
+		for _, column := range b.cfg.cells {
+			if ok {
+				row = append(row, optionalValue(column.cell(centroid), true, len(row)))
+			} else {
+				row = append(row, parquet.NullValue().Level(0, 0, len(row)))
+			}
+		}
+	}
+
+	for i, info := range b.properties {
+		value := feature.Properties[info.Name]
+		if value == nil && !info.Nullable {
+			return nil, fmt.Errorf("property %q is null, but its column is required", info.Name)
+		}
+
+		var err error
+		if row, err = b.appenders[i](row, value, 0); err != nil {
+			return nil, fmt.Errorf("property %q: %w", info.Name, err)
+		}
+	}
+
+	return row, nil
+}
+
+// optionalValue returns the value of a top-level column with a single value per row,
+// at the definition level of a present value of an optional column if optional
+func optionalValue(value parquet.Value, optional bool, column int) parquet.Value {
+	if optional {
+		return value.Level(0, 1, column)
+	}
+	return value.Level(0, 0, column)
+}
+
+// appendDoubles appends the values of top-level optional double columns to a row, or
+// nulls if !present. With several values, they are the fields of an optional group.
+func appendDoubles(row parquet.Row, present bool, values ...float64) parquet.Row {
+	for _, value := range values {
+		if present {
+			row = append(row, parquet.DoubleValue(value).Level(0, 1, len(row)))
+		} else {
+			row = append(row, parquet.NullValue().Level(0, 0, len(row)))
+		}
+	}
+	return row
+}
+
+// propertyAppender appends the values of a property column to a row, value being nil
+// for a null, within groups of definition level def
+type propertyAppender func(row parquet.Row, value any, def int) (parquet.Row, error)
+
+// newPropertyAppender returns the appender of a property column whose first leaf
+// column is column, and the index of the leaf column following its own
+func newPropertyAppender(info PropertyInfo, column int) (propertyAppender, int) {
+	switch info.Type {
+	case PropertyTypeStruct:
+		return newStructAppender(info, column)
+	case PropertyTypeList:
+		return newListAppender(info, column), column + 1
+	}
+
+	convert := newValueConverter(info.Type, info.Bits)
+	nullable := info.Nullable
+	return func(row parquet.Row, value any, def int) (parquet.Row, error) {
+		if value == nil {
+			return append(row, parquet.NullValue().Level(0, def, column)), nil
+		}
+		converted, err := convert(value)
+		if err != nil {
+			return row, err
+		}
+		if nullable {
+			def++
+		}
+		return append(row, converted.Level(0, def, column)), nil
+	}, column + 1
+}
+
+// valueConverter converts a property value to the Parquet value of a column
+type valueConverter func(value any) (parquet.Value, error)
+
+// newValueConverter returns the converter of the values of a property type, integers
+// being narrowed to bits if it is not 0
+func newValueConverter(propType PropertyType, bits int) valueConverter {
+	switch propType {
+	case PropertyTypeInt:
+		if bits != 0 {
+			return func(value any) (parquet.Value, error) {
+				integer, err := convertTo[int64](value, propType)
+				if err != nil {
+					return parquet.Value{}, err
+				}
+				narrowed, err := narrowInteger(integer, bits)
+				return parquet.Int32Value(narrowed), err
+			}
+		}
+		return func(value any) (parquet.Value, error) {
+			integer, err := convertTo[int64](value, propType)
+			return parquet.Int64Value(integer), err
+		}
+	case PropertyTypeUint:
+		return func(value any) (parquet.Value, error) {
+			integer, err := convertTo[uint64](value, propType)
+			return parquet.Int64Value(int64(integer)), err //nolint:gosec
+		}
+	case PropertyTypeFloat:
+		return func(value any) (parquet.Value, error) {
+			float, err := convertTo[float64](value, propType)
+			return parquet.DoubleValue(float), err
+		}
+	case PropertyTypeBool:
+		return func(value any) (parquet.Value, error) {
+			boolean, err := convertTo[bool](value, propType)
+			return parquet.BooleanValue(boolean), err
+		}
+	case PropertyTypeTimestamp:
+		return func(value any) (parquet.Value, error) {
+			timestamp, err := convertTimestamp(value)
+			return parquet.Int64Value(timestamp.UnixMicro()), err
+		}
+	case PropertyTypeDate:
+		return func(value any) (parquet.Value, error) {
+			date, err := convertDate(value)
+			return parquet.Int32Value(date), err
+		}
+	case PropertyTypeUUID:
+		return func(value any) (parquet.Value, error) {
+			uuid, err := convertUUID(value)
+			return parquet.FixedLenByteArrayValue(uuid[:]), err
+		}
+	case PropertyTypeJSON:
+		return func(value any) (parquet.Value, error) {
+			text, err := convertJSON(value)
+			return parquet.ByteArrayValue([]byte(text)), err
+		}
+	default:
+		return func(value any) (parquet.Value, error) {
+			text, err := convertTo[string](value, PropertyTypeString)
+			return parquet.ByteArrayValue([]byte(text)), err
+		}
+	}
+}
+
+// convertTo converts a property value to the Go type T of the values of a column of
+// propType, as convertPropertyValue does, values already of type T being kept
+func convertTo[T any](value any, propType PropertyType) (T, error) {
+	if v, ok := value.(T); ok {
+		return v, nil
+	}
+	converted, err := convertPropertyValue(value, propType)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return converted.(T), nil
+}
+
+// convertPropertyValue converts a GeoJSON property value to the Go type of its column
+func convertPropertyValue(value any, propType PropertyType) (any, error) {
+	rv := reflect.ValueOf(value)
+
+	switch propType {
+	case PropertyTypeInt:
+		switch {
+		case rv.CanInt():
+			return rv.Int(), nil
+		case rv.CanUint() && rv.Uint() <= math.MaxInt64:
+			return int64(rv.Uint()), nil //nolint:gosec
+		case rv.CanFloat():
+			return int64(rv.Float()), nil
+		case rv.Kind() == reflect.String:
+			text := strings.TrimSpace(rv.String())
+			if integer, err := strconv.ParseInt(text, 10, 64); err == nil {
+				return integer, nil
+			}
+			if float, err := strconv.ParseFloat(text, 64); err == nil {
+				return int64(float), nil
+			}
+		}
+	case PropertyTypeUint:
+		// Negative values cannot be converted
+		switch {
+		case rv.CanUint():
+			return rv.Uint(), nil
+		case rv.CanInt() && rv.Int() >= 0:
+			return uint64(rv.Int()), nil
+		case rv.CanFloat() && rv.Float() >= 0 && rv.Float() < math.MaxUint64:
+			return uint64(rv.Float()), nil
+		case rv.Kind() == reflect.String:
+			text := strings.TrimSpace(rv.String())
+			if integer, err := strconv.ParseUint(text, 10, 64); err == nil {
+				return integer, nil
+			}
+		}
+	case PropertyTypeFloat:
+		switch {
+		case rv.CanFloat():
+			return rv.Float(), nil
+		case rv.CanInt():
+			return float64(rv.Int()), nil
+		case rv.CanUint():
+			return float64(rv.Uint()), nil
+		case rv.Kind() == reflect.String:
+			if float, err := strconv.ParseFloat(strings.TrimSpace(rv.String()), 64); err == nil {
+				return float, nil
+			}
+		}
+	case PropertyTypeBool:
+		switch rv.Kind() {
+		case reflect.Bool:
+			return rv.Bool(), nil
+		case reflect.String:
+			if boolean, err := strconv.ParseBool(strings.TrimSpace(rv.String())); err == nil {
+				return boolean, nil
+			}
+		}
+	case PropertyTypeTimestamp:
+		return convertTimestamp(value)
+	case PropertyTypeDate:
+		return convertDate(value)
+	case PropertyTypeUUID:
+		return convertUUID(value)
+	case PropertyTypeJSON:
+		return convertJSON(value)
+	default:
+		return stringifyProperty(value)
+	}
+
+	if text, ok := value.(string); ok {
+		return nil, fmt.Errorf("cannot convert %q to %s", text, propType)
+	}
+	return nil, fmt.Errorf("cannot convert %T to %s", value, propType)
+}
+
+// stringifyProperty renders a property value as a string.
+// Complex values (maps, slices) are stored as JSON.
+func stringifyProperty(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	default:
+		return fmt.Sprint(value), nil
+	}
+}
+
+// convertJSON returns the JSON text of a property value. Strings holding JSON, such as
+// those read back from a JSON column, are kept as they are.
+func convertJSON(value any) (string, error) {
+	if text, ok := value.(string); ok && json.Valid([]byte(text)) {
+		return text, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
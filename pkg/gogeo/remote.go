@@ -0,0 +1,80 @@
+package gogeo
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Timeouts applied when fetching remote inputs. Reading the body is not bounded as a
+// whole, since inputs can be large, but it fails once no data arrives for httpIdleTimeout.
+const (
+	httpDialTimeout           = 30 * time.Second
+	httpTLSHandshakeTimeout   = 10 * time.Second
+	httpResponseHeaderTimeout = 60 * time.Second
+	httpIdleTimeout           = 60 * time.Second
+)
+
+// IsURL checks if a path is an HTTP or HTTPS URL
+func IsURL(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// NewHTTPClient returns an HTTP client suited to streaming large inputs: connecting and
+// waiting for the response headers are bounded by timeouts, reading the body is not.
+func NewHTTPClient() *http.Client {
+	dialer := &net.Dialer{Timeout: httpDialTimeout}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   httpTLSHandshakeTimeout,
+			ResponseHeaderTimeout: httpResponseHeaderTimeout,
+			ForceAttemptHTTP2:     true,
+		},
+	}
+}
+
+// OpenURL returns an OpenFunc fetching url with a GET request carrying header, e.g. an
+// Authorization token. Each call issues a new request and streams its body, so the input
+// is downloaded once per pass instead of being buffered. A nil client uses NewHTTPClient.
+func OpenURL(ctx context.Context, client *http.Client, url string, header http.Header) OpenFunc {
+	store := &HTTPStore{Client: client, Header: header}
+	return func() (io.ReadCloser, error) { return store.Open(ctx, url) }
+}
+
+// idleTimeoutReader cancels a request when its body yields no data for a while
+type idleTimeoutReader struct {
+	body   io.ReadCloser
+	timer  *time.Timer
+	idle   time.Duration
+	cancel context.CancelFunc
+}
+
+func newIdleTimeoutReader(body io.ReadCloser, idle time.Duration, cancel context.CancelFunc) *idleTimeoutReader {
+	return &idleTimeoutReader{
+		body:   body,
+		timer:  time.AfterFunc(idle, cancel),
+		idle:   idle,
+		cancel: cancel,
+	}
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.idle)
+	}
+	return n, err
+}
+
+func (r *idleTimeoutReader) Close() error {
+	r.timer.Stop()
+	err := r.body.Close()
+	r.cancel()
+	return err
+}
@@ -0,0 +1,27 @@
+package gogeo
+
+import "slices"
+
+// WithRequiredColumns writes the property columns present and non-null in every
+// feature as REQUIRED columns instead of OPTIONAL ones, so that readers and table
+// formats know that they hold no nulls and the files store no definition levels for
+// them. The fields of struct columns present and non-null in all their objects are
+// required too. Without it, every property column is optional, whatever the Nullable
+// of the schema. A feature missing the value of a required column of a schema given
+// with WithSchema fails the conversion.
+func WithRequiredColumns() Option {
+	return func(cfg *config) {
+		cfg.requiredColumns = true
+	}
+}
+
+// nullableSchema returns property columns marked as nullable, recursing into the fields
+// of struct columns
+func nullableSchema(schema []PropertyInfo) []PropertyInfo {
+	nullable := slices.Clone(schema)
+	for i := range nullable {
+		nullable[i].Nullable = true
+		nullable[i].Fields = nullableSchema(nullable[i].Fields)
+	}
+	return nullable
+}
@@ -0,0 +1,134 @@
+package gogeo
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/paulmach/orb"
+)
+
+// maxS2Level is the level of the S2 leaf cells, about 1 cm across
+const maxS2Level = 30
+
+// Orientations of the Hilbert curve of the S2 cells: whether the i and j axes are
+// swapped, and whether both are inverted
+const (
+	s2SwapMask   = 1
+	s2InvertMask = 2
+)
+
+// s2LookupBits is the number of bits of i and j handled by a step of s2CellID
+const s2LookupBits = 4
+
+var (
+	// s2PosToIJ gives the position (i<<1 | j) of the four children of a cell in the
+	// order of the Hilbert curve, for each orientation.
+	s2PosToIJ = [4][4]int{
+		{0, 1, 3, 2},
+		{0, 2, 3, 1},
+		{3, 2, 0, 1},
+		{3, 1, 0, 2},
+	}
+	// s2PosToOrientation gives the change of orientation of the children of a cell.
+	s2PosToOrientation = [4]int{s2SwapMask, 0, 0, s2InvertMask | s2SwapMask}
+	// s2LookupPos maps s2LookupBits bits of i and j and an orientation to the
+	// positions along the Hilbert curve of the matching cells and their orientation.
+	s2LookupPos [1 << (2*s2LookupBits + 2)]int
+)
+
+func init() {
+	for _, orientation := range []int{0, s2SwapMask, s2InvertMask, s2SwapMask | s2InvertMask} {
+		initS2Lookup(0, 0, 0, orientation, 0, orientation)
+	}
+}
+
+// initS2Lookup fills s2LookupPos for the cells below the cell of level, i, j and pos
+// along the Hilbert curve
+func initS2Lookup(level, i, j, origOrientation, pos, orientation int) {
+	if level == s2LookupBits {
+		ij := i<<s2LookupBits + j
+		s2LookupPos[ij<<2+origOrientation] = pos<<2 + orientation
+		return
+	}
+	for child, ij := range s2PosToIJ[orientation] {
+		initS2Lookup(level+1, i<<1+ij>>1, j<<1+ij&1, origOrientation, pos<<2+child, orientation^s2PosToOrientation[child])
+	}
+}
+
+// WithS2Column adds an INT64 column holding the id of the S2 cell of the given level,
+// from 0 to 30, containing the centroid of each feature geometry, after any geometry
+// transformation. The ids are those of BigQuery S2_CELLIDFROMPOINT, as signed integers,
+// so the column joins S2-indexed tables. The coordinates must be longitudes and latitudes.
+func WithS2Column(name string, level int) Option {
+	return func(cfg *config) {
+		if level < 0 || level > maxS2Level {
+			cfg.fail(AppError{Message: fmt.Sprintf("invalid S2 level %d, expected 0 to %d", level, maxS2Level)})
+			return
+		}
+		cfg.addCellColumn(cellColumn{name: name, system: cellS2, level: level})
+	}
+}
+
+// s2CellID returns the id of the S2 cell of a level containing a point of longitude and
+// latitude. The point is projected from the center of the Earth onto the face of a
+// cube, the face coordinates are scaled quadratically to make the cells of about the
+// same area, and the cells of the face are numbered along a Hilbert curve.
+func s2CellID(point orb.Point, level int) uint64 {
+	lat, lng := point[1]*math.Pi/180, point[0]*math.Pi/180
+	x, y, z := math.Cos(lat)*math.Cos(lng), math.Cos(lat)*math.Sin(lng), math.Sin(lat)
+
+	face := 0
+	if math.Abs(y) >= math.Abs(x) {
+		face = 1
+	}
+	if math.Abs(z) >= math.Abs([3]float64{x, y, z}[face]) {
+		face = 2
+	}
+	if [3]float64{x, y, z}[face] < 0 {
+		face += 3
+	}
+
+	var u, v float64
+	switch face {
+	case 0:
+		u, v = y/x, z/x
+	case 1:
+		u, v = -x/y, z/y
+	case 2:
+		u, v = -x/z, -y/z
+	case 3:
+		u, v = z/x, y/x
+	case 4:
+		u, v = z/y, -x/y
+	default:
+		u, v = -y/z, -x/z
+	}
+	i, j := s2IJ(u), s2IJ(v)
+
+	id := uint64(face) << (2*maxS2Level + 1)
+	bits := face & s2SwapMask
+	mask := 1<<s2LookupBits - 1
+	for k := 7; k >= 0; k-- {
+		bits += (i >> (k * s2LookupBits) & mask) << (s2LookupBits + 2)
+		bits += (j >> (k * s2LookupBits) & mask) << 2
+		bits = s2LookupPos[bits]
+		id |= uint64(bits>>2) << (k*2*s2LookupBits + 1)
+		bits &= s2SwapMask | s2InvertMask
+	}
+	id |= 1
+
+	// The cell of the level is the ancestor of the leaf cell
+	lsb := uint64(1) << (2 * (maxS2Level - level))
+	return id&-lsb | lsb
+}
+
+// s2IJ returns the leaf cell coordinate along a face of a cube coordinate from -1 to 1
+func s2IJ(u float64) int {
+	var s float64
+	if u >= 0 {
+		s = 0.5 * math.Sqrt(1+3*u)
+	} else {
+		s = 1 - 0.5*math.Sqrt(1-3*u)
+	}
+	return max(0, min(1<<maxS2Level-1, int(math.Floor(s*(1<<maxS2Level)))))
+}
@@ -0,0 +1,449 @@
+package gogeo
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// s3PartSize is the size of the parts of a multipart upload. Objects smaller than one
+// part are uploaded with a single PUT.
+const s3PartSize = 8 << 20
+
+// s3ContainerCredentialsHost serves the task role credentials of ECS containers
+const s3ContainerCredentialsHost = "http://169.254.170.2"
+
+// IsS3URI checks if a path is an s3://bucket/key URI
+func IsS3URI(path string) bool {
+	return strings.HasPrefix(strings.ToLower(path), "s3://")
+}
+
+// S3Store reads and writes objects in Amazon S3 or an S3 compatible service.
+type S3Store struct {
+	client   *http.Client
+	region   string
+	endpoint string
+
+	mu          sync.Mutex
+	credentials awsCredentials
+}
+
+// awsCredentials holds the keys signing S3 requests
+type awsCredentials struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	SessionToken    string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+// NewS3Store creates an S3Store configured from the standard AWS environment variables:
+// AWS_REGION (or AWS_DEFAULT_REGION), AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN as set in Lambda, or the ECS task role when running in a container.
+// AWS_ENDPOINT_URL_S3 (or AWS_ENDPOINT_URL) selects an S3 compatible service such as MinIO.
+func NewS3Store() *S3Store {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_S3")
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+
+	return &S3Store{
+		client:   NewHTTPClient(),
+		region:   region,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+	}
+}
+
+// Open streams the object at an s3://bucket/key URI.
+func (s *S3Store) Open(ctx context.Context, uri string) (io.ReadCloser, error) {
+	bucket, key, err := parseBucketURI(uri, "s3")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	response, err := s.do(ctx, http.MethodGet, bucket, key, nil, nil)
+	if err != nil {
+		cancel()
+		return nil, AppError{Message: fmt.Sprintf("failed to read %s", uri), Value: err}
+	}
+	return newIdleTimeoutReader(response.Body, httpIdleTimeout, cancel), nil
+}
+
+// Create returns a writer uploading to the object at an s3://bucket/key URI. Data is
+// uploaded in parts as it is written and the object only appears once Close succeeds.
+func (s *S3Store) Create(ctx context.Context, uri string) (BlobWriter, error) {
+	bucket, key, err := parseBucketURI(uri, "s3")
+	if err != nil {
+		return nil, err
+	}
+	return &s3Writer{store: s, ctx: ctx, uri: uri, bucket: bucket, key: key}, nil
+}
+
+// s3Writer uploads an object to S3 as it is written
+type s3Writer struct {
+	store  *S3Store
+	ctx    context.Context
+	uri    string
+	bucket string
+	key    string
+
+	buffer   bytes.Buffer
+	uploadID string
+	parts    []s3Part
+	err      error
+}
+
+// s3Part is an uploaded part of a multipart upload
+type s3Part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// Write buffers p and uploads a part each time s3PartSize bytes are buffered.
+func (w *s3Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	w.buffer.Write(p)
+	for w.buffer.Len() >= s3PartSize {
+		if err := w.uploadPart(w.buffer.Next(s3PartSize)); err != nil {
+			w.err = err
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close uploads the remaining data and completes the object.
+func (w *s3Writer) Close() error {
+	if w.err != nil {
+		w.Abort()
+		return w.err
+	}
+
+	// Small objects are written with a single request
+	if w.uploadID == "" {
+		response, err := w.store.do(w.ctx, http.MethodPut, w.bucket, w.key, nil, w.buffer.Bytes())
+		if err != nil {
+			return AppError{Message: fmt.Sprintf("failed to write %s", w.uri), Value: err}
+		}
+		response.Body.Close()
+		return nil
+	}
+
+	if w.buffer.Len() > 0 {
+		if err := w.uploadPart(w.buffer.Bytes()); err != nil {
+			w.Abort()
+			return err
+		}
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: w.parts})
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"uploadId": {w.uploadID}}
+	response, err := w.store.do(w.ctx, http.MethodPost, w.bucket, w.key, query, body)
+	if err != nil {
+		w.Abort()
+		return AppError{Message: fmt.Sprintf("failed to complete upload of %s", w.uri), Value: err}
+	}
+	defer response.Body.Close()
+
+	// S3 may report a failed completion in the body of a 200 response
+	result, err := io.ReadAll(response.Body)
+	if err != nil {
+		return AppError{Message: fmt.Sprintf("failed to complete upload of %s", w.uri), Value: err}
+	}
+	if bytes.Contains(result, []byte("<Error>")) {
+		w.Abort()
+		return AppError{Message: fmt.Sprintf("failed to complete upload of %s: %s", w.uri, result)}
+	}
+	return nil
+}
+
+// Abort discards the upload; nothing is written to the object.
+func (w *s3Writer) Abort() error {
+	if w.err == nil {
+		w.err = AppError{Message: fmt.Sprintf("upload of %s was aborted", w.uri)}
+	}
+	if w.uploadID == "" {
+		return nil
+	}
+
+	// The upload is cleaned up even if the conversion was cancelled
+	query := url.Values{"uploadId": {w.uploadID}}
+	w.uploadID = ""
+	response, err := w.store.do(context.WithoutCancel(w.ctx), http.MethodDelete, w.bucket, w.key, query, nil)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+// uploadPart uploads data as the next part, starting the multipart upload if needed
+func (w *s3Writer) uploadPart(data []byte) error {
+	if w.uploadID == "" {
+		uploadID, err := w.createMultipartUpload()
+		if err != nil {
+			return AppError{Message: fmt.Sprintf("failed to start upload of %s", w.uri), Value: err}
+		}
+		w.uploadID = uploadID
+	}
+
+	number := len(w.parts) + 1
+	query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {w.uploadID}}
+	response, err := w.store.do(w.ctx, http.MethodPut, w.bucket, w.key, query, data)
+	if err != nil {
+		return AppError{Message: fmt.Sprintf("failed to upload part %d of %s", number, w.uri), Value: err}
+	}
+	response.Body.Close()
+
+	w.parts = append(w.parts, s3Part{PartNumber: number, ETag: response.Header.Get("ETag")})
+	return nil
+}
+
+// createMultipartUpload starts a multipart upload and returns its id
+func (w *s3Writer) createMultipartUpload() (string, error) {
+	response, err := w.store.do(w.ctx, http.MethodPost, w.bucket, w.key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(response.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if result.UploadID == "" {
+		return "", fmt.Errorf("no upload id in response")
+	}
+	return result.UploadID, nil
+}
+
+// do sends a signed request for an object and fails on non-2xx responses
+func (s *S3Store) do(ctx context.Context, method, bucket, key string, query url.Values, body []byte) (*http.Response, error) {
+	credentials, err := s.resolveCredentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, s.objectURL(bucket, key, query), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		request.Body = http.NoBody
+	}
+	signS3Request(request, body, credentials, s.region, time.Now())
+
+	return doRequest(s.client, request)
+}
+
+// objectURL returns the URL of an object. Custom endpoints use path-style addressing,
+// AWS uses virtual-hosted-style addressing.
+func (s *S3Store) objectURL(bucket, key string, query url.Values) string {
+	var base string
+	if s.endpoint != "" {
+		base = s.endpoint + "/" + bucket
+	} else {
+		base = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, s.region)
+	}
+
+	objectURL := base + "/" + s3EscapePath(key)
+	if len(query) > 0 {
+		objectURL += "?" + s3CanonicalQuery(query)
+	}
+	return objectURL
+}
+
+// resolveCredentials returns the credentials from the environment, or the cached
+// ECS container credentials, refreshing them before they expire
+func (s *S3Store) resolveCredentials(ctx context.Context) (awsCredentials, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return awsCredentials{
+			AccessKeyID:     id,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.credentials.AccessKeyID != "" && time.Until(s.credentials.Expiration) > 5*time.Minute {
+		return s.credentials, nil
+	}
+
+	credentialsURL := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		credentialsURL = s3ContainerCredentialsHost + relative
+	}
+	if credentialsURL == "" {
+		return awsCredentials{}, AppError{Message: "no AWS credentials found, set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY"}
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, credentialsURL, nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+		request.Header.Set("Authorization", token)
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return awsCredentials{}, AppError{Message: "failed to fetch container credentials", Value: err}
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return awsCredentials{}, AppError{Message: fmt.Sprintf("failed to fetch container credentials: %s", response.Status)}
+	}
+
+	var credentials awsCredentials
+	if err := json.NewDecoder(response.Body).Decode(&credentials); err != nil {
+		return awsCredentials{}, AppError{Message: "failed to decode container credentials", Value: err}
+	}
+	s.credentials = credentials
+	return credentials, nil
+}
+
+// signS3Request signs a request with AWS Signature Version 4
+func signS3Request(request *http.Request, body []byte, credentials awsCredentials, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(body)
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if credentials.SessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	}
+
+	canonicalRequest, signedHeaders := s3CanonicalRequest(request, payloadHash)
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := s3StringToSign(amzDate, scope, canonicalRequest)
+
+	key := hmacSHA256([]byte("AWS4"+credentials.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		credentials.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// s3CanonicalRequest returns the canonical request of a request and the names of its
+// signed headers: all headers set so far, along with the host
+func s3CanonicalRequest(request *http.Request, payloadHash string) (string, string) {
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		s3EscapePath(request.URL.Path),
+		s3CanonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	return canonicalRequest, signedHeaders
+}
+
+// s3StringToSign returns the string signed for a canonical request
+func s3StringToSign(amzDate, scope, canonicalRequest string) string {
+	return "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+}
+
+// s3EscapePath URI-encodes each segment of an object path
+func s3EscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = s3Escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// s3CanonicalQuery encodes query parameters sorted by name, as required for signing
+func s3CanonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var pairs []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			pairs = append(pairs, s3Escape(name)+"="+s3Escape(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// s3Escape percent-encodes everything but the RFC 3986 unreserved characters
+func s3Escape(s string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(s) {
+		if ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' {
+			escaped.WriteByte(b)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
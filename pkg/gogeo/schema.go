@@ -1,7 +1,10 @@
 package gogeo
 
 import (
+	"fmt"
+	"math"
 	"reflect"
+	"strings"
 )
 
 // PropertyType represents the inferred type of a GeoJSON property
@@ -14,6 +17,13 @@ const (
 	PropertyTypeFloat
 	PropertyTypeBool
 	PropertyTypeNull
+	PropertyTypeTimestamp
+	PropertyTypeDate
+	PropertyTypeUUID
+	PropertyTypeJSON
+	PropertyTypeStruct
+	PropertyTypeList
+	PropertyTypeUint
 )
 
 // inferPropertyType infers the Parquet type from a GeoJSON property value
@@ -28,7 +38,7 @@ func inferPropertyType(value any) PropertyType {
 	case int, int8, int16, int32, int64:
 		return PropertyTypeInt
 	case uint, uint8, uint16, uint32, uint64:
-		return PropertyTypeInt
+		return unsignedPropertyType(reflect.ValueOf(v).Uint())
 	case float32, float64:
 		return PropertyTypeFloat
 	case string:
@@ -42,20 +52,87 @@ func inferPropertyType(value any) PropertyType {
 		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 			return PropertyTypeInt
 		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			return PropertyTypeInt
+			return unsignedPropertyType(rv.Uint())
 		case reflect.Float32, reflect.Float64:
 			return PropertyTypeFloat
 		case reflect.String:
 			return PropertyTypeString
 		case reflect.Map, reflect.Slice, reflect.Array:
-			// Complex types stored as JSON strings
-			return PropertyTypeString
+			// Complex types stored as JSON text
+			return PropertyTypeJSON
 		default:
 			return PropertyTypeString
 		}
 	}
 }
 
+// isComplex reports whether a property type holds objects or arrays
+func isComplex(propType PropertyType) bool {
+	return propType == PropertyTypeJSON || propType == PropertyTypeStruct || propType == PropertyTypeList
+}
+
+// unsignedPropertyType returns the type of an unsigned integer, PropertyTypeUint if it
+// does not fit in an int64
+func unsignedPropertyType(value uint64) PropertyType {
+	if value > math.MaxInt64 {
+		return PropertyTypeUint
+	}
+	return PropertyTypeInt
+}
+
+// isNumeric reports whether a property type is an integer or float
+func isNumeric(propType PropertyType) bool {
+	return propType == PropertyTypeInt || propType == PropertyTypeUint || propType == PropertyTypeFloat
+}
+
+// ParsePropertyType returns the property type of a name such as "string", "int", "uint",
+// "float", "bool", "timestamp", "date", "uuid" or "json", or of the Parquet type names returned by
+// PropertyType.String.
+func ParsePropertyType(name string) (PropertyType, error) {
+	switch strings.ToLower(name) {
+	case "string", "str", "text":
+		return PropertyTypeString, nil
+	case "int", "int64", "integer":
+		return PropertyTypeInt, nil
+	case "uint", "uint64", "unsigned":
+		return PropertyTypeUint, nil
+	case "float", "double", "float64", "number":
+		return PropertyTypeFloat, nil
+	case "bool", "boolean":
+		return PropertyTypeBool, nil
+	case "timestamp", "datetime":
+		return PropertyTypeTimestamp, nil
+	case "date":
+		return PropertyTypeDate, nil
+	case "uuid":
+		return PropertyTypeUUID, nil
+	case "json":
+		return PropertyTypeJSON, nil
+	case "struct":
+		return PropertyTypeStruct, nil
+	case "list":
+		return PropertyTypeList, nil
+	default:
+		return PropertyTypeUnknown, AppError{Message: fmt.Sprintf("unknown property type %q, expected string, int, uint, float, bool, timestamp, date, uuid or json", name)}
+	}
+}
+
+// MarshalText writes a PropertyType as its String, so that schemas read in JSON.
+func (pt PropertyType) MarshalText() ([]byte, error) {
+	return []byte(pt.String()), nil
+}
+
+// UnmarshalText reads a PropertyType written by MarshalText or named as for
+// ParsePropertyType.
+func (pt *PropertyType) UnmarshalText(text []byte) error {
+	parsed, err := ParsePropertyType(string(text))
+	if err != nil {
+		return err
+	}
+	*pt = parsed
+	return nil
+}
+
 // String returns the string representation of a PropertyType
 func (pt PropertyType) String() string {
 	switch pt {
@@ -69,6 +146,20 @@ func (pt PropertyType) String() string {
 		return "boolean"
 	case PropertyTypeNull:
 		return "null"
+	case PropertyTypeTimestamp:
+		return "timestamp"
+	case PropertyTypeDate:
+		return "date"
+	case PropertyTypeUUID:
+		return "uuid"
+	case PropertyTypeJSON:
+		return "json"
+	case PropertyTypeStruct:
+		return "struct"
+	case PropertyTypeList:
+		return "list"
+	case PropertyTypeUint:
+		return "uint64"
 	default:
 		return "unknown"
 	}
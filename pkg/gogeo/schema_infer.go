@@ -0,0 +1,66 @@
+package gogeo
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// InferSchema runs only the property analysis of Generate on a GeoJSON file and
+// returns the schema it would write, without producing a GeoParquet file: the number of
+// features, the property columns with their types and nullability, and the geo metadata
+// with the geometry types and bbox of the geometry columns. The options that select,
+// rename, transform and cast properties apply as they do to Generate.
+func InferSchema(geojsonPath string, opts ...Option) (*Report, error) {
+	return InferSchemaContext(context.Background(), geojsonPath, opts...)
+}
+
+// InferSchemaContext is like InferSchema but stops the analysis when ctx is cancelled.
+func InferSchemaContext(ctx context.Context, geojsonPath string, opts ...Option) (*Report, error) {
+	cfg := newConfig(opts)
+	if cfg.inputFormat == "" {
+		cfg.inputFormat = FormatFromPath(geojsonPath)
+	}
+	input, err := os.Open(geojsonPath)
+	if err != nil {
+		return nil, AppError{Message: "failed to read GeoJSON file", Value: err}
+	}
+	defer input.Close()
+
+	return inferSchemaFrom(ctx, input, cfg)
+}
+
+// InferSchemaFrom is like InferSchema but reads the GeoJSON from a stream. The
+// analysis reads it once, without buffering the features.
+func InferSchemaFrom(r io.Reader, opts ...Option) (*Report, error) {
+	return InferSchemaFromContext(context.Background(), r, opts...)
+}
+
+// InferSchemaFromContext is like InferSchemaFrom but stops the analysis when ctx is cancelled.
+func InferSchemaFromContext(ctx context.Context, r io.Reader, opts ...Option) (*Report, error) {
+	return inferSchemaFrom(ctx, r, newConfig(opts))
+}
+
+// inferSchemaFrom analyzes the features of r and casts the inferred property columns
+func inferSchemaFrom(ctx context.Context, r io.Reader, cfg *config) (*Report, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	reader, err := newFeatureReader(r, cfg)
+	if err != nil {
+		return nil, err
+	}
+	analysis, err := analyzeFeatures(withContext(ctx, reader), cfg)
+	if err != nil {
+		return nil, AppError{Message: "failed to read GeoJSON", Value: err}
+	}
+	if analysis.Features == 0 {
+		return nil, AppError{Message: "no features found in GeoJSON"}
+	}
+
+	if analysis.Properties, err = cfg.castSchema(analysis.Properties); err != nil {
+		return nil, err
+	}
+	return analysis, nil
+}
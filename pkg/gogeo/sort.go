@@ -0,0 +1,312 @@
+package gogeo
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// Space-filling curves ordering features with WithSpatialSort
+const (
+	// SpatialSortHilbert orders features along a Hilbert curve, which keeps
+	// consecutive features closer together than a Z-order curve.
+	SpatialSortHilbert = "hilbert"
+	// SpatialSortZOrder orders features along a Z-order (Morton) curve, which is
+	// cheaper to compute.
+	SpatialSortZOrder = "zorder"
+)
+
+// curveOrder is the number of bits per axis of the grid the curves are computed on
+const curveOrder = 16
+
+// normalizeSpatialSort validates the name of a space-filling curve
+func normalizeSpatialSort(curve string) (string, error) {
+	switch normalized := strings.ToLower(curve); normalized {
+	case SpatialSortHilbert, SpatialSortZOrder:
+		return normalized, nil
+	case "z-order", "morton":
+		return SpatialSortZOrder, nil
+	default:
+		return "", AppError{Message: fmt.Sprintf("unsupported spatial sort %q, expected hilbert or zorder", curve)}
+	}
+}
+
+// SortColumn is a property column ordering the rows with WithSortBy.
+type SortColumn struct {
+	Name string
+	// Descending orders the rows from the largest value to the smallest.
+	Descending bool
+}
+
+// sortColumnTypes returns the types of the sort columns, which must be property columns
+func sortColumnTypes(schema []PropertyInfo, columns []SortColumn) ([]PropertyType, error) {
+	types := make([]PropertyType, len(columns))
+	for i, column := range columns {
+		index := slices.IndexFunc(schema, func(info PropertyInfo) bool { return info.Name == column.Name })
+		if index < 0 {
+			return nil, AppError{Message: fmt.Sprintf("cannot sort by %q, it is not a property column", column.Name)}
+		}
+		types[i] = schema[index].Type
+	}
+	return types, nil
+}
+
+// sortFeatures reads all features of reader into memory and returns a reader over them
+// in the order configured by cfg: by the sort columns, then along the space-filling
+// curve. Ties keep their input order. With a memory budget, the features are read and
+// sorted in runs fitting in its share, whose ends are recorded in breaks.
+func sortFeatures(reader FeatureReader, schema []PropertyInfo, cfg *config, breaks *rowGroupBreaks) (FeatureReader, error) {
+	types, err := sortColumnTypes(schema, cfg.sortBy)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.maxMemory > 0 {
+		return &runReader{reader: reader, types: types, cfg: cfg, breaks: breaks}, nil
+	}
+	features, err := readAllFeatures(reader)
+	if err != nil {
+		return nil, err
+	}
+	return newSliceReader(sortRun(features, types, cfg)), nil
+}
+
+// runReader reads the features of a reader in sorted runs of at most the memory share
+// of the budget
+type runReader struct {
+	reader FeatureReader
+	types  []PropertyType
+	cfg    *config
+	breaks *rowGroupBreaks
+	// run holds the features of the current run left to return, and read is the number
+	// of features read.
+	run  []*geojson.Feature
+	read int
+	done bool
+}
+
+func (r *runReader) Next() (*geojson.Feature, error) {
+	if len(r.run) == 0 {
+		if err := r.nextRun(); err != nil {
+			return nil, err
+		}
+	}
+	feature := r.run[0]
+	r.run = r.run[1:]
+	return feature, nil
+}
+
+// nextRun reads and sorts the next run, returning io.EOF after the last one
+func (r *runReader) nextRun() error {
+	if r.done {
+		return io.EOF
+	}
+	var features []*geojson.Feature
+	var size int64
+	for size < r.cfg.memoryShare() || len(features) == 0 {
+		feature, err := r.reader.Next()
+		if errors.Is(err, io.EOF) {
+			r.done = true
+			break
+		}
+		if err != nil {
+			return err
+		}
+		features = append(features, feature)
+		size += featureSize(feature)
+	}
+	if len(features) == 0 {
+		return io.EOF
+	}
+	// The run starts a row group unless it is the first one
+	if r.read > 0 {
+		r.breaks.add(r.read)
+	}
+	r.read += len(features)
+	r.run = sortRun(features, r.types, r.cfg)
+	return nil
+}
+
+// sortRun returns features in the order configured by cfg
+func sortRun(features []*geojson.Feature, types []PropertyType, cfg *config) []*geojson.Feature {
+	// Convert the sort values to the types of their columns, as they are written;
+	// values that cannot be converted sort as nulls
+	var values [][]any
+	if len(cfg.sortBy) > 0 {
+		values = make([][]any, len(features))
+		for i, feature := range features {
+			row := make([]any, len(cfg.sortBy))
+			for j, column := range cfg.sortBy {
+				if value := feature.Properties[column.Name]; value != nil {
+					if converted, err := convertPropertyValue(value, types[j]); err == nil {
+						row[j] = converted
+					}
+				}
+			}
+			values[i] = row
+		}
+	}
+	var curve []uint64
+	if cfg.spatialSort != "" {
+		curve = curveKeys(features, cfg.spatialSort)
+	}
+
+	order := make([]int, len(features))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		for k, column := range cfg.sortBy {
+			if c := compareSortValues(values[a][k], values[b][k], column.Descending); c != 0 {
+				return c < 0
+			}
+		}
+		return curve != nil && curve[a] < curve[b]
+	})
+
+	sorted := make([]*geojson.Feature, len(features))
+	for i, index := range order {
+		sorted[i] = features[index]
+	}
+	return sorted
+}
+
+// compareSortValues orders two values of a sort column, nulls last in either direction
+func compareSortValues(a, b any, descending bool) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+
+	var c int
+	switch a := a.(type) {
+	case int64:
+		c = cmp.Compare(a, b.(int64))
+	case uint64:
+		c = cmp.Compare(a, b.(uint64))
+	case float64:
+		c = cmp.Compare(a, b.(float64))
+	case bool:
+		c = compareValues(a, b)
+	case string:
+		c = strings.Compare(a, b.(string))
+	case int32:
+		c = cmp.Compare(a, b.(int32))
+	case time.Time:
+		c = a.Compare(b.(time.Time))
+	case [16]byte:
+		other := b.([16]byte)
+		c = bytes.Compare(a[:], other[:])
+	}
+	if descending {
+		return -c
+	}
+	return c
+}
+
+// curveKeys returns the positions of features along a space-filling curve through the
+// centers of their bounding boxes, scaled to the extent of all centers. Features
+// without a geometry or with an empty one get the largest key, so they come last.
+func curveKeys(features []*geojson.Feature, curve string) []uint64 {
+	centers := make([]orb.Point, len(features))
+	located := make([]bool, len(features))
+	var extent orb.Bound
+	found := false
+	for i, feature := range features {
+		if feature.Geometry == nil || countPositions(feature.Geometry) == 0 {
+			continue
+		}
+		center := feature.Geometry.Bound().Center()
+		if math.IsNaN(center[0]) || math.IsNaN(center[1]) {
+			continue
+		}
+		centers[i], located[i] = center, true
+		if !found {
+			extent = orb.Bound{Min: center, Max: center}
+			found = true
+		} else {
+			extent = extent.Extend(center)
+		}
+	}
+
+	keys := make([]uint64, len(features))
+	for i := range features {
+		if !located[i] {
+			keys[i] = math.MaxUint64
+			continue
+		}
+		x := gridCoordinate(centers[i][0], extent.Min[0], extent.Max[0])
+		y := gridCoordinate(centers[i][1], extent.Min[1], extent.Max[1])
+		if curve == SpatialSortZOrder {
+			keys[i] = zOrderIndex(x, y)
+		} else {
+			keys[i] = hilbertIndex(x, y)
+		}
+	}
+	return keys
+}
+
+// gridCoordinate scales a coordinate within [min, max] to a cell of the curve grid
+func gridCoordinate(value, minimum, maximum float64) uint32 {
+	if maximum <= minimum {
+		return 0
+	}
+	cells := float64(uint32(1)<<curveOrder - 1)
+	return uint32(math.Round((value - minimum) / (maximum - minimum) * cells))
+}
+
+// hilbertIndex returns the distance along a Hilbert curve of a cell of the grid
+func hilbertIndex(x, y uint32) uint64 {
+	const n = uint32(1) << curveOrder
+	var index uint64
+	for s := n / 2; s > 0; s /= 2 {
+		var rx, ry uint32
+		if x&s != 0 {
+			rx = 1
+		}
+		if y&s != 0 {
+			ry = 1
+		}
+		index += uint64(s) * uint64(s) * uint64((3*rx)^ry)
+
+		// Rotate the quadrant so that the curve continues from the previous one
+		if ry == 0 {
+			if rx == 1 {
+				x = n - 1 - x
+				y = n - 1 - y
+			}
+			x, y = y, x
+		}
+	}
+	return index
+}
+
+// zOrderIndex interleaves the bits of the coordinates of a cell of the grid
+func zOrderIndex(x, y uint32) uint64 {
+	return spreadBits(x) | spreadBits(y)<<1
+}
+
+// spreadBits inserts a zero bit before each of the low 32 bits of v
+func spreadBits(v uint32) uint64 {
+	x := uint64(v)
+	x = (x | x<<16) & 0x0000ffff0000ffff
+	x = (x | x<<8) & 0x00ff00ff00ff00ff
+	x = (x | x<<4) & 0x0f0f0f0f0f0f0f0f
+	x = (x | x<<2) & 0x3333333333333333
+	x = (x | x<<1) & 0x5555555555555555
+	return x
+}
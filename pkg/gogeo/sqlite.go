@@ -0,0 +1,532 @@
+package gogeo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// sqliteHeader is the magic string starting every SQLite database file
+const sqliteHeader = "SQLite format 3\x00"
+
+// B-tree page types
+const (
+	sqliteInteriorTable = 0x05
+	sqliteLeafTable     = 0x0d
+)
+
+// sqliteDB is a minimal read-only reader of the SQLite file format, sufficient to
+// scan the rowid tables of a GeoPackage. Indexes, WAL files and UTF-16 databases
+// are not supported: a database in WAL mode is refused while its WAL file holds
+// changes that were not checkpointed.
+type sqliteDB struct {
+	r        io.ReaderAt
+	size     int64
+	pageSize int
+	// usable is the page size minus the reserved bytes at the end of each page.
+	usable int
+}
+
+// sqliteTable describes a table found in the schema
+type sqliteTable struct {
+	name     string
+	rootPage int
+	columns  []sqliteColumn
+	// rowidColumn is the index of the INTEGER PRIMARY KEY column aliasing the rowid, or -1.
+	rowidColumn int
+}
+
+// sqliteColumn is a column of a CREATE TABLE statement
+type sqliteColumn struct {
+	name string
+	// declType is the declared type in upper case, e.g. "INTEGER" or "POINT".
+	declType string
+}
+
+// openSQLite reads the database header
+func openSQLite(r io.ReaderAt, size int64) (*sqliteDB, error) {
+	header := make([]byte, 100)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("failed to read database header: %w", err)
+	}
+	if string(header[:16]) != sqliteHeader {
+		return nil, errors.New("not a SQLite database")
+	}
+
+	pageSize := int(binary.BigEndian.Uint16(header[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, fmt.Errorf("invalid page size %d", pageSize)
+	}
+	if encoding := binary.BigEndian.Uint32(header[56:60]); encoding > 1 {
+		return nil, errors.New("UTF-16 databases are not supported")
+	}
+	// Format versions 2 mean WAL mode, where committed changes can still be in the WAL
+	// file next to the database instead of the database itself
+	if header[18] == 2 || header[19] == 2 {
+		if err := checkWAL(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return &sqliteDB{r: r, size: size, pageSize: pageSize, usable: pageSize - int(header[20])}, nil
+}
+
+// checkWAL fails if the database is a file whose WAL file holds changes that were not
+// checkpointed into it yet, since reading the database alone would miss them
+func checkWAL(r io.ReaderAt) error {
+	file, ok := r.(interface{ Name() string })
+	if !ok {
+		return nil
+	}
+	wal := file.Name() + "-wal"
+	if info, err := os.Stat(wal); err == nil && info.Size() > 0 {
+		return fmt.Errorf("database has changes in its WAL file %s that are not checkpointed, "+
+			"run PRAGMA wal_checkpoint(TRUNCATE) on it first", wal)
+	}
+	return nil
+}
+
+// page reads a page by its 1-based number
+func (db *sqliteDB) page(number int) ([]byte, error) {
+	offset := int64(number-1) * int64(db.pageSize)
+	if number < 1 || offset+int64(db.pageSize) > db.size {
+		return nil, fmt.Errorf("page %d is out of range", number)
+	}
+	data := make([]byte, db.pageSize)
+	if _, err := db.r.ReadAt(data, offset); err != nil {
+		return nil, fmt.Errorf("failed to read page %d: %w", number, err)
+	}
+	return data, nil
+}
+
+// tables reads the schema table and returns the tables by name
+func (db *sqliteDB) tables() (map[string]*sqliteTable, error) {
+	// sqlite_schema is rooted at page 1 with columns type, name, tbl_name, rootpage, sql
+	tables := make(map[string]*sqliteTable)
+	cursor := db.scan(1)
+	for {
+		_, values, err := cursor.next()
+		if errors.Is(err, io.EOF) {
+			return tables, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema: %w", err)
+		}
+		if len(values) < 5 || values[0] != "table" {
+			continue
+		}
+
+		name, _ := values[1].(string)
+		rootPage, _ := values[3].(int64)
+		sql, _ := values[4].(string)
+		columns, rowidColumn, err := parseCreateTable(sql)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse schema of table %q: %w", name, err)
+		}
+		tables[strings.ToLower(name)] = &sqliteTable{
+			name:        name,
+			rootPage:    int(rootPage),
+			columns:     columns,
+			rowidColumn: rowidColumn,
+		}
+	}
+}
+
+// rows reads all rows of a table as maps from column name to value
+func (db *sqliteDB) rows(table *sqliteTable) ([]map[string]any, error) {
+	var rows []map[string]any
+	cursor := db.scan(table.rootPage)
+	for {
+		rowid, values, err := cursor.next()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, table.row(rowid, values))
+	}
+}
+
+// row maps the values of a record to the table columns
+func (t *sqliteTable) row(rowid int64, values []any) map[string]any {
+	row := make(map[string]any, len(t.columns))
+	for i, column := range t.columns {
+		var value any
+		if i < len(values) {
+			value = values[i]
+		}
+		if i == t.rowidColumn {
+			value = rowid
+		}
+		row[column.name] = value
+	}
+	return row
+}
+
+// sqliteCursor iterates over the rows of a table b-tree in rowid order
+type sqliteCursor struct {
+	db    *sqliteDB
+	stack []sqliteFrame
+	err   error
+}
+
+// sqliteFrame is a page being visited by a cursor
+type sqliteFrame struct {
+	page []byte
+	// header is the offset of the b-tree page header, 100 on page 1.
+	header int
+	// cell is the index of the next cell to visit.
+	cell int
+}
+
+// scan returns a cursor over the table b-tree rooted at rootPage
+func (db *sqliteDB) scan(rootPage int) *sqliteCursor {
+	cursor := &sqliteCursor{db: db}
+	cursor.err = cursor.push(rootPage)
+	return cursor
+}
+
+// push descends into a page
+func (c *sqliteCursor) push(number int) error {
+	if len(c.stack) > 64 {
+		return errors.New("b-tree is too deep, the database may be corrupt")
+	}
+	page, err := c.db.page(number)
+	if err != nil {
+		return err
+	}
+	header := 0
+	if number == 1 {
+		header = 100
+	}
+	if page[header] != sqliteInteriorTable && page[header] != sqliteLeafTable {
+		return fmt.Errorf("page %d is not a table b-tree page", number)
+	}
+	c.stack = append(c.stack, sqliteFrame{page: page, header: header})
+	return nil
+}
+
+// next returns the rowid and values of the next row, or io.EOF
+func (c *sqliteCursor) next() (int64, []any, error) {
+	for c.err == nil {
+		if len(c.stack) == 0 {
+			return 0, nil, io.EOF
+		}
+
+		frame := &c.stack[len(c.stack)-1]
+		page, header := frame.page, frame.header
+		cells := int(binary.BigEndian.Uint16(page[header+3:]))
+
+		if page[header] == sqliteLeafTable {
+			if frame.cell >= cells {
+				c.stack = c.stack[:len(c.stack)-1]
+				continue
+			}
+			pointer := int(binary.BigEndian.Uint16(page[header+8+2*frame.cell:]))
+			frame.cell++
+			return c.db.leafCell(page, pointer)
+		}
+
+		// Interior pages list their children in cells, followed by the right-most pointer
+		var child int
+		switch {
+		case frame.cell < cells:
+			pointer := int(binary.BigEndian.Uint16(page[header+12+2*frame.cell:]))
+			child = int(binary.BigEndian.Uint32(page[pointer:]))
+		case frame.cell == cells:
+			child = int(binary.BigEndian.Uint32(page[header+8:]))
+		default:
+			c.stack = c.stack[:len(c.stack)-1]
+			continue
+		}
+		frame.cell++
+		c.err = c.push(child)
+	}
+	return 0, nil, c.err
+}
+
+// leafCell decodes the table leaf cell at offset
+func (db *sqliteDB) leafCell(page []byte, offset int) (int64, []any, error) {
+	payloadSize, n := sqliteVarint(page[offset:])
+	offset += n
+	rowid, n := sqliteVarint(page[offset:])
+	offset += n
+
+	payload, err := db.payload(page, offset, int(payloadSize))
+	if err != nil {
+		return 0, nil, err
+	}
+	values, err := sqliteRecord(payload)
+	if err != nil {
+		return 0, nil, fmt.Errorf("row %d: %w", rowid, err)
+	}
+	return int64(rowid), values, nil
+}
+
+// payload assembles a cell payload, following its overflow pages
+func (db *sqliteDB) payload(page []byte, offset, size int) ([]byte, error) {
+	maxLocal := db.usable - 35
+	local := size
+	if size > maxLocal {
+		minLocal := (db.usable-12)*32/255 - 23
+		local = minLocal + (size-minLocal)%(db.usable-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+	if offset+local > len(page) {
+		return nil, errors.New("cell extends beyond its page")
+	}
+
+	payload := make([]byte, 0, size)
+	payload = append(payload, page[offset:offset+local]...)
+	if local == size {
+		return payload, nil
+	}
+
+	next := int(binary.BigEndian.Uint32(page[offset+local:]))
+	for len(payload) < size {
+		if next == 0 {
+			return nil, errors.New("overflow chain ends early")
+		}
+		overflow, err := db.page(next)
+		if err != nil {
+			return nil, err
+		}
+		next = int(binary.BigEndian.Uint32(overflow))
+		chunk := overflow[4:db.usable]
+		if remaining := size - len(payload); len(chunk) > remaining {
+			chunk = chunk[:remaining]
+		}
+		payload = append(payload, chunk...)
+	}
+	return payload, nil
+}
+
+// sqliteRecord decodes a record into int64, float64, string, []byte or nil values
+func sqliteRecord(payload []byte) ([]any, error) {
+	headerSize, n := sqliteVarint(payload)
+	if int(headerSize) > len(payload) || n == 0 {
+		return nil, errors.New("invalid record header")
+	}
+
+	var values []any
+	header := payload[n:headerSize]
+	body := payload[headerSize:]
+	for len(header) > 0 {
+		serialType, n := sqliteVarint(header)
+		header = header[n:]
+
+		size := sqliteSerialSize(serialType)
+		if size > len(body) {
+			return nil, errors.New("record value extends beyond the record")
+		}
+		data := body[:size]
+		body = body[size:]
+
+		switch {
+		case serialType == 0:
+			values = append(values, nil)
+		case serialType >= 1 && serialType <= 6:
+			// Big-endian two's complement integers of 1, 2, 3, 4, 6 or 8 bytes
+			value := int64(int8(data[0]))
+			for _, b := range data[1:] {
+				value = value<<8 | int64(b)
+			}
+			values = append(values, value)
+		case serialType == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(data)))
+		case serialType == 8:
+			values = append(values, int64(0))
+		case serialType == 9:
+			values = append(values, int64(1))
+		case serialType >= 12 && serialType%2 == 0:
+			values = append(values, append([]byte(nil), data...))
+		case serialType >= 13:
+			values = append(values, string(data))
+		default:
+			return nil, fmt.Errorf("invalid serial type %d", serialType)
+		}
+	}
+	return values, nil
+}
+
+// sqliteSerialSize returns the size of a value of a serial type
+func sqliteSerialSize(serialType uint64) int {
+	switch {
+	case serialType >= 12:
+		return int((serialType - 12) / 2)
+	case serialType == 5:
+		return 6
+	case serialType == 6, serialType == 7:
+		return 8
+	case serialType >= 1 && serialType <= 4:
+		return int(serialType)
+	default:
+		return 0
+	}
+}
+
+// sqliteVarint decodes a SQLite variable-length integer and returns it with its length
+func sqliteVarint(data []byte) (uint64, int) {
+	var value uint64
+	for i := 0; i < 9 && i < len(data); i++ {
+		if i == 8 {
+			return value<<8 | uint64(data[i]), 9
+		}
+		value = value<<7 | uint64(data[i]&0x7f)
+		if data[i] < 0x80 {
+			return value, i + 1
+		}
+	}
+	return value, len(data)
+}
+
+// parseCreateTable extracts the columns of a CREATE TABLE statement and the index of
+// the INTEGER PRIMARY KEY column, or -1
+func parseCreateTable(sql string) ([]sqliteColumn, int, error) {
+	open := strings.Index(sql, "(")
+	closing := strings.LastIndex(sql, ")")
+	if open < 0 || closing < open {
+		return nil, -1, errors.New("no column definitions")
+	}
+	if strings.Contains(strings.ToUpper(sql[closing:]), "WITHOUT ROWID") {
+		return nil, -1, errors.New("WITHOUT ROWID tables are not supported")
+	}
+
+	var columns []sqliteColumn
+	rowidColumn := -1
+	primaryKey := ""
+	for _, definition := range splitTopLevel(sql[open+1 : closing]) {
+		tokens := sqlTokens(definition)
+		if len(tokens) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(tokens[0]) {
+		case "CONSTRAINT", "PRIMARY", "UNIQUE", "CHECK", "FOREIGN":
+			// A table constraint; PRIMARY KEY (column) may alias the rowid
+			upper := strings.ToUpper(strings.Join(tokens, " "))
+			if strings.HasPrefix(upper, "PRIMARY KEY (") || strings.Contains(upper, " PRIMARY KEY (") {
+				keys := tokens[len(tokens)-1]
+				for i, token := range tokens {
+					if token == "(" && i+2 < len(tokens) && tokens[i+2] == ")" {
+						keys = tokens[i+1]
+					}
+				}
+				primaryKey = unquoteIdentifier(keys)
+			}
+			continue
+		}
+
+		column := sqliteColumn{name: unquoteIdentifier(tokens[0])}
+		var typeTokens []string
+		for _, token := range tokens[1:] {
+			upper := strings.ToUpper(token)
+			if upper == "PRIMARY" || upper == "NOT" || upper == "NULL" || upper == "UNIQUE" ||
+				upper == "CHECK" || upper == "DEFAULT" || upper == "COLLATE" || upper == "REFERENCES" ||
+				upper == "CONSTRAINT" || upper == "GENERATED" || upper == "AS" || upper == "(" {
+				break
+			}
+			typeTokens = append(typeTokens, upper)
+		}
+		column.declType = strings.Join(typeTokens, " ")
+		if column.declType == "INTEGER" && strings.Contains(strings.ToUpper(strings.Join(tokens, " ")), "PRIMARY KEY") {
+			rowidColumn = len(columns)
+		}
+		columns = append(columns, column)
+	}
+
+	if rowidColumn < 0 && primaryKey != "" {
+		for i, column := range columns {
+			if strings.EqualFold(column.name, primaryKey) && column.declType == "INTEGER" {
+				rowidColumn = i
+			}
+		}
+	}
+	return columns, rowidColumn, nil
+}
+
+// splitTopLevel splits column definitions on commas outside parentheses and quotes
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '[':
+			quote = ']'
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// sqlTokens splits a column definition into identifiers, quoted names and parentheses
+func sqlTokens(s string) []string {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == ',':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"' || c == '\'' || c == '`' || c == '[':
+			end := c
+			if c == '[' {
+				end = ']'
+			}
+			j := strings.IndexByte(s[i+1:], end)
+			if j < 0 {
+				return append(tokens, s[i:])
+			}
+			tokens = append(tokens, s[i:i+j+2])
+			i += j + 2
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(" \t\n\r(),", rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+// unquoteIdentifier removes the quotes around an SQL identifier
+func unquoteIdentifier(name string) string {
+	if len(name) >= 2 {
+		switch {
+		case name[0] == '"' && name[len(name)-1] == '"',
+			name[0] == '`' && name[len(name)-1] == '`',
+			name[0] == '\'' && name[len(name)-1] == '\'',
+			name[0] == '[' && name[len(name)-1] == ']':
+			return name[1 : len(name)-1]
+		}
+	}
+	return name
+}
@@ -0,0 +1,147 @@
+package gogeo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/encoding/thrift"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// WithSkipStatistics writes no min/max statistics for these columns, neither in the
+// footer nor in the page index, such as for JSON or long text columns whose bounds
+// bloat the footer and never prune a query. A column is a property, geometry or derived
+// column, all of whose fields are skipped for a struct column, or a field named by its
+// dotted path such as "bbox.xmin". Null counts are still written. Readers can no longer
+// skip row groups by the values of these columns, so keep the statistics of the columns
+// queries filter on, and of the bbox covering column.
+func WithSkipStatistics(columns ...string) Option {
+	return func(cfg *config) {
+		cfg.skipStatistics = append(cfg.skipStatistics, columns...)
+	}
+}
+
+// WithStatisticsTruncation truncates the min/max statistics of string and binary
+// columns, in the footer and in the page index, to at most this number of bytes. The
+// minimum is cut to its prefix and the maximum to its prefix incremented by one, so
+// that they still bound the values. Statistics of a few bytes are enough to prune row
+// groups by most string filters, while those of long values, such as WKB geometries,
+// inflate the footer that readers load before any data. 0 keeps them whole, as
+// parquet-go does in the footer, and 16 bytes in the page index.
+func WithStatisticsTruncation(bytes int) Option {
+	return func(cfg *config) {
+		cfg.statisticsLimit = bytes
+	}
+}
+
+// statisticsOptions returns the parquet-go options skipping and truncating the
+// statistics of the columns of a schema as configured
+func statisticsOptions(schema *parquet.Schema, cfg *config) ([]parquet.WriterOption, error) {
+	var opts []parquet.WriterOption
+	paths := schema.Columns()
+	skipped := slices.Clone(cfg.skipStatistics)
+	sort.Strings(skipped)
+	for _, name := range skipped {
+		found := false
+		for _, path := range paths {
+			if path[0] == name || strings.Join(path, ".") == name || strings.HasPrefix(strings.Join(path, "."), name+".") {
+				opts = append(opts, parquet.SkipPageBounds(path...))
+				found = true
+			}
+		}
+		if !found {
+			return nil, AppError{Message: fmt.Sprintf("cannot skip the statistics of %q, it is not a column", name)}
+		}
+	}
+	if cfg.statisticsLimit > 0 {
+		opts = append(opts, parquet.ColumnIndexSizeLimit(cfg.statisticsLimit))
+	}
+	return opts, nil
+}
+
+// truncatingWriter passes the output of a parquet-go writer writing without a buffer of
+// its own through a buffer, holding back the last write, which is then the footer, so
+// that the statistics it holds can be truncated
+type truncatingWriter struct {
+	buffer *bufio.Writer
+	last   []byte
+	limit  int
+}
+
+func newTruncatingWriter(w io.Writer, bufferSize, limit int) *truncatingWriter {
+	return &truncatingWriter{buffer: bufio.NewWriterSize(w, bufferSize), limit: limit}
+}
+
+func (w *truncatingWriter) Write(p []byte) (int, error) {
+	if _, err := w.buffer.Write(w.last); err != nil {
+		return 0, err
+	}
+	w.last = append(w.last[:0], p...)
+	return len(p), nil
+}
+
+// Close writes the footer with truncated statistics and flushes the buffer. It does
+// not close the underlying writer.
+func (w *truncatingWriter) Close() error {
+	footer := w.last
+	if len(footer) < 8 || string(footer[len(footer)-4:]) != parquetMagic ||
+		int(binary.LittleEndian.Uint32(footer[len(footer)-8:])) != len(footer)-8 {
+		return AppError{Message: "unexpected end of the Parquet output, expected its footer"}
+	}
+	var metadata format.FileMetaData
+	if err := thrift.Unmarshal(new(thrift.CompactProtocol), footer[:len(footer)-8], &metadata); err != nil {
+		return AppError{Message: "failed to decode Parquet footer", Value: err}
+	}
+	for i := range metadata.RowGroups {
+		for j := range metadata.RowGroups[i].Columns {
+			column := &metadata.RowGroups[i].Columns[j].MetaData
+			if column.Type == format.ByteArray {
+				truncateStatistics(&column.Statistics, w.limit)
+			}
+		}
+	}
+	if err := writeFooter(w.buffer, &metadata); err != nil {
+		return err
+	}
+	return w.buffer.Flush()
+}
+
+// truncateStatistics truncates the min/max statistics of a byte array column chunk to
+// at most limit bytes
+func truncateStatistics(statistics *format.Statistics, limit int) {
+	statistics.Min = truncateMin(statistics.Min, limit)
+	statistics.MinValue = truncateMin(statistics.MinValue, limit)
+	statistics.Max = truncateMax(statistics.Max, limit)
+	statistics.MaxValue = truncateMax(statistics.MaxValue, limit)
+}
+
+// truncateMin returns the prefix of a minimum of at most limit bytes
+func truncateMin(value []byte, limit int) []byte {
+	if len(value) <= limit {
+		return value
+	}
+	return value[:limit]
+}
+
+// truncateMax returns the smallest value of at most limit bytes greater than a maximum,
+// its prefix with the last byte below 0xFF incremented, or the maximum itself if its
+// prefix only holds 0xFF bytes
+func truncateMax(value []byte, limit int) []byte {
+	if len(value) <= limit {
+		return value
+	}
+	truncated := slices.Clone(value[:limit])
+	for i := len(truncated) - 1; i >= 0; i-- {
+		if truncated[i] != 0xFF {
+			truncated[i]++
+			return truncated[:i+1]
+		}
+	}
+	return value
+}
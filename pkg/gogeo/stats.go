@@ -0,0 +1,313 @@
+package gogeo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb/geojson"
+)
+
+// maxDistinctValues bounds the memory used to count the distinct values of a property
+const maxDistinctValues = 100000
+
+// Stats summarizes the features of a file.
+type Stats struct {
+	// Number of features.
+	Features int64 `json:"features"`
+	// Number of features of each geometry type, e.g. {"Point": 12, "Polygon Z": 3};
+	// features without a geometry are counted as "null".
+	GeometryTypes map[string]int64 `json:"geometry_types"`
+	// Total number of positions of all geometries.
+	Vertices int64 `json:"vertices"`
+	// Bounding box of all geometries as [xmin, ymin, xmax, ymax], nil if there are none.
+	// As in the GeoParquet metadata, geographic geometries on both sides of the
+	// antimeridian get a bbox crossing it, with xmin > xmax.
+	BBox []float64 `json:"bbox"`
+	// Statistics of each property, sorted by name.
+	Properties []PropertyStats `json:"properties"`
+}
+
+// PropertyStats summarizes the values of a property.
+type PropertyStats struct {
+	Name string `json:"name"`
+	// JSON type of the values: "number", "string", "boolean", "object", "array",
+	// "geometry", "mixed" if they differ, or "null" if all are null.
+	Type string `json:"type"`
+	// Number of features where the property is null or missing.
+	Nulls int64 `json:"nulls"`
+	// Number of distinct non-null values.
+	Distinct int64 `json:"distinct"`
+	// DistinctCapped reports that counting stopped at 100000 distinct values, so
+	// Distinct is a lower bound.
+	DistinctCapped bool `json:"distinct_capped,omitempty"`
+	// Smallest and largest value of number, string and boolean properties.
+	Min any `json:"min,omitempty"`
+	Max any `json:"max,omitempty"`
+}
+
+// ComputeStats reads the remaining features of reader and summarizes them. Only the
+// distinct values of each property are held in memory.
+func ComputeStats(ctx context.Context, reader FeatureReader) (*Stats, error) {
+	return computeStats(ctx, reader, nil, nil)
+}
+
+// GeoParquetStats summarizes the rows of GeoParquet of the given size read from r.
+// Columns that are null in every row are listed as properties of type "null".
+func GeoParquetStats(ctx context.Context, r io.ReaderAt, size int64) (*Stats, error) {
+	reader, err := newGeoParquetReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var columns []string
+	for _, path := range reader.decoder.columns {
+		// Columns nested in a struct column are fields of its objects
+		name := path[0]
+		if reader.decoder.skip[name] || name == reader.decoder.geoMeta.PrimaryColumn || slices.Contains(columns, name) {
+			continue
+		}
+		columns = append(columns, name)
+	}
+	geoMeta := reader.decoder.geoMeta
+	return computeStats(ctx, reader, columns, geoMeta.Columns[geoMeta.PrimaryColumn].CRS)
+}
+
+// GeoJSONStats summarizes a FeatureCollection (FormatGeoJSON) or one Feature per line
+// (FormatGeoJSONL) streamed from r.
+func GeoJSONStats(ctx context.Context, r io.Reader, format string) (*Stats, error) {
+	format, err := normalizeFormat(format)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatGeoJSON:
+		return ComputeStats(ctx, NewGeoJSONDecoder(r))
+	case FormatGeoJSONL:
+		return ComputeStats(ctx, NewGeoJSONSeqDecoder(r))
+	default:
+		return nil, AppError{Message: fmt.Sprintf("cannot compute statistics of %q input, expected geojson or geojsonl", format)}
+	}
+}
+
+// computeStats summarizes the features of reader, listing the given properties even
+// if they never have a value. The geometries are bounded in crs, geographic if nil.
+func computeStats(ctx context.Context, reader FeatureReader, properties []string, crs json.RawMessage) (*Stats, error) {
+	stats := &Stats{GeometryTypes: make(map[string]int64)}
+	accumulators := make(map[string]*propertyAccumulator)
+	for _, name := range properties {
+		accumulators[name] = newPropertyAccumulator()
+	}
+
+	// The bbox is built like the one of the GeoParquet metadata
+	geometries := &columnStats{geomTypes: make(map[string]bool)}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		feature, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		stats.Features++
+
+		if feature.Geometry == nil {
+			stats.GeometryTypes["null"]++
+		} else {
+			stats.GeometryTypes[geometryTypeName(feature.Geometry)]++
+			if vertices := countPositions(feature.Geometry); vertices > 0 {
+				stats.Vertices += int64(vertices)
+				geometries.add(feature.Geometry)
+			}
+		}
+
+		for name, value := range feature.Properties {
+			if value == nil {
+				continue
+			}
+			accumulator, ok := accumulators[name]
+			if !ok {
+				accumulator = newPropertyAccumulator()
+				accumulators[name] = accumulator
+			}
+			accumulator.add(value)
+		}
+	}
+
+	stats.BBox = geometries.build("", crs).BBox
+
+	stats.Properties = make([]PropertyStats, 0, len(accumulators))
+	for name, accumulator := range accumulators {
+		stats.Properties = append(stats.Properties, accumulator.build(name, stats.Features))
+	}
+	sort.Slice(stats.Properties, func(i, j int) bool {
+		return stats.Properties[i].Name < stats.Properties[j].Name
+	})
+	return stats, nil
+}
+
+// propertyAccumulator collects the statistics of the values of a property
+type propertyAccumulator struct {
+	count    int64
+	kind     string
+	distinct map[string]bool
+	capped   bool
+	min, max any
+}
+
+func newPropertyAccumulator() *propertyAccumulator {
+	return &propertyAccumulator{distinct: make(map[string]bool)}
+}
+
+// add records a non-null value
+func (a *propertyAccumulator) add(value any) {
+	a.count++
+	a.addKind(value)
+
+	if key := distinctKey(value); !a.distinct[key] {
+		if len(a.distinct) < maxDistinctValues {
+			a.distinct[key] = true
+		} else {
+			a.capped = true
+		}
+	}
+
+	if a.kind == "mixed" {
+		a.min, a.max = nil, nil
+		return
+	}
+	if a.min == nil || compareValues(value, a.min) < 0 {
+		a.min = value
+	}
+	if a.max == nil || compareValues(value, a.max) > 0 {
+		a.max = value
+	}
+}
+
+// addKind records the JSON type of a non-null value
+func (a *propertyAccumulator) addKind(value any) {
+	kind := valueKind(value)
+	switch a.kind {
+	case "":
+		a.kind = kind
+	case kind:
+	default:
+		a.kind = "mixed"
+	}
+}
+
+// build returns the statistics of the property given the number of features
+func (a *propertyAccumulator) build(name string, features int64) PropertyStats {
+	stats := PropertyStats{
+		Name:           name,
+		Type:           a.kind,
+		Nulls:          features - a.count,
+		Distinct:       int64(len(a.distinct)),
+		DistinctCapped: a.capped,
+	}
+	if stats.Type == "" {
+		stats.Type = "null"
+	}
+	switch stats.Type {
+	case "number", "string", "boolean":
+		stats.Min, stats.Max = a.min, a.max
+	}
+	return stats
+}
+
+// valueKind returns the JSON type of a property value
+func valueKind(value any) string {
+	switch value.(type) {
+	case float64, float32, int, int32, int64, uint64, json.Number:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case []any:
+		return "array"
+	case *geojson.Geometry:
+		return "geometry"
+	default:
+		return "object"
+	}
+}
+
+// distinctKey returns a string identifying a value, equal for equal values
+func distinctKey(value any) string {
+	switch v := value.(type) {
+	case string:
+		return "s" + v
+	case bool:
+		return "b" + strconv.FormatBool(v)
+	}
+	if number, ok := toFloat(value); ok {
+		return "n" + strconv.FormatFloat(number, 'g', -1, 64)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%T%v", value, value)
+	}
+	return "j" + string(data)
+}
+
+// compareValues orders two values of the same kind
+func compareValues(a, b any) int {
+	switch a := a.(type) {
+	case string:
+		return strings.Compare(a, b.(string))
+	case bool:
+		switch {
+		case a == b.(bool):
+			return 0
+		case a:
+			return 1
+		default:
+			return -1
+		}
+	}
+	x, okA := toFloat(a)
+	y, okB := toFloat(b)
+	if !okA || !okB || x == y || math.IsNaN(x) || math.IsNaN(y) {
+		return 0
+	}
+	if x < y {
+		return -1
+	}
+	return 1
+}
+
+// toFloat converts a numeric property value to a float64
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		number, err := v.Float64()
+		return number, err == nil
+	}
+	return 0, false
+}
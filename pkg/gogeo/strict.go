@@ -0,0 +1,148 @@
+package gogeo
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxTypeConflicts is the number of type conflicts listed; further ones are only counted
+const maxTypeConflicts = 1000
+
+// WithStrictTypes fails the conversion with a TypeConflictError listing the property
+// values whose type conflicts with that of their column, such as a string in an integer
+// column, instead of promoting the column to string, so that data quality problems
+// surface at conversion time. The type of a column is that of its first value. Integers
+// and floats still widen to floats, dates to timestamps, objects and arrays to JSON, and
+// strings parsed as timestamps, dates or UUIDs mixed with other strings to strings.
+func WithStrictTypes() Option {
+	return func(cfg *config) {
+		cfg.strictTypes = true
+	}
+}
+
+// TypeConflict is a property value whose type conflicts with that of its column,
+// reported by WithStrictTypes.
+type TypeConflict struct {
+	// Index of the feature among those converted, starting at 1.
+	Feature int `json:"feature"`
+	// Identifier of the feature, if it has one.
+	ID any `json:"id,omitempty"`
+	// Column of the value. The fields of struct columns are named by their dotted path
+	// and the elements of list columns as column.element.
+	Column string `json:"column"`
+	// Type of the column, inferred from the previous values.
+	Type PropertyType `json:"type"`
+	// Type of the value.
+	Conflict PropertyType `json:"conflict"`
+	Value    any          `json:"value"`
+}
+
+// TypeConflictError is the error of a conversion with WithStrictTypes whose input holds
+// type conflicts.
+type TypeConflictError struct {
+	// Conflicts found, in input order, up to the first 1000.
+	Conflicts []TypeConflict `json:"conflicts"`
+	// Number of conflicts found beyond those listed.
+	Omitted int `json:"omitted,omitempty"`
+	// Columns holding conflicts, sorted by name.
+	Columns []string `json:"columns"`
+}
+
+func (e *TypeConflictError) Error() string {
+	first := e.Conflicts[0]
+	message := fmt.Sprintf("type conflicts in %s: feature %d has %s %s in %s column %q",
+		quoteColumns(e.Columns), first.Feature, first.Conflict, formatConflictValue(first.Value), first.Type, first.Column)
+	if more := len(e.Conflicts) - 1 + e.Omitted; more > 0 {
+		message += fmt.Sprintf(", and %d more", more)
+	}
+	return message
+}
+
+// quoteColumns returns a list of column names for a message
+func quoteColumns(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = fmt.Sprintf("%q", column)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// formatConflictValue returns the JSON text of a conflicting value
+func formatConflictValue(value any) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// typeConflicts collects the type conflicts of an analysis and its struct fields
+type typeConflicts struct {
+	// feature is the index of the feature analyzed, and id its identifier.
+	feature int
+	id      any
+	err     TypeConflictError
+	columns map[string]bool
+}
+
+// add records the conflict of a value of the feature analyzed
+func (c *typeConflicts) add(column string, columnType, valueType PropertyType, value any) {
+	if c.columns == nil {
+		c.columns = make(map[string]bool)
+	}
+	c.columns[column] = true
+	if len(c.err.Conflicts) == maxTypeConflicts {
+		c.err.Omitted++
+		return
+	}
+	c.err.Conflicts = append(c.err.Conflicts, TypeConflict{
+		Feature:  c.feature,
+		ID:       c.id,
+		Column:   column,
+		Type:     columnType,
+		Conflict: valueType,
+		Value:    value,
+	})
+}
+
+// error returns the TypeConflictError of the conflicts found, nil if there are none
+func (c *typeConflicts) error() error {
+	if c == nil || len(c.err.Conflicts) == 0 {
+		return nil
+	}
+	err := c.err
+	// The properties of a feature are analyzed in no particular order
+	sort.SliceStable(err.Conflicts, func(i, j int) bool {
+		a, b := err.Conflicts[i], err.Conflicts[j]
+		return a.Feature < b.Feature || a.Feature == b.Feature && a.Column < b.Column
+	})
+	for column := range c.columns {
+		err.Columns = append(err.Columns, column)
+	}
+	sort.Strings(err.Columns)
+	return &err
+}
+
+// isTypeConflict reports whether a column of a type holding a value of another is
+// promoted to string, from values that are not all strings
+func isTypeConflict(columnType, valueType PropertyType) bool {
+	if columnType == PropertyTypeNull || valueType == PropertyTypeNull {
+		return false
+	}
+	if widenPropertyType(columnType, valueType) != PropertyTypeString {
+		return false
+	}
+	return !isTextual(columnType) || !isTextual(valueType)
+}
+
+// isTextual reports whether a property type is inferred from strings
+func isTextual(propType PropertyType) bool {
+	switch propType {
+	case PropertyTypeString, PropertyTypeTimestamp, PropertyTypeDate, PropertyTypeUUID:
+		return true
+	default:
+		return false
+	}
+}
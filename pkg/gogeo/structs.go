@@ -1,5 +1,7 @@
 package gogeo
 
+import "encoding/json"
+
 // GeoParquetRecord represents a single record in a GeoParquet file
 type GeoParquetRecord struct {
 	Geometry []byte  `parquet:"geometry"`
@@ -18,12 +20,37 @@ type GeoParquet struct {
 
 // GeoParquetColumn represents metadata for a geometry column
 type GeoParquetColumn struct {
-	// Encoding type (e.g., WKB).
+	// Encoding type (WKB or WKT).
 	Encoding string `json:"encoding"`
 	// List of geometry types (e.g., ["Point"], ["LineString"], etc.).
 	GeometryTypes []string `json:"geometry_types"`
-	// Coordinate reference system (can be null for WGS84/EPSG:4326).
-	CRS *string `json:"crs,omitempty"`
+	// Coordinate reference system as a PROJJSON object (OGC:CRS84 when omitted).
+	CRS json.RawMessage `json:"crs,omitempty"`
+	// Bounding box of all geometries in the column ([xmin, ymin, xmax, ymax]).
+	BBox []float64 `json:"bbox,omitempty"`
+	// Winding order of polygon rings, "counterclockwise" for counterclockwise exterior
+	// rings and clockwise holes, or empty if unspecified.
+	Orientation string `json:"orientation,omitempty"`
+	// Columns covering the geometry column (GeoParquet 1.1).
+	Covering *GeoParquetCovering `json:"covering,omitempty"`
+}
+
+// GeoParquetCovering describes columns that can be used to filter a geometry column without decoding it
+type GeoParquetCovering struct {
+	// Per-row bounding box struct column.
+	BBox *GeoParquetBBoxCovering `json:"bbox,omitempty"`
+}
+
+// GeoParquetBBoxCovering holds the paths of the bounding box fields
+type GeoParquetBBoxCovering struct {
+	// Path to the minimum x field (e.g., ["bbox", "xmin"]).
+	Xmin []string `json:"xmin"`
+	// Path to the minimum y field.
+	Ymin []string `json:"ymin"`
+	// Path to the maximum x field.
+	Xmax []string `json:"xmax"`
+	// Path to the maximum y field.
+	Ymax []string `json:"ymax"`
 }
 
 // GeoParquetProperty represents metadata for a property column (not used in actual schema)
@@ -35,3 +62,25 @@ type GeoParquetProperty struct {
 	// Indicates if the property can have null values.
 	Nullable bool `json:"nullable"`
 }
+
+// Report summarizes the result of a conversion
+type Report struct {
+	// Number of features written.
+	Features int `json:"features"`
+	// Property columns inferred from the input.
+	Properties []PropertyInfo `json:"properties"`
+	// GeoParquet metadata written to the file.
+	Metadata *GeoParquet `json:"metadata"`
+	// Number of geometries repaired with WithMakeValid.
+	Repaired int `json:"repaired,omitempty"`
+	// Number of geometries WithMakeValid could not repair, written as they are.
+	Unrepaired int `json:"unrepaired,omitempty"`
+	// Geometries WithMakeValid could not repair, up to the first 1000.
+	Invalid []InvalidGeometry `json:"invalid,omitempty"`
+	// Number of features without a geometry left out with WithNullGeometries.
+	Skipped int `json:"skipped,omitempty"`
+	// Number of features written with an empty geometry.
+	Empty int `json:"empty,omitempty"`
+	// Number of features with an empty geometry left out with WithEmptyGeometries.
+	Dropped int `json:"dropped,omitempty"`
+}
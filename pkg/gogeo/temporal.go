@@ -0,0 +1,279 @@
+package gogeo
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go/format"
+	"github.com/paulmach/orb/geojson"
+)
+
+// Range of the numbers taken for milliseconds since the Unix epoch by
+// WithTemporalInference, from 2000-01-01 to 2100-01-01, so that counts and ids are not
+// taken for timestamps
+const (
+	minEpochMillis = 946684800000
+	maxEpochMillis = 4102444800000
+)
+
+// propertyTypeEpochMillis is the type inferred for numbers that could be milliseconds
+// since the epoch. It becomes a timestamp unless the column holds other numbers.
+const propertyTypeEpochMillis PropertyType = -1
+
+// secondsPerDay is the number of seconds of a day of a DATE column
+const secondsPerDay = 24 * 60 * 60
+
+// WithTemporalInference writes string properties holding RFC 3339 timestamps, such as
+// "2024-05-01T12:00:00Z", as TIMESTAMP columns in microseconds adjusted to UTC, and
+// those holding dates, such as "2024-05-01", as DATE columns, so that temporal
+// predicates work downstream. Numbers between 2000 and 2100 in milliseconds since the
+// Unix epoch, such as 1714564800000, are written as timestamps too. A column mixing
+// timestamps and dates is written as timestamps; mixing them with other values, as
+// before.
+func WithTemporalInference() Option {
+	return func(cfg *config) {
+		cfg.inferTemporal = true
+	}
+}
+
+// WithDatetimeFormats parses string properties in these layouts, written in the
+// notation of the time package such as "02/01/2006 15:04" or "Jan 2, 2006", so that
+// timestamps and dates that are not in RFC 3339 are written as TIMESTAMP columns, or as
+// DATE columns for layouts without a time of day. The layouts are tried in order, and
+// times without a zone are taken in UTC. It implies WithTemporalInference.
+func WithDatetimeFormats(layouts ...string) Option {
+	return func(cfg *config) {
+		for _, layout := range layouts {
+			parsed, err := newDatetimeLayout(layout)
+			if err != nil {
+				cfg.fail(err)
+				return
+			}
+			cfg.datetimeFormats = append(cfg.datetimeFormats, parsed)
+		}
+		cfg.inferTemporal = true
+	}
+}
+
+// WithDatetimeColumn writes a property column as a TIMESTAMP column, or as a DATE
+// column for a layout without a time of day, parsing its strings with layout. An empty
+// layout parses them with the layouts of WithDatetimeFormats and as RFC 3339. The column
+// is named after renaming, like those of WithCast.
+func WithDatetimeColumn(column, layout string) Option {
+	return func(cfg *config) {
+		if column == "" {
+			cfg.fail(AppError{Message: "datetime column name must not be empty"})
+			return
+		}
+		parsed := datetimeLayout{}
+		if layout != "" {
+			var err error
+			if parsed, err = newDatetimeLayout(layout); err != nil {
+				cfg.fail(err)
+				return
+			}
+		}
+		if cfg.datetimeColumns == nil {
+			cfg.datetimeColumns = make(map[string]datetimeLayout)
+		}
+		cfg.datetimeColumns[column] = parsed
+		propType := PropertyTypeTimestamp
+		if parsed.date {
+			propType = PropertyTypeDate
+		}
+		WithCast(column, propType)(cfg)
+	}
+}
+
+// datetimeLayout is a layout of the time package parsing property strings
+type datetimeLayout struct {
+	layout string
+	// date is whether the layout has no time of day.
+	date bool
+}
+
+// newDatetimeLayout checks that a layout holds at least a year, by parsing the
+// reference time formatted with it, and whether it holds a time of day
+func newDatetimeLayout(layout string) (datetimeLayout, error) {
+	reference := time.Date(2006, time.January, 2, 15, 4, 5, 0, time.UTC)
+	t, err := time.Parse(layout, reference.Format(layout))
+	if err != nil || t.Year() != reference.Year() {
+		return datetimeLayout{}, AppError{Message: fmt.Sprintf("invalid datetime format %q, expected a layout of the reference time such as \"02/01/2006 15:04\"", layout)}
+	}
+	return datetimeLayout{layout: layout, date: t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0}, nil
+}
+
+// datetimeReader rewrites the property strings matching the configured layouts as
+// RFC 3339 timestamps and dates, which the schema inference and conversion understand
+type datetimeReader struct {
+	reader  FeatureReader
+	layouts []datetimeLayout
+	// columns holds the layout of the properties parsed with their own.
+	columns map[string]datetimeLayout
+}
+
+func (r *datetimeReader) Next() (*geojson.Feature, error) {
+	feature, err := r.reader.Next()
+	if err != nil {
+		return nil, err
+	}
+	var properties geojson.Properties
+	for name, value := range feature.Properties {
+		text, ok := value.(string)
+		if !ok {
+			continue
+		}
+		layouts := r.layouts
+		if column, ok := r.columns[name]; ok && column.layout != "" {
+			layouts = []datetimeLayout{column}
+		}
+		normalized, ok := normalizeDatetime(text, layouts)
+		if !ok {
+			continue
+		}
+		if properties == nil {
+			properties = maps.Clone(feature.Properties)
+		}
+		properties[name] = normalized
+	}
+	if properties == nil {
+		return feature, nil
+	}
+	// Copy the feature, which buffered inputs read more than once
+	parsed := *feature
+	parsed.Properties = properties
+	return &parsed, nil
+}
+
+// normalizeDatetime returns the RFC 3339 timestamp or the date of a string in the
+// first of the layouts it matches
+func normalizeDatetime(text string, layouts []datetimeLayout) (string, bool) {
+	text = strings.TrimSpace(text)
+	for _, layout := range layouts {
+		t, err := time.Parse(layout.layout, text)
+		if err != nil {
+			continue
+		}
+		if layout.date {
+			return t.Format(time.DateOnly), true
+		}
+		return t.Format(time.RFC3339Nano), true
+	}
+	return "", false
+}
+
+// inferTemporalType returns the temporal type of a property value, or
+// PropertyTypeUnknown if it is not a timestamp or a date
+func inferTemporalType(value any) PropertyType {
+	switch v := value.(type) {
+	case string:
+		if _, ok := parseDate(v); ok {
+			return PropertyTypeDate
+		}
+		if _, ok := parseTimestamp(v); ok {
+			return PropertyTypeTimestamp
+		}
+	case float64:
+		if v == math.Trunc(v) && v >= minEpochMillis && v < maxEpochMillis {
+			return propertyTypeEpochMillis
+		}
+	case int64:
+		if v >= minEpochMillis && v < maxEpochMillis {
+			return propertyTypeEpochMillis
+		}
+	}
+	return PropertyTypeUnknown
+}
+
+// widenTemporalType returns the type of a column holding values of two types, one of
+// them temporal, and whether it applies
+func widenTemporalType(existingType, inferredType PropertyType) (PropertyType, bool) {
+	temporal := func(propType PropertyType) bool {
+		return propType == PropertyTypeTimestamp || propType == PropertyTypeDate || propType == propertyTypeEpochMillis
+	}
+	switch {
+	case existingType == propertyTypeEpochMillis && isNumeric(inferredType):
+		return inferredType, true
+	case inferredType == propertyTypeEpochMillis && isNumeric(existingType):
+		return existingType, true
+	case temporal(existingType) && temporal(inferredType):
+		return PropertyTypeTimestamp, true
+	}
+	return PropertyTypeUnknown, false
+}
+
+// parseTimestamp parses an RFC 3339 timestamp
+func parseTimestamp(text string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(text))
+	return t, err == nil
+}
+
+// parseDate parses a date such as "2024-05-01"
+func parseDate(text string) (time.Time, bool) {
+	t, err := time.Parse(time.DateOnly, strings.TrimSpace(text))
+	return t, err == nil
+}
+
+// convertTimestamp converts a property value to the time of a TIMESTAMP column: an
+// RFC 3339 timestamp, a date at midnight UTC or milliseconds since the epoch
+func convertTimestamp(value any) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC(), nil
+	case string:
+		if t, ok := parseTimestamp(v); ok {
+			return t.UTC(), nil
+		}
+		if t, ok := parseDate(v); ok {
+			return t, nil
+		}
+		return time.Time{}, fmt.Errorf("cannot convert %q to %s", v, PropertyTypeTimestamp)
+	case float64:
+		return time.UnixMilli(int64(v)).UTC(), nil
+	case int64:
+		return time.UnixMilli(v).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("cannot convert %T to %s", value, PropertyTypeTimestamp)
+}
+
+// convertDate converts a property value to the days since the epoch of a DATE column.
+// Timestamps are taken at the date of their own time zone.
+func convertDate(value any) (int32, error) {
+	var t time.Time
+	switch v := value.(type) {
+	case string:
+		var ok bool
+		if t, ok = parseDate(v); !ok {
+			if t, ok = parseTimestamp(v); !ok {
+				return 0, fmt.Errorf("cannot convert %q to %s", v, PropertyTypeDate)
+			}
+		}
+	default:
+		var err error
+		if t, err = convertTimestamp(value); err != nil {
+			return 0, fmt.Errorf("cannot convert %T to %s", value, PropertyTypeDate)
+		}
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return int32(midnight.Unix() / secondsPerDay), nil //nolint:gosec
+}
+
+// timestampTime returns the time of a value of a TIMESTAMP column in unit
+func timestampTime(value int64, unit format.TimeUnit) time.Time {
+	switch {
+	case unit.Millis != nil:
+		return time.UnixMilli(value).UTC()
+	case unit.Micros != nil:
+		return time.UnixMicro(value).UTC()
+	default:
+		return time.Unix(0, value).UTC()
+	}
+}
+
+// formatDate returns the text of the days since the epoch of a DATE column
+func formatDate(days int32) string {
+	return time.Unix(int64(days)*secondsPerDay, 0).UTC().Format(time.DateOnly)
+}
@@ -0,0 +1,543 @@
+package gogeo
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/clip"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/orb/project"
+)
+
+// Vector tiles
+const (
+	// tileExtent is the size of a tile in tile coordinates.
+	tileExtent = 4096
+	// tileBuffer is the margin around a tile, in tile coordinates, within which
+	// geometries are kept, so that lines and polygon outlines do not show seams at the
+	// edges of the tiles.
+	tileBuffer = 64
+	// maxTileZoom is the highest zoom level served.
+	maxTileZoom = 24
+	// maxMercatorLatitude is the latitude of the edges of the Web Mercator square.
+	maxMercatorLatitude = 85.05112877980659
+	// DefaultTileLayer is the name of the layer of the tiles of a TileServer.
+	DefaultTileLayer = "features"
+	// mvtContentType is the media type of Mapbox Vector Tiles.
+	mvtContentType = "application/vnd.mapbox-vector-tile"
+)
+
+// Geometry types and commands of Mapbox Vector Tiles
+const (
+	mvtPoint      = 1
+	mvtLineString = 2
+	mvtPolygon    = 3
+
+	mvtMoveTo    = 1
+	mvtLineTo    = 2
+	mvtClosePath = 7
+)
+
+// TileOptions configures a TileServer.
+type TileOptions struct {
+	// Layer is the name of the layer of the tiles, DefaultTileLayer when empty.
+	Layer string
+	// MinZoom is the lowest zoom level served. The tiles of low zoom levels cover much
+	// of the file, and are slow to build for large ones.
+	MinZoom int
+}
+
+// TileServer is an http.Handler serving the features of a GeoParquet file as Mapbox
+// Vector Tiles at /{z}/{x}/{y}.mvt, and their TileJSON description at /tiles.json.
+// When the file has a bbox covering column, a tile only decodes the row groups whose
+// column statistics intersect it, so tiles of a spatially sorted file, e.g. written
+// with generate --spatial-sort hilbert --bbox-column, are served without reading most
+// of the file. The coordinates must be longitudes and latitudes.
+type TileServer struct {
+	pf       *parquet.File
+	geoMeta  *GeoParquet
+	covering *bboxCoveringColumns
+	options  TileOptions
+	// fields are the TileJSON types of the property columns.
+	fields map[string]string
+}
+
+// NewTileServer returns a TileServer over the GeoParquet file of the given size read
+// from r, which must remain open while the server runs.
+func NewTileServer(r io.ReaderAt, size int64, options TileOptions) (*TileServer, error) {
+	if options.MinZoom < 0 || options.MinZoom > maxTileZoom {
+		return nil, AppError{Message: fmt.Sprintf("invalid minimum zoom %d, expected 0 to %d", options.MinZoom, maxTileZoom)}
+	}
+	if options.Layer == "" {
+		options.Layer = DefaultTileLayer
+	}
+
+	pf, err := parquet.OpenFile(r, size, parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+	if err != nil {
+		return nil, AppError{Message: "failed to read GeoParquet file", Value: err}
+	}
+	geoMeta, err := readGeoMetadata(pf)
+	if err != nil {
+		return nil, err
+	}
+	if !geographicCRS(geoMeta.Columns[geoMeta.PrimaryColumn].CRS) {
+		return nil, AppError{Message: fmt.Sprintf("vector tiles need longitudes and latitudes, but the CRS of column %q is not geographic", geoMeta.PrimaryColumn)}
+	}
+	covering, err := bboxCovering(pf, geoMeta)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TileServer{pf: pf, geoMeta: geoMeta, covering: covering, options: options, fields: propertyFields(pf, geoMeta)}, nil
+}
+
+// propertyFields returns the types of the top-level property columns of a file, as
+// "Boolean", "Number" or "String"
+func propertyFields(pf *parquet.File, geoMeta *GeoParquet) map[string]string {
+	skip := coveringColumns(geoMeta)
+	fields := make(map[string]string)
+	for _, field := range pf.Schema().Fields() {
+		if _, ok := geoMeta.Columns[field.Name()]; ok || skip[field.Name()] || !field.Leaf() {
+			continue
+		}
+		switch field.Type().Kind() {
+		case parquet.Boolean:
+			fields[field.Name()] = "Boolean"
+		case parquet.Int32, parquet.Int64, parquet.Float, parquet.Double:
+			fields[field.Name()] = "Number"
+		default:
+			fields[field.Name()] = "String"
+		}
+	}
+	return fields
+}
+
+func (s *TileServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// Maps are usually served from another origin
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if strings.HasSuffix(req.URL.Path, "/tiles.json") {
+		s.serveTileJSON(w, req)
+		return
+	}
+	tile, ok := parseTilePath(req.URL.Path)
+	if !ok || int(tile.Z) < s.options.MinZoom {
+		http.NotFound(w, req)
+		return
+	}
+	data, err := s.Tile(req.Context(), tile)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", mvtContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+// parseTilePath parses the zoom level and coordinates of a tile from a path ending in
+// /{z}/{x}/{y}.mvt
+func parseTilePath(path string) (maptile.Tile, bool) {
+	path, ok := strings.CutSuffix(path, ".mvt")
+	if !ok {
+		return maptile.Tile{}, false
+	}
+	parts := strings.Split(path, "/")
+	if len(parts) < 3 {
+		return maptile.Tile{}, false
+	}
+	var values [3]int
+	for i, part := range parts[len(parts)-3:] {
+		value, err := strconv.Atoi(part)
+		if err != nil || value < 0 {
+			return maptile.Tile{}, false
+		}
+		values[i] = value
+	}
+	z, x, y := values[0], values[1], values[2]
+	if z > maxTileZoom || x >= 1<<z || y >= 1<<z {
+		return maptile.Tile{}, false
+	}
+	return maptile.New(uint32(x), uint32(y), maptile.Zoom(z)), true
+}
+
+// serveTileJSON writes the TileJSON description of the tiles, whose URL template is
+// relative to the requested one
+func (s *TileServer) serveTileJSON(w http.ResponseWriter, req *http.Request) {
+	base := baseURL(req) + strings.TrimSuffix(req.URL.Path, "tiles.json")
+	description := map[string]any{
+		"tilejson": "3.0.0",
+		"tiles":    []string{base + "{z}/{x}/{y}.mvt"},
+		"minzoom":  s.options.MinZoom,
+		"maxzoom":  maxTileZoom,
+		"vector_layers": []map[string]any{{
+			"id":     s.options.Layer,
+			"fields": s.fields,
+		}},
+	}
+	if bbox := s.geoMeta.Columns[s.geoMeta.PrimaryColumn].BBox; len(bbox) >= 4 {
+		half := len(bbox) / 2
+		description["bounds"] = []float64{bbox[0], bbox[1], bbox[half], bbox[half+1]}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(description)
+}
+
+// Tile returns a tile encoded as a Mapbox Vector Tile of one layer. A tile without
+// features is empty.
+func (s *TileServer) Tile(ctx context.Context, tile maptile.Tile) ([]byte, error) {
+	// Read the features within the buffer of the tile
+	bound := tile.Bound()
+	padX := (bound.Max[0] - bound.Min[0]) * tileBuffer / tileExtent
+	padY := (bound.Max[1] - bound.Min[1]) * tileBuffer / tileExtent
+	query := orb.Bound{
+		Min: orb.Point{bound.Min[0] - padX, bound.Min[1] - padY},
+		Max: orb.Point{bound.Max[0] + padX, bound.Max[1] + padY},
+	}
+
+	rows := fileRows(s.pf, s.geoMeta)
+	defer rows.Close()
+	if s.covering != nil {
+		// The row groups of the file are shared by the requests
+		kept := make([]parquet.RowGroup, 0, len(rows.rowGroups))
+		for i, rowGroup := range rows.rowGroups {
+			if !s.covering.disjoint(s.pf.Metadata().RowGroups[i], query) {
+				kept = append(kept, rowGroup)
+			}
+		}
+		rows.rowGroups = kept
+	}
+
+	reader := &extractReader{reader: withContext(ctx, rows), extract: ExtractOptions{BBox: &query}, geographic: true}
+	layer := newMVTLayer(s.options.Layer)
+	for {
+		feature, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		geometryType, commands := encodeMVTGeometry(tileGeometry(feature.Geometry, tile))
+		if len(commands) > 0 {
+			layer.add(feature, geometryType, commands)
+		}
+	}
+	return layer.encode(), nil
+}
+
+// tileGeometry projects a geometry of longitudes and latitudes to the coordinates of a
+// tile, with the origin at its top left corner and y pointing down, and clips it to the
+// tile and its buffer
+func tileGeometry(geometry orb.Geometry, tile maptile.Tile) orb.Geometry {
+	geometry = planarGeometry(geometry)
+	if geometry == nil {
+		return nil
+	}
+	geometry = splitAntimeridian(geometry)
+
+	world := float64(uint64(1)<<tile.Z) * tileExtent
+	originX, originY := float64(tile.X)*tileExtent, float64(tile.Y)*tileExtent
+	mercator := func(p orb.Point) orb.Point {
+		latitude := math.Max(-maxMercatorLatitude, math.Min(maxMercatorLatitude, p[1]))
+		sin := math.Sin(latitude * math.Pi / 180)
+		return orb.Point{
+			(p[0]+180)/360*world - originX,
+			(0.5-math.Log((1+sin)/(1-sin))/(4*math.Pi))*world - originY,
+		}
+	}
+	// Projections modify the geometry in place
+	projected := project.Geometry(orb.Clone(geometry), mercator)
+	return clip.Geometry(orb.Bound{
+		Min: orb.Point{-tileBuffer, -tileBuffer},
+		Max: orb.Point{tileExtent + tileBuffer, tileExtent + tileBuffer},
+	}, projected)
+}
+
+// mvtEncoder encodes the commands of a vector tile geometry, whose positions are
+// relative to the previous one
+type mvtEncoder struct {
+	commands []uint32
+	x, y     int64
+}
+
+// encodeMVTGeometry returns the vector tile geometry type and commands of a geometry in
+// tile coordinates, without commands when nothing remains once the positions are
+// rounded to whole tile coordinates
+func encodeMVTGeometry(geometry orb.Geometry) (uint64, []uint32) {
+	e := &mvtEncoder{}
+	switch g := geometry.(type) {
+	case orb.Point:
+		e.points([]orb.Point{g})
+		return mvtPoint, e.commands
+	case orb.MultiPoint:
+		e.points(g)
+		return mvtPoint, e.commands
+	case orb.LineString:
+		e.line(g)
+		return mvtLineString, e.commands
+	case orb.MultiLineString:
+		for _, line := range g {
+			e.line(line)
+		}
+		return mvtLineString, e.commands
+	case orb.Polygon:
+		e.polygon(g)
+		return mvtPolygon, e.commands
+	case orb.MultiPolygon:
+		for _, polygon := range g {
+			e.polygon(polygon)
+		}
+		return mvtPolygon, e.commands
+	}
+	return 0, nil
+}
+
+// command appends a command of count repetitions
+func (e *mvtEncoder) command(id, count int) {
+	e.commands = append(e.commands, uint32(id&7|count<<3))
+}
+
+// position appends the parameters of a position, as the zigzag encoded offsets from
+// the previous one
+func (e *mvtEncoder) position(p [2]int64) {
+	dx, dy := p[0]-e.x, p[1]-e.y
+	e.commands = append(e.commands, uint32((dx<<1)^(dx>>63)), uint32((dy<<1)^(dy>>63)))
+	e.x, e.y = p[0], p[1]
+}
+
+func (e *mvtEncoder) points(points []orb.Point) {
+	if len(points) == 0 {
+		return
+	}
+	e.command(mvtMoveTo, len(points))
+	for _, point := range points {
+		e.position(roundTilePosition(point))
+	}
+}
+
+func (e *mvtEncoder) line(line orb.LineString) {
+	positions := roundTilePositions(line)
+	if len(positions) < 2 {
+		return
+	}
+	e.command(mvtMoveTo, 1)
+	e.position(positions[0])
+	e.command(mvtLineTo, len(positions)-1)
+	for _, position := range positions[1:] {
+		e.position(position)
+	}
+}
+
+// polygon appends the rings of a polygon, the exterior one with a positive area in tile
+// coordinates, clockwise as y points down, and the holes with a negative area. A polygon
+// whose exterior ring collapses is left out.
+func (e *mvtEncoder) polygon(polygon orb.Polygon) {
+	for i, ring := range polygon {
+		positions := roundTilePositions(ring)
+		if len(positions) > 1 && positions[0] == positions[len(positions)-1] {
+			positions = positions[:len(positions)-1]
+		}
+		area := int64(0)
+		for j := range positions {
+			a, b := positions[j], positions[(j+1)%len(positions)]
+			area += a[0]*b[1] - b[0]*a[1]
+		}
+		if len(positions) < 3 || area == 0 {
+			if i == 0 {
+				return
+			}
+			continue
+		}
+		if (i == 0) != (area > 0) {
+			for l, r := 0, len(positions)-1; l < r; l, r = l+1, r-1 {
+				positions[l], positions[r] = positions[r], positions[l]
+			}
+		}
+
+		e.command(mvtMoveTo, 1)
+		e.position(positions[0])
+		e.command(mvtLineTo, len(positions)-1)
+		for _, position := range positions[1:] {
+			e.position(position)
+		}
+		e.command(mvtClosePath, 1)
+	}
+}
+
+// roundTilePosition rounds a position to whole tile coordinates
+func roundTilePosition(p orb.Point) [2]int64 {
+	return [2]int64{int64(math.Round(p[0])), int64(math.Round(p[1]))}
+}
+
+// roundTilePositions rounds positions to whole tile coordinates, dropping those that
+// repeat the previous one
+func roundTilePositions(points []orb.Point) [][2]int64 {
+	positions := make([][2]int64, 0, len(points))
+	for _, point := range points {
+		position := roundTilePosition(point)
+		if len(positions) == 0 || positions[len(positions)-1] != position {
+			positions = append(positions, position)
+		}
+	}
+	return positions
+}
+
+// mvtLayer accumulates the encoded features of a vector tile layer, and the keys and
+// values of their properties, each stored once
+type mvtLayer struct {
+	name     string
+	features [][]byte
+	keys     []string
+	values   [][]byte
+	// keyIndex and valueIndex locate the keys and encoded values already stored.
+	keyIndex   map[string]int
+	valueIndex map[string]int
+}
+
+func newMVTLayer(name string) *mvtLayer {
+	return &mvtLayer{name: name, keyIndex: make(map[string]int), valueIndex: make(map[string]int)}
+}
+
+// add appends a feature with the given geometry type and commands
+func (l *mvtLayer) add(feature *geojson.Feature, geometryType uint64, commands []uint32) {
+	var data []byte
+	if id, ok := mvtFeatureID(feature.ID); ok {
+		data = protoAppendVarint(data, 1, id)
+	}
+
+	names := make([]string, 0, len(feature.Properties))
+	for name := range feature.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var tags []uint64
+	for _, name := range names {
+		value, ok := encodeMVTValue(feature.Properties[name])
+		if !ok {
+			continue
+		}
+		key, ok := l.keyIndex[name]
+		if !ok {
+			key = len(l.keys)
+			l.keyIndex[name] = key
+			l.keys = append(l.keys, name)
+		}
+		index, ok := l.valueIndex[string(value)]
+		if !ok {
+			index = len(l.values)
+			l.valueIndex[string(value)] = index
+			l.values = append(l.values, value)
+		}
+		tags = append(tags, uint64(key), uint64(index))
+	}
+	if len(tags) > 0 {
+		data = protoAppendPacked(data, 2, tags)
+	}
+
+	data = protoAppendVarint(data, 3, geometryType)
+	packed := make([]uint64, len(commands))
+	for i, command := range commands {
+		packed[i] = uint64(command)
+	}
+	data = protoAppendPacked(data, 4, packed)
+	l.features = append(l.features, data)
+}
+
+// encode returns a tile holding the layer, empty when the layer has no features
+func (l *mvtLayer) encode() []byte {
+	if len(l.features) == 0 {
+		return nil
+	}
+	layer := protoAppendVarint(nil, 15, 2)
+	layer = protoAppendBytes(layer, 1, []byte(l.name))
+	for _, feature := range l.features {
+		layer = protoAppendBytes(layer, 2, feature)
+	}
+	for _, key := range l.keys {
+		layer = protoAppendBytes(layer, 3, []byte(key))
+	}
+	for _, value := range l.values {
+		layer = protoAppendBytes(layer, 4, value)
+	}
+	layer = protoAppendVarint(layer, 5, tileExtent)
+	return protoAppendBytes(nil, 3, layer)
+}
+
+// mvtFeatureID returns the id of a feature as the unsigned integer of a vector tile
+// feature, if it is one
+func mvtFeatureID(id any) (uint64, bool) {
+	switch v := id.(type) {
+	case int64:
+		return uint64(v), v >= 0
+	case int:
+		return uint64(v), v >= 0
+	case float64:
+		return uint64(v), v >= 0 && v == math.Trunc(v) && v < 1<<63
+	}
+	return 0, false
+}
+
+// encodeMVTValue encodes a property value as a vector tile value message. Property
+// values other than strings, numbers and booleans, such as geometries, are left out.
+func encodeMVTValue(value any) ([]byte, bool) {
+	switch v := value.(type) {
+	case string:
+		return protoAppendBytes(nil, 1, []byte(v)), true
+	case float64:
+		data := protoAppendKey(nil, 3, 1)
+		return binary.LittleEndian.AppendUint64(data, math.Float64bits(v)), true
+	case int64:
+		return protoAppendVarint(nil, 6, uint64((v<<1)^(v>>63))), true
+	case uint64:
+		return protoAppendVarint(nil, 5, v), true
+	case bool:
+		flag := uint64(0)
+		if v {
+			flag = 1
+		}
+		return protoAppendVarint(nil, 7, flag), true
+	}
+	return nil, false
+}
+
+// protoAppendKey appends the key of a protobuf field
+func protoAppendKey(data []byte, number, wire int) []byte {
+	return binary.AppendUvarint(data, uint64(number)<<3|uint64(wire))
+}
+
+// protoAppendVarint appends a varint protobuf field
+func protoAppendVarint(data []byte, number int, value uint64) []byte {
+	return binary.AppendUvarint(protoAppendKey(data, number, 0), value)
+}
+
+// protoAppendBytes appends a length-delimited protobuf field
+func protoAppendBytes(data []byte, number int, value []byte) []byte {
+	data = binary.AppendUvarint(protoAppendKey(data, number, 2), uint64(len(value)))
+	return append(data, value...)
+}
+
+// protoAppendPacked appends a packed repeated varint protobuf field
+func protoAppendPacked(data []byte, number int, values []uint64) []byte {
+	var packed []byte
+	for _, value := range values {
+		packed = binary.AppendUvarint(packed, value)
+	}
+	return protoAppendBytes(data, number, packed)
+}
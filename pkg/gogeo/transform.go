@@ -0,0 +1,370 @@
+package gogeo
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/simplify"
+)
+
+// WithSimplify simplifies the lines and polygons of the feature geometries with the
+// Douglas-Peucker algorithm, removing the vertices closer than tolerance to the
+// simplified shape. The tolerance is in the units of the coordinates, degrees for
+// longitudes and latitudes. Geometries that would collapse are kept as they are.
+func WithSimplify(tolerance float64) Option {
+	return func(cfg *config) {
+		if tolerance < 0 || math.IsNaN(tolerance) || math.IsInf(tolerance, 0) {
+			cfg.fail(AppError{Message: fmt.Sprintf("invalid simplification tolerance %g", tolerance)})
+			return
+		}
+		cfg.simplify = tolerance
+	}
+}
+
+// maxPrecision is the largest number of decimal places of WithPrecision, beyond which
+// float64 coordinates have no more digits
+const maxPrecision = 15
+
+// WithPrecision rounds the coordinates of the feature geometries, including Z, to the
+// given number of decimal places. Six decimal places of degrees are about 10 cm, and
+// fewer distinct digits compress better.
+func WithPrecision(decimals int) Option {
+	return func(cfg *config) {
+		if decimals < 0 || decimals > maxPrecision {
+			cfg.fail(AppError{Message: fmt.Sprintf("invalid precision %d, expected 0 to %d decimal places", decimals, maxPrecision)})
+			return
+		}
+		cfg.precision = decimals
+		cfg.precisionSet = true
+	}
+}
+
+// WithCounterclockwise orients the exterior rings of the polygons of the feature
+// geometries counterclockwise and their holes clockwise, as RFC 7946 recommends, and
+// records the orientation "counterclockwise" in the geo metadata of the geometry column.
+func WithCounterclockwise() Option {
+	return func(cfg *config) {
+		cfg.counterclockwise = true
+	}
+}
+
+// WithPromoteToMulti writes the points, lines and polygons of the feature geometries as
+// MultiPoint, MultiLineString and MultiPolygon geometries of one member, so that a
+// column mixing single and multi geometries has a single geometry type per dimension.
+func WithPromoteToMulti() Option {
+	return func(cfg *config) {
+		cfg.promoteToMulti = true
+	}
+}
+
+// transformsGeometry reports whether cfg configures a transformation of the feature geometries
+func (cfg *config) transformsGeometry() bool {
+	return cfg.splitAntimeridian || cfg.simplify > 0 || cfg.precisionSet || cfg.makeValid || cfg.counterclockwise ||
+		cfg.promoteToMulti || cfg.nullGeometries != "" || cfg.emptyGeometries != ""
+}
+
+// transformReader transforms the geometries of the features of reader as configured,
+// and applies the policies for the features without a geometry or with an empty one
+type transformReader struct {
+	reader FeatureReader
+	cfg    *config
+	// count is the number of features read.
+	count int
+	// Outcome of WithMakeValid: the number of geometries repaired, of those that could
+	// not be, and the first of them.
+	repaired, unrepaired int
+	invalid              []InvalidGeometry
+	// skipped and dropped are the numbers of features without a geometry and with an
+	// empty one left out.
+	skipped, dropped int
+}
+
+func (r *transformReader) Next() (*geojson.Feature, error) {
+	feature, err := r.reader.Next()
+	if err != nil {
+		return nil, err
+	}
+	r.count++
+	if feature.Geometry == nil {
+		switch r.cfg.nullGeometries {
+		case NullGeometriesSkip:
+			r.skipped++
+			return r.Next()
+		case NullGeometriesFail:
+			return nil, nullGeometryError(r.count, feature.ID)
+		}
+		return feature, nil
+	}
+	if r.cfg.emptyGeometries != "" && emptyGeometry(feature.Geometry) {
+		if r.cfg.emptyGeometries == EmptyGeometriesFail {
+			return nil, emptyGeometryError(r.count, feature.ID)
+		}
+		r.dropped++
+		return r.Next()
+	}
+	// Copy the feature, which buffered inputs read more than once
+	transformed := *feature
+	transformed.Geometry = r.transform(feature)
+	return &transformed, nil
+}
+
+// transform applies the configured transformations to the geometry of a feature
+func (r *transformReader) transform(feature *geojson.Feature) orb.Geometry {
+	geometry := feature.Geometry
+	if r.cfg.splitAntimeridian {
+		geometry = splitAntimeridian(geometry)
+	}
+	if r.cfg.simplify > 0 {
+		geometry = simplifyGeometry(geometry, simplify.DouglasPeucker(r.cfg.simplify))
+	}
+	if r.cfg.precisionSet {
+		geometry = roundGeometry(geometry, math.Pow10(r.cfg.precision))
+	}
+	if r.cfg.makeValid {
+		valid, repaired, problem := makeValid(geometry)
+		switch {
+		case repaired:
+			r.repaired++
+		case problem != "":
+			r.unrepaired++
+			if len(r.invalid) < maxInvalidGeometries {
+				r.invalid = append(r.invalid, InvalidGeometry{Feature: r.count, ID: feature.ID, Problem: problem})
+			}
+		}
+		geometry = valid
+	}
+	if r.cfg.counterclockwise {
+		geometry = orientGeometry(geometry)
+	}
+	if r.cfg.promoteToMulti {
+		geometry = promoteToMulti(geometry)
+	}
+	return geometry
+}
+
+// report records the outcome of the transformations in a report
+func (r *transformReader) report(report *Report) {
+	report.Repaired = r.repaired
+	report.Unrepaired = r.unrepaired
+	report.Invalid = r.invalid
+	report.Skipped = r.skipped
+	report.Dropped = r.dropped
+}
+
+// simplifyGeometry removes the vertices of lines and rings that are closer than the
+// tolerance of simplifier to the simplified shape. Geometries that would collapse, such
+// as a polygon whose exterior ring would keep fewer than four positions, are kept as
+// they are, and the Z ordinates of the kept positions are preserved.
+func simplifyGeometry(geometry orb.Geometry, simplifier *simplify.DouglasPeuckerSimplifier) orb.Geometry {
+	switch g := geometry.(type) {
+	case orb.Point, orb.MultiPoint, orb.Bound:
+		return geometry
+	case orb.Collection:
+		members := make(orb.Collection, len(g))
+		for i, member := range g {
+			members[i] = simplifyGeometry(member, simplifier)
+		}
+		return members
+	case GeometryZ:
+		simplified := simplifyGeometry(g.Geometry, simplifier)
+		return GeometryZ{Geometry: simplified, Z: keptZ(g.Geometry, simplified, g.Z)}
+	}
+
+	// The simplifier modifies the geometry in place
+	simplified := simplifier.Simplify(orb.Clone(geometry))
+	if collapsed(simplified) {
+		return geometry
+	}
+	return simplified
+}
+
+// collapsed reports whether a simplified geometry lost its shape
+func collapsed(geometry orb.Geometry) bool {
+	switch g := geometry.(type) {
+	case nil:
+		return true
+	case orb.LineString:
+		return len(g) < 2
+	case orb.MultiLineString:
+		return len(g) == 0
+	case orb.Polygon:
+		return len(g) == 0 || len(g[0]) < 4
+	case orb.MultiPolygon:
+		if len(g) == 0 {
+			return true
+		}
+		for _, polygon := range g {
+			if collapsed(polygon) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// keptZ returns the Z ordinates of the positions of simplified, whose positions are a
+// subsequence of those of original
+func keptZ(original, simplified orb.Geometry, z []float64) []float64 {
+	positions := appendPositions(nil, original)
+	kept := make([]float64, 0, countPositions(simplified))
+	i := 0
+	for _, position := range appendPositions(nil, simplified) {
+		for i < len(positions) && positions[i] != position {
+			i++
+		}
+		if i < len(positions) && i < len(z) {
+			kept = append(kept, z[i])
+			i++
+		} else {
+			kept = append(kept, 0)
+		}
+	}
+	return kept
+}
+
+// appendPositions appends the positions of a geometry to points, in the order of its
+// coordinates
+func appendPositions(points []orb.Point, geometry orb.Geometry) []orb.Point {
+	switch g := geometry.(type) {
+	case orb.Point:
+		return append(points, g)
+	case orb.MultiPoint:
+		return append(points, g...)
+	case orb.LineString:
+		return append(points, g...)
+	case orb.Ring:
+		return append(points, g...)
+	case orb.Polygon:
+		for _, ring := range g {
+			points = append(points, ring...)
+		}
+	case orb.MultiLineString:
+		for _, line := range g {
+			points = append(points, line...)
+		}
+	case orb.MultiPolygon:
+		for _, polygon := range g {
+			points = appendPositions(points, polygon)
+		}
+	case orb.Collection:
+		for _, member := range g {
+			points = appendPositions(points, member)
+		}
+	case GeometryZ:
+		return appendPositions(points, g.Geometry)
+	}
+	return points
+}
+
+// roundGeometry returns a geometry whose coordinates are rounded to multiples of 1/factor
+func roundGeometry(geometry orb.Geometry, factor float64) orb.Geometry {
+	switch g := geometry.(type) {
+	case orb.Collection:
+		members := make(orb.Collection, len(g))
+		for i, member := range g {
+			members[i] = roundGeometry(member, factor)
+		}
+		return members
+	case GeometryZ:
+		z := make([]float64, len(g.Z))
+		for i, value := range g.Z {
+			z[i] = math.Round(value*factor) / factor
+		}
+		return GeometryZ{Geometry: roundGeometry(g.Geometry, factor), Z: z}
+	}
+	// orb.Round modifies the geometry in place
+	return orb.Round(orb.Clone(geometry), int(factor))
+}
+
+// promoteToMulti returns a point, line or polygon as a multi geometry of one member
+func promoteToMulti(geometry orb.Geometry) orb.Geometry {
+	switch g := geometry.(type) {
+	case orb.Point:
+		if isEmptyPoint(g) {
+			return orb.MultiPoint{}
+		}
+		return orb.MultiPoint{g}
+	case orb.LineString:
+		return orb.MultiLineString{g}
+	case orb.Polygon:
+		return orb.MultiPolygon{g}
+	case GeometryZ:
+		// The positions keep their order, and so their Z ordinates
+		return GeometryZ{Geometry: promoteToMulti(g.Geometry), Z: g.Z}
+	}
+	return geometry
+}
+
+// orientGeometry returns a geometry whose polygons have counterclockwise exterior rings
+// and clockwise holes
+func orientGeometry(geometry orb.Geometry) orb.Geometry {
+	switch g := geometry.(type) {
+	case orb.Polygon:
+		return orientPolygon(g, nil)
+	case orb.MultiPolygon:
+		return orientMultiPolygon(g, nil)
+	case orb.Collection:
+		members := make(orb.Collection, len(g))
+		for i, member := range g {
+			members[i] = orientGeometry(member)
+		}
+		return members
+	case GeometryZ:
+		z := slices.Clone(g.Z)
+		switch inner := g.Geometry.(type) {
+		case orb.Polygon:
+			return GeometryZ{Geometry: orientPolygon(inner, z), Z: z}
+		case orb.MultiPolygon:
+			return GeometryZ{Geometry: orientMultiPolygon(inner, z), Z: z}
+		}
+	}
+	return geometry
+}
+
+// orientMultiPolygon orients the rings of the polygons of a multipolygon, reversing the
+// matching Z ordinates of z in place
+func orientMultiPolygon(multi orb.MultiPolygon, z []float64) orb.MultiPolygon {
+	oriented := make(orb.MultiPolygon, len(multi))
+	offset := 0
+	for i, polygon := range multi {
+		n := countPositions(polygon)
+		var polygonZ []float64
+		if offset+n <= len(z) {
+			polygonZ = z[offset : offset+n]
+		}
+		oriented[i] = orientPolygon(polygon, polygonZ)
+		offset += n
+	}
+	return oriented
+}
+
+// orientPolygon returns a polygon with a counterclockwise exterior ring and clockwise
+// holes, reversing the matching Z ordinates of z in place
+func orientPolygon(polygon orb.Polygon, z []float64) orb.Polygon {
+	oriented := polygon
+	cloned := false
+	offset := 0
+	for i, ring := range polygon {
+		want := orb.CCW
+		if i > 0 {
+			want = orb.CW
+		}
+		if orientation := ring.Orientation(); len(ring) >= 3 && orientation != 0 && orientation != want {
+			if !cloned {
+				oriented = slices.Clone(polygon)
+				cloned = true
+			}
+			reversed := ring.Clone()
+			reversed.Reverse()
+			oriented[i] = reversed
+			if offset+len(ring) <= len(z) {
+				slices.Reverse(z[offset : offset+len(ring)])
+			}
+		}
+		offset += len(ring)
+	}
+	return oriented
+}
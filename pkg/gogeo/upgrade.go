@@ -0,0 +1,196 @@
+package gogeo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// UpgradeGeoParquet copies GeoParquet of the given size from r to w with its geo
+// metadata converted to the shape of GeoParquet 1.1: the version is set to 1.1.0, the
+// geometry_type of pre-1.0 files becomes geometry_types, lowercase encodings are
+// normalized, and CRS given as codes such as "EPSG:4326" are replaced by their PROJJSON
+// definitions. Only the footer is rewritten.
+//
+// When options are given, such as WithBBoxColumn to add a bbox covering column, the
+// rows are decoded and written again with them instead, keeping the geometry columns,
+// encodings and CRS of the input. The input is then read twice.
+func UpgradeGeoParquet(ctx context.Context, r io.ReaderAt, size int64, w io.Writer, opts ...Option) error {
+	pf, err := parquet.OpenFile(r, size, parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+	if err != nil {
+		return AppError{Message: "failed to read Parquet file", Value: err}
+	}
+	value, ok := pf.Lookup(GeoParquetMetadataKey)
+	if !ok {
+		return AppError{Message: "file has no geo metadata, not a GeoParquet file"}
+	}
+	var metadata map[string]any
+	if err := json.Unmarshal([]byte(value), &metadata); err != nil {
+		return AppError{Message: "geo metadata is not a JSON object", Value: err}
+	}
+	if err := upgradeGeoMetadata(metadata); err != nil {
+		return err
+	}
+
+	if len(opts) == 0 {
+		return writeGeoMetadata(r, size, w, pf, metadata)
+	}
+
+	upgraded, err := upgradeOptions(metadata)
+	if err != nil {
+		return err
+	}
+	cfg := newConfig(append(upgraded, opts...))
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	_, err = regenerateGeoParquet(ctx, r, size, w, cfg)
+	return err
+}
+
+// upgradeGeoMetadata converts geo metadata of any version to the shape of GeoParquet 1.1
+func upgradeGeoMetadata(metadata map[string]any) error {
+	metadata["version"] = GeoParquetVersion
+
+	columns, ok := metadata["columns"].(map[string]any)
+	if !ok {
+		return AppError{Message: "geo metadata has no columns object"}
+	}
+	for name, value := range columns {
+		column, ok := value.(map[string]any)
+		if !ok {
+			return AppError{Message: fmt.Sprintf("geo metadata of column %q is not an object", name)}
+		}
+
+		if encoding, ok := column["encoding"].(string); ok {
+			if normalized, err := normalizeGeometryEncoding(encoding); err == nil {
+				column["encoding"] = normalized
+			}
+		}
+
+		// Before 1.0, geometry_type held a type or a list of types, or "Unknown"
+		if legacy, ok := column["geometry_type"]; ok {
+			if _, ok := column["geometry_types"]; !ok {
+				column["geometry_types"] = legacyGeometryTypes(legacy)
+			}
+			delete(column, "geometry_type")
+		}
+		if _, ok := column["geometry_types"]; !ok {
+			column["geometry_types"] = []any{}
+		}
+
+		// Before 1.0, the CRS could be given as a string
+		if code, ok := column["crs"].(string); ok {
+			definition, err := LookupCRS(code)
+			if err != nil {
+				return AppError{Message: fmt.Sprintf("column %q: cannot convert CRS %q to PROJJSON, declare it with meta set --crs", name, code), Value: err}
+			}
+			var crs any
+			if err := json.Unmarshal(definition, &crs); err != nil {
+				return AppError{Message: "invalid CRS definition", Value: err}
+			}
+			column["crs"] = crs
+		}
+	}
+	return nil
+}
+
+// legacyGeometryTypes converts a pre-1.0 geometry_type to geometry_types
+func legacyGeometryTypes(legacy any) []any {
+	var names []any
+	switch v := legacy.(type) {
+	case string:
+		names = []any{v}
+	case []any:
+		names = v
+	}
+
+	types := []any{}
+	for _, name := range names {
+		if s, ok := name.(string); !ok || strings.EqualFold(s, "Unknown") {
+			return []any{}
+		}
+		types = append(types, name)
+	}
+	return types
+}
+
+// upgradeOptions returns the options writing the geometry columns of upgraded geo
+// metadata as they are
+func upgradeOptions(metadata map[string]any) ([]Option, error) {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, AppError{Message: "failed to encode geo metadata", Value: err}
+	}
+	var geoMeta GeoParquet
+	if err := json.Unmarshal(data, &geoMeta); err != nil {
+		return nil, AppError{Message: "failed to parse geo metadata", Value: err}
+	}
+	if _, ok := geoMeta.Columns[geoMeta.PrimaryColumn]; !ok {
+		return nil, AppError{Message: fmt.Sprintf("primary column %q is not described in geo metadata", geoMeta.PrimaryColumn)}
+	}
+	return geometryOptions(&geoMeta)
+}
+
+// geometryOptions returns the options writing the geometry columns described by geo
+// metadata with their encodings and CRS
+func geometryOptions(geoMeta *GeoParquet) ([]Option, error) {
+	primary := geoMeta.Columns[geoMeta.PrimaryColumn]
+	opts := []Option{
+		WithGeometryName(geoMeta.PrimaryColumn),
+		WithGeometryEncoding(primary.Encoding),
+	}
+	switch {
+	case string(primary.CRS) == "null":
+		return nil, AppError{Message: fmt.Sprintf("column %q has an unknown CRS, which cannot be kept when rewriting the rows", geoMeta.PrimaryColumn)}
+	case primary.CRS != nil:
+		opts = append(opts, WithCRS(primary.CRS))
+	}
+	if primary.Orientation == "counterclockwise" {
+		opts = append(opts, WithCounterclockwise())
+	}
+	names := make([]string, 0, len(geoMeta.Columns))
+	for name := range geoMeta.Columns {
+		if name != geoMeta.PrimaryColumn {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		opts = append(opts, WithGeometryColumn(name, geoMeta.Columns[name].Encoding))
+	}
+	return opts, nil
+}
+
+// regenerateGeoParquet decodes the rows of GeoParquet read from r and writes them to w
+// with the configuration cfg, reading the input twice unless a schema is configured
+func regenerateGeoParquet(ctx context.Context, r io.ReaderAt, size int64, w io.Writer, cfg *config) (*Report, error) {
+	schema, total := cfg.schema, 0
+	if schema == nil {
+		reader, err := newGeoParquetReader(r, size)
+		if err != nil {
+			return nil, err
+		}
+		analysis, err := analyzeFeatures(withContext(ctx, reader), cfg)
+		reader.Close()
+		if err != nil {
+			return nil, AppError{Message: "failed to read GeoParquet rows", Value: err}
+		}
+		if analysis.Features == 0 {
+			return nil, AppError{Message: "no rows found in GeoParquet file"}
+		}
+		schema, total = analysis.Properties, analysis.Features
+	}
+
+	reader, err := newGeoParquetReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return generate(withContext(ctx, reader), w, schema, cfg, total)
+}
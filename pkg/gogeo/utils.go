@@ -9,8 +9,24 @@ import (
 
 // IsCSVFile checks if a file appears to be a CSV file based on extension
 func IsGeoJsonFile(filePath string) bool {
+	format := FormatFromPath(filePath)
+	return format == FormatGeoJSON || format == FormatGeoJSONL
+}
+
+// IsFeatureFile checks if a file is in a feature format that can be converted, based on extension
+func IsFeatureFile(filePath string) bool {
+	return FormatFromPath(filePath) != ""
+}
+
+// IsZipFile checks if a file appears to be a ZIP archive based on extension
+func IsZipFile(filePath string) bool {
+	return strings.ToLower(filepath.Ext(filePath)) == ".zip"
+}
+
+// IsGeoParquetFile checks if a file appears to be a GeoParquet file based on extension
+func IsGeoParquetFile(filePath string) bool {
 	ext := strings.ToLower(filepath.Ext(filePath))
-	return ext == ".geojson" || ext == ".json"
+	return ext == ".geoparquet" || ext == ".parquet"
 }
 
 // ValidateOutputPath validates if the given path is a valid file path
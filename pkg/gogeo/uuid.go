@@ -0,0 +1,66 @@
+package gogeo
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// WithUUIDInference writes string properties holding UUIDs, such as
+// "f47ac10b-58cc-4372-a567-0e02b2c3d479", as FIXED_LEN_BYTE_ARRAY(16) columns annotated
+// with the UUID logical type, which take less than half the space of their text. A
+// column mixing UUIDs with other values is written as strings.
+func WithUUIDInference() Option {
+	return func(cfg *config) {
+		cfg.inferUUID = true
+	}
+}
+
+// inferUUIDType returns PropertyTypeUUID for a UUID string, or PropertyTypeUnknown
+func inferUUIDType(value any) PropertyType {
+	if text, ok := value.(string); ok {
+		if _, ok := parseUUID(text); ok {
+			return PropertyTypeUUID
+		}
+	}
+	return PropertyTypeUnknown
+}
+
+// parseUUID parses a UUID in its canonical form of 32 hexadecimal digits in groups of
+// 8, 4, 4, 4 and 12 separated by hyphens, in either case
+func parseUUID(text string) ([16]byte, bool) {
+	var uuid [16]byte
+	if len(text) != 36 || text[8] != '-' || text[13] != '-' || text[18] != '-' || text[23] != '-' {
+		return uuid, false
+	}
+	digits := strings.ReplaceAll(text, "-", "")
+	if len(digits) != 32 {
+		return uuid, false
+	}
+	if _, err := hex.Decode(uuid[:], []byte(digits)); err != nil {
+		return uuid, false
+	}
+	return uuid, true
+}
+
+// convertUUID converts a property value to the bytes of a UUID column
+func convertUUID(value any) ([16]byte, error) {
+	text, ok := value.(string)
+	if !ok {
+		return [16]byte{}, fmt.Errorf("cannot convert %T to %s", value, PropertyTypeUUID)
+	}
+	uuid, ok := parseUUID(strings.TrimSpace(text))
+	if !ok {
+		return [16]byte{}, fmt.Errorf("cannot convert %q to %s", text, PropertyTypeUUID)
+	}
+	return uuid, nil
+}
+
+// formatUUID returns the canonical lower case text of the bytes of a UUID
+func formatUUID(uuid []byte) string {
+	if len(uuid) != 16 {
+		return hex.EncodeToString(uuid)
+	}
+	text := hex.EncodeToString(uuid)
+	return text[0:8] + "-" + text[8:12] + "-" + text[12:16] + "-" + text[16:20] + "-" + text[20:]
+}
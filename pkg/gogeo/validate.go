@@ -0,0 +1,433 @@
+package gogeo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/paulmach/orb"
+)
+
+// maxGeometryErrors is the number of undecodable geometries reported per column;
+// further ones are only counted.
+const maxGeometryErrors = 10
+
+// geometryTypePattern matches the geometry types allowed in geometry_types
+var geometryTypePattern = regexp.MustCompile(`^(GeometryCollection|(Multi)?(Point|LineString|Polygon))( Z)?$`)
+
+// nativeEncodings are the GeoArrow encodings allowed by GeoParquet 1.1 besides WKB
+var nativeEncodings = map[string]bool{
+	"point": true, "linestring": true, "polygon": true,
+	"multipoint": true, "multilinestring": true, "multipolygon": true,
+}
+
+// ValidationReport lists the violations of the GeoParquet specification found in a file.
+type ValidationReport struct {
+	// GeoParquet version declared by the file, empty if the geo metadata is missing.
+	Version string `json:"version"`
+	// Number of rows checked.
+	Rows int64 `json:"rows"`
+	// Violations found, empty if the file is valid.
+	Violations []string `json:"violations"`
+}
+
+// Valid reports whether no violations were found.
+func (r *ValidationReport) Valid() bool {
+	return len(r.Violations) == 0
+}
+
+func (r *ValidationReport) add(format string, args ...any) {
+	r.Violations = append(r.Violations, fmt.Sprintf(format, args...))
+}
+
+// ValidateGeoParquetFile checks a local GeoParquet file against the specification.
+func ValidateGeoParquetFile(ctx context.Context, path string) (*ValidationReport, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, AppError{Message: "failed to open GeoParquet file", Value: err}
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, AppError{Message: "failed to stat GeoParquet file", Value: err}
+	}
+	return ValidateGeoParquet(ctx, file, stat.Size())
+}
+
+// ValidateGeoParquet checks GeoParquet of the given size read from r against the
+// GeoParquet 1.0 and 1.1 specifications: the geo metadata must follow the metadata
+// JSON schema of its version and describe existing columns, and every value of a WKB
+// geometry column must decode, have one of the declared geometry_types and lie within
+// the declared bbox. Violations are collected in the report; an error is only returned
+// if the file cannot be read as Parquet.
+func ValidateGeoParquet(ctx context.Context, r io.ReaderAt, size int64) (*ValidationReport, error) {
+	pf, err := parquet.OpenFile(r, size, parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+	if err != nil {
+		return nil, AppError{Message: "failed to read Parquet file", Value: err}
+	}
+
+	report := &ValidationReport{Rows: pf.NumRows()}
+	value, ok := pf.Lookup(GeoParquetMetadataKey)
+	if !ok {
+		report.add("file has no %q metadata key", GeoParquetMetadataKey)
+		return report, nil
+	}
+
+	var metadata map[string]any
+	if err := json.Unmarshal([]byte(value), &metadata); err != nil {
+		report.add("geo metadata is not a JSON object: %v", err)
+		return report, nil
+	}
+
+	columns := validateGeoMetadata(metadata, report)
+	validateGeometrySchema(pf, columns, report)
+	if err := validateGeometryData(ctx, pf, columns, report); err != nil {
+		return nil, AppError{Message: "failed to read GeoParquet rows", Value: err}
+	}
+	return report, nil
+}
+
+// validatedColumn is a geometry column whose metadata was checked
+type validatedColumn struct {
+	name     string
+	encoding string
+	types    map[string]bool
+	bbox     []float64
+	// leaf is the index of the Parquet column holding the geometries, -1 if it is
+	// missing or cannot be checked.
+	leaf int
+}
+
+// validateGeoMetadata checks the geo metadata against the metadata schema of its
+// version and returns its geometry columns, sorted by name
+func validateGeoMetadata(metadata map[string]any, report *ValidationReport) []*validatedColumn {
+	version, ok := metadata["version"].(string)
+	switch {
+	case !ok:
+		report.add("geo metadata: version is missing or not a string")
+	case version != "1.0.0" && version != "1.1.0":
+		report.add("geo metadata: unsupported version %q, expected 1.0.0 or 1.1.0", version)
+	}
+	report.Version = version
+
+	primary, ok := metadata["primary_column"].(string)
+	if !ok {
+		report.add("geo metadata: primary_column is missing or not a string")
+	}
+
+	described, ok := metadata["columns"].(map[string]any)
+	if !ok || len(described) == 0 {
+		report.add("geo metadata: columns is missing or empty")
+		return nil
+	}
+	if primary != "" {
+		if _, ok := described[primary]; !ok {
+			report.add("geo metadata: primary_column %q is not described in columns", primary)
+		}
+	}
+
+	names := make([]string, 0, len(described))
+	for name := range described {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var columns []*validatedColumn
+	for _, name := range names {
+		object, ok := described[name].(map[string]any)
+		if !ok {
+			report.add("column %s: metadata is not an object", name)
+			continue
+		}
+		columns = append(columns, validateColumnMetadata(name, object, version, report))
+	}
+	return columns
+}
+
+// validateColumnMetadata checks the metadata of a geometry column
+func validateColumnMetadata(name string, object map[string]any, version string, report *ValidationReport) *validatedColumn {
+	column := &validatedColumn{name: name, types: make(map[string]bool), leaf: -1}
+
+	encoding, _ := object["encoding"].(string)
+	column.encoding = encoding
+	switch {
+	case encoding == GeometryEncodingWKB:
+	case nativeEncodings[encoding] && version != "1.0.0":
+	case encoding == "":
+		report.add("column %s: encoding is missing or not a string", name)
+	default:
+		report.add("column %s: encoding %q is not allowed by GeoParquet %s", name, encoding, version)
+	}
+
+	types, ok := object["geometry_types"].([]any)
+	if !ok {
+		report.add("column %s: geometry_types is missing or not an array", name)
+	}
+	for _, value := range types {
+		geometryType, ok := value.(string)
+		if !ok || !geometryTypePattern.MatchString(geometryType) {
+			report.add("column %s: invalid geometry type %v", name, value)
+			continue
+		}
+		if column.types[geometryType] {
+			report.add("column %s: geometry type %q is listed twice", name, geometryType)
+		}
+		column.types[geometryType] = true
+	}
+
+	if crs, ok := object["crs"]; ok && crs != nil {
+		if _, ok := crs.(map[string]any); !ok {
+			report.add("column %s: crs must be a PROJJSON object or null", name)
+		}
+	}
+	if edges, ok := object["edges"]; ok && edges != "planar" && edges != "spherical" {
+		report.add("column %s: edges must be \"planar\" or \"spherical\", not %v", name, edges)
+	}
+	if orientation, ok := object["orientation"]; ok && orientation != "counterclockwise" {
+		report.add("column %s: orientation must be \"counterclockwise\", not %v", name, orientation)
+	}
+	if epoch, ok := object["epoch"]; ok {
+		if _, ok := epoch.(float64); !ok {
+			report.add("column %s: epoch must be a number", name)
+		}
+	}
+
+	if value, ok := object["bbox"]; ok {
+		values, _ := value.([]any)
+		for _, v := range values {
+			number, ok := v.(float64)
+			if !ok {
+				column.bbox = nil
+				break
+			}
+			column.bbox = append(column.bbox, number)
+		}
+		if len(column.bbox) != 4 && len(column.bbox) != 6 {
+			report.add("column %s: bbox must be an array of 4 or 6 numbers", name)
+			column.bbox = nil
+		}
+	}
+	// Only a bbox in longitudes and latitudes can cross the antimeridian
+	if xmin, xmax := bboxLongitudes(column.bbox); xmin > xmax && !geographicCRS(columnCRS(object)) {
+		report.add("column %s: bbox has xmin %v greater than xmax %v, which is only allowed for a geographic CRS", name, xmin, xmax)
+	}
+
+	if covering, ok := object["covering"]; ok {
+		if version == "1.0.0" {
+			report.add("column %s: covering is not part of GeoParquet 1.0.0", name)
+		} else {
+			validateCovering(name, covering, report)
+		}
+	}
+	return column
+}
+
+// bboxLongitudes returns the xmin and xmax of a bbox of 4 or 6 numbers, zero if it is nil
+func bboxLongitudes(bbox []float64) (xmin, xmax float64) {
+	if bbox == nil {
+		return 0, 0
+	}
+	return bbox[0], bbox[len(bbox)/2]
+}
+
+// columnCRS returns the crs member of the metadata of a geometry column as JSON, nil if
+// it is missing, which means OGC:CRS84
+func columnCRS(object map[string]any) json.RawMessage {
+	value, ok := object["crs"]
+	if !ok {
+		return nil
+	}
+	crs, _ := json.Marshal(value)
+	return crs
+}
+
+// validateCovering checks the shape of a covering object
+func validateCovering(name string, covering any, report *ValidationReport) {
+	object, ok := covering.(map[string]any)
+	if !ok {
+		report.add("column %s: covering must be an object", name)
+		return
+	}
+	bbox, ok := object["bbox"].(map[string]any)
+	if !ok {
+		report.add("column %s: covering.bbox is missing or not an object", name)
+		return
+	}
+
+	parent := ""
+	for _, field := range []string{"xmin", "ymin", "xmax", "ymax"} {
+		path, _ := bbox[field].([]any)
+		if len(path) != 2 {
+			report.add("column %s: covering.bbox.%s must be a path of 2 column names", name, field)
+			continue
+		}
+		first, _ := path[0].(string)
+		if parent == "" {
+			parent = first
+		} else if first != parent {
+			report.add("column %s: covering.bbox fields must belong to the same column", name)
+		}
+	}
+}
+
+// validateGeometrySchema checks that the geometry columns exist with a suitable
+// Parquet type, and records the leaf column of those whose data can be checked
+func validateGeometrySchema(pf *parquet.File, columns []*validatedColumn, report *ValidationReport) {
+	schema := pf.Schema()
+	for _, column := range columns {
+		if nativeEncodings[column.encoding] {
+			if !hasField(schema, column.name) {
+				report.add("column %s: not found in the Parquet schema", column.name)
+			}
+			continue
+		}
+
+		leaf, ok := schema.Lookup(column.name)
+		if !ok {
+			report.add("column %s: not found in the Parquet schema as a top-level column", column.name)
+			continue
+		}
+		if leaf.Node.Type().Kind() != parquet.ByteArray {
+			report.add("column %s: stored as %s, WKB must be stored as BYTE_ARRAY", column.name, leaf.Node.Type().Kind())
+			continue
+		}
+		if leaf.Node.Repeated() {
+			report.add("column %s: must not be repeated", column.name)
+			continue
+		}
+		if column.encoding == GeometryEncodingWKB {
+			column.leaf = leaf.ColumnIndex
+		}
+	}
+}
+
+// hasField reports whether the schema has a top-level field of the given name
+func hasField(schema *parquet.Schema, name string) bool {
+	for _, field := range schema.Fields() {
+		if field.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// geometryStats accumulates what the values of a geometry column hold
+type geometryStats struct {
+	types  map[string]int
+	bound  orb.Bound
+	empty  bool
+	errors int
+}
+
+// validateGeometryData decodes every value of the checkable geometry columns and
+// compares their types and extent with the metadata
+func validateGeometryData(ctx context.Context, pf *parquet.File, columns []*validatedColumn, report *ValidationReport) error {
+	stats := make(map[int]*geometryStats)
+	names := make(map[int]string)
+	for _, column := range columns {
+		if column.leaf >= 0 {
+			stats[column.leaf] = &geometryStats{types: make(map[string]int), empty: true}
+			names[column.leaf] = column.name
+		}
+	}
+	if len(stats) == 0 {
+		return nil
+	}
+
+	row := int64(0)
+	buffer := make([]parquet.Row, readBatchSize)
+	for _, rowGroup := range pf.RowGroups() {
+		rows := rowGroup.Rows()
+		for {
+			if err := ctx.Err(); err != nil {
+				rows.Close()
+				return err
+			}
+
+			n, err := rows.ReadRows(buffer)
+			for _, values := range buffer[:n] {
+				for _, value := range values {
+					s, ok := stats[value.Column()]
+					if !ok || value.IsNull() || len(value.ByteArray()) == 0 {
+						continue
+					}
+					geometry, decodeErr := decodeGeometry(value.ByteArray(), GeometryEncodingWKB)
+					if decodeErr != nil {
+						s.errors++
+						if s.errors <= maxGeometryErrors {
+							report.add("column %s, row %d: %v", names[value.Column()], row, decodeErr)
+						}
+						continue
+					}
+					s.types[geometryTypeName(geometry)]++
+					if bound := geometry.Bound(); s.empty {
+						s.bound, s.empty = bound, false
+					} else {
+						s.bound = s.bound.Union(bound)
+					}
+				}
+				row++
+			}
+
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+	}
+
+	for _, column := range columns {
+		s, ok := stats[column.leaf]
+		if !ok {
+			continue
+		}
+		if s.errors > maxGeometryErrors {
+			report.add("column %s: %d geometries are not valid WKB", column.name, s.errors)
+		}
+
+		var undeclared []string
+		for geometryType := range s.types {
+			if len(column.types) > 0 && !column.types[geometryType] {
+				undeclared = append(undeclared, geometryType)
+			}
+		}
+		sort.Strings(undeclared)
+		for _, geometryType := range undeclared {
+			report.add("column %s: %d geometries of type %s, which is not in geometry_types", column.name, s.types[geometryType], geometryType)
+		}
+
+		if column.bbox != nil && !s.empty && !bboxContains(column.bbox, s.bound) {
+			report.add("column %s: geometries extend to %v, outside the declared bbox %v", column.name,
+				[]float64{s.bound.Min[0], s.bound.Min[1], s.bound.Max[0], s.bound.Max[1]}, column.bbox)
+		}
+	}
+	return nil
+}
+
+// bboxContains reports whether a declared [xmin, ymin, (zmin,) xmax, ymax, (zmax)]
+// bbox contains a bound. A bbox crossing the antimeridian, with xmin > xmax, is only
+// checked in y.
+func bboxContains(bbox []float64, bound orb.Bound) bool {
+	half := len(bbox) / 2
+	xmin, ymin, xmax, ymax := bbox[0], bbox[1], bbox[half], bbox[half+1]
+	// Tolerate the rounding of bounds written as decimal JSON
+	const tolerance = 1e-9
+	if bound.Min[1] < ymin-tolerance || bound.Max[1] > ymax+tolerance {
+		return false
+	}
+	if xmin > xmax {
+		return true
+	}
+	return bound.Min[0] >= xmin-tolerance && bound.Max[0] <= xmax+tolerance
+}
@@ -0,0 +1,424 @@
+package gogeo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// Severities of GeoJSON problems
+const (
+	// SeverityError marks a violation of RFC 7946.
+	SeverityError = "error"
+	// SeverityWarning marks a departure from a recommendation of RFC 7946, such as
+	// the winding order of polygon rings, that readers usually tolerate.
+	SeverityWarning = "warning"
+)
+
+// maxGeoJSONProblems is the number of problems reported; further ones are only counted
+const maxGeoJSONProblems = 1000
+
+// GeoJSONProblem is a problem found in a GeoJSON document.
+type GeoJSONProblem struct {
+	// Index of the feature, starting at 1, or 0 for the document as a whole.
+	Feature int `json:"feature"`
+	// Line on which the feature starts, or where the document could not be parsed.
+	Line int `json:"line"`
+	// SeverityError or SeverityWarning.
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// GeoJSONReport lists the problems found in a GeoJSON document.
+type GeoJSONReport struct {
+	// Number of features read.
+	Features int `json:"features"`
+	// Problems found, in document order, up to the first 1000.
+	Problems []GeoJSONProblem `json:"problems"`
+	// Number of problems found beyond those listed.
+	Omitted int `json:"omitted,omitempty"`
+}
+
+// Errors returns the number of listed problems of SeverityError.
+func (r *GeoJSONReport) Errors() int {
+	count := 0
+	for _, problem := range r.Problems {
+		if problem.Severity == SeverityError {
+			count++
+		}
+	}
+	return count
+}
+
+func (r *GeoJSONReport) add(problem GeoJSONProblem) {
+	if len(r.Problems) >= maxGeoJSONProblems {
+		r.Omitted++
+		return
+	}
+	r.Problems = append(r.Problems, problem)
+}
+
+// rawFeatureDecoder is a streaming decoder returning undecoded features
+type rawFeatureDecoder interface {
+	nextRaw() (json.RawMessage, error)
+	offset() int64
+}
+
+// ValidateGeoJSONFile checks a local GeoJSON or GeoJSONL file against RFC 7946; the
+// format is detected from the extension, defaulting to GeoJSON.
+func ValidateGeoJSONFile(ctx context.Context, path string) (*GeoJSONReport, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, AppError{Message: "failed to open GeoJSON file", Value: err}
+	}
+	defer file.Close()
+
+	format := FormatFromPath(path)
+	if format == "" {
+		format = FormatGeoJSON
+	}
+	return ValidateGeoJSON(ctx, file, format)
+}
+
+// ValidateGeoJSON streams a FeatureCollection (FormatGeoJSON) or one Feature per line
+// (FormatGeoJSONL) from r and checks it against RFC 7946, reporting the problems that
+// would make a conversion fail or produce wrong results: malformed features and
+// geometries, positions that are not numbers or lie outside longitude/latitude range,
+// LineStrings with fewer than 2 positions, unclosed or too short polygon rings, and
+// geometries mixing 2D and 3D positions. Ring winding order that does not follow the
+// right-hand rule, positions with more than 3 elements and collections mixing 2D and
+// 3D features are warnings. A document that is not valid JSON is reported as an error
+// at the line where parsing stopped.
+func ValidateGeoJSON(ctx context.Context, r io.Reader, format string) (*GeoJSONReport, error) {
+	format, err := normalizeFormat(format)
+	if err != nil {
+		return nil, err
+	}
+
+	// The byte order mark is skipped before counting so that offsets match lines
+	lines := &lineCounter{r: skipBOM(r)}
+	var decoder rawFeatureDecoder
+	switch format {
+	case FormatGeoJSON:
+		decoder = NewGeoJSONDecoder(lines)
+	case FormatGeoJSONL:
+		decoder = NewGeoJSONSeqDecoder(lines)
+	default:
+		return nil, AppError{Message: fmt.Sprintf("cannot validate %q input, expected geojson or geojsonl", format)}
+	}
+
+	report := &GeoJSONReport{}
+	dimensions := make(map[int]int)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		raw, err := decoder.nextRaw()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// Locate the error where parsing stopped rather than at the start of the value
+			offset := decoder.offset()
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				offset = syntaxErr.Offset
+			} else if errors.Is(err, io.ErrUnexpectedEOF) {
+				offset = lines.read - 1
+			}
+			report.add(GeoJSONProblem{Line: lines.lineAt(offset), Severity: SeverityError, Message: err.Error()})
+			return report, nil
+		}
+		report.Features++
+
+		check := &featureCheck{seen: make(map[string]bool), dimensions: make(map[int]bool)}
+		check.feature(raw)
+		line := lines.lineAt(decoder.offset() - int64(len(raw)))
+		for _, problem := range check.problems {
+			problem.Feature = report.Features
+			problem.Line = line
+			report.add(problem)
+		}
+		if check.dimension > 0 {
+			dimensions[check.dimension]++
+		}
+	}
+
+	if dimensions[2] > 0 && dimensions[3] > 0 {
+		report.add(GeoJSONProblem{Severity: SeverityWarning, Message: fmt.Sprintf(
+			"collection mixes %d features with 2D positions and %d with 3D positions", dimensions[2], dimensions[3])})
+	}
+	return report, nil
+}
+
+// featureCheck collects the problems of a feature, each reported once
+type featureCheck struct {
+	problems []GeoJSONProblem
+	seen     map[string]bool
+	// dimensions holds the number of elements of the positions met.
+	dimensions map[int]bool
+	// dimension is the dimension of all positions of the feature, 0 if mixed or none.
+	dimension int
+}
+
+func (c *featureCheck) report(severity, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	if c.seen[message] {
+		return
+	}
+	c.seen[message] = true
+	c.problems = append(c.problems, GeoJSONProblem{Severity: severity, Message: message})
+}
+
+// feature checks the members of a Feature object
+func (c *featureCheck) feature(raw json.RawMessage) {
+	var members map[string]any
+	if err := json.Unmarshal(raw, &members); err != nil {
+		c.report(SeverityError, "feature is not a JSON object")
+		return
+	}
+
+	if members["type"] != "Feature" {
+		c.report(SeverityError, "type is %v, expected \"Feature\"", jsonText(members["type"]))
+	}
+	if id, ok := members["id"]; ok {
+		switch id.(type) {
+		case string, float64:
+		default:
+			c.report(SeverityError, "id must be a string or a number")
+		}
+	}
+	if properties, ok := members["properties"]; !ok {
+		c.report(SeverityWarning, "properties member is missing")
+	} else if _, isObject := properties.(map[string]any); !isObject && properties != nil {
+		c.report(SeverityError, "properties must be an object or null")
+	}
+	if bbox, ok := members["bbox"]; ok {
+		c.bbox(bbox)
+	}
+
+	geometry, ok := members["geometry"]
+	if !ok {
+		c.report(SeverityError, "geometry member is missing")
+		return
+	}
+	if geometry != nil {
+		c.geometry(geometry, "geometry")
+	}
+
+	if len(c.dimensions) > 1 {
+		c.report(SeverityError, "geometry mixes 2D and 3D positions")
+	}
+	if len(c.dimensions) == 1 {
+		for dimension := range c.dimensions {
+			c.dimension = dimension
+		}
+	}
+}
+
+// bbox checks a bbox member
+func (c *featureCheck) bbox(value any) {
+	values, ok := value.([]any)
+	if !ok || len(values) < 4 || len(values)%2 != 0 {
+		c.report(SeverityError, "bbox must be an array of 2*n numbers")
+		return
+	}
+	for _, v := range values {
+		if _, ok := v.(float64); !ok {
+			c.report(SeverityError, "bbox must be an array of 2*n numbers")
+			return
+		}
+	}
+}
+
+// geometry checks a Geometry object found at path
+func (c *featureCheck) geometry(value any, path string) {
+	object, ok := value.(map[string]any)
+	if !ok {
+		c.report(SeverityError, "%s is not an object", path)
+		return
+	}
+	if bbox, ok := object["bbox"]; ok {
+		c.bbox(bbox)
+	}
+
+	geometryType, _ := object["type"].(string)
+	if geometryType == "GeometryCollection" {
+		members, ok := object["geometries"].([]any)
+		if !ok {
+			c.report(SeverityError, "%s: GeometryCollection has no geometries array", path)
+			return
+		}
+		for i, member := range members {
+			c.geometry(member, fmt.Sprintf("%s.geometries[%d]", path, i))
+		}
+		return
+	}
+
+	coordinates, ok := object["coordinates"]
+	if !ok {
+		c.report(SeverityError, "%s: coordinates member is missing", path)
+		return
+	}
+
+	switch geometryType {
+	case "Point":
+		c.position(coordinates, path)
+	case "MultiPoint":
+		c.positions(coordinates, path)
+	case "LineString":
+		c.lineString(coordinates, path)
+	case "MultiLineString":
+		for _, line := range c.array(coordinates, path) {
+			c.lineString(line, path)
+		}
+	case "Polygon":
+		c.polygon(coordinates, path)
+	case "MultiPolygon":
+		for _, polygon := range c.array(coordinates, path) {
+			c.polygon(polygon, path)
+		}
+	default:
+		c.report(SeverityError, "%s: unknown geometry type %v", path, jsonText(object["type"]))
+	}
+}
+
+// array returns the elements of a coordinates array, reporting anything else
+func (c *featureCheck) array(value any, path string) []any {
+	values, ok := value.([]any)
+	if !ok {
+		c.report(SeverityError, "%s: coordinates are not nested arrays of the geometry type", path)
+	}
+	return values
+}
+
+// position checks a position and returns it, or nil if it is invalid
+func (c *featureCheck) position(value any, path string) []float64 {
+	values, ok := value.([]any)
+	if !ok || len(values) < 2 {
+		c.report(SeverityError, "%s: positions must be arrays of at least 2 numbers", path)
+		return nil
+	}
+
+	position := make([]float64, len(values))
+	for i, v := range values {
+		number, ok := v.(float64)
+		if !ok {
+			c.report(SeverityError, "%s: position has a non-numeric element %v", path, jsonText(v))
+			return nil
+		}
+		position[i] = number
+	}
+
+	if len(position) > 3 {
+		c.report(SeverityWarning, "%s: positions have more than 3 elements", path)
+	}
+	c.dimensions[min(len(position), 3)] = true
+	if math.Abs(position[0]) > 180 {
+		c.report(SeverityError, "%s: longitude %v is out of range [-180, 180]", path, position[0])
+	}
+	if math.Abs(position[1]) > 90 {
+		c.report(SeverityError, "%s: latitude %v is out of range [-90, 90]", path, position[1])
+	}
+	return position
+}
+
+// positions checks an array of positions and returns the valid ones
+func (c *featureCheck) positions(value any, path string) [][]float64 {
+	var positions [][]float64
+	for _, v := range c.array(value, path) {
+		if position := c.position(v, path); position != nil {
+			positions = append(positions, position)
+		}
+	}
+	return positions
+}
+
+// lineString checks the coordinates of a LineString
+func (c *featureCheck) lineString(value any, path string) {
+	if positions := c.positions(value, path); len(positions) < 2 {
+		c.report(SeverityError, "%s: LineString has fewer than 2 positions", path)
+	}
+}
+
+// polygon checks the rings of a Polygon and their winding order: the exterior ring
+// counterclockwise and holes clockwise
+func (c *featureCheck) polygon(value any, path string) {
+	rings := c.array(value, path)
+	if len(rings) == 0 {
+		c.report(SeverityError, "%s: Polygon has no rings", path)
+	}
+	for i, ring := range rings {
+		positions := c.positions(ring, path)
+		if len(positions) < 4 {
+			c.report(SeverityError, "%s: polygon ring has fewer than 4 positions", path)
+			continue
+		}
+		first, last := positions[0], positions[len(positions)-1]
+		if first[0] != last[0] || first[1] != last[1] {
+			c.report(SeverityError, "%s: polygon ring is not closed, its first and last positions differ", path)
+			continue
+		}
+
+		area := ringArea(positions)
+		switch {
+		case i == 0 && area < 0:
+			c.report(SeverityWarning, "%s: exterior ring is clockwise, RFC 7946 expects counterclockwise", path)
+		case i > 0 && area > 0:
+			c.report(SeverityWarning, "%s: hole is counterclockwise, RFC 7946 expects clockwise", path)
+		}
+	}
+}
+
+// ringArea returns twice the signed area of a closed ring, positive if counterclockwise
+func ringArea(positions [][]float64) float64 {
+	area := 0.0
+	for i := 0; i < len(positions)-1; i++ {
+		area += positions[i][0]*positions[i+1][1] - positions[i+1][0]*positions[i][1]
+	}
+	return area
+}
+
+// jsonText renders a decoded JSON value for a message
+func jsonText(value any) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// lineCounter records the offsets of the newlines read through it, to map the input
+// offsets of a decoder to line numbers. Offsets must be queried in increasing order.
+type lineCounter struct {
+	r    io.Reader
+	read int64
+	// newlines holds the offsets of the newlines past the last queried offset.
+	newlines []int64
+	line     int
+}
+
+func (c *lineCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	for i, b := range p[:n] {
+		if b == '\n' {
+			c.newlines = append(c.newlines, c.read+int64(i))
+		}
+	}
+	c.read += int64(n)
+	return n, err
+}
+
+// lineAt returns the line, starting at 1, of an input offset
+func (c *lineCounter) lineAt(offset int64) int {
+	passed := sort.Search(len(c.newlines), func(i int) bool { return c.newlines[i] >= offset })
+	c.line += passed
+	c.newlines = c.newlines[passed:]
+	return c.line + 1
+}
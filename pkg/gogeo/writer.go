@@ -0,0 +1,286 @@
+package gogeo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// compressionCodecs maps the supported compression names to parquet-go codecs
+var compressionCodecs = map[string]compress.Codec{
+	"zstd":   &parquet.Zstd,
+	"snappy": &parquet.Snappy,
+	"gzip":   &parquet.Gzip,
+	"lz4":    &parquet.Lz4Raw,
+	"brotli": &parquet.Brotli,
+	"none":   &parquet.Uncompressed,
+}
+
+// writeBatchSize is the number of rows handed to parquet-go at a time, whose columns are
+// then written together.
+const writeBatchSize = 256
+
+// FeatureWriter writes GeoJSON features to a GeoParquet stream one at a time.
+// The geo metadata (geometry types and bounds) is maintained incrementally and
+// written to the file footer on Close.
+type FeatureWriter struct {
+	writer   *parquet.Writer
+	cfg      *config
+	records  *recordBuilder
+	metadata *metadataBuilder
+	// enums collects the values written to the enum columns, nil if there are none.
+	enums enumRecorder
+	// truncating truncates the statistics of the footer, nil to write it as it is.
+	truncating *truncatingWriter
+	// pages counts the bytes of the pages of the row group being written, nil without
+	// a memory budget, and breaks holds the rows starting a new row group, if any.
+	pages  *pageBuffers
+	breaks *rowGroupBreaks
+	// rows is the number of rows written, and pending those not yet handed to parquet-go.
+	rows    int
+	pending []parquet.Row
+	// empty is the number of features written with an empty geometry.
+	empty int
+	// identified reports whether a feature was written with its id in the id column.
+	identified bool
+}
+
+// NewFeatureWriter creates a FeatureWriter writing GeoParquet to w.
+// The schema lists the property columns; properties of written features that are
+// not part of the schema are ignored. Rows are written in the order of the calls, so
+// WithSpatialSort has no effect, and with WithSortBy the features must be written in
+// that order for the recorded sorting_columns to hold. WithCast replaces the types of
+// schema columns.
+func NewFeatureWriter(w io.Writer, schema []PropertyInfo, opts ...Option) (*FeatureWriter, error) {
+	cfg := newConfig(opts)
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	schema, err := cfg.castSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	return newFeatureWriter(w, schema, cfg)
+}
+
+func newFeatureWriter(w io.Writer, schema []PropertyInfo, cfg *config) (*FeatureWriter, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	if len(cfg.measures) > 0 && !geographicCRS(cfg.crs) {
+		return nil, AppError{Message: "area and length columns need longitudes and latitudes, but the CRS is not geographic"}
+	}
+	if len(cfg.cells) > 0 && !geographicCRS(cfg.crs) {
+		return nil, AppError{Message: "grid cell columns need longitudes and latitudes, but the CRS is not geographic"}
+	}
+	if cfg.splitAntimeridian && !geographicCRS(cfg.crs) {
+		return nil, AppError{Message: "splitting at the antimeridian needs longitudes and latitudes, but the CRS is not geographic"}
+	}
+
+	reserved := cfg.reservedColumns()
+	seen := make(map[string]bool, len(schema))
+	for _, info := range schema {
+		if reserved[info.Name] {
+			return nil, AppError{Message: fmt.Sprintf("property name %q is reserved", info.Name)}
+		}
+		if seen[info.Name] {
+			return nil, AppError{Message: fmt.Sprintf("duplicate property %q in schema", info.Name)}
+		}
+		seen[info.Name] = true
+	}
+	if err := cfg.checkEncodings(schema); err != nil {
+		return nil, err
+	}
+	if !cfg.requiredColumns {
+		schema = nullableSchema(schema)
+	}
+
+	parquetSchema := recordSchema(schema, cfg)
+
+	// Create writer with options
+	writerOpts := []parquet.WriterOption{
+		parquetSchema,
+		parquet.Compression(compressionCodecs[cfg.compression]),
+	}
+	if cfg.rowGroupSize > 0 {
+		writerOpts = append(writerOpts, parquet.MaxRowsPerRowGroup(cfg.rowGroupSize))
+	}
+	if cfg.pageSize > 0 {
+		writerOpts = append(writerOpts, parquet.PageBufferSize(cfg.pageSize))
+	}
+	writerOpts = append(writerOpts, cfg.versionOptions()...)
+	statisticsOpts, err := statisticsOptions(parquetSchema, cfg)
+	if err != nil {
+		return nil, err
+	}
+	writerOpts = append(writerOpts, statisticsOpts...)
+	var truncating *truncatingWriter
+	if cfg.statisticsLimit > 0 {
+		// The footer is truncated as the last write of an unbuffered writer
+		bufferSize := parquet.DefaultWriteBufferSize
+		if cfg.writeBufferSet {
+			bufferSize = cfg.writeBufferSize
+		}
+		truncating = newTruncatingWriter(w, bufferSize, cfg.statisticsLimit)
+		w = truncating
+		writerOpts = append(writerOpts, parquet.WriteBufferSize(0))
+	} else if cfg.writeBufferSet {
+		writerOpts = append(writerOpts, parquet.WriteBufferSize(cfg.writeBufferSize))
+	}
+	var pages *pageBuffers
+	if cfg.maxMemory > 0 {
+		pages = newPageBuffers()
+		writerOpts = append(writerOpts, parquet.ColumnPageBuffers(pages))
+	}
+	if len(cfg.sortBy) > 0 {
+		if _, err := sortColumnTypes(schema, cfg.sortBy); err != nil {
+			return nil, err
+		}
+		sorting := make([]parquet.SortingColumn, len(cfg.sortBy))
+		for i, column := range cfg.sortBy {
+			if column.Descending {
+				sorting[i] = parquet.Descending(column.Name)
+			} else {
+				sorting[i] = parquet.Ascending(column.Name)
+			}
+		}
+		writerOpts = append(writerOpts, parquet.SortingWriterConfig(parquet.SortingColumns(sorting...)))
+	}
+
+	return &FeatureWriter{
+		writer:     parquet.NewWriter(w, writerOpts...),
+		cfg:        cfg,
+		records:    newRecordBuilder(schema, cfg),
+		metadata:   newMetadataBuilder(cfg),
+		enums:      newEnumRecorder(schema),
+		truncating: truncating,
+		pages:      pages,
+		pending:    make([]parquet.Row, 0, writeBatchSize),
+	}, nil
+}
+
+// WriteFeature encodes a feature and appends it to the output.
+func (fw *FeatureWriter) WriteFeature(feature *geojson.Feature) error {
+	encoded, err := fw.encode(feature)
+	if err != nil {
+		return err
+	}
+	return fw.write(encoded)
+}
+
+// encodedFeature is a feature converted to a row, ready to be written
+type encodedFeature struct {
+	row        parquet.Row
+	geometries []orb.Geometry
+	properties map[string]any
+	identified bool
+}
+
+// encode converts a feature to a row. It does not modify the writer and is
+// safe to call concurrently.
+func (fw *FeatureWriter) encode(feature *geojson.Feature) (encodedFeature, error) {
+	geometries, err := featureGeometries(feature, fw.cfg)
+	if err != nil {
+		return encodedFeature{}, err
+	}
+
+	row, err := fw.records.build(feature, geometries)
+	if err != nil {
+		return encodedFeature{}, err
+	}
+
+	// The id column holds the id when the feature went through an idReader
+	identified := feature.ID != nil && reflect.DeepEqual(feature.Properties[fw.cfg.idColumn], feature.ID)
+	return encodedFeature{row: row, geometries: geometries, properties: feature.Properties, identified: identified}, nil
+}
+
+// write appends an encoded feature to the output and records it in the geo metadata
+func (fw *FeatureWriter) write(encoded encodedFeature) error {
+	// A row group ends at the end of a sorted run, or once its pages fill their share
+	// of the memory budget
+	if (fw.breaks != nil && fw.breaks.reached(fw.rows)) || (fw.pages != nil && fw.pages.size > 0 && fw.pages.size >= fw.cfg.memoryShare()) {
+		if err := fw.writePending(); err != nil {
+			return err
+		}
+		if err := fw.writer.Flush(); err != nil {
+			return fmt.Errorf("failed to flush row group: %w", err)
+		}
+	}
+	fw.pending = append(fw.pending, encoded.row)
+	fw.rows++
+	if len(fw.pending) == writeBatchSize {
+		if err := fw.writePending(); err != nil {
+			return err
+		}
+	}
+
+	fw.metadata.add(encoded.geometries)
+	if fw.enums != nil {
+		fw.enums.add(encoded.properties)
+	}
+	if emptyGeometry(encoded.geometries[0]) {
+		fw.empty++
+	}
+	fw.identified = fw.identified || encoded.identified
+	return nil
+}
+
+// writePending hands the pending rows to parquet-go
+func (fw *FeatureWriter) writePending() error {
+	if len(fw.pending) == 0 {
+		return nil
+	}
+	_, err := fw.writer.WriteRows(fw.pending)
+	clear(fw.pending)
+	fw.pending = fw.pending[:0]
+	if err != nil {
+		return fmt.Errorf("failed to write record: %w", err)
+	}
+	return nil
+}
+
+// Metadata returns the geo metadata describing the features written so far.
+func (fw *FeatureWriter) Metadata() *GeoParquet {
+	return fw.metadata.build()
+}
+
+// Close writes the geo metadata and flushes the remaining rows.
+// It does not close the underlying writer.
+func (fw *FeatureWriter) Close() error {
+	if err := fw.writePending(); err != nil {
+		return err
+	}
+
+	geoMetaJSON, err := json.Marshal(fw.Metadata())
+	if err != nil {
+		return fmt.Errorf("failed to marshal geo metadata: %w", err)
+	}
+
+	fw.writer.SetKeyValueMetadata(GeoParquetMetadataKey, string(geoMetaJSON))
+	if fw.enums != nil {
+		enumsJSON, err := fw.enums.metadata()
+		if err != nil {
+			return fmt.Errorf("failed to marshal enum metadata: %w", err)
+		}
+		fw.writer.SetKeyValueMetadata(EnumMetadataKey, enumsJSON)
+	}
+	// The ids are only restored from a column written from them
+	if fw.identified && slices.ContainsFunc(fw.records.properties, func(info PropertyInfo) bool { return info.Name == fw.cfg.idColumn }) {
+		fw.writer.SetKeyValueMetadata(IDMetadataKey, fw.cfg.idColumn)
+	}
+	if err := fw.writer.Close(); err != nil {
+		return err
+	}
+	if fw.truncating != nil {
+		return fw.truncating.Close()
+	}
+	return nil
+}